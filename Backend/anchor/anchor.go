@@ -0,0 +1,180 @@
+// Package anchor commits IDChain checkpoints to an external public chain, for
+// deployments which need auditability beyond the IDChain network. Bitcoin
+// anchors go in an OP_RETURN output, and Ethereum anchors go to the
+// CheckpointAnchor contract.
+//
+// Without an IDChain network, a Batcher anchors the DID operations directly,
+// in batches under one Merkle root, and resolution over an Anchored ledger
+// accepts operations with a valid inclusion proof only.
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Verification errors
+var (
+	ErrMismatch    = errors.New("anchor: checkpoint does not match external chain")
+	ErrUnconfirmed = errors.New("anchor: insufficient confirmations")
+	ErrNoAnchor    = errors.New("anchor: no checkpoint in transaction")
+)
+
+// Root is a state root hash.
+type Root [32]byte
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (r Root) MarshalText() ([]byte, error) {
+	return hex.AppendEncode(nil, r[:]), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (r *Root) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(r) {
+		return fmt.Errorf("anchor: root of %d hex digits, want 64", len(text))
+	}
+	_, err := hex.Decode(r[:], text)
+	return err
+}
+
+// Checkpoint is a commitment to the IDChain state at a height.
+type Checkpoint struct {
+	Height uint64 `json:"height"`
+	Root   Root   `json:"root"`
+}
+
+// PayloadMagic identifies anchor payloads.
+const payloadMagic = "IDC1"
+
+// PayloadSize is the number of bytes in an anchor payload, which is within
+// the 80-byte OP_RETURN limit of Bitcoin.
+const PayloadSize = len(payloadMagic) + 8 + 32
+
+// Payload returns the magic "IDC1", the height as big-endian, and the root.
+func (c *Checkpoint) Payload() []byte {
+	p := make([]byte, 0, PayloadSize)
+	p = append(p, payloadMagic...)
+	p = binary.BigEndian.AppendUint64(p, c.Height)
+	return append(p, c.Root[:]...)
+}
+
+// ParsePayload decodes the Payload format.
+func ParsePayload(p []byte) (*Checkpoint, error) {
+	if len(p) != PayloadSize || !bytes.HasPrefix(p, []byte(payloadMagic)) {
+		return nil, ErrNoAnchor
+	}
+	c := &Checkpoint{Height: binary.BigEndian.Uint64(p[4:12])}
+	copy(c.Root[:], p[12:])
+	return c, nil
+}
+
+// Chain is an external blockchain.
+type Chain interface {
+	// Name identifies the chain, e.g., "bitcoin".
+	Name() string
+	// Anchor publishes a checkpoint, and it returns the transaction ID.
+	Anchor(ctx context.Context, c *Checkpoint) (txID string, err error)
+	// Lookup returns the checkpoint in a transaction, with the number of
+	// confirmations. Zero confirmations means not mined [yet].
+	Lookup(ctx context.Context, txID string) (c *Checkpoint, confirmations int64, err error)
+}
+
+// Receipt is proof of an anchoring.
+type Receipt struct {
+	Chain string `json:"chain"`
+	TxID  string `json:"txid"`
+	Checkpoint
+	Time time.Time `json:"time"`
+}
+
+// Verify confirms that the local checkpoint matches the anchor of receipt on
+// chain, with at least minConfirmations.
+func Verify(ctx context.Context, chain Chain, local *Checkpoint, receipt *Receipt, minConfirmations int64) error {
+	if receipt.Chain != chain.Name() {
+		return fmt.Errorf("anchor: receipt for chain %q, verifier on %q", receipt.Chain, chain.Name())
+	}
+	anchored, confirmations, err := chain.Lookup(ctx, receipt.TxID)
+	if err != nil {
+		return err
+	}
+	if *anchored != *local {
+		return fmt.Errorf("%w: transaction %s has height %d root %x, local height %d root %x",
+			ErrMismatch, receipt.TxID, anchored.Height, anchored.Root[:], local.Height, local.Root[:])
+	}
+	if confirmations < minConfirmations {
+		return fmt.Errorf("%w: transaction %s has %d, want %d",
+			ErrUnconfirmed, receipt.TxID, confirmations, minConfirmations)
+	}
+	return nil
+}
+
+// Anchorer publishes checkpoints periodically.
+type Anchorer struct {
+	Chain Chain
+
+	// Checkpoint returns the current state.
+	Checkpoint func() (*Checkpoint, error)
+
+	Interval time.Duration  // default 1 h
+	OnAnchor func(*Receipt) // e.g., to persist receipts
+	Log      *slog.Logger   // nil for slog.Default
+
+	last uint64 // height anchored
+}
+
+func (a *Anchorer) log() *slog.Logger {
+	if a.Log != nil {
+		return a.Log
+	}
+	return slog.Default()
+}
+
+// Anchor publishes the current checkpoint. The receipt is nil when the height
+// was anchored already.
+func (a *Anchorer) Anchor(ctx context.Context) (*Receipt, error) {
+	c, err := a.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	if c.Height <= a.last {
+		return nil, nil
+	}
+	txID, err := a.Chain.Anchor(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("anchor at height %d on %s: %w", c.Height, a.Chain.Name(), err)
+	}
+	a.last = c.Height
+	r := &Receipt{Chain: a.Chain.Name(), TxID: txID, Checkpoint: *c, Time: time.Now()}
+	a.log().Info("checkpoint anchored", "chain", r.Chain, "txid", txID, "height", c.Height)
+	if a.OnAnchor != nil {
+		a.OnAnchor(r)
+	}
+	return r, nil
+}
+
+// Run anchors on each interval until ctx is done. Failures are logged, and
+// retried on the next interval.
+func (a *Anchorer) Run(ctx context.Context) {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := a.Anchor(ctx); err != nil {
+			a.log().Error("checkpoint anchoring failed", "chain", a.Chain.Name(), "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
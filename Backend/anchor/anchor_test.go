@@ -0,0 +1,249 @@
+package anchor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// FakeNode answers JSON-RPC with a result per method.
+func fakeNode(t *testing.T, results map[string]any) *RPC {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64  `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error("fake node got malformed request:", err)
+		}
+		result, ok := results[req.Method]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "error": map[string]any{"code": -32601, "message": "Method not found"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return &RPC{URL: srv.URL}
+}
+
+var testCheckpoint = Checkpoint{Height: 1234, Root: Root{0xde, 0xad, 0xbe, 0xef}}
+
+func TestPayload(t *testing.T) {
+	p := testCheckpoint.Payload()
+	if len(p) != PayloadSize || PayloadSize > 80 {
+		t.Fatalf("got payload of %d bytes, want %d within the OP_RETURN limit", len(p), PayloadSize)
+	}
+	got, err := ParsePayload(p)
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+	if *got != testCheckpoint {
+		t.Errorf("got %+v, want %+v", got, testCheckpoint)
+	}
+
+	text, err := json.Marshal(&testCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"height":1234,"root":"deadbeef00000000000000000000000000000000000000000000000000000000"}`
+	if string(text) != want {
+		t.Errorf("got JSON %s, want %s", text, want)
+	}
+}
+
+func TestBitcoin(t *testing.T) {
+	script := "6a2c" + hex.EncodeToString(testCheckpoint.Payload())
+	b := &Bitcoin{RPC: fakeNode(t, map[string]any{
+		"createrawtransaction":         "0200",
+		"fundrawtransaction":           map[string]any{"hex": "0201"},
+		"signrawtransactionwithwallet": map[string]any{"hex": "0202", "complete": true},
+		"sendrawtransaction":           "f00d",
+		"getrawtransaction": map[string]any{
+			"confirmations": 3,
+			"vout": []any{
+				map[string]any{"scriptPubKey": map[string]any{"hex": "0014aabbccddeeff00112233445566778899aabbccdd"}},
+				map[string]any{"scriptPubKey": map[string]any{"hex": script}},
+			},
+		},
+	})}
+
+	a := &Anchorer{Chain: b, Checkpoint: func() (*Checkpoint, error) { return &testCheckpoint, nil }}
+	r, err := a.Anchor(context.Background())
+	if err != nil {
+		t.Fatal("anchor error:", err)
+	}
+	if r.TxID != "f00d" || r.Chain != "bitcoin" {
+		t.Errorf("got receipt %+v", r)
+	}
+	if again, err := a.Anchor(context.Background()); again != nil || err != nil {
+		t.Errorf("same height got receipt %+v, error %v, want neither", again, err)
+	}
+
+	if err := Verify(context.Background(), b, &testCheckpoint, r, 3); err != nil {
+		t.Error("verify error:", err)
+	}
+	if err := Verify(context.Background(), b, &testCheckpoint, r, 6); !errors.Is(err, ErrUnconfirmed) {
+		t.Errorf("verify with 6 confirmations got error %v, want ErrUnconfirmed", err)
+	}
+	other := testCheckpoint
+	other.Root[0] ^= 1
+	if err := Verify(context.Background(), b, &other, r, 1); !errors.Is(err, ErrMismatch) {
+		t.Errorf("verify of other root got error %v, want ErrMismatch", err)
+	}
+}
+
+func TestEthereum(t *testing.T) {
+	const contract = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	input := "0x" + hex.EncodeToString(anchorSelector) +
+		"00000000000000000000000000000000000000000000000000000000000004d2" +
+		hex.EncodeToString(testCheckpoint.Root[:])
+	e := &Ethereum{Contract: contract, RPC: fakeNode(t, map[string]any{
+		"eth_getTransactionByHash":  map[string]any{"to": "0x5fbdb2315678afecb367f032d93f642f64180aa3", "input": input},
+		"eth_getTransactionReceipt": map[string]any{"status": "0x1", "blockNumber": "0x10"},
+		"eth_blockNumber":           "0x1b",
+	})}
+	c, confirmations, err := e.Lookup(context.Background(), "0xabc")
+	if err != nil {
+		t.Fatal("lookup error:", err)
+	}
+	if *c != testCheckpoint || confirmations != 12 {
+		t.Errorf("got %+v with %d confirmations, want %+v with 12", c, confirmations, testCheckpoint)
+	}
+
+	e.Contract = "0x0000000000000000000000000000000000000001"
+	if _, _, err := e.Lookup(context.Background(), "0xabc"); !errors.Is(err, ErrNoAnchor) {
+		t.Errorf("other contract got error %v, want ErrNoAnchor", err)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	// well-known ERC-20 selector
+	if got := hex.EncodeToString(selector("transfer(address,uint256)")); got != "a9059cbb" {
+		t.Errorf("got selector %s, want a9059cbb", got)
+	}
+}
+
+func TestRPCError(t *testing.T) {
+	err := fakeNode(t, nil).Call(context.Background(), nil, "getblockcount")
+	var e *RPCError
+	if !errors.As(err, &e) || e.Code != -32601 {
+		t.Errorf("got error %v, want RPCError -32601", err)
+	}
+}
+
+// MemoryChain is a Chain with all transactions at a fixed confirmation count.
+type memoryChain struct {
+	anchors       []Checkpoint
+	confirmations int64
+}
+
+func (m *memoryChain) Name() string { return "memory" }
+
+func (m *memoryChain) Anchor(_ context.Context, c *Checkpoint) (string, error) {
+	m.anchors = append(m.anchors, *c)
+	return fmt.Sprint(len(m.anchors) - 1), nil
+}
+
+func (m *memoryChain) Lookup(_ context.Context, txID string) (*Checkpoint, int64, error) {
+	var i int
+	if _, err := fmt.Sscan(txID, &i); err != nil || i < 0 || i >= len(m.anchors) {
+		return nil, 0, ErrNoAnchor
+	}
+	return &m.anchors[i], m.confirmations, nil
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	ext := &memoryChain{confirmations: 6}
+	proofs := new(MemoryProofs)
+	batcher := &Batcher{Chain: ext, MaxSize: 2, OnBatch: func(b *Batch) {
+		if err := proofs.Add(b); err != nil {
+			t.Error("proofs add:", err)
+		}
+	}}
+	ledger := &Ledger{Ledger: new(idchain.Memory), Batcher: batcher}
+	anchored := &Anchored{Ledger: ledger, Proofs: proofs, Chain: ext, MinConfirmations: 6}
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := backend.URL{DID: idchain.Placeholder, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, idchain.Placeholder, pub, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	genesis, did, err := idchain.NewGenesis(&backend.Document{
+		Subject:              idchain.Placeholder,
+		VerificationMethods:  []*backend.VerificationMethod{m},
+		CapabilityInvocation: &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}},
+	}, &id, key, t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idchain.Submit(ctx, ledger, genesis); err != nil {
+		t.Fatal("submit genesis:", err)
+	}
+	resolver := &idchain.Resolver{Ledger: anchored}
+	if _, _, err := resolver.Resolve(ctx, did); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("resolve before anchoring got error %v, want ErrNotFound", err)
+	}
+
+	// batch of genesis and an unrelated entry
+	batcher.Add("other")
+	if b, err := batcher.Flush(ctx); err != nil || b.Height != 1 || len(b.Entries) != 2 {
+		t.Fatalf("flush got batch %+v, error %v", b, err)
+	}
+	keyID := &backend.URL{DID: did, RawFragment: "#key-1"}
+	update, err := idchain.NewUpdate(genesis, &backend.Document{Subject: did, AlsoKnownAs: []string{"https://example.com"}}, keyID, key, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idchain.Submit(ctx, ledger, update); err != nil {
+		t.Fatal("submit update:", err)
+	}
+	if _, meta, err := resolver.Resolve(ctx, did); err != nil || meta.VersionID != "1" {
+		t.Errorf("resolve with unanchored update got meta %+v, error %v", meta, err)
+	}
+	if b, err := batcher.Flush(ctx); err != nil || b.Height != 2 || len(b.Entries) != 1 {
+		t.Fatalf("second flush got batch %+v, error %v", b, err)
+	}
+	if doc, meta, err := resolver.Resolve(ctx, did); err != nil || meta.VersionID != "2" || len(doc.AlsoKnownAs) != 1 {
+		t.Errorf("resolve anchored update got meta %+v, error %v", meta, err)
+	}
+	if b, err := batcher.Flush(ctx); b != nil || err != nil {
+		t.Errorf("empty flush got batch %+v, error %v", b, err)
+	}
+
+	p, err := proofs.Proof(ctx, idchain.Hash(genesis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Verify(ctx, ext, update, 1); !errors.Is(err, chain.ErrProof) {
+		t.Errorf("proof of other entry got error %v, want ErrProof", err)
+	}
+	ext.confirmations = 1
+	if _, _, err := resolver.Resolve(ctx, did); !errors.Is(err, ErrUnconfirmed) {
+		t.Errorf("resolve with 1 confirmation got error %v, want ErrUnconfirmed", err)
+	}
+	ext.confirmations = 6
+	ext.anchors[1].Root[0] ^= 1
+	if _, _, err := resolver.Resolve(ctx, did); !errors.Is(err, ErrMismatch) {
+		t.Errorf("resolve with altered anchor got error %v, want ErrMismatch", err)
+	}
+}
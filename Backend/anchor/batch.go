@@ -0,0 +1,270 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+// Batch is a set of DID operations anchored as one checkpoint, Sidetree
+// style. The checkpoint has the batch sequence number as its height, and the
+// Merkle root of the operations, as in chain.MerkleRoot, as its root.
+type Batch struct {
+	Receipt
+	Entries []string `json:"entries"` // did:idchain log entries
+}
+
+// Proof returns the inclusion proof of entry i.
+func (b *Batch) Proof(i int) (*OperationProof, error) {
+	block := batchBlock(b.Height, b.Entries)
+	p, err := block.Proof(i)
+	if err != nil {
+		return nil, err
+	}
+	return &OperationProof{Receipt: b.Receipt, Proof: *p}, nil
+}
+
+// BatchBlock holds entries for the Merkle computations of package chain.
+func batchBlock(seq uint64, entries []string) *chain.Block {
+	txs := make([]chain.Transaction, len(entries))
+	for i, e := range entries {
+		txs[i].Entry = e
+	}
+	b := chain.NewBlock(nil, txs, time.Time{})
+	b.Height = seq
+	return b
+}
+
+// OperationProof is the inclusion of a DID operation in an anchored batch.
+type OperationProof struct {
+	Receipt Receipt     `json:"receipt"`
+	Proof   chain.Proof `json:"proof"`
+}
+
+// Verify checks that entry is in the batch of the receipt, and that the
+// batch is anchored on c with at least minConfirmations.
+func (p *OperationProof) Verify(ctx context.Context, c Chain, entry string, minConfirmations int64) error {
+	if err := p.include(entry); err != nil {
+		return err
+	}
+	return Verify(ctx, c, &p.Receipt.Checkpoint, &p.Receipt, minConfirmations)
+}
+
+// Include checks the Merkle proof of entry against the receipt root.
+func (p *OperationProof) include(entry string) error {
+	header := chain.Header{Height: p.Receipt.Height, MerkleRoot: chain.Hash(p.Receipt.Root)}
+	return p.Proof.Verify(&header, &chain.Transaction{Entry: entry})
+}
+
+// ProofStore provides operation proofs by the idchain.Hash of their entry.
+type ProofStore interface {
+	// Proof returns ErrNoAnchor for operations not anchored [yet].
+	Proof(ctx context.Context, hash string) (*OperationProof, error)
+}
+
+// MemoryProofs is a ProofStore in memory. The zero value is ready to use.
+// Multiple goroutines may invoke methods on a MemoryProofs simultaneously.
+type MemoryProofs struct {
+	mutex  sync.RWMutex
+	proofs map[string]*OperationProof
+}
+
+// Add registers the proofs of each operation in b.
+func (m *MemoryProofs) Add(b *Batch) error {
+	proofs := make(map[string]*OperationProof, len(b.Entries))
+	for i, e := range b.Entries {
+		p, err := b.Proof(i)
+		if err != nil {
+			return err
+		}
+		proofs[idchain.Hash(e)] = p
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.proofs == nil {
+		m.proofs = make(map[string]*OperationProof)
+	}
+	for hash, p := range proofs {
+		m.proofs[hash] = p
+	}
+	return nil
+}
+
+// Proof implements the ProofStore interface.
+func (m *MemoryProofs) Proof(_ context.Context, hash string) (*OperationProof, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	p, ok := m.proofs[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: operation %s", ErrNoAnchor, hash)
+	}
+	return p, nil
+}
+
+// Batcher anchors DID operations in batches. Multiple goroutines may invoke
+// methods on a Batcher simultaneously.
+type Batcher struct {
+	Chain Chain
+
+	Interval time.Duration // default 10 min
+	MaxSize  int           // operations per batch, default 10 000
+
+	// Sequence is the number of batches anchored before. Persist it across
+	// restarts, such that each batch height is unique.
+	Sequence uint64
+
+	OnBatch func(*Batch) // e.g., to MemoryProofs.Add
+	Log     *slog.Logger // nil for slog.Default
+
+	flushMutex sync.Mutex // one batch at a time, for the sequence
+	mutex      sync.Mutex
+	pending    []string
+}
+
+func (b *Batcher) log() *slog.Logger {
+	if b.Log != nil {
+		return b.Log
+	}
+	return slog.Default()
+}
+
+func (b *Batcher) maxSize() int {
+	if b.MaxSize > 0 {
+		return b.MaxSize
+	}
+	return 10000
+}
+
+// Add queues a log entry for the next batch.
+func (b *Batcher) Add(entry string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.pending = append(b.pending, entry)
+}
+
+// Flush anchors the operations queued. The batch is nil without operations.
+// Operations remain queued on error.
+func (b *Batcher) Flush(ctx context.Context) (*Batch, error) {
+	b.flushMutex.Lock()
+	defer b.flushMutex.Unlock()
+	b.mutex.Lock()
+	n := min(len(b.pending), b.maxSize())
+	entries := b.pending[:n:n]
+	b.mutex.Unlock()
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	seq := b.Sequence + 1
+	c := &Checkpoint{Height: seq, Root: Root(batchBlock(seq, entries).MerkleRoot)}
+	txID, err := b.Chain.Anchor(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("anchor of batch %d on %s: %w", seq, b.Chain.Name(), err)
+	}
+	b.Sequence = seq
+	b.mutex.Lock()
+	b.pending = b.pending[len(entries):]
+	b.mutex.Unlock()
+	batch := &Batch{
+		Receipt: Receipt{Chain: b.Chain.Name(), TxID: txID, Checkpoint: *c, Time: time.Now()},
+		Entries: entries,
+	}
+	b.log().Info("operation batch anchored", "chain", batch.Chain, "txid", txID, "batch", seq, "operations", len(entries))
+	if b.OnBatch != nil {
+		b.OnBatch(batch)
+	}
+	return batch, nil
+}
+
+// Run flushes on each interval until ctx is done. Failures are logged, and
+// retried on the next interval.
+func (b *Batcher) Run(ctx context.Context) {
+	interval := b.Interval
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			batch, err := b.Flush(ctx)
+			if err != nil {
+				b.log().Error("operation batch anchoring failed", "chain", b.Chain.Name(), "error", err)
+			}
+			if batch == nil || len(batch.Entries) < b.maxSize() {
+				break
+			}
+		}
+	}
+}
+
+// Ledger is an idchain.Ledger which queues each operation appended on a
+// Batcher.
+type Ledger struct {
+	idchain.Ledger
+	Batcher *Batcher
+}
+
+// Append implements the idchain.Ledger interface.
+func (l *Ledger) Append(ctx context.Context, did backend.DID, n int, entry string) error {
+	if err := l.Ledger.Append(ctx, did, n, entry); err != nil {
+		return err
+	}
+	l.Batcher.Add(entry)
+	return nil
+}
+
+// Anchored is an idchain.Ledger which reads the operations with a valid
+// anchor only. Logs end before the first operation without one, such that an
+// idchain.Resolver on Anchored resolves the anchored state.
+type Anchored struct {
+	idchain.Ledger
+	Proofs           ProofStore
+	Chain            Chain
+	MinConfirmations int64
+}
+
+// Entries implements the idchain.Ledger interface.
+func (a *Anchored) Entries(ctx context.Context, did backend.DID) ([]string, error) {
+	entries, err := a.Ledger.Entries(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	verified := make(map[string]Checkpoint) // by anchor transaction
+	for i, e := range entries {
+		p, err := a.Proofs.Proof(ctx, idchain.Hash(e))
+		if errors.Is(err, ErrNoAnchor) {
+			if i == 0 {
+				return nil, fmt.Errorf("%w: %s has no anchored operations", backend.ErrNotFound, did.String())
+			}
+			return entries[:i:i], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := verified[p.Receipt.TxID]; !ok {
+			err = p.Verify(ctx, a.Chain, e, a.MinConfirmations)
+		} else if c != p.Receipt.Checkpoint {
+			err = fmt.Errorf("%w: receipts of transaction %s differ", ErrMismatch, p.Receipt.TxID)
+		} else {
+			err = p.include(e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d of %s: %w", i+1, did.String(), err)
+		}
+		verified[p.Receipt.TxID] = p.Receipt.Checkpoint
+	}
+	return entries, nil
+}
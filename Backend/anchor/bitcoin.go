@@ -0,0 +1,93 @@
+package anchor
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Bitcoin anchors with an OP_RETURN output. The transaction is funded and
+// signed by the wallet of the node. Lookup of transactions outside the wallet
+// requires the node to run with -txindex.
+type Bitcoin struct {
+	RPC *RPC
+}
+
+// Name implements the Chain interface.
+func (b *Bitcoin) Name() string { return "bitcoin" }
+
+// Anchor implements the Chain interface.
+func (b *Bitcoin) Anchor(ctx context.Context, c *Checkpoint) (txID string, err error) {
+	var raw string
+	outputs := []map[string]string{{"data": hex.EncodeToString(c.Payload())}}
+	if err := b.RPC.Call(ctx, &raw, "createrawtransaction", []any{}, outputs); err != nil {
+		return "", err
+	}
+	var funded struct {
+		Hex string `json:"hex"`
+	}
+	if err := b.RPC.Call(ctx, &funded, "fundrawtransaction", raw); err != nil {
+		return "", err
+	}
+	var signed struct {
+		Hex      string `json:"hex"`
+		Complete bool   `json:"complete"`
+	}
+	if err := b.RPC.Call(ctx, &signed, "signrawtransactionwithwallet", funded.Hex); err != nil {
+		return "", err
+	}
+	if !signed.Complete {
+		return "", errors.New("anchor: bitcoin wallet could not sign all inputs")
+	}
+	err = b.RPC.Call(ctx, &txID, "sendrawtransaction", signed.Hex)
+	return txID, err
+}
+
+// Lookup implements the Chain interface.
+func (b *Bitcoin) Lookup(ctx context.Context, txID string) (*Checkpoint, int64, error) {
+	var tx struct {
+		Vout []struct {
+			ScriptPubKey struct {
+				Hex string `json:"hex"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+		Confirmations int64 `json:"confirmations"`
+	}
+	if err := b.RPC.Call(ctx, &tx, "getrawtransaction", txID, true); err != nil {
+		return nil, 0, err
+	}
+	for _, out := range tx.Vout {
+		script, err := hex.DecodeString(out.ScriptPubKey.Hex)
+		if err != nil {
+			return nil, 0, fmt.Errorf("anchor: bitcoin output script: %w", err)
+		}
+		if data, ok := opReturnData(script); ok {
+			if c, err := ParsePayload(data); err == nil {
+				return c, tx.Confirmations, nil
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("%w %s", ErrNoAnchor, txID)
+}
+
+// OpReturnData returns the pushed data of a null data script.
+func opReturnData(script []byte) ([]byte, bool) {
+	const opReturn, opPushData1 = 0x6a, 0x4c
+	if len(script) < 2 || script[0] != opReturn {
+		return nil, false
+	}
+	n, data := int(script[1]), script[2:]
+	switch {
+	case n < opPushData1:
+		break
+	case n == opPushData1 && len(data) != 0:
+		n, data = int(data[0]), data[1:]
+	default:
+		return nil, false
+	}
+	if len(data) != n {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,99 @@
+package anchor
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Ethereum anchors with the CheckpointAnchor contract. Transactions are
+// signed by the node, with From as an unlocked account which owns Contract.
+type Ethereum struct {
+	RPC      *RPC
+	From     string // account address
+	Contract string // CheckpointAnchor address
+}
+
+// AnchorSelector is the function selector of anchor(uint64,bytes32).
+var anchorSelector = selector("anchor(uint64,bytes32)")
+
+// Selector returns the first 4 bytes of the Keccak-256 of a function
+// signature.
+func selector(signature string) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(signature))
+	return h.Sum(nil)[:4]
+}
+
+// Name implements the Chain interface.
+func (e *Ethereum) Name() string { return "ethereum" }
+
+// Anchor implements the Chain interface.
+func (e *Ethereum) Anchor(ctx context.Context, c *Checkpoint) (txID string, err error) {
+	input := make([]byte, 4+32+32)
+	copy(input, anchorSelector)
+	binary.BigEndian.PutUint64(input[4+24:], c.Height)
+	copy(input[4+32:], c.Root[:])
+	tx := map[string]string{
+		"from": e.From,
+		"to":   e.Contract,
+		"data": "0x" + hex.EncodeToString(input),
+	}
+	err = e.RPC.Call(ctx, &txID, "eth_sendTransaction", tx)
+	return txID, err
+}
+
+// Lookup implements the Chain interface. Transactions which reverted, or
+// which went to another contract, do not count.
+func (e *Ethereum) Lookup(ctx context.Context, txID string) (*Checkpoint, int64, error) {
+	var tx struct {
+		To    string `json:"to"`
+		Input string `json:"input"`
+	}
+	if err := e.RPC.Call(ctx, &tx, "eth_getTransactionByHash", txID); err != nil {
+		return nil, 0, err
+	}
+	if !strings.EqualFold(tx.To, e.Contract) {
+		return nil, 0, fmt.Errorf("%w %s: recipient %q is not contract %q", ErrNoAnchor, txID, tx.To, e.Contract)
+	}
+	input, err := hex.DecodeString(strings.TrimPrefix(tx.Input, "0x"))
+	if err != nil || len(input) != 4+32+32 || string(input[:4]) != string(anchorSelector) {
+		return nil, 0, fmt.Errorf("%w %s: input is not an anchor call", ErrNoAnchor, txID)
+	}
+	for _, b := range input[4 : 4+24] {
+		if b != 0 {
+			return nil, 0, fmt.Errorf("%w %s: height exceeds 64 bits", ErrNoAnchor, txID)
+		}
+	}
+	c := &Checkpoint{Height: binary.BigEndian.Uint64(input[4+24:])}
+	copy(c.Root[:], input[4+32:])
+
+	var receipt *struct {
+		Status      string `json:"status"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := e.RPC.Call(ctx, &receipt, "eth_getTransactionReceipt", txID); err != nil {
+		return nil, 0, err
+	}
+	if receipt == nil {
+		return c, 0, nil // pending
+	}
+	if receipt.Status != "0x1" {
+		return nil, 0, fmt.Errorf("%w %s: transaction reverted", ErrNoAnchor, txID)
+	}
+	var head string
+	if err := e.RPC.Call(ctx, &head, "eth_blockNumber"); err != nil {
+		return nil, 0, err
+	}
+	mined, err1 := strconv.ParseInt(strings.TrimPrefix(receipt.BlockNumber, "0x"), 16, 64)
+	latest, err2 := strconv.ParseInt(strings.TrimPrefix(head, "0x"), 16, 64)
+	if err1 != nil || err2 != nil {
+		return nil, 0, fmt.Errorf("anchor: malformed block numbers %q and %q", receipt.BlockNumber, head)
+	}
+	return c, latest - mined + 1, nil
+}
@@ -0,0 +1,85 @@
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// RPC is a JSON-RPC client for blockchain nodes, such as bitcoind and geth.
+type RPC struct {
+	URL            string
+	User, Password string       // HTTP basic authentication, if any
+	HTTP           *http.Client // nil for http.DefaultClient
+
+	lastID atomic.Int64
+}
+
+// RPCError is an error response.
+type RPCError struct {
+	Method  string `json:"-"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("anchor: %s RPC error %d: %s", e.Method, e.Code, e.Message)
+}
+
+// Call invokes method, and it decodes the result into out.
+func (c *RPC) Call(ctx context.Context, out any, method string, params ...any) error {
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      c.lastID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.User != "" || c.Password != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("anchor: %s RPC: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	// bitcoind sends errors with HTTP status 500 and a JSON body
+	var r struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&r); err != nil {
+		return fmt.Errorf("anchor: %s RPC response with HTTP status %q: %w", method, resp.Status, err)
+	}
+	if r.Error != nil {
+		r.Error.Method = method
+		return r.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return fmt.Errorf("anchor: %s RPC result: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// APIKeyHeader is the HTTP header for API keys.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeys authenticates with static keys. Only hashes of the keys are kept.
+type APIKeys struct {
+	entries []apiKey
+}
+
+type apiKey struct {
+	hash      [sha256.Size]byte
+	principal *Principal
+}
+
+// NewAPIKeys returns the authenticator of a configuration.
+func NewAPIKeys(config map[string]APIKeyConfig) (*APIKeys, error) {
+	keys := new(APIKeys)
+	for name, c := range config {
+		h, err := hex.DecodeString(c.SHA256)
+		if err != nil || len(h) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: malformed SHA-256 %q", name, c.SHA256)
+		}
+		e := apiKey{principal: &Principal{ID: name, Scheme: "api-key", Roles: c.Roles}}
+		copy(e.hash[:], h)
+		keys.entries = append(keys.entries, e)
+	}
+	return keys, nil
+}
+
+// Authenticate implements the Authenticator interface.
+func (keys *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+	h := sha256.Sum256([]byte(key))
+	// constant time over all entries
+	var match *Principal
+	for i := range keys.entries {
+		if subtle.ConstantTimeCompare(h[:], keys.entries[i].hash[:]) == 1 {
+			match = keys.entries[i].principal
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%w: unknown API key", ErrUnauthenticated)
+	}
+	return match, nil
+}
+
+// DIDAuthMaxAgeDefault applies when DIDAuth.MaxAge is zero.
+const DIDAuthMaxAgeDefault = 5 * time.Minute
+
+// DIDAuth authenticates with a bearer token: a compact JWS signed by an
+// authentication method of the issuer DID. The key ID must be a DID URL of
+// the issuer.
+//
+//	{"iss": "did:example:alice", "aud": "https://idchain.example", "iat": 1700000000, "exp": 1700000060}
+//
+// Tokens are not tracked, so they may be replayed until they expire. Keep the
+// lifetime short.
+type DIDAuth struct {
+	Resolver backend.Resolver
+	Audience string
+
+	// Roles maps DIDs to their roles. Unlisted DIDs authenticate without
+	// roles.
+	Roles map[string][]Role
+
+	MaxAge time.Duration // limit on the token lifetime
+}
+
+// Token is the payload of a DID Auth bearer token.
+type Token struct {
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+
+	// Nonce binds the token to a challenge, if any, as in
+	// AuthenticateConn.
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// Authenticate implements the Authenticator interface.
+func (a *DIDAuth) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, nil
+	}
+	did, err := a.Verify(r.Context(), token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{ID: did.String(), Scheme: "did-auth", Roles: a.Roles[did.String()]}, nil
+}
+
+// Verify returns the issuer of a valid token.
+func (a *DIDAuth) Verify(ctx context.Context, token string, now time.Time) (backend.DID, error) {
+	did, _, err := a.verify(ctx, token, now)
+	return did, err
+}
+
+// Verify returns the issuer of a valid token, with its claims.
+func (a *DIDAuth) verify(ctx context.Context, token string, now time.Time) (backend.DID, *Token, error) {
+	jws, err := jose.ParseCompact(token)
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	var t Token
+	if err := json.Unmarshal(jws.Payload, &t); err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: token payload: %w", ErrUnauthenticated, err)
+	}
+	did, err := backend.Parse(t.Issuer)
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: token issuer: %w", ErrUnauthenticated, err)
+	}
+	keyID, err := backend.ParseURL(jws.Header.Kid)
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: token kid: %w", ErrUnauthenticated, err)
+	}
+	if !keyID.DID.Equal(did) {
+		return backend.DID{}, nil, fmt.Errorf("%w: key %s not of issuer %s", ErrUnauthenticated, jws.Header.Kid, t.Issuer)
+	}
+
+	if t.Audience != a.Audience {
+		return backend.DID{}, nil, fmt.Errorf("%w: token audience %q", ErrUnauthenticated, t.Audience)
+	}
+	maxAge := a.MaxAge
+	if maxAge <= 0 {
+		maxAge = DIDAuthMaxAgeDefault
+	}
+	iat, exp := time.Unix(t.IssuedAt, 0), time.Unix(t.Expires, 0)
+	if t.IssuedAt == 0 || t.Expires == 0 || !now.Before(exp) || now.Add(time.Minute).Before(iat) || exp.Sub(iat) > maxAge {
+		return backend.DID{}, nil, fmt.Errorf("%w: token expired or not within lifetime limit", ErrUnauthenticated)
+	}
+
+	doc, _, err := a.Resolver.Resolve(ctx, did)
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("DID Auth issuer resolution: %w", err)
+	}
+	m := doc.AuthorizedMethod(doc.Authentication, keyID)
+	if m == nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: no authentication method %s in DID document", ErrUnauthenticated, jws.Header.Kid)
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	if err := jws.Verify(pub); err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	return did, &t, nil
+}
+
+// Authenticator returns API key and DID Auth authentication conform c.
+func (c *Config) Authenticator(resolver backend.Resolver, audience string) (Authenticator, error) {
+	keys, err := NewAPIKeys(c.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	return Authenticators{keys, &DIDAuth{Resolver: resolver, Audience: audience, Roles: c.DIDs}}, nil
+}
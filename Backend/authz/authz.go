@@ -0,0 +1,237 @@
+// Package authz provides role-based access control for the resolver,
+// registrar and admin APIs. Principals authenticate with an API key or with
+// DID Auth, and a Policy maps their roles to operations. The HTTP middleware
+// is in Handler, and RPC servers apply Policy.Authorize with the full method
+// name as path.
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Role is a named set of permissions. Roles are ordered: each role includes
+// the permissions of its predecessors.
+type Role string
+
+// Defined roles in ascending order
+const (
+	Resolver  Role = "resolver"  // read DID documents
+	Registrar Role = "registrar" // create, update and deactivate DIDs
+	Admin     Role = "admin"     // operate the service
+)
+
+var roleRank = map[Role]int{Resolver: 1, Registrar: 2, Admin: 3}
+
+// Includes returns whether r grants the permissions of other.
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[other] && roleRank[other] != 0
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (r *Role) UnmarshalText(text []byte) error {
+	if _, ok := roleRank[Role(text)]; !ok {
+		return fmt.Errorf("unknown role %q", text)
+	}
+	*r = Role(text)
+	return nil
+}
+
+// Principal is an authenticated party.
+type Principal struct {
+	ID     string // API key name or DID
+	Scheme string // "api-key" or "did-auth"
+	Roles  []Role
+}
+
+// Has returns whether the principal has a role which includes r.
+func (p *Principal) Has(r Role) bool {
+	for _, role := range p.Roles {
+		if role.Includes(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnauthenticated signals a request without valid credentials.
+var ErrUnauthenticated = errors.New("authentication required")
+
+// ErrForbidden signals a principal without the required role.
+var ErrForbidden = errors.New("permission denied")
+
+// Rule requires a role for matching operations.
+type Rule struct {
+	// Method is the HTTP method, or empty for any.
+	Method string `json:"method,omitempty"`
+	// Path matches on prefix when it ends with a slash, and exact otherwise.
+	Path string `json:"path"`
+	// Role is the minimum role, or empty for anonymous access.
+	Role Role `json:"role,omitempty"`
+}
+
+func (r *Rule) matches(method, path string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	if strings.HasSuffix(r.Path, "/") {
+		return strings.HasPrefix(path, r.Path)
+	}
+	return path == r.Path
+}
+
+// Policy is an ordered list of rules. The first match applies. Operations
+// without a matching rule are denied.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DefaultPolicy opens DID resolution and the reads of the node API to
+// resolvers, DID registration and operation submission to registrars, and
+// everything else, such as the metrics, to admins.
+var DefaultPolicy = Policy{Rules: []Rule{
+	{Method: http.MethodGet, Path: "/1.0/identifiers/", Role: Resolver},
+	{Method: http.MethodHead, Path: "/1.0/identifiers/", Role: Resolver},
+	{Path: "/1.0/create", Role: Registrar},
+	{Path: "/1.0/update", Role: Registrar},
+	{Path: "/1.0/deactivate", Role: Registrar},
+	// node API, as in nodeapi.ServiceName and nodeapi.EventsPath
+	{Method: http.MethodPost, Path: "/idchain.node.v1.Node/SubmitOperation", Role: Registrar},
+	{Method: http.MethodPost, Path: "/idchain.node.v1.Node/", Role: Resolver},
+	{Method: http.MethodGet, Path: "/events", Role: Resolver},
+	{Path: "/", Role: Admin},
+}}
+
+// Authorize returns nil when p may perform the operation. The principal is
+// nil for anonymous requests.
+func (policy *Policy) Authorize(p *Principal, method, path string) error {
+	for i := range policy.Rules {
+		r := &policy.Rules[i]
+		if !r.matches(method, path) {
+			continue
+		}
+		switch {
+		case r.Role == "":
+			return nil
+		case p == nil:
+			return ErrUnauthenticated
+		case p.Has(r.Role):
+			return nil
+		default:
+			return fmt.Errorf("%w: %s %s requires role %s", ErrForbidden, method, path, r.Role)
+		}
+	}
+	if p == nil {
+		return ErrUnauthenticated
+	}
+	return fmt.Errorf("%w: no rule for %s %s", ErrForbidden, method, path)
+}
+
+// Authenticator establishes the principal of a request. It returns nil
+// without error when the request has no credentials for the scheme.
+type Authenticator interface {
+	Authenticate(*http.Request) (*Principal, error)
+}
+
+// Authenticators tries each entry in order. The first principal wins.
+type Authenticators []Authenticator
+
+// Authenticate implements the Authenticator interface.
+func (a Authenticators) Authenticate(r *http.Request) (*Principal, error) {
+	for _, auth := range a {
+		p, err := auth.Authenticate(r)
+		if err != nil || p != nil {
+			return p, err
+		}
+	}
+	return nil, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx with the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of ctx, or nil when absent.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Handler enforces the policy on next. The principal is available to next
+// with FromContext. Denials go to the log when not nil.
+func (policy *Policy) Handler(auth Authenticator, log *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := auth.Authenticate(r)
+		if err == nil {
+			err = policy.Authorize(p, r.Method, r.URL.Path)
+		}
+		if err != nil {
+			if log != nil {
+				id := ""
+				if p != nil {
+					id = p.ID
+				}
+				log.Warn("request denied", "principal", id,
+					"method", r.Method, "path", r.URL.Path, "error", err)
+			}
+			if errors.Is(err, ErrForbidden) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="IDChain"`)
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+			}
+			return
+		}
+		if p != nil {
+			r = r.WithContext(NewContext(r.Context(), p))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Config is the configuration form of access control.
+type Config struct {
+	Policy
+
+	// APIKeys maps key names to their hash and roles.
+	APIKeys map[string]APIKeyConfig `json:"apiKeys"`
+
+	// DIDs maps principal DIDs to their roles, for DID Auth.
+	DIDs map[string][]Role `json:"dids"`
+}
+
+// APIKeyConfig is an API key entry.
+type APIKeyConfig struct {
+	SHA256 string `json:"sha256"` // hex encoding of the key hash
+	Roles  []Role `json:"roles"`
+}
+
+// LoadConfig reads a JSON configuration.
+func LoadConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("access control configuration: %w", err)
+	}
+	c.ApplyDefaults()
+	return &c, nil
+}
+
+// ApplyDefaults installs the rules of DefaultPolicy when c has none, for
+// configurations which are not read with LoadConfig.
+func (c *Config) ApplyDefaults() {
+	if len(c.Rules) == 0 {
+		c.Policy = Policy{Rules: append([]Rule(nil), DefaultPolicy.Rules...)}
+	}
+}
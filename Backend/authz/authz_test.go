@@ -0,0 +1,202 @@
+package authz
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+var GoldenAuthorize = []struct {
+	roles  []Role // nil for anonymous
+	method string
+	path   string
+	want   error
+}{
+	{[]Role{Resolver}, "GET", "/1.0/identifiers/did:example:123", nil},
+	{[]Role{Resolver}, "POST", "/1.0/create", ErrForbidden},
+	{[]Role{Registrar}, "GET", "/1.0/identifiers/did:example:123", nil},
+	{[]Role{Registrar}, "POST", "/1.0/create", nil},
+	{[]Role{Registrar}, "POST", "/admin/reload", ErrForbidden},
+	{[]Role{Admin}, "POST", "/admin/reload", nil},
+	{[]Role{Resolver, Admin}, "POST", "/1.0/deactivate", nil},
+	{[]Role{}, "GET", "/1.0/identifiers/did:example:123", ErrForbidden},
+	{nil, "GET", "/1.0/identifiers/did:example:123", ErrUnauthenticated},
+	{[]Role{Resolver}, "POST", "/idchain.node.v1.Node/Resolve", nil},
+	{[]Role{Resolver}, "POST", "/idchain.node.v1.Node/SubmitOperation", ErrForbidden},
+	{[]Role{Registrar}, "POST", "/idchain.node.v1.Node/SubmitOperation", nil},
+	{[]Role{Resolver}, "GET", "/events", nil},
+	{[]Role{Registrar}, "GET", "/metrics", ErrForbidden},
+}
+
+func TestAuthorize(t *testing.T) {
+	for _, gold := range GoldenAuthorize {
+		var p *Principal
+		if gold.roles != nil {
+			p = &Principal{ID: "test", Roles: gold.roles}
+		}
+		err := DefaultPolicy.Authorize(p, gold.method, gold.path)
+		if !errors.Is(err, gold.want) || (gold.want == nil && err != nil) {
+			t.Errorf("roles %q %s %s got error %v, want %v", gold.roles, gold.method, gold.path, err, gold.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	keyHash := sha256.Sum256([]byte("s3cr3t"))
+	config, err := LoadConfig(strings.NewReader(`{
+		"apiKeys": {"ops": {"sha256": "` + hex.EncodeToString(keyHash[:]) + `", "roles": ["registrar"]}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := config.Authenticator(nil, "https://idchain.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *Principal
+	h := config.Handler(auth, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+
+	for _, test := range []struct {
+		key    string
+		method string
+		path   string
+		want   int
+	}{
+		{"s3cr3t", "POST", "/1.0/create", http.StatusOK},
+		{"s3cr3t", "POST", "/admin/keys", http.StatusForbidden},
+		{"wrong", "POST", "/1.0/create", http.StatusUnauthorized},
+		{"", "GET", "/1.0/identifiers/did:example:123", http.StatusUnauthorized},
+	} {
+		got = nil
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.key != "" {
+			req.Header.Set(APIKeyHeader, test.key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("key %q %s %s got HTTP %d, want %d", test.key, test.method, test.path, rec.Code, test.want)
+		}
+		if test.want == http.StatusOK && (got == nil || got.ID != "ops") {
+			t.Errorf("key %q got principal %+v, want ops", test.key, got)
+		}
+	}
+}
+
+func TestDIDAuth(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := backend.DID{Method: "example", SpecID: "alice"}
+	keyID := backend.URL{DID: subject, RawFragment: "#key-1"}
+	m, err := jose.NewMethod(keyID, subject, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &backend.Document{
+		Subject:             subject,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		Authentication: &backend.VerificationRelationship{
+			URIRefs: []*backend.URL{{RawFragment: "#key-1"}},
+		},
+	}
+	auth := &DIDAuth{
+		Resolver: backend.Resolve(func(did backend.DID) (*backend.Document, *backend.Meta, error) {
+			if !did.Equal(subject) {
+				return nil, nil, backend.ErrNotFound
+			}
+			return doc, nil, nil
+		}),
+		Audience: "https://idchain.example",
+		Roles:    map[string][]Role{"did:example:alice": {Admin}},
+	}
+
+	now := time.Now()
+	token := func(claims Token) string {
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := jose.Sign(jose.Header{Alg: jose.EdDSA, Kid: keyID.String()}, payload, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := Token{Issuer: "did:example:alice", Audience: auth.Audience, IssuedAt: now.Unix(), Expires: now.Unix() + 60}
+
+	req := httptest.NewRequest("GET", "/admin/status", nil)
+	req.Header.Set("Authorization", "Bearer "+token(valid))
+	p, err := auth.Authenticate(req)
+	if err != nil {
+		t.Fatal("DID Auth error:", err)
+	}
+	if p.ID != "did:example:alice" || !p.Has(Admin) {
+		t.Errorf("got principal %+v", p)
+	}
+
+	for name, claims := range map[string]Token{
+		"audience": {Issuer: valid.Issuer, Audience: "https://other.example", IssuedAt: valid.IssuedAt, Expires: valid.Expires},
+		"expired":  {Issuer: valid.Issuer, Audience: valid.Audience, IssuedAt: now.Unix() - 120, Expires: now.Unix() - 60},
+		"lifetime": {Issuer: valid.Issuer, Audience: valid.Audience, IssuedAt: now.Unix(), Expires: now.Unix() + 3600},
+		"issuer":   {Issuer: "did:example:mallory", Audience: valid.Audience, IssuedAt: valid.IssuedAt, Expires: valid.Expires},
+	} {
+		if _, err := auth.Verify(context.Background(), token(claims), now); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s got error %v, want ErrUnauthenticated", name, err)
+		}
+	}
+
+	// challenge on WebSocket connections
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			t.Error("upgrade error:", err)
+			return
+		}
+		defer conn.Close()
+		p, err := auth.AuthenticateConn(r.Context(), conn)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(p.ID))
+	}))
+	defer srv.Close()
+	for audience, want := range map[string]bool{auth.Audience: true, "https://other.example": false} {
+		conn, err := new(websocket.Dialer).Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"))
+		if err != nil {
+			t.Fatal("dial error:", err)
+		}
+		err = AnswerChallenge(conn, audience, &keyID, key)
+		if !want {
+			var closed *websocket.CloseError
+			if !errors.As(err, &closed) || closed.Code != websocket.ClosePolicy {
+				t.Errorf("audience %q got error %v, want close with policy violation", audience, err)
+			}
+			conn.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatal("challenge error:", err)
+		}
+		if _, id, err := conn.ReadMessage(); err != nil || string(id) != "did:example:alice" {
+			t.Errorf("got principal %q, error %v", id, err)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,119 @@
+package authz
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+// ChallengeTimeout limits the authentication of a WebSocket connection.
+const ChallengeTimeout = 10 * time.Second
+
+// ChallengeMessage is exchanged in text messages during the authentication of
+// a WebSocket connection. The server sends a "challenge" with a nonce. The
+// client answers with an "authenticate", with a DID Auth token of the nonce,
+// and the server confirms with "authenticated", or it closes the connection
+// with status 1008 (policy violation).
+//
+//	{"type": "challenge", "nonce": "3q2-7w…"}
+//	{"type": "authenticate", "token": "eyJhbGciOiJFZERTQSIs…"}
+//	{"type": "authenticated", "did": "did:example:alice"}
+type ChallengeMessage struct {
+	Type  string `json:"type"`
+	Nonce string `json:"nonce,omitempty"`
+	Token string `json:"token,omitempty"`
+	DID   string `json:"did,omitempty"`
+}
+
+// AuthenticateConn runs the server side of a challenge on a new connection,
+// before any other traffic. The token must have the nonce of the challenge,
+// which prevents replay on other connections.
+func (a *DIDAuth) AuthenticateConn(ctx context.Context, conn *websocket.Conn) (*Principal, error) {
+	conn.NetConn().SetDeadline(time.Now().Add(ChallengeTimeout))
+	defer conn.NetConn().SetDeadline(time.Time{})
+
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	challenge := base64.RawURLEncoding.EncodeToString(nonce[:])
+	if err := writeChallengeMessage(conn, &ChallengeMessage{Type: "challenge", Nonce: challenge}); err != nil {
+		return nil, err
+	}
+	answer, err := readChallengeMessage(conn, "authenticate")
+	if err != nil {
+		conn.CloseStatus(websocket.ClosePolicy, "authentication required")
+		return nil, err
+	}
+	did, t, err := a.verify(ctx, answer.Token, time.Now())
+	if err == nil && t.Nonce != challenge {
+		err = fmt.Errorf("%w: token nonce is not of the challenge", ErrUnauthenticated)
+	}
+	if err != nil {
+		conn.CloseStatus(websocket.ClosePolicy, "authentication failed")
+		return nil, err
+	}
+	if err := writeChallengeMessage(conn, &ChallengeMessage{Type: "authenticated", DID: did.String()}); err != nil {
+		return nil, err
+	}
+	return &Principal{ID: did.String(), Scheme: "did-auth", Roles: a.Roles[did.String()]}, nil
+}
+
+// AnswerChallenge runs the client side of AuthenticateConn, with a token from
+// the DID of keyID for the audience of the server. The signer must match an
+// authentication method of the DID.
+func AnswerChallenge(conn *websocket.Conn, audience string, keyID *backend.URL, signer crypto.Signer) error {
+	challenge, err := readChallengeMessage(conn, "challenge")
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	payload, err := json.Marshal(&Token{
+		Issuer:   keyID.DID.String(),
+		Audience: audience,
+		IssuedAt: now,
+		Expires:  now + int64(ChallengeTimeout/time.Second),
+		Nonce:    challenge.Nonce,
+	})
+	if err != nil {
+		return err
+	}
+	token, err := jose.Sign(jose.Header{Kid: keyID.String()}, payload, signer)
+	if err != nil {
+		return err
+	}
+	if err := writeChallengeMessage(conn, &ChallengeMessage{Type: "authenticate", Token: token}); err != nil {
+		return err
+	}
+	if _, err := readChallengeMessage(conn, "authenticated"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeChallengeMessage(conn *websocket.Conn, m *ChallengeMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// ReadChallengeMessage returns the next message, which must be of type typ.
+func readChallengeMessage(conn *websocket.Conn, typ string) (*ChallengeMessage, error) {
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrUnauthenticated, typ, err)
+	}
+	m := new(ChallengeMessage)
+	if messageType != websocket.TextMessage || json.Unmarshal(data, m) != nil || m.Type != typ {
+		return nil, fmt.Errorf("%w: WebSocket message is not a %s", ErrUnauthenticated, typ)
+	}
+	return m, nil
+}
@@ -0,0 +1,384 @@
+// Package builder composes DID documents together with a fresh DID. Keys get
+// their fragment named automatically, and services attach in order. The
+// outcome depends on the DID method: did:idchain gets a signed genesis
+// operation, while did:peer and did:key derive the DID from the content.
+package builder
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// Verification relationships, by property name
+const (
+	Authentication       = "authentication"
+	AssertionMethod      = "assertionMethod"
+	KeyAgreement         = "keyAgreement"
+	CapabilityInvocation = "capabilityInvocation"
+	CapabilityDelegation = "capabilityDelegation"
+)
+
+// Naming selects the fragments of verification methods.
+type Naming int
+
+// Namings
+const (
+	Sequential Naming = iota // "#key-1", "#key-2", etc.
+	Thumbprint               // JWK Thumbprint, conform RFC 7638
+)
+
+// Key is a verification method pending.
+type key struct {
+	pub           crypto.PublicKey
+	signer        crypto.Signer     // optional
+	private       crypto.PrivateKey // generated
+	relationships []string
+}
+
+// DocumentBuilder collects the content of a DID document in a fluent chain.
+// The first error encountered is retained, and Build returns it. Builders are
+// not safe for concurrent use.
+type DocumentBuilder struct {
+	method      string
+	naming      Naming
+	format      string
+	keys        []*key
+	services    []*backend.Service
+	controllers []backend.DID
+	alsoKnownAs []string
+	err         error
+}
+
+// New returns a builder for a DID of method, which is one of idchain.Method,
+// didpeer.Method or didkey.Method.
+func New(method string) *DocumentBuilder {
+	b := &DocumentBuilder{method: method, format: keys.Multikey}
+	switch method {
+	case idchain.Method, didpeer.Method, didkey.Method:
+		break
+	default:
+		b.err = fmt.Errorf("%w: document builder for did:%s", backend.ErrMethodNotSupported, method)
+	}
+	return b
+}
+
+// Naming sets the fragments of verification methods, which defaults to
+// Sequential. Methods did:peer and did:key have their naming fixed.
+func (b *DocumentBuilder) Naming(n Naming) *DocumentBuilder {
+	b.naming = n
+	return b
+}
+
+// Format sets the verification method type, which is either keys.Multikey
+// (the default) or keys.JsonWebKey2020.
+func (b *DocumentBuilder) Format(format string) *DocumentBuilder {
+	b.format = format
+	return b
+}
+
+// Key adds a public key for each of the relationships.
+func (b *DocumentBuilder) Key(pub crypto.PublicKey, relationships ...string) *DocumentBuilder {
+	for _, r := range relationships {
+		switch r {
+		case Authentication, AssertionMethod, KeyAgreement, CapabilityInvocation, CapabilityDelegation:
+			break
+		default:
+			b.fail(fmt.Errorf("document builder: unknown verification relationship %q", r))
+		}
+	}
+	b.keys = append(b.keys, &key{pub: pub, relationships: relationships})
+	return b
+}
+
+// Signer adds the public key of signer like Key does. A did:idchain genesis
+// operation is signed with the first signer for CapabilityInvocation.
+func (b *DocumentBuilder) Signer(signer crypto.Signer, relationships ...string) *DocumentBuilder {
+	b.Key(signer.Public(), relationships...)
+	b.keys[len(b.keys)-1].signer = signer
+	return b
+}
+
+// Generate adds a new key of type t like Signer does, or like Key does for
+// key agreement keys. Build returns the private key in its Keys.
+func (b *DocumentBuilder) Generate(t keys.Type, relationships ...string) *DocumentBuilder {
+	private, err := keys.Generate(t)
+	if err != nil {
+		return b.fail(err)
+	}
+	if signer, err := keys.Signer(private); err == nil {
+		b.Signer(signer, relationships...)
+	} else {
+		pub, err := keys.Public(private)
+		if err != nil {
+			return b.fail(err)
+		}
+		b.Key(pub, relationships...)
+	}
+	b.keys[len(b.keys)-1].private = private
+	return b
+}
+
+// Service adds a service with a fragment, e.g., "#didcomm", as its
+// identifier. Method did:peer names services by position instead, when
+// fragment is empty.
+func (b *DocumentBuilder) Service(fragment, serviceType, endpoint string) *DocumentBuilder {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return b.fail(fmt.Errorf("document builder: service endpoint: %w", err))
+	}
+	srv := &backend.Service{
+		Types:    []string{serviceType},
+		Endpoint: backend.ServiceEndpoint{URIRefs: []*url.URL{u}},
+	}
+	if fragment != "" {
+		if fragment[0] != '#' {
+			return b.fail(fmt.Errorf("document builder: service fragment %q does not start with '#'", fragment))
+		}
+		srv.ID.Fragment = fragment[1:]
+	}
+	b.services = append(b.services, srv)
+	return b
+}
+
+// Controller adds a controller to the document.
+func (b *DocumentBuilder) Controller(did backend.DID) *DocumentBuilder {
+	b.controllers = append(b.controllers, did)
+	return b
+}
+
+// AlsoKnownAs adds an alias to the document.
+func (b *DocumentBuilder) AlsoKnownAs(uri string) *DocumentBuilder {
+	b.alsoKnownAs = append(b.alsoKnownAs, uri)
+	return b
+}
+
+func (b *DocumentBuilder) fail(err error) *DocumentBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Result is the outcome of a build.
+type Result struct {
+	DID      backend.DID
+	Document *backend.Document
+
+	// Genesis is the signed create operation of did:idchain, ready to
+	// Submit to a ledger. The DID of other methods needs no registration.
+	Genesis string
+
+	// Signers has the keys with a signer by DID URL of their method.
+	Signers map[string]crypto.Signer
+	// Keys has the keys generated by DID URL of their method.
+	Keys map[string]crypto.PrivateKey
+}
+
+// Build returns the document with its DID, at time now.
+func (b *DocumentBuilder) Build(now time.Time) (*Result, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.keys) == 0 {
+		return nil, errors.New("document builder: no keys")
+	}
+	switch b.method {
+	case didkey.Method:
+		return b.buildKey()
+	case didpeer.Method:
+		return b.buildPeer()
+	default:
+		return b.buildIDChain(now)
+	}
+}
+
+// BuildKey derives a did:key, of which the document is fixed.
+func (b *DocumentBuilder) buildKey() (*Result, error) {
+	if len(b.keys) != 1 || len(b.services) != 0 || len(b.controllers) != 0 || len(b.alsoKnownAs) != 0 {
+		return nil, errors.New("document builder: did:key takes one key only")
+	}
+	did, err := didkey.New(b.keys[0].pub)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := (&didkey.Resolver{Format: b.format}).Expand(did)
+	if err != nil {
+		return nil, err
+	}
+	return b.result(did, doc, []string{"#" + did.SpecID}), nil
+}
+
+// Purposes maps relationships to did:peer numalgo 2.
+var purposes = map[string]didpeer.Purpose{
+	Authentication:       didpeer.Verification,
+	AssertionMethod:      didpeer.Assertion,
+	KeyAgreement:         didpeer.Encryption,
+	CapabilityInvocation: didpeer.Invocation,
+	CapabilityDelegation: didpeer.Delegation,
+}
+
+// BuildPeer derives a did:peer with numalgo 2. Each key takes one relationship,
+// as the method names its fragments per purpose.
+func (b *DocumentBuilder) buildPeer() (*Result, error) {
+	if len(b.controllers) != 0 || len(b.alsoKnownAs) != 0 {
+		return nil, errors.New("document builder: did:peer has no controllers nor aliases")
+	}
+	peerKeys := make([]didpeer.Key, len(b.keys))
+	fragments := make([]string, len(b.keys))
+	for i, k := range b.keys {
+		if len(k.relationships) != 1 {
+			return nil, fmt.Errorf("document builder: did:peer key № %d has %d relationships, want 1", i+1, len(k.relationships))
+		}
+		peerKeys[i] = didpeer.Key{Purpose: purposes[k.relationships[0]], Public: k.pub}
+		fragments[i] = "#key-" + strconv.Itoa(i+1)
+	}
+	services := make([]*backend.Service, len(b.services))
+	for i, srv := range b.services {
+		services[i] = srv
+		if srv.ID.Fragment == "" {
+			c := *srv // copy
+			c.ID.Fragment = "service"
+			if i != 0 {
+				c.ID.Fragment += "-" + strconv.Itoa(i)
+			}
+			services[i] = &c
+		}
+	}
+	did, err := didpeer.New2(peerKeys, services)
+	if err != nil {
+		return nil, err
+	}
+	doc, _, err := new(didpeer.Resolver).Resolve(context.Background(), did)
+	if err != nil {
+		return nil, err
+	}
+	return b.result(did, doc, fragments), nil
+}
+
+// BuildIDChain signs the genesis of a did:idchain.
+func (b *DocumentBuilder) buildIDChain(now time.Time) (*Result, error) {
+	doc, fragments, err := b.document(idchain.Placeholder)
+	if err != nil {
+		return nil, err
+	}
+	var keyID *backend.URL
+	var signer crypto.Signer
+	for i, k := range b.keys {
+		if k.signer != nil && slices.Contains(k.relationships, CapabilityInvocation) {
+			keyID = &backend.URL{DID: idchain.Placeholder, RawFragment: fragments[i]}
+			signer = k.signer
+			break
+		}
+	}
+	if signer == nil {
+		return nil, errors.New("document builder: did:idchain needs a signer for capabilityInvocation")
+	}
+
+	genesis, did, err := idchain.NewGenesis(doc, keyID, signer, now)
+	if err != nil {
+		return nil, err
+	}
+	_, op, err := idchain.ParseEntry(genesis)
+	if err != nil {
+		return nil, err
+	}
+	res := b.result(did, op.Document, fragments)
+	res.Genesis = genesis
+	return res, nil
+}
+
+// Document composes the content for subject, with the fragment of each key.
+func (b *DocumentBuilder) document(subject backend.DID) (*backend.Document, []string, error) {
+	doc := &backend.Document{
+		Subject:     subject,
+		AlsoKnownAs: b.alsoKnownAs,
+		Controllers: b.controllers,
+		Services:    b.services,
+	}
+
+	fragments := make([]string, len(b.keys))
+	for i, k := range b.keys {
+		fragment := "#key-" + strconv.Itoa(i+1)
+		if b.naming == Thumbprint {
+			jwk, err := keys.JWK(k.pub)
+			if err != nil {
+				return nil, nil, err
+			}
+			thumbprint, err := jwk.Thumbprint()
+			if err != nil {
+				return nil, nil, err
+			}
+			fragment = "#" + thumbprint
+		}
+		if slices.Contains(fragments[:i], fragment) {
+			return nil, nil, fmt.Errorf("document builder: key № %d is a duplicate", i+1)
+		}
+		fragments[i] = fragment
+
+		m, err := keys.NewMethod(backend.URL{DID: subject, RawFragment: fragment}, subject, k.pub, b.format)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+		for _, name := range k.relationships {
+			r := relationship(doc, name)
+			if *r == nil {
+				*r = new(backend.VerificationRelationship)
+			}
+			(*r).URIRefs = append((*r).URIRefs, &m.ID)
+		}
+	}
+	for _, srv := range doc.Services {
+		if srv.ID.Fragment == "" {
+			return nil, nil, errors.New("document builder: service without fragment")
+		}
+	}
+	return doc, fragments, nil
+}
+
+// Relationship returns the field of doc with the property name.
+func relationship(doc *backend.Document, name string) **backend.VerificationRelationship {
+	switch name {
+	case Authentication:
+		return &doc.Authentication
+	case AssertionMethod:
+		return &doc.AssertionMethod
+	case KeyAgreement:
+		return &doc.KeyAgreement
+	case CapabilityInvocation:
+		return &doc.CapabilityInvocation
+	default:
+		return &doc.CapabilityDelegation
+	}
+}
+
+func (b *DocumentBuilder) result(did backend.DID, doc *backend.Document, fragments []string) *Result {
+	res := &Result{
+		DID:      did,
+		Document: doc,
+		Signers:  make(map[string]crypto.Signer),
+		Keys:     make(map[string]crypto.PrivateKey),
+	}
+	for i, k := range b.keys {
+		id := backend.URL{DID: did, RawFragment: fragments[i]}
+		if k.signer != nil {
+			res.Signers[id.String()] = k.signer
+		}
+		if k.private != nil {
+			res.Keys[id.String()] = k.private
+		}
+	}
+	return res
+}
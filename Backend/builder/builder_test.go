@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+func TestIDChain(t *testing.T) {
+	controller := backend.DID{Method: "example", SpecID: "boss"}
+	res, err := New(idchain.Method).
+		Generate(keys.Ed25519, Authentication, CapabilityInvocation).
+		Generate(keys.X25519, KeyAgreement).
+		Service("#hub", "LinkedDomains", "https://example.com/").
+		Controller(controller).
+		Build(time.Now())
+	if err != nil {
+		t.Fatal("build error:", err)
+	}
+	if res.DID.Method != idchain.Method || !res.Document.Subject.Equal(res.DID) || res.Genesis == "" {
+		t.Fatalf("got result %+v", res)
+	}
+	if len(res.Signers) != 1 || len(res.Keys) != 2 {
+		t.Errorf("got %d signers and %d keys, want 1 and 2", len(res.Signers), len(res.Keys))
+	}
+	keyID := &backend.URL{DID: res.DID, RawFragment: "#key-1"}
+	if m := res.Document.AuthorizedMethod(res.Document.CapabilityInvocation, keyID); m == nil {
+		t.Errorf("no capability invocation %s", keyID.String())
+	}
+	keyID.RawFragment = "#key-2"
+	if m := res.Document.AuthorizedMethod(res.Document.KeyAgreement, keyID); m == nil {
+		t.Errorf("no key agreement %s", keyID.String())
+	}
+
+	// the genesis replays into the document built
+	l := new(idchain.Memory)
+	if _, err := idchain.Submit(context.Background(), l, res.Genesis); err != nil {
+		t.Fatal("submit error:", err)
+	}
+	doc, _, err := (&idchain.Resolver{Ledger: l}).Resolve(context.Background(), res.DID)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	if len(doc.VerificationMethods) != 2 || doc.Services[0].ID.Fragment != "hub" || !doc.Controllers.ContainsString(controller.String()) {
+		t.Errorf("resolved document %+v", doc)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	res, err := New(idchain.Method).
+		Naming(Thumbprint).
+		Format(keys.JsonWebKey2020).
+		Generate(keys.P256, CapabilityInvocation, AssertionMethod).
+		Build(time.Now())
+	if err != nil {
+		t.Fatal("build error:", err)
+	}
+	m := res.Document.VerificationMethods[0]
+	jwk, _ := keys.JWK(res.Signers[m.ID.String()].Public())
+	thumbprint, _ := jwk.Thumbprint()
+	if m.ID.Fragment() != thumbprint || m.Type != keys.JsonWebKey2020 {
+		t.Errorf("got method %s of type %q, want fragment %q", m.ID.String(), m.Type, thumbprint)
+	}
+}
+
+func TestPeer(t *testing.T) {
+	res, err := New(didpeer.Method).
+		Generate(keys.Ed25519, Authentication).
+		Generate(keys.X25519, KeyAgreement).
+		Service("", "DIDCommMessaging", "https://example.com/didcomm").
+		Build(time.Now())
+	if err != nil {
+		t.Fatal("build error:", err)
+	}
+	if !strings.HasPrefix(res.DID.SpecID, "2.V") || res.Genesis != "" {
+		t.Errorf("got DID %s, genesis %q", res.DID.String(), res.Genesis)
+	}
+	doc, _, err := new(didpeer.Resolver).Resolve(context.Background(), res.DID)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	for id := range res.Keys {
+		u, _ := backend.ParseURL(id)
+		if doc.AuthorizedMethod(doc.Authentication, u) == nil && doc.AuthorizedMethod(doc.KeyAgreement, u) == nil {
+			t.Errorf("key %s not in resolved document", id)
+		}
+	}
+
+	_, err = New(didpeer.Method).Generate(keys.Ed25519, Authentication, AssertionMethod).Build(time.Now())
+	if err == nil {
+		t.Error("did:peer key with 2 relationships built")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := New("web").Generate(keys.Ed25519).Build(time.Now()); !errors.Is(err, backend.ErrMethodNotSupported) {
+		t.Errorf("did:web got error %v, want ErrMethodNotSupported", err)
+	}
+	if _, err := New(idchain.Method).Generate(keys.Ed25519, "nonsense").Build(time.Now()); err == nil {
+		t.Error("unknown relationship built")
+	}
+	if _, err := New(idchain.Method).Generate(keys.Ed25519, Authentication).Build(time.Now()); err == nil {
+		t.Error("did:idchain without capability invocation built")
+	}
+	res, err := New(didkey.Method).Generate(keys.Ed25519).Build(time.Now())
+	if err != nil || res.DID.Method != didkey.Method || len(res.Signers) != 1 {
+		t.Errorf("did:key got %+v, error %v", res, err)
+	}
+	if _, err := New(didkey.Method).Generate(keys.Ed25519).Generate(keys.Ed25519).Build(time.Now()); err == nil {
+		t.Error("did:key with 2 keys built")
+	}
+}
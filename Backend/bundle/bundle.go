@@ -0,0 +1,128 @@
+// Package bundle exports resolved DID documents into a signed file, for
+// resolution without network access, as needed in air-gapped environments.
+// A bundle is a JWT of the exporter, which carries the documents with their
+// metadata and any proofs.
+package bundle
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// Typ is the "typ" header of bundles, for explicit typing conform RFC 8725.
+const Typ = "did-bundle+jwt"
+
+// SizeMax is an upper boundary for bundles in bytes.
+const SizeMax = 64 << 20
+
+// Entry is a DID resolution in a Bundle.
+type Entry struct {
+	Document *backend.Document `json:"didDocument"`
+	Meta     *backend.Meta     `json:"didDocumentMetadata"`
+
+	// Proofs are evidence for the document, opaque to the bundle, such as
+	// the signed operation log of did:idchain.
+	Proofs []json.RawMessage `json:"proofs,omitempty"`
+}
+
+// Bundle is a portable set of DID resolutions.
+type Bundle struct {
+	// Issuer is the DID of the exporter, as set by Sign and Open.
+	Issuer backend.DID
+
+	// Issued is the time of signing, as set by Sign and Open.
+	Issued time.Time
+	// Expires is the end of validity, if any. Open denies bundles which
+	// expired.
+	Expires time.Time
+
+	Entries []*Entry
+}
+
+// Claims is the JWT payload of a Bundle.
+type claims struct {
+	didjwt.Claims
+	Entries []*Entry `json:"entries"`
+}
+
+// Add resolves did with r into an entry, with any proofs attached. An entry
+// of the same DID is replaced.
+func (b *Bundle) Add(ctx context.Context, r backend.Resolver, did backend.DID, proofs ...json.RawMessage) error {
+	doc, meta, err := r.Resolve(ctx, did)
+	if err != nil {
+		return fmt.Errorf("DID bundle entry %s: %w", did.String(), err)
+	}
+	if meta == nil {
+		meta = new(backend.Meta)
+	}
+	e := &Entry{Document: doc, Meta: meta, Proofs: proofs}
+	for i, o := range b.Entries {
+		if o.Document != nil && o.Document.Subject.Equal(did) {
+			b.Entries[i] = e
+			return nil
+		}
+	}
+	b.Entries = append(b.Entries, e)
+	return nil
+}
+
+// Sign returns the bundle as a JWT, signed with key by keyID, which is an
+// "assertionMethod" of the Issuer. The Issuer and the Issued time are set.
+func (b *Bundle) Sign(keyID *backend.URL, key crypto.Signer) (string, error) {
+	b.Issuer = keyID.DID
+	b.Issued = time.Now().Truncate(time.Second)
+	c := claims{
+		Claims: didjwt.Claims{
+			Issuer:   b.Issuer.String(),
+			IssuedAt: b.Issued.Unix(),
+		},
+		Entries: b.Entries,
+	}
+	if !b.Expires.IsZero() {
+		c.Expires = b.Expires.Unix()
+	}
+	if c.Entries == nil {
+		c.Entries = []*Entry{} // JSON array
+	}
+	return didjwt.SignTyp(Typ, &c, keyID, key)
+}
+
+// Open verifies a bundle from Sign. The document of the exporter comes from
+// trust. Use self-certifying methods like did:key and did:peer when offline.
+// The entries are not verified in any way; the exporter vouches for them.
+func Open(ctx context.Context, token string, trust backend.Resolver) (*Bundle, error) {
+	jws, err := jose.ParseCompact(token)
+	if err != nil {
+		return nil, fmt.Errorf("DID bundle: %w", err)
+	}
+	if jws.Header.Typ != Typ {
+		return nil, fmt.Errorf("DID bundle has typ %q, want %q", jws.Header.Typ, Typ)
+	}
+	var c claims
+	v := didjwt.Verifier{Resolver: trust}
+	issuer, err := v.Verify(ctx, token, time.Now(), &c)
+	if err != nil {
+		return nil, fmt.Errorf("DID bundle: %w", err)
+	}
+	for i, e := range c.Entries {
+		if e == nil || e.Document == nil || e.Meta == nil {
+			return nil, fmt.Errorf("DID bundle entry № %d incomplete", i+1)
+		}
+	}
+
+	b := &Bundle{Issuer: issuer, Entries: c.Entries}
+	if c.IssuedAt != 0 {
+		b.Issued = time.Unix(c.IssuedAt, 0)
+	}
+	if c.Expires != 0 {
+		b.Expires = time.Unix(c.Expires, 0)
+	}
+	return b, nil
+}
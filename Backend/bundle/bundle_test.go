@@ -0,0 +1,109 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+var created = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Upstream resolves any DID of did:example.
+var upstream = backend.Resolve(func(did backend.DID) (*backend.Document, *backend.Meta, error) {
+	if did.Method != "example" {
+		return nil, nil, backend.ErrMethodNotSupported
+	}
+	return &backend.Document{Subject: did}, &backend.Meta{Created: created, VersionID: "1"}, nil
+})
+
+func TestBundle(t *testing.T) {
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	exporter, _ := didkey.New(signer.Public())
+	keyID := &backend.URL{DID: exporter, RawFragment: "#" + exporter.SpecID}
+
+	ctx := context.Background()
+	alice := backend.DID{Method: "example", SpecID: "alice"}
+	bob := backend.DID{Method: "example", SpecID: "bob"}
+	var b Bundle
+	if err := b.Add(ctx, upstream, alice, json.RawMessage(`"proof"`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add(ctx, upstream, bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add(ctx, upstream, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add(ctx, upstream, backend.DID{Method: "web", SpecID: "example.com"}); !errors.Is(err, backend.ErrMethodNotSupported) {
+		t.Errorf("unresolvable DID got error %v, want ErrMethodNotSupported", err)
+	}
+	if len(b.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(b.Entries))
+	}
+	b.Entries[0].Proofs = []json.RawMessage{json.RawMessage(`{"ledger":"entry"}`)}
+
+	token, err := b.Sign(keyID, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// offline trust in did:key only
+	trust := new(backend.MethodRegistry)
+	trust.Register(didkey.Method, new(didkey.Resolver))
+	opened, err := Open(ctx, token, trust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opened.Issuer.Equal(exporter) || opened.Issued.IsZero() || len(opened.Entries) != 2 {
+		t.Errorf("got bundle %+v", opened)
+	}
+
+	r := opened.Resolver()
+	doc, meta, err := r.Resolve(ctx, alice)
+	if err != nil || !doc.Subject.Equal(alice) || !meta.Created.Equal(created) {
+		t.Errorf("got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+	if proofs, err := r.Proofs(alice); err != nil || len(proofs) != 1 || string(proofs[0]) != `{"ledger":"entry"}` {
+		t.Errorf("got proofs %q, error %v", proofs, err)
+	}
+	if _, _, err := r.Resolve(ctx, backend.DID{Method: "example", SpecID: "carol"}); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("DID not in bundle got error %v, want ErrNotFound", err)
+	}
+	if _, _, err := r.ResolveVersion(ctx, bob, "1", created); err != nil {
+		t.Errorf("version in effect got error: %s", err)
+	}
+	if _, _, err := r.ResolveVersion(ctx, bob, "2", time.Time{}); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("other version got error %v, want ErrNotFound", err)
+	}
+	if _, _, err := r.ResolveVersion(ctx, bob, "", created.Add(-time.Second)); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("version time before creation got error %v, want ErrNotFound", err)
+	}
+
+	// tamper
+	parts := strings.Split(token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	payload = bytes.ReplaceAll(payload, []byte("alice"), []byte("eve"))
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	if _, err := Open(ctx, strings.Join(parts, "."), trust); err == nil {
+		t.Error("tampered bundle got no error")
+	}
+	// untrusted method
+	if _, err := Open(ctx, token, new(backend.MethodRegistry)); !errors.Is(err, backend.ErrMethodNotSupported) {
+		t.Errorf("untrusted exporter got error %v, want ErrMethodNotSupported", err)
+	}
+	b.Expires = time.Now().Add(-time.Hour)
+	expired, _ := b.Sign(keyID, signer)
+	if _, err := Open(ctx, expired, trust); err == nil {
+		t.Error("expired bundle got no error")
+	}
+}
@@ -0,0 +1,80 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Resolver serves from a Bundle only, without any network access. Documents
+// are shared, and thus read-only. Multiple goroutines may invoke methods on a
+// Resolver simultaneously.
+type Resolver struct {
+	entries map[string]*Entry // by canonical DID
+}
+
+// Resolver returns the entries of b for resolution. The first entry wins on
+// duplicate DIDs.
+func (b *Bundle) Resolver() *Resolver {
+	r := &Resolver{entries: make(map[string]*Entry, len(b.Entries))}
+	for _, e := range b.Entries {
+		key := e.Document.Subject.Canonical()
+		if _, ok := r.entries[key]; !ok {
+			r.entries[key] = e
+		}
+	}
+	return r
+}
+
+// Resolve implements the backend.Resolver interface. DIDs not in the bundle
+// get backend.ErrNotFound.
+func (r *Resolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	e, err := r.entry(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e.Document, e.Meta, nil
+}
+
+// ResolveVersion implements the backend.VersionResolver interface. Bundles
+// have one version per DID, which must match the version ID, and which must
+// be in effect at the version time, if any.
+func (r *Resolver) ResolveVersion(_ context.Context, did backend.DID, versionID string, versionTime time.Time) (*backend.Document, *backend.Meta, error) {
+	e, err := r.entry(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	if versionID != "" && e.Meta.VersionID != versionID {
+		return nil, nil, fmt.Errorf("%w: version %q of %s not in bundle", backend.ErrNotFound, versionID, did.String())
+	}
+	if !versionTime.IsZero() {
+		since := e.Meta.Updated
+		if since.IsZero() {
+			since = e.Meta.Created
+		}
+		if since.After(versionTime) || (!e.Meta.NextUpdate.IsZero() && !e.Meta.NextUpdate.After(versionTime)) {
+			return nil, nil, fmt.Errorf("%w: version of %s at %s not in bundle", backend.ErrNotFound, did.String(), versionTime.Format(time.RFC3339))
+		}
+	}
+	return e.Document, e.Meta, nil
+}
+
+// Proofs returns the evidence of did from the bundle, if any.
+func (r *Resolver) Proofs(did backend.DID) ([]json.RawMessage, error) {
+	e, err := r.entry(did)
+	if err != nil {
+		return nil, err
+	}
+	return e.Proofs, nil
+}
+
+func (r *Resolver) entry(did backend.DID) (*Entry, error) {
+	e, ok := r.entries[did.Canonical()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not in bundle", backend.ErrNotFound, did.String())
+	}
+	return e, nil
+}
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CachedResolver is a Resolver with a cache in front. Entries expire conform
+// Meta.Expires when set, like with the HTTP caching of did:web, or after the
+// TTL of the DID method otherwise. Cached documents are shared, and thus
+// read-only. Multiple goroutines may invoke methods on a CachedResolver
+// simultaneously.
+type CachedResolver struct {
+	Resolver Resolver
+
+	// TTL is the time to live of documents without Meta.Expires. Zero
+	// disables caching of such documents.
+	TTL time.Duration
+	// MethodTTLs override the TTL per DID method.
+	MethodTTLs map[string]time.Duration
+
+	// StaleWhileRevalidate is the period after expiry in which entries are
+	// served while a refresh runs in the background, as in RFC 5861. The
+	// refresh continues without the cancellation of the request context.
+	StaleWhileRevalidate time.Duration
+
+	// MaxEntries limits the number of documents retained. Zero means no
+	// limit.
+	MaxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry // by canonical DID
+}
+
+type cacheEntry struct {
+	doc        *Document
+	meta       *Meta
+	expires    time.Time
+	refreshing bool
+}
+
+func (c *CachedResolver) ttl(method string) time.Duration {
+	if ttl, ok := c.MethodTTLs[method]; ok {
+		return ttl
+	}
+	return c.TTL
+}
+
+// Resolve implements the Resolver interface. Errors are not cached. Each
+// lookup is a "did.cache" span with the method, and with a "cache" attribute
+// of either "hit", "stale" or "miss".
+func (c *CachedResolver) Resolve(ctx context.Context, did DID) (doc *Document, meta *Meta, err error) {
+	ctx, span := StartSpan(ctx, "did.cache", slog.String("method", did.Method))
+	defer func() { span.End(err) }()
+	key := did.String()
+	now := time.Now()
+
+	c.mutex.Lock()
+	e, ok := c.entries[key]
+	switch {
+	case !ok:
+		break
+	case now.Before(e.expires):
+		c.mutex.Unlock()
+		span.SetAttributes(slog.String("cache", "hit"))
+		return e.doc, e.meta, nil
+	case now.Before(e.expires.Add(c.StaleWhileRevalidate)):
+		if !e.refreshing {
+			e.refreshing = true
+			go c.refresh(context.WithoutCancel(ctx), did, e)
+		}
+		c.mutex.Unlock()
+		span.SetAttributes(slog.String("cache", "stale"))
+		return e.doc, e.meta, nil
+	}
+	c.mutex.Unlock()
+
+	span.SetAttributes(slog.String("cache", "miss"))
+	return c.fetch(ctx, did)
+}
+
+// Fetch resolves did, and it caches the result when applicable.
+func (c *CachedResolver) fetch(ctx context.Context, did DID) (*Document, *Meta, error) {
+	doc, meta, err := c.Resolver.Resolve(ctx, did)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var expires time.Time
+	if meta != nil && !meta.Expires.IsZero() {
+		expires = meta.Expires
+	} else {
+		expires = now.Add(c.ttl(did.Method))
+	}
+	if expires.Add(c.StaleWhileRevalidate).After(now) {
+		c.store(did.String(), &cacheEntry{doc: doc, meta: meta, expires: expires})
+	}
+	return doc, meta, nil
+}
+
+// Refresh replaces the stale entry e. Failures keep e in place for the next
+// attempt.
+func (c *CachedResolver) refresh(ctx context.Context, did DID, e *cacheEntry) {
+	if _, _, err := c.fetch(ctx, did); err != nil {
+		c.mutex.Lock()
+		e.refreshing = false
+		c.mutex.Unlock()
+	}
+}
+
+func (c *CachedResolver) store(key string, e *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+	// random eviction by map order
+	for k := range c.entries {
+		if c.MaxEntries <= 0 || len(c.entries) < c.MaxEntries {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[key] = e
+}
+
+// Invalidate removes any entry of did.
+func (c *CachedResolver) Invalidate(did DID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, did.String())
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// CountResolver resolves any DID with an increasing NextVersionID.
+type countResolver struct {
+	calls   atomic.Int32
+	expires time.Time // optional
+	done    chan struct{}
+}
+
+func (r *countResolver) Resolve(_ context.Context, did DID) (*Document, *Meta, error) {
+	n := r.calls.Add(1)
+	if r.done != nil {
+		defer func() { r.done <- struct{}{} }()
+	}
+	return &Document{Subject: did}, &Meta{NextVersionID: string(rune('0' + n)), Expires: r.expires}, nil
+}
+
+func TestCachedResolver(t *testing.T) {
+	r := new(countResolver)
+	c := &CachedResolver{
+		Resolver:   r,
+		TTL:        time.Hour,
+		MethodTTLs: map[string]time.Duration{"key": 0},
+	}
+	ctx := context.Background()
+	alice := DID{Method: "example", SpecID: "alice"}
+	for i := 0; i < 3; i++ {
+		if _, meta, err := c.Resolve(ctx, alice); err != nil || meta.NextVersionID != "1" {
+			t.Fatalf("resolve № %d got meta %+v, error %v", i+1, meta, err)
+		}
+	}
+	// method without caching
+	key := DID{Method: "key", SpecID: "z6Mk"}
+	c.Resolve(ctx, key)
+	c.Resolve(ctx, key)
+	if got := r.calls.Load(); got != 3 {
+		t.Errorf("got %d resolutions, want 3", got)
+	}
+
+	c.Invalidate(alice)
+	if _, meta, _ := c.Resolve(ctx, alice); meta.NextVersionID != "4" {
+		t.Errorf("after invalidate got meta %+v, want a new resolution", meta)
+	}
+}
+
+func TestCachedResolverExpires(t *testing.T) {
+	// expiry of the transport overrides the TTL
+	r := &countResolver{expires: time.Now().Add(-time.Second)}
+	c := &CachedResolver{Resolver: r, TTL: time.Hour}
+	did := DID{Method: "web", SpecID: "example.com"}
+	c.Resolve(context.Background(), did)
+	c.Resolve(context.Background(), did)
+	if got := r.calls.Load(); got != 2 {
+		t.Errorf("got %d resolutions of expired documents, want 2", got)
+	}
+}
+
+func TestCachedResolverStale(t *testing.T) {
+	r := &countResolver{done: make(chan struct{}, 1)}
+	c := &CachedResolver{
+		Resolver:             r,
+		TTL:                  time.Millisecond,
+		StaleWhileRevalidate: time.Hour,
+	}
+	did := DID{Method: "example", SpecID: "alice"}
+	c.Resolve(context.Background(), did)
+	<-r.done
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, meta, err := c.Resolve(ctx, did)
+	cancel() // must not affect the refresh
+	if err != nil || meta.NextVersionID != "1" {
+		t.Fatalf("stale got meta %+v, error %v", meta, err)
+	}
+	select {
+	case <-r.done:
+		break
+	case <-time.After(time.Second):
+		t.Fatal("no refresh in background")
+	}
+}
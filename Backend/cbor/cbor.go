@@ -0,0 +1,448 @@
+// Package cbor implements the Concise Binary Object Representation, as per RFC
+// 8949, for generic data structures. Encoding is deterministic conform the
+// “Core Deterministic Encoding Requirements” of section 4.2.1.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Major types
+const (
+	majorUint   = 0 << 5
+	majorNegint = 1 << 5
+	majorBytes  = 2 << 5
+	majorText   = 3 << 5
+	majorArray  = 4 << 5
+	majorMap    = 5 << 5
+	majorTag    = 6 << 5
+	majorSimple = 7 << 5
+)
+
+// Tag is a semantically tagged data item.
+type Tag struct {
+	Number  uint64
+	Content any
+}
+
+// Undefined is the simple value 23.
+type Undefined struct{}
+
+// Marshal returns the deterministic encoding of v. Supported types are nil,
+// bool, all integer types, float32, float64, string, []byte, []any, []string,
+// map[string]any, map[any]any, map[int]any, Tag and Undefined.
+func Marshal(v any) ([]byte, error) {
+	return appendValue(make([]byte, 0, 128), v, 0)
+}
+
+// MaxDepth is the nesting limit for both encoding and decoding.
+const MaxDepth = 64
+
+var errDepth = errors.New("CBOR nesting exceeds depth limit")
+
+func appendHead(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, major|27), n)
+	}
+}
+
+func appendInt(buf []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(buf, majorNegint, uint64(-(v + 1)))
+	}
+	return appendHead(buf, majorUint, uint64(v))
+}
+
+func appendValue(buf []byte, v any, depth int) ([]byte, error) {
+	if depth > MaxDepth {
+		return nil, errDepth
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return append(buf, majorSimple|22), nil
+	case Undefined:
+		return append(buf, majorSimple|23), nil
+	case bool:
+		if v {
+			return append(buf, majorSimple|21), nil
+		}
+		return append(buf, majorSimple|20), nil
+
+	case int:
+		return appendInt(buf, int64(v)), nil
+	case int8:
+		return appendInt(buf, int64(v)), nil
+	case int16:
+		return appendInt(buf, int64(v)), nil
+	case int32:
+		return appendInt(buf, int64(v)), nil
+	case int64:
+		return appendInt(buf, v), nil
+	case uint:
+		return appendHead(buf, majorUint, uint64(v)), nil
+	case uint8:
+		return appendHead(buf, majorUint, uint64(v)), nil
+	case uint16:
+		return appendHead(buf, majorUint, uint64(v)), nil
+	case uint32:
+		return appendHead(buf, majorUint, uint64(v)), nil
+	case uint64:
+		return appendHead(buf, majorUint, v), nil
+
+	case float32:
+		return appendFloat(buf, float64(v)), nil
+	case float64:
+		return appendFloat(buf, v), nil
+
+	case string:
+		buf = appendHead(buf, majorText, uint64(len(v)))
+		return append(buf, v...), nil
+	case []byte:
+		buf = appendHead(buf, majorBytes, uint64(len(v)))
+		return append(buf, v...), nil
+
+	case []string:
+		buf = appendHead(buf, majorArray, uint64(len(v)))
+		for _, s := range v {
+			buf = appendHead(buf, majorText, uint64(len(s)))
+			buf = append(buf, s...)
+		}
+		return buf, nil
+	case []any:
+		buf = appendHead(buf, majorArray, uint64(len(v)))
+		var err error
+		for _, e := range v {
+			buf, err = appendValue(buf, e, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	case map[string]any:
+		entries := make([]mapEntry, 0, len(v))
+		for k, e := range v {
+			entries = append(entries, mapEntry{key: k, value: e})
+		}
+		return appendMap(buf, entries, depth)
+	case map[int]any:
+		entries := make([]mapEntry, 0, len(v))
+		for k, e := range v {
+			entries = append(entries, mapEntry{key: k, value: e})
+		}
+		return appendMap(buf, entries, depth)
+	case map[any]any:
+		entries := make([]mapEntry, 0, len(v))
+		for k, e := range v {
+			entries = append(entries, mapEntry{key: k, value: e})
+		}
+		return appendMap(buf, entries, depth)
+
+	case Tag:
+		buf = appendHead(buf, majorTag, v.Number)
+		return appendValue(buf, v.Content, depth+1)
+
+	default:
+		return nil, fmt.Errorf("CBOR encoding of Go type %T not supported", v)
+	}
+}
+
+type mapEntry struct {
+	key, value any
+	encodedKey []byte
+}
+
+// AppendMap sorts the keys in the bytewise lexicographic order of their
+// deterministic encodings.
+func appendMap(buf []byte, entries []mapEntry, depth int) ([]byte, error) {
+	for i := range entries {
+		k, err := appendValue(nil, entries[i].key, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].encodedKey = k
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].encodedKey, entries[j].encodedKey) < 0
+	})
+
+	buf = appendHead(buf, majorMap, uint64(len(entries)))
+	var err error
+	for i := range entries {
+		if i != 0 && bytes.Equal(entries[i-1].encodedKey, entries[i].encodedKey) {
+			return nil, fmt.Errorf("CBOR map key %x duplicate", entries[i].encodedKey)
+		}
+		buf = append(buf, entries[i].encodedKey...)
+		buf, err = appendValue(buf, entries[i].value, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// AppendFloat uses the shortest floating-point encoding that preserves the
+// value. Integral values are not converted to integers.
+func appendFloat(buf []byte, f float64) []byte {
+	if math.IsNaN(f) {
+		return append(buf, majorSimple|25, 0x7e, 0x00) // canonical NaN
+	}
+	if h, ok := toHalf(f); ok {
+		return binary.BigEndian.AppendUint16(append(buf, majorSimple|25), h)
+	}
+	if f32 := float32(f); float64(f32) == f {
+		return binary.BigEndian.AppendUint32(append(buf, majorSimple|26), math.Float32bits(f32))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, majorSimple|27), math.Float64bits(f))
+}
+
+// ToHalf returns the IEEE 754 binary16 representation of f, if exact.
+func toHalf(f float64) (uint16, bool) {
+	bits := math.Float64bits(f)
+	sign := uint16(bits>>48) & 0x8000
+	exp := int(bits>>52&0x7ff) - 1023
+	mant := bits & (1<<52 - 1)
+
+	switch {
+	case math.IsInf(f, 0):
+		return sign | 0x7c00, true
+	case f == 0:
+		return sign, true
+	case exp >= -14 && exp <= 15:
+		// normal; 10 bits of mantissa
+		if mant&(1<<42-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>42), true
+	case exp >= -24 && exp < -14:
+		// subnormal
+		shift := uint(42 + (-14 - exp))
+		m := mant | 1<<52 // implicit bit
+		if m&(1<<(shift)-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(m>>shift), true
+	}
+	return 0, false
+}
+
+func fromHalf(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h >> 10 & 0x1f)
+	mant := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(mant+1024, exp-25)
+}
+
+// SyntaxError denies CBOR on well-formedness.
+type SyntaxError struct {
+	Offset int    // index of the data item in error
+	Reason string // human readable
+}
+
+// Error implements the standard error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("malformed CBOR at byte № %d: %s", e.Offset+1, e.Reason)
+}
+
+// Unmarshal decodes exactly one data item. Integers decode as int64, or as
+// uint64 when out of range. Floating-points decode as float64, byte strings
+// as []byte, text as string, arrays as []any, and maps as map[any]any. Tags
+// decode into Tag, null into nil and undefined into Undefined.
+func Unmarshal(data []byte) (any, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.i != len(data) {
+		return nil, &SyntaxError{Offset: d.i, Reason: "data after end of item"}
+	}
+	return v, nil
+}
+
+// UnmarshalPrefix decodes one data item from the start of data. It returns the
+// number of bytes read.
+func UnmarshalPrefix(data []byte) (any, int, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	return v, d.i, err
+}
+
+type decoder struct {
+	data []byte
+	i    int // read index
+}
+
+func (d *decoder) errorf(offset int, format string, args ...any) error {
+	return &SyntaxError{Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Head reads the initial byte with its argument.
+func (d *decoder) head() (major byte, info byte, arg uint64, err error) {
+	offset := d.i
+	if d.i >= len(d.data) {
+		return 0, 0, 0, d.errorf(offset, "end incomplete")
+	}
+	b := d.data[d.i]
+	d.i++
+	major, info = b&0xe0, b&0x1f
+
+	var n int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	case info == 31:
+		return 0, 0, 0, d.errorf(offset, "indefinite length not supported")
+	default:
+		return 0, 0, 0, d.errorf(offset, "reserved additional information %d", info)
+	}
+	if len(d.data)-d.i < n {
+		return 0, 0, 0, d.errorf(offset, "end incomplete")
+	}
+	for _, c := range d.data[d.i : d.i+n] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.i += n
+	return major, info, arg, nil
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > MaxDepth {
+		return nil, errDepth
+	}
+	offset := d.i
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+
+	case majorNegint:
+		if arg > math.MaxInt64 {
+			return nil, d.errorf(offset, "negative integer out of range")
+		}
+		return -1 - int64(arg), nil
+
+	case majorBytes, majorText:
+		if arg > uint64(len(d.data)-d.i) {
+			return nil, d.errorf(offset, "end incomplete")
+		}
+		s := d.data[d.i : d.i+int(arg)]
+		d.i += int(arg)
+		if major == majorText {
+			return string(s), nil
+		}
+		b := make([]byte, len(s))
+		copy(b, s)
+		return b, nil
+
+	case majorArray:
+		// each item takes at least one byte
+		if arg > uint64(len(d.data)-d.i) {
+			return nil, d.errorf(offset, "end incomplete")
+		}
+		a := make([]any, arg)
+		for i := range a {
+			a[i], err = d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+
+	case majorMap:
+		// each pair takes at least two bytes
+		if arg > uint64(len(d.data)-d.i)/2 {
+			return nil, d.errorf(offset, "end incomplete")
+		}
+		m := make(map[any]any, arg)
+		for n := uint64(0); n < arg; n++ {
+			keyOffset := d.i
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, uint64, string, bool, nil:
+				break // comparable
+			default:
+				return nil, d.errorf(keyOffset, "map key of type %T not supported", k)
+			}
+			if _, ok := m[k]; ok {
+				return nil, d.errorf(keyOffset, "duplicate map key %v", k)
+			}
+			m[k], err = d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+
+	case majorTag:
+		content, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: arg, Content: content}, nil
+
+	default: // majorSimple
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		case 23:
+			return Undefined{}, nil
+		case 25:
+			return fromHalf(uint16(arg)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case 27:
+			return math.Float64frombits(arg), nil
+		}
+		return nil, d.errorf(offset, "simple value %d not supported", arg)
+	}
+}
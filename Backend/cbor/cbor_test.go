@@ -0,0 +1,160 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// GoldenValues are borrowed from RFC 8949, appendix A.
+var GoldenValues = []struct {
+	Hex string
+	V   any
+}{
+	{"00", int64(0)},
+	{"01", int64(1)},
+	{"0a", int64(10)},
+	{"17", int64(23)},
+	{"1818", int64(24)},
+	{"1864", int64(100)},
+	{"1903e8", int64(1000)},
+	{"1a000f4240", int64(1000000)},
+	{"1b000000e8d4a51000", int64(1000000000000)},
+	{"1bffffffffffffffff", uint64(18446744073709551615)},
+	{"20", int64(-1)},
+	{"29", int64(-10)},
+	{"3863", int64(-100)},
+	{"3903e7", int64(-1000)},
+	{"f90000", 0.0},
+	{"f93c00", 1.0},
+	{"fb3ff199999999999a", 1.1},
+	{"f93e00", 1.5},
+	{"f97bff", 65504.0},
+	{"fa47c35000", 100000.0},
+	{"fa7f7fffff", 3.4028234663852886e+38},
+	{"fb7e37e43c8800759c", 1.0e+300},
+	{"f90001", 5.960464477539063e-8},
+	{"f90400", 0.00006103515625},
+	{"f9c400", -4.0},
+	{"fbc010666666666666", -4.1},
+	{"f97c00", math.Inf(1)},
+	{"f9fc00", math.Inf(-1)},
+	{"f4", false},
+	{"f5", true},
+	{"f6", nil},
+	{"f7", Undefined{}},
+	{"c074323031332d30332d32315432303a30343a30305a", Tag{0, "2013-03-21T20:04:00Z"}},
+	{"40", []byte{}},
+	{"4401020304", []byte{1, 2, 3, 4}},
+	{"60", ""},
+	{"6161", "a"},
+	{"6449455446", "IETF"},
+	{"62225c", "\"\\"},
+	{"62c3bc", "ü"},
+	{"80", []any{}},
+	{"83010203", []any{int64(1), int64(2), int64(3)}},
+	{"8301820203820405", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+	{"a0", map[any]any{}},
+	{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+	{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+	{"a56161614161626142616361436164614461656145", map[any]any{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}},
+}
+
+func TestMarshal(t *testing.T) {
+	for _, gold := range GoldenValues {
+		got, err := Marshal(gold.V)
+		if err != nil {
+			t.Errorf("%#v got error: %s", gold.V, err)
+			continue
+		}
+		if hex.EncodeToString(got) != gold.Hex {
+			t.Errorf("%#v got %x, want %s", gold.V, got, gold.Hex)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	for _, gold := range GoldenValues {
+		data, err := hex.DecodeString(gold.Hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Errorf("%s got error: %s", gold.Hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, gold.V) {
+			t.Errorf("%s got %#v, want %#v", gold.Hex, got, gold.V)
+		}
+	}
+}
+
+func TestMapKeyOrder(t *testing.T) {
+	// “The keys in every map MUST be sorted in the bytewise lexicographic
+	// order of their deterministic encodings.”
+	got, err := Marshal(map[any]any{
+		"aa":      int64(4),
+		"b":       int64(3),
+		int64(-1): int64(2),
+		int64(10): int64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "a40a012002616203626161" + "04"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("got %x, want %s", got, want)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, s := range []string{
+		"",                   // empty
+		"18",                 // argument missing
+		"1c",                 // reserved
+		"5f",                 // indefinite length
+		"62c3",               // text truncated
+		"9bffffffffffffffff", // length exceeds data
+		"a20101" + "0102",    // duplicate key
+		"0000",               // trailing data
+		"f818",               // simple value
+	} {
+		data, _ := hex.DecodeString(s)
+		if v, err := Unmarshal(data); err == nil {
+			t.Errorf("%s got %#v, want error", s, v)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	const doc = `{"id":"did:example:123","n":-7,"ok":true,"tags":["a","b"],"x":1.5,"z":null}`
+	data, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != doc {
+		t.Errorf("got %s, want %s", got, doc)
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, gold := range GoldenValues {
+		data, _ := hex.DecodeString(gold.Hex)
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		if _, err := Marshal(v); err != nil {
+			t.Errorf("%x decoded as %#v, which got encode error: %s", data, v, err)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package cbor
+
+import (
+	"encoding/json"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// MarshalDocument returns the backend.CBOR representation of doc. The encoding
+// is deterministic, such that equal documents produce equal bytes, which makes
+// the output suitable for hashing.
+func MarshalDocument(doc *backend.Document) ([]byte, error) {
+	return marshalJSON(doc)
+}
+
+// UnmarshalDocument parses the backend.CBOR representation. Errors wrap
+// backend.ErrMediaType.
+func UnmarshalDocument(data []byte) (*backend.Document, error) {
+	doc := new(backend.Document)
+	if err := unmarshalJSON(data, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// MarshalResult returns the deterministic CBOR of a resolution result.
+func MarshalResult(r *backend.ResolutionResult) ([]byte, error) {
+	return marshalJSON(r)
+}
+
+// UnmarshalResult parses the encoding of MarshalResult. Errors wrap
+// backend.ErrMediaType.
+func UnmarshalResult(data []byte) (*backend.ResolutionResult, error) {
+	r := new(backend.ResolutionResult)
+	if err := unmarshalJSON(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// The representations follow the JSON data model, i.e., CBOR is a drop-in
+// replacement for JSON.
+func marshalJSON(v any) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(j)
+}
+
+func unmarshalJSON(data []byte, v any) error {
+	j, err := ToJSON(data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", backend.ErrMediaType, err)
+	}
+	if err := json.Unmarshal(j, v); err != nil {
+		return fmt.Errorf("%w: %w", backend.ErrMediaType, err)
+	}
+	return nil
+}
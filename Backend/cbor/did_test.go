@@ -0,0 +1,69 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func TestDocument(t *testing.T) {
+	// same document in other key order
+	a := `{"id":"did:example:123","alsoKnownAs":["https://example.com/"],"service":[{"id":"#agent","type":"Agent","serviceEndpoint":"https://agent.example.com/"}]}`
+	b := `{"service":[{"serviceEndpoint":"https://agent.example.com/","type":"Agent","id":"#agent"}],"alsoKnownAs":["https://example.com/"],"id":"did:example:123"}`
+	var docA, docB backend.Document
+	if err := json.Unmarshal([]byte(a), &docA); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(b), &docB); err != nil {
+		t.Fatal(err)
+	}
+	encA, err := MarshalDocument(&docA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encB, err := MarshalDocument(&docB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encA, encB) {
+		t.Errorf("encoding not deterministic:\n%x\n%x", encA, encB)
+	}
+	if len(encA) >= len(a) {
+		t.Errorf("got %d bytes of CBOR for %d bytes of JSON", len(encA), len(a))
+	}
+
+	doc, err := UnmarshalDocument(encA)
+	if err != nil {
+		t.Fatal("decode error:", err)
+	}
+	if got, _ := json.Marshal(doc); string(got) != a {
+		t.Errorf("round trip got %s\nwant %s", got, a)
+	}
+
+	if _, err := UnmarshalDocument([]byte{0xa1, 0x01, 0x02}); !errors.Is(err, backend.ErrMediaType) {
+		t.Errorf("integer key got error %v, want ErrMediaType", err)
+	}
+}
+
+func TestResult(t *testing.T) {
+	in := &backend.ResolutionResult{
+		Document:       &backend.Document{Subject: backend.DID{Method: "example", SpecID: "123"}},
+		DocumentMeta:   &backend.Meta{Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), VersionID: "1"},
+		ResolutionMeta: &backend.ResolutionMeta{ContentType: backend.CBOR, Duration: 12 * time.Millisecond},
+	}
+	enc, err := MarshalResult(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := UnmarshalResult(enc)
+	if err != nil {
+		t.Fatal("decode error:", err)
+	}
+	if !out.Document.Subject.Equal(in.Document.Subject) || !out.DocumentMeta.Created.Equal(in.DocumentMeta.Created) || *out.ResolutionMeta != *in.ResolutionMeta {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
@@ -0,0 +1,108 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// FromJSON converts a JSON document into its deterministic CBOR encoding.
+// Numbers without fraction nor exponent convert to integers when in range.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("JSON data after top-level value")
+	}
+	return Marshal(fromJSONValue(v))
+}
+
+func fromJSONValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = fromJSONValue(v[i])
+		}
+		return v
+	case map[string]any:
+		for k := range v {
+			v[k] = fromJSONValue(v[k])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// ToJSON converts one CBOR data item into JSON. Byte strings convert to
+// base64url without padding, conform RFC 8949, subsection 6.1. Tags convert to
+// their content. Map keys must be text.
+func ToJSON(data []byte) ([]byte, error) {
+	v, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	v, err = toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func toJSONValue(v any) (any, error) {
+	switch v := v.(type) {
+	case []byte:
+		return base64.RawURLEncoding.EncodeToString(v), nil
+	case Undefined:
+		return nil, nil
+	case Tag:
+		return toJSONValue(v.Content)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("CBOR float %g has no JSON equivalent", v)
+		}
+		return v, nil
+	case []any:
+		for i := range v {
+			var err error
+			v[i], err = toJSONValue(v[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("CBOR map key %v has no JSON equivalent", k)
+			}
+			var err error
+			m[s], err = toJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return v, nil
+	}
+}
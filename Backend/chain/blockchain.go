@@ -0,0 +1,261 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+// ErrFork signals blocks which conflict with the local chain.
+var ErrFork = errors.New("chain: fork")
+
+// Blockchain is the local copy of the ledger, as an idchain.Ledger. Operations
+// go to a pool of pending transactions first, and they are confirmed once in
+// a block. The operation logs include pending transactions. Multiple
+// goroutines may invoke methods on a Blockchain simultaneously.
+type Blockchain struct {
+	Consensus Consensus
+
+	mutex   sync.RWMutex
+	blocks  []*Block
+	final   int // number of blocks which can not revert
+	pending []Transaction
+
+	confirmed map[backend.DID][]string // operation logs in blocks
+	logs      map[backend.DID][]string // confirmed, and then pending
+
+	changed chan struct{} // closes on the next change, if any
+}
+
+// Changed returns a channel which closes on the next change of the blocks, or
+// of their finality, e.g., to follow the chain without polling.
+func (c *Blockchain) Changed() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return c.changed
+}
+
+// Notify closes the channel of Changed, if any. The write lock must be held.
+func (c *Blockchain) notify() {
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+}
+
+// Head returns the last block, or nil when empty.
+func (c *Blockchain) Head() *Block {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if len(c.blocks) == 0 {
+		return nil
+	}
+	return c.blocks[len(c.blocks)-1]
+}
+
+// Block returns the block at height.
+func (c *Blockchain) Block(height uint64) (*Block, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if height >= uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("chain: no block at height %d", height)
+	}
+	return c.blocks[height], nil
+}
+
+// Len returns the number of blocks, which is the height of the next block.
+func (c *Blockchain) Len() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return uint64(len(c.blocks))
+}
+
+// Final returns the number of blocks which can not revert.
+func (c *Blockchain) Final() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return uint64(c.final)
+}
+
+// Pending returns the transactions not in a block yet, in order of arrival.
+func (c *Blockchain) Pending() []Transaction {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]Transaction(nil), c.pending...)
+}
+
+// Entries implements the idchain.Ledger interface.
+func (c *Blockchain) Entries(_ context.Context, did backend.DID) ([]string, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	entries, ok := c.logs[did]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not on ledger", backend.ErrNotFound, did.String())
+	}
+	return entries[:len(entries):len(entries)], nil
+}
+
+// Append implements the idchain.Ledger interface. The entry becomes pending.
+func (c *Blockchain) Append(_ context.Context, did backend.DID, n int, entry string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.logs[did]) != n {
+		return fmt.Errorf("%w: %s has %d entries, not %d", idchain.ErrConflict, did.String(), len(c.logs[did]), n)
+	}
+	if c.logs == nil {
+		c.logs = make(map[backend.DID][]string)
+	}
+	c.logs[did] = append(c.logs[did], entry)
+	c.pending = append(c.pending, Transaction{Entry: entry})
+	return nil
+}
+
+// AddBlock appends b after validation with the Consensus, including each
+// operation against the confirmed logs. Pending transactions which conflict
+// with b are dropped. Each addition is a "ledger.addBlock" span with the
+// height and the number of transactions.
+func (c *Blockchain) AddBlock(ctx context.Context, b *Block) (err error) {
+	ctx, span := backend.StartSpan(ctx, "ledger.addBlock", slog.Uint64("height", b.Height), slog.Int("transactions", len(b.Transactions)))
+	defer func() { span.End(err) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if b.Height != uint64(len(c.blocks)) {
+		return fmt.Errorf("%w: block %d on chain of %d blocks", ErrFork, b.Height, len(c.blocks))
+	}
+	if c.confirmed == nil {
+		c.confirmed = make(map[backend.DID][]string)
+	}
+	if err := c.extend(ctx, c.blocks, b, c.confirmed); err != nil {
+		return err
+	}
+	c.blocks = append(c.blocks, b)
+	c.repool()
+	c.notify()
+	return nil
+}
+
+// Extend validates b as the successor of blocks, and it appends the
+// operations of b to confirmed, which are the logs of blocks. Confirmed is
+// not modified on error.
+func (c *Blockchain) extend(ctx context.Context, blocks []*Block, b *Block, confirmed map[backend.DID][]string) error {
+	var prev *Block
+	if len(blocks) != 0 {
+		prev = blocks[len(blocks)-1]
+	}
+	if err := c.Consensus.ValidateBlock(ctx, prev, b); err != nil {
+		return err
+	}
+	updates := make(map[backend.DID][]string)
+	for i := range b.Transactions {
+		op, err := b.Transactions[i].Operation()
+		if err != nil {
+			return fmt.Errorf("block %d transaction № %d: %w", b.Height, i+1, err)
+		}
+		log, ok := updates[op.DID]
+		if !ok {
+			log = confirmed[op.DID]
+		}
+		log = append(log[:len(log):len(log)], b.Transactions[i].Entry)
+		if _, err := idchain.Replay(op.DID, log); err != nil {
+			return fmt.Errorf("block %d transaction № %d: %w", b.Height, i+1, err)
+		}
+		updates[op.DID] = log
+	}
+	for did, log := range updates {
+		confirmed[did] = log
+	}
+	return nil
+}
+
+// Finalize marks the blocks up to and including height as final.
+func (c *Blockchain) Finalize(height uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if n := int(min(height+1, uint64(len(c.blocks)))); n > c.final {
+		c.final = n
+		c.notify()
+	}
+}
+
+// Reorganize replaces the blocks from the height of the first in blocks on,
+// granted the replacement results in a longer chain, and granted no final
+// blocks revert. Pending transactions are retained when still valid. Each
+// reorganization is a "ledger.reorganize" span with the height of the first
+// block and the number of blocks.
+func (c *Blockchain) Reorganize(ctx context.Context, blocks []*Block) (err error) {
+	if len(blocks) == 0 {
+		return nil
+	}
+	ctx, span := backend.StartSpan(ctx, "ledger.reorganize", slog.Uint64("from", blocks[0].Height), slog.Int("blocks", len(blocks)))
+	defer func() { span.End(err) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	from := blocks[0].Height
+	switch {
+	case from > uint64(len(c.blocks)):
+		return fmt.Errorf("%w: reorganization from height %d on chain of %d blocks", ErrFork, from, len(c.blocks))
+	case from < uint64(c.final):
+		return fmt.Errorf("%w: reorganization from height %d reverts final blocks", ErrFork, from)
+	case from+uint64(len(blocks)) <= uint64(len(c.blocks)):
+		return fmt.Errorf("%w: reorganization to %d blocks does not exceed %d", ErrFork, from+uint64(len(blocks)), len(c.blocks))
+	}
+	chain := c.blocks[:from:from]
+	confirmed := confirmedLogs(chain)
+	for _, b := range blocks {
+		if err := c.extend(ctx, chain, b, confirmed); err != nil {
+			return err
+		}
+		chain = append(chain, b)
+	}
+	c.blocks, c.confirmed = chain, confirmed
+	c.repool()
+	c.notify()
+	return nil
+}
+
+// Repool derives the operation logs from the confirmed ones, with the pending
+// transactions which remain valid.
+func (c *Blockchain) repool() {
+	c.logs = make(map[backend.DID][]string, len(c.confirmed))
+	for did, log := range c.confirmed {
+		c.logs[did] = log[:len(log):len(log)]
+	}
+	pending := c.pending[:0]
+	for _, tx := range c.pending {
+		op, err := tx.Operation()
+		if err != nil {
+			continue
+		}
+		log := append(c.logs[op.DID], tx.Entry)
+		if _, err := idchain.Replay(op.DID, log); err != nil {
+			continue // confirmed already, or conflicts with the chain
+		}
+		c.logs[op.DID] = log
+		pending = append(pending, tx)
+	}
+	clear(c.pending[len(pending):])
+	c.pending = pending
+}
+
+// ConfirmedLogs returns the operation logs in blocks.
+func confirmedLogs(blocks []*Block) map[backend.DID][]string {
+	logs := make(map[backend.DID][]string)
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			op, err := tx.Operation()
+			if err != nil {
+				continue // validated on add
+			}
+			logs[op.DID] = append(logs[op.DID], tx.Entry)
+		}
+	}
+	return logs
+}
@@ -0,0 +1,187 @@
+// Package chain provides the ledger data structures of IDChain. Blocks order
+// DID operations in transactions, and each block commits to its transactions
+// with a Merkle root, and to its predecessor with a hash, such that single
+// operations can be proven with a Merkle path against a block header.
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+// Verification errors
+var (
+	ErrLink  = errors.New("chain: block does not link to its predecessor")
+	ErrRoot  = errors.New("chain: Merkle root does not match transactions")
+	ErrProof = errors.New("chain: Merkle proof does not match root")
+)
+
+// Hash is a SHA-256 sum.
+type Hash [sha256.Size]byte
+
+// String returns the hex encoding.
+func (h Hash) String() string { return hex.EncodeToString(h[:]) }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (h Hash) MarshalText() ([]byte, error) {
+	return hex.AppendEncode(nil, h[:]), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (h *Hash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(h) {
+		return fmt.Errorf("chain: hash of %d hex digits, want 64", len(text))
+	}
+	_, err := hex.Decode(h[:], text)
+	return err
+}
+
+// Transaction carries a DID operation, i.e., an entry of a did:idchain log.
+type Transaction struct {
+	Entry string `json:"entry"`
+}
+
+// Hash returns the Merkle leaf hash of tx.
+func (tx *Transaction) Hash() Hash {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write([]byte(tx.Entry))
+	return Hash(h.Sum(nil))
+}
+
+// Operation decodes the entry without verification.
+func (tx *Transaction) Operation() (*idchain.Operation, error) {
+	_, op, err := idchain.ParseEntry(tx.Entry)
+	return op, err
+}
+
+// Header is the part of a block covered by the block hash.
+type Header struct {
+	Height     uint64    `json:"height"`
+	PrevHash   Hash      `json:"prevHash"` // zero for the genesis block
+	Time       time.Time `json:"time"`
+	MerkleRoot Hash      `json:"merkleRoot"`
+}
+
+// Hash returns the SHA-256 of the header in binary form, with the height and
+// the time in Unix nanoseconds as 64-bit big-endian.
+func (h *Header) Hash() Hash {
+	buf := make([]byte, 0, 8+len(h.PrevHash)+8+len(h.MerkleRoot))
+	buf = binary.BigEndian.AppendUint64(buf, h.Height)
+	buf = append(buf, h.PrevHash[:]...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Time.UnixNano()))
+	buf = append(buf, h.MerkleRoot[:]...)
+	return sha256.Sum256(buf)
+}
+
+// Block is a unit of the ledger.
+type Block struct {
+	Header
+	Transactions []Transaction `json:"transactions"`
+
+	// Seals are the approvals of the Consensus, which are not covered by
+	// the block hash.
+	Seals []string `json:"seals,omitempty"`
+}
+
+// NewBlock returns the successor of prev with txs. The genesis block has a
+// nil prev.
+func NewBlock(prev *Block, txs []Transaction, now time.Time) *Block {
+	b := &Block{
+		Header:       Header{Time: now.UTC()},
+		Transactions: txs,
+	}
+	if prev != nil {
+		b.Height = prev.Height + 1
+		b.PrevHash = prev.Hash()
+	}
+	b.MerkleRoot = MerkleRoot(b.leaves())
+	return b
+}
+
+func (b *Block) leaves() []Hash {
+	leaves := make([]Hash, len(b.Transactions))
+	for i := range b.Transactions {
+		leaves[i] = b.Transactions[i].Hash()
+	}
+	return leaves
+}
+
+// Verify checks the Merkle root of b against its transactions.
+func (b *Block) Verify() error {
+	if got := MerkleRoot(b.leaves()); got != b.MerkleRoot {
+		return fmt.Errorf("%w: block %d has %s, transactions give %s", ErrRoot, b.Height, b.MerkleRoot, got)
+	}
+	return nil
+}
+
+// VerifyLink checks that next is the successor of prev.
+func VerifyLink(prev, next *Header) error {
+	if next.Height != prev.Height+1 {
+		return fmt.Errorf("%w: height %d after %d", ErrLink, next.Height, prev.Height)
+	}
+	if next.PrevHash != prev.Hash() {
+		return fmt.Errorf("%w: block %d has previous hash %s, want %s", ErrLink, next.Height, next.PrevHash, prev.Hash())
+	}
+	if next.Time.Before(prev.Time) {
+		return fmt.Errorf("%w: block %d precedes block %d in time", ErrLink, next.Height, prev.Height)
+	}
+	return nil
+}
+
+// VerifyChain checks each block, and the linkage of consecutive blocks.
+func VerifyChain(blocks []*Block) error {
+	for i, b := range blocks {
+		if err := b.Verify(); err != nil {
+			return err
+		}
+		if i != 0 {
+			if err := VerifyLink(&blocks[i-1].Header, &b.Header); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Proof returns the Merkle proof of transaction i.
+func (b *Block) Proof(i int) (*Proof, error) {
+	if i < 0 || i >= len(b.Transactions) {
+		return nil, fmt.Errorf("chain: transaction № %d not in block %d of %d transactions", i, b.Height, len(b.Transactions))
+	}
+	return &Proof{
+		Height: b.Height,
+		Index:  i,
+		Size:   len(b.Transactions),
+		Path:   merklePath(b.leaves(), i),
+	}, nil
+}
+
+// Proof is an inclusion proof of a transaction in a block.
+type Proof struct {
+	Height uint64 `json:"height"`
+	Index  int    `json:"index"` // transaction position
+	Size   int    `json:"size"`  // transaction count
+	Path   []Hash `json:"path"`  // audit path, bottom up
+}
+
+// Verify checks that tx is included in the block of header.
+func (p *Proof) Verify(header *Header, tx *Transaction) error {
+	if p.Height != header.Height {
+		return fmt.Errorf("%w: proof for block %d, header of %d", ErrProof, p.Height, header.Height)
+	}
+	root, err := rootFromPath(tx.Hash(), p.Index, p.Size, p.Path)
+	if err != nil {
+		return err
+	}
+	if root != header.MerkleRoot {
+		return fmt.Errorf("%w: block %d", ErrProof, header.Height)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package chain
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+func testTransactions(n int) []Transaction {
+	txs := make([]Transaction, n)
+	for i := range txs {
+		txs[i].Entry = fmt.Sprintf("entry-%d", i)
+	}
+	return txs
+}
+
+func TestMerkleRoot(t *testing.T) {
+	if got, want := MerkleRoot(nil), Hash(sha256.Sum256(nil)); got != want {
+		t.Errorf("empty root %s, want %s", got, want)
+	}
+	txs := testTransactions(3)
+	a, b, c := txs[0].Hash(), txs[1].Hash(), txs[2].Hash()
+	want := nodeHash(nodeHash(a, b), c)
+	if got := MerkleRoot([]Hash{a, b, c}); got != want {
+		t.Errorf("root of 3 leaves %s, want %s", got, want)
+	}
+}
+
+func TestProof(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		b := NewBlock(nil, testTransactions(size), time.Now())
+		for i := range b.Transactions {
+			p, err := b.Proof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Verify(&b.Header, &b.Transactions[i]); err != nil {
+				t.Errorf("size %d index %d: %s", size, i, err)
+			}
+			other := Transaction{Entry: "forged"}
+			if err := p.Verify(&b.Header, &other); !errors.Is(err, ErrProof) {
+				t.Errorf("size %d index %d: forged transaction got error %v, want ErrProof", size, i, err)
+			}
+			if size > 1 {
+				p.Path = p.Path[1:]
+				if err := p.Verify(&b.Header, &b.Transactions[i]); !errors.Is(err, ErrProof) {
+					t.Errorf("size %d index %d: short path got error %v, want ErrProof", size, i, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	t0 := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	genesis := NewBlock(nil, nil, t0)
+	b1 := NewBlock(genesis, testTransactions(2), t0.Add(time.Second))
+	b2 := NewBlock(b1, testTransactions(5), t0.Add(2*time.Second))
+	if err := VerifyChain([]*Block{genesis, b1, b2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChain([]*Block{genesis, b2}); !errors.Is(err, ErrLink) {
+		t.Errorf("gap got error %v, want ErrLink", err)
+	}
+
+	// JSON round trip retains the hash
+	bytes, err := json.Marshal(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Block
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash() != b1.Hash() {
+		t.Errorf("hash changed after JSON round trip of %s", bytes)
+	}
+
+	b1.Transactions[0].Entry = "tampered"
+	if err := VerifyChain([]*Block{genesis, b1, b2}); !errors.Is(err, ErrRoot) {
+		t.Errorf("tampered transaction got error %v, want ErrRoot", err)
+	}
+}
+
+func TestAuthority(t *testing.T) {
+	ctx := context.Background()
+	var validators []backend.DID
+	var signers []crypto.Signer
+	for i := 0; i < 3; i++ {
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		did, err := didkey.New(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validators = append(validators, did)
+		signers = append(signers, key)
+	}
+	node := func(i int) *Authority {
+		return &Authority{
+			Validators: validators,
+			Resolver:   new(didkey.Resolver),
+			KeyID:      &backend.URL{DID: validators[i], RawFragment: "#" + validators[i].SpecID},
+			Signer:     signers[i],
+		}
+	}
+
+	genesis, err := node(0).ProposeBlock(ctx, nil, nil)
+	if err != nil {
+		t.Fatal("genesis proposal:", err)
+	}
+	if err := node(2).ValidateBlock(ctx, nil, genesis); err != nil {
+		t.Fatal("genesis validation:", err)
+	}
+	if _, err := node(0).ProposeBlock(ctx, genesis, nil); !errors.Is(err, ErrProposer) {
+		t.Errorf("proposal out of turn got error %v, want ErrProposer", err)
+	}
+
+	b, err := node(1).ProposeBlock(ctx, genesis, testTransactions(2))
+	if err != nil {
+		t.Fatal("proposal:", err)
+	}
+	if err := node(0).ValidateBlock(ctx, genesis, b); err != nil {
+		t.Fatal("validation:", err)
+	}
+	if final, err := node(1).Finalize(ctx, b); err != nil || final {
+		t.Errorf("finalize with proposer seal only got %t, error %v", final, err)
+	}
+	if final, err := node(2).Finalize(ctx, b); err != nil || !final {
+		t.Errorf("finalize with 2 of 3 seals got %t, error %v", final, err)
+	}
+	if n := len(b.Seals); n != 2 {
+		t.Errorf("got %d seals, want 2", n)
+	}
+
+	// reordered seals put another validator as proposer
+	b.Seals[0], b.Seals[1] = b.Seals[1], b.Seals[0]
+	if err := node(0).ValidateBlock(ctx, genesis, b); !errors.Is(err, ErrProposer) {
+		t.Errorf("swapped seals got error %v, want ErrProposer", err)
+	}
+	b.Seals = []string{b.Seals[1], b.Seals[1]}
+	if err := node(0).ValidateBlock(ctx, genesis, b); !errors.Is(err, ErrSeal) {
+		t.Errorf("duplicate seal got error %v, want ErrSeal", err)
+	}
+	b.Transactions = testTransactions(1)
+	b.MerkleRoot = MerkleRoot(b.leaves())
+	if err := node(0).ValidateBlock(ctx, genesis, b); !errors.Is(err, ErrSeal) {
+		t.Errorf("altered block got error %v, want ErrSeal", err)
+	}
+}
+
+func TestBlockchain(t *testing.T) {
+	ctx := context.Background()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := didkey.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority := &Authority{
+		Validators: []backend.DID{validator},
+		Resolver:   new(didkey.Resolver),
+		KeyID:      &backend.URL{DID: validator, RawFragment: "#" + validator.SpecID},
+		Signer:     key,
+	}
+	c := &Blockchain{Consensus: authority}
+	propose := func(prev *Block, txs []Transaction) *Block {
+		t.Helper()
+		b, err := authority.ProposeBlock(ctx, prev, txs)
+		if err != nil {
+			t.Fatal("proposal:", err)
+		}
+		return b
+	}
+
+	// operation log of one DID
+	id := backend.URL{DID: idchain.Placeholder, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, idchain.Placeholder, pub, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	genesis, did, err := idchain.NewGenesis(&backend.Document{
+		Subject:              idchain.Placeholder,
+		VerificationMethods:  []*backend.VerificationMethod{m},
+		CapabilityInvocation: &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}},
+	}, &id, key, t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := &backend.URL{DID: did, RawFragment: "#key-1"}
+	update, err := idchain.NewUpdate(genesis, &backend.Document{Subject: did, AlsoKnownAs: []string{"https://a.example"}}, keyID, key, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rival, err := idchain.NewUpdate(genesis, &backend.Document{Subject: did, AlsoKnownAs: []string{"https://b.example"}}, keyID, key, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := idchain.Submit(ctx, c, genesis); err != nil {
+		t.Fatal("submit genesis:", err)
+	}
+	if n := len(c.Pending()); n != 1 {
+		t.Fatalf("got %d pending, want 1", n)
+	}
+	b0 := propose(nil, c.Pending())
+	changed := c.Changed()
+	if err := c.AddBlock(ctx, b0); err != nil {
+		t.Fatal("add genesis block:", err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("change channel open after block")
+	}
+	if n := len(c.Pending()); n != 0 {
+		t.Errorf("got %d pending after block, want 0", n)
+	}
+	if err := c.AddBlock(ctx, b0); !errors.Is(err, ErrFork) {
+		t.Errorf("block at height 0 again got error %v, want ErrFork", err)
+	}
+
+	if _, err := idchain.Submit(ctx, c, update); err != nil {
+		t.Fatal("submit update:", err)
+	}
+	if entries, _ := c.Entries(ctx, did); len(entries) != 2 {
+		t.Errorf("got %d entries with pending update, want 2", len(entries))
+	}
+	bad := propose(b0, []Transaction{{Entry: genesis}})
+	if err := c.AddBlock(ctx, bad); !errors.Is(err, idchain.ErrLog) {
+		t.Errorf("block with replayed genesis got error %v, want ErrLog", err)
+	}
+
+	// rival branch confirms a conflicting update
+	b1 := propose(b0, []Transaction{{Entry: rival}})
+	b2 := propose(b1, nil)
+	if err := c.Reorganize(ctx, []*Block{b1, b2}); err != nil {
+		t.Fatal("reorganization:", err)
+	}
+	if err := c.Reorganize(ctx, []*Block{b1, b2}); !errors.Is(err, ErrFork) {
+		t.Errorf("reorganization to an equal length got error %v, want ErrFork", err)
+	}
+	if c.Len() != 3 || c.Head() != b2 {
+		t.Errorf("got %d blocks after reorganization, want 3", c.Len())
+	}
+	if n := len(c.Pending()); n != 0 {
+		t.Errorf("got %d pending after reorganization, want conflicting update dropped", n)
+	}
+	if entries, _ := c.Entries(ctx, did); len(entries) != 2 || entries[1] != rival {
+		t.Errorf("got entries %q, want rival update", entries)
+	}
+
+	c.Finalize(1)
+	if err := c.Reorganize(ctx, []*Block{propose(b0, nil), b1, b2}); !errors.Is(err, ErrFork) {
+		t.Errorf("reorganization of final blocks got error %v, want ErrFork", err)
+	}
+}
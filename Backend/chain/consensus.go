@@ -0,0 +1,217 @@
+package chain
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+)
+
+// Consensus errors
+var (
+	ErrProposer = errors.New("chain: block from other than the proposer in turn")
+	ErrSeal     = errors.New("chain: block seal not acceptable")
+)
+
+// Consensus decides on the blocks of the ledger. Engines may range from a
+// fixed set of authorities up to crash or Byzantine fault tolerant protocols,
+// such as Raft or PBFT, which exchange messages outside of this interface.
+// Implementations must be safe for concurrent use.
+type Consensus interface {
+	// ProposeBlock returns a new block with txs on top of prev, which is
+	// nil for the genesis. The local node must be eligible to propose.
+	ProposeBlock(ctx context.Context, prev *Block, txs []Transaction) (*Block, error)
+
+	// ValidateBlock checks b as the successor of prev, including the
+	// authorization of its proposer.
+	ValidateBlock(ctx context.Context, prev, b *Block) error
+
+	// Finalize adds the local approval to a valid block, and it reports
+	// whether b is final, i.e., it can not be reverted.
+	Finalize(ctx context.Context, b *Block) (final bool, err error)
+}
+
+// SealType is the JWT "typ" of seals.
+const SealType = "idchain-seal+jwt"
+
+// SealClaims are the JWT claims of a seal. The subject is the block hash.
+type sealClaims struct {
+	didjwt.Claims
+	Height uint64 `json:"height"`
+}
+
+// Authority is a proof-of-authority Consensus. A fixed set of validators take
+// turns in proposing blocks, and each validator seals blocks with a JWT of
+// their DID. A block is final with seals from a majority of the validators.
+type Authority struct {
+	// Validators are the authorities in order of their turn, i.e., the
+	// proposer of height h is Validators[h % len(Validators)].
+	Validators []backend.DID
+
+	// Resolver provides the validator documents. Seals must be signed
+	// with an assertion method.
+	Resolver backend.Resolver
+
+	// KeyID and Signer are the local validator key, if any. Nodes without
+	// a key can validate only.
+	KeyID  *backend.URL
+	Signer crypto.Signer
+
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (a *Authority) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// Proposer returns the validator in turn for height. The zero value means
+// none.
+func (a *Authority) Proposer(height uint64) backend.DID {
+	if len(a.Validators) == 0 {
+		return backend.DID{}
+	}
+	return a.Validators[height%uint64(len(a.Validators))]
+}
+
+// Quorum returns the number of seals needed for finality.
+func (a *Authority) Quorum() int {
+	return len(a.Validators)/2 + 1
+}
+
+// Seal returns the seal of the local validator over h.
+func (a *Authority) seal(h *Header) (string, error) {
+	if a.Signer == nil || a.KeyID == nil {
+		return "", errors.New("chain: no local validator key")
+	}
+	claims := sealClaims{
+		Claims: didjwt.Claims{
+			Issuer:  a.KeyID.DID.String(),
+			Subject: h.Hash().String(),
+		},
+		Height: h.Height,
+	}
+	return didjwt.SignTyp(SealType, &claims, a.KeyID, a.Signer)
+}
+
+// VerifySeal returns the validator of a seal over h.
+func (a *Authority) verifySeal(ctx context.Context, h *Header, seal string) (backend.DID, error) {
+	verifier := didjwt.Verifier{Resolver: a.Resolver}
+	var claims sealClaims
+	did, err := verifier.Verify(ctx, seal, h.Time, &claims)
+	if err != nil {
+		return backend.DID{}, fmt.Errorf("%w: %w", ErrSeal, err)
+	}
+	if claims.Subject != h.Hash().String() || claims.Height != h.Height {
+		return backend.DID{}, fmt.Errorf("%w: seal for block %d %s", ErrSeal, claims.Height, claims.Subject)
+	}
+	if !a.isValidator(did) {
+		return backend.DID{}, fmt.Errorf("%w: %s is not a validator", ErrSeal, did.String())
+	}
+	return did, nil
+}
+
+func (a *Authority) isValidator(did backend.DID) bool {
+	for _, v := range a.Validators {
+		if v.Equal(did) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProposeBlock implements the Consensus interface. The block has the seal of
+// the local validator.
+func (a *Authority) ProposeBlock(_ context.Context, prev *Block, txs []Transaction) (*Block, error) {
+	var height uint64
+	if prev != nil {
+		height = prev.Height + 1
+	}
+	if a.KeyID == nil || !a.Proposer(height).Equal(a.KeyID.DID) {
+		return nil, fmt.Errorf("%w: height %d is for %s", ErrProposer, height, a.Proposer(height).String())
+	}
+	now := a.now()
+	if prev != nil && now.Before(prev.Time) {
+		now = prev.Time
+	}
+	b := NewBlock(prev, txs, now)
+	seal, err := a.seal(&b.Header)
+	if err != nil {
+		return nil, err
+	}
+	b.Seals = []string{seal}
+	return b, nil
+}
+
+// ValidateBlock implements the Consensus interface. The first seal must be of
+// the proposer in turn, and each seal must be of a distinct validator.
+func (a *Authority) ValidateBlock(ctx context.Context, prev, b *Block) error {
+	if prev == nil {
+		if b.Height != 0 || b.PrevHash != (Hash{}) {
+			return fmt.Errorf("%w: genesis at height %d", ErrLink, b.Height)
+		}
+	} else if err := VerifyLink(&prev.Header, &b.Header); err != nil {
+		return err
+	}
+	if err := b.Verify(); err != nil {
+		return err
+	}
+	if len(b.Seals) == 0 {
+		return fmt.Errorf("%w: block %d has no seal", ErrProposer, b.Height)
+	}
+	_, err := a.validators(ctx, b)
+	return err
+}
+
+// Validators returns the validators which sealed b, with the proposer first.
+func (a *Authority) validators(ctx context.Context, b *Block) ([]backend.DID, error) {
+	dids := make([]backend.DID, 0, len(b.Seals))
+	for i, seal := range b.Seals {
+		did, err := a.verifySeal(ctx, &b.Header, seal)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && !did.Equal(a.Proposer(b.Height)) {
+			return nil, fmt.Errorf("%w: block %d proposed by %s", ErrProposer, b.Height, did.String())
+		}
+		for _, d := range dids {
+			if d.Equal(did) {
+				return nil, fmt.Errorf("%w: duplicate seal of %s", ErrSeal, did.String())
+			}
+		}
+		dids = append(dids, did)
+	}
+	return dids, nil
+}
+
+// Finalize implements the Consensus interface. The seal of the local
+// validator is added when absent. The block must be validated beforehand.
+// Multiple goroutines must not Finalize the same block simultaneously.
+func (a *Authority) Finalize(ctx context.Context, b *Block) (bool, error) {
+	dids, err := a.validators(ctx, b)
+	if err != nil {
+		return false, err
+	}
+	if a.KeyID != nil && a.Signer != nil && a.isValidator(a.KeyID.DID) {
+		sealed := false
+		for _, d := range dids {
+			sealed = sealed || d.Equal(a.KeyID.DID)
+		}
+		if !sealed {
+			seal, err := a.seal(&b.Header)
+			if err != nil {
+				return false, err
+			}
+			b.Seals = append(b.Seals, seal)
+			dids = append(dids, a.KeyID.DID)
+		}
+	}
+	return len(dids) >= a.Quorum(), nil
+}
@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Domain separation conform RFC 6962, section 2.1
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+func nodeHash(left, right Hash) Hash {
+	var buf [1 + 2*sha256.Size]byte
+	buf[0] = nodePrefix
+	copy(buf[1:], left[:])
+	copy(buf[1+sha256.Size:], right[:])
+	return sha256.Sum256(buf[:])
+}
+
+// Split returns the largest power of two less than n, for n > 1.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// MerkleRoot returns the Merkle Tree Hash of the leaf hashes, conform
+// RFC 6962, section 2.1. The root of no leaves is the SHA-256 of nothing.
+func MerkleRoot(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(MerkleRoot(leaves[:k]), MerkleRoot(leaves[k:]))
+}
+
+// MerklePath returns the audit path of leaf m, conform RFC 6962, section 2.1.1.
+func merklePath(leaves []Hash, m int) []Hash {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if m < k {
+		return append(merklePath(leaves[:k], m), MerkleRoot(leaves[k:]))
+	}
+	return append(merklePath(leaves[k:], m-k), MerkleRoot(leaves[:k]))
+}
+
+// RootFromPath returns the root implied by an audit path, conform the
+// verification algorithm of RFC 9162, section 2.1.3.2.
+func rootFromPath(leaf Hash, index, size int, path []Hash) (Hash, error) {
+	if index < 0 || index >= size {
+		return Hash{}, fmt.Errorf("%w: index %d of size %d", ErrProof, index, size)
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return Hash{}, fmt.Errorf("%w: path too long", ErrProof)
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return Hash{}, fmt.Errorf("%w: path too short", ErrProof)
+	}
+	return r, nil
+}
@@ -0,0 +1,35 @@
+// Binding of idchain.wasm for browser wallets. Load wasm_exec.js from the Go
+// distribution ($(go env GOROOT)/lib/wasm) first, for the global Go class.
+//
+//	import { load } from "./idchain.js";
+//	const idchain = await load("idchain.wasm");
+//	const { issuer, claims } = idchain.verifyJWT(token);
+//
+// Functions return parsed JSON, and they throw an Error on failure.
+
+// Load instantiates the module from a URL, a Response, or the bytes, and it
+// returns the functions bound.
+export async function load(source = "idchain.wasm") {
+	const go = new Go();
+	let instance;
+	if (source instanceof ArrayBuffer || ArrayBuffer.isView(source)) {
+		({ instance } = await WebAssembly.instantiate(source, go.importObject));
+	} else {
+		const response = source instanceof Response ? source : fetch(source);
+		({ instance } = await WebAssembly.instantiateStreaming(response, go.importObject));
+	}
+	go.run(instance); // installs globalThis.idchain, and keeps running
+
+	const api = globalThis.idchain;
+	const bound = {};
+	for (const name of Object.keys(api)) {
+		bound[name] = (...args) => {
+			const out = api[name](...args);
+			if (out.error !== undefined) {
+				throw new Error(`idchain.${name}: ${out.error}`);
+			}
+			return JSON.parse(out.result);
+		};
+	}
+	return bound;
+}
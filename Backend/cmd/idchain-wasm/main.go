@@ -0,0 +1,181 @@
+//go:build js && wasm
+
+// Command idchain-wasm exposes DID logic to JavaScript, for browser wallets.
+// The functions install on the global idchain object, and they return either
+// {result: JSON} or {error: message}. Use idchain.js for a binding which
+// parses the JSON, and which throws on errors.
+//
+//	GOOS=js GOARCH=wasm go build -o idchain.wasm ./Backend/cmd/idchain-wasm
+//
+// Resolution is limited to the methods which need no network access, i.e.,
+// did:key and did:peer.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall/js"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Resolver has the offline DID methods.
+var resolver = new(backend.MethodRegistry)
+
+func init() {
+	resolver.Register(didkey.Method, new(didkey.Resolver))
+	resolver.Register(didpeer.Method, new(didpeer.Resolver))
+}
+
+// Functions by name, with string arguments.
+var functions = map[string]func(args []string) (any, error){
+	"parse":            parse,
+	"validDID":         validDID,
+	"resolve":          resolve,
+	"keyDID":           keyDID,
+	"verifyJWT":        verifyJWT,
+	"verifyCredential": verifyCredential,
+}
+
+func main() {
+	api := js.Global().Get("Object").New()
+	for name, f := range functions {
+		api.Set(name, wrap(f))
+	}
+	js.Global().Set("idchain", api)
+	select {} // serve calls until the page unloads
+}
+
+// Wrap converts f into a JavaScript function.
+func wrap(f func(args []string) (any, error)) js.Func {
+	return js.FuncOf(func(_ js.Value, args []js.Value) any {
+		strs := make([]string, len(args))
+		for i, a := range args {
+			if a.Type() != js.TypeString {
+				return map[string]any{"error": fmt.Sprintf("argument № %d is not a string", i+1)}
+			}
+			strs[i] = a.String()
+		}
+		v, err := f(strs)
+		if err == nil {
+			var b []byte
+			b, err = json.Marshal(v)
+			if err == nil {
+				return map[string]any{"result": string(b)}
+			}
+		}
+		return map[string]any{"error": err.Error()}
+	})
+}
+
+var errArgs = errors.New("wrong number of arguments")
+
+func arg(args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%w: got %d, want %d", errArgs, len(args), n)
+	}
+	return nil
+}
+
+// Parse returns the components of a DID URL.
+func parse(args []string) (any, error) {
+	if err := arg(args, 1); err != nil {
+		return nil, err
+	}
+	u, err := backend.ParseURL(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"did":       u.DID.String(),
+		"method":    u.Method,
+		"specId":    u.SpecID,
+		"path":      u.RawPath,
+		"query":     u.RawQuery,
+		"fragment":  u.RawFragment,
+		"relative":  u.IsRelative(),
+		"canonical": u.Canonical(),
+	}, nil
+}
+
+// ValidDID returns whether the argument is a DID, i.e., without any path,
+// query or fragment. Use parse for DID URLs.
+func validDID(args []string) (any, error) {
+	if err := arg(args, 1); err != nil {
+		return nil, err
+	}
+	return backend.Valid(args[0]), nil
+}
+
+// Resolve returns the resolution result of an offline DID method.
+func resolve(args []string) (any, error) {
+	if err := arg(args, 1); err != nil {
+		return nil, err
+	}
+	did, err := backend.Parse(args[0])
+	if err != nil {
+		return nil, err
+	}
+	doc, meta, err := resolver.Resolve(context.Background(), did)
+	if err != nil {
+		return nil, err
+	}
+	return &backend.ResolutionResult{
+		Document:       doc,
+		DocumentMeta:   meta,
+		ResolutionMeta: &backend.ResolutionMeta{ContentType: "application/did+json"},
+	}, nil
+}
+
+// KeyDID returns the did:key of a public JWK, such as one exported from the
+// Web Crypto API.
+func keyDID(args []string) (any, error) {
+	if err := arg(args, 1); err != nil {
+		return nil, err
+	}
+	var k jose.JWK
+	if err := json.Unmarshal([]byte(args[0]), &k); err != nil {
+		return nil, fmt.Errorf("JWK: %w", err)
+	}
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	did, err := didkey.New(pub)
+	if err != nil {
+		return nil, err
+	}
+	return did.String(), nil
+}
+
+// VerifyJWT returns the issuer and the claims of a valid token.
+func verifyJWT(args []string) (any, error) {
+	if err := arg(args, 1); err != nil {
+		return nil, err
+	}
+	v := didjwt.Verifier{Resolver: resolver, Leeway: time.Minute}
+	var claims map[string]any
+	issuer, err := v.Verify(context.Background(), args[0], time.Now(), &claims)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"issuer": issuer.String(), "claims": claims}, nil
+}
+
+// VerifyCredential returns a valid credential, either secured as a JWT, or
+// with an embedded proof.
+func verifyCredential(args []string) (any, error) {
+	if err := arg(args, 1); err != nil {
+		return nil, err
+	}
+	v := vc.Verifier{Resolver: resolver, Leeway: time.Minute}
+	return v.VerifyCredential(context.Background(), []byte(args[0]), time.Now())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/bundle"
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+func bundleCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	e.register(flags)
+	keyRef := flags.String("key", "", "keystore `reference` of the signing key")
+	kid := flags.String("kid", "", "verification method `id` of the key, a DID URL")
+	expiry := flags.Duration("exp", 0, "expire the bundle after `duration`, when positive")
+	out := flags.String("o", "-", "write the bundle to `file`, with \"-\" for the standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain bundle -key ref -kid did-url [options] did ...\n\nThe DIDs resolve into a signed bundle, for resolution with the -bundle\noption of other commands, without network access. DIDs of did:idchain\ninclude their operation log as proof. Use a did:key or a did:peer for -kid,\nas offline verification can not resolve other methods.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 || *keyRef == "" || *kid == "" {
+		flags.Usage()
+		return 2
+	}
+	keyID, err := backend.ParseURL(*kid)
+	if err != nil || keyID.IsRelative() || keyID.Fragment() == "" {
+		fmt.Fprintf(os.Stderr, "idchain: -kid %q is not an absolute DID URL with fragment\n", *kid)
+		return 2
+	}
+	dids := make([]backend.DID, flags.NArg())
+	for i, s := range flags.Args() {
+		dids[i], err = backend.Parse(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "idchain:", err)
+			return 2
+		}
+	}
+
+	ks, err := e.keyStore()
+	if err != nil {
+		return fail(err)
+	}
+	signer, err := ks.Signer(*keyRef)
+	if err != nil {
+		return fail(err)
+	}
+	r, err := e.resolverFor()
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := e.context()
+	defer cancel()
+	var b bundle.Bundle
+	node := e.nodeClient()
+	for _, did := range dids {
+		var proofs []json.RawMessage
+		if did.Method == idchain.Method && e.bundle == "" {
+			entries, err := node.OperationLog(ctx, did)
+			if err != nil {
+				return fail(fmt.Errorf("operation log of %s: %w", did.String(), err))
+			}
+			for _, entry := range entries {
+				proof, err := json.Marshal(entry)
+				if err != nil {
+					return fail(err)
+				}
+				proofs = append(proofs, proof)
+			}
+		}
+		if err := b.Add(ctx, r, did, proofs...); err != nil {
+			return fail(err)
+		}
+	}
+	if *expiry > 0 {
+		b.Expires = time.Now().Add(*expiry)
+	}
+	token, err := b.Sign(keyID, signer)
+	if err != nil {
+		return fail(err)
+	}
+
+	if *out == "-" {
+		_, err = fmt.Println(token)
+	} else {
+		err = os.WriteFile(*out, []byte(token+"\n"), 0o644)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
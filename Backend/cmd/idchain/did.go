@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/dereference"
+	"EncrypteDL/IDChain/Backend/jsonpatch"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/registrar"
+)
+
+func createCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	e.register(flags)
+	method := flags.String("method", "key", "DID `method`, either \"key\", \"web\" or \"idchain\"")
+	keyType := flags.String("keytype", string(keystore.Ed25519), "key `type` to generate, either \"Ed25519\", \"P-256\" or \"P-384\"")
+	docFile := flags.String("document", "", "read the initial DID document from `file`")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain create [options] [did]\n\nThe DID argument applies to did:web only. The output is the registration\nresult, with the keystore references of any keys generated.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	req := new(registrar.CreateRequest)
+	if flags.NArg() == 1 {
+		did, err := backend.Parse(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "idchain:", err)
+			return 2
+		}
+		req.DID = &did
+	}
+	if *docFile != "" {
+		req.Document = new(backend.Document)
+		if err := readJSON(*docFile, req.Document); err != nil {
+			return fail(err)
+		}
+	}
+	r, err := e.registrar(*method, keystore.KeyType(*keyType))
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := e.context()
+	defer cancel()
+	result, err := r.Create(ctx, req)
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, result); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+func resolveCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("resolve", flag.ExitOnError)
+	e.register(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain resolve [options] did-or-did-url\n\nA DID gets the resolution result. A DID URL gets the dereferencing result.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	u, err := backend.ParseURL(flags.Arg(0))
+	if err != nil || u.IsRelative() {
+		fmt.Fprintf(os.Stderr, "idchain: %q is not a DID nor an absolute DID URL\n", flags.Arg(0))
+		return 2
+	}
+
+	ctx, cancel := e.context()
+	defer cancel()
+	resolver, err := e.resolverFor()
+	if err != nil {
+		return fail(err)
+	}
+	d := dereference.Dereferencer{Resolver: resolver}
+	r, err := d.Dereference(ctx, flags.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	if u.RawPath == "" && u.RawQuery == "" && u.RawFragment == "" {
+		err = writeJSON(os.Stdout, &backend.ResolutionResult{
+			Document:       r.Document,
+			DocumentMeta:   r.Meta,
+			ResolutionMeta: r.Resolution,
+		})
+	} else {
+		var content any = r.Document
+		switch {
+		case r.Endpoint != nil:
+			content = r.Endpoint.String()
+		case r.Method != nil:
+			content = r.Method
+		case r.Service != nil:
+			content = r.Service
+		case r.Resource != nil:
+			r.Resource.Close()
+			return fail(fmt.Errorf("DID URL path resources not supported"))
+		}
+		err = writeJSON(os.Stdout, map[string]any{
+			"dereferencingMetadata": r.Resolution,
+			"contentStream":         content,
+			"contentMetadata":       r.Meta,
+		})
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+func updateCmd(args []string) int {
+	var e env
+	refs := make(keyRefs)
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	e.register(flags)
+	flags.Var(refs, "key", "authorize with the keystore reference of a verification method, as `id=ref`; repeatable")
+	docFile := flags.String("document", "", "replace the DID document with the one in `file`")
+	patchFile := flags.String("patch", "", "apply the JSON Patch in `file` to the DID document")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain update [options] did\n\nEither -document or -patch is required.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*docFile == "") == (*patchFile == "") {
+		flags.Usage()
+		return 2
+	}
+	did, err := backend.Parse(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "idchain:", err)
+		return 2
+	}
+
+	req := &registrar.UpdateRequest{DID: did, Secret: refs.secret()}
+	if *docFile != "" {
+		req.Document = new(backend.Document)
+		err = readJSON(*docFile, req.Document)
+	} else {
+		req.Patch = make([]jsonpatch.Patch, 0)
+		err = readJSON(*patchFile, &req.Patch)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	r, err := e.registrar(did.Method, "")
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := e.context()
+	defer cancel()
+	result, err := r.Update(ctx, req)
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, result); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+func deactivateCmd(args []string) int {
+	var e env
+	refs := make(keyRefs)
+	flags := flag.NewFlagSet("deactivate", flag.ExitOnError)
+	e.register(flags)
+	flags.Var(refs, "key", "authorize with the keystore reference of a verification method, as `id=ref`; repeatable")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain deactivate [options] did\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	did, err := backend.Parse(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "idchain:", err)
+		return 2
+	}
+
+	r, err := e.registrar(did.Method, "")
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := e.context()
+	defer cancel()
+	result, err := r.Deactivate(ctx, &registrar.DeactivateRequest{DID: did, Secret: refs.secret()})
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, result); err != nil {
+		return fail(err)
+	}
+	return 0
+}
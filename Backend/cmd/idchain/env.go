@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/bundle"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/didweb"
+	"EncrypteDL/IDChain/Backend/example"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/nodeapi"
+	"EncrypteDL/IDChain/Backend/registrar"
+)
+
+// PassphraseEnv names the environment variable with the keystore passphrase.
+const passphraseEnv = "IDCHAIN_PASSPHRASE"
+
+// APIKeyEnv names the environment variable with the API key of the node, if
+// any, for nodes with access control.
+const apiKeyEnv = "IDCHAIN_API_KEY"
+
+// Env has the settings shared by commands.
+type env struct {
+	keys     string
+	node     string
+	webRoot  string
+	resolver string
+	bundle   string
+	timeout  time.Duration
+}
+
+// Register installs the flags of e on flags.
+func (e *env) register(flags *flag.FlagSet) {
+	home, _ := os.UserHomeDir()
+	flags.StringVar(&e.keys, "keys", filepath.Join(home, ".idchain", "keys"), "keystore `directory`, with the passphrase in $"+passphraseEnv)
+	flags.StringVar(&e.node, "node", "https://localhost:7443", "node API `URL` for did:idchain, with the API key, if any, in $"+apiKeyEnv)
+	flags.StringVar(&e.webRoot, "web-root", ".", "document root `directory` of the did:web domain")
+	flags.StringVar(&e.resolver, "resolver", "http://localhost:8080/1.0/identifiers/", "resolution `endpoint` for other methods, to append the DID to")
+	flags.StringVar(&e.bundle, "bundle", "", "resolve offline, from a signed bundle `file` only, as exported by a did:key or a did:peer")
+	flags.DurationVar(&e.timeout, "timeout", 30*time.Second, "limit on the operation `duration`")
+}
+
+func (e *env) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), e.timeout)
+}
+
+// NodeClient returns the client of the node API, with the API key from the
+// environment.
+func (e *env) nodeClient() *nodeapi.Client {
+	c := &nodeapi.Client{URL: e.node}
+	if key := os.Getenv(apiKeyEnv); key != "" {
+		c.Header = http.Header{authz.APIKeyHeader: {key}}
+	}
+	return c
+}
+
+// KeyStore returns the keystore with the passphrase from the environment.
+func (e *env) keyStore() (*keystore.Passphrase, error) {
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("keystore passphrase not set in $%s", passphraseEnv)
+	}
+	return &keystore.Passphrase{
+		Storage:    &keystore.DirStorage{Dir: e.keys},
+		Passphrase: []byte(passphrase),
+	}, nil
+}
+
+// Registrar returns the registrar of method.
+func (e *env) registrar(method string, keyType keystore.KeyType) (registrar.Registrar, error) {
+	ks, err := e.keyStore()
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case didkey.Method:
+		return &registrar.Key{Keys: ks, KeyType: keyType}, nil
+	case didweb.Method:
+		return &registrar.Web{Root: e.webRoot, Keys: ks, KeyType: keyType}, nil
+	case idchain.Method:
+		return &idchain.Registrar{Ledger: nodeLedger{e.nodeClient()}, Keys: ks, KeyType: keyType}, nil
+	}
+	return nil, fmt.Errorf("%w: no registration of %q", backend.ErrMethodNotSupported, method)
+}
+
+// Resolver returns resolution of the built-in methods, and of other methods
+// at the resolver endpoint, or of the bundle only when set.
+func (e *env) resolverFor() (backend.VersionResolver, error) {
+	if e.bundle != "" {
+		return e.offline()
+	}
+	r := &resolver{endpoint: e.resolver}
+	r.Register(didkey.Method, new(didkey.Resolver))
+	r.Register(didpeer.Method, new(didpeer.Resolver))
+	r.Register(didweb.Method, new(didweb.Resolver))
+	r.Register(idchain.Method, e.nodeClient())
+	return r, nil
+}
+
+// Offline returns the resolver of the bundle file. The exporter must be of a
+// DID method which resolves without network access.
+func (e *env) offline() (*bundle.Resolver, error) {
+	token, err := os.ReadFile(e.bundle)
+	if err != nil {
+		return nil, err
+	}
+	if len(token) > bundle.SizeMax {
+		return nil, fmt.Errorf("%s exceeds %d bytes", e.bundle, bundle.SizeMax)
+	}
+	trust := new(backend.MethodRegistry)
+	trust.Register(didkey.Method, new(didkey.Resolver))
+	trust.Register(didpeer.Method, new(didpeer.Resolver))
+	ctx, cancel := e.context()
+	defer cancel()
+	b, err := bundle.Open(ctx, strings.TrimSpace(string(token)), trust)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.bundle, err)
+	}
+	return b.Resolver(), nil
+}
+
+// Resolver is a backend.VersionResolver. Versions are available from the
+// built-in methods only.
+type resolver struct {
+	backend.MethodRegistry
+	endpoint string
+	client   example.Client
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *resolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, meta, err := r.MethodRegistry.Resolve(ctx, did)
+	if !errors.Is(err, backend.ErrMethodNotSupported) {
+		return doc, meta, err
+	}
+	return r.client.Resolve(ctx, strings.TrimSuffix(r.endpoint, "/")+"/"+url.PathEscape(did.String()))
+}
+
+// NodeLedger is an idchain.Ledger on the API of a node. The node checks the
+// position of appended entries with their link to the previous entry.
+type nodeLedger struct {
+	*nodeapi.Client
+}
+
+// Entries implements the idchain.Ledger interface.
+func (l nodeLedger) Entries(ctx context.Context, did backend.DID) ([]string, error) {
+	return l.OperationLog(ctx, did)
+}
+
+// Append implements the idchain.Ledger interface.
+func (l nodeLedger) Append(ctx context.Context, _ backend.DID, _ int, entry string) error {
+	_, err := l.SubmitOperation(ctx, entry)
+	return err
+}
+
+// KeyRefs is a repeatable flag with verification method IDs and their
+// keystore reference, as "id=ref".
+type keyRefs map[string]string
+
+// String implements the flag.Value interface.
+func (refs keyRefs) String() string {
+	var b strings.Builder
+	for id, ref := range refs {
+		if b.Len() != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(id + "=" + ref)
+	}
+	return b.String()
+}
+
+// Set implements the flag.Value interface.
+func (refs keyRefs) Set(s string) error {
+	id, ref, ok := strings.Cut(s, "=")
+	if !ok || id == "" || ref == "" {
+		return errors.New("want verification method ID = keystore reference")
+	}
+	refs[id] = ref
+	return nil
+}
+
+func (refs keyRefs) secret() *registrar.Secret {
+	if len(refs) == 0 {
+		return nil
+	}
+	return &registrar.Secret{KeyRefs: refs}
+}
+
+// WriteJSON prints v for scripting.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// Fail reports err on the standard error, and it returns the exit code.
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "idchain:", err)
+	return 1
+}
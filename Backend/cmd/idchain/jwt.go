@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+)
+
+// ClaimsMax is the size limit for input of sign and verify.
+const claimsMax = 1 << 20
+
+// ReadInput returns the content of file, with "-" for the standard input.
+func readInput(file string) ([]byte, error) {
+	r := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := io.ReadAll(io.LimitReader(r, claimsMax+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > claimsMax {
+		return nil, fmt.Errorf("%s exceeds %d bytes", file, claimsMax)
+	}
+	return b, nil
+}
+
+func signCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	e.register(flags)
+	keyRef := flags.String("key", "", "keystore `reference` of the signing key")
+	kid := flags.String("kid", "", "verification method `id` of the key, a DID URL")
+	typ := flags.String("typ", "JWT", "\"typ\" `header` of the token")
+	expiry := flags.Duration("exp", 0, "expire the token after `duration`, when positive")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain sign -key ref -kid did-url [options] [claims-file]\n\nThe claims are a JSON object, read from the standard input without file.\nThe issuer defaults to the DID of -kid, and the issue time to now.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 || *keyRef == "" || *kid == "" {
+		flags.Usage()
+		return 2
+	}
+	keyID, err := backend.ParseURL(*kid)
+	if err != nil || keyID.IsRelative() || keyID.Fragment() == "" {
+		fmt.Fprintf(os.Stderr, "idchain: -kid %q is not an absolute DID URL with fragment\n", *kid)
+		return 2
+	}
+	file := "-"
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+
+	raw, err := readInput(file)
+	if err != nil {
+		return fail(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return fail(fmt.Errorf("claims: %w", err))
+	}
+	if claims == nil {
+		return fail(fmt.Errorf("claims not a JSON object"))
+	}
+	now := time.Now()
+	if _, ok := claims["iss"]; !ok {
+		claims["iss"] = keyID.DID.String()
+	}
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if *expiry > 0 {
+		claims["exp"] = now.Add(*expiry).Unix()
+	}
+
+	ks, err := e.keyStore()
+	if err != nil {
+		return fail(err)
+	}
+	signer, err := ks.Signer(*keyRef)
+	if err != nil {
+		return fail(err)
+	}
+	token, err := didjwt.SignTyp(*typ, claims, keyID, signer)
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, map[string]string{"jwt": token}); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// VerifyResult is the output of verify.
+type verifyResult struct {
+	Verified bool           `json:"verified"`
+	Issuer   string         `json:"issuer,omitempty"`
+	Claims   map[string]any `json:"claims,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func verifyCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	e.register(flags)
+	relationship := flags.String("relationship", "assertionMethod", "verification `relationship` required of the key")
+	audience := flags.String("aud", "", "require the \"aud\" claim to match `audience`")
+	leeway := flags.Duration("leeway", time.Minute, "clock skew tolerance on time claims")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain verify [options] [token-file]\n\nThe token is read from the standard input without file. The exit code is\n1 when the token does not verify.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	file := "-"
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+	raw, err := readInput(file)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := e.context()
+	defer cancel()
+	r, err := e.resolverFor()
+	if err != nil {
+		return fail(err)
+	}
+	v := didjwt.Verifier{
+		Resolver:     r,
+		Relationship: *relationship,
+		Audience:     *audience,
+		Leeway:       *leeway,
+	}
+	var result verifyResult
+	issuer, err := v.Verify(ctx, strings.TrimSpace(string(raw)), time.Now(), &result.Claims)
+	if err != nil {
+		result.Error = err.Error()
+		result.Claims = nil
+	} else {
+		result.Verified = true
+		result.Issuer = issuer.String()
+	}
+	if err := writeJSON(os.Stdout, &result); err != nil {
+		return fail(err)
+	}
+	if !result.Verified {
+		return 1
+	}
+	return 0
+}
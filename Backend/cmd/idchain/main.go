@@ -0,0 +1,139 @@
+// Command idchain provides IDChain operations on the command line. The DID
+// lifecycle commands keep private keys in a passphrase-encrypted keystore, and
+// they print JSON for use in scripts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/compliance"
+	"EncrypteDL/IDChain/Backend/example"
+)
+
+// Subcommands by name.
+var commands = map[string]func(args []string) int{
+	"bundle":     bundleCmd,
+	"compliance": complianceCmd,
+	"create":     createCmd,
+	"resolve":    resolveCmd,
+	"update":     updateCmd,
+	"deactivate": deactivateCmd,
+	"sign":       signCmd,
+	"verify":     verifyCmd,
+	"vc":         vcCmd,
+	"vp":         vpCmd,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: idchain <command> [arguments]\n\ncommands:")
+	fmt.Fprintln(os.Stderr, "\tcreate\t\tregister a new DID, with keys in the keystore")
+	fmt.Fprintln(os.Stderr, "\tresolve\t\tresolve a DID, or dereference a DID URL")
+	fmt.Fprintln(os.Stderr, "\tupdate\t\treplace or patch the document of a DID")
+	fmt.Fprintln(os.Stderr, "\tdeactivate\tdeactivate a DID")
+	fmt.Fprintln(os.Stderr, "\tsign\t\tsign JWT claims with a key from the keystore")
+	fmt.Fprintln(os.Stderr, "\tverify\t\tverify a JWT against the DID document of its issuer")
+	fmt.Fprintln(os.Stderr, "\tvc\t\tissue, verify and check the status of credentials")
+	fmt.Fprintln(os.Stderr, "\tvp\t\tcreate presentations")
+	fmt.Fprintln(os.Stderr, "\tcompliance\tevaluate a DID against the DID Core and method rules")
+	fmt.Fprintln(os.Stderr, "\tbundle\t\texport DID documents for offline resolution")
+	fmt.Fprintln(os.Stderr, "\nOutput is JSON, except for compliance in text format, and for bundle. Run a\ncommand with -h for its options.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "idchain: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd(os.Args[2:]))
+}
+
+func complianceCmd(args []string) int {
+	flags := flag.NewFlagSet("compliance", flag.ExitOnError)
+	resolver := flags.String("resolver", "http://localhost:8080/1.0/identifiers/", "resolution `endpoint` to append the DID to")
+	docFile := flags.String("document", "", "read the DID document from `file` instead of resolution")
+	metaFile := flags.String("meta", "", "read the DID document metadata from `file`")
+	format := flags.String("format", "text", "report `format`, either \"text\" or \"json\"")
+	timeout := flags.Duration("timeout", 30*time.Second, "limit on the resolution `duration`")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain compliance [options] did\n\nThe exit code is 1 when not compliant.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		return 2
+	}
+	did, err := backend.Parse(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "idchain:", err)
+		return 2
+	}
+
+	in := &compliance.Input{DID: did}
+	if *docFile != "" {
+		in.Document = new(backend.Document)
+		if err := readJSON(*docFile, in.Document); err != nil {
+			fmt.Fprintln(os.Stderr, "idchain:", err)
+			return 2
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		var c example.Client
+		in.Document, in.Meta, err = c.Resolve(ctx, strings.TrimSuffix(*resolver, "/")+"/"+did.String())
+		// not found is a finding
+		if err != nil && !errors.Is(err, backend.ErrNotFound) {
+			fmt.Fprintln(os.Stderr, "idchain:", err)
+			return 2
+		}
+	}
+	if *metaFile != "" {
+		in.Meta = new(backend.Meta)
+		if err := readJSON(*metaFile, in.Meta); err != nil {
+			fmt.Fprintln(os.Stderr, "idchain:", err)
+			return 2
+		}
+	}
+
+	report := compliance.Evaluate(in)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "idchain:", err)
+		return 2
+	}
+	if !report.Compliant() {
+		return 1
+	}
+	return 0
+}
+
+func readJSON(file string, v any) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
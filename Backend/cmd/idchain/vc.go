@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didconfig"
+	"EncrypteDL/IDChain/Backend/jsonld"
+	"EncrypteDL/IDChain/Backend/trust"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Credential subcommands by name
+var vcCommands = map[string]func(args []string) int{
+	"issue":  vcIssueCmd,
+	"verify": vcVerifyCmd,
+	"status": vcStatusCmd,
+	"link":   vcLinkCmd,
+}
+
+// Presentation subcommands by name
+var vpCommands = map[string]func(args []string) int{
+	"create": vpCreateCmd,
+}
+
+func vcCmd(args []string) int {
+	return group("vc", vcCommands, args, []string{
+		"issue\tsign a credential with a key from the keystore",
+		"verify\tverify a credential against the DID document of its issuer",
+		"status\tcheck the revocation or suspension of a credential",
+		"link\tlink a DID to a web origin with a DID configuration",
+	})
+}
+
+func vpCmd(args []string) int {
+	return group("vp", vpCommands, args, []string{
+		"create\tpresent credentials with a key from the keystore",
+	})
+}
+
+// Group dispatches args on the subcommand name.
+func group(name string, commands map[string]func([]string) int, args, help []string) int {
+	if len(args) != 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+		fmt.Fprintf(os.Stderr, "idchain: unknown %s command %q\n", name, args[0])
+	}
+	fmt.Fprintf(os.Stderr, "usage: idchain %s <command> [arguments]\n\ncommands:\n", name)
+	for _, line := range help {
+		fmt.Fprintln(os.Stderr, "\t"+line)
+	}
+	return 2
+}
+
+// Secured is the output of issue and create, with either a compact JWT or a
+// JSON object with an embedded proof.
+type secured struct {
+	Format       vc.Format       `json:"format"`
+	Credential   json.RawMessage `json:"credential,omitempty"`
+	Presentation json.RawMessage `json:"presentation,omitempty"`
+}
+
+func newSecured(format vc.Format, b []byte, presentation bool) *secured {
+	raw := json.RawMessage(b)
+	if format == vc.JWT {
+		raw, _ = json.Marshal(string(b))
+	}
+	s := &secured{Format: format}
+	if presentation {
+		s.Presentation = raw
+	} else {
+		s.Credential = raw
+	}
+	return s
+}
+
+// ReadSecured returns the secured credential or presentation in file, which is
+// either a compact JWT, a JSON object with a proof, or the output of issue and
+// create.
+func readSecured(file string) ([]byte, error) {
+	b, err := readInput(file)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		return b, nil
+	}
+	var s secured
+	if json.Unmarshal(b, &s) == nil && s.Format != "" {
+		raw := s.Credential
+		if raw == nil {
+			raw = s.Presentation
+		}
+		if s.Format == vc.JWT {
+			var token string
+			if err := json.Unmarshal(raw, &token); err != nil {
+				return nil, fmt.Errorf("%s: JWT not a string: %w", file, err)
+			}
+			return []byte(token), nil
+		}
+		return raw, nil
+	}
+	return b, nil
+}
+
+// SignerFlags are the options for keys from the keystore.
+type signerFlags struct {
+	keyRef string
+	kid    string
+	format string
+}
+
+func (f *signerFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.keyRef, "key", "", "keystore `reference` of the signing key")
+	flags.StringVar(&f.kid, "kid", "", "verification method `id` of the key, a DID URL")
+	flags.StringVar(&f.format, "format", string(vc.JWT), "securing `format`, either \"jwt\" or \"data-integrity\"")
+}
+
+// Parse returns the verification method, or it prints why not.
+func (f *signerFlags) parse() (*backend.URL, bool) {
+	if f.keyRef == "" || f.kid == "" {
+		return nil, false
+	}
+	if vc.Format(f.format) != vc.JWT && vc.Format(f.format) != vc.DataIntegrity {
+		fmt.Fprintf(os.Stderr, "idchain: format %q not supported\n", f.format)
+		return nil, false
+	}
+	keyID, err := backend.ParseURL(f.kid)
+	if err != nil || keyID.IsRelative() || keyID.Fragment() == "" {
+		fmt.Fprintf(os.Stderr, "idchain: -kid %q is not an absolute DID URL with fragment\n", f.kid)
+		return nil, false
+	}
+	return keyID, true
+}
+
+func vcIssueCmd(args []string) int {
+	var e env
+	var s signerFlags
+	flags := flag.NewFlagSet("vc issue", flag.ExitOnError)
+	e.register(flags)
+	s.register(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain vc issue -key ref -kid did-url [options] [credential-file]\n\nThe credential is read from the standard input without file. The issuer\ndefaults to the DID of -kid, and the validity starts now when absent.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	keyID, ok := s.parse()
+	if !ok || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	file := "-"
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+
+	raw, err := readInput(file)
+	if err != nil {
+		return fail(err)
+	}
+	c := new(vc.Credential)
+	if err := json.Unmarshal(raw, c); err != nil {
+		return fail(fmt.Errorf("credential: %w", err))
+	}
+	if c.Issuer.ID == "" {
+		c.Issuer.ID = keyID.DID.String()
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	switch {
+	case c.V2() && c.ValidFrom == nil:
+		c.ValidFrom = &now
+	case !c.V2() && c.IssuanceDate == nil:
+		c.IssuanceDate = &now
+	}
+
+	ks, err := e.keyStore()
+	if err != nil {
+		return fail(err)
+	}
+	signer, err := ks.Signer(s.keyRef)
+	if err != nil {
+		return fail(err)
+	}
+	b, err := vc.Issue(c, signer, keyID, vc.Format(s.format))
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, newSecured(vc.Format(s.format), b, false)); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+func vcLinkCmd(args []string) int {
+	var e env
+	var s signerFlags
+	flags := flag.NewFlagSet("vc link", flag.ExitOnError)
+	e.register(flags)
+	s.register(flags)
+	origin := flags.String("origin", "", "web `origin` to link, e.g., \"https://example.com\"")
+	validity := flags.Duration("validity", 365*24*time.Hour, "validity period of the domain linkage credential")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain vc link -key ref -kid did-url -origin url [options] [configuration-file]\n\nThe output is a DID configuration resource, for the origin to serve as\n"+didconfig.Path+". The domain linkage credential is added to the\nconfiguration file, if any.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	keyID, ok := s.parse()
+	if !ok || *origin == "" || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	conf := didconfig.New()
+	if flags.NArg() == 1 {
+		raw, err := readInput(flags.Arg(0))
+		if err != nil {
+			return fail(err)
+		}
+		if err := json.Unmarshal(raw, conf); err != nil {
+			return fail(fmt.Errorf("DID configuration: %w", err))
+		}
+	}
+	now := time.Now()
+	c, err := didconfig.NewCredential(keyID.DID, *origin, now, now.Add(*validity))
+	if err != nil {
+		return fail(err)
+	}
+	ks, err := e.keyStore()
+	if err != nil {
+		return fail(err)
+	}
+	signer, err := ks.Signer(s.keyRef)
+	if err != nil {
+		return fail(err)
+	}
+	b, err := vc.Issue(c, signer, keyID, vc.Format(s.format))
+	if err != nil {
+		return fail(err)
+	}
+	if err := conf.Add(b); err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, conf); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+func vcVerifyCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("vc verify", flag.ExitOnError)
+	e.register(flags)
+	status := flags.Bool("status", false, "check the credential status too")
+	leeway := flags.Duration("leeway", time.Minute, "clock skew tolerance on validity periods")
+	contexts := make(contextFiles)
+	flags.Var(contexts, "context", "JSON-LD context for rdfc cryptosuites as `url=file`, repeatable")
+	trustFile := flags.String("trust", "", "require an issuer trusted by the trust list in `file`")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain vc verify [options] [credential-file]\n\nThe credential is read from the standard input without file. The exit\ncode is 1 when the credential does not verify.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	file := "-"
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+	b, err := readSecured(file)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := e.context()
+	defer cancel()
+	r, err := e.resolverFor()
+	if err != nil {
+		return fail(err)
+	}
+	v := vc.Verifier{Resolver: r, Leeway: *leeway}
+	if len(contexts) != 0 {
+		v.Contexts = jsonld.Contexts(contexts)
+	}
+	if *status {
+		v.Status = new(vc.StatusLists)
+	}
+	if *trustFile != "" {
+		f, err := os.Open(*trustFile)
+		if err != nil {
+			return fail(err)
+		}
+		list, err := trust.LoadList(f)
+		f.Close()
+		if err != nil {
+			return fail(err)
+		}
+		// accreditations get the checks of the credential, except for trust
+		registry := &trust.Registry{
+			Verifier: &vc.Verifier{Resolver: r, Leeway: v.Leeway, Status: v.Status, Contexts: v.Contexts},
+			DNS:      net.DefaultResolver,
+		}
+		if err := registry.Load(ctx, list); err != nil {
+			return fail(err)
+		}
+		v.Policy = registry.Policy()
+	}
+	var result struct {
+		Verified   bool           `json:"verified"`
+		Credential *vc.Credential `json:"credential,omitempty"`
+		Error      string         `json:"error,omitempty"`
+	}
+	result.Credential, err = v.VerifyCredential(ctx, b, time.Now())
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Verified = true
+	}
+	if err := writeJSON(os.Stdout, &result); err != nil {
+		return fail(err)
+	}
+	if !result.Verified {
+		return 1
+	}
+	return 0
+}
+
+// ContextFiles is a repeatable flag with JSON-LD contexts by URL, as
+// "url=file". Files are read on Set.
+type contextFiles jsonld.Contexts
+
+// String implements the flag.Value interface.
+func (files contextFiles) String() string {
+	urls := make([]string, 0, len(files))
+	for url := range files {
+		urls = append(urls, url)
+	}
+	return strings.Join(urls, ",")
+}
+
+// Set implements the flag.Value interface.
+func (files contextFiles) Set(s string) error {
+	url, file, ok := strings.Cut(s, "=")
+	if !ok || url == "" || file == "" {
+		return errors.New("want context URL = file")
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	files[url] = b
+	return nil
+}
+
+func vcStatusCmd(args []string) int {
+	var e env
+	flags := flag.NewFlagSet("vc status", flag.ExitOnError)
+	e.register(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain vc status [options] [credential-file]\n\nThe credential is read from the standard input without file. The status is\none of \"valid\", \"revoked\" or \"suspended\", with exit code 1 for the latter\ntwo. Credentials without status are valid.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	file := "-"
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+	b, err := readSecured(file)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := e.context()
+	defer cancel()
+	r, err := e.resolverFor()
+	if err != nil {
+		return fail(err)
+	}
+	v := vc.Verifier{Resolver: r, Leeway: time.Minute}
+	now := time.Now()
+	c, err := v.VerifyCredential(ctx, b, now)
+	if err != nil {
+		return fail(err)
+	}
+	var result struct {
+		Status string      `json:"status"`
+		Entry  vc.Statuses `json:"credentialStatus,omitempty"`
+	}
+	result.Entry = c.Status
+	err = new(vc.StatusLists).Check(ctx, &v, c, now)
+	switch {
+	case err == nil:
+		result.Status = "valid"
+	case errors.Is(err, vc.ErrRevoked):
+		result.Status = "revoked"
+	case errors.Is(err, vc.ErrSuspended):
+		result.Status = "suspended"
+	default:
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, &result); err != nil {
+		return fail(err)
+	}
+	if result.Status != "valid" {
+		return 1
+	}
+	return 0
+}
+
+func vpCreateCmd(args []string) int {
+	var e env
+	var s signerFlags
+	flags := flag.NewFlagSet("vp create", flag.ExitOnError)
+	e.register(flags)
+	s.register(flags)
+	challenge := flags.String("challenge", "", "`nonce` of the verifier")
+	domain := flags.String("domain", "", "`domain` of the verifier, as the audience")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchain vp create -key ref -kid did-url [options] credential-file ...\n\nThe holder is the DID of -kid, which must be an authentication method.\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	keyID, ok := s.parse()
+	if !ok {
+		flags.Usage()
+		return 2
+	}
+
+	p := vc.NewPresentation(keyID.DID)
+	for _, file := range flags.Args() {
+		b, err := readSecured(file)
+		if err != nil {
+			return fail(err)
+		}
+		if err := p.Add(b); err != nil {
+			return fail(fmt.Errorf("%s: %w", file, err))
+		}
+	}
+	ks, err := e.keyStore()
+	if err != nil {
+		return fail(err)
+	}
+	signer, err := ks.Signer(s.keyRef)
+	if err != nil {
+		return fail(err)
+	}
+	b, err := vc.Present(p, signer, keyID, *challenge, *domain, vc.Format(s.format))
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeJSON(os.Stdout, newSecured(vc.Format(s.format), b, true)); err != nil {
+		return fail(err)
+	}
+	return 0
+}
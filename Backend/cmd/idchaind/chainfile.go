@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"EncrypteDL/IDChain/Backend/chain"
+)
+
+// ChainFile persists a Blockchain as JSON lines, with one block per line.
+// New blocks are appended. A reorganization rewrites the file atomically with
+// a rename.
+type chainFile struct {
+	path string
+
+	len  uint64     // blocks in the file
+	head chain.Hash // hash of the last block in the file
+}
+
+// Load adds the blocks in the file to c, which must be empty.
+func (f *chainFile) load(ctx context.Context, c *chain.Blockchain) error {
+	file, err := os.Open(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		b := new(chain.Block)
+		if err := json.Unmarshal(scanner.Bytes(), b); err != nil {
+			return fmt.Errorf("%s: block %d: %w", f.path, f.len, err)
+		}
+		if err := c.AddBlock(ctx, b); err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		f.len, f.head = b.Height+1, b.Hash()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Save writes the blocks of c which are not in the file yet.
+func (f *chainFile) save(c *chain.Blockchain) error {
+	n := c.Len()
+	if n == f.len {
+		if n == 0 || c.Head().Hash() == f.head {
+			return nil
+		}
+	}
+	from := f.len
+	if from != 0 {
+		if b, err := c.Block(from - 1); err != nil || b.Hash() != f.head {
+			from = 0 // reorganized
+		}
+	}
+
+	var buf []byte
+	var head chain.Hash
+	for h := from; h < n; h++ {
+		b, err := c.Block(h)
+		if err != nil {
+			return err
+		}
+		line, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+		head = b.Hash()
+	}
+
+	if from == 0 {
+		tmp, err := os.CreateTemp(filepath.Dir(f.path), ".tmp-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(buf)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), f.path)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(buf)
+		if err == nil {
+			err = file.Sync()
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	f.len, f.head = n, head
+	return nil
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/didpkh"
+	"EncrypteDL/IDChain/Backend/didweb"
+	"EncrypteDL/IDChain/Backend/httpserver"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/p2p"
+)
+
+// Config is the content of the configuration file, in TOML, or in JSON with
+// a ".json" name extension. Unknown keys are an error.
+type config struct {
+	// Storage is the data directory, with the blocks and the keystore.
+	Storage string `json:"storage"`
+
+	// Methods are the DID methods to resolve, with all of the built-in
+	// ones by default.
+	Methods []string `json:"methods"`
+
+	// Validators are the DIDs of the proof-of-authority, in order of turn.
+	Validators []string `json:"validators"`
+
+	BlockInterval httpserver.Duration `json:"blockInterval"` // proposal period, default 5 s
+	SyncInterval  httpserver.Duration `json:"syncInterval"`  // pull period per peer, default 30 s
+
+	Listen struct {
+		HTTP string `json:"http"` // resolution API, empty disables
+		GRPC string `json:"grpc"` // node API, empty disables
+		P2P  string `json:"p2p"`  // peer network, empty disables
+
+		Metrics string `json:"metrics"` // Prometheus exposition, empty disables
+	} `json:"listen"`
+
+	// TLS is the certificate of the node API, as gRPC requires HTTP/2.
+	TLS struct {
+		Cert string `json:"cert"` // PEM file
+		Key  string `json:"key"`  // PEM file
+	} `json:"tls"`
+
+	// Key is the node key in the keystore of Storage, with the passphrase
+	// in $IDCHAIN_PASSPHRASE. Validators seal blocks with the key, and the
+	// peer network authenticates the node with it. The key must be both
+	// an assertion and an authentication method.
+	Key struct {
+		ID  string `json:"id"`  // verification method, a DID URL
+		Ref string `json:"ref"` // keystore reference
+	} `json:"key"`
+
+	// Web has the security options of did:web resolution, as documented
+	// with example.Client.
+	Web struct {
+		RedirectMax   int                 `json:"redirectMax"`
+		BlockPrivate  bool                `json:"blockPrivate"`
+		AllowPrefixes []netip.Prefix      `json:"allowPrefixes"`
+		Pins          map[string][]string `json:"pins"` // base64 SHA-256 by host
+		DNSOverHTTPS  string              `json:"dnsOverHTTPS"`
+		RequireDNSSEC bool                `json:"requireDNSSEC"`
+	} `json:"web"`
+
+	// P2P is the security of the peer network, with "noise" by default.
+	// The "tls" transport does mutual TLS with the certificate files, and
+	// it reloads them once the certificate file changes, for rotation.
+	// Without a CA, peers need a self-signed certificate bound to an
+	// authentication method of their DID, as with p2p.NewDIDCertificate.
+	P2P struct {
+		Transport string `json:"transport"` // "noise" or "tls"
+		Cert      string `json:"cert"`      // PEM file
+		Key       string `json:"key"`       // PEM file
+		CA        string `json:"ca"`        // PEM file of peer authorities
+	} `json:"p2p"`
+
+	Discovery p2p.DiscoveryConfig `json:"discovery"`
+	Gateway   httpserver.Gateway  `json:"gateway"`
+
+	// Auth, when set, enforces access control on the resolution API, the
+	// node API and the metrics. The rules default to authz.DefaultPolicy.
+	// DID Auth tokens must have the audience.
+	Auth *struct {
+		authz.Config
+		Audience string `json:"audience"`
+	} `json:"auth"`
+}
+
+// BuiltinMethods are the DID methods available without configuration.
+var builtinMethods = []string{didkey.Method, didpeer.Method, didpkh.Method, didweb.Method, idchain.Method}
+
+// LoadConfig reads the file at path, and it applies defaults.
+func loadConfig(path string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".json" {
+		tables, err := parseTOML(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		b, err = json.Marshal(tables)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	c := new(config)
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *config) validate() error {
+	if c.Storage == "" {
+		return errors.New("storage directory not set")
+	}
+	if c.Methods == nil {
+		c.Methods = builtinMethods
+	}
+	for _, m := range c.Methods {
+		if !contains(builtinMethods, m) {
+			return fmt.Errorf("%w: %q", backend.ErrMethodNotSupported, m)
+		}
+	}
+	if len(c.Validators) == 0 {
+		return errors.New("no validators")
+	}
+	if _, err := c.validators(); err != nil {
+		return err
+	}
+	if c.BlockInterval <= 0 {
+		c.BlockInterval = httpserver.Duration(5 * time.Second)
+	}
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = httpserver.Duration(30 * time.Second)
+	}
+	if c.Listen.GRPC != "" && (c.TLS.Cert == "" || c.TLS.Key == "") {
+		return errors.New("node API requires a TLS certificate and key")
+	}
+	if (c.Key.ID == "") != (c.Key.Ref == "") {
+		return errors.New("node key needs both an ID and a keystore reference")
+	}
+	if c.Listen.P2P != "" || len(c.Discovery.Bootstrap) != 0 {
+		if c.Key.ID == "" {
+			return errors.New("peer network requires a node key")
+		}
+	}
+	switch c.P2P.Transport {
+	case "":
+		c.P2P.Transport = "noise"
+	case "noise":
+		break
+	case "tls":
+		if c.P2P.Cert == "" || c.P2P.Key == "" {
+			return errors.New("peer network TLS requires a certificate and key")
+		}
+	default:
+		return fmt.Errorf("peer network transport %q unknown", c.P2P.Transport)
+	}
+	if c.Web.RequireDNSSEC && c.Web.DNSOverHTTPS == "" {
+		return errors.New("web DNSSEC requires a DNS-over-HTTPS service")
+	}
+	if c.Key.ID != "" {
+		if _, err := c.keyID(); err != nil {
+			return err
+		}
+	}
+	if c.Auth != nil {
+		c.Auth.ApplyDefaults()
+		if _, err := authz.NewAPIKeys(c.Auth.APIKeys); err != nil {
+			return err
+		}
+		if len(c.Auth.DIDs) != 0 && c.Auth.Audience == "" {
+			return errors.New("DID Auth requires an audience")
+		}
+		for s := range c.Auth.DIDs {
+			if _, err := backend.Parse(s); err != nil {
+				return fmt.Errorf("auth: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Authenticators returns the authentication conform the Auth settings, with
+// DID Auth separate for the block stream of the node API.
+func (c *config) authenticators(resolver backend.Resolver) (authz.Authenticator, *authz.DIDAuth, error) {
+	apiKeys, err := authz.NewAPIKeys(c.Auth.APIKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	didAuth := &authz.DIDAuth{Resolver: resolver, Audience: c.Auth.Audience, Roles: c.Auth.DIDs}
+	return authz.Authenticators{apiKeys, didAuth}, didAuth, nil
+}
+
+func (c *config) validators() ([]backend.DID, error) {
+	dids := make([]backend.DID, len(c.Validators))
+	for i, s := range c.Validators {
+		var err error
+		dids[i], err = backend.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("validator № %d: %w", i+1, err)
+		}
+	}
+	return dids, nil
+}
+
+func (c *config) keyID() (*backend.URL, error) {
+	u, err := backend.ParseURL(c.Key.ID)
+	if err != nil {
+		return nil, fmt.Errorf("node key: %w", err)
+	}
+	if u.IsRelative() || u.Fragment() == "" {
+		return nil, fmt.Errorf("node key %q is not an absolute DID URL with fragment", c.Key.ID)
+	}
+	return u, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTOML returns the tables of a TOML document, with string, int64,
+// float64, bool, []any and map[string]any values. Multi-line strings,
+// date-times and arrays of tables are not supported.
+func parseTOML(src []byte) (map[string]any, error) {
+	p := &tomlParser{src: string(src)}
+	root := make(map[string]any)
+	table := root
+	defined := make(map[string]bool) // table headers by path
+	for {
+		p.skip(true)
+		if p.pos >= len(p.src) {
+			return root, nil
+		}
+		if p.src[p.pos] == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("arrays of tables not supported")
+			}
+			path, err := p.key(']')
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			name := strings.Join(path, "\x00")
+			if defined[name] {
+				return nil, p.errorf("table %q defined twice", strings.Join(path, "."))
+			}
+			defined[name] = true
+			if table, err = p.table(root, path); err != nil {
+				return nil, err
+			}
+		} else {
+			path, err := p.key('=')
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			p.skip(false)
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.set(table, path, v); err != nil {
+				return nil, err
+			}
+		}
+		p.skip(false)
+		switch {
+		case p.pos >= len(p.src):
+			return root, nil
+		case strings.HasPrefix(p.src[p.pos:], "\n"), strings.HasPrefix(p.src[p.pos:], "\r\n"):
+			continue
+		}
+		return nil, p.errorf("unexpected %q after value", p.src[p.pos])
+	}
+}
+
+type tomlParser struct {
+	src string
+	pos int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.src[:min(p.pos, len(p.src))], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// Skip passes spaces and comments, and line breaks when newlines.
+func (p *tomlParser) skip(newlines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// Key parses a dotted key up to the terminator, which is not consumed.
+func (p *tomlParser) key(term byte) ([]string, error) {
+	var path []string
+	for {
+		p.skip(false)
+		var part string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			part = s.(string)
+		default:
+			start := p.pos
+			for p.pos < len(p.src) && isBareKey(p.src[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("key expected")
+			}
+			part = p.src[start:p.pos]
+		}
+		path = append(path, part)
+		p.skip(false)
+		switch p.peek() {
+		case '.':
+			p.pos++
+		case term:
+			return path, nil
+		default:
+			return nil, p.errorf("%q expected after key %q", term, strings.Join(path, "."))
+		}
+	}
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// Table returns the table at path, which is created as needed.
+func (p *tomlParser) table(root map[string]any, path []string) (map[string]any, error) {
+	t := root
+	for i, name := range path {
+		switch v := t[name].(type) {
+		case nil:
+			sub := make(map[string]any)
+			t[name] = sub
+			t = sub
+		case map[string]any:
+			t = v
+		default:
+			return nil, p.errorf("key %q is not a table", strings.Join(path[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+func (p *tomlParser) set(t map[string]any, path []string, v any) error {
+	t, err := p.table(t, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	name := path[len(path)-1]
+	if _, ok := t[name]; ok {
+		return p.errorf("key %q defined twice", strings.Join(path, "."))
+	}
+	t[name] = v
+	return nil
+}
+
+func (p *tomlParser) value() (any, error) {
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return nil, p.errorf("multi-line strings not supported")
+		}
+		return p.basicString()
+	case '\'':
+		if strings.HasPrefix(p.src[p.pos:], "'''") {
+			return nil, p.errorf("multi-line strings not supported")
+		}
+		end := strings.IndexAny(p.src[p.pos+1:], "'\n")
+		if end < 0 || p.src[p.pos+1+end] != '\'' {
+			return nil, p.errorf("unterminated string")
+		}
+		s := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return s, nil
+	case '[':
+		p.pos++
+		list := make([]any, 0)
+		for {
+			p.skip(true)
+			if p.peek() == ']' {
+				p.pos++
+				return list, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			p.skip(true)
+			switch p.peek() {
+			case ',':
+				p.pos++
+			case ']':
+				p.pos++
+				return list, nil
+			default:
+				return nil, p.errorf("',' or ']' expected in array")
+			}
+		}
+	case '{':
+		p.pos++
+		t := make(map[string]any)
+		p.skip(false)
+		if p.peek() == '}' {
+			p.pos++
+			return t, nil
+		}
+		for {
+			path, err := p.key('=')
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			p.skip(false)
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.set(t, path, v); err != nil {
+				return nil, err
+			}
+			p.skip(false)
+			switch p.peek() {
+			case ',':
+				p.pos++
+			case '}':
+				p.pos++
+				return t, nil
+			default:
+				return nil, p.errorf("',' or '}' expected in inline table")
+			}
+		}
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && (isBareKey(p.src[p.pos]) || strings.IndexByte("+.:", p.src[p.pos]) >= 0) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	switch token {
+	case "":
+		return nil, p.errorf("value expected")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if strings.Contains(token, ":") || len(token) >= 10 && token[4] == '-' && token[7] == '-' {
+		return nil, p.errorf("date-time %q not supported", token)
+	}
+	digits := strings.TrimLeft(token, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return nil, p.errorf("number %q with leading zero", token)
+	}
+	if i, err := strconv.ParseInt(token, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(strings.ReplaceAll(token, "_", ""), 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("value %q not supported", token)
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch c := p.src[i]; c {
+		case '"':
+			p.pos = i + 1
+			return b.String(), nil
+		case '\n':
+			p.pos = i
+			return "", p.errorf("unterminated string")
+		case '\\':
+			i++
+			if i >= len(p.src) {
+				break
+			}
+			switch e := p.src[i]; e {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if i+n >= len(p.src) {
+					break
+				}
+				r, err := strconv.ParseUint(p.src[i+1:i+1+n], 16, 32)
+				if err != nil {
+					p.pos = i
+					return "", p.errorf("malformed Unicode escape")
+				}
+				b.WriteRune(rune(r))
+				i += n
+			default:
+				p.pos = i
+				return "", p.errorf("escape \\%c unknown", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	p.pos = len(p.src)
+	return "", p.errorf("unterminated string")
+}
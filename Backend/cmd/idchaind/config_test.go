@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"EncrypteDL/IDChain/Backend/authz"
+)
+
+func TestParseTOML(t *testing.T) {
+	const src = `# node
+storage = "/var/lib/idchaind" # trailing comment
+methods = [
+	"key",
+	'web', # literal
+]
+"quoted key" = "tab\there é"
+n = -1_000
+f = 2.5e3
+hex = 0x1F
+on = true
+
+[listen]
+http = ":8080"
+[a.b]
+c.d = {x = 1, y = [false]}
+`
+	got, err := parseTOML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"storage":    "/var/lib/idchaind",
+		"methods":    []any{"key", "web"},
+		"quoted key": "tab\there é",
+		"n":          int64(-1000),
+		"f":          2500.0,
+		"hex":        int64(31),
+		"on":         true,
+		"listen":     map[string]any{"http": ":8080"},
+		"a": map[string]any{"b": map[string]any{"c": map[string]any{"d": map[string]any{
+			"x": int64(1),
+			"y": []any{false},
+		}}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{"a = 1\na = 2", "line 2: key \"a\" defined twice"},
+		{"[t]\n[t]", "line 2: table \"t\" defined twice"},
+		{"a = 1\n[a]", "line 2: key \"a\" is not a table"},
+		{"a = \"open\nb = 1", "line 1: unterminated string"},
+		{"a = 1 2", "line 1: unexpected"},
+		{"a = 1979-05-27", "date-time"},
+		{"a = 007", "leading zero"},
+		{"[[t]]", "arrays of tables"},
+		{"a = \"\"\"x\"\"\"", "multi-line"},
+		{"= 1", "key expected"},
+	}
+	for _, test := range tests {
+		_, err := parseTOML([]byte(test.src))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q got error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestLoadConfigAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idchaind.toml")
+	const src = `storage = "/var/lib/idchaind"
+validators = ["did:web:validator.example"]
+
+[auth]
+audience = "https://node.example"
+apiKeys.ci = { sha256 = "4e738ca5563c06cfd0018299933d58db1dd8bf97f6973dc99bf6cdc64b5550bd", roles = ["registrar"] }
+dids."did:web:operator.example" = ["admin"]
+`
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Auth.Rules, authz.DefaultPolicy.Rules) {
+		t.Errorf("got rules %+v, want the default policy", c.Auth.Rules)
+	}
+	if got := c.Auth.DIDs["did:web:operator.example"]; !reflect.DeepEqual(got, []authz.Role{authz.Admin}) {
+		t.Errorf("got DID roles %q", got)
+	}
+	auth, didAuth, err := c.authenticators(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if didAuth.Audience != "https://node.example" {
+		t.Errorf("got DID Auth audience %q", didAuth.Audience)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/idchain.node.v1.Node/SubmitOperation", nil)
+	r.Header.Set(authz.APIKeyHeader, "s3cr3t")
+	p, err := auth.Authenticate(r)
+	if err != nil || p.ID != "ci" {
+		t.Fatalf("API key got principal %+v, error %v", p, err)
+	}
+	if err := c.Auth.Authorize(p, r.Method, r.URL.Path); err != nil {
+		t.Errorf("registrar submit got error %v", err)
+	}
+
+	bad := strings.Replace(src, `roles = ["registrar"]`, `roles = ["root"]`, 1)
+	if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "unknown role") {
+		t.Errorf("unknown role got error %v", err)
+	}
+}
+
+func TestConfigP2P(t *testing.T) {
+	tests := []struct {
+		transport, cert, key string
+		want                 string // error, if any
+	}{
+		{"", "", "", ""},
+		{"tls", "/etc/idchaind/peer.crt", "/etc/idchaind/peer.key", ""},
+		{"tls", "/etc/idchaind/peer.crt", "", "requires a certificate and key"},
+		{"quic", "", "", "unknown"},
+	}
+	for _, test := range tests {
+		c := &config{Storage: "/var/lib/idchaind", Validators: []string{"did:web:validator.example"}}
+		c.P2P.Transport, c.P2P.Cert, c.P2P.Key = test.transport, test.cert, test.key
+		err := c.validate()
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("transport %q got error %v", test.transport, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("transport %q got error %v, want %q", test.transport, err, test.want)
+		case err == nil && c.P2P.Transport == "":
+			t.Errorf("transport %q got no default", test.transport)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Command idchaind runs a full IDChain node. The node keeps the ledger in
+// sync with its peers, it proposes blocks in the turn of its validator key,
+// and it serves the DID resolution API and the node API for the idchain
+// command. SIGINT and SIGTERM shut the node down gracefully.
+//
+// The configuration file is TOML, e.g.,
+//
+//	storage = "/var/lib/idchaind"
+//	methods = ["key", "web", "idchain"]
+//	validators = ["did:key:z6Mk…", "did:web:validator.example"]
+//
+//	[listen]
+//	http = ":8080"
+//	grpc = ":7443"
+//	p2p = ":7474"
+//	metrics = ":9090"
+//
+//	[tls]
+//	cert = "/etc/idchaind/node.crt"
+//	key = "/etc/idchaind/node.key"
+//
+//	[key]
+//	id = "did:key:z6Mk…#z6Mk…"
+//	ref = "ed25519/4f2a…"
+//
+//	[discovery]
+//	bootstrap = ["node1.example:7474"]
+//
+//	[p2p]
+//	transport = "tls"
+//	cert = "/etc/idchaind/peer.crt"
+//	key = "/etc/idchaind/peer.key"
+//
+//	[auth]
+//	audience = "https://node.example"
+//	apiKeys.ci = { sha256 = "9f86…", roles = ["registrar"] }
+//	dids."did:key:z6Mk…" = ["admin"]
+//
+// The auth table enables access control on the APIs and the metrics, with
+// the rules of authz.DefaultPolicy, unless the table has its own rules, as
+// an array of inline tables.
+//
+// The keystore is in the "keys" directory of storage, with the passphrase in
+// $IDCHAIN_PASSPHRASE, as with the idchain command. The events of the ledger
+// for SubscribeEvents of the node API are in the "events.jsonl" file.
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/didpkh"
+	"EncrypteDL/IDChain/Backend/didweb"
+	"EncrypteDL/IDChain/Backend/events"
+	"EncrypteDL/IDChain/Backend/httpserver"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/metrics"
+	"EncrypteDL/IDChain/Backend/nodeapi"
+	"EncrypteDL/IDChain/Backend/p2p"
+)
+
+// PassphraseEnv names the environment variable with the keystore passphrase.
+const passphraseEnv = "IDCHAIN_PASSPHRASE"
+
+// ShutdownTimeout limits the wait on requests in progress.
+const shutdownTimeout = 10 * time.Second
+
+// EventRetention is the number of events available to replays.
+const eventRetention = 100_000
+
+func main() {
+	configFile := flag.String("config", "/etc/idchaind/idchaind.toml", "configuration `file`, TOML or JSON")
+	debug := flag.Bool("debug", false, "log debug messages")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: idchaind [options]\n\noptions:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	level := slog.LevelInfo
+	if *debug {
+		level = slog.LevelDebug
+	}
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(log)
+
+	c, err := loadConfig(*configFile)
+	if err != nil {
+		log.Error("configuration not loaded", "error", err)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, c, log); err != nil {
+		log.Error("node failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// Run starts the node conform c, and it stops once ctx is done.
+func run(ctx context.Context, c *config, log *slog.Logger) error {
+	if err := os.MkdirAll(c.Storage, 0o700); err != nil {
+		return err
+	}
+	validators, _ := c.validators()
+	registry := new(backend.MethodRegistry)
+	authority := &chain.Authority{Validators: validators, Resolver: registry}
+	bc := &chain.Blockchain{Consensus: authority}
+	for _, m := range c.Methods {
+		switch m {
+		case didkey.Method:
+			registry.Register(m, new(didkey.Resolver))
+		case didpeer.Method:
+			registry.Register(m, new(didpeer.Resolver))
+		case didpkh.Method:
+			registry.Register(m, new(didpkh.Resolver))
+		case didweb.Method:
+			web := new(didweb.Resolver)
+			web.RedirectMax = c.Web.RedirectMax
+			web.BlockPrivate = c.Web.BlockPrivate
+			web.AllowPrefixes = c.Web.AllowPrefixes
+			web.Pins = c.Web.Pins
+			web.DNSOverHTTPS = c.Web.DNSOverHTTPS
+			web.RequireDNSSEC = c.Web.RequireDNSSEC
+			registry.Register(m, web)
+		case idchain.Method:
+			registry.Register(m, &idchain.Resolver{Ledger: bc})
+		}
+	}
+	if c.Key.ID != "" {
+		keyID, _ := c.keyID()
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return fmt.Errorf("keystore passphrase not set in $%s", passphraseEnv)
+		}
+		ks := &keystore.Passphrase{
+			Storage:    &keystore.DirStorage{Dir: filepath.Join(c.Storage, "keys")},
+			Passphrase: []byte(passphrase),
+		}
+		signer, err := ks.Signer(c.Key.Ref)
+		if err != nil {
+			return fmt.Errorf("node key: %w", err)
+		}
+		authority.KeyID, authority.Signer = keyID, signer
+	}
+
+	file := &chainFile{path: filepath.Join(c.Storage, "chain.jsonl")}
+	if err := file.load(ctx, bc); err != nil {
+		return err
+	}
+	log.Info("ledger loaded", "blocks", bc.Len())
+	eventLog, err := events.OpenFileLog(filepath.Join(c.Storage, "events.jsonl"), eventRetention)
+	if err != nil {
+		return err
+	}
+	defer eventLog.Close()
+	broker := &events.Broker{Log: eventLog}
+	n := &node{
+		chain:         bc,
+		authority:     authority,
+		file:          file,
+		blockInterval: time.Duration(c.BlockInterval),
+		syncInterval:  time.Duration(c.SyncInterval),
+		log:           log,
+	}
+	// spans log with -debug, and failures at the info level
+	tracer := backend.Tracers{&backend.LogTracer{Log: log, Level: slog.LevelDebug}}
+	exposition := new(metrics.Registry)
+	var peers *metrics.Peers
+	if c.Listen.Metrics != "" {
+		resolution, err := metrics.NewResolution(exposition)
+		if err != nil {
+			return err
+		}
+		if err := metrics.NewNode(exposition, bc); err != nil {
+			return err
+		}
+		tracer = append(tracer, resolution)
+		if peers, err = metrics.NewPeers(exposition, validators); err != nil {
+			return err
+		}
+	}
+	if authority.KeyID != nil && (c.Listen.P2P != "" || len(c.Discovery.Bootstrap) != 0) {
+		var onHandshake p2p.HandshakeFunc
+		if peers != nil {
+			onHandshake = peers.Observer(c.P2P.Transport)
+		}
+		switch c.P2P.Transport {
+		case "tls":
+			t := &p2p.TLS{
+				Certificate: (&p2p.CertReloader{CertFile: c.P2P.Cert, KeyFile: c.P2P.Key}).Certificate,
+				Resolver:    registry,
+				Log:         log,
+				OnHandshake: onHandshake,
+			}
+			if _, err := t.Certificate(); err != nil {
+				return fmt.Errorf("peer network certificate: %w", err)
+			}
+			if c.P2P.CA != "" {
+				pem, err := os.ReadFile(c.P2P.CA)
+				if err != nil {
+					return fmt.Errorf("peer network CA: %w", err)
+				}
+				t.Roots = x509.NewCertPool()
+				if !t.Roots.AppendCertsFromPEM(pem) {
+					return fmt.Errorf("peer network CA: no certificates in %s", c.P2P.CA)
+				}
+			}
+			n.transport = t
+		default:
+			n.transport = &p2p.Noise{KeyID: *authority.KeyID, Signer: authority.Signer, Resolver: registry, Log: log, OnHandshake: onHandshake}
+		}
+		n.sync = &p2p.Sync{Chain: bc, Log: log}
+		n.gossip = &p2p.Gossip{Deliver: n.sync.Deliver, Log: log}
+	}
+
+	var policy *authz.Policy
+	var auth authz.Authenticator
+	var didAuth *authz.DIDAuth
+	if c.Auth != nil {
+		var err error
+		auth, didAuth, err = c.authenticators(registry)
+		if err != nil {
+			return err
+		}
+		policy = &c.Auth.Policy
+	}
+	// Protect applies the access control, if any, to h.
+	protect := func(h http.Handler) http.Handler {
+		if policy == nil {
+			return h
+		}
+		return policy.Handler(auth, log, h)
+	}
+
+	ctx, cancel := context.WithCancel(backend.WithTracer(ctx, tracer))
+	defer cancel()
+	var wg sync.WaitGroup
+	var servers []*http.Server
+	errs := make(chan error, 3)
+	// Listen returns the listener on addr, and it serves with srv.
+	listen := func(name, addr string, srv *http.Server, tls bool) error {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		servers = append(servers, srv)
+		log.Info(name+" listening", "addr", l.Addr().String())
+		go func() {
+			var err error
+			if tls {
+				err = srv.ServeTLS(l, c.TLS.Cert, c.TLS.Key)
+			} else {
+				err = srv.Serve(l)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("%s: %w", name, err)
+				cancel()
+			}
+		}()
+		return nil
+	}
+	if c.Listen.HTTP != "" {
+		mux := http.NewServeMux()
+		// concurrent requests for one DID share the upstream resolution
+		mux.Handle(httpserver.Path, &httpserver.Server{Resolver: &backend.CoalescingResolver{Resolver: registry}, Gateway: c.Gateway, Log: log, Tracer: tracer})
+		srv := &http.Server{Handler: protect(mux), ReadHeaderTimeout: 10 * time.Second, ErrorLog: slog.NewLogLogger(log.Handler(), slog.LevelWarn)}
+		if err := listen("resolution API", c.Listen.HTTP, srv, false); err != nil {
+			return err
+		}
+	}
+	if c.Listen.GRPC != "" {
+		api := &nodeapi.Server{Chain: bc, Submitted: n.submitted, Events: broker, Log: log, Tracer: tracer,
+			Policy: policy, Authenticator: auth, Auth: didAuth}
+		srv := &http.Server{Handler: api, ReadHeaderTimeout: 10 * time.Second, ErrorLog: slog.NewLogLogger(log.Handler(), slog.LevelWarn)}
+		if err := listen("node API", c.Listen.GRPC, srv, true); err != nil {
+			return err
+		}
+	}
+	if c.Listen.Metrics != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", exposition)
+		srv := &http.Server{Handler: protect(mux), ReadHeaderTimeout: 10 * time.Second, ErrorLog: slog.NewLogLogger(log.Handler(), slog.LevelWarn)}
+		if err := listen("metrics", c.Listen.Metrics, srv, false); err != nil {
+			return err
+		}
+	}
+	if n.transport != nil {
+		if c.Listen.P2P != "" {
+			l, err := net.Listen("tcp", c.Listen.P2P)
+			if err != nil {
+				return fmt.Errorf("peer network: %w", err)
+			}
+			log.Info("peer network listening", "addr", l.Addr().String())
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n.serve(ctx, l)
+			}()
+		}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			n.gossip.Run(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			self := p2p.PeerAddr{Addr: c.Listen.P2P, ID: authority.KeyID.String()}
+			book := new(p2p.PeerBook)
+			err := p2p.Discover(ctx, &c.Discovery, c.Discovery.Discoverers(self), book, func(p p2p.PeerAddr) {
+				log.Info("peer discovered", "addr", p.Addr, "source", p.Source)
+				go n.connect(ctx, p)
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Error("peer discovery failed", "error", err)
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n.produce(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		err := (&events.Ledger{Broker: broker, Chain: bc}).Run(ctx)
+		if ctx.Err() == nil {
+			log.Error("ledger events stopped", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("shutting down")
+	shutdown, done := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer done()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdown); err != nil {
+			log.Warn("server shutdown incomplete", "error", err)
+		}
+	}
+	wg.Wait()
+	err = file.save(bc)
+	select {
+	case serveErr := <-errs:
+		err = errors.Join(serveErr, err)
+	default:
+	}
+	return err
+}
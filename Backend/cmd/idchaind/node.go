@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/p2p"
+)
+
+// Protocols of peer connections, as the first byte after the handshake
+const (
+	protoGossip byte = 'g'
+	protoSync   byte = 's'
+)
+
+// HandshakeTimeout limits the setup of peer connections.
+const handshakeTimeout = 10 * time.Second
+
+// Node runs the consensus and the peer network of a Blockchain.
+type node struct {
+	chain     *chain.Blockchain
+	authority *chain.Authority
+	file      *chainFile
+
+	transport p2p.Transport // nil without peer network
+	gossip    *p2p.Gossip
+	sync      *p2p.Sync
+
+	blockInterval time.Duration
+	syncInterval  time.Duration
+	log           *slog.Logger
+}
+
+// Publish sends m to the peers, if any.
+func (n *node) publish(m *p2p.Message) {
+	if n.gossip != nil {
+		n.gossip.Publish(m)
+	}
+}
+
+// Produce proposes a block in each interval with the turn of the local
+// validator, and it persists the chain, until ctx is done.
+func (n *node) produce(ctx context.Context) {
+	ticker := time.NewTicker(n.blockInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n.propose(ctx)
+		n.finalize(ctx)
+		if err := n.file.save(n.chain); err != nil {
+			n.log.Error("chain persistence failed", "error", err)
+		}
+	}
+}
+
+// Propose adds a block with the pending transactions when the local
+// validator is in turn. The genesis block may be empty.
+func (n *node) propose(ctx context.Context) {
+	if n.authority.KeyID == nil {
+		return
+	}
+	head := n.chain.Head()
+	var height uint64
+	if head != nil {
+		height = head.Height + 1
+	}
+	if !n.authority.Proposer(height).Equal(n.authority.KeyID.DID) {
+		return
+	}
+	txs := n.chain.Pending()
+	if len(txs) == 0 && head != nil {
+		return
+	}
+	b, err := n.authority.ProposeBlock(ctx, head, txs)
+	if err == nil {
+		err = n.chain.AddBlock(ctx, b)
+	}
+	if err != nil {
+		n.log.Warn("block proposal failed", "height", height, "error", err)
+		return
+	}
+	m, err := p2p.BlockMessage(b)
+	if err != nil {
+		n.log.Error("block announcement failed", "height", height, "error", err)
+		return
+	}
+	n.publish(m)
+	n.log.Info("block proposed", "height", height, "transactions", len(txs))
+}
+
+// Finalize marks the blocks with a quorum of seals as final. The seals are
+// checked on a copy, as blocks on the chain are shared with readers. Seals of
+// other validators arrive with the blocks only, so finality beyond a single
+// validator needs blocks sealed before their announcement.
+func (n *node) finalize(ctx context.Context) {
+	for h := n.chain.Final(); h < n.chain.Len(); h++ {
+		b, err := n.chain.Block(h)
+		if err != nil {
+			return
+		}
+		c := *b
+		c.Seals = append([]string(nil), b.Seals...)
+		final, err := n.authority.Finalize(ctx, &c)
+		if err != nil || !final {
+			return
+		}
+		n.chain.Finalize(h)
+	}
+}
+
+// Serve accepts peer connections on l until ctx is done.
+func (n *node) serve(ctx context.Context, l net.Listener) {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	for {
+		raw, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				n.log.Error("peer listener failed", "error", err)
+			}
+			return
+		}
+		go n.accept(ctx, raw)
+	}
+}
+
+func (n *node) accept(ctx context.Context, raw net.Conn) {
+	handshake, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	conn, err := n.transport.Server(handshake, raw)
+	if err != nil {
+		raw.Close()
+		n.log.Debug("peer handshake failed", "remote", raw.RemoteAddr().String(), "error", err)
+		return
+	}
+	defer conn.Close()
+	proto := make([]byte, 1)
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	if _, err := conn.Read(proto); err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	switch proto[0] {
+	case protoGossip:
+		err = n.gossip.Join(ctx, conn)
+	case protoSync:
+		err = n.sync.Serve(ctx, conn)
+	default:
+		n.log.Warn("peer protocol unknown", "peer", conn.Peer(), "protocol", proto[0])
+		return
+	}
+	if err != nil {
+		n.log.Debug("peer connection failed", "peer", conn.Peer(), "error", err)
+	}
+}
+
+// Connect links with the peer at addr, with gossip and periodic block
+// downloads, until ctx is done.
+func (n *node) connect(ctx context.Context, peer p2p.PeerAddr) {
+	go n.link(ctx, peer.Addr, protoGossip, n.gossip.Join)
+	n.link(ctx, peer.Addr, protoSync, func(ctx context.Context, conn p2p.Conn) error {
+		ticker := time.NewTicker(n.syncInterval)
+		defer ticker.Stop()
+		for {
+			if err := n.sync.Pull(ctx, conn); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Link runs proto with the peer at addr, and it reconnects with exponential
+// backoff, until ctx is done.
+func (n *node) link(ctx context.Context, addr string, proto byte, run func(context.Context, p2p.Conn) error) {
+	backoff := time.Second
+	for {
+		conn, err := n.dial(ctx, addr, proto)
+		if err == nil {
+			backoff = time.Second
+			err = run(ctx, conn)
+			conn.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+		n.log.Warn("peer link failed", "addr", addr, "protocol", string(proto), "retry", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func (n *node) dial(ctx context.Context, addr string, proto byte) (p2p.Conn, error) {
+	handshake, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	var d net.Dialer
+	raw, err := d.DialContext(handshake, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := n.transport.Client(handshake, raw)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{proto}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Submitted publishes operations accepted by the node API.
+func (n *node) submitted(entry string, _ backend.DID) {
+	n.publish(p2p.OperationMessage(entry))
+}
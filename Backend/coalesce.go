@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// CoalescingResolver is a Resolver which merges concurrent resolutions of the
+// same DID into one upstream request, as with “singleflight”. Popular DIDs,
+// like those of credential issuers, thus cause no thundering herd. Put a
+// CachedResolver in front to retain the results. Documents are shared, and
+// thus read-only. Multiple goroutines may invoke methods on a
+// CoalescingResolver simultaneously.
+type CoalescingResolver struct {
+	Resolver Resolver
+
+	mutex   sync.Mutex
+	flights map[string]*flight // by canonical DID
+}
+
+// Flight is an upstream resolution in progress.
+type flight struct {
+	done chan struct{} // closed once the result is set
+	doc  *Document
+	meta *Meta
+	err  error
+
+	waiters int                // guarded by the mutex of the resolver
+	cancel  context.CancelFunc // stops upstream
+}
+
+// Resolve implements the Resolver interface. The upstream request runs with
+// the context values of the first caller, and it stops once all callers are
+// cancelled. Each caller returns on cancellation of its own context, with an
+// error which wraps the context error. Each resolution is a "did.coalesce"
+// span with the method, and with a "shared" attribute for requests joined.
+func (r *CoalescingResolver) Resolve(ctx context.Context, did DID) (doc *Document, meta *Meta, err error) {
+	ctx, span := StartSpan(ctx, "did.coalesce", slog.String("method", did.Method))
+	defer func() { span.End(err) }()
+	key := did.Canonical()
+
+	r.mutex.Lock()
+	f, shared := r.flights[key]
+	if !shared {
+		upstream, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		if r.flights == nil {
+			r.flights = make(map[string]*flight)
+		}
+		r.flights[key] = f
+		go r.fly(upstream, key, did, f)
+	}
+	f.waiters++
+	r.mutex.Unlock()
+	span.SetAttributes(slog.Bool("shared", shared))
+
+	select {
+	case <-f.done:
+		return f.doc, f.meta, f.err
+	case <-ctx.Done():
+		r.mutex.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if r.flights[key] == f {
+				delete(r.flights, key)
+			}
+		}
+		r.mutex.Unlock()
+		return nil, nil, fmt.Errorf("resolution of %s: %w", did.String(), ctx.Err())
+	}
+}
+
+// Fly resolves upstream, and it releases the waiters of f.
+func (r *CoalescingResolver) fly(ctx context.Context, key string, did DID, f *flight) {
+	defer f.cancel()
+	f.doc, f.meta, f.err = r.Resolver.Resolve(ctx, did)
+
+	r.mutex.Lock()
+	if r.flights[key] == f {
+		delete(r.flights, key)
+	}
+	r.mutex.Unlock()
+	close(f.done)
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// GateResolver blocks resolution until the gate closes, or until cancel.
+type gateResolver struct {
+	calls     atomic.Int32
+	cancelled atomic.Int32
+	gate      chan struct{}
+}
+
+func (r *gateResolver) Resolve(ctx context.Context, did DID) (*Document, *Meta, error) {
+	r.calls.Add(1)
+	select {
+	case <-r.gate:
+		return &Document{Subject: did}, new(Meta), nil
+	case <-ctx.Done():
+		r.cancelled.Add(1)
+		return nil, nil, ctx.Err()
+	}
+}
+
+func TestCoalescingResolver(t *testing.T) {
+	upstream := &gateResolver{gate: make(chan struct{})}
+	r := &CoalescingResolver{Resolver: upstream}
+	alice := DID{Method: "example", SpecID: "alice"}
+
+	const n = 20
+	docs := make([]*Document, n)
+	var wg sync.WaitGroup
+	for i := range docs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			docs[i], _, err = r.Resolve(context.Background(), alice)
+			if err != nil {
+				t.Error("resolve error:", err)
+			}
+		}()
+	}
+	// wait for all to join
+	for {
+		r.mutex.Lock()
+		f := r.flights[alice.Canonical()]
+		joined := f != nil && f.waiters == n
+		r.mutex.Unlock()
+		if joined {
+			break
+		}
+		runtime.Gosched()
+	}
+	close(upstream.gate)
+	wg.Wait()
+
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("got %d upstream resolutions, want 1", got)
+	}
+	for i, doc := range docs {
+		if doc != docs[0] {
+			t.Errorf("resolution № %d got another document", i+1)
+		}
+	}
+
+	// new flight after completion
+	if _, _, err := r.Resolve(context.Background(), alice); err != nil {
+		t.Fatal(err)
+	}
+	if got := upstream.calls.Load(); got != 2 {
+		t.Errorf("got %d upstream resolutions after completion, want 2", got)
+	}
+}
+
+func TestCoalescingResolverCancel(t *testing.T) {
+	upstream := &gateResolver{gate: make(chan struct{})}
+	r := &CoalescingResolver{Resolver: upstream}
+	bob := DID{Method: "example", SpecID: "bob"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := r.Resolve(ctx, bob); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got error %v, want context.Canceled", err)
+	}
+	// the only caller left, thus upstream stops
+	for upstream.cancelled.Load() == 0 {
+		runtime.Gosched()
+	}
+	r.mutex.Lock()
+	n := len(r.flights)
+	r.mutex.Unlock()
+	if n != 0 {
+		t.Errorf("got %d flights after cancel, want none", n)
+	}
+}
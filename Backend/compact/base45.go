@@ -0,0 +1,65 @@
+package compact
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Base45Alphabet fits the alphanumeric mode of QR codes.
+const base45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// EncodeBase45 returns the encoding conform RFC 9285.
+func EncodeBase45(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data)/2*3 + 2)
+	for len(data) >= 2 {
+		n := int(data[0])<<8 | int(data[1])
+		b.WriteByte(base45Alphabet[n%45])
+		b.WriteByte(base45Alphabet[n/45%45])
+		b.WriteByte(base45Alphabet[n/(45*45)])
+		data = data[2:]
+	}
+	if len(data) != 0 {
+		n := int(data[0])
+		b.WriteByte(base45Alphabet[n%45])
+		b.WriteByte(base45Alphabet[n/45])
+	}
+	return b.String()
+}
+
+// DecodeBase45 returns the decoding conform RFC 9285.
+func DecodeBase45(s string) ([]byte, error) {
+	if len(s)%3 == 1 {
+		return nil, fmt.Errorf("base45 length %d invalid", len(s))
+	}
+
+	buf := make([]byte, 0, len(s)/3*2+1)
+	for i := 0; i < len(s); i += 3 {
+		var n, weight int = 0, 1
+		end := i + 3
+		if end > len(s) {
+			end = len(s)
+		}
+		for j := i; j < end; j++ {
+			v := strings.IndexByte(base45Alphabet, s[j])
+			if v < 0 {
+				return nil, fmt.Errorf("illegal base45 character %q at byte № %d", s[j], j+1)
+			}
+			n += v * weight
+			weight *= 45
+		}
+
+		if end-i == 3 {
+			if n > 0xffff {
+				return nil, fmt.Errorf("base45 triplet %q at byte № %d out of range", s[i:end], i+1)
+			}
+			buf = append(buf, byte(n>>8), byte(n))
+		} else {
+			if n > 0xff {
+				return nil, fmt.Errorf("base45 pair %q at byte № %d out of range", s[i:end], i+1)
+			}
+			buf = append(buf, byte(n))
+		}
+	}
+	return buf, nil
+}
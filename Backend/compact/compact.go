@@ -0,0 +1,241 @@
+// Package compact provides minimal-size encodings of out-of-band messages,
+// such as invitations, credential offers and proof requests, for use in QR
+// codes and links.
+//
+// Encoded strings start with a short header. The header consists of "IDC",
+// followed by the Kind of payload, followed by the format digit, and then a
+// colon (':'). The header is compatible with the alphanumeric mode of QR codes.
+package compact
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"EncrypteDL/IDChain/Backend/cbor"
+)
+
+// Kind identifies the type of payload.
+type Kind byte
+
+// Payload kinds
+const (
+	Invitation      Kind = 'I' // out-of-band invitation
+	CredentialOffer Kind = 'O' // credential offer
+	ProofRequest    Kind = 'P' // presentation request
+)
+
+// String returns the name.
+func (k Kind) String() string {
+	switch k {
+	case Invitation:
+		return "invitation"
+	case CredentialOffer:
+		return "credential offer"
+	case ProofRequest:
+		return "proof request"
+	}
+	return fmt.Sprintf("kind %q", byte(k))
+}
+
+// Format identifies the encoding.
+type Format byte
+
+// Encoding formats
+const (
+	// CBOR with base45 suits the alphanumeric mode of QR codes.
+	CBORBase45 Format = '1'
+	// CBOR with zlib compression and base45 suits the alphanumeric mode
+	// of QR codes.
+	CBORZlibBase45 Format = '2'
+	// JSON with deflate compression and base64url suits URL parameters,
+	// and the byte mode of QR codes.
+	DeflateBase64URL Format = '3'
+)
+
+// ErrBudget signals a payload which does not fit the size constraints.
+var ErrBudget = errors.New("compact encoding exceeds size budget")
+
+// Report describes the size of an encoding.
+type Report struct {
+	Format    Format
+	JSONSize  int // bytes of the original JSON
+	Binary    int // bytes of the binary before text encoding
+	Chars     int // length of the encoded string, including the header
+	QRVersion int // smallest QR code fit at level M, or 0 for none
+}
+
+// Fits returns whether the encoding fits a QR code of maxVersion (1–40), with
+// error correction level M.
+func (r *Report) Fits(maxVersion int) bool {
+	return r.QRVersion != 0 && r.QRVersion <= maxVersion
+}
+
+// Encode returns the encoding of a JSON payload in the requested format. Format
+// CBORBase45 applies zlib compression only when it saves space, which results
+// in CBORZlibBase45.
+func Encode(kind Kind, payload json.RawMessage, format Format) (string, *Report, error) {
+	if !json.Valid(payload) {
+		return "", nil, errors.New("compact encoding of invalid JSON")
+	}
+	r := Report{Format: format, JSONSize: len(payload)}
+
+	var body string
+	switch format {
+	case CBORBase45, CBORZlibBase45:
+		bin, err := cbor.FromJSON(payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("compact encoding: %w", err)
+		}
+		var buf bytes.Buffer
+		w, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+		w.Write(bin)
+		w.Close()
+		if format == CBORZlibBase45 || buf.Len() < len(bin) {
+			r.Format = CBORZlibBase45
+			bin = buf.Bytes()
+		}
+		r.Binary = len(bin)
+		body = EncodeBase45(bin)
+
+	case DeflateBase64URL:
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(payload)
+		w.Close()
+		r.Binary = buf.Len()
+		body = base64.RawURLEncoding.EncodeToString(buf.Bytes())
+
+	default:
+		return "", nil, fmt.Errorf("compact format %q unknown", byte(format))
+	}
+
+	s := "IDC" + string(rune(kind)) + string(rune(r.Format)) + ":" + body
+	r.Chars = len(s)
+	if r.Format == DeflateBase64URL {
+		r.QRVersion = qrVersion(qrByteCapacityM[:], r.Chars)
+	} else {
+		r.QRVersion = qrVersion(qrAlphanumericCapacityM[:], r.Chars)
+	}
+	return s, &r, nil
+}
+
+// EncodeWithin returns the smallest encoding which fits a QR code of
+// maxVersion (1–40) with error correction level M, or ErrBudget when none do.
+func EncodeWithin(kind Kind, payload json.RawMessage, maxVersion int) (string, *Report, error) {
+	s1, r1, err := Encode(kind, payload, CBORBase45)
+	if err != nil {
+		return "", nil, err
+	}
+	s2, r2, err := Encode(kind, payload, DeflateBase64URL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// prefer the smallest QR code
+	switch {
+	case r1.Fits(maxVersion) && (!r2.Fits(maxVersion) || r1.QRVersion <= r2.QRVersion):
+		return s1, r1, nil
+	case r2.Fits(maxVersion):
+		return s2, r2, nil
+	}
+	return "", r1, fmt.Errorf("%w: %s of %d JSON bytes needs %d characters for QR version %d",
+		ErrBudget, kind, len(payload), r1.Chars, maxVersion)
+}
+
+// DecodeMax is the upper boundary for decompressed payloads in bytes.
+const DecodeMax = 1 << 20
+
+// Decode returns the JSON payload of an encoding.
+func Decode(s string) (Kind, json.RawMessage, error) {
+	if len(s) < 6 || s[:3] != "IDC" || s[5] != ':' {
+		return 0, nil, errors.New("compact encoding header missing")
+	}
+	kind, format, body := Kind(s[3]), Format(s[4]), s[6:]
+
+	switch format {
+	case CBORBase45, CBORZlibBase45:
+		bin, err := DecodeBase45(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("compact encoding: %w", err)
+		}
+		if format == CBORZlibBase45 {
+			r, err := zlib.NewReader(bytes.NewReader(bin))
+			if err != nil {
+				return 0, nil, fmt.Errorf("compact encoding: %w", err)
+			}
+			bin, err = readMax(r)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		payload, err := cbor.ToJSON(bin)
+		if err != nil {
+			return 0, nil, fmt.Errorf("compact encoding: %w", err)
+		}
+		return kind, payload, nil
+
+	case DeflateBase64URL:
+		bin, err := base64.RawURLEncoding.DecodeString(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("compact encoding: %w", err)
+		}
+		payload, err := readMax(flate.NewReader(bytes.NewReader(bin)))
+		if err != nil {
+			return 0, nil, err
+		}
+		if !json.Valid(payload) {
+			return 0, nil, errors.New("compact encoding has invalid JSON")
+		}
+		return kind, payload, nil
+
+	default:
+		return 0, nil, fmt.Errorf("compact format %q unknown", byte(format))
+	}
+}
+
+func readMax(r io.Reader) ([]byte, error) {
+	bytes, err := io.ReadAll(io.LimitReader(r, DecodeMax+1))
+	if err != nil {
+		return nil, fmt.Errorf("compact encoding decompression: %w", err)
+	}
+	if len(bytes) > DecodeMax {
+		return nil, fmt.Errorf("compact encoding decompresses beyond %d bytes", DecodeMax)
+	}
+	return bytes, nil
+}
+
+// IsEncoding returns whether s has the header of an encoding.
+func IsEncoding(s string) bool {
+	return len(s) >= 6 && strings.HasPrefix(s, "IDC") && s[5] == ':'
+}
+
+// QR code capacities in characters for versions 1 to 40, with error correction
+// level M, as per ISO/IEC 18004, table 7.
+var qrAlphanumericCapacityM = [40]int{
+	20, 38, 61, 90, 122, 154, 178, 221, 262, 311,
+	366, 419, 483, 528, 600, 656, 734, 816, 909, 970,
+	1035, 1134, 1248, 1326, 1451, 1542, 1637, 1732, 1839, 1994,
+	2113, 2238, 2369, 2506, 2632, 2780, 2894, 3054, 3220, 3391,
+}
+var qrByteCapacityM = [40]int{
+	14, 26, 42, 62, 84, 106, 122, 152, 180, 213,
+	251, 287, 331, 362, 412, 450, 504, 560, 624, 666,
+	711, 779, 857, 911, 997, 1059, 1125, 1190, 1264, 1370,
+	1452, 1538, 1628, 1722, 1809, 1911, 1989, 2099, 2213, 2331,
+}
+
+func qrVersion(capacities []int, n int) int {
+	for i, c := range capacities {
+		if n <= c {
+			return i + 1
+		}
+	}
+	return 0
+}
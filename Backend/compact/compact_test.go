@@ -0,0 +1,109 @@
+package compact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// GoldenBase45 is borrowed from RFC 9285, section 4.3.
+var GoldenBase45 = []struct{ Plain, Encoded string }{
+	{"AB", "BB8"},
+	{"Hello!!", "%69 VD92EX0"},
+	{"base-45", "UJCLQE7W581"},
+	{"ietf!", "QED8WEX0"},
+}
+
+func TestBase45(t *testing.T) {
+	for _, gold := range GoldenBase45 {
+		if got := EncodeBase45([]byte(gold.Plain)); got != gold.Encoded {
+			t.Errorf("%q got %q, want %q", gold.Plain, got, gold.Encoded)
+		}
+		got, err := DecodeBase45(gold.Encoded)
+		if err != nil {
+			t.Errorf("%q got error: %s", gold.Encoded, err)
+		} else if string(got) != gold.Plain {
+			t.Errorf("%q got %q, want %q", gold.Encoded, got, gold.Plain)
+		}
+	}
+
+	for _, s := range []string{"GGW", "a", "ZZZ", "A"} {
+		if got, err := DecodeBase45(s); err == nil {
+			t.Errorf("%q got %q, want error", s, got)
+		}
+	}
+}
+
+const sampleInvitation = `{
+	"@type": "https://didcomm.org/out-of-band/2.0/invitation",
+	"@id": "69212a3a-d068-4f9d-a2dd-4741bca89af3",
+	"from": "did:example:alice",
+	"body": {
+		"goal_code": "issue-vc",
+		"goal": "To issue a Faber College Graduate credential",
+		"accept": ["didcomm/v2", "didcomm/aip2;env=rfc587"]
+	}
+}`
+
+func TestRoundTrip(t *testing.T) {
+	var want any
+	if err := json.Unmarshal([]byte(sampleInvitation), &want); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(want)
+
+	for _, format := range []Format{CBORBase45, CBORZlibBase45, DeflateBase64URL} {
+		s, r, err := Encode(Invitation, json.RawMessage(sampleInvitation), format)
+		if err != nil {
+			t.Fatalf("format %c got error: %s", format, err)
+		}
+		if r.Chars != len(s) || r.QRVersion == 0 {
+			t.Errorf("format %c got report %+v for %d characters", format, r, len(s))
+		}
+
+		kind, payload, err := Decode(s)
+		if err != nil {
+			t.Fatalf("format %c decode error: %s", format, err)
+		}
+		if kind != Invitation {
+			t.Errorf("format %c got kind %s, want %s", format, kind, Invitation)
+		}
+		var got any
+		if err := json.Unmarshal(payload, &got); err != nil {
+			t.Fatalf("format %c got invalid JSON %s", format, payload)
+		}
+		gotJSON, _ := json.Marshal(got)
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("format %c got %s, want %s", format, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestAlphanumericMode(t *testing.T) {
+	s, _, err := Encode(ProofRequest, json.RawMessage(sampleInvitation), CBORBase45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(base45Alphabet, s[i]) < 0 {
+			t.Fatalf("character %q at %d not in alphanumeric QR mode", s[i], i)
+		}
+	}
+}
+
+func TestEncodeWithin(t *testing.T) {
+	s, r, err := EncodeWithin(CredentialOffer, json.RawMessage(sampleInvitation), 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncoding(s) || !r.Fits(40) {
+		t.Errorf("got %q with report %+v", s, r)
+	}
+
+	_, _, err = EncodeWithin(CredentialOffer, json.RawMessage(sampleInvitation), 1)
+	if !errors.Is(err, ErrBudget) {
+		t.Errorf("version 1 budget got error %v, want ErrBudget", err)
+	}
+}
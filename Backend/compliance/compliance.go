@@ -0,0 +1,169 @@
+// Package compliance evaluates DIDs with their documents and resolution
+// metadata against the DID Core rules plus any rules of the DID method, for
+// audits and certification.
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Level classifies a rule conform the requirement keywords of RFC 2119.
+type Level string
+
+// Requirement Levels
+const (
+	Error   Level = "error"   // MUST
+	Warning Level = "warning" // SHOULD
+)
+
+// Input is the subject of evaluation.
+type Input struct {
+	DID      backend.DID
+	Document *backend.Document
+	Meta     *backend.Meta // optional
+}
+
+// Rule is a single requirement.
+type Rule struct {
+	ID    string // unique, e.g., "core-id"
+	Level Level
+	// Requirement quotes or paraphrases the specification.
+	Requirement string
+
+	// Check returns a description per violation, if any.
+	Check func(in *Input) []string
+}
+
+var (
+	methodRulesMutex sync.RWMutex
+	methodRules      = make(map[string][]Rule)
+)
+
+// Register adds rules for DIDs with method. Rule IDs should be prefixed with
+// the method name to prevent collisions.
+func Register(method string, rules ...Rule) {
+	methodRulesMutex.Lock()
+	defer methodRulesMutex.Unlock()
+	methodRules[method] = append(methodRules[method], rules...)
+}
+
+// Rules returns the DID Core rules followed by the rules registered for
+// method, if any.
+func Rules(method string) []Rule {
+	methodRulesMutex.RLock()
+	defer methodRulesMutex.RUnlock()
+	rules := make([]Rule, 0, len(coreRules)+len(methodRules[method]))
+	rules = append(rules, coreRules...)
+	return append(rules, methodRules[method]...)
+}
+
+// Finding is a rule violation.
+type Finding struct {
+	Rule        string `json:"rule"`
+	Level       Level  `json:"level"`
+	Requirement string `json:"requirement"`
+	Message     string `json:"message"`
+}
+
+// Report is the outcome of an evaluation. The JSON encoding is the
+// machine-readable form, and WriteText produces the human-readable form.
+type Report struct {
+	DID      string    `json:"did"`
+	Method   string    `json:"method"`
+	Time     time.Time `json:"time"`
+	Rules    []string  `json:"rules"` // IDs evaluated
+	Findings []Finding `json:"findings"`
+}
+
+// Compliant returns whether no Error level rule was violated.
+func (r *Report) Compliant() bool {
+	return r.Count(Error) == 0
+}
+
+// Count returns the number of findings on level.
+func (r *Report) Count(level Level) int {
+	var n int
+	for _, f := range r.Findings {
+		if f.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// MarshalJSON implements the json.Marshaler interface. The encoding includes
+// the verdict.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	type plain Report // without methods
+	findings := r.Findings
+	if findings == nil {
+		findings = []Finding{} // not null
+	}
+	return json.Marshal(struct {
+		*plain
+		Findings  []Finding `json:"findings"`
+		Compliant bool      `json:"compliant"`
+	}{(*plain)(r), findings, r.Compliant()})
+}
+
+// WriteText prints the report in a human-readable form.
+func (r *Report) WriteText(w io.Writer) error {
+	verdict := "COMPLIANT"
+	if !r.Compliant() {
+		verdict = "NOT COMPLIANT"
+	}
+	_, err := fmt.Fprintf(w, "Compliance report for %s\nEvaluated %s against %d rules.\n%s: %d errors, %d warnings\n",
+		r.DID, r.Time.UTC().Format(time.RFC3339), len(r.Rules), verdict, r.Count(Error), r.Count(Warning))
+	if err != nil {
+		return err
+	}
+	for _, f := range r.Findings {
+		_, err := fmt.Fprintf(w, "\n[%s] %s: %s\n\t%s\n", f.Level, f.Rule, f.Message, f.Requirement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate applies the Rules for the DID method of in. Errors come before
+// warnings in the findings, in rule order otherwise.
+func Evaluate(in *Input) *Report {
+	r := &Report{
+		DID:    in.DID.String(),
+		Method: in.DID.Method,
+		Time:   time.Now(),
+	}
+	for _, rule := range Rules(in.DID.Method) {
+		r.Rules = append(r.Rules, rule.ID)
+		if in.Document == nil && rule.ID != "core-document" {
+			continue
+		}
+		for _, msg := range rule.Check(in) {
+			r.Findings = append(r.Findings, Finding{
+				Rule:        rule.ID,
+				Level:       rule.Level,
+				Requirement: rule.Requirement,
+				Message:     msg,
+			})
+		}
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		return r.Findings[i].Level == Error && r.Findings[j].Level != Error
+	})
+	return r
+}
+
+// IsURI returns whether s is an absolute URI.
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
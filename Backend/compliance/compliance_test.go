@@ -0,0 +1,141 @@
+package compliance
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func mustDoc(t *testing.T, s string) *backend.Document {
+	t.Helper()
+	doc := new(backend.Document)
+	if err := json.Unmarshal([]byte(s), doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestCompliant(t *testing.T) {
+	did, err := backend.Parse("did:web:example.com%3A8443:users:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := mustDoc(t, `{
+		"id": "did:web:example.com%3A8443:users:alice",
+		"alsoKnownAs": ["https://example.com/alice"],
+		"verificationMethod": [{
+			"id": "did:web:example.com%3A8443:users:alice#key-1",
+			"type": "JsonWebKey2020",
+			"controller": "did:web:example.com%3A8443:users:alice",
+			"publicKeyJwk": {"kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+		}],
+		"authentication": ["#key-1"],
+		"service": [{"id": "did:web:example.com%3A8443:users:alice#hub", "type": "Hub", "serviceEndpoint": "https://hub.example.com/"}]
+	}`)
+	r := Evaluate(&Input{DID: did, Document: doc, Meta: &backend.Meta{Created: time.Unix(0, 0)}})
+	if !r.Compliant() || len(r.Findings) != 0 {
+		t.Errorf("got findings %+v", r.Findings)
+	}
+	if !strings.HasPrefix(strings.Join(r.Rules, " "), "core-document core-id") || r.Rules[len(r.Rules)-1] != "web-path" {
+		t.Errorf("got rules %q", r.Rules)
+	}
+}
+
+func TestViolations(t *testing.T) {
+	did := backend.DID{Method: "web", SpecID: "192.168.0.1:8080:..:docs"}
+	doc := mustDoc(t, `{
+		"id": "did:web:other.example.com",
+		"alsoKnownAs": ["alice"],
+		"verificationMethod": [{
+			"id": "#key-1",
+			"type": "JsonWebKey2020",
+			"controller": "did:web:other.example.com",
+			"publicKeyJwk": {"kty": "OKP", "crv": "Ed25519", "x": "AA", "d": "AA"},
+			"publicKeyMultibase": "z6Mk"
+		}, {
+			"id": "did:web:other.example.com#key-1",
+			"type": "JsonWebKey2020",
+			"controller": "did:web:other.example.com"
+		}],
+		"assertionMethod": ["#key-2"],
+		"service": [
+			{"id": "#hub", "type": "Hub", "serviceEndpoint": "https://hub.example.com/"},
+			{"id": "#hub", "type": "Hub", "serviceEndpoint": "/relative"}
+		]
+	}`)
+	meta := &backend.Meta{
+		Created:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Updated:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		EquivalentIDs: []backend.DID{{Method: "example", SpecID: "alice"}},
+	}
+	r := Evaluate(&Input{DID: did, Document: doc, Meta: meta})
+
+	want := map[string]int{
+		"core-id":               1,
+		"core-also-known-as":    1,
+		"core-method-unique":    1,
+		"core-method-material":  1,
+		"core-jwk-private":      1,
+		"core-method-reference": 1,
+		"core-service-id":       2,
+		"core-service-unique":   1,
+		"core-service-endpoint": 1,
+		"meta-equivalent-id":    1,
+		"meta-updated":          1,
+		"web-domain":            1,
+		"web-path":              1,
+	}
+	got := make(map[string]int)
+	for _, f := range r.Findings {
+		got[f.Rule]++
+	}
+	for rule, n := range want {
+		if got[rule] != n {
+			t.Errorf("rule %q got %d findings, want %d", rule, got[rule], n)
+		}
+	}
+	for rule, n := range got {
+		if want[rule] == 0 {
+			t.Errorf("rule %q got %d unexpected findings", rule, n)
+		}
+	}
+	if r.Compliant() {
+		t.Error("compliant with violations")
+	}
+	if r.Findings[len(r.Findings)-1].Level != Warning {
+		t.Error("errors not before warnings")
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "NOT COMPLIANT: 12 errors, 2 warnings") {
+		t.Errorf("got text report:\n%s", buf.String())
+	}
+}
+
+func TestNoDocument(t *testing.T) {
+	r := Evaluate(&Input{DID: backend.DID{Method: "example", SpecID: "gone"}})
+	if len(r.Findings) != 1 || r.Findings[0].Rule != "core-document" {
+		t.Errorf("got findings %+v", r.Findings)
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Compliant *bool `json:"compliant"`
+		Findings  []Finding
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Compliant == nil || *decoded.Compliant || len(decoded.Findings) != 1 {
+		t.Errorf("got JSON %s", b)
+	}
+}
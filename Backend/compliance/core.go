@@ -0,0 +1,254 @@
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// CoreRules apply to any DID method, conform W3C DID Core v1.0.
+var coreRules = []Rule{
+	{
+		ID:          "core-document",
+		Level:       Error,
+		Requirement: "If the resolution is successful, … the DID document MUST be returned.",
+		Check: func(in *Input) []string {
+			if in.Document == nil {
+				return []string{"no DID document"}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "core-id",
+		Level:       Error,
+		Requirement: "The DID for a particular DID subject is expressed using the id property in the DID document.",
+		Check: func(in *Input) []string {
+			if in.Document.Subject.Equal(in.DID) {
+				return nil
+			}
+			if in.Meta != nil && in.Meta.CanonicalID != nil && in.Document.Subject.Equal(*in.Meta.CanonicalID) {
+				return nil
+			}
+			return []string{fmt.Sprintf("document id %s does not match %s", in.Document.Subject.String(), in.DID.String())}
+		},
+	},
+	{
+		ID:          "core-also-known-as",
+		Level:       Error,
+		Requirement: "The alsoKnownAs property is OPTIONAL. If present, the value MUST be a set where each item in the set is a URI conforming to [RFC3986].",
+		Check: func(in *Input) (violations []string) {
+			for _, s := range in.Document.AlsoKnownAs {
+				if !isURI(s) {
+					violations = append(violations, fmt.Sprintf("alsoKnownAs %q is not a URI", s))
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-method-unique",
+		Level:       Error,
+		Requirement: "If more than one verification method is present … with the same identifier, it is an error.",
+		Check: func(in *Input) (violations []string) {
+			seen := make(map[string]bool)
+			for _, m := range allMethods(in.Document) {
+				id := absolute(in.Document, &m.ID).String()
+				if seen[id] {
+					violations = append(violations, fmt.Sprintf("verification method %s more than once", id))
+				}
+				seen[id] = true
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-method-type",
+		Level:       Error,
+		Requirement: "The value of the type property MUST be a string that references exactly one verification method type.",
+		Check: func(in *Input) (violations []string) {
+			for _, m := range allMethods(in.Document) {
+				if m.Type == "" {
+					violations = append(violations, fmt.Sprintf("verification method %s has no type", m.ID.String()))
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-method-material",
+		Level:       Error,
+		Requirement: "A verification method MUST NOT contain multiple verification material properties for the same material.",
+		Check: func(in *Input) (violations []string) {
+			for _, m := range allMethods(in.Document) {
+				_, jwk := m.Additional["publicKeyJwk"]
+				_, multibase := m.Additional["publicKeyMultibase"]
+				if jwk && multibase {
+					violations = append(violations, fmt.Sprintf("verification method %s has both publicKeyJwk and publicKeyMultibase", m.ID.String()))
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-jwk-private",
+		Level:       Error,
+		Requirement: "The JSON Web Key MUST NOT contain \"d\", or any other members of the private information class.",
+		Check: func(in *Input) (violations []string) {
+			for _, m := range allMethods(in.Document) {
+				raw, ok := m.Additional["publicKeyJwk"]
+				if !ok {
+					continue
+				}
+				var members map[string]json.RawMessage
+				if err := json.Unmarshal(raw, &members); err != nil {
+					violations = append(violations, fmt.Sprintf("verification method %s has a publicKeyJwk which is not a JSON object", m.ID.String()))
+					continue
+				}
+				// private members of RFC 7518, section 6
+				for _, name := range [...]string{"d", "p", "q", "dp", "dq", "qi", "oth", "k"} {
+					if _, ok := members[name]; ok {
+						violations = append(violations, fmt.Sprintf("verification method %s exposes private key member %q", m.ID.String(), name))
+					}
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-method-reference",
+		Level:       Warning,
+		Requirement: "Verification methods can be referenced … the DID URL is dereferenced to find the verification method.",
+		Check: func(in *Input) (violations []string) {
+			_, notFound := in.Document.VerificationMethodRefs()
+			for _, u := range notFound {
+				if u.IsRelative() || u.DID.Equal(in.Document.Subject) {
+					violations = append(violations, fmt.Sprintf("verification method reference %s not in document", u.String()))
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-service-id",
+		Level:       Error,
+		Requirement: "The value of the id property MUST be a URI conforming to [RFC3986].",
+		Check: func(in *Input) (violations []string) {
+			for _, s := range in.Document.Services {
+				if s.ID.Scheme == "" {
+					violations = append(violations, fmt.Sprintf("service id %q is not a URI", s.ID.String()))
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-service-unique",
+		Level:       Error,
+		Requirement: "A conforming producer MUST NOT produce multiple service entries with the same id.",
+		Check: func(in *Input) (violations []string) {
+			seen := make(map[string]bool)
+			for _, s := range in.Document.Services {
+				id := s.ID.String()
+				if seen[id] {
+					violations = append(violations, fmt.Sprintf("service %s more than once", id))
+				}
+				seen[id] = true
+			}
+			return
+		},
+	},
+	{
+		ID:          "core-service-endpoint",
+		Level:       Error,
+		Requirement: "All string values MUST be valid URIs conforming to [RFC3986].",
+		Check: func(in *Input) (violations []string) {
+			for _, s := range in.Document.Services {
+				for _, u := range s.Endpoint.URIRefs {
+					if u.Scheme == "" {
+						violations = append(violations, fmt.Sprintf("service %s endpoint %q is not a URI", s.ID.String(), u.String()))
+					}
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "meta-equivalent-id",
+		Level:       Error,
+		Requirement: "Each equivalentId DID value MUST be produced by, and a form of, the same DID Method as the id property value.",
+		Check: func(in *Input) (violations []string) {
+			if in.Meta == nil {
+				return nil
+			}
+			for _, d := range in.Meta.EquivalentIDs {
+				if d.Method != in.Document.Subject.Method {
+					violations = append(violations, fmt.Sprintf("equivalentId %s of another method", d.String()))
+				}
+			}
+			return
+		},
+	},
+	{
+		ID:          "meta-canonical-id",
+		Level:       Error,
+		Requirement: "The canonicalId value MUST be produced by, and a form of, the same DID Method as the id property value.",
+		Check: func(in *Input) []string {
+			if in.Meta == nil || in.Meta.CanonicalID == nil || in.Meta.CanonicalID.Method == in.Document.Subject.Method {
+				return nil
+			}
+			return []string{fmt.Sprintf("canonicalId %s of another method", in.Meta.CanonicalID.String())}
+		},
+	},
+	{
+		ID:          "meta-updated",
+		Level:       Warning,
+		Requirement: "The updated timestamp can not precede the created timestamp.",
+		Check: func(in *Input) []string {
+			if in.Meta == nil || in.Meta.Created.IsZero() || in.Meta.Updated.IsZero() || !in.Meta.Updated.Before(in.Meta.Created) {
+				return nil
+			}
+			return []string{fmt.Sprintf("updated %s before created %s", in.Meta.Updated, in.Meta.Created)}
+		},
+	},
+	{
+		ID:          "meta-deactivated",
+		Level:       Warning,
+		Requirement: "Deactivated DIDs can no longer be relied upon.",
+		Check: func(in *Input) []string {
+			if in.Meta == nil || in.Meta.Deactivated.IsZero() {
+				return nil
+			}
+			return []string{fmt.Sprintf("DID deactivated since %s", in.Meta.Deactivated)}
+		},
+	},
+}
+
+// AllMethods returns the verification methods of doc, including the ones
+// embedded in relationships.
+func allMethods(doc *backend.Document) []*backend.VerificationMethod {
+	methods := append([]*backend.VerificationMethod(nil), doc.VerificationMethods...)
+	for _, r := range [...]*backend.VerificationRelationship{
+		doc.Authentication,
+		doc.AssertionMethod,
+		doc.KeyAgreement,
+		doc.CapabilityInvocation,
+		doc.CapabilityDelegation,
+	} {
+		if r != nil {
+			methods = append(methods, r.Methods...)
+		}
+	}
+	return methods
+}
+
+// Absolute resolves u against the subject of doc.
+func absolute(doc *backend.Document, u *backend.URL) *backend.URL {
+	if !u.IsRelative() {
+		return u
+	}
+	resolved := *u // copy
+	resolved.DID = doc.Subject
+	return &resolved
+}
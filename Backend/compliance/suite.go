@@ -0,0 +1,300 @@
+package compliance
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/cbor"
+)
+
+// Suite is an implementation report in the format of the W3C DID Test Suite,
+// i.e., a JSON file from packages/did-core-test-server/suites/implementations
+// at https://github.com/w3c/did-test-suite. Reports either have DIDs with
+// their productions, or they have executions of a resolver or a dereferencer.
+type Suite struct {
+	DIDMethod             string            `json:"didMethod"` // e.g., "did:key"
+	Implementation        string            `json:"implementation"`
+	Implementer           string            `json:"implementer"`
+	SupportedContentTypes []string          `json:"supportedContentTypes"`
+	DIDs                  []string          `json:"dids"`
+	DIDParameters         map[string]string `json:"didParameters"`
+
+	// Fixtures have the productions of each DID, by content type, plus the
+	// "didDocumentDataModel" entry.
+	Fixtures map[string]map[string]json.RawMessage `json:"-"`
+
+	Executions []*Execution `json:"executions"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *Suite) UnmarshalJSON(data []byte) error {
+	type plain Suite // without methods
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	s.Fixtures = make(map[string]map[string]json.RawMessage, len(s.DIDs))
+	for _, did := range s.DIDs {
+		raw, ok := all[did]
+		if !ok {
+			continue
+		}
+		var fixture map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fixture); err != nil {
+			return fmt.Errorf("test suite fixture of %q: %w", did, err)
+		}
+		s.Fixtures[did] = fixture
+	}
+	return nil
+}
+
+// Execution is a recorded invocation of a resolver or a dereferencer.
+type Execution struct {
+	// Function is one of "resolve", "resolveRepresentation" or
+	// "dereference".
+	Function string `json:"function"`
+	Input    struct {
+		DID    string `json:"did"`
+		DIDURL string `json:"didUrl"`
+	} `json:"input"`
+	Output struct {
+		ResolutionMeta    *backend.ResolutionMeta `json:"didResolutionMetadata"`
+		Document          json.RawMessage         `json:"didDocument"`
+		DocumentStream    string                  `json:"didDocumentStream"`
+		DocumentMeta      json.RawMessage         `json:"didDocumentMetadata"`
+		DereferencingMeta *backend.ResolutionMeta `json:"dereferencingMetadata"`
+	} `json:"output"`
+}
+
+// Case is the outcome of a single assertion.
+type Case struct {
+	Name    string `json:"name"`              // subject and assertion
+	Failure string `json:"failure,omitempty"` // empty on success
+}
+
+// Conformance is the outcome of a Suite.
+type Conformance struct {
+	Implementation string `json:"implementation"`
+	Cases          []Case `json:"cases"`
+}
+
+// Failed returns the number of cases with a failure.
+func (c *Conformance) Failed() int {
+	var n int
+	for _, tc := range c.Cases {
+		if tc.Failure != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Conformance) add(name string, failure string) {
+	c.Cases = append(c.Cases, Case{Name: name, Failure: failure})
+}
+
+// Check evaluates the productions and the executions of s against this
+// implementation, i.e., the DID parser, the document codecs, and the DID Core
+// rules from Evaluate. Any disagreement on the validity of a DID, a DID URL,
+// or a document counts as failure.
+func (s *Suite) Check() *Conformance {
+	c := &Conformance{Implementation: s.Implementation}
+	for _, did := range s.DIDs {
+		s.checkDID(c, did)
+	}
+	for _, e := range s.Executions {
+		e.check(c)
+	}
+	return c
+}
+
+func (s *Suite) checkDID(c *Conformance, str string) {
+	did, err := backend.Parse(str)
+	if err != nil {
+		c.add(str+"/syntax", err.Error())
+		return
+	}
+	if s.DIDMethod != "" && "did:"+did.Method != s.DIDMethod {
+		c.add(str+"/syntax", fmt.Sprintf("method %q is not the %q of the suite", did.Method, s.DIDMethod))
+		return
+	}
+	c.add(str+"/syntax", "")
+
+	fixture, ok := s.Fixtures[str]
+	if !ok {
+		c.add(str+"/dataModel", "no fixture")
+		return
+	}
+	var model struct {
+		Properties json.RawMessage `json:"properties"`
+	}
+	var doc *backend.Document
+	if err := json.Unmarshal(fixture["didDocumentDataModel"], &model); err != nil || model.Properties == nil {
+		c.add(str+"/dataModel", "no didDocumentDataModel properties")
+	} else if doc, err = decodeDocument(backend.JSON, model.Properties); err != nil {
+		c.add(str+"/dataModel", err.Error())
+	} else {
+		c.add(str+"/dataModel", violations(did, doc))
+	}
+
+	for _, contentType := range s.SupportedContentTypes {
+		name := str + "/" + contentType
+		var production struct {
+			Representation string                  `json:"representation"`
+			DocumentMeta   json.RawMessage         `json:"didDocumentMetadata"`
+			ResolutionMeta *backend.ResolutionMeta `json:"didResolutionMetadata"`
+		}
+		if err := json.Unmarshal(fixture[contentType], &production); err != nil {
+			c.add(name, "no production")
+			continue
+		}
+
+		if production.ResolutionMeta == nil || production.ResolutionMeta.ContentType != contentType {
+			c.add(name+"/contentType", "didResolutionMetadata has another contentType")
+		} else {
+			c.add(name+"/contentType", "")
+		}
+
+		if production.DocumentMeta != nil {
+			var meta backend.Meta
+			if err := json.Unmarshal(production.DocumentMeta, &meta); err != nil {
+				c.add(name+"/metadata", err.Error())
+			} else {
+				c.add(name+"/metadata", "")
+			}
+		}
+
+		repr, err := decodeDocument(contentType, []byte(production.Representation))
+		if err != nil {
+			c.add(name+"/representation", err.Error())
+			continue
+		}
+		c.add(name+"/representation", violations(did, repr))
+		if doc != nil {
+			c.add(name+"/equivalence", equivalence(doc, repr))
+		}
+	}
+}
+
+func (e *Execution) check(c *Conformance) {
+	switch e.Function {
+	case "resolve", "resolveRepresentation":
+		name := e.Function + "/" + e.Input.DID
+		var code string
+		if e.Output.ResolutionMeta != nil {
+			code = e.Output.ResolutionMeta.Error
+		}
+		did, err := backend.Parse(e.Input.DID)
+		switch {
+		case err != nil && code != "invalidDid":
+			c.add(name, fmt.Sprintf("got error code %q for an invalid DID: %s", code, err))
+		case err == nil && code == "invalidDid":
+			c.add(name, "got error code \"invalidDid\" for a valid DID")
+		case err != nil || code != "":
+			c.add(name, "") // error as expected
+		default:
+			c.add(name, e.checkDocument(did))
+		}
+
+	case "dereference":
+		name := e.Function + "/" + e.Input.DIDURL
+		var code string
+		if e.Output.DereferencingMeta != nil {
+			code = e.Output.DereferencingMeta.Error
+		}
+		_, err := backend.ParseURL(e.Input.DIDURL)
+		switch {
+		case err != nil && code != "invalidDidUrl":
+			c.add(name, fmt.Sprintf("got error code %q for an invalid DID URL: %s", code, err))
+		case err == nil && code == "invalidDidUrl":
+			c.add(name, "got error code \"invalidDidUrl\" for a valid DID URL")
+		default:
+			c.add(name, "")
+		}
+
+	default:
+		c.add(e.Function, "unknown function")
+	}
+}
+
+// CheckDocument verifies the production of a successful resolution.
+func (e *Execution) checkDocument(did backend.DID) string {
+	var doc *backend.Document
+	var err error
+	if e.Function == "resolve" {
+		if len(e.Output.Document) == 0 {
+			return "no didDocument"
+		}
+		doc, err = decodeDocument(backend.JSON, e.Output.Document)
+	} else {
+		contentType := backend.JSON
+		if e.Output.ResolutionMeta != nil && e.Output.ResolutionMeta.ContentType != "" {
+			contentType = e.Output.ResolutionMeta.ContentType
+		}
+		doc, err = decodeDocument(contentType, []byte(e.Output.DocumentStream))
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return violations(did, doc)
+}
+
+// DecodeDocument parses a representation. CBOR comes in hexadecimal, as the
+// test suite is JSON.
+func decodeDocument(contentType string, data []byte) (*backend.Document, error) {
+	switch contentType {
+	case backend.JSON, backend.LDJSON:
+		doc := new(backend.Document)
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, err
+		}
+		if contentType == backend.LDJSON && (len(doc.Context) == 0 || doc.Context[0] != backend.V1) {
+			return nil, fmt.Errorf("%s has no @context with %q first", backend.LDJSON, backend.V1)
+		}
+		return doc, nil
+	case backend.CBOR:
+		raw, err := hex.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s representation: %w", backend.CBOR, err)
+		}
+		return cbor.UnmarshalDocument(raw)
+	default:
+		return nil, fmt.Errorf("%w: %q", backend.ErrMediaType, contentType)
+	}
+}
+
+// Violations returns the Error level findings of Evaluate, if any.
+func violations(did backend.DID, doc *backend.Document) string {
+	var msgs []string
+	for _, f := range Evaluate(&Input{DID: did, Document: doc}).Findings {
+		if f.Level == Error {
+			msgs = append(msgs, f.Rule+": "+f.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Equivalence compares the data model with a representation, regardless of
+// the representation-specific "@context".
+func equivalence(model, repr *backend.Document) string {
+	a, b := *model, *repr
+	a.Context, b.Context = nil, nil
+	x, err := json.Marshal(&a)
+	if err != nil {
+		return err.Error()
+	}
+	y, err := json.Marshal(&b)
+	if err != nil {
+		return err.Error()
+	}
+	if string(x) != string(y) {
+		return fmt.Sprintf("representation %s differs from data model %s", y, x)
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package compliance
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Run the official fixtures with:
+//
+//	go test ./compliance -run TestSuite -suite path/to/did-test-suite/packages/did-core-test-server/suites/implementations
+//
+// Reports vendored in testdata/upstream run always. See the README there.
+var suiteDir = flag.String("suite", "", "`directory` with implementation reports of the W3C DID Test Suite, in addition to testdata/suite")
+
+func TestSuite(t *testing.T) {
+	paths, err := filepath.Glob("testdata/suite/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := filepath.Glob("testdata/upstream/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upstream) != 0 {
+		source, err := os.ReadFile("testdata/upstream/SOURCE")
+		if err != nil || !strings.Contains(string(source), "commit ") {
+			t.Fatal("vendored reports need their upstream commit in testdata/upstream/SOURCE")
+		}
+		paths = append(paths, upstream...)
+	}
+	if *suiteDir != "" {
+		more, err := filepath.Glob(filepath.Join(*suiteDir, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(more) == 0 {
+			t.Fatalf("no implementation reports in %s", *suiteDir)
+		}
+		paths = append(paths, more...)
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var s Suite
+			if err := json.Unmarshal(data, &s); err != nil {
+				t.Fatal(err)
+			}
+			c := s.Check()
+			for _, tc := range c.Cases {
+				if tc.Failure != "" {
+					t.Errorf("%s: %s", tc.Name, tc.Failure)
+				}
+			}
+			t.Logf("%s by %s: %d of %d cases conform", c.Implementation, s.Implementer, len(c.Cases)-c.Failed(), len(c.Cases))
+		})
+	}
+}
+
+func TestSuiteFailures(t *testing.T) {
+	const report = `{
+		"didMethod": "did:example",
+		"supportedContentTypes": ["application/did+json", "application/did+ld+json"],
+		"dids": ["did:example:123", "did:other:456"],
+		"did:example:123": {
+			"didDocumentDataModel": {"properties": {"id": "did:example:123", "alsoKnownAs": ["https://example.com/"]}},
+			"application/did+json": {
+				"representation": "{\"id\": \"did:example:123\"}",
+				"didResolutionMetadata": {"contentType": "application/did+json"}
+			},
+			"application/did+ld+json": {
+				"representation": "{\"id\": \"did:example:123\", \"alsoKnownAs\": [\"https://example.com/\"]}",
+				"didResolutionMetadata": {"contentType": "application/did+json"}
+			}
+		},
+		"executions": [{
+			"function": "resolve",
+			"input": {"did": "did:example:abc%"},
+			"output": {"didResolutionMetadata": {"error": "notFound"}}
+		}, {
+			"function": "resolve",
+			"input": {"did": "did:example:123"},
+			"output": {"didResolutionMetadata": {"error": "invalidDid"}}
+		}, {
+			"function": "dereference",
+			"input": {"didUrl": "did:example:123#%zz"},
+			"output": {"dereferencingMetadata": {}}
+		}]
+	}`
+	var s Suite
+	if err := json.Unmarshal([]byte(report), &s); err != nil {
+		t.Fatal(err)
+	}
+	c := s.Check()
+
+	var failed []string
+	for _, tc := range c.Cases {
+		if tc.Failure != "" {
+			failed = append(failed, tc.Name)
+		}
+	}
+	want := []string{
+		"did:example:123/application/did+json/equivalence",
+		"did:example:123/application/did+ld+json/contentType",
+		"did:example:123/application/did+ld+json/representation",
+		"did:other:456/syntax",
+		"resolve/did:example:abc%",
+		"resolve/did:example:123",
+		"dereference/did:example:123#%zz",
+	}
+	if got := strings.Join(failed, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got failures:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+	if c.Failed() != len(want) {
+		t.Errorf("got %d failed, want %d", c.Failed(), len(want))
+	}
+}
+
+// TestSuiteInvalidRepresentations has productions which violate DID Core,
+// section 4 and 6, each of which must fail.
+func TestSuiteInvalidRepresentations(t *testing.T) {
+	const did = "did:example:123"
+	tests := []struct {
+		name           string
+		contentType    string
+		representation string
+	}{
+		{"syntax", backend.JSON, `{"id": "did:example:123"`},
+		{"id not a DID", backend.JSON, `{"id": "https://example.com/"}`},
+		{"id of another DID", backend.JSON, `{"id": "did:example:456"}`},
+		{"no @context", backend.LDJSON, `{"id": "did:example:123"}`},
+		{"@context not DID first", backend.LDJSON, `{"@context": ["https://example.com/"], "id": "did:example:123"}`},
+		{"method without type", backend.JSON, `{"id": "did:example:123", "verificationMethod": [{"id": "did:example:123#key-1", "controller": "did:example:123", "publicKeyMultibase": "z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp"}]}`},
+		{"method twice", backend.JSON, `{"id": "did:example:123", "verificationMethod": [{"id": "did:example:123#key-1", "type": "Multikey", "controller": "did:example:123", "publicKeyMultibase": "z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp"}, {"id": "did:example:123#key-1", "type": "Multikey", "controller": "did:example:123", "publicKeyMultibase": "z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp"}]}`},
+		{"service without endpoint", backend.JSON, `{"id": "did:example:123", "service": [{"id": "did:example:123#hub", "type": "Hub"}]}`},
+		{"CBOR not in hexadecimal", backend.CBOR, `zz`},
+	}
+	for _, test := range tests {
+		production, err := json.Marshal(map[string]any{
+			"representation":        test.representation,
+			"didResolutionMetadata": map[string]string{"contentType": test.contentType},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := Suite{
+			SupportedContentTypes: []string{test.contentType},
+			DIDs:                  []string{did},
+			Fixtures: map[string]map[string]json.RawMessage{did: {
+				test.contentType: production,
+			}},
+		}
+		var failed bool
+		for _, tc := range s.Check().Cases {
+			if tc.Name == did+"/"+test.contentType+"/representation" && tc.Failure != "" {
+				failed = true
+			}
+		}
+		if !failed {
+			t.Errorf("%s: representation %s passed", test.name, test.representation)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package compliance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("web", webRules...)
+}
+
+// WebRules apply to did:web, conform the W3C CCG DID Method Specification.
+var webRules = []Rule{
+	{
+		ID:          "web-domain",
+		Level:       Error,
+		Requirement: "The method specific identifier MUST match the common name used in the SSL/TLS certificate, and it MUST NOT include IP addresses.",
+		Check: func(in *Input) []string {
+			// SpecID has the percent-encoding of ports decoded already
+			host, _, _ := strings.Cut(in.DID.SpecID, ":")
+			if !isHostname(host) {
+				return []string{fmt.Sprintf("domain %q is not a host name", host)}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "web-path",
+		Level:       Error,
+		Requirement: "The method specific identifier MAY include a path, with colons in place of the slashes.",
+		Check: func(in *Input) (violations []string) {
+			segs := strings.Split(in.DID.SpecID, ":")
+			for _, seg := range segs[1:] {
+				if seg == "" || seg == "." || seg == ".." || strings.ContainsAny(seg, "/?#") {
+					violations = append(violations, fmt.Sprintf("path segment %q not allowed", seg))
+				}
+			}
+			return
+		},
+	},
+}
+
+// IsHostname returns whether s is a domain name with at least two labels,
+// which excludes IP addresses.
+func isHostname(s string) bool {
+	labels := strings.Split(strings.TrimSuffix(s, "."), ".")
+	if len(s) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(l); i++ {
+			c := l[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	// top-level domains are not numeric
+	_, err := strconv.Atoi(labels[len(labels)-1])
+	return err != nil
+}
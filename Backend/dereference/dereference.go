@@ -0,0 +1,328 @@
+// Package dereference implements DID URL dereferencing, conform the DID
+// Resolution specification. A DID URL selects either the DID document, a
+// verification method, a service, a service endpoint, or a resource.
+package dereference
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// ErrHashlink signals a resource which does not match its "hl" parameter.
+var ErrHashlink = backend.ErrHashlink
+
+// ErrTooLarge signals a resource which exceeds the size limit.
+var ErrTooLarge = errors.New("DID URL resource exceeds size limit")
+
+// ResourceMax is the default size limit on resources in bytes.
+const ResourceMax = 16 << 20
+
+// Result is the outcome of dereferencing. Document, Meta and Resolution are
+// always set. At most one of the other fields is set, with the Document being
+// the primary resource when none are.
+type Result struct {
+	Document   *backend.Document
+	Meta       *backend.Meta
+	Resolution *backend.ResolutionMeta
+
+	// Method is the verification method selected by the fragment.
+	Method *backend.VerificationMethod
+	// Service is the service selected by the fragment.
+	Service *backend.Service
+	// Endpoint is the selection of the "service" parameter, with
+	// any "relativeRef" and fragment applied.
+	Endpoint *url.URL
+	// Resource is the content of a path, or the content of the Endpoint
+	// when retrieved. Callers must close it.
+	Resource io.ReadCloser
+	// MediaType is the content type of a retrieved Resource, without
+	// parameters. Resources of paths have no media type.
+	MediaType string
+}
+
+// Dereferencer applies DID URLs on resolution results. Multiple goroutines
+// may invoke methods on a Dereferencer simultaneously.
+type Dereferencer struct {
+	// Resolver must implement backend.VersionResolver for the "versionId"
+	// and "versionTime" parameters.
+	Resolver backend.Resolver
+
+	// Resources retrieves DID URL paths, which are method specific. The
+	// nil function makes all paths not found.
+	Resources func(ctx context.Context, u *backend.URL, doc *backend.Document) (io.ReadCloser, error)
+
+	// HTTP, when set, retrieves the service endpoint of DID URLs with a
+	// "relativeRef" parameter as the Resource, next to the Endpoint. Such
+	// endpoints are not retrieved when nil.
+	HTTP *http.Client
+
+	// ResourceMax limits the size of resources in bytes, with zero for
+	// ResourceMax. Reads beyond the limit get ErrTooLarge.
+	ResourceMax int64
+
+	// MediaTypes limits the retrieval of service endpoints to the content
+	// types listed, e.g., "application/json" or "image/*". Others get
+	// backend.ErrMediaType. All content types pass when empty.
+	MediaTypes []string
+
+	// Timeout limits the resolution when positive. Resources are bound to
+	// the context of Dereference only.
+	Timeout time.Duration
+}
+
+func (d *Dereferencer) resourceMax() int64 {
+	if d.ResourceMax > 0 {
+		return d.ResourceMax
+	}
+	return ResourceMax
+}
+
+// Dereference resolves the DID of s, and it applies the path, the query and
+// the fragment. Errors wrap the backend errors of resolution where
+// applicable. Each call is a "did.dereference" span with the method.
+func (d *Dereferencer) Dereference(ctx context.Context, s string) (_ *Result, err error) {
+	ctx, span := backend.StartSpan(ctx, "did.dereference")
+	defer func() { span.End(err) }()
+	u, err := backend.ParseURL(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+	if u.IsRelative() {
+		return nil, fmt.Errorf("%w: relative DID URL %q", backend.ErrInvalid, s)
+	}
+	span.SetAttributes(slog.String("method", u.DID.Method))
+	return d.dereference(ctx, s, u)
+}
+
+func (d *Dereferencer) dereference(ctx context.Context, s string, u *backend.URL) (*Result, error) {
+	params, err := u.QueryValues()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+	versionID, versionTime, err := backend.VersionParams(params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+	service, relativeRef, err := backend.ServiceParams(params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+	hl, err := u.Hashlink()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+
+	resolver := d.Resolver
+	if versionID != "" || !versionTime.IsZero() {
+		vr, ok := d.Resolver.(backend.VersionResolver)
+		if !ok {
+			return nil, fmt.Errorf("%w: resolver has no version support", backend.ErrNotFound)
+		}
+		resolver = version{vr, versionID, versionTime}
+	}
+	var r Result
+	r.Document, r.Meta, r.Resolution, err = backend.ResolveTimed(ctx, resolver, u.DID, d.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if r.Meta == nil {
+		r.Meta = new(backend.Meta)
+	}
+
+	switch {
+	case service != "":
+		if u.RawPath != "" {
+			return nil, fmt.Errorf("%w: DID URL with both a path and a service", backend.ErrInvalid)
+		}
+		r.Endpoint, err = r.Document.ServiceEndpoint(u)
+		if err != nil {
+			return nil, err
+		}
+		if relativeRef != nil && d.HTTP != nil {
+			r.Resource, r.MediaType, err = d.fetch(ctx, r.Endpoint)
+			if err != nil {
+				return nil, err
+			}
+			return verify(&r, hl), nil
+		}
+
+	case u.RawPath != "":
+		if d.Resources == nil {
+			return nil, fmt.Errorf("%w: DID URL path %q", backend.ErrNotFound, u.RawPath)
+		}
+		resource, err := d.Resources(ctx, u, r.Document)
+		if err != nil {
+			return nil, err
+		}
+		r.Resource = &limitReader{ReadCloser: resource, n: d.resourceMax()}
+		return verify(&r, hl), nil
+
+	case u.RawFragment != "":
+		r.Method, r.Service = selectFragment(r.Document, u.Fragment())
+		if r.Method == nil && r.Service == nil {
+			return nil, fmt.Errorf("%w: no fragment %q in DID document", backend.ErrNotFound, u.Fragment())
+		}
+	}
+
+	if hl != nil {
+		return nil, fmt.Errorf("%w: hashlink applies to resources only", backend.ErrInvalid)
+	}
+	return &r, nil
+}
+
+// Verify wraps the resource of r with a check on EOF against hl, if any.
+func verify(r *Result, hl *backend.Hashlink) *Result {
+	if hl != nil {
+		r.Resource = &hashlinkReader{ReadCloser: r.Resource, hash: hl.New(), want: hl.Digest}
+	}
+	return r
+}
+
+// Fetch retrieves a service endpoint. The body streams with the size limit in
+// place.
+func (d *Dereferencer) fetch(ctx context.Context, endpoint *url.URL) (io.ReadCloser, string, error) {
+	if endpoint.Scheme != "https" && endpoint.Scheme != "http" {
+		return nil, "", fmt.Errorf("%w: service endpoint %q not retrievable", backend.ErrNotFound, endpoint.Redacted())
+	}
+	target := *endpoint // copy
+	target.Fragment, target.RawFragment = "", ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("service endpoint: %w", err)
+	}
+	if len(d.MediaTypes) != 0 {
+		req.Header.Set("Accept", strings.Join(d.MediaTypes, ", "))
+	}
+	resp, err := d.HTTP.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("service endpoint retrieval: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// stream
+	case http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: service endpoint %s got HTTP %q", backend.ErrNotFound, target.Redacted(), resp.Status)
+	case http.StatusNotAcceptable:
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: service endpoint %s got HTTP %q", backend.ErrMediaType, target.Redacted(), resp.Status)
+	default:
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("service endpoint %s got HTTP %q", target.Redacted(), resp.Status)
+	}
+
+	max := d.resourceMax()
+	if resp.ContentLength > max {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: service endpoint %s has %d bytes", ErrTooLarge, target.Redacted(), resp.ContentLength)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil && len(d.MediaTypes) != 0 {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: service endpoint %s content type: %w", backend.ErrMediaType, target.Redacted(), err)
+	}
+	if !acceptMediaType(d.MediaTypes, mediaType) {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: service endpoint %s has content type %q", backend.ErrMediaType, target.Redacted(), mediaType)
+	}
+	return &limitReader{ReadCloser: resp.Body, n: max}, mediaType, nil
+}
+
+// AcceptMediaType returns whether mediaType matches any of the accepted, with
+// "type/*" matching on the type only. The empty list accepts all.
+func acceptMediaType(accepted []string, mediaType string) bool {
+	if len(accepted) == 0 {
+		return true
+	}
+	for _, a := range accepted {
+		if strings.EqualFold(a, mediaType) {
+			return true
+		}
+		prefix, ok := strings.CutSuffix(a, "/*")
+		if ok && len(mediaType) > len(prefix) && mediaType[len(prefix)] == '/' && strings.EqualFold(prefix, mediaType[:len(prefix)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitReader fails with ErrTooLarge once more than n bytes pass.
+type limitReader struct {
+	io.ReadCloser
+	n int64 // remaining, or negative once exceeded
+}
+
+// Read implements the io.Reader interface.
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.n < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1] // one extra byte detects excess
+	}
+	n, err := r.ReadCloser.Read(p)
+	if int64(n) > r.n {
+		n, r.n = int(r.n), -1
+		return n, ErrTooLarge
+	}
+	r.n -= int64(n)
+	return n, err
+}
+
+// Version binds version parameters to a resolver.
+type version struct {
+	backend.VersionResolver
+	id   string
+	time time.Time
+}
+
+// Resolve implements the backend.Resolver interface.
+func (v version) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return v.ResolveVersion(ctx, did, v.id, v.time)
+}
+
+// SelectFragment returns the verification method or the service with name.
+func selectFragment(doc *backend.Document, name string) (*backend.VerificationMethod, *backend.Service) {
+	want := &backend.URL{DID: doc.Subject}
+	want.SetFragment(name)
+
+	for _, m := range doc.Methods() {
+		id := m.ID
+		if id.IsRelative() {
+			id.DID = doc.Subject
+		}
+		if id.Equal(want) {
+			return m, nil
+		}
+	}
+	return nil, doc.Service(name)
+}
+
+type hashlinkReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	want []byte
+}
+
+// Read implements the io.Reader interface. The io.EOF becomes ErrHashlink on
+// mismatch.
+func (r *hashlinkReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(r.hash.Sum(nil), r.want) {
+		return n, ErrHashlink
+	}
+	return n, err
+}
@@ -0,0 +1,212 @@
+package dereference
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+)
+
+const testDoc = `{
+	"id": "did:example:123",
+	"verificationMethod": [{
+		"id": "did:example:123#key-1",
+		"type": "Multikey",
+		"controller": "did:example:123",
+		"publicKeyMultibase": "z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7V"
+	}],
+	"authentication": [{
+		"id": "#key-2",
+		"type": "Multikey",
+		"controller": "did:example:123",
+		"publicKeyMultibase": "z6MkgoLTnTypo3tDRwCkZXSccTPHRLhF4ZnjhueYAFpEX6vg"
+	}],
+	"service": [{"id": "#agent", "type": "DIDCommMessaging", "serviceEndpoint": "https://agent.example.com/"}]
+}`
+
+// VersionedResolver has version "1" only.
+type versionedResolver struct{}
+
+func (versionedResolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return versionedResolver{}.ResolveVersion(ctx, did, "", time.Time{})
+}
+
+func (versionedResolver) ResolveVersion(_ context.Context, did backend.DID, versionID string, versionTime time.Time) (*backend.Document, *backend.Meta, error) {
+	if did.String() != "did:example:123" || (versionID != "" && versionID != "1") || !versionTime.IsZero() {
+		return nil, nil, backend.ErrNotFound
+	}
+	doc := new(backend.Document)
+	if err := json.Unmarshal([]byte(testDoc), doc); err != nil {
+		return nil, nil, err
+	}
+	return doc, &backend.Meta{NextVersionID: "2"}, nil
+}
+
+func TestDereference(t *testing.T) {
+	resource := "resource content"
+	sum := sha256.Sum256([]byte(resource))
+	hl := didkey.EncodeMultibase(append([]byte{0x12, 0x20}, sum[:]...))
+
+	d := &Dereferencer{
+		Resolver: versionedResolver{},
+		Resources: func(_ context.Context, u *backend.URL, _ *backend.Document) (io.ReadCloser, error) {
+			if u.RawPath != "/docs/readme" {
+				return nil, backend.ErrNotFound
+			}
+			return io.NopCloser(strings.NewReader(resource)), nil
+		},
+	}
+	ctx := context.Background()
+
+	r, err := d.Dereference(ctx, "did:example:123")
+	if err != nil || r.Document == nil || r.Method != nil || r.Meta.NextVersionID != "2" || r.Resolution == nil {
+		t.Errorf("document got %+v, error %v", r, err)
+	}
+	r, err = d.Dereference(ctx, "did:example:123?versionId=1#key-1")
+	if err != nil || r.Method == nil || r.Method.ID.String() != "did:example:123#key-1" {
+		t.Errorf("method got %+v, error %v", r, err)
+	}
+	r, err = d.Dereference(ctx, "did:example:123#key-2")
+	if err != nil || r.Method == nil || r.Method.Type != "Multikey" {
+		t.Errorf("embedded method got %+v, error %v", r, err)
+	}
+	r, err = d.Dereference(ctx, "did:example:123#agent")
+	if err != nil || r.Service == nil {
+		t.Errorf("service got %+v, error %v", r, err)
+	}
+	r, err = d.Dereference(ctx, "did:example:123?service=agent&relativeRef=/inbox#x")
+	if err != nil || r.Endpoint == nil || r.Endpoint.String() != "https://agent.example.com/inbox#x" {
+		t.Errorf("service endpoint got %+v, error %v", r, err)
+	}
+
+	r, err = d.Dereference(ctx, "did:example:123/docs/readme?hl="+hl)
+	if err != nil {
+		t.Fatal("resource error:", err)
+	}
+	got, err := io.ReadAll(r.Resource)
+	if err != nil || string(got) != resource {
+		t.Errorf("resource got %q, error %v", got, err)
+	}
+	other := sha256.Sum256([]byte("other"))
+	r, err = d.Dereference(ctx, "did:example:123/docs/readme?hl="+didkey.EncodeMultibase(append([]byte{0x12, 0x20}, other[:]...)))
+	if err != nil {
+		t.Fatal("resource error:", err)
+	}
+	if _, err := io.ReadAll(r.Resource); !errors.Is(err, ErrHashlink) {
+		t.Errorf("resource with other hashlink got error %v, want ErrHashlink", err)
+	}
+
+	notFound := []string{
+		"did:example:456",
+		"did:example:123?versionId=2",
+		"did:example:123#key-3",
+		"did:example:123?service=none",
+		"did:example:123/other",
+	}
+	for _, s := range notFound {
+		if _, err := d.Dereference(ctx, s); !errors.Is(err, backend.ErrNotFound) {
+			t.Errorf("%q got error %v, want ErrNotFound", s, err)
+		}
+	}
+	invalid := []string{
+		"did:example",
+		"#key-1",
+		"did:example:123?versionId=1&versionId=2",
+		"did:example:123?hl=" + hl,
+		"did:example:123/docs/readme?hl=zzz",
+	}
+	for _, s := range invalid {
+		if _, err := d.Dereference(ctx, s); !errors.Is(err, backend.ErrInvalid) {
+			t.Errorf("%q got error %v, want ErrInvalid", s, err)
+		}
+	}
+}
+
+// EndpointResolver is a versionedResolver with the service endpoint replaced.
+type endpointResolver struct{ endpoint string }
+
+func (r endpointResolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, meta, err := versionedResolver{}.Resolve(ctx, did)
+	if err == nil {
+		doc.Services[0].Endpoint.URIRefs[0], err = url.Parse(r.endpoint)
+	}
+	return doc, meta, err
+}
+
+func TestFetch(t *testing.T) {
+	const content = `{"hello":"world"}`
+	sum := sha256.Sum256([]byte(content))
+	hl := didkey.EncodeMultibase(append([]byte{0x12, 0x20}, sum[:]...))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hello.json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			io.WriteString(w, content)
+		case "/hello.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, content)
+		case "/stream":
+			// no Content-Length
+			w.Header().Set("Content-Type", "application/json")
+			w.(http.Flusher).Flush()
+			io.WriteString(w, content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	d := &Dereferencer{
+		Resolver:   endpointResolver{srv.URL + "/"},
+		HTTP:       srv.Client(),
+		MediaTypes: []string{"application/json", "image/*"},
+	}
+	ctx := context.Background()
+
+	r, err := d.Dereference(ctx, "did:example:123?service=agent&relativeRef=/hello.json&hl="+hl)
+	if err != nil {
+		t.Fatal("fetch error:", err)
+	}
+	got, err := io.ReadAll(r.Resource)
+	r.Resource.Close()
+	if err != nil || string(got) != content || r.MediaType != "application/json" || r.Endpoint == nil {
+		t.Errorf("fetch got %q, media type %q, endpoint %v, error %v", got, r.MediaType, r.Endpoint, err)
+	}
+
+	r, err = d.Dereference(ctx, "did:example:123?service=agent")
+	if err != nil || r.Resource != nil || r.Endpoint == nil {
+		t.Errorf("service without relativeRef got %+v, error %v", r, err)
+	}
+
+	if _, err := d.Dereference(ctx, "did:example:123?service=agent&relativeRef=/hello.txt"); !errors.Is(err, backend.ErrMediaType) {
+		t.Errorf("fetch of text got error %v, want ErrMediaType", err)
+	}
+	if _, err := d.Dereference(ctx, "did:example:123?service=agent&relativeRef=/none"); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("fetch of missing got error %v, want ErrNotFound", err)
+	}
+
+	d.ResourceMax = int64(len(content) - 1)
+	if _, err := d.Dereference(ctx, "did:example:123?service=agent&relativeRef=/hello.json"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("fetch with Content-Length beyond limit got error %v, want ErrTooLarge", err)
+	}
+	r, err = d.Dereference(ctx, "did:example:123?service=agent&relativeRef=/stream")
+	if err != nil {
+		t.Fatal("stream error:", err)
+	}
+	got, err = io.ReadAll(r.Resource)
+	r.Resource.Close()
+	if !errors.Is(err, ErrTooLarge) || len(got) != len(content)-1 {
+		t.Errorf("stream beyond limit got %d bytes, error %v, want %d bytes and ErrTooLarge", len(got), err, len(content)-1)
+	}
+}
@@ -1,9 +1,13 @@
 package backend
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 const prefix = "did:" //URI scheme selection
@@ -37,10 +41,11 @@ func (e *SyntaxError) Error() string {
 	case e.S == "":
 		return "empty DID string"
 	case e.I < 0:
-		desc = "reason unkown" //should not happen
+		desc = "reason unknown" // should not happen
 	case e.I >= len(e.S):
-		desc = "end imcompltet"
+		desc = "end incomplete"
 	case e.S[e.I] == ':' && strings.IndexAny(e.S, ":/?#") >= e.I:
+		desc = `no "did:" scheme`
 	default:
 		desc = fmt.Sprintf("illegal %q at byte № %d", e.S[e.I], e.I+1)
 	}
@@ -48,7 +53,7 @@ func (e *SyntaxError) Error() string {
 	if len(e.S) <= 200 {
 		return fmt.Sprintf("invalid DID %q: %s", e.S, desc)
 	}
-	return fmt.Sprintf("invalid DID %q [truncated]: %s", e.S[:199]+"...", desc)
+	return fmt.Sprintf("invalid DID %q [truncated]: %s", e.S[:199]+"…", desc)
 }
 
 // Parse validates s in full. It returns the mapping if, and only if s conforms
@@ -151,6 +156,107 @@ NoEscapes:
 	return DID{Method: method, SpecID: b.String()}, nil
 }
 
+// MustParse is like Parse, but it panics on error. It simplifies the safe
+// initialization of global variables, and tests.
+func MustParse(s string) DID {
+	d, err := Parse(s)
+	if err != nil {
+		panic("backend: MustParse(" + strconv.Quote(s) + "): " + err.Error())
+	}
+	return d
+}
+
+// Valid returns whether s conforms to the DID syntax specification, which is
+// equivalent to Parse without error. The check does not allocate.
+func Valid(s string) bool {
+	if len(s) < len(prefix) || s[:len(prefix)] != prefix {
+		return false
+	}
+
+	// method name
+	i := len(prefix)
+	for ; i < len(s) && s[i] != ':'; i++ {
+		switch s[i] {
+		// match method-char BNF
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', // DIGIT
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', // %x61-7A
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z': // %x61-7A
+			continue // pass
+		default:
+			return false
+		}
+	}
+	if i == len(prefix) || i >= len(s)-1 {
+		return false // no method name, or no method-specific identifier
+	}
+
+	// method-specific identifier
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case ':': // method-specific-id must match: *( *idchar ":" ) 1*idchar
+			if i == len(s)-1 {
+				return false
+			}
+		// match idchar BNF excluding pct-encoded
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', // DIGIT
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', // ALPHA
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', // ALPHA
+			'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', // ALPHA
+			'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', // ALPHA
+			'.', '-', '_': // idchar
+			continue // pass
+		// match pct-encoded BNF
+		case '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return false
+			}
+			i += 2
+		default:
+			return false // illegal character
+		}
+	}
+	return true
+}
+
+// IsHex returns whether c is a hexadecimal digit, in either case.
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// MethodSyntax checks the method-specific identifier of a DID method, beyond
+// the generic DID syntax.
+type MethodSyntax func(specID string) error
+
+var (
+	syntaxesMutex sync.RWMutex
+	syntaxes      = make(map[string]MethodSyntax) // by method name
+)
+
+// RegisterMethodSyntax installs s for the DIDs of method. Any previous
+// registration is replaced. Packages of DID methods may register on init.
+func RegisterMethodSyntax(method string, s MethodSyntax) {
+	syntaxesMutex.Lock()
+	defer syntaxesMutex.Unlock()
+	syntaxes[method] = s
+}
+
+// ValidateMethodSyntax applies the MethodSyntax registered for the method of
+// did, if any. DIDs of methods without registration pass. Errors wrap
+// ErrInvalid.
+func ValidateMethodSyntax(did DID) error {
+	syntaxesMutex.RLock()
+	s, ok := syntaxes[did.Method]
+	syntaxesMutex.RUnlock()
+	if !ok {
+		return nil
+	}
+	err := s(did.SpecID)
+	if err == nil || errors.Is(err, ErrInvalid) {
+		return err
+	}
+	return fmt.Errorf("%w: did:%s method-specific identifier: %w", ErrInvalid, did.Method, err)
+}
+
 func readMethodName(s string) (string, error) {
 	for i := len(prefix); i < len(s); i++ {
 		switch s[i] {
@@ -225,6 +331,8 @@ func (d DID) EqualString(s string) bool {
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
 			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm',
 			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z',
+			'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M',
+			'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z',
 			'.', '-', '_':
 			if s[i] != c {
 				return false
@@ -313,6 +421,75 @@ func (d DID) String() string {
 	return b.String()
 }
 
+// Append appends the String of d to dst, and it returns the extended buffer.
+func (d DID) Append(dst []byte) []byte {
+	if d.Method == "" && d.SpecID == "" {
+		return dst
+	}
+	dst = append(dst, prefix...)
+	dst = append(dst, d.Method...)
+	dst = append(dst, ':')
+
+	for i := 0; i < len(d.SpecID); i++ {
+		switch c := d.SpecID[i]; c {
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm',
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z',
+			'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M',
+			'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z',
+			'.', '-', '_':
+			dst = append(dst, c)
+
+		default:
+			dst = append(dst, '%', hexTable[c>>4], hexTable[c&15])
+		}
+	}
+	return dst
+}
+
+// Canonical returns the normalized form of d, with the method in lowercase,
+// and with percent-encoding where required only, in uppercase hex digits.
+// Unlike String, colon characters (':') stay as is, except for the last one.
+// DIDs which are Equal have the same canonical form, which makes it suitable
+// for map keys and database identifiers. The return is invalid if any of the
+// attributes (Method or SpecID) are invalid.
+func (d DID) Canonical() string {
+	if d.Method == "" && d.SpecID == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.Grow(len(prefix) + len(d.Method) + 1 + len(d.SpecID))
+	b.WriteString(prefix)
+	b.WriteString(strings.ToLower(d.Method))
+	b.WriteByte(':')
+
+	for i := 0; i < len(d.SpecID); i++ {
+		switch c := d.SpecID[i]; c {
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm',
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z',
+			'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M',
+			'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z',
+			'.', '-', '_':
+			b.WriteByte(c)
+
+		case ':':
+			// colon not allowed as last character
+			if i < len(d.SpecID)-1 {
+				b.WriteByte(c)
+				break
+			}
+			fallthrough
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexTable[c>>4])
+			b.WriteByte(hexTable[c&15])
+		}
+	}
+	return b.String()
+}
+
 // MarshalJSON implements the json.Marshaler interface.
 func (d DID) MarshalJSON() ([]byte, error) {
 	return json.Marshal(d.String())
@@ -325,6 +502,10 @@ func (d *DID) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
+	if s == "" {
+		*d = DID{} // as encoded by MarshalJSON
+		return nil
+	}
 
 	p, err := Parse(s)
 	if err != nil {
@@ -333,3 +514,95 @@ func (d *DID) UnmarshalJSON(bytes []byte) error {
 	*d = p // copy
 	return nil
 }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d DID) MarshalText() ([]byte, error) {
+	return d.Append(nil), nil
+}
+
+// AppendText implements the encoding.TextAppender interface.
+func (d DID) AppendText(dst []byte) ([]byte, error) {
+	return d.Append(dst), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *DID) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = DID{} // as encoded by MarshalText
+		return nil
+	}
+	p, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*d = p // copy
+	return nil
+}
+
+// Value implements the driver.Valuer interface, with the Canonical form, and
+// with NULL for the zero DID.
+func (d DID) Value() (driver.Value, error) {
+	if d.Method == "" && d.SpecID == "" {
+		return nil, nil
+	}
+	return d.Canonical(), nil
+}
+
+// Scan implements the sql.Scanner interface, with the zero DID for NULL.
+func (d *DID) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = DID{}
+		return nil
+	case string:
+		return d.UnmarshalText([]byte(v))
+	case []byte:
+		return d.UnmarshalText(v)
+	default:
+		return fmt.Errorf("DID scan from %T not supported", src)
+	}
+}
+
+// The binary encoding of a DID is the method name, followed by a colon (':'),
+// followed by the method-specific identifier as is, i.e., without percent-
+// encoding. The zero DID encodes as an empty sequence.
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (d DID) MarshalBinary() ([]byte, error) {
+	return d.AppendBinary(nil)
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (d DID) AppendBinary(dst []byte) ([]byte, error) {
+	if d.Method == "" && d.SpecID == "" {
+		return dst, nil
+	}
+	dst = append(dst, d.Method...)
+	dst = append(dst, ':')
+	return append(dst, d.SpecID...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (d *DID) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		*d = DID{}
+		return nil
+	}
+	for i, c := range data {
+		switch c {
+		// match method-char BNF
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', // DIGIT
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', // %x61-7A
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z': // %x61-7A
+			continue // pass
+		case ':':
+			if i == 0 || i == len(data)-1 {
+				return fmt.Errorf("binary DID %q without method name or method-specific identifier", data)
+			}
+			*d = DID{Method: string(data[:i]), SpecID: string(data[i+1:])}
+			return nil
+		}
+		return fmt.Errorf("binary DID %q has illegal %q in method name", data, c)
+	}
+	return fmt.Errorf("binary DID %q without method separator", data)
+}
@@ -1,6 +1,10 @@
 package backend
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/url"
 	"reflect"
@@ -59,6 +63,9 @@ var GoldenDIDs = []struct {
 	{
 		"did:foo:bar",
 		DID{Method: "foo", SpecID: "bar"},
+	}, {
+		"did:key:z6MkFoo",
+		DID{Method: "key", SpecID: "z6MkFoo"},
 	}, {
 		"did:foo:b%61r",
 		DID{Method: "foo", SpecID: "bar"},
@@ -735,3 +742,434 @@ func FuzzParseURL(f *testing.F) {
 		}
 	})
 }
+
+func ExampleURL_SetHashlink() {
+	u, _ := ParseURL("did:example:123/hello?hl=outdated&versionId=1")
+	u.SetHashlink([]byte("Hello World!"))
+	fmt.Println(u)
+	// Output: did:example:123/hello?hl=zQmWvQxTqbG2Z9HPJgG57jjwR154cKhbtJenbyYTWkjgF3e&versionId=1
+}
+
+func TestURLHashlink(t *testing.T) {
+	content := []byte("Hello World!")
+	var u URL
+	u.SetHashlink(content)
+	hl, err := u.Hashlink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hl.Verify(content); err != nil {
+		t.Error("verify got error:", err)
+	}
+	if err := hl.Verify([]byte("Hello World?")); err != ErrHashlink {
+		t.Errorf("verify of other content got error %v, want ErrHashlink", err)
+	}
+	if got, err := ParseHashlink(hl.String()); err != nil || !reflect.DeepEqual(got, hl) {
+		t.Errorf("parse of %q got %+v, error %v", hl, got, err)
+	}
+
+	if hl, err := (&URL{RawQuery: "?versionId=1"}).Hashlink(); hl != nil || err != nil {
+		t.Errorf("without hl parameter got %v, error %v", hl, err)
+	}
+	for _, query := range []string{
+		"?hl=zQmWvQxTqbG2Z9HPJgG57jjwR154cKhbtJenbyYTWkjgF3e&hl=zQmWvQxTqbG2Z9HPJgG57jjwR154cKhbtJenbyYTWkjgF3e",
+		"?hl=zzz",
+		"?hl=z2DrjgbF2bT8Mr", // identity multihash
+		"?hl=f1210aabb",      // short digest
+	} {
+		if hl, err := (&URL{RawQuery: query}).Hashlink(); err == nil {
+			t.Errorf("%q got %v, want error", query, hl)
+		}
+	}
+}
+
+func TestURLParams(t *testing.T) {
+	u, err := ParseURL("did:example:123?foo=bar&service=files&x%3Dy=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := u.Service(); s != "files" || err != nil {
+		t.Errorf("service got %q, error %v", s, err)
+	}
+	if ref, err := u.RelativeRef(); ref != nil || err != nil {
+		t.Errorf("relativeRef got %v, error %v", ref, err)
+	}
+
+	u.SetService("agent")
+	if err := u.SetRelativeRef(&url.URL{Path: "/inbox", RawQuery: "a=b&c"}); err != nil {
+		t.Fatal("set relativeRef error:", err)
+	}
+	u.SetTransformKeys("JsonWebKey")
+	const want = "did:example:123?foo=bar&service=agent&x%3Dy=1&relativeRef=/inbox?a%3Db%26c&transformKeys=JsonWebKey"
+	if got := u.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if ref, err := u.RelativeRef(); err != nil || ref.String() != "/inbox?a=b&c" {
+		t.Errorf("relativeRef got %v, error %v", ref, err)
+	}
+	if s, err := u.TransformKeys(); s != "JsonWebKey" || err != nil {
+		t.Errorf("transformKeys got %q, error %v", s, err)
+	}
+
+	if err := u.SetRelativeRef(&url.URL{Scheme: "https", Host: "example.com"}); err == nil {
+		t.Error("absolute relativeRef got no error")
+	}
+	u.SetRelativeRef(nil)
+	u.SetService("")
+	u.SetTransformKeys("")
+	if got := u.String(); got != "did:example:123?foo=bar&x%3Dy=1" {
+		t.Errorf("got %s after clear, want the unknown parameters only", got)
+	}
+
+	for _, query := range []string{"?service=a&service=b", "?relativeRef=/x", "?service=a&relativeRef=https://example.com/"} {
+		if ref, err := (&URL{RawQuery: query}).RelativeRef(); err == nil {
+			t.Errorf("%q got relativeRef %v, want error", query, ref)
+		}
+	}
+	if s, err := (&URL{RawQuery: "?transformKeys=a&transformKeys=b"}).TransformKeys(); err == nil {
+		t.Errorf("duplicate transformKeys got %q, want error", s)
+	}
+}
+
+func TestURLQueryValues(t *testing.T) {
+	u := URL{RawQuery: "?b=2&a=x+y%2b&flag&&b=%e2%9c%a8&hl=zQm&c=1%201"}
+	got, err := u.QueryValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the plus is literal, and not a space
+	want := url.Values{"a": {"x+y+"}, "b": {"2", "✨"}, "c": {"1 1"}, "flag": {""}, "hl": {"zQm"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	u.SetQueryValues(got)
+	const wantQuery = "?a=x%2By%2B&b=2&b=%E2%9C%A8&c=1%201&flag=&hl=zQm"
+	if u.RawQuery != wantQuery {
+		t.Errorf("set got raw query %q, want %q", u.RawQuery, wantQuery)
+	}
+	if again, err := u.QueryValues(); err != nil || !reflect.DeepEqual(again, want) {
+		t.Errorf("round trip got %q, error %v", again, err)
+	}
+	u.SetQueryValues(nil)
+	if u.RawQuery != "" {
+		t.Errorf("set of nil got raw query %q, want none", u.RawQuery)
+	}
+
+	for _, raw := range []string{
+		"?a=%zz",
+		"?a=%4",
+		"?=value",
+		"?versionId=1&versionId=2",
+		"?service=a&x=y&service=b",
+		"no-question-mark",
+	} {
+		if got, err := (&URL{RawQuery: raw}).QueryValues(); err == nil {
+			t.Errorf("%q got %q, want error", raw, got)
+		}
+	}
+}
+
+func TestDIDCanonical(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"did:example:123", "did:example:123"},
+		{"did:web:example.com%3A8443:user", "did:web:example.com:8443:user"},
+		{"did:a:%3Ac", "did:a::c"},
+		{"did:x:%3A", "did:x:%3A"},
+		{"did:xx::%3A", "did:xx::%3A"},
+		{"did:tricky:%3A%66%6F%6F%2f", "did:tricky::foo%2F"},
+	}
+	for _, test := range tests {
+		d, err := Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Canonical(); got != test.want {
+			t.Errorf("%s got canonical %s, want %s", test.in, got, test.want)
+		}
+	}
+
+	for _, gold := range GoldenDIDs {
+		s := gold.DID.Canonical()
+		d, err := Parse(s)
+		if err != nil || d != gold.DID || !Equal(s, gold.S) {
+			t.Errorf("%s canonical %s got %#v, error %v", gold.S, s, d, err)
+		}
+	}
+	if got := (DID{Method: "EXAMPLE", SpecID: "a"}).Canonical(); got != "did:example:a" {
+		t.Errorf("uppercase method got canonical %s", got)
+	}
+}
+
+func TestURLCanonical(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"did:example:123", "did:example:123"},
+		{"did:example:123/a/./b/../c", "did:example:123/a/c"},
+		{"did:example:123/a/b/..", "did:example:123/a/"},
+		{"did:example:123/../a//b/.", "did:example:123/a//b/"},
+		{"did:example:123/%7euser/%2e%2E/x%2fy", "did:example:123/x%2Fy"},
+		{"did:example:123?service=files&relativeRef=%2fa%20b", "did:example:123?service=files&relativeRef=%2Fa%20b"},
+		{"did:example:123?%41=%7E#%6bey-1%3f", "did:example:123?A=~#key-1%3F"},
+		{"did:example:a%3Ab/x", "did:example:a:b/x"},
+		{"#%6bey-1", "#key-1"},
+		{"../a/./b", "../a/./b"},
+	}
+	for _, test := range tests {
+		u, err := ParseURL(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := u.Canonical()
+		if got != test.want {
+			t.Errorf("%s got canonical %s, want %s", test.in, got, test.want)
+		}
+		again, err := ParseURL(got)
+		if err != nil {
+			t.Errorf("%s canonical %s parse error: %s", test.in, got, err)
+		} else if again.Canonical() != got {
+			t.Errorf("%s canonical %s not idempotent: %s", test.in, got, again.Canonical())
+		}
+	}
+}
+
+func TestDIDText(t *testing.T) {
+	type record struct {
+		XMLName xml.Name `xml:"record"`
+		Subject DID      `xml:"subject,attr"`
+		Ref     *URL     `xml:"ref"`
+	}
+	in := record{
+		Subject: DID{Method: "web", SpecID: "example.com:user"},
+		Ref:     &URL{DID: DID{Method: "example", SpecID: "123"}, RawPath: "/a", RawFragment: "#key-1"},
+	}
+	b, err := xml.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `<record subject="did:web:example.com%3Auser"><ref>did:example:123/a#key-1</ref></record>`
+	if string(b) != want {
+		t.Errorf("XML got %s, want %s", b, want)
+	}
+	var out record
+	if err := xml.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Subject != in.Subject || *out.Ref != *in.Ref {
+		t.Errorf("XML round trip got %+v, want %+v", out, in)
+	}
+	if err := xml.Unmarshal([]byte(`<record subject="did:X:1"></record>`), &out); err == nil {
+		t.Error("XML with invalid DID got no error")
+	}
+
+	// map keys
+	b, err = json.Marshal(map[DID]int{in.Subject: 1})
+	if err != nil || string(b) != `{"did:web:example.com%3Auser":1}` {
+		t.Errorf("JSON map got %s, error %v", b, err)
+	}
+}
+
+func TestDIDSQL(t *testing.T) {
+	d := DID{Method: "web", SpecID: "example.com:user"}
+	v, err := d.Value()
+	if err != nil || v != "did:web:example.com:user" {
+		t.Errorf("value got %v, error %v", v, err)
+	}
+	if v, err := (DID{}).Value(); v != nil || err != nil {
+		t.Errorf("zero value got %v, error %v", v, err)
+	}
+
+	var got DID
+	for _, src := range []any{"did:web:example.com:user", []byte("did:web:example.com%3Auser")} {
+		if err := got.Scan(src); err != nil || got != d {
+			t.Errorf("scan %q got %#v, error %v", src, got, err)
+		}
+	}
+	if err := got.Scan(nil); err != nil || got != (DID{}) {
+		t.Errorf("scan NULL got %#v, error %v", got, err)
+	}
+	if err := got.Scan(42); err == nil {
+		t.Error("scan of int got no error")
+	}
+
+	u := &URL{DID: d, RawPath: "/%7ea", RawQuery: "?versionId=1"}
+	v, err = u.Value()
+	if err != nil || v != "did:web:example.com:user/~a?versionId=1" {
+		t.Errorf("URL value got %v, error %v", v, err)
+	}
+	var gotURL URL
+	if err := gotURL.Scan(v); err != nil || !gotURL.Equal(u) {
+		t.Errorf("URL scan got %#v, error %v", gotURL, err)
+	}
+	if err := gotURL.Scan(nil); err != nil || gotURL != (URL{}) {
+		t.Errorf("URL scan NULL got %#v, error %v", gotURL, err)
+	}
+	if v, err := gotURL.Value(); v != nil || err != nil {
+		t.Errorf("zero URL value got %v, error %v", v, err)
+	}
+
+	// as database/sql converts arguments
+	if v, err := driver.DefaultParameterConverter.ConvertValue(*u); err != nil || v != "did:web:example.com:user/~a?versionId=1" {
+		t.Errorf("URL argument got %v, error %v", v, err)
+	}
+	if v, err := driver.DefaultParameterConverter.ConvertValue((*URL)(nil)); v != nil || err != nil {
+		t.Errorf("nil URL argument got %v, error %v", v, err)
+	}
+}
+
+func TestDIDAppend(t *testing.T) {
+	for _, gold := range GoldenDIDs {
+		buf := []byte("prefix ")
+		got := gold.DID.Append(buf)
+		if want := "prefix " + gold.DID.String(); string(got) != want {
+			t.Errorf("%s appended %q, want %q", gold.S, got, want)
+		}
+	}
+
+	d := DID{Method: "example", SpecID: "a:b/c"}
+	u := &URL{DID: d, RawPath: "/x", RawQuery: "?versionId=1", RawFragment: "#key-1"}
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = d.Append(buf[:0])
+		buf = u.Append(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("append got %v allocations, want none", allocs)
+	}
+	if string(buf) != u.String() {
+		t.Errorf("URL appended %q, want %q", buf, u.String())
+	}
+
+	// beyond the stack buffer of string conversion
+	escaped := DID{Method: "example", SpecID: "users:alice/keys:2024/primary"}
+	var s string
+	allocs = testing.AllocsPerRun(100, func() { s = escaped.String() })
+	if allocs != 1 {
+		t.Errorf("String of escaped %#v got %v allocations, want 1", escaped, allocs)
+	}
+	if s != string(escaped.Append(nil)) {
+		t.Errorf("String got %q, want Append %q", s, escaped.Append(nil))
+	}
+}
+
+func TestDIDBinary(t *testing.T) {
+	for _, gold := range GoldenDIDs {
+		b, err := gold.DID.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got DID
+		if err := got.UnmarshalBinary(b); err != nil || got != gold.DID {
+			t.Errorf("%s binary %q got %#v, error %v", gold.S, b, got, err)
+		}
+	}
+	for _, bad := range []string{"example", ":a", "example:", "Example:a", "ex-ample:a"} {
+		var d DID
+		if err := d.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("binary %q got %#v, want error", bad, d)
+		}
+	}
+
+	for _, s := range []string{
+		"did:example:a%3Ab%2F/x%2Fy?versionId=1#key-1",
+		"did:example:123",
+		"#key-1",
+		"../a?b",
+	} {
+		u, err := ParseURL(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := u.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got URL
+		if err := got.UnmarshalBinary(b); err != nil || got != *u {
+			t.Errorf("%s binary %q got %#v, error %v", s, b, got, err)
+		}
+	}
+	var zero URL
+	if b, _ := zero.MarshalBinary(); zero.UnmarshalBinary(b) != nil || zero != (URL{}) {
+		t.Errorf("zero URL binary %q round trip got %#v", b, zero)
+	}
+	for _, bad := range []string{"", "\x80", "\x09example:", "\x09example:a/%zz"} {
+		var u URL
+		if err := u.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("binary %q got %#v, want error", bad, u)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, gold := range GoldenDIDs {
+		if !Valid(gold.S) {
+			t.Errorf("%s not valid", gold.S)
+		}
+	}
+	for _, gold := range GoldenDIDErrors {
+		if Valid(gold.DID) {
+			t.Errorf("%s valid, want %s", gold.DID, gold.Err)
+		}
+	}
+	for _, s := range []string{"did:a:b/c", "did:a:b?c", "did:a:b#c", "did:a:%ZZ", "DID:a:b"} {
+		if Valid(s) {
+			t.Errorf("%s valid", s)
+		}
+	}
+	if allocs := testing.AllocsPerRun(100, func() { Valid("did:foo:%3A:bar") }); allocs != 0 {
+		t.Errorf("got %v allocations, want none", allocs)
+	}
+}
+
+// FuzzValid compares Valid with Parse.
+func FuzzValid(f *testing.F) {
+	for _, gold := range GoldenDIDs {
+		f.Add(gold.S)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		_, err := Parse(s)
+		if got := Valid(s); got != (err == nil) {
+			t.Errorf("%q got valid %t, with parse error %v", s, got, err)
+		}
+	})
+}
+
+func TestMustParse(t *testing.T) {
+	if d := MustParse("did:example:123"); d != (DID{Method: "example", SpecID: "123"}) {
+		t.Errorf("got %#v", d)
+	}
+	if u := MustParseURL("did:example:123#key-1"); u.RawFragment != "#key-1" {
+		t.Errorf("got %#v", u)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), `MustParse("did:X:1")`) {
+			t.Errorf("got panic %v", r)
+		}
+	}()
+	MustParse("did:X:1")
+}
+
+func TestValidateMethodSyntax(t *testing.T) {
+	RegisterMethodSyntax("syntaxtest", func(specID string) error {
+		if !strings.HasPrefix(specID, "0x") {
+			return fmt.Errorf("%q without hex prefix", specID)
+		}
+		return nil
+	})
+	defer func() {
+		syntaxesMutex.Lock()
+		delete(syntaxes, "syntaxtest")
+		syntaxesMutex.Unlock()
+	}()
+
+	if err := ValidateMethodSyntax(MustParse("did:syntaxtest:0x12")); err != nil {
+		t.Error("valid identifier got error:", err)
+	}
+	if err := ValidateMethodSyntax(MustParse("did:syntaxtest:12")); !errors.Is(err, ErrInvalid) {
+		t.Errorf("invalid identifier got error %v, want ErrInvalid", err)
+	}
+	if err := ValidateMethodSyntax(MustParse("did:unregistered:12")); err != nil {
+		t.Error("unregistered method got error:", err)
+	}
+}
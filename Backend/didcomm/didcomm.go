@@ -0,0 +1,339 @@
+// Package didcomm implements DIDComm Messaging v2, with plaintext messages,
+// signed messages, and anonymous encryption (anoncrypt) with X25519. Keys are
+// found in DID documents, with "authentication" for signatures and with
+// "keyAgreement" for encryption.
+package didcomm
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// Media types of messages
+const (
+	MediaTypePlain     = "application/didcomm-plain+json"
+	MediaTypeSigned    = "application/didcomm-signed+json"
+	MediaTypeEncrypted = "application/didcomm-encrypted+json"
+)
+
+// EnvelopeMax is the size limit for messages received.
+const EnvelopeMax = 4 << 20
+
+// ErrMessage signals a malformed message, or a message in violation of the
+// protocol in use.
+var ErrMessage = errors.New("DIDComm message invalid")
+
+// Message is a plaintext message.
+type Message struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"` // message type URI
+	From           string          `json:"from,omitempty"`
+	To             []string        `json:"to,omitempty"`
+	ThreadID       string          `json:"thid,omitempty"`
+	ParentThreadID string          `json:"pthid,omitempty"`
+	CreatedTime    int64           `json:"created_time,omitempty"` // Unix time
+	ExpiresTime    int64           `json:"expires_time,omitempty"` // Unix time
+	Body           json.RawMessage `json:"body"`
+	Attachments    []Attachment    `json:"attachments,omitempty"`
+
+	// ReturnRoute "all" requests replies on the same transport.
+	ReturnRoute string `json:"return_route,omitempty"`
+}
+
+// Attachment is embedded content, or content by reference.
+type Attachment struct {
+	ID        string         `json:"id,omitempty"`
+	MediaType string         `json:"media_type,omitempty"`
+	Format    string         `json:"format,omitempty"`
+	Data      AttachmentData `json:"data"`
+}
+
+// AttachmentData has either one of its fields set.
+type AttachmentData struct {
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Base64 string          `json:"base64,omitempty"`
+	Links  []string        `json:"links,omitempty"`
+	Hash   string          `json:"hash,omitempty"`
+}
+
+// Content returns the embedded data. Links are not followed.
+func (a *Attachment) Content() ([]byte, error) {
+	switch {
+	case a.Data.JSON != nil:
+		return a.Data.JSON, nil
+	case a.Data.Base64 != "":
+		// base64url per specification, with or without padding
+		s := strings.TrimRight(a.Data.Base64, "=")
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.RawStdEncoding.DecodeString(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: attachment %q base64: %w", ErrMessage, a.ID, err)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%w: attachment %q has no embedded data", ErrMessage, a.ID)
+}
+
+// NewMessage returns a message with a random ID, and with body encoded.
+func NewMessage(typ string, body any) (*Message, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &Message{ID: id, Type: typ, Body: raw}, nil
+}
+
+// NewID returns a random UUID (version 4).
+func newID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// Reply returns a message in the thread of m.
+func (m *Message) Reply(typ string, body any) (*Message, error) {
+	r, err := NewMessage(typ, body)
+	if err != nil {
+		return nil, err
+	}
+	r.ThreadID = m.ThreadID
+	if r.ThreadID == "" {
+		r.ThreadID = m.ID
+	}
+	if m.From != "" {
+		r.To = []string{m.From}
+	}
+	return r, nil
+}
+
+// ParseMessage decodes a plaintext message.
+func ParseMessage(plaintext []byte) (*Message, error) {
+	m := new(Message)
+	if err := json.Unmarshal(plaintext, m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMessage, err)
+	}
+	if m.ID == "" || m.Type == "" {
+		return nil, fmt.Errorf(`%w: plaintext needs an "id" and a "type"`, ErrMessage)
+	}
+	return m, nil
+}
+
+type jwsSignature struct {
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+	Header    struct {
+		KID string `json:"kid"`
+	} `json:"header"`
+}
+
+// JWS is the General JSON Serialization.
+type jws struct {
+	Payload    string         `json:"payload"`
+	Signatures []jwsSignature `json:"signatures"`
+}
+
+// Sign returns payload as a signed message, in the General JSON Serialization
+// of JWS, with keyID as the authentication method of signer.
+func Sign(payload []byte, keyID *backend.URL, signer crypto.Signer) ([]byte, error) {
+	compact, err := jose.Sign(jose.Header{Kid: keyID.String(), Typ: MediaTypeSigned}, payload, signer)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(compact, ".")
+	sig := jwsSignature{Protected: parts[0], Signature: parts[2]}
+	sig.Header.KID = keyID.String()
+	return json.Marshal(&jws{Payload: parts[1], Signatures: []jwsSignature{sig}})
+}
+
+// Verify returns the payload of a signed message, with the authentication
+// method which signed.
+func Verify(ctx context.Context, envelope []byte, resolver backend.Resolver) (payload []byte, signer *backend.URL, err error) {
+	var in jws
+	if err := json.Unmarshal(envelope, &in); err != nil {
+		return nil, nil, fmt.Errorf("%w: signed message: %w", ErrMessage, err)
+	}
+	if len(in.Signatures) != 1 {
+		return nil, nil, fmt.Errorf("%w: signed message has %d signatures, want 1", ErrMessage, len(in.Signatures))
+	}
+	s := in.Signatures[0]
+	parsed, err := jose.ParseCompact(s.Protected + "." + in.Payload + "." + s.Signature)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: signed message: %w", ErrMessage, err)
+	}
+	kid := parsed.Header.Kid
+	if kid == "" {
+		kid = s.Header.KID
+	} else if s.Header.KID != "" && s.Header.KID != kid {
+		return nil, nil, fmt.Errorf("%w: signed message has kid %q protected, and %q unprotected", ErrMessage, kid, s.Header.KID)
+	}
+	id, err := backend.ParseURL(kid)
+	if err != nil || id.IsRelative() {
+		return nil, nil, fmt.Errorf("%w: signed message kid %q is not a DID URL", ErrMessage, kid)
+	}
+	doc, _, err := resolver.Resolve(ctx, id.DID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DIDComm signer %s: %w", id.DID.String(), err)
+	}
+	m := doc.AuthorizedMethod(doc.Authentication, id)
+	if m == nil {
+		return nil, nil, fmt.Errorf("%w: no authentication method %s in DID document", backend.ErrNotFound, kid)
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := parsed.Verify(pub); err != nil {
+		return nil, nil, fmt.Errorf("DIDComm signature of %s: %w", kid, err)
+	}
+	return parsed.Payload, id, nil
+}
+
+// RecipientKeys returns the X25519 key agreement keys of a DID. Methods with
+// other types of keys are ignored.
+func RecipientKeys(ctx context.Context, resolver backend.Resolver, did backend.DID) ([]Recipient, error) {
+	doc, _, err := resolver.Resolve(ctx, did)
+	if err != nil {
+		return nil, fmt.Errorf("DIDComm recipient %s: %w", did.String(), err)
+	}
+	var recipients []Recipient
+	if doc.KeyAgreement != nil {
+		methods := slices.Clone(doc.KeyAgreement.Methods)
+		for _, ref := range doc.KeyAgreement.URIRefs {
+			id := *ref // copy
+			if id.IsRelative() {
+				id.DID = doc.Subject
+			}
+			if m := doc.AuthorizedMethod(doc.KeyAgreement, &id); m != nil {
+				methods = append(methods, m)
+			}
+		}
+		for _, m := range methods {
+			pub, err := keys.MethodKey(m)
+			if err != nil {
+				continue
+			}
+			if pub, ok := pub.(*ecdh.PublicKey); ok && pub.Curve() == ecdh.X25519() {
+				id := m.ID
+				if id.IsRelative() {
+					id.DID = doc.Subject
+				}
+				recipients = append(recipients, Recipient{KID: id.String(), Key: pub})
+			}
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: DIDComm recipient %s has no X25519 key agreement", jose.ErrKeyType, did.String())
+	}
+	return recipients, nil
+}
+
+// Agent packs and unpacks messages for its DIDs.
+type Agent struct {
+	Resolver backend.Resolver
+
+	// Keys has the key agreement keys by DID URL of their method.
+	Keys map[string]*ecdh.PrivateKey
+
+	// Signer with its authentication method KeyID signs each message
+	// packed. Messages go anonymous with a nil Signer.
+	Signer crypto.Signer
+	KeyID  *backend.URL
+}
+
+// Envelope has the outcome of unpacking.
+type Envelope struct {
+	Recipient string       // key identifier, or zero when not encrypted
+	Signer    *backend.URL // authentication method, or nil when unsigned
+}
+
+// Pack returns m signed when a Signer is set, and encrypted for each X25519
+// key agreement method of to.
+func (a *Agent) Pack(ctx context.Context, m *Message, to backend.DID) ([]byte, error) {
+	recipients, err := RecipientKeys(ctx, a.Resolver, to)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if a.Signer != nil {
+		if m.From == "" || !a.KeyID.DID.EqualString(m.From) {
+			return nil, fmt.Errorf("%w: message from %q signed by %s", ErrMessage, m.From, a.KeyID.String())
+		}
+		payload, err = Sign(payload, a.KeyID, a.Signer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Encrypt(payload, recipients)
+}
+
+func (a *Agent) key(kid string) *ecdh.PrivateKey { return a.Keys[kid] }
+
+// Unpack decrypts and verifies as needed. Plaintext is accepted as is. The
+// "from" of signed messages must match the signer.
+func (a *Agent) Unpack(ctx context.Context, envelope []byte) (*Message, *Envelope, error) {
+	var e Envelope
+	if isEncrypted(envelope) {
+		var err error
+		envelope, e.Recipient, err = Decrypt(envelope, a.key)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if isSigned(envelope) {
+		var err error
+		envelope, e.Signer, err = Verify(ctx, envelope, a.Resolver)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	m, err := ParseMessage(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.Signer != nil && !e.Signer.DID.EqualString(m.From) {
+		return nil, nil, fmt.Errorf("%w: message from %q signed by %s", ErrMessage, m.From, e.Signer.String())
+	}
+	return m, &e, nil
+}
+
+// IsEncrypted returns whether the JSON object has a "ciphertext".
+func isEncrypted(envelope []byte) bool {
+	var probe struct {
+		Ciphertext *string `json:"ciphertext"`
+	}
+	return json.Unmarshal(envelope, &probe) == nil && probe.Ciphertext != nil
+}
+
+// IsSigned returns whether the JSON object has "signatures".
+func isSigned(envelope []byte) bool {
+	var probe struct {
+		Signatures json.RawMessage `json:"signatures"`
+	}
+	return json.Unmarshal(envelope, &probe) == nil && len(bytes.TrimSpace(probe.Signatures)) != 0
+}
@@ -0,0 +1,500 @@
+package didcomm
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/didpeer"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+func TestKeyWrap(t *testing.T) {
+	// RFC 3394, section 4.6
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F")
+	want, _ := hex.DecodeString("28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21")
+	got, err := keyWrap(kek, key)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("got wrap %x, error %v, want %x", got, err, want)
+	}
+	unwrapped, err := keyUnwrap(kek, got)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("got unwrap %x, error %v", unwrapped, err)
+	}
+	got[3] ^= 1
+	if _, err := keyUnwrap(kek, got); err == nil {
+		t.Error("unwrap of corrupted key passed")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	a, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	b, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	envelope, err := Encrypt([]byte("hello"), []Recipient{{"did:example:a#1", a.PublicKey()}, {"did:example:b#1", b.PublicKey()}})
+	if err != nil {
+		t.Fatal("encrypt error:", err)
+	}
+	payload, kid, err := Decrypt(envelope, func(kid string) *ecdh.PrivateKey {
+		if kid == "did:example:b#1" {
+			return b
+		}
+		return nil
+	})
+	if err != nil || string(payload) != "hello" || kid != "did:example:b#1" {
+		t.Errorf("got payload %q for %q, error %v", payload, kid, err)
+	}
+
+	none := func(string) *ecdh.PrivateKey { return nil }
+	if _, _, err := Decrypt(envelope, none); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("decrypt without keys got error %v, want ErrDecrypt", err)
+	}
+	var tampered map[string]any
+	json.Unmarshal(envelope, &tampered)
+	tampered["recipients"] = tampered["recipients"].([]any)[1:] // drop a
+	raw, _ := json.Marshal(tampered)
+	if _, _, err := Decrypt(raw, func(string) *ecdh.PrivateKey { return b }); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("recipient removal got error %v, want ErrDecrypt", err)
+	}
+}
+
+// Party is a did:peer with its keys.
+type party struct {
+	did   backend.DID
+	agent *Agent
+}
+
+func newParty(t *testing.T, signs bool) *party {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	agree, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	did, err := didpeer.New2([]didpeer.Key{{Purpose: didpeer.Verification, Public: pub}, {Purpose: didpeer.Encryption, Public: agree.PublicKey()}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &Agent{
+		Resolver: new(didpeer.Resolver),
+		Keys:     map[string]*ecdh.PrivateKey{did.String() + "#key-2": agree},
+	}
+	if signs {
+		agent.Signer = key
+		agent.KeyID = &backend.URL{DID: did, RawFragment: "#key-1"}
+	}
+	return &party{did, agent}
+}
+
+func (p *party) request(t *testing.T, typ string, body any) *Message {
+	m, err := NewMessage(typ, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.From = p.did.String()
+	m.ReturnRoute = "all"
+	return m
+}
+
+func TestMediator(t *testing.T) {
+	ctx := context.Background()
+	mediator, alice, bob := newParty(t, false), newParty(t, true), newParty(t, false)
+	srv := httptest.NewServer(&Mediator{Agent: mediator.agent, Queue: new(MemoryQueue)})
+	defer srv.Close()
+
+	post := func(envelope []byte) (*http.Response, []byte) {
+		resp, err := http.Post(srv.URL, MediaTypeEncrypted, bytes.NewReader(envelope))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return resp, buf.Bytes()
+	}
+	// Send goes from bob to alice, through the mediator.
+	send := func(text string) {
+		msg, _ := NewMessage("https://example.com/protocols/chat/1.0/message", map[string]string{"text": text})
+		inner, err := bob.agent.Pack(ctx, msg, alice.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forward, _ := NewForward(alice.did.String(), inner)
+		outer, err := bob.agent.Pack(ctx, forward, mediator.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, body := post(outer); resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("forward got HTTP %q: %s", resp.Status, body)
+		}
+	}
+	// Pickup sends a request from alice, and it returns the reply.
+	pickup := func(m *Message) *Message {
+		envelope, err := alice.agent.Pack(ctx, m, mediator.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, body := post(envelope)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s got HTTP %q: %s", m.Type, resp.Status, body)
+		}
+		reply, _, err := alice.agent.Unpack(ctx, body)
+		if err != nil {
+			t.Fatalf("%s reply: %s", m.Type, err)
+		}
+		if reply.ThreadID != m.ID {
+			t.Errorf("%s reply in thread %q, want %q", m.Type, reply.ThreadID, m.ID)
+		}
+		return reply
+	}
+
+	send("hi")
+	send("there")
+	var status StatusBody
+	json.Unmarshal(pickup(alice.request(t, StatusRequestType, &PickupBody{})).Body, &status)
+	if status.MessageCount != 2 || status.LiveDelivery {
+		t.Errorf("got status %+v", status)
+	}
+
+	delivery := pickup(alice.request(t, DeliveryRequestType, &PickupBody{Limit: 1}))
+	if delivery.Type != DeliveryType || len(delivery.Attachments) != 1 {
+		t.Fatalf("got delivery %+v", delivery)
+	}
+	inner, err := delivery.Attachments[0].Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, e, err := alice.agent.Unpack(ctx, inner)
+	if err != nil || !strings.Contains(string(msg.Body), "hi") || e.Recipient == "" {
+		t.Errorf("delivered message %+v, error %v", msg, err)
+	}
+
+	received := alice.request(t, MessagesReceivedType, &PickupBody{MessageIDList: []string{delivery.Attachments[0].ID}})
+	json.Unmarshal(pickup(received).Body, &status)
+	if status.MessageCount != 1 {
+		t.Errorf("status after received got %+v", status)
+	}
+	live := pickup(alice.request(t, LiveDeliveryChangeType, &PickupBody{LiveDelivery: true}))
+	if live.Type != ProblemReportType {
+		t.Errorf("live delivery over HTTP got %+v", live)
+	}
+
+	// unsigned, and for another recipient
+	anonymous := &party{alice.did, &Agent{Resolver: alice.agent.Resolver, Keys: alice.agent.Keys}}
+	envelope, _ := anonymous.agent.Pack(ctx, alice.request(t, StatusRequestType, &PickupBody{}), mediator.did)
+	if resp, _ := post(envelope); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned pickup got HTTP %q", resp.Status)
+	}
+	envelope, _ = alice.agent.Pack(ctx, alice.request(t, StatusRequestType, &PickupBody{RecipientDID: bob.did.String()}), mediator.did)
+	if resp, _ := post(envelope); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("pickup for bob got HTTP %q", resp.Status)
+	}
+}
+
+func TestLiveDelivery(t *testing.T) {
+	ctx := context.Background()
+	mediator, alice, bob := newParty(t, false), newParty(t, true), newParty(t, false)
+	m := &Mediator{Agent: mediator.agent, Queue: new(MemoryQueue)}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	conn, err := new(websocket.Dialer).Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	exchange := func(req *Message) *Message {
+		envelope, err := alice.agent.Pack(ctx, req, mediator.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, envelope); err != nil {
+			t.Fatal(err)
+		}
+		return readMessage(t, conn, alice.agent)
+	}
+	var status StatusBody
+	json.Unmarshal(exchange(alice.request(t, LiveDeliveryChangeType, &PickupBody{LiveDelivery: true})).Body, &status)
+	if !status.LiveDelivery {
+		t.Fatalf("live delivery change got status %+v", status)
+	}
+
+	msg, _ := NewMessage("https://example.com/protocols/chat/1.0/message", map[string]string{"text": "live"})
+	inner, _ := bob.agent.Pack(ctx, msg, alice.did)
+	forward, _ := NewForward(alice.did.String(), inner)
+	outer, _ := bob.agent.Pack(ctx, forward, mediator.did)
+	if _, err := m.Handle(ctx, outer); err != nil {
+		t.Fatal("forward error:", err)
+	}
+	delivery := readMessage(t, conn, alice.agent)
+	if delivery.Type != DeliveryType || len(delivery.Attachments) != 1 {
+		t.Fatalf("got live delivery %+v", delivery)
+	}
+	content, _ := delivery.Attachments[0].Content()
+	if got, _, err := alice.agent.Unpack(ctx, content); err != nil || got.ID != msg.ID {
+		t.Errorf("live delivery got message %+v, error %v", got, err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mediator, alice, bob := newParty(t, false), newParty(t, true), newParty(t, false)
+	m := &Mediator{
+		Agent: mediator.agent,
+		Queue: new(MemoryQueue),
+		Auth:  &authz.DIDAuth{Resolver: mediator.agent.Resolver, Audience: "https://mediator.example"},
+	}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	received := make(chan *Message, 4)
+	link := &Link{
+		Agent:        alice.agent,
+		Peer:         mediator.did,
+		Client:       websocket.Client{URL: "ws" + strings.TrimPrefix(srv.URL, "http")},
+		Audience:     "https://mediator.example",
+		LiveDelivery: true,
+		Handle:       func(_ context.Context, msg *Message, _ *Envelope) { received <- msg },
+	}
+	go link.Run(ctx)
+	receive := func() *Message {
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message on link")
+			return nil
+		}
+	}
+	if status := receive(); status.Type != StatusType {
+		t.Fatalf("got %s, want live delivery status", status.Type)
+	}
+
+	msg, _ := NewMessage("https://example.com/protocols/chat/1.0/message", map[string]string{"text": "linked"})
+	inner, _ := bob.agent.Pack(ctx, msg, alice.did)
+	forward, _ := NewForward(alice.did.String(), inner)
+	outer, _ := bob.agent.Pack(ctx, forward, mediator.did)
+	if _, err := m.Handle(ctx, outer); err != nil {
+		t.Fatal("forward error:", err)
+	}
+	delivery := receive()
+	if delivery.Type != DeliveryType || len(delivery.Attachments) != 1 {
+		t.Fatalf("got live delivery %+v", delivery)
+	}
+
+	ack := alice.request(t, MessagesReceivedType, &PickupBody{MessageIDList: []string{delivery.Attachments[0].ID}})
+	if err := link.Send(ctx, ack); err != nil {
+		t.Fatal("send error:", err)
+	}
+	var status StatusBody
+	if err := json.Unmarshal(receive().Body, &status); err != nil || status.MessageCount != 0 {
+		t.Errorf("got status %+v after messages received, error %v", status, err)
+	}
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn, agent *Agent) *Message {
+	_, envelope, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal("WebSocket read:", err)
+	}
+	m, _, err := agent.Unpack(context.Background(), envelope)
+	if err != nil {
+		t.Fatal("unpack:", err)
+	}
+	return m
+}
+
+func TestInvitation(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t, true), newParty(t, true)
+
+	request, _ := NewMessage("https://didcomm.org/present-proof/3.0/request-presentation", map[string]string{"goal_code": "verify.age"})
+	inv, err := NewInvitation(alice.did, nil, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := InvitationURL("https://alice.example/connect?lang=en", inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseInvitationURL(link)
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+	if got.ID != inv.ID || got.From != alice.did.String() {
+		t.Errorf("got invitation %+v", got)
+	}
+	if body, err := InvitationBodyOf(got); err != nil || len(body.Accept) != 1 || body.Accept[0] != ProfileV2 {
+		t.Errorf("got invitation body %+v, error %v", body, err)
+	}
+	requests, err := InvitationRequests(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].ID != request.ID || requests[0].From != alice.did.String() || requests[0].ParentThreadID != inv.ID {
+		t.Errorf("got requests %+v", requests)
+	}
+
+	// connection by trust ping
+	ping, err := AcceptInvitation(got, bob.did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := bob.agent.Pack(ctx, ping, alice.did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, _, err := alice.agent.Unpack(ctx, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Type != PingType || received.ParentThreadID != inv.ID {
+		t.Errorf("alice got %+v", received)
+	}
+	resp, err := PingResponse(received)
+	if err != nil || resp == nil {
+		t.Fatalf("got ping response %+v, error %v", resp, err)
+	}
+	resp.From = alice.did.String()
+	envelope, err = alice.agent.Pack(ctx, resp, bob.did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, _, err := bob.agent.Unpack(ctx, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed.Type != PingResponseType || confirmed.ThreadID != ping.ID {
+		t.Errorf("bob got %+v", confirmed)
+	}
+
+	silent, _ := NewPing(bob.did, alice.did, false)
+	if resp, err := PingResponse(silent); resp != nil || err != nil {
+		t.Errorf("ping without response requested got %+v, error %v", resp, err)
+	}
+
+	for _, link := range []string{
+		"https://alice.example/connect",
+		"https://alice.example/connect?_oobid=5f0e3ffb",
+		"https://alice.example/connect?_oob=%%%",
+		"https://alice.example/connect?_oob=e30",
+	} {
+		if _, err := ParseInvitationURL(link); !errors.Is(err, ErrMessage) {
+			t.Errorf("%s got error %v, want ErrMessage", link, err)
+		}
+	}
+}
+
+func TestExchanges(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t, true), newParty(t, true)
+	issuer := &Exchanges{Store: new(MemoryExchanges)}
+	holder := &Exchanges{Store: new(MemoryExchanges)}
+
+	// Transfer sends m from one party to another, as recorded on both ends.
+	transfer := func(from *party, sender *Exchanges, to *party, receiver *Exchanges, m *Message) (*Exchange, *Exchange) {
+		t.Helper()
+		m.From = from.did.String()
+		m.To = []string{to.did.String()}
+		sent, err := sender.Send(ctx, m)
+		if err != nil {
+			t.Fatalf("send %s: %s", m.Type, err)
+		}
+		envelope, err := from.agent.Pack(ctx, m, to.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unpacked, _, err := to.agent.Unpack(ctx, envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received, err := receiver.Receive(ctx, unpacked)
+		if err != nil {
+			t.Fatalf("receive %s: %s", m.Type, err)
+		}
+		return sent, received
+	}
+
+	offer, err := NewExchangeMessage(OfferCredentialType, &ExchangeBody{
+		CredentialPreview: &CredentialPreview{
+			Type:       CredentialPreviewType,
+			Attributes: []CredentialAttribute{{Name: "degree", Value: "BSc"}},
+		},
+	}, map[string][]byte{LDProofVCDetailFormat: []byte(`{"credential":{"type":["VerifiableCredential"]}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := transfer(alice, issuer, bob, holder, offer)
+	if x.Role != Issuer || x.State != OfferSent || y.Role != Holder || y.State != OfferReceived {
+		t.Errorf("after offer got %s %s and %s %s", x.Role, x.State, y.Role, y.State)
+	}
+	detail, err := FormatContent(y.Last(OfferCredentialType), LDProofVCDetailFormat)
+	if err != nil || !strings.Contains(string(detail), "VerifiableCredential") {
+		t.Errorf("got offer detail %s, error %v", detail, err)
+	}
+
+	// issuance before request
+	early, _ := offer.Reply(IssueCredentialType, struct{}{})
+	early.To = []string{bob.did.String()}
+	if _, err := issuer.Send(ctx, early); !errors.Is(err, ErrState) {
+		t.Errorf("issue before request got error %v, want ErrState", err)
+	}
+
+	request, _ := y.Last(OfferCredentialType).Reply(RequestCredentialType, struct{}{})
+	Attach(request, nil, map[string][]byte{LDProofVCDetailFormat: detail})
+	transfer(bob, holder, alice, issuer, request)
+	issue, _ := request.Reply(IssueCredentialType, struct{}{})
+	Attach(issue, nil, map[string][]byte{LDProofVCFormat: []byte(`{"type":["VerifiableCredential"],"proof":{}}`)})
+	x, y = transfer(alice, issuer, bob, holder, issue)
+	if x.State != CredentialIssued || y.State != CredentialReceived {
+		t.Errorf("after issue got states %s and %s", x.State, y.State)
+	}
+	ack, _ := issue.Reply(CredentialAckType, &ExchangeBody{Status: "OK"})
+	x, y = transfer(bob, holder, alice, issuer, ack)
+	if x.State != Done || y.State != Done || len(y.Messages) != 4 || y.ThreadID != offer.ID {
+		t.Errorf("after ack got %+v and %+v", x, y)
+	}
+
+	// message of another party in the thread
+	carol := newParty(t, true)
+	intruder, _ := offer.Reply(CredentialAckType, struct{}{})
+	intruder.From = carol.did.String()
+	if _, err := issuer.Receive(ctx, intruder); !errors.Is(err, ErrState) {
+		t.Errorf("message from a third party got error %v, want ErrState", err)
+	}
+
+	// present proof, abandoned by the prover
+	verifier := &Exchanges{Store: new(MemoryExchanges)}
+	prover := &Exchanges{Store: new(MemoryExchanges)}
+	req, _ := NewExchangeMessage(RequestPresentationType, &ExchangeBody{WillConfirm: true},
+		map[string][]byte{PEDefinitionFormat: []byte(`{"presentation_definition":{"id":"x","input_descriptors":[]}}`)})
+	x, y = transfer(alice, verifier, bob, prover, req)
+	if x.Role != Verifier || x.State != RequestSent || y.Role != Prover || y.State != RequestReceived {
+		t.Errorf("after request got %s %s and %s %s", x.Role, x.State, y.Role, y.State)
+	}
+	problem, _ := NewMessage(ProblemReportType, &ProblemBody{Code: "e.p.req.no-credential"})
+	problem.ParentThreadID = req.ID
+	x, y = transfer(bob, prover, alice, verifier, problem)
+	if x.State != Abandoned || y.State != Abandoned {
+		t.Errorf("after problem report got states %s and %s", x.State, y.State)
+	}
+	late, _ := req.Reply(PresentationType, struct{}{})
+	late.To = []string{alice.did.String()}
+	if _, err := prover.Send(ctx, late); !errors.Is(err, ErrState) {
+		t.Errorf("presentation after abandon got error %v, want ErrState", err)
+	}
+
+	chat, _ := NewMessage("https://didcomm.org/basicmessage/2.0/message", struct{}{})
+	if _, err := prover.Receive(ctx, chat); !errors.Is(err, ErrMessage) {
+		t.Errorf("message of another protocol got error %v, want ErrMessage", err)
+	}
+}
@@ -0,0 +1,418 @@
+package didcomm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types of Issue Credential 2.0, conform Aries RFC 0453
+const (
+	ProposeCredentialType = "https://didcomm.org/issue-credential/2.0/propose-credential"
+	OfferCredentialType   = "https://didcomm.org/issue-credential/2.0/offer-credential"
+	RequestCredentialType = "https://didcomm.org/issue-credential/2.0/request-credential"
+	IssueCredentialType   = "https://didcomm.org/issue-credential/2.0/issue-credential"
+	CredentialAckType     = "https://didcomm.org/issue-credential/2.0/ack"
+	CredentialProblemType = "https://didcomm.org/issue-credential/2.0/problem-report"
+)
+
+// Message types of Present Proof 2.0, conform Aries RFC 0454
+const (
+	ProposePresentationType = "https://didcomm.org/present-proof/2.0/propose-presentation"
+	RequestPresentationType = "https://didcomm.org/present-proof/2.0/request-presentation"
+	PresentationType        = "https://didcomm.org/present-proof/2.0/presentation"
+	PresentationAckType     = "https://didcomm.org/present-proof/2.0/ack"
+	PresentationProblemType = "https://didcomm.org/present-proof/2.0/problem-report"
+)
+
+// CredentialPreviewType is the type of a CredentialPreview.
+const CredentialPreviewType = "https://didcomm.org/issue-credential/2.0/credential-preview"
+
+// Attachment formats of the protocols
+const (
+	LDProofVCFormat       = "aries/ld-proof-vc@v1.0"
+	LDProofVCDetailFormat = "aries/ld-proof-vc-detail@v1.0"
+	PEDefinitionFormat    = "dif/presentation-exchange/definitions@v1.0"
+	PESubmissionFormat    = "dif/presentation-exchange/submission@v1.0"
+)
+
+// Protocol identifiers, with the prefix of their message types
+const (
+	issueCredentialProtocol = "issue-credential/2.0"
+	presentProofProtocol    = "present-proof/2.0"
+	protocolPrefix          = "https://didcomm.org/"
+)
+
+// Role is the part of an agent in an Exchange.
+type Role string
+
+// Roles of the protocols
+const (
+	Issuer   Role = "issuer"
+	Holder   Role = "holder"
+	Verifier Role = "verifier"
+	Prover   Role = "prover"
+)
+
+// State is the state of an Exchange, as named in the RFCs.
+type State string
+
+// States of Issue Credential 2.0
+const (
+	ProposalSent       State = "proposal-sent"
+	ProposalReceived   State = "proposal-received"
+	OfferSent          State = "offer-sent"
+	OfferReceived      State = "offer-received"
+	RequestSent        State = "request-sent"
+	RequestReceived    State = "request-received"
+	CredentialIssued   State = "credential-issued"
+	CredentialReceived State = "credential-received"
+)
+
+// States of Present Proof 2.0, next to ProposalSent, ProposalReceived,
+// RequestSent and RequestReceived
+const (
+	PresentationSent     State = "presentation-sent"
+	PresentationReceived State = "presentation-received"
+)
+
+// Final states of both protocols
+const (
+	Done      State = "done"
+	Abandoned State = "abandoned"
+)
+
+// ErrState signals a message out of protocol order.
+var ErrState = errors.New("DIDComm message not expected in protocol state")
+
+// Transition is an edge of the state machines. The zero State in from
+// starts an Exchange.
+type transition struct {
+	role Role
+	sent bool
+	typ  string
+	from []State
+	to   State
+}
+
+var transitions = []transition{
+	{Issuer, false, ProposeCredentialType, []State{"", OfferSent}, ProposalReceived},
+	{Issuer, true, OfferCredentialType, []State{"", ProposalReceived}, OfferSent},
+	{Issuer, false, RequestCredentialType, []State{"", OfferSent}, RequestReceived},
+	{Issuer, true, IssueCredentialType, []State{RequestReceived}, CredentialIssued},
+	{Issuer, false, CredentialAckType, []State{CredentialIssued}, Done},
+
+	{Holder, true, ProposeCredentialType, []State{"", OfferReceived}, ProposalSent},
+	{Holder, false, OfferCredentialType, []State{"", ProposalSent}, OfferReceived},
+	{Holder, true, RequestCredentialType, []State{"", OfferReceived}, RequestSent},
+	{Holder, false, IssueCredentialType, []State{RequestSent}, CredentialReceived},
+	{Holder, true, CredentialAckType, []State{CredentialReceived}, Done},
+
+	{Verifier, false, ProposePresentationType, []State{"", RequestSent}, ProposalReceived},
+	{Verifier, true, RequestPresentationType, []State{"", ProposalReceived}, RequestSent},
+	{Verifier, false, PresentationType, []State{RequestSent}, PresentationReceived},
+	{Verifier, true, PresentationAckType, []State{PresentationReceived}, Done},
+
+	{Prover, true, ProposePresentationType, []State{"", RequestReceived}, ProposalSent},
+	{Prover, false, RequestPresentationType, []State{"", ProposalSent}, RequestReceived},
+	{Prover, true, PresentationType, []State{RequestReceived}, PresentationSent},
+	{Prover, false, PresentationAckType, []State{PresentationSent}, Done},
+}
+
+// Exchange is an instance of Issue Credential 2.0 or Present Proof 2.0, i.e.,
+// one thread.
+type Exchange struct {
+	ThreadID string    `json:"thid"`
+	Protocol string    `json:"protocol"` // "issue-credential/2.0" or "present-proof/2.0"
+	Role     Role      `json:"role"`
+	State    State     `json:"state"`
+	Peer     string    `json:"peer,omitempty"` // DID of the other party
+	Updated  time.Time `json:"updated"`
+
+	// Messages are the ones sent and received, in order.
+	Messages []*Message `json:"messages"`
+}
+
+// Last returns the latest message of the type, or nil when none.
+func (x *Exchange) Last(typ string) *Message {
+	for i := len(x.Messages) - 1; i >= 0; i-- {
+		if x.Messages[i].Type == typ {
+			return x.Messages[i]
+		}
+	}
+	return nil
+}
+
+// ExchangeStore keeps the state of protocol instances. Implementations must
+// be safe for concurrent use.
+type ExchangeStore interface {
+	// Get returns the Exchange of a thread, or nil without error when
+	// the thread is unknown.
+	Get(ctx context.Context, threadID string) (*Exchange, error)
+	// Put inserts or replaces the Exchange of its thread.
+	Put(ctx context.Context, x *Exchange) error
+}
+
+// MemoryExchanges is an ExchangeStore in memory. The zero value is ready to
+// use.
+type MemoryExchanges struct {
+	mutex     sync.Mutex
+	exchanges map[string][]byte // JSON by thread
+}
+
+// Get implements the ExchangeStore interface.
+func (s *MemoryExchanges) Get(_ context.Context, threadID string) (*Exchange, error) {
+	s.mutex.Lock()
+	raw, ok := s.exchanges[threadID]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	x := new(Exchange)
+	if err := json.Unmarshal(raw, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Put implements the ExchangeStore interface.
+func (s *MemoryExchanges) Put(_ context.Context, x *Exchange) error {
+	raw, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.exchanges == nil {
+		s.exchanges = make(map[string][]byte)
+	}
+	s.exchanges[x.ThreadID] = raw
+	return nil
+}
+
+// Exchanges runs the state machines of Issue Credential 2.0 and of Present
+// Proof 2.0. Each message, sent or received, goes through Exchanges before
+// transport or after unpacking, respectively, such that messages out of order
+// are rejected. The content of messages is up to the caller. Multiple
+// goroutines may invoke methods on Exchanges simultaneously, when they are
+// the only users of the Store.
+type Exchanges struct {
+	Store ExchangeStore
+
+	mutex sync.Mutex // serialises read–modify–write on Store
+}
+
+// Send records a message to send, and it returns the Exchange in its new
+// state. Messages start a thread with their ID, or they continue the thread
+// of ThreadID. The first message of a thread must have a recipient in To.
+func (e *Exchanges) Send(ctx context.Context, m *Message) (*Exchange, error) {
+	return e.advance(ctx, m, true)
+}
+
+// Receive records a message received, as returned by Agent Unpack, and it
+// returns the Exchange in its new state. The sender must be the peer of the
+// thread.
+func (e *Exchanges) Receive(ctx context.Context, m *Message) (*Exchange, error) {
+	return e.advance(ctx, m, false)
+}
+
+func (e *Exchanges) advance(ctx context.Context, m *Message, sent bool) (*Exchange, error) {
+	var protocol string
+	switch {
+	case strings.HasPrefix(m.Type, protocolPrefix+issueCredentialProtocol+"/"):
+		protocol = issueCredentialProtocol
+	case strings.HasPrefix(m.Type, protocolPrefix+presentProofProtocol+"/"):
+		protocol = presentProofProtocol
+	case m.Type == ProblemReportType:
+		break // protocol of the thread
+	default:
+		return nil, fmt.Errorf("%w: message type %q not in Issue Credential 2.0 nor in Present Proof 2.0", ErrMessage, m.Type)
+	}
+	threadID := m.ThreadID
+	if m.Type == ProblemReportType && m.ParentThreadID != "" {
+		threadID = m.ParentThreadID // per Report Problem 2.0
+	}
+	if threadID == "" {
+		threadID = m.ID
+	}
+	peer := m.From
+	if sent {
+		peer = ""
+		if len(m.To) != 0 {
+			peer = m.To[0]
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	x, err := e.Store.Get(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if x == nil {
+		if m.Type == ProblemReportType || m.Type == CredentialProblemType || m.Type == PresentationProblemType {
+			return nil, fmt.Errorf("%w: problem report for unknown thread %q", ErrState, threadID)
+		}
+		if peer == "" {
+			return nil, fmt.Errorf("%w: message %s starts a thread without peer", ErrMessage, m.ID)
+		}
+		x = &Exchange{ThreadID: threadID, Protocol: protocol, Peer: peer}
+	} else {
+		if protocol != "" && protocol != x.Protocol {
+			return nil, fmt.Errorf("%w: %s message in %s thread %q", ErrState, m.Type, x.Protocol, threadID)
+		}
+		if !sent && m.From != x.Peer {
+			return nil, fmt.Errorf("%w: message from %q in thread %q with %q", ErrState, m.From, threadID, x.Peer)
+		}
+	}
+
+	next, err := x.next(m.Type, sent)
+	if err != nil {
+		return nil, err
+	}
+	x.State = next
+	x.Updated = time.Now()
+	x.Messages = append(x.Messages, m)
+	if err := e.Store.Put(ctx, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Next returns the state after a message of the type, and it sets the Role
+// when the Exchange starts.
+func (x *Exchange) next(typ string, sent bool) (State, error) {
+	switch typ {
+	case ProblemReportType, CredentialProblemType, PresentationProblemType:
+		if x.State == Done || x.State == Abandoned {
+			return "", fmt.Errorf("%w: problem report in %s thread %q", ErrState, x.State, x.ThreadID)
+		}
+		return Abandoned, nil
+	}
+	for _, t := range transitions {
+		if t.typ != typ || t.sent != sent || (x.Role != "" && t.role != x.Role) {
+			continue
+		}
+		for _, from := range t.from {
+			if from == x.State {
+				if x.Role == "" {
+					x.Role = t.role
+				}
+				return t.to, nil
+			}
+		}
+	}
+	direction := "received"
+	if sent {
+		direction = "sent"
+	}
+	if x.State == "" {
+		return "", fmt.Errorf("%w: thread %q can not start with %s %s", ErrState, x.ThreadID, typ, direction)
+	}
+	return "", fmt.Errorf("%w: %s %s in state %s of the %s", ErrState, typ, direction, x.State, x.Role)
+}
+
+// FormatID is an entry of "formats" in the body of protocol messages.
+type FormatID struct {
+	AttachID string `json:"attach_id"`
+	Format   string `json:"format"`
+}
+
+// CredentialPreview lists the attributes of a credential proposed or offered.
+type CredentialPreview struct {
+	Type       string                `json:"type"`
+	Attributes []CredentialAttribute `json:"attributes"`
+}
+
+// CredentialAttribute is an entry of a CredentialPreview.
+type CredentialAttribute struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mime-type,omitempty"`
+	Value    string `json:"value"`
+}
+
+// ExchangeBody is the body of protocol messages, with the fields in use per
+// type.
+type ExchangeBody struct {
+	GoalCode string     `json:"goal_code,omitempty"`
+	Comment  string     `json:"comment,omitempty"`
+	Formats  []FormatID `json:"formats,omitempty"`
+
+	CredentialPreview *CredentialPreview `json:"credential_preview,omitempty"` // propose and offer
+	ReplacementID     string             `json:"replacement_id,omitempty"`     // offer and issue
+	WillConfirm       bool               `json:"will_confirm,omitempty"`       // request-presentation
+	Status            string             `json:"status,omitempty"`             // ack, e.g., "OK"
+}
+
+// NewExchangeMessage returns a protocol message with content attached for
+// each format, as listed in the "formats" of the body. Messages other than
+// the first of a thread should come from Message Reply instead, with Attach.
+func NewExchangeMessage(typ string, body *ExchangeBody, content map[string][]byte) (*Message, error) {
+	m, err := NewMessage(typ, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	return m, Attach(m, body, content)
+}
+
+// Attach sets body as the body of m, with content attached for each format.
+// JSON content is embedded as is, and anything else in base64.
+func Attach(m *Message, body *ExchangeBody, content map[string][]byte) error {
+	if body == nil {
+		body = new(ExchangeBody)
+	}
+	formats := make([]string, 0, len(content))
+	for format := range content {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats) // deterministic
+	for _, format := range formats {
+		data := content[format]
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		a := Attachment{ID: id, Format: format}
+		if json.Valid(data) {
+			a.MediaType = "application/json"
+			a.Data.JSON = data
+		} else {
+			a.Data.Base64 = base64.RawURLEncoding.EncodeToString(data)
+		}
+		m.Attachments = append(m.Attachments, a)
+		body.Formats = append(body.Formats, FormatID{AttachID: id, Format: format})
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	m.Body = raw
+	return nil
+}
+
+// FormatContent returns the attachment of a format, as listed in the
+// "formats" of the body of m.
+func FormatContent(m *Message, format string) ([]byte, error) {
+	var body ExchangeBody
+	if err := json.Unmarshal(m.Body, &body); err != nil {
+		return nil, fmt.Errorf("%w: %s body: %w", ErrMessage, m.Type, err)
+	}
+	for _, f := range body.Formats {
+		if f.Format != format {
+			continue
+		}
+		for i := range m.Attachments {
+			if m.Attachments[i].ID == f.AttachID {
+				return m.Attachments[i].Content()
+			}
+		}
+		return nil, fmt.Errorf("%w: %s has no attachment %q for format %q", ErrMessage, m.Type, f.AttachID, format)
+	}
+	return nil, fmt.Errorf("%w: %s has no format %q", ErrMessage, m.Type, format)
+}
@@ -0,0 +1,320 @@
+package didcomm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// Anoncrypt algorithms conform DIDComm Messaging v2
+const (
+	KeyAlg = "ECDH-ES+A256KW"
+	EncAlg = "A256CBC-HS512"
+)
+
+// ErrDecrypt signals an envelope which can not be decrypted, either because
+// none of the recipients has a key available, or because of tampering.
+var ErrDecrypt = errors.New("DIDComm envelope decryption failed")
+
+// Recipient is a key agreement key of a recipient.
+type Recipient struct {
+	KID string          // DID URL of the verification method
+	Key *ecdh.PublicKey // X25519
+}
+
+type jweHeader struct {
+	Typ string    `json:"typ,omitempty"`
+	Alg string    `json:"alg"`
+	Enc string    `json:"enc"`
+	EPK *jose.JWK `json:"epk"`
+	APV string    `json:"apv"`
+}
+
+type jweRecipient struct {
+	Header struct {
+		KID string `json:"kid"`
+	} `json:"header"`
+	EncryptedKey string `json:"encrypted_key"`
+}
+
+// JWE is the General JSON Serialization.
+type jwe struct {
+	Protected  string         `json:"protected"`
+	Recipients []jweRecipient `json:"recipients"`
+	IV         string         `json:"iv"`
+	Ciphertext string         `json:"ciphertext"`
+	Tag        string         `json:"tag"`
+}
+
+// APV is the hash of the recipient key identifiers, sorted and joined by
+// dots, for the PartyVInfo.
+func apv(kids []string) []byte {
+	sorted := slices.Clone(kids)
+	slices.Sort(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ".")))
+	return sum[:]
+}
+
+// Encrypt returns payload as an anonymous JWE for each of the recipients.
+func Encrypt(payload []byte, recipients []Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("DIDComm encryption without recipients")
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	epk, err := jose.NewJWK(ephemeral.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	kids := make([]string, len(recipients))
+	for i, r := range recipients {
+		kids[i] = r.KID
+	}
+	partyV := apv(kids)
+	header, err := json.Marshal(&jweHeader{
+		Typ: MediaTypeEncrypted,
+		Alg: KeyAlg,
+		Enc: EncAlg,
+		EPK: epk,
+		APV: base64.RawURLEncoding.EncodeToString(partyV),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := jwe{Protected: base64.RawURLEncoding.EncodeToString(header)}
+
+	cek := make([]byte, 64)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, err
+	}
+	for _, r := range recipients {
+		if r.Key == nil || r.Key.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("%w: DIDComm recipient %s needs an X25519 key", jose.ErrKeyType, r.KID)
+		}
+		z, err := ephemeral.ECDH(r.Key)
+		if err != nil {
+			return nil, fmt.Errorf("DIDComm recipient %s: %w", r.KID, err)
+		}
+		wrapped, err := keyWrap(concatKDF(z, KeyAlg, nil, partyV), cek)
+		if err != nil {
+			return nil, err
+		}
+		var e jweRecipient
+		e.Header.KID = r.KID
+		e.EncryptedKey = base64.RawURLEncoding.EncodeToString(wrapped)
+		out.Recipients = append(out.Recipients, e)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	ciphertext, tag := sealCBCHMAC(cek, iv, payload, []byte(out.Protected))
+	out.IV = base64.RawURLEncoding.EncodeToString(iv)
+	out.Ciphertext = base64.RawURLEncoding.EncodeToString(ciphertext)
+	out.Tag = base64.RawURLEncoding.EncodeToString(tag)
+	return json.Marshal(&out)
+}
+
+// Decrypt returns the payload of an anonymous JWE, with the key identifier of
+// the recipient which matched. Keys returns nil for unknown identifiers.
+func Decrypt(envelope []byte, keys func(kid string) *ecdh.PrivateKey) (payload []byte, kid string, err error) {
+	var in jwe
+	if err := json.Unmarshal(envelope, &in); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(in.Protected)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: protected header: %w", ErrDecrypt, err)
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, "", fmt.Errorf("%w: protected header: %w", ErrDecrypt, err)
+	}
+	if header.Alg != KeyAlg || header.Enc != EncAlg {
+		return nil, "", fmt.Errorf("%w: algorithms %q and %q not supported", ErrDecrypt, header.Alg, header.Enc)
+	}
+	if header.EPK == nil {
+		return nil, "", fmt.Errorf("%w: no ephemeral key", ErrDecrypt)
+	}
+	epk, err := header.EPK.PublicKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: ephemeral key: %w", ErrDecrypt, err)
+	}
+	ephemeral, ok := epk.(*ecdh.PublicKey)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: ephemeral key type %T", ErrDecrypt, epk)
+	}
+	partyV, err := base64.RawURLEncoding.DecodeString(header.APV)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: apv: %w", ErrDecrypt, err)
+	}
+	kids := make([]string, len(in.Recipients))
+	for i, r := range in.Recipients {
+		kids[i] = r.Header.KID
+	}
+	if subtle.ConstantTimeCompare(partyV, apv(kids)) != 1 {
+		return nil, "", fmt.Errorf("%w: apv does not match the recipients", ErrDecrypt)
+	}
+	iv, err1 := base64.RawURLEncoding.DecodeString(in.IV)
+	ciphertext, err2 := base64.RawURLEncoding.DecodeString(in.Ciphertext)
+	tag, err3 := base64.RawURLEncoding.DecodeString(in.Tag)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+
+	for _, r := range in.Recipients {
+		key := keys(r.Header.KID)
+		if key == nil {
+			continue
+		}
+		wrapped, err := base64.RawURLEncoding.DecodeString(r.EncryptedKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: encrypted key: %w", ErrDecrypt, err)
+		}
+		z, err := key.ECDH(ephemeral)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %w", ErrDecrypt, err)
+		}
+		cek, err := keyUnwrap(concatKDF(z, KeyAlg, nil, partyV), wrapped)
+		if err != nil || len(cek) != 64 {
+			return nil, "", fmt.Errorf("%w: content key of %s does not unwrap", ErrDecrypt, r.Header.KID)
+		}
+		payload, err := openCBCHMAC(cek, iv, ciphertext, tag, []byte(in.Protected))
+		if err != nil {
+			return nil, "", err
+		}
+		return payload, r.Header.KID, nil
+	}
+	return nil, "", fmt.Errorf("%w: no key for any of recipients %q", ErrDecrypt, kids)
+}
+
+// ConcatKDF derives a 256-bit key conform NIST SP 800-56A, as in RFC 7518,
+// section 4.6.2.
+func concatKDF(z []byte, alg string, partyU, partyV []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0, 0, 0, 1}) // round 1 suffices for SHA-256
+	h.Write(z)
+	for _, field := range [][]byte{[]byte(alg), partyU, partyV} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		h.Write(field)
+	}
+	h.Write(binary.BigEndian.AppendUint32(nil, 256)) // SuppPubInfo
+	return h.Sum(nil)
+}
+
+// KeyWrap implements AES Key Wrap conform RFC 3394.
+func keyWrap(kek, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) / 8
+	if len(key)%8 != 0 || n < 2 {
+		return nil, errors.New("AES key wrap of partial blocks")
+	}
+	out := make([]byte, 8+len(key))
+	a := out[:8]
+	for i := range a {
+		a[i] = 0xa6
+	}
+	copy(out[8:], key)
+	var b [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[:8], a)
+			copy(b[8:], out[8*i:])
+			block.Encrypt(b[:], b[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[8*i:], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// KeyUnwrap is the inverse of keyWrap.
+func keyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	if len(wrapped)%8 != 0 || n < 2 {
+		return nil, errors.New("AES key unwrap of partial blocks")
+	}
+	var a [8]byte
+	copy(a[:], wrapped)
+	r := make([]byte, 8*n)
+	copy(r, wrapped[8:])
+	var b [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(a[:])^t)
+			copy(b[8:], r[8*(i-1):])
+			block.Decrypt(b[:], b[:])
+			copy(a[:], b[:8])
+			copy(r[8*(i-1):], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a[:], []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}) != 1 {
+		return nil, errors.New("AES key unwrap integrity check failed")
+	}
+	return r, nil
+}
+
+// SealCBCHMAC implements AES_256_CBC_HMAC_SHA_512 conform RFC 7518, section
+// 5.2.5.
+func sealCBCHMAC(key, iv, plaintext, aad []byte) (ciphertext, tag []byte) {
+	block, _ := aes.NewCipher(key[32:])
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext = append(slices.Clone(plaintext), make([]byte, pad)...)
+	for i := len(plaintext); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return ciphertext, cbcTag(key[:32], iv, ciphertext, aad)
+}
+
+func openCBCHMAC(key, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: malformed ciphertext", ErrDecrypt)
+	}
+	if !hmac.Equal(tag, cbcTag(key[:32], iv, ciphertext, aad)) {
+		return nil, fmt.Errorf("%w: authentication tag mismatch", ErrDecrypt)
+	}
+	block, _ := aes.NewCipher(key[32:])
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, fmt.Errorf("%w: malformed padding", ErrDecrypt)
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+func cbcTag(macKey, iv, ciphertext, aad []byte) []byte {
+	m := hmac.New(sha512.New, macKey)
+	m.Write(aad)
+	m.Write(iv)
+	m.Write(ciphertext)
+	m.Write(binary.BigEndian.AppendUint64(nil, uint64(len(aad))*8))
+	return m.Sum(nil)[:32]
+}
@@ -0,0 +1,507 @@
+package didcomm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+// Message types of the mediator protocols
+const (
+	ForwardType = "https://didcomm.org/routing/2.0/forward"
+
+	StatusRequestType      = "https://didcomm.org/messagepickup/3.0/status-request"
+	StatusType             = "https://didcomm.org/messagepickup/3.0/status"
+	DeliveryRequestType    = "https://didcomm.org/messagepickup/3.0/delivery-request"
+	DeliveryType           = "https://didcomm.org/messagepickup/3.0/delivery"
+	MessagesReceivedType   = "https://didcomm.org/messagepickup/3.0/messages-received"
+	LiveDeliveryChangeType = "https://didcomm.org/messagepickup/3.0/live-delivery-change"
+
+	ProblemReportType = "https://didcomm.org/report-problem/2.0/problem-report"
+)
+
+// ErrForbidden signals a request denied by the mediator.
+var ErrForbidden = errors.New("DIDComm mediator denied the request")
+
+// ErrQueueFull signals a recipient with too many messages queued.
+var ErrQueueFull = errors.New("DIDComm message queue full")
+
+// ForwardBody is the body of a forward message.
+type ForwardBody struct {
+	Next string `json:"next"` // DID or key identifier of the recipient
+}
+
+// NewForward returns a forward message for next, with the envelope attached.
+// Encrypt the return for the routing keys of the mediator.
+func NewForward(next string, envelope []byte) (*Message, error) {
+	m, err := NewMessage(ForwardType, &ForwardBody{Next: next})
+	if err != nil {
+		return nil, err
+	}
+	m.To = []string{next}
+	m.Attachments = []Attachment{{Data: AttachmentData{JSON: envelope}}}
+	return m, nil
+}
+
+// StatusBody is the body of a pickup status.
+type StatusBody struct {
+	RecipientDID string `json:"recipient_did,omitempty"`
+	MessageCount int    `json:"message_count"`
+	LiveDelivery bool   `json:"live_delivery"`
+}
+
+// PickupBody is the body of pickup requests, with the fields in use per type.
+type PickupBody struct {
+	RecipientDID  string   `json:"recipient_did,omitempty"`
+	Limit         int      `json:"limit,omitempty"`           // delivery-request
+	MessageIDList []string `json:"message_id_list,omitempty"` // messages-received
+	LiveDelivery  bool     `json:"live_delivery,omitempty"`   // live-delivery-change
+}
+
+// ProblemBody is the body of a problem report.
+type ProblemBody struct {
+	Code    string `json:"code"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Queued is a message held for a recipient.
+type Queued struct {
+	ID       string
+	Envelope []byte
+	Received time.Time
+}
+
+// Queue holds messages per recipient until their pickup.
+type Queue interface {
+	// Push appends a message, or it fails with ErrQueueFull.
+	Push(ctx context.Context, recipient string, q *Queued) error
+	// Peek returns up to limit messages, oldest first.
+	Peek(ctx context.Context, recipient string, limit int) ([]*Queued, error)
+	// Remove drops the messages with the IDs. Unknown IDs are ignored.
+	Remove(ctx context.Context, recipient string, ids []string) error
+	// Len returns the number of messages held.
+	Len(ctx context.Context, recipient string) (int, error)
+}
+
+// MemoryQueue is a Queue in memory. The zero value is ready to use. Multiple
+// goroutines may invoke methods on a MemoryQueue simultaneously.
+type MemoryQueue struct {
+	Max int // messages per recipient, default 1000
+
+	mutex  sync.Mutex
+	queues map[string][]*Queued
+}
+
+// Push implements the Queue interface.
+func (q *MemoryQueue) Push(_ context.Context, recipient string, m *Queued) error {
+	limit := q.Max
+	if limit <= 0 {
+		limit = 1000
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.queues[recipient]) >= limit {
+		return fmt.Errorf("%w: %d messages for %s", ErrQueueFull, limit, recipient)
+	}
+	if q.queues == nil {
+		q.queues = make(map[string][]*Queued)
+	}
+	q.queues[recipient] = append(q.queues[recipient], m)
+	return nil
+}
+
+// Peek implements the Queue interface.
+func (q *MemoryQueue) Peek(_ context.Context, recipient string, limit int) ([]*Queued, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	l := q.queues[recipient]
+	return l[:min(limit, len(l)):min(limit, len(l))], nil
+}
+
+// Remove implements the Queue interface.
+func (q *MemoryQueue) Remove(_ context.Context, recipient string, ids []string) error {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var remain []*Queued
+	for _, m := range q.queues[recipient] {
+		if !drop[m.ID] {
+			remain = append(remain, m)
+		}
+	}
+	if len(remain) == 0 {
+		delete(q.queues, recipient)
+	} else {
+		q.queues[recipient] = remain
+	}
+	return nil
+}
+
+// Len implements the Queue interface.
+func (q *MemoryQueue) Len(_ context.Context, recipient string) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.queues[recipient]), nil
+}
+
+// Mediator relays messages to recipients which can not be reached directly,
+// such as mobile agents behind NAT. Senders forward messages, conform Routing
+// Protocol 2.0, and recipients collect them, conform Message Pickup 3.0,
+// either by polling or with live delivery on a WebSocket. Pickup requests
+// must be signed by their sender, and they only apply to messages for the DID
+// of the sender. Replies go on the same transport.
+//
+// Mediator serves HTTP with POST for each message, and with GET for WebSocket
+// sessions. With Auth set, sessions must pass a DID-signed challenge first,
+// and pickup requests on the session are limited to the DID which passed.
+// Multiple goroutines may invoke methods on a Mediator simultaneously.
+type Mediator struct {
+	// Agent decrypts with the keys of the routing DID, and it packs the
+	// replies to pickup requests.
+	Agent *Agent
+	Queue Queue
+
+	// Accept returns whether to relay messages for the recipient, as in
+	// ForwardBody.Next. Nil accepts any.
+	Accept func(ctx context.Context, recipient string) bool
+
+	// Auth, when set, authenticates WebSocket sessions, as in
+	// authz.DIDAuth.AuthenticateConn.
+	Auth *authz.DIDAuth
+
+	// PingInterval is the WebSocket keepalive, with
+	// websocket.PingIntervalDefault for zero.
+	PingInterval time.Duration
+
+	Log *slog.Logger // nil for slog.Default
+
+	mutex sync.Mutex
+	live  map[string]map[*session]struct{} // by recipient
+}
+
+func (m *Mediator) log() *slog.Logger {
+	if m.Log != nil {
+		return m.Log
+	}
+	return slog.Default()
+}
+
+// Session is a WebSocket connection.
+type session struct {
+	conn *websocket.Conn
+	did  string // authenticated, if any
+}
+
+// Handle processes one message, with an optional reply.
+func (m *Mediator) Handle(ctx context.Context, envelope []byte) (reply []byte, err error) {
+	return m.handle(ctx, envelope, nil)
+}
+
+func (m *Mediator) handle(ctx context.Context, envelope []byte, s *session) (reply []byte, err error) {
+	msg, e, err := m.Agent.Unpack(ctx, envelope)
+	if err != nil {
+		return nil, err
+	}
+	if msg.ExpiresTime != 0 && time.Unix(msg.ExpiresTime, 0).Before(time.Now()) {
+		return nil, fmt.Errorf("%w: message %s expired", ErrMessage, msg.ID)
+	}
+	if msg.Type == ForwardType {
+		if e.Recipient == "" {
+			return nil, fmt.Errorf("%w: forward message not encrypted", ErrMessage)
+		}
+		return nil, m.forward(ctx, msg)
+	}
+
+	if e.Signer == nil {
+		return nil, fmt.Errorf("%w: %s message not signed", ErrForbidden, msg.Type)
+	}
+	var body PickupBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return nil, fmt.Errorf("%w: %s body: %w", ErrMessage, msg.Type, err)
+	}
+	if body.RecipientDID != "" && body.RecipientDID != msg.From {
+		return nil, fmt.Errorf("%w: pickup for %s by %s", ErrForbidden, body.RecipientDID, msg.From)
+	}
+	recipient := msg.From
+	if s != nil && s.did != "" && s.did != recipient {
+		return nil, fmt.Errorf("%w: pickup by %s on a session of %s", ErrForbidden, recipient, s.did)
+	}
+
+	var r *Message
+	switch msg.Type {
+	case StatusRequestType:
+		r, err = m.status(ctx, msg, recipient, s)
+	case DeliveryRequestType:
+		r, err = m.delivery(ctx, msg, recipient, body.Limit)
+	case MessagesReceivedType:
+		if err = m.Queue.Remove(ctx, recipient, body.MessageIDList); err == nil {
+			r, err = m.status(ctx, msg, recipient, s)
+		}
+	case LiveDeliveryChangeType:
+		if s == nil {
+			r, err = msg.Reply(ProblemReportType, &ProblemBody{
+				Code:    "e.p.req.live-mode-not-supported",
+				Comment: "Connection does not support Live Delivery",
+			})
+			break
+		}
+		m.setLive(recipient, s, body.LiveDelivery)
+		r, err = m.status(ctx, msg, recipient, s)
+	default:
+		return nil, fmt.Errorf("%w: message type %q not supported", ErrMessage, msg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.pack(ctx, r, recipient)
+}
+
+func (m *Mediator) pack(ctx context.Context, r *Message, recipient string) ([]byte, error) {
+	to, err := backend.Parse(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recipient %q: %w", ErrMessage, recipient, err)
+	}
+	if m.Agent.KeyID != nil {
+		r.From = m.Agent.KeyID.DID.String()
+	}
+	r.CreatedTime = time.Now().Unix()
+	return m.Agent.Pack(ctx, r, to)
+}
+
+func (m *Mediator) forward(ctx context.Context, msg *Message) error {
+	var body ForwardBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil || body.Next == "" {
+		return fmt.Errorf(`%w: forward body needs "next"`, ErrMessage)
+	}
+	if len(msg.Attachments) != 1 {
+		return fmt.Errorf("%w: forward with %d attachments, want 1", ErrMessage, len(msg.Attachments))
+	}
+	inner, err := msg.Attachments[0].Content()
+	if err != nil {
+		return err
+	}
+	if !json.Valid(inner) {
+		return fmt.Errorf("%w: forwarded envelope is not JSON", ErrMessage)
+	}
+	if m.Accept != nil && !m.Accept(ctx, body.Next) {
+		return fmt.Errorf("%w: no mediation for %s", ErrForbidden, body.Next)
+	}
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	q := &Queued{ID: id, Envelope: inner, Received: time.Now()}
+	if err := m.Queue.Push(ctx, body.Next, q); err != nil {
+		return err
+	}
+	m.log().Debug("DIDComm message queued", "recipient", body.Next, "id", id, "size", len(inner))
+	m.deliverLive(ctx, body.Next, q)
+	return nil
+}
+
+// DeliverLive pushes q to each live session of the recipient. Messages stay
+// queued until the recipient confirms them.
+func (m *Mediator) deliverLive(ctx context.Context, recipient string, q *Queued) {
+	m.mutex.Lock()
+	sessions := make([]*session, 0, len(m.live[recipient]))
+	for s := range m.live[recipient] {
+		sessions = append(sessions, s)
+	}
+	m.mutex.Unlock()
+	if len(sessions) == 0 {
+		return
+	}
+
+	msg, err := NewMessage(DeliveryType, map[string]string{"recipient_did": recipient})
+	if err != nil {
+		return
+	}
+	msg.Attachments = []Attachment{queuedAttachment(q)}
+	envelope, err := m.pack(ctx, msg, recipient)
+	if err != nil {
+		m.log().Warn("DIDComm live delivery failed", "recipient", recipient, "error", err)
+		return
+	}
+	for _, s := range sessions {
+		if err := s.conn.WriteMessage(websocket.TextMessage, envelope); err != nil {
+			m.log().Info("DIDComm live delivery failed", "recipient", recipient, "error", err)
+		}
+	}
+}
+
+func queuedAttachment(q *Queued) Attachment {
+	return Attachment{ID: q.ID, Data: AttachmentData{Base64: base64.RawURLEncoding.EncodeToString(q.Envelope)}}
+}
+
+func (m *Mediator) status(ctx context.Context, req *Message, recipient string, s *session) (*Message, error) {
+	n, err := m.Queue.Len(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	body := StatusBody{MessageCount: n, LiveDelivery: m.isLive(recipient, s)}
+	return req.Reply(StatusType, &body)
+}
+
+func (m *Mediator) delivery(ctx context.Context, req *Message, recipient string, limit int) (*Message, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	queued, err := m.Queue.Peek(ctx, recipient, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(queued) == 0 {
+		// “If no messages are available …, a status message MUST be sent”
+		return m.status(ctx, req, recipient, nil)
+	}
+	r, err := req.Reply(DeliveryType, map[string]string{"recipient_did": recipient})
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queued {
+		r.Attachments = append(r.Attachments, queuedAttachment(q))
+	}
+	return r, nil
+}
+
+func (m *Mediator) setLive(recipient string, s *session, on bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !on {
+		delete(m.live[recipient], s)
+		if len(m.live[recipient]) == 0 {
+			delete(m.live, recipient)
+		}
+		return
+	}
+	if m.live == nil {
+		m.live = make(map[string]map[*session]struct{})
+	}
+	if m.live[recipient] == nil {
+		m.live[recipient] = make(map[*session]struct{})
+	}
+	m.live[recipient][s] = struct{}{}
+}
+
+func (m *Mediator) isLive(recipient string, s *session) bool {
+	if s == nil {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.live[recipient][s]
+	return ok
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (m *Mediator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsUpgrade(r) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			m.log().Info("DIDComm WebSocket upgrade failed", "error", err)
+			return
+		}
+		m.serveSession(r.Context(), conn)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "DIDComm messages require POST", http.StatusMethodNotAllowed)
+		return
+	}
+	envelope, err := io.ReadAll(http.MaxBytesReader(w, r.Body, EnvelopeMax))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	reply, err := m.Handle(r.Context(), envelope)
+	switch {
+	case err == nil:
+		break
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, ErrQueueFull):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, ErrMessage), errors.Is(err, ErrDecrypt):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		m.log().Error("DIDComm message handling failed", "error", err)
+		http.Error(w, "DIDComm message handling failed", http.StatusInternalServerError)
+		return
+	}
+	if reply == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", MediaTypeEncrypted)
+	w.Write(reply)
+}
+
+func (m *Mediator) serveSession(ctx context.Context, conn *websocket.Conn) {
+	s := &session{conn: conn}
+	defer conn.Close()
+	defer func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		for recipient, sessions := range m.live {
+			delete(sessions, s)
+			if len(sessions) == 0 {
+				delete(m.live, recipient)
+			}
+		}
+	}()
+
+	if m.Auth != nil {
+		p, err := m.Auth.AuthenticateConn(ctx, conn)
+		if err != nil {
+			m.log().Info("DIDComm WebSocket authentication failed", "error", err)
+			return
+		}
+		s.did = p.ID
+	}
+	interval := m.PingInterval
+	if interval <= 0 {
+		interval = websocket.PingIntervalDefault
+	}
+	defer conn.KeepAlive(interval)()
+
+	conn.ReadLimit = EnvelopeMax
+	for {
+		_, envelope, err := conn.ReadMessage()
+		if err != nil {
+			var closed *websocket.CloseError
+			if !errors.As(err, &closed) && !errors.Is(err, io.EOF) {
+				m.log().Info("DIDComm WebSocket read failed", "error", err)
+			}
+			return
+		}
+		reply, err := m.handle(ctx, envelope, s)
+		if err != nil {
+			m.log().Info("DIDComm message over WebSocket rejected", "error", err)
+			continue
+		}
+		if reply != nil {
+			if err := conn.WriteMessage(websocket.TextMessage, reply); err != nil {
+				m.log().Info("DIDComm WebSocket write failed", "error", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package didcomm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Message types of Out of Band Messages 2.0 and of Trust Ping 2.0
+const (
+	InvitationType   = "https://didcomm.org/out-of-band/2.0/invitation"
+	PingType         = "https://didcomm.org/trust-ping/2.0/ping"
+	PingResponseType = "https://didcomm.org/trust-ping/2.0/ping-response"
+)
+
+// Profile of DIDComm Messaging v2
+const ProfileV2 = "didcomm/v2"
+
+// InvitationBody is the body of an out-of-band invitation.
+type InvitationBody struct {
+	GoalCode string   `json:"goal_code,omitempty"`
+	Goal     string   `json:"goal,omitempty"`
+	Accept   []string `json:"accept,omitempty"` // DIDComm profiles
+
+	// HandshakeProtocols are the protocols of connection establishment
+	// which the inviter supports, as in Aries RFC 0434, for agents which
+	// need a connection before any request. DIDComm v2 agents may just
+	// send, see AcceptInvitation.
+	HandshakeProtocols []string `json:"handshake_protocols,omitempty"`
+}
+
+// NewInvitation returns an out-of-band invitation from the DID, with each of
+// the requests attached. Requests are plaintext messages for whoever accepts,
+// and they should have no "to" nor "from". The body defaults to an Accept of
+// ProfileV2 only.
+func NewInvitation(from backend.DID, body *InvitationBody, requests ...*Message) (*Message, error) {
+	if body == nil {
+		body = &InvitationBody{Accept: []string{ProfileV2}}
+	}
+	inv, err := NewMessage(InvitationType, body)
+	if err != nil {
+		return nil, err
+	}
+	inv.From = from.String()
+	for _, r := range requests {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		inv.Attachments = append(inv.Attachments, Attachment{
+			ID:        r.ID,
+			MediaType: MediaTypePlain,
+			Data:      AttachmentData{JSON: raw},
+		})
+	}
+	return inv, nil
+}
+
+// InvitationURL returns base with the invitation in the "_oob" query
+// parameter, in base64url.
+func InvitationURL(base string, inv *Message) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(inv)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("_oob", base64.RawURLEncoding.EncodeToString(raw))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// ParseInvitationURL returns the invitation in the "_oob" query parameter of
+// s. Short URLs, with "_oobid", must be resolved by the caller.
+func ParseInvitationURL(s string) (*Message, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invitation URL: %w", ErrMessage, err)
+	}
+	encoded := u.Query().Get("_oob")
+	if encoded == "" {
+		if u.Query().Has("_oobid") {
+			return nil, fmt.Errorf("%w: short invitation URL needs a redirect", ErrMessage)
+		}
+		return nil, fmt.Errorf(`%w: invitation URL has no "_oob" parameter`, ErrMessage)
+	}
+	if len(encoded) > EnvelopeMax {
+		return nil, fmt.Errorf("%w: invitation exceeds %d bytes", ErrMessage, EnvelopeMax)
+	}
+	// base64url per specification, with or without padding
+	encoded = strings.TrimRight(encoded, "=")
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		raw, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invitation base64: %w", ErrMessage, err)
+	}
+	return ParseInvitation(raw)
+}
+
+// ParseInvitation decodes a plaintext invitation, with its body validated.
+func ParseInvitation(plaintext []byte) (*Message, error) {
+	inv, err := ParseMessage(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Type != InvitationType {
+		return nil, fmt.Errorf("%w: message type %q is not an invitation", ErrMessage, inv.Type)
+	}
+	if _, err := backend.Parse(inv.From); err != nil {
+		return nil, fmt.Errorf(`%w: invitation "from" %q: %w`, ErrMessage, inv.From, err)
+	}
+	if _, err := InvitationBodyOf(inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// InvitationBodyOf decodes the body of an invitation.
+func InvitationBodyOf(inv *Message) (*InvitationBody, error) {
+	body := new(InvitationBody)
+	if len(inv.Body) != 0 {
+		if err := json.Unmarshal(inv.Body, body); err != nil {
+			return nil, fmt.Errorf("%w: invitation body: %w", ErrMessage, err)
+		}
+	}
+	return body, nil
+}
+
+// InvitationRequests returns the requests attached to an invitation, with the
+// inviter as their "from" and with the invitation as their parent thread.
+func InvitationRequests(inv *Message) ([]*Message, error) {
+	requests := make([]*Message, 0, len(inv.Attachments))
+	for _, a := range inv.Attachments {
+		content, err := a.Content()
+		if err != nil {
+			return nil, err
+		}
+		r, err := ParseMessage(content)
+		if err != nil {
+			return nil, fmt.Errorf("invitation attachment %q: %w", a.ID, err)
+		}
+		if r.From != "" && r.From != inv.From {
+			return nil, fmt.Errorf("%w: invitation from %q has a request from %q", ErrMessage, inv.From, r.From)
+		}
+		r.From = inv.From
+		if r.ParentThreadID == "" {
+			r.ParentThreadID = inv.ID
+		}
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+// AcceptInvitation returns a trust ping from the DID to the inviter, in a new
+// thread with the invitation as its parent. The response of the inviter
+// confirms the connection.
+func AcceptInvitation(inv *Message, from backend.DID) (*Message, error) {
+	inviter, err := backend.Parse(inv.From)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: invitation "from" %q: %w`, ErrMessage, inv.From, err)
+	}
+	ping, err := NewPing(from, inviter, true)
+	if err != nil {
+		return nil, err
+	}
+	ping.ParentThreadID = inv.ID
+	return ping, nil
+}
+
+// PingBody is the body of a trust ping.
+type PingBody struct {
+	ResponseRequested bool `json:"response_requested"`
+}
+
+// NewPing returns a trust ping from a DID to another.
+func NewPing(from, to backend.DID, responseRequested bool) (*Message, error) {
+	ping, err := NewMessage(PingType, &PingBody{ResponseRequested: responseRequested})
+	if err != nil {
+		return nil, err
+	}
+	ping.From = from.String()
+	ping.To = []string{to.String()}
+	return ping, nil
+}
+
+// PingResponse returns the reply to a trust ping, or nil when the sender
+// requested no response. Responses go to the "from" of the ping, which must
+// be set.
+func PingResponse(ping *Message) (*Message, error) {
+	if ping.Type != PingType {
+		return nil, fmt.Errorf("%w: message type %q is not a trust ping", ErrMessage, ping.Type)
+	}
+	var body struct {
+		ResponseRequested *bool `json:"response_requested"`
+	}
+	if len(ping.Body) != 0 {
+		if err := json.Unmarshal(ping.Body, &body); err != nil {
+			return nil, fmt.Errorf("%w: trust ping body: %w", ErrMessage, err)
+		}
+	}
+	// true by default, per specification
+	if body.ResponseRequested != nil && !*body.ResponseRequested {
+		return nil, nil
+	}
+	if ping.From == "" {
+		return nil, fmt.Errorf(`%w: trust ping without "from" requests a response`, ErrMessage)
+	}
+	return ping.Reply(PingResponseType, struct{}{})
+}
@@ -0,0 +1,93 @@
+package didcomm
+
+import (
+	"context"
+	"log/slog"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+// Link is a DIDComm connection on a WebSocket, with reconnects and keepalive,
+// such as the session of an agent with its mediator. Messages are packed and
+// unpacked by Agent.
+type Link struct {
+	Agent *Agent
+	Peer  backend.DID // recipient of Send
+
+	// Client has the WebSocket URL, with its connection options. Run sets
+	// the Hello and the Receive.
+	Client websocket.Client
+
+	// Audience, when set, answers the challenge of a Mediator with Auth on
+	// each connection, with the Signer of Agent, which must be set.
+	Audience string
+
+	// LiveDelivery requests live delivery, conform Message Pickup 3.0, on
+	// each connection. The Agent must sign.
+	LiveDelivery bool
+
+	// Handle gets each message received, with the outcome of unpacking.
+	Handle func(ctx context.Context, msg *Message, e *Envelope)
+
+	Log *slog.Logger // nil for slog.Default
+}
+
+func (l *Link) log() *slog.Logger {
+	if l.Log != nil {
+		return l.Log
+	}
+	return slog.Default()
+}
+
+// Run connects, and it reconnects after each loss, until ctx is done.
+func (l *Link) Run(ctx context.Context) error {
+	l.Client.Hello = func(ctx context.Context, conn *websocket.Conn) error {
+		if l.Audience != "" {
+			if err := authz.AnswerChallenge(conn, l.Audience, l.Agent.KeyID, l.Agent.Signer); err != nil {
+				return err
+			}
+		}
+		if l.LiveDelivery {
+			req, err := NewMessage(LiveDeliveryChangeType, &PickupBody{LiveDelivery: true})
+			if err != nil {
+				return err
+			}
+			req.From = l.Agent.KeyID.DID.String()
+			req.ReturnRoute = "all"
+			envelope, err := l.Agent.Pack(ctx, req, l.Peer)
+			if err != nil {
+				return err
+			}
+			return conn.WriteMessage(websocket.TextMessage, envelope)
+		}
+		return nil
+	}
+	l.Client.Receive = func(_ int, envelope []byte) {
+		msg, e, err := l.Agent.Unpack(ctx, envelope)
+		if err != nil {
+			l.log().Info("DIDComm message over WebSocket rejected", "error", err)
+			return
+		}
+		if l.Handle != nil {
+			l.Handle(ctx, msg, e)
+		}
+	}
+	if l.Client.Disconnected == nil {
+		l.Client.Disconnected = func(err error) {
+			l.log().Info("DIDComm WebSocket disconnected", "url", l.Client.URL, "error", err)
+		}
+	}
+	return l.Client.Run(ctx)
+}
+
+// Send packs m for Peer, and it writes the envelope on the connection. Without
+// connection, it waits for Run to connect, until ctx is done.
+func (l *Link) Send(ctx context.Context, m *Message) error {
+	envelope, err := l.Agent.Pack(ctx, m, l.Peer)
+	if err != nil {
+		return err
+	}
+	return l.Client.WriteMessage(ctx, websocket.TextMessage, envelope)
+}
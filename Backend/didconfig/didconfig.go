@@ -0,0 +1,261 @@
+// Package didconfig implements the Well Known DID Configuration of DIF, which
+// links DIDs to web origins. The origin serves a resource with “domain linkage
+// credentials”, each of which is issued by the DID it links, about the DID,
+// with the origin as a claim. Credentials come in either format of package vc,
+// i.e., a JWT or a JSON-LD credential with an embedded proof.
+package didconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didweb"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Path is the location of the resource on an origin.
+const Path = "/.well-known/did-configuration.json"
+
+// Context is the JSON-LD context of both the resource and the credentials.
+const Context = "https://identity.foundation/.well-known/did-configuration/v1"
+
+// LinkageType is the credential type of domain linkage.
+const LinkageType = "DomainLinkageCredential"
+
+// DownloadMax is the upper boundary for the byte size of the resource.
+const DownloadMax = 1 << 16
+
+// ErrLinkage signals a DID which is not linked to an origin.
+var ErrLinkage = errors.New("DID not linked to origin")
+
+// Configuration is the DID configuration resource.
+type Configuration struct {
+	Context string `json:"@context"`
+
+	// LinkedDIDs are secured credentials, i.e., either a JSON object with an
+	// embedded proof, or a JWT in a JSON string.
+	LinkedDIDs []json.RawMessage `json:"linked_dids"`
+}
+
+// New returns an empty resource.
+func New() *Configuration {
+	return &Configuration{Context: Context, LinkedDIDs: []json.RawMessage{}}
+}
+
+// Add includes a secured credential, as returned by vc.Issue.
+func (conf *Configuration) Add(secured []byte) error {
+	if len(secured) != 0 && secured[0] == '{' {
+		if !json.Valid(secured) {
+			return errors.New("domain linkage credential is not valid JSON")
+		}
+		conf.LinkedDIDs = append(conf.LinkedDIDs, json.RawMessage(secured))
+		return nil
+	}
+	raw, err := json.Marshal(string(secured))
+	if err != nil {
+		return err
+	}
+	conf.LinkedDIDs = append(conf.LinkedDIDs, raw)
+	return nil
+}
+
+// NewCredential returns a domain linkage credential of did for origin, for
+// vc.Issue. The expiry is mandatory.
+func NewCredential(did backend.DID, origin string, from, until time.Time) (*vc.Credential, error) {
+	origin, err := Origin(origin)
+	if err != nil {
+		return nil, err
+	}
+	from, until = from.UTC().Truncate(time.Second), until.UTC().Truncate(time.Second)
+	return &vc.Credential{
+		Context:        []any{vc.V1, Context},
+		Types:          []string{"VerifiableCredential", LinkageType},
+		Issuer:         vc.Issuer{ID: did.String()},
+		IssuanceDate:   &from,
+		ExpirationDate: &until,
+		Subjects:       vc.Subjects{{"id": did.String(), "origin": origin}},
+	}, nil
+}
+
+// Origin returns the normalized form of a web origin, i.e., a URL with a
+// scheme and a host only.
+func Origin(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("origin: %w", err)
+	}
+	switch {
+	case u.Scheme != "https" && u.Scheme != "http", u.Host == "":
+		return "", fmt.Errorf("origin %q is not an HTTP(S) URL", s)
+	case u.User != nil, u.Path != "" && u.Path != "/", u.RawQuery != "", u.Fragment != "":
+		return "", fmt.Errorf("origin %q has more than a scheme and a host", s)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// Fetch returns the resource of origin. The client defaults to
+// http.DefaultClient when nil.
+func Fetch(ctx context.Context, client *http.Client, origin string) (*Configuration, error) {
+	origin, err := Origin(origin)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DID configuration lookup: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: HTTP %q for DID configuration of %s", ErrLinkage, res.Status, origin)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, DownloadMax+1))
+	if err != nil {
+		return nil, fmt.Errorf("DID configuration of %s unavailable: %w", origin, err)
+	}
+	if len(body) > DownloadMax {
+		return nil, fmt.Errorf("DID configuration of %s exceeds %d bytes", origin, DownloadMax)
+	}
+	conf := new(Configuration)
+	if err := json.Unmarshal(body, conf); err != nil {
+		return nil, fmt.Errorf("DID configuration of %s: %w", origin, err)
+	}
+	if conf.Context != Context {
+		return nil, fmt.Errorf("DID configuration of %s has @context %q", origin, conf.Context)
+	}
+	return conf, nil
+}
+
+// Verify returns nil when one of the credentials links did to origin at time
+// now. Credentials of other DIDs are ignored. The error wraps ErrLinkage, with
+// the reasons of each credential for did, if any.
+func (conf *Configuration) Verify(ctx context.Context, v *vc.Verifier, did backend.DID, origin string, now time.Time) error {
+	origin, err := Origin(origin)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, raw := range conf.LinkedDIDs {
+		secured := []byte(raw)
+		if len(raw) != 0 && raw[0] == '"' {
+			var token string
+			if err := json.Unmarshal(raw, &token); err != nil {
+				errs = append(errs, fmt.Errorf("linked_dids № %d: %w", i+1, err))
+				continue
+			}
+			secured = []byte(token)
+		}
+		if !issuedBy(secured, did) {
+			continue
+		}
+		c, err := v.VerifyCredential(ctx, secured, now)
+		if err == nil {
+			err = checkLinkage(c, secured, did, origin)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("linked_dids № %d: %w", i+1, err))
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: no credential of %s for %s", ErrLinkage, did.String(), origin)
+	}
+	return fmt.Errorf("%w: %w", ErrLinkage, errors.Join(errs...))
+}
+
+// VerifyWeb checks the origin of a did:web to link the DID, as part of trust
+// establishment. The client defaults to http.DefaultClient when nil.
+func VerifyWeb(ctx context.Context, v *vc.Verifier, client *http.Client, did backend.DID, now time.Time) error {
+	u, err := didweb.URL(did)
+	if err != nil {
+		return err
+	}
+	origin := u.Scheme + "://" + u.Host
+	conf, err := Fetch(ctx, client, origin)
+	if err != nil {
+		return err
+	}
+	return conf.Verify(ctx, v, did, origin, now)
+}
+
+// IssuedBy returns whether the unverified issuer of secured is did.
+func issuedBy(secured []byte, did backend.DID) bool {
+	var c struct {
+		Issuer vc.Issuer `json:"issuer"`
+		JWTIss string    `json:"iss"`
+	}
+	if len(secured) != 0 && secured[0] == '{' {
+		if json.Unmarshal(secured, &c) != nil {
+			return false
+		}
+		return did.EqualString(c.Issuer.ID)
+	}
+	jws, err := jose.ParseCompact(string(secured))
+	if err != nil || json.Unmarshal(jws.Payload, &c) != nil {
+		return false
+	}
+	return did.EqualString(c.JWTIss)
+}
+
+// CheckLinkage applies the constraints of domain linkage credentials.
+func checkLinkage(c *vc.Credential, secured []byte, did backend.DID, origin string) error {
+	hasType := false
+	for _, t := range c.Types {
+		hasType = hasType || t == LinkageType
+	}
+	hasContext := false
+	for _, s := range c.Context {
+		hasContext = hasContext || s == Context
+	}
+	switch {
+	case !hasType:
+		return fmt.Errorf("credential type is not %s", LinkageType)
+	case !hasContext:
+		return fmt.Errorf("credential @context has no %s", Context)
+	case c.ExpirationDate == nil && c.ValidUntil == nil:
+		return errors.New("domain linkage credential without expiry")
+	case len(c.Subjects) != 1:
+		return errors.New("domain linkage credential needs exactly one subject")
+	}
+	if id, _ := c.Subjects[0]["id"].(string); !did.EqualString(id) {
+		return fmt.Errorf("credential subject %q is not issuer %s", id, did.String())
+	}
+	s, _ := c.Subjects[0]["origin"].(string)
+	if got, err := Origin(s); err != nil || got != origin {
+		return fmt.Errorf("credential origin %q does not match %s", s, origin)
+	}
+
+	if len(secured) != 0 && secured[0] != '{' {
+		// the subject claim must match too
+		jws, err := jose.ParseCompact(string(secured))
+		if err != nil {
+			return err
+		}
+		var claims struct {
+			Subject string `json:"sub"`
+		}
+		if err := json.Unmarshal(jws.Payload, &claims); err != nil {
+			return err
+		}
+		if !did.EqualString(claims.Subject) {
+			return fmt.Errorf("JWT sub %q is not credential subject %s", claims.Subject, did.String())
+		}
+	}
+	return nil
+}
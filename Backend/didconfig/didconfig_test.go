@@ -0,0 +1,122 @@
+package didconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didweb"
+	"EncrypteDL/IDChain/Backend/example"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+func TestVerifyWeb(t *testing.T) {
+	key, _ := keys.Generate(keys.P256)
+	signer, _ := keys.Signer(key)
+	did := backend.DID{Method: didweb.Method, SpecID: "example.com"}
+	keyID := backend.URL{DID: did, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(keyID, did, signer.Public(), keys.JsonWebKey2020)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &backend.Document{
+		Subject:             did,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		AssertionMethod:     &backend.VerificationRelationship{URIRefs: []*backend.URL{{RawFragment: "#key-1"}}},
+	}
+	docJSON, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	var served []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/did.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/did+json")
+		w.Write(docJSON)
+	})
+	mux.HandleFunc(Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(served)
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+	// the test certificate is valid for example.com
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	client := &http.Client{Transport: transport}
+	v := &vc.Verifier{Resolver: &didweb.Resolver{Client: example.Client{Client: *client}}}
+	ctx := context.Background()
+
+	for _, format := range []vc.Format{vc.JWT, vc.DataIntegrity} {
+		c, err := NewCredential(did, "https://EXAMPLE.com/", now.Add(-time.Hour), now.AddDate(1, 0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		secured, err := vc.Issue(c, signer, &keyID, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := New()
+		if err := conf.Add(secured); err != nil {
+			t.Fatal(err)
+		}
+		served, _ = json.Marshal(conf)
+		if err := VerifyWeb(ctx, v, client, did, now); err != nil {
+			t.Errorf("%s: got error: %s", format, err)
+		}
+		if err := VerifyWeb(ctx, v, client, did, now.AddDate(2, 0, 0)); !errors.Is(err, ErrLinkage) {
+			t.Errorf("%s: expired credential got error %v, want ErrLinkage", format, err)
+		}
+
+		// another origin
+		c.Subjects[0]["origin"] = "https://example.org"
+		secured, err = vc.Issue(c, signer, &keyID, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf = New()
+		conf.Add(secured)
+		served, _ = json.Marshal(conf)
+		if err := VerifyWeb(ctx, v, client, did, now); !errors.Is(err, ErrLinkage) {
+			t.Errorf("%s: credential for another origin got error %v, want ErrLinkage", format, err)
+		}
+	}
+
+	served = []byte(`{"@context": "` + Context + `", "linked_dids": []}`)
+	if err := VerifyWeb(ctx, v, client, did, now); !errors.Is(err, ErrLinkage) {
+		t.Errorf("empty configuration got error %v, want ErrLinkage", err)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	for s, want := range map[string]string{
+		"https://Example.com":      "https://example.com",
+		"https://example.com/":     "https://example.com",
+		"http://example.com:8080":  "http://example.com:8080",
+		"https://example.com/path": "",
+		"https://user@example.com": "",
+		"ftp://example.com":        "",
+		"example.com":              "",
+	} {
+		got, err := Origin(s)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%q got %q, want error", s, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("%q got %q, %v, want %q", s, got, err, want)
+		}
+	}
+}
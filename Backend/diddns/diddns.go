@@ -0,0 +1,79 @@
+// Package diddns discovers DIDs from DNS. A domain binds DIDs with TXT records
+// at the "_did" subdomain, each of which has a DID, optionally prefixed with
+// "did=", as in:
+//
+//	_did.example.com. 3600 IN TXT "did=did:web:example.com"
+//
+// The binding is an assertion of the domain holder that the DID speaks for the
+// domain. DNS without DNSSEC is subject to spoofing. Use an example.Client
+// with DNSOverHTTPS and RequireDNSSEC for authenticated lookups.
+package diddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Label is the subdomain with the DID records.
+const Label = "_did"
+
+// ErrNoBinding signals a domain without a DID binding, or without the DID
+// requested.
+var ErrNoBinding = errors.New("no DID bound to domain in DNS")
+
+// TXTResolver looks up DNS text records. Both net.Resolver and example.Client
+// implement the interface.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Discover returns the DIDs bound to domain, in order of appearance. Records
+// which are not a DID are ignored, as the name may be shared with other uses.
+func Discover(ctx context.Context, r TXTResolver, domain string) ([]backend.DID, error) {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || strings.HasPrefix(domain, ".") {
+		return nil, fmt.Errorf("invalid domain name %q", domain)
+	}
+	texts, err := r.LookupTXT(ctx, Label+"."+domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNoBinding, domain)
+		}
+		return nil, fmt.Errorf("DID discovery for %s: %w", domain, err)
+	}
+
+	var dids []backend.DID
+	for _, s := range texts {
+		s = strings.TrimPrefix(strings.TrimSpace(s), "did=")
+		did, err := backend.Parse(s)
+		if err != nil {
+			continue
+		}
+		dids = append(dids, did)
+	}
+	if len(dids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoBinding, domain)
+	}
+	return dids, nil
+}
+
+// SpeaksFor returns nil when DNS binds did to domain. The error wraps
+// ErrNoBinding when no binding is in place.
+func SpeaksFor(ctx context.Context, r TXTResolver, did backend.DID, domain string) error {
+	dids, err := Discover(ctx, r, domain)
+	if err != nil {
+		return err
+	}
+	for _, bound := range dids {
+		if bound.Equal(did) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s not bound to %s", ErrNoBinding, did.String(), domain)
+}
@@ -0,0 +1,50 @@
+package diddns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Zone maps names to their text records.
+type zone map[string][]string
+
+func (z zone) LookupTXT(_ context.Context, name string) ([]string, error) {
+	texts, ok := z[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return texts, nil
+}
+
+func TestDiscover(t *testing.T) {
+	z := zone{
+		"_did.example.com": {"v=spf1 -all", "did=did:web:example.com", " did:example:123 "},
+		"_did.example.org": {"google-site-verification=x"},
+	}
+	dids, err := Discover(context.Background(), z, "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dids) != 2 || dids[0].String() != "did:web:example.com" || dids[1].String() != "did:example:123" {
+		t.Errorf("got %v", dids)
+	}
+
+	for _, domain := range []string{"example.org", "example.net"} {
+		if _, err := Discover(context.Background(), z, domain); !errors.Is(err, ErrNoBinding) {
+			t.Errorf("%s got error %v, want ErrNoBinding", domain, err)
+		}
+	}
+
+	did := backend.DID{Method: "example", SpecID: "123"}
+	if err := SpeaksFor(context.Background(), z, did, "example.com"); err != nil {
+		t.Errorf("got error: %s", err)
+	}
+	did.SpecID = "456"
+	if err := SpeaksFor(context.Background(), z, did, "example.com"); !errors.Is(err, ErrNoBinding) {
+		t.Errorf("unbound DID got error %v, want ErrNoBinding", err)
+	}
+}
@@ -0,0 +1,576 @@
+// Package didethr implements the did:ethr method, with the ERC-1056 registry
+// on Ethereum as the source of truth. Documents derive from the event history
+// of the registry, such that any version resolves by block number.
+package didethr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/anchor"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/multiformat"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Method is the DID method name.
+const Method = "ethr"
+
+// RegistryDefault is the address of the ERC-1056 deployment on mainnet and
+// most test networks.
+const RegistryDefault = "0xdca7ef03e98e0dc2b855be647c39abe984fcf21b"
+
+// Verification method types
+const (
+	RecoveryMethod  = "EcdsaSecp256k1RecoveryMethod2020"
+	Secp256k1Method = "EcdsaSecp256k1VerificationKey2019"
+)
+
+func keccak(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, p := range data {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// Event topics of the registry
+var (
+	ownerChanged     = "0x" + hex.EncodeToString(keccak([]byte("DIDOwnerChanged(address,address,uint256)")))
+	delegateChanged  = "0x" + hex.EncodeToString(keccak([]byte("DIDDelegateChanged(address,bytes32,address,uint256,uint256)")))
+	attributeChanged = "0x" + hex.EncodeToString(keccak([]byte("DIDAttributeChanged(address,bytes32,bytes,uint256,uint256)")))
+)
+
+// ChangedSelector is the function selector of changed(address).
+var changedSelector = keccak([]byte("changed(address)"))[:4]
+
+// Address returns the Ethereum address of a key, in lower case.
+func Address(pub didkey.Secp256k1PublicKey) (string, error) {
+	jwk, err := keys.JWK(pub)
+	if err != nil {
+		return "", err
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, _ := base64.RawURLEncoding.DecodeString(jwk.Y)
+	return "0x" + hex.EncodeToString(keccak(x, y)[12:]), nil
+}
+
+// Checksum returns the mixed-case encoding of an address, conform EIP-55.
+func Checksum(addr string) string {
+	lower := strings.ToLower(strings.TrimPrefix(addr, "0x"))
+	h := hex.EncodeToString(keccak([]byte(lower)))
+	b := []byte(lower)
+	for i, c := range b {
+		if c >= 'a' && h[i] >= '8' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(b)
+}
+
+// Network is an Ethereum network with a registry.
+type Network struct {
+	ChainID  uint64
+	RPC      *anchor.RPC
+	Registry string // defaults to RegistryDefault
+}
+
+func (n *Network) registry() string {
+	if n.Registry != "" {
+		return strings.ToLower(n.Registry)
+	}
+	return RegistryDefault
+}
+
+// Identifier is a parsed did:ethr.
+type identifier struct {
+	network string
+	address string                    // lower case
+	pub     didkey.Secp256k1PublicKey // nil for address DIDs
+}
+
+var addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+func init() {
+	backend.RegisterMethodSyntax(Method, func(specID string) error {
+		_, err := parse(backend.DID{Method: Method, SpecID: specID})
+		return err
+	})
+}
+
+func parse(did backend.DID) (*identifier, error) {
+	if did.Method != Method {
+		return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	id := &identifier{network: "mainnet"}
+	s := did.SpecID
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		id.network, s = s[:i], s[i+1:]
+	}
+	switch {
+	case addressPattern.MatchString(s):
+		id.address = strings.ToLower(s)
+	case len(s) == 2+66 && strings.HasPrefix(s, "0x"):
+		raw, err := hex.DecodeString(s[2:])
+		if err != nil || !didkey.Secp256k1PublicKey(raw).Valid() {
+			return nil, fmt.Errorf("%w: did:ethr public key %q", backend.ErrInvalid, s)
+		}
+		id.pub = didkey.Secp256k1PublicKey(raw)
+		if id.address, err = Address(id.pub); err != nil {
+			return nil, fmt.Errorf("%w: did:ethr public key: %w", backend.ErrInvalid, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: did:ethr identifier %q is not an address nor a compressed public key", backend.ErrInvalid, s)
+	}
+	return id, nil
+}
+
+// Event is a registry log, decoded.
+type event struct {
+	topic     string
+	block     uint64
+	index     uint64 // log index within block
+	time      time.Time
+	owner     string // ownerChanged
+	delegate  string // delegateChanged
+	name      string // delegate type or attribute name
+	value     []byte // attributeChanged
+	validTo   time.Time
+	prevBlock uint64
+}
+
+// Word returns the 32-byte word i of ABI data.
+func word(data []byte, i int) ([]byte, error) {
+	if len(data) < (i+1)*32 {
+		return nil, fmt.Errorf("did:ethr log data of %d bytes, want word %d", len(data), i)
+	}
+	return data[i*32 : (i+1)*32], nil
+}
+
+func wordAddress(w []byte) string { return "0x" + hex.EncodeToString(w[12:]) }
+
+// WordUint reads an uint256, capped at the maximum of uint64.
+func wordUint(w []byte) uint64 {
+	n := new(big.Int).SetBytes(w)
+	if !n.IsUint64() {
+		return ^uint64(0)
+	}
+	return n.Uint64()
+}
+
+// WordTime reads a Unix timestamp, capped at the maximum of int64.
+func wordTime(w []byte) time.Time {
+	return time.Unix(int64(min(wordUint(w), 1<<63-1)), 0).UTC()
+}
+
+func wordString(w []byte) string { return strings.TrimRight(string(w), "\x00") }
+
+type rpcLog struct {
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+	BlockNumber string   `json:"blockNumber"`
+	LogIndex    string   `json:"logIndex"`
+}
+
+func parseQuantity(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+func decodeLog(l *rpcLog) (*event, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(l.Data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("did:ethr log data: %w", err)
+	}
+	e := &event{topic: l.Topics[0]}
+	if e.block, err = parseQuantity(l.BlockNumber); err != nil {
+		return nil, fmt.Errorf("did:ethr log block number %q", l.BlockNumber)
+	}
+	if e.index, err = parseQuantity(l.LogIndex); err != nil {
+		return nil, fmt.Errorf("did:ethr log index %q", l.LogIndex)
+	}
+
+	var words [5][]byte
+	n := map[string]int{ownerChanged: 2, delegateChanged: 4, attributeChanged: 4}[e.topic]
+	for i := 0; i < n; i++ {
+		if words[i], err = word(data, i); err != nil {
+			return nil, err
+		}
+	}
+	switch e.topic {
+	case ownerChanged:
+		e.owner, e.prevBlock = wordAddress(words[0]), wordUint(words[1])
+	case delegateChanged:
+		e.name, e.delegate = wordString(words[0]), wordAddress(words[1])
+		e.validTo, e.prevBlock = wordTime(words[2]), wordUint(words[3])
+	case attributeChanged:
+		e.name, e.validTo, e.prevBlock = wordString(words[0]), wordTime(words[2]), wordUint(words[3])
+		offset := wordUint(words[1])
+		if offset > uint64(len(data)) || offset%32 != 0 {
+			return nil, fmt.Errorf("did:ethr attribute value offset %d", offset)
+		}
+		size, err := word(data, int(offset/32))
+		if err != nil {
+			return nil, err
+		}
+		start := offset + 32
+		if wordUint(size) > uint64(len(data))-start {
+			return nil, fmt.Errorf("did:ethr attribute value of %d bytes exceeds log data", wordUint(size))
+		}
+		e.value = data[start : start+wordUint(size)]
+	}
+	return e, nil
+}
+
+// Resolver implements the “Read” operation of did:ethr, including versions.
+// Multiple goroutines may invoke methods on a Resolver simultaneously.
+type Resolver struct {
+	// Networks by name, as in DIDs, e.g., "mainnet", "sepolia" or "0xaa36a7".
+	// DIDs without a network name are on "mainnet".
+	Networks map[string]*Network
+
+	Now func() time.Time // defaults to time.Now
+}
+
+func (r *Resolver) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *Resolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return r.ResolveVersion(ctx, did, "", time.Time{})
+}
+
+// ResolveVersion implements the backend.VersionResolver interface. Version
+// identifiers are block numbers in decimal.
+func (r *Resolver) ResolveVersion(ctx context.Context, did backend.DID, versionID string, versionTime time.Time) (*backend.Document, *backend.Meta, error) {
+	id, err := parse(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	network, ok := r.Networks[id.network]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: did:ethr network %q not configured", backend.ErrMethodNotSupported, id.network)
+	}
+	var versionBlock uint64
+	if versionID != "" {
+		versionBlock, err = strconv.ParseUint(versionID, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: did:ethr version %q is not a block number", backend.ErrInvalid, versionID)
+		}
+	}
+
+	history, err := r.history(ctx, network, id.address)
+	if err != nil {
+		return nil, nil, err
+	}
+	// cut at the version
+	at := r.now()
+	if versionID != "" || !versionTime.IsZero() {
+		at = versionTime
+	}
+	n := 0
+	for n < len(history) {
+		e := history[n]
+		if versionID != "" && e.block > versionBlock || !versionTime.IsZero() && e.time.After(versionTime) {
+			break
+		}
+		n++
+	}
+	if versionID != "" {
+		if n == 0 || history[n-1].block != versionBlock {
+			return nil, nil, fmt.Errorf("%w: did:ethr %s has no change in block %d", backend.ErrNotFound, did.String(), versionBlock)
+		}
+		if versionTime.IsZero() {
+			at = history[n-1].time
+		}
+	}
+
+	meta := new(backend.Meta)
+	if n != 0 {
+		meta.VersionID = strconv.FormatUint(history[n-1].block, 10)
+		meta.Updated = history[n-1].time
+	}
+	for _, e := range history[n:] {
+		if meta.VersionID == "" || e.block != history[n-1].block {
+			meta.NextVersionID = strconv.FormatUint(e.block, 10)
+			meta.NextUpdate = e.time
+			break
+		}
+	}
+	doc, deactivated, err := document(did, id, network.ChainID, history[:n], at)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deactivated {
+		meta.Deactivated = meta.Updated
+	}
+	return doc, meta, nil
+}
+
+// History returns the registry events of an identity in chronological order,
+// with their block time.
+func (r *Resolver) history(ctx context.Context, network *Network, address string) ([]*event, error) {
+	data := "0x" + hex.EncodeToString(changedSelector) + strings.Repeat("0", 24) + address[2:]
+	var changed string
+	call := map[string]string{"to": network.registry(), "data": data}
+	if err := network.RPC.Call(ctx, &changed, "eth_call", call, "latest"); err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(changed, "0x"))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("did:ethr changed(address) result %q", changed)
+	}
+
+	var history []*event
+	times := make(map[uint64]time.Time)
+	identityTopic := "0x" + strings.Repeat("0", 24) + address[2:]
+	for block := wordUint(raw); block != 0; {
+		filter := map[string]any{
+			"address":   network.registry(),
+			"fromBlock": "0x" + strconv.FormatUint(block, 16),
+			"toBlock":   "0x" + strconv.FormatUint(block, 16),
+			"topics":    []any{[]string{ownerChanged, delegateChanged, attributeChanged}, identityTopic},
+		}
+		var logs []*rpcLog
+		if err := network.RPC.Call(ctx, &logs, "eth_getLogs", filter); err != nil {
+			return nil, err
+		}
+		var events []*event
+		var prev uint64
+		for _, l := range logs {
+			if len(l.Topics) != 2 || !strings.EqualFold(l.Topics[1], identityTopic) {
+				continue
+			}
+			e, err := decodeLog(l)
+			if err != nil {
+				return nil, err
+			}
+			if e.block != block {
+				return nil, fmt.Errorf("did:ethr log of block %d for block %d", e.block, block)
+			}
+			if e.prevBlock < block {
+				prev = e.prevBlock
+			}
+			events = append(events, e)
+		}
+		if len(events) == 0 {
+			return nil, fmt.Errorf("did:ethr registry change in block %d without events", block)
+		}
+
+		t, ok := times[block]
+		if !ok {
+			var b struct {
+				Timestamp string `json:"timestamp"`
+			}
+			if err := network.RPC.Call(ctx, &b, "eth_getBlockByNumber", "0x"+strconv.FormatUint(block, 16), false); err != nil {
+				return nil, err
+			}
+			unix, err := parseQuantity(b.Timestamp)
+			if err != nil {
+				return nil, fmt.Errorf("did:ethr block %d timestamp %q", block, b.Timestamp)
+			}
+			t = time.Unix(int64(unix), 0).UTC()
+			times[block] = t
+		}
+		for _, e := range events {
+			e.time = t
+		}
+		// blocks in reverse; logs in order within
+		history = append(events, history...)
+		block = prev
+	}
+	return history, nil
+}
+
+// AttributePattern matches names like "did/pub/Ed25519/veriKey/base64".
+var attributePattern = regexp.MustCompile(`^did/(pub|svc)/(\w+)(/(\w+))?(/(\w+))?$`)
+
+// Document applies the history conform the reference implementation, with
+// delegates and attributes valid at time at.
+func document(did backend.DID, id *identifier, chainID uint64, history []*event, at time.Time) (doc *backend.Document, deactivated bool, err error) {
+	owner := id.address
+	type entry struct {
+		key    string // event index
+		method *backend.VerificationMethod
+		auth   bool
+		enc    bool
+	}
+	var methods []entry
+	var services []struct {
+		key     string
+		service *backend.Service
+	}
+	var delegates, serviceCount int
+	for _, e := range history {
+		switch e.topic {
+		case ownerChanged:
+			owner = e.owner
+			continue
+		}
+
+		key := e.topic + "-" + e.name + "-" + e.delegate + "-" + hex.EncodeToString(e.value)
+		match := attributePattern.FindStringSubmatch(e.name)
+		isService := e.topic == attributeChanged && match != nil && match[1] == "svc"
+		if e.topic == attributeChanged && match == nil {
+			continue // other attribute
+		}
+		if isService {
+			serviceCount++
+		} else {
+			delegates++
+		}
+		for i := range methods {
+			if methods[i].key == key {
+				methods = append(methods[:i], methods[i+1:]...)
+				break
+			}
+		}
+		for i := range services {
+			if services[i].key == key {
+				services = append(services[:i], services[i+1:]...)
+				break
+			}
+		}
+		if e.validTo.Before(at) {
+			continue // revoked or expired
+		}
+
+		if isService {
+			srv, err := attributeService(did, serviceCount, match[2], e.value)
+			if err != nil {
+				continue // malformed attribute
+			}
+			services = append(services, struct {
+				key     string
+				service *backend.Service
+			}{key, srv})
+			continue
+		}
+		m := &backend.VerificationMethod{
+			ID:         backend.URL{DID: did, RawFragment: "#delegate-" + strconv.Itoa(delegates)},
+			Controller: did,
+		}
+		var purpose string
+		if e.topic == delegateChanged {
+			purpose = e.name
+			m.Type = RecoveryMethod
+			m.Additional = additional("blockchainAccountId", fmt.Sprintf("eip155:%d:%s", chainID, Checksum(e.delegate)))
+		} else {
+			purpose = match[4]
+			var ok bool
+			if m.Type, m.Additional, ok = attributeKey(match[2], purpose, match[6], e.value); !ok {
+				continue
+			}
+		}
+		switch purpose {
+		case "veriKey", "sigAuth", "enc":
+			methods = append(methods, entry{key, m, purpose == "sigAuth", purpose == "enc"})
+		}
+	}
+
+	doc = &backend.Document{Subject: did}
+	if owner == "0x"+strings.Repeat("0", 40) {
+		return doc, true, nil
+	}
+	controller := &backend.VerificationMethod{
+		ID:         backend.URL{DID: did, RawFragment: "#controller"},
+		Type:       RecoveryMethod,
+		Controller: did,
+		Additional: additional("blockchainAccountId", fmt.Sprintf("eip155:%d:%s", chainID, Checksum(owner))),
+	}
+	doc.VerificationMethods = []*backend.VerificationMethod{controller}
+	doc.Authentication = &backend.VerificationRelationship{URIRefs: []*backend.URL{&controller.ID}}
+	doc.AssertionMethod = &backend.VerificationRelationship{URIRefs: []*backend.URL{&controller.ID}}
+	if id.pub != nil && owner == id.address {
+		m := &backend.VerificationMethod{
+			ID:         backend.URL{DID: did, RawFragment: "#controllerKey"},
+			Type:       Secp256k1Method,
+			Controller: did,
+			Additional: additional("publicKeyHex", hex.EncodeToString(id.pub)),
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+		doc.Authentication.URIRefs = append(doc.Authentication.URIRefs, &m.ID)
+		doc.AssertionMethod.URIRefs = append(doc.AssertionMethod.URIRefs, &m.ID)
+	}
+	for _, e := range methods {
+		doc.VerificationMethods = append(doc.VerificationMethods, e.method)
+		if e.enc {
+			if doc.KeyAgreement == nil {
+				doc.KeyAgreement = new(backend.VerificationRelationship)
+			}
+			doc.KeyAgreement.URIRefs = append(doc.KeyAgreement.URIRefs, &e.method.ID)
+			continue
+		}
+		doc.AssertionMethod.URIRefs = append(doc.AssertionMethod.URIRefs, &e.method.ID)
+		if e.auth {
+			doc.Authentication.URIRefs = append(doc.Authentication.URIRefs, &e.method.ID)
+		}
+	}
+	for _, s := range services {
+		doc.Services = append(doc.Services, s.service)
+	}
+	return doc, false, nil
+}
+
+func additional(property, value string) map[string]json.RawMessage {
+	raw, _ := json.Marshal(value)
+	return map[string]json.RawMessage{property: raw}
+}
+
+// AttributeKey returns the verification method type and the key property of
+// a "did/pub" attribute.
+func attributeKey(algorithm, purpose, encoding string, value []byte) (string, map[string]json.RawMessage, bool) {
+	var typ string
+	switch {
+	case algorithm == "Secp256k1" && purpose != "enc":
+		typ = Secp256k1Method
+	case algorithm == "Ed25519" && purpose != "enc":
+		typ = "Ed25519VerificationKey2018"
+	case algorithm == "X25519" && purpose == "enc":
+		typ = "X25519KeyAgreementKey2019"
+	default:
+		return "", nil, false
+	}
+	switch encoding {
+	case "", "hex":
+		return typ, additional("publicKeyHex", hex.EncodeToString(value)), true
+	case "base64":
+		return typ, additional("publicKeyBase64", base64.StdEncoding.EncodeToString(value)), true
+	case "base58":
+		return typ, additional("publicKeyBase58", multiformat.Encode(multiformat.Base58BTC, value)[1:]), true
+	}
+	return "", nil, false
+}
+
+// AttributeService returns the service of a "did/svc" attribute. Values are
+// either a URI, or a JSON endpoint.
+func attributeService(did backend.DID, n int, typ string, value []byte) (*backend.Service, error) {
+	id, err := url.Parse(did.String() + "#service-" + strconv.Itoa(n))
+	if err != nil {
+		return nil, err
+	}
+	s := &backend.Service{ID: *id, Types: []string{typ}}
+	endpoint := value
+	if !json.Valid(value) {
+		endpoint, _ = json.Marshal(string(value))
+	}
+	if err := json.Unmarshal(endpoint, &s.Endpoint); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
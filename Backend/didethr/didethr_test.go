@@ -0,0 +1,227 @@
+package didethr
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/anchor"
+	"EncrypteDL/IDChain/Backend/didkey"
+)
+
+func TestAddress(t *testing.T) {
+	// public key of private key 1
+	pub, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	addr, err := Address(didkey.Secp256k1PublicKey(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Checksum(addr), "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"; got != want {
+		t.Errorf("got address %s, want %s", got, want)
+	}
+	// EIP-55 test vector
+	if got, want := Checksum("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"), "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"; got != want {
+		t.Errorf("got checksum %s, want %s", got, want)
+	}
+
+	for _, s := range []string{"0x123", "goerli:0xzz5f4552091a69125d5dfcb7b8c2659029395bdf", "0x0379be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ff"} {
+		if _, err := parse(backend.DID{Method: Method, SpecID: s}); !errors.Is(err, backend.ErrInvalid) {
+			t.Errorf("%s got error %v, want ErrInvalid", s, err)
+		}
+	}
+}
+
+// Registry is a fake node with the event logs of one identity.
+type registry struct {
+	identity string
+	logs     map[uint64][]map[string]any // by block
+	times    map[uint64]int64
+}
+
+func (reg *registry) changed() uint64 {
+	var last uint64
+	for b := range reg.logs {
+		last = max(last, b)
+	}
+	return last
+}
+
+func abiWord(v any) string {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			return strings.Repeat("0", 24) + v[2:]
+		}
+		return hex.EncodeToString([]byte(v)) + strings.Repeat("0", 64-2*len(v))
+	case uint64:
+		return hex.EncodeToString(new(big.Int).SetUint64(v).FillBytes(make([]byte, 32)))
+	}
+	panic("word type")
+}
+
+// Add registers an event in block with the ABI-encoded arguments, where a
+// []byte argument is the dynamic value.
+func (reg *registry) add(block uint64, topic string, args ...any) {
+	var prev uint64 // previous change
+	for b := range reg.logs {
+		if b <= block {
+			prev = max(prev, b)
+		}
+	}
+	var head, tail string
+	for _, a := range args {
+		if b, ok := a.([]byte); ok {
+			head += abiWord(uint64(len(args)+1) * 32)
+			tail = abiWord(uint64(len(b))) + hex.EncodeToString(b)
+			tail += strings.Repeat("0", (64-len(tail)%64)%64)
+			continue
+		}
+		head += abiWord(a)
+	}
+	head += abiWord(prev)
+
+	reg.logs[block] = append(reg.logs[block], map[string]any{
+		"topics":      []string{topic, "0x" + abiWord(reg.identity)},
+		"data":        "0x" + head + tail,
+		"blockNumber": "0x" + strconv.FormatUint(block, 16),
+		"logIndex":    "0x" + strconv.Itoa(len(reg.logs[block])),
+	})
+	reg.times[block] = 1_600_000_000 + int64(block)*12
+}
+
+func (reg *registry) serve(t *testing.T) *anchor.RPC {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64             `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error("fake node got malformed request:", err)
+		}
+		var result any
+		switch req.Method {
+		case "eth_call":
+			var call struct{ To, Data string }
+			json.Unmarshal(req.Params[0], &call)
+			if call.To != RegistryDefault || !strings.HasPrefix(call.Data, "0xf96d0f9f") {
+				t.Errorf("fake node got call %+v", call)
+			}
+			if strings.HasSuffix(call.Data, reg.identity[2:]) {
+				result = "0x" + abiWord(reg.changed())
+			} else {
+				result = "0x" + abiWord(uint64(0))
+			}
+		case "eth_getLogs":
+			var filter struct{ FromBlock, ToBlock string }
+			json.Unmarshal(req.Params[0], &filter)
+			block, _ := parseQuantity(filter.FromBlock)
+			if filter.ToBlock != filter.FromBlock {
+				t.Errorf("fake node got logs filter %+v", filter)
+			}
+			result = reg.logs[block]
+		case "eth_getBlockByNumber":
+			var s string
+			json.Unmarshal(req.Params[0], &s)
+			block, _ := parseQuantity(s)
+			result = map[string]any{"timestamp": "0x" + strconv.FormatInt(reg.times[block], 16)}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return &anchor.RPC{URL: srv.URL}
+}
+
+func TestResolve(t *testing.T) {
+	const identity = "0xb9c5714089478a327f09197987f16f9e5d936e8a"
+	const delegate = "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+	reg := &registry{identity: identity, logs: make(map[uint64][]map[string]any), times: make(map[uint64]int64)}
+	never := uint64(1 << 62)
+	reg.add(100, attributeChanged, "did/pub/Ed25519/veriKey/base64", make([]byte, 32), never)
+	reg.add(200, delegateChanged, "sigAuth", delegate, never)
+	reg.add(300, attributeChanged, "did/svc/HubService", []byte("https://hub.example.com/"), never)
+	reg.add(300, attributeChanged, "did/pub/Ed25519/veriKey/base64", make([]byte, 32), uint64(0))
+	r := &Resolver{Networks: map[string]*Network{"mainnet": {ChainID: 1, RPC: reg.serve(t)}}}
+	ctx := context.Background()
+	did := backend.DID{Method: Method, SpecID: identity}
+
+	doc, meta, err := r.Resolve(ctx, did)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	if meta.VersionID != "300" || meta.Updated.Unix() != reg.times[300] || meta.NextVersionID != "" {
+		t.Errorf("got meta %+v", meta)
+	}
+	if len(doc.VerificationMethods) != 2 || doc.VerificationMethods[1].ID.RawFragment != "#delegate-2" {
+		t.Fatalf("got verification methods %+v", doc.VerificationMethods)
+	}
+	want := "eip155:1:" + Checksum(identity)
+	if got := doc.VerificationMethods[0].AdditionalString("blockchainAccountId"); got != want {
+		t.Errorf("controller got account %q, want %q", got, want)
+	}
+	if len(doc.Authentication.URIRefs) != 2 || len(doc.AssertionMethod.URIRefs) != 2 {
+		t.Errorf("got authentication %+v, assertion %+v", doc.Authentication, doc.AssertionMethod)
+	}
+	if len(doc.Services) != 1 || doc.Services[0].ID.Fragment != "service-1" || doc.Services[0].Types[0] != "HubService" {
+		t.Errorf("got services %+v", doc.Services)
+	}
+
+	// version with the key, before revocation
+	doc, meta, err = r.ResolveVersion(ctx, did, "200", time.Time{})
+	if err != nil {
+		t.Fatal("resolve version error:", err)
+	}
+	if meta.VersionID != "200" || meta.NextVersionID != "300" || meta.NextUpdate.Unix() != reg.times[300] {
+		t.Errorf("version 200 got meta %+v", meta)
+	}
+	if len(doc.VerificationMethods) != 3 || doc.VerificationMethods[1].AdditionalString("publicKeyBase64") == "" || len(doc.Services) != 0 {
+		t.Errorf("version 200 got document %+v", doc)
+	}
+	_, meta, err = r.ResolveVersion(ctx, did, "", time.Unix(reg.times[100]+1, 0))
+	if err != nil || meta.VersionID != "100" || meta.NextVersionID != "200" {
+		t.Errorf("version time got meta %+v, error %v", meta, err)
+	}
+	if _, _, err := r.ResolveVersion(ctx, did, "250", time.Time{}); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("version without change got error %v, want ErrNotFound", err)
+	}
+
+	// public key without changes
+	pubDID := backend.DID{Method: Method, SpecID: "0x0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"}
+	doc, meta, err = r.Resolve(ctx, pubDID)
+	if err != nil || meta.VersionID != "" || len(doc.VerificationMethods) != 2 || doc.VerificationMethods[1].ID.RawFragment != "#controllerKey" {
+		t.Errorf("public key got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+	if _, _, err := r.Resolve(ctx, backend.DID{Method: Method, SpecID: "sepolia:" + identity}); !errors.Is(err, backend.ErrMethodNotSupported) {
+		t.Errorf("unknown network got error %v, want ErrMethodNotSupported", err)
+	}
+
+	// owner to zero address
+	reg.add(400, ownerChanged, "0x"+strings.Repeat("0", 40))
+	doc, meta, err = r.Resolve(ctx, did)
+	if err != nil || meta.Deactivated.IsZero() || len(doc.VerificationMethods) != 0 {
+		t.Errorf("deactivated got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+}
+
+func TestMethodSyntax(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"did:ethr:0xb9c5714089478a327f09197987f16f9e5d936e8a":         true,
+		"did:ethr:sepolia:0xb9c5714089478a327f09197987f16f9e5d936e8a": true,
+		"did:ethr:0xb9c5714089478a327f09197987f16f9e5d936e8":          false,
+		"did:ethr:0xz9c5714089478a327f09197987f16f9e5d936e8a":         false,
+	} {
+		err := backend.ValidateMethodSyntax(backend.MustParse(s))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, backend.ErrInvalid)) {
+			t.Errorf("%s got error %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+// Package didion implements the did:ion method, which is the Sidetree
+// protocol on Bitcoin. Published DIDs resolve with a Sidetree node. Long-form
+// DIDs carry their initial state, and they resolve without any network when
+// not published [yet].
+package didion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/multiformat"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Method is the DID method name.
+const Method = "ion"
+
+// ErrCommitment signals a long-form DID with an initial state which does not
+// match its hash commitments. The error wraps backend.ErrInvalid.
+var ErrCommitment = fmt.Errorf("%w: did:ion initial state does not match its commitments", backend.ErrInvalid)
+
+// ResponseMax is the size limit of Sidetree node responses.
+const ResponseMax = 1 << 20
+
+// Patch actions
+const (
+	Replace          = "replace"
+	AddPublicKeys    = "add-public-keys"
+	RemovePublicKeys = "remove-public-keys"
+	AddServices      = "add-services"
+	RemoveServices   = "remove-services"
+)
+
+// PublicKey is a key entry of the document state.
+type PublicKey struct {
+	ID       string          `json:"id"` // fragment
+	Type     string          `json:"type"`
+	JWK      json.RawMessage `json:"publicKeyJwk"`
+	Purposes []string        `json:"purposes,omitempty"` // verification relationships
+}
+
+// Service is a service entry of the document state.
+type Service struct {
+	ID       string          `json:"id"` // fragment
+	Type     string          `json:"type"`
+	Endpoint json.RawMessage `json:"serviceEndpoint"`
+}
+
+// State is the document state of Sidetree, as opposed to a DID document.
+type State struct {
+	PublicKeys []PublicKey `json:"publicKeys,omitempty"`
+	Services   []Service   `json:"services,omitempty"`
+}
+
+// Patch is a modification of the State.
+type Patch struct {
+	Action     string      `json:"action"`
+	Document   *State      `json:"document,omitempty"`   // Replace
+	PublicKeys []PublicKey `json:"publicKeys,omitempty"` // AddPublicKeys
+	Services   []Service   `json:"services,omitempty"`   // AddServices
+	IDs        []string    `json:"ids,omitempty"`        // RemovePublicKeys and RemoveServices
+}
+
+// Delta has the changes of an operation.
+type Delta struct {
+	Patches          []Patch `json:"patches"`
+	UpdateCommitment string  `json:"updateCommitment"`
+}
+
+// SuffixData is the part of a create operation which the DID commits to.
+type SuffixData struct {
+	DeltaHash          string `json:"deltaHash"`
+	RecoveryCommitment string `json:"recoveryCommitment"`
+	Type               string `json:"type,omitempty"`
+}
+
+// InitialState is the create operation, which long-form DIDs encode.
+type InitialState struct {
+	SuffixData SuffixData `json:"suffixData"`
+	Delta      Delta      `json:"delta"`
+}
+
+// Hash returns the Sidetree hash of v, which is the base64url encoding of
+// the SHA-256 multihash over the JSON Canonicalization Scheme of v.
+func Hash(v any) (string, error) {
+	c, err := vc.Canonicalize(v)
+	if err != nil {
+		return "", err
+	}
+	return encodeMultihash(sha256.Sum256(c)), nil
+}
+
+func encodeMultihash(digest [sha256.Size]byte) string {
+	return base64.RawURLEncoding.EncodeToString(multiformat.EncodeMultihash(multiformat.SHA2_256, digest[:]))
+}
+
+// Commitment returns the commitment to an update or recovery key, which is
+// the double hash of the JWK as in the ION reference implementation.
+func Commitment(jwk any) (string, error) {
+	c, err := vc.Canonicalize(jwk)
+	if err != nil {
+		return "", err
+	}
+	reveal := sha256.Sum256(c)
+	return encodeMultihash(sha256.Sum256(reveal[:])), nil
+}
+
+// CheckMultihash validates an encoded SHA-256 multihash.
+func checkMultihash(s string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	code, digest, err := multiformat.DecodeMultihash(raw)
+	if err != nil {
+		return err
+	}
+	if code != multiformat.SHA2_256 || len(digest) != sha256.Size {
+		return fmt.Errorf("multihash code %#x of %d bytes, want SHA-256", code, len(digest))
+	}
+	return nil
+}
+
+// NewLongForm returns both the short-form and the long-form DID of a create
+// operation. The network is empty for mainnet, e.g., "test" for testnet.
+func NewLongForm(network string, s *InitialState) (short, long backend.DID, err error) {
+	if s.SuffixData.DeltaHash == "" {
+		s.SuffixData.DeltaHash, err = Hash(&s.Delta)
+		if err != nil {
+			return backend.DID{}, backend.DID{}, err
+		}
+	}
+	suffix, err := Hash(&s.SuffixData)
+	if err != nil {
+		return backend.DID{}, backend.DID{}, err
+	}
+	c, err := vc.Canonicalize(s)
+	if err != nil {
+		return backend.DID{}, backend.DID{}, err
+	}
+	if network != "" {
+		suffix = network + ":" + suffix
+	}
+	short = backend.DID{Method: Method, SpecID: suffix}
+	long = backend.DID{Method: Method, SpecID: suffix + ":" + base64.RawURLEncoding.EncodeToString(c)}
+	return short, long, nil
+}
+
+// Split returns the short form of did, and the initial state of long-form
+// DIDs, which is nil for short-form ones. The commitments of the initial
+// state are verified.
+func Split(did backend.DID) (short backend.DID, initial *InitialState, err error) {
+	if did.Method != Method {
+		return backend.DID{}, nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	segs := strings.Split(did.SpecID, ":")
+	var network string // a suffix is never a network name
+	if len(segs) > 1 && checkMultihash(segs[0]) != nil {
+		network, segs = segs[0], segs[1:]
+	}
+	if len(segs) > 2 {
+		return backend.DID{}, nil, fmt.Errorf("%w: did:ion identifier %q", backend.ErrInvalid, did.SpecID)
+	}
+	suffix := segs[0]
+	if err := checkMultihash(suffix); err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: did:ion suffix %q: %w", backend.ErrInvalid, suffix, err)
+	}
+	short = backend.DID{Method: Method, SpecID: suffix}
+	if network != "" {
+		short.SpecID = network + ":" + suffix
+	}
+	if len(segs) == 1 {
+		return short, nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(segs[1])
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: did:ion long-form encoding: %w", backend.ErrInvalid, err)
+	}
+	// hashes apply to the JSON as is
+	var encoded struct {
+		SuffixData json.RawMessage `json:"suffixData"`
+		Delta      json.RawMessage `json:"delta"`
+	}
+	initial = new(InitialState)
+	err = json.Unmarshal(raw, &encoded)
+	if err == nil {
+		err = json.Unmarshal(encoded.SuffixData, &initial.SuffixData)
+	}
+	if err == nil {
+		err = json.Unmarshal(encoded.Delta, &initial.Delta)
+	}
+	if err != nil {
+		return backend.DID{}, nil, fmt.Errorf("%w: did:ion long-form state: %w", backend.ErrInvalid, err)
+	}
+	if got, err := Hash(encoded.SuffixData); err != nil || got != suffix {
+		return backend.DID{}, nil, fmt.Errorf("%w: suffix data hashes to %s", ErrCommitment, got)
+	}
+	if got, err := Hash(encoded.Delta); err != nil || got != initial.SuffixData.DeltaHash {
+		return backend.DID{}, nil, fmt.Errorf("%w: delta hashes to %s, want %s", ErrCommitment, got, initial.SuffixData.DeltaHash)
+	}
+	for _, c := range []string{initial.SuffixData.RecoveryCommitment, initial.Delta.UpdateCommitment} {
+		if err := checkMultihash(c); err != nil {
+			return backend.DID{}, nil, fmt.Errorf("%w: commitment %q: %w", ErrCommitment, c, err)
+		}
+	}
+	return short, initial, nil
+}
+
+// Apply returns the state after patches, or an error for invalid patches.
+func Apply(s State, patches []Patch) (State, error) {
+	for i, p := range patches {
+		switch p.Action {
+		case Replace:
+			if p.Document == nil {
+				return State{}, fmt.Errorf("did:ion patch № %d: replace without document", i+1)
+			}
+			s = State{}
+			s.PublicKeys = append(s.PublicKeys, p.Document.PublicKeys...)
+			s.Services = append(s.Services, p.Document.Services...)
+		case AddPublicKeys:
+			for _, k := range p.PublicKeys {
+				s.PublicKeys = append(removeByID(s.PublicKeys, []string{k.ID}), k)
+			}
+		case RemovePublicKeys:
+			s.PublicKeys = removeByID(s.PublicKeys, p.IDs)
+		case AddServices:
+			for _, srv := range p.Services {
+				s.Services = append(removeByID(s.Services, []string{srv.ID}), srv)
+			}
+		case RemoveServices:
+			s.Services = removeByID(s.Services, p.IDs)
+		default:
+			return State{}, fmt.Errorf("did:ion patch № %d: action %q not supported", i+1, p.Action)
+		}
+	}
+	return s, s.validate()
+}
+
+func removeByID[T PublicKey | Service](entries []T, ids []string) []T {
+	var kept []T
+	for _, e := range entries {
+		var id string
+		switch e := any(e).(type) {
+		case PublicKey:
+			id = e.ID
+		case Service:
+			id = e.ID
+		}
+		removed := false
+		for _, r := range ids {
+			removed = removed || r == id
+		}
+		if !removed {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// IsID returns whether s is a valid key or service identifier.
+func isID(s string) bool {
+	if s == "" || len(s) > 50 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+var purposes = map[string]bool{"authentication": true, "assertionMethod": true, "capabilityInvocation": true, "capabilityDelegation": true, "keyAgreement": true}
+
+func (s *State) validate() error {
+	seen := make(map[string]bool)
+	for _, k := range s.PublicKeys {
+		if !isID(k.ID) || seen[k.ID] {
+			return fmt.Errorf("did:ion public key id %q invalid or duplicate", k.ID)
+		}
+		seen[k.ID] = true
+		if k.Type == "" || len(k.JWK) == 0 || k.JWK[0] != '{' {
+			return fmt.Errorf("did:ion public key %q without type or JWK", k.ID)
+		}
+		for _, p := range k.Purposes {
+			if !purposes[p] {
+				return fmt.Errorf("did:ion public key %q purpose %q unknown", k.ID, p)
+			}
+		}
+	}
+	clear(seen)
+	for _, srv := range s.Services {
+		if !isID(srv.ID) || seen[srv.ID] {
+			return fmt.Errorf("did:ion service id %q invalid or duplicate", srv.ID)
+		}
+		seen[srv.ID] = true
+		if srv.Type == "" || len(srv.Type) > 30 || len(srv.Endpoint) == 0 || srv.Endpoint[0] == '[' {
+			return fmt.Errorf("did:ion service %q without type or with malformed endpoint", srv.ID)
+		}
+	}
+	return nil
+}
+
+// Document returns the DID document of a state.
+func (s *State) Document(did backend.DID) (*backend.Document, error) {
+	doc := &backend.Document{Subject: did}
+	for _, k := range s.PublicKeys {
+		m := &backend.VerificationMethod{
+			ID:         backend.URL{DID: did, RawFragment: "#" + k.ID},
+			Type:       k.Type,
+			Controller: did,
+			Additional: map[string]json.RawMessage{"publicKeyJwk": k.JWK},
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+		for _, p := range k.Purposes {
+			r := relationship(doc, p)
+			if *r == nil {
+				*r = new(backend.VerificationRelationship)
+			}
+			(*r).URIRefs = append((*r).URIRefs, &m.ID)
+		}
+	}
+	for _, srv := range s.Services {
+		id, err := url.Parse(did.String() + "#" + srv.ID)
+		if err != nil {
+			return nil, err
+		}
+		e := &backend.Service{ID: *id, Types: []string{srv.Type}}
+		if err := json.Unmarshal(srv.Endpoint, &e.Endpoint); err != nil {
+			return nil, fmt.Errorf("did:ion service %q endpoint: %w", srv.ID, err)
+		}
+		doc.Services = append(doc.Services, e)
+	}
+	return doc, nil
+}
+
+// Relationship returns the field of a purpose, which must be valid.
+func relationship(doc *backend.Document, purpose string) **backend.VerificationRelationship {
+	switch purpose {
+	case "authentication":
+		return &doc.Authentication
+	case "assertionMethod":
+		return &doc.AssertionMethod
+	case "keyAgreement":
+		return &doc.KeyAgreement
+	case "capabilityInvocation":
+		return &doc.CapabilityInvocation
+	default:
+		return &doc.CapabilityDelegation
+	}
+}
+
+// Resolver implements the “Read” operation of did:ion. Multiple goroutines
+// may invoke methods on a Resolver simultaneously.
+type Resolver struct {
+	// Node is the resolution endpoint of a Sidetree node to append DIDs
+	// to, e.g., "https://ion.example/identifiers/". Without a node, only
+	// long-form DIDs resolve, from their initial state.
+	Node string
+
+	HTTP *http.Client // nil for http.DefaultClient
+}
+
+// Resolve implements the backend.Resolver interface. Long-form DIDs which the
+// node does not know resolve from their initial state, with the short form as
+// an equivalent ID.
+func (r *Resolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	short, initial, err := Split(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Node != "" {
+		doc, meta, err := r.fetch(ctx, did, short)
+		if err == nil || initial == nil || !errors.Is(err, backend.ErrNotFound) {
+			return doc, meta, err
+		}
+	}
+	if initial == nil {
+		return nil, nil, fmt.Errorf("%w: did:ion short-form %s without Sidetree node", backend.ErrNotFound, did.String())
+	}
+
+	state, err := Apply(State{}, initial.Delta.Patches)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+	doc, err := state.Document(did)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", backend.ErrInvalid, err)
+	}
+	return doc, &backend.Meta{EquivalentIDs: []backend.DID{short}}, nil
+}
+
+// Fetch resolves did with the Sidetree node.
+func (r *Resolver) fetch(ctx context.Context, did, short backend.DID) (*backend.Document, *backend.Meta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Node+did.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", `application/ld+json;profile="https://w3id.org/did-resolution", application/json;q=0.9`)
+	client := r.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("did:ion node: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ResponseMax))
+	if err != nil {
+		return nil, nil, fmt.Errorf("did:ion node response: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusGone:
+		break // Sidetree responds deactivated DIDs with 410 Gone
+	case http.StatusNotFound:
+		return nil, nil, fmt.Errorf("%w: did:ion node has no %s", backend.ErrNotFound, short.String())
+	case http.StatusBadRequest:
+		return nil, nil, fmt.Errorf("%w: did:ion node rejects %s", backend.ErrInvalid, did.String())
+	default:
+		return nil, nil, fmt.Errorf("did:ion node got HTTP %q", resp.Status)
+	}
+
+	var result backend.ResolutionResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, nil, fmt.Errorf("did:ion node resolution result: %w", err)
+	}
+	if result.Document == nil || !result.Document.Subject.Equal(did) && !result.Document.Subject.Equal(short) {
+		return nil, nil, fmt.Errorf("did:ion node resolution of %s without matching document", did.String())
+	}
+	meta := result.DocumentMeta
+	if meta == nil {
+		meta = new(backend.Meta)
+	}
+	if resp.StatusCode == http.StatusGone && meta.Deactivated.IsZero() {
+		return nil, nil, fmt.Errorf("%w: %s", backend.ErrDeactivated, did.String())
+	}
+	return result.Document, meta, nil
+}
@@ -0,0 +1,166 @@
+package didion
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func testState(t *testing.T) *InitialState {
+	jwk := map[string]string{"kty": "EC", "crv": "secp256k1", "x": "nIqlRCx0eyBSXcQnqDpReSv4zuWhwCRWssoc9L_nj6A", "y": "iG29VK6l2U5sKBZUSJePvyFusXgSlK2dDFlWaCM8F7k"}
+	commitment, err := Commitment(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &InitialState{
+		SuffixData: SuffixData{RecoveryCommitment: commitment},
+		Delta: Delta{
+			UpdateCommitment: commitment,
+			Patches: []Patch{{
+				Action: Replace,
+				Document: &State{
+					PublicKeys: []PublicKey{{
+						ID:       "key-1",
+						Type:     "EcdsaSecp256k1VerificationKey2019",
+						JWK:      json.RawMessage(`{"kty":"EC","crv":"secp256k1","x":"nIqlRCx0eyBSXcQnqDpReSv4zuWhwCRWssoc9L_nj6A","y":"iG29VK6l2U5sKBZUSJePvyFusXgSlK2dDFlWaCM8F7k"}`),
+						Purposes: []string{"authentication", "assertionMethod"},
+					}},
+					Services: []Service{{ID: "domain-1", Type: "LinkedDomains", Endpoint: json.RawMessage(`"https://foo.example.com"`)}},
+				},
+			}},
+		},
+	}
+}
+
+func TestLongForm(t *testing.T) {
+	short, long, err := NewLongForm("", testState(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(short.SpecID) != 46 || !strings.HasPrefix(short.SpecID, "EiA") {
+		t.Errorf("got short-form %s", short.String())
+	}
+	parsed, err := backend.Parse(long.String())
+	if err != nil {
+		t.Fatal("long-form parse:", err)
+	}
+
+	doc, meta, err := new(Resolver).Resolve(context.Background(), parsed)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	if !doc.Subject.Equal(long) || len(meta.EquivalentIDs) != 1 || !meta.EquivalentIDs[0].Equal(short) {
+		t.Errorf("got document %s with meta %+v", doc.Subject.String(), meta)
+	}
+	if len(doc.VerificationMethods) != 1 || doc.Authentication == nil || doc.AssertionMethod == nil || doc.KeyAgreement != nil {
+		t.Errorf("got verification methods %+v", doc)
+	}
+	if doc.VerificationMethods[0].AdditionalString("publicKeyJwk") != "" || doc.VerificationMethods[0].Additional["publicKeyJwk"] == nil {
+		t.Error("JWK not embedded as object")
+	}
+	if len(doc.Services) != 1 || doc.Services[0].ID.Fragment != "domain-1" {
+		t.Errorf("got services %+v", doc.Services)
+	}
+	if _, _, err := new(Resolver).Resolve(context.Background(), short); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("short-form without node got error %v, want ErrNotFound", err)
+	}
+
+	testnet, testLong, err := NewLongForm("test", testState(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := Split(testLong); err != nil || !got.Equal(testnet) || !strings.HasPrefix(got.SpecID, "test:EiA") {
+		t.Errorf("testnet split got %s, error %v", got.String(), err)
+	}
+
+	// delta replaced without the deltaHash
+	forged := testState(t)
+	NewLongForm("", forged)
+	forged.Delta.Patches[0].Document.Services = nil
+	raw, _ := json.Marshal(forged)
+	forgedDID := backend.DID{Method: Method, SpecID: short.SpecID + ":" + base64.RawURLEncoding.EncodeToString(raw)}
+	if _, _, err := Split(forgedDID); !errors.Is(err, ErrCommitment) || !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("forged delta got error %v, want ErrCommitment", err)
+	}
+	other := backend.DID{Method: Method, SpecID: "EiBVpjUxXeSRJpvj2TewlX9zNF3GKMCKWwGmKBZqF6pk_A" + long.SpecID[46:]}
+	if _, _, err := Split(other); !errors.Is(err, ErrCommitment) {
+		t.Errorf("other suffix got error %v, want ErrCommitment", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	s, err := Apply(State{}, testState(t).Delta.Patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2 := s.PublicKeys[0]
+	key2.ID = "key-2"
+	s, err = Apply(s, []Patch{
+		{Action: AddPublicKeys, PublicKeys: []PublicKey{key2}},
+		{Action: RemovePublicKeys, IDs: []string{"key-1"}},
+		{Action: RemoveServices, IDs: []string{"domain-1"}},
+	})
+	if err != nil || len(s.PublicKeys) != 1 || s.PublicKeys[0].ID != "key-2" || len(s.Services) != 0 {
+		t.Errorf("got state %+v, error %v", s, err)
+	}
+
+	bad := []Patch{
+		{Action: "ietf-json-patch"},
+		{Action: Replace},
+		{Action: AddPublicKeys, PublicKeys: []PublicKey{{ID: "key#1", Type: "JsonWebKey2020", JWK: json.RawMessage(`{}`)}}},
+		{Action: AddPublicKeys, PublicKeys: []PublicKey{{ID: "key-3", Type: "JsonWebKey2020", JWK: json.RawMessage(`{}`), Purposes: []string{"signing"}}}},
+		{Action: AddServices, Services: []Service{{ID: "s", Type: "T", Endpoint: json.RawMessage(`["https://a.example"]`)}}},
+	}
+	for _, p := range bad {
+		if _, err := Apply(s, []Patch{p}); err == nil {
+			t.Errorf("patch %+v passed", p)
+		}
+	}
+}
+
+func TestNode(t *testing.T) {
+	short, long, err := NewLongForm("", testState(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := &backend.Document{Subject: short, AlsoKnownAs: []string{"https://published.example"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/identifiers/") {
+		case short.String():
+			json.NewEncoder(w).Encode(&backend.ResolutionResult{Document: published, DocumentMeta: &backend.Meta{VersionID: "1"}})
+		case "did:ion:EiBVpjUxXeSRJpvj2TewlX9zNF3GKMCKWwGmKBZqF6pk_A":
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(&backend.ResolutionResult{Document: &backend.Document{Subject: backend.DID{Method: Method, SpecID: "EiBVpjUxXeSRJpvj2TewlX9zNF3GKMCKWwGmKBZqF6pk_A"}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	r := &Resolver{Node: srv.URL + "/identifiers/"}
+	ctx := context.Background()
+
+	doc, meta, err := r.Resolve(ctx, short)
+	if err != nil || len(doc.AlsoKnownAs) != 1 || meta.VersionID != "1" {
+		t.Errorf("published got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+	// long-form unknown to the node
+	doc, meta, err = r.Resolve(ctx, long)
+	if err != nil || !doc.Subject.Equal(long) || len(meta.EquivalentIDs) != 1 {
+		t.Errorf("unpublished long-form got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+	unknown := backend.DID{Method: Method, SpecID: "EiDahaOGH-liLLdDtTxEAdc8i-cfCz-WUcQdRJheMVNn3A"}
+	if _, _, err := r.Resolve(ctx, unknown); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("unknown got error %v, want ErrNotFound", err)
+	}
+	gone := backend.DID{Method: Method, SpecID: "EiBVpjUxXeSRJpvj2TewlX9zNF3GKMCKWwGmKBZqF6pk_A"}
+	if _, _, err := r.Resolve(ctx, gone); !errors.Is(err, backend.ErrDeactivated) {
+		t.Errorf("deactivated got error %v, want ErrDeactivated", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package didjwt signs and verifies JSON Web Tokens of DID subjects. The "kid"
+// of a token is a DID URL of the issuer, which locates the verification method
+// in the DID document of the issuer.
+package didjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// ES256K is the JWA algorithm of ECDSA with secp256k1 and SHA-256, conform
+// RFC 8812.
+const ES256K = "ES256K"
+
+// ErrClaims signals a token with claims that are not acceptable, such as an
+// expiry in the past, or another audience.
+var ErrClaims = errors.New("JWT claims not acceptable")
+
+// Claims are the registered claims of RFC 7519 in use.
+type Claims struct {
+	Issuer    string   `json:"iss"` // DID
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Expires   int64    `json:"exp,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Audience is the "aud" claim. RFC 7519, section 4.1.3, permits a single
+// string or an array of strings. The JSON is a string for one entry, and an
+// array otherwise.
+type Audience []string
+
+// Contains returns whether s is one of the entries.
+func (a Audience) Contains(s string) bool {
+	for _, aud := range a {
+		if aud == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (a *Audience) UnmarshalJSON(bytes []byte) error {
+	if len(bytes) != 0 && bytes[0] == '"' {
+		var s string
+		if err := json.Unmarshal(bytes, &s); err != nil {
+			return err
+		}
+		*a = Audience{s}
+		return nil
+	}
+	return json.Unmarshal(bytes, (*[]string)(a))
+}
+
+// AlgFor returns the signature algorithm for the public key. In addition to
+// jose.AlgFor, secp256k1 keys get ES256K.
+func AlgFor(pub crypto.PublicKey) (string, error) {
+	if _, ok := pub.(didkey.Secp256k1PublicKey); ok {
+		return ES256K, nil
+	}
+	return jose.AlgFor(pub)
+}
+
+// Sign returns a compact JWT with the JSON of claims as payload. The issuer
+// in claims should be the DID of keyID, which is the verification method of
+// key.
+func Sign(claims any, keyID *backend.URL, key crypto.Signer) (string, error) {
+	return SignTyp("JWT", claims, keyID, key)
+}
+
+// SignTyp is like Sign, with an explicit "typ" header, such as one for
+// explicit typing conform RFC 8725, section 3.11.
+func SignTyp(typ string, claims any, keyID *backend.URL, key crypto.Signer) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	h := jose.Header{Kid: keyID.String(), Typ: typ}
+	if _, ok := key.Public().(didkey.Secp256k1PublicKey); !ok {
+		return jose.Sign(h, payload, key)
+	}
+
+	h.Alg = ES256K
+	headerJSON, err := json.Marshal(&h)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	der, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	sig, err := jose.ECDSASignature(der, 32)
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Verifier checks tokens against the DID documents of their issuer.
+type Verifier struct {
+	Resolver backend.Resolver
+
+	// Relationship is the verification relationship of the signing key,
+	// which defaults to "assertionMethod".
+	Relationship string
+
+	// Audience, when set, must match an entry of the "aud" claim.
+	Audience string
+
+	// Leeway is the tolerance for clock skew on the time claims.
+	Leeway time.Duration
+}
+
+// Verify returns the issuer of a valid token, with the payload decoded into
+// claims, if not nil.
+func (v *Verifier) Verify(ctx context.Context, token string, now time.Time, claims any) (backend.DID, error) {
+	jws, err := jose.ParseCompact(token)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	var c Claims
+	if err := json.Unmarshal(jws.Payload, &c); err != nil {
+		return backend.DID{}, fmt.Errorf("JWT payload: %w", err)
+	}
+	if err := v.checkClaims(&c, now); err != nil {
+		return backend.DID{}, err
+	}
+	did, err := backend.Parse(c.Issuer)
+	if err != nil {
+		return backend.DID{}, fmt.Errorf("JWT issuer: %w", err)
+	}
+	keyID, err := backend.ParseURL(jws.Header.Kid)
+	if err != nil {
+		return backend.DID{}, fmt.Errorf("JWT kid: %w", err)
+	}
+	if keyID.IsRelative() {
+		keyID.DID = did
+	}
+	if !keyID.DID.Equal(did) || keyID.Fragment() == "" {
+		return backend.DID{}, fmt.Errorf("JWT kid %q is not a verification method of issuer %s", jws.Header.Kid, c.Issuer)
+	}
+
+	doc, _, err := v.Resolver.Resolve(ctx, did)
+	if err != nil {
+		return backend.DID{}, fmt.Errorf("JWT issuer resolution: %w", err)
+	}
+	relationship := v.Relationship
+	if relationship == "" {
+		relationship = "assertionMethod"
+	}
+	m := doc.AuthorizedMethod(doc.Relationship(relationship), keyID)
+	if m == nil {
+		return backend.DID{}, fmt.Errorf("%w: no %s method %s in DID document", backend.ErrNotFound, relationship, keyID.String())
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	alg, err := AlgFor(pub)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	if alg != jws.Header.Alg {
+		return backend.DID{}, fmt.Errorf("%w: %q header with %s key", jose.ErrAlg, jws.Header.Alg, alg)
+	}
+	if alg == ES256K {
+		if len(jws.Signature) != 64 || keys.Verify(pub, jws.SigningInput(), jws.Signature) != nil {
+			return backend.DID{}, jose.ErrSignature
+		}
+	} else if err := jws.Verify(pub); err != nil {
+		return backend.DID{}, err
+	}
+
+	if claims != nil {
+		if err := json.Unmarshal(jws.Payload, claims); err != nil {
+			return backend.DID{}, fmt.Errorf("JWT payload: %w", err)
+		}
+	}
+	return did, nil
+}
+
+func (v *Verifier) checkClaims(c *Claims, now time.Time) error {
+	if v.Audience != "" && !c.Audience.Contains(v.Audience) {
+		return fmt.Errorf("%w: audience %q", ErrClaims, []string(c.Audience))
+	}
+	leeway := int64(v.Leeway / time.Second)
+	t := now.Unix()
+	if c.Expires != 0 && t > c.Expires+leeway {
+		return fmt.Errorf("%w: expired at %s", ErrClaims, time.Unix(c.Expires, 0).UTC().Format(time.RFC3339))
+	}
+	if c.NotBefore != 0 && t < c.NotBefore-leeway {
+		return fmt.Errorf("%w: not before %s", ErrClaims, time.Unix(c.NotBefore, 0).UTC().Format(time.RFC3339))
+	}
+	if c.IssuedAt != 0 && t < c.IssuedAt-leeway {
+		return fmt.Errorf("%w: issued in the future", ErrClaims)
+	}
+	if !strings.HasPrefix(c.Issuer, "did:") {
+		return fmt.Errorf("%w: issuer %q is not a DID", ErrClaims, c.Issuer)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package didjwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := &Verifier{Resolver: new(didkey.Resolver), Audience: "https://idchain.example"}
+
+	for _, kt := range []keys.Type{keys.Ed25519, keys.P256, keys.Secp256k1} {
+		key, _ := keys.Generate(kt)
+		signer, _ := keys.Signer(key)
+		did, err := didkey.New(signer.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID := &backend.URL{DID: did, RawFragment: "#" + did.SpecID}
+
+		claims := Claims{Issuer: did.String(), Audience: Audience{v.Audience}, IssuedAt: now.Unix(), Expires: now.Unix() + 60}
+		token, err := Sign(&claims, keyID, signer)
+		if err != nil {
+			t.Fatalf("%s: sign error: %s", kt, err)
+		}
+		jws, _ := jose.ParseCompact(token)
+		want := map[keys.Type]string{keys.Ed25519: jose.EdDSA, keys.P256: jose.ES256, keys.Secp256k1: ES256K}[kt]
+		if jws.Header.Alg != want || jws.Header.Kid != keyID.String() {
+			t.Errorf("%s: got alg %q and kid %q, want %q and %q", kt, jws.Header.Alg, jws.Header.Kid, want, keyID.String())
+		}
+
+		var got Claims
+		issuer, err := v.Verify(context.Background(), token, now, &got)
+		if err != nil {
+			t.Errorf("%s: verify error: %s", kt, err)
+		} else if !issuer.Equal(did) || !reflect.DeepEqual(got, claims) {
+			t.Errorf("%s: got issuer %s with claims %+v", kt, issuer.String(), got)
+		}
+
+		_, err = v.Verify(context.Background(), token, now.Add(2*time.Minute), nil)
+		if !errors.Is(err, ErrClaims) {
+			t.Errorf("%s: expired token got error %v, want ErrClaims", kt, err)
+		}
+
+		i := strings.LastIndexByte(token, '.')
+		tampered := token[:i] + ".AAAA" + token[i+5:]
+		if _, err := v.Verify(context.Background(), tampered, now, nil); !errors.Is(err, jose.ErrSignature) {
+			t.Errorf("%s: tampered token got error %v, want ErrSignature", kt, err)
+		}
+	}
+}
+
+func TestVerifyKeyMismatch(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := &Verifier{Resolver: new(didkey.Resolver)}
+
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	other, _ := keys.Generate(keys.Ed25519)
+	otherSigner, _ := keys.Signer(other)
+	otherDID, _ := didkey.New(otherSigner.Public())
+
+	// key of another DID
+	token, _ := Sign(&Claims{Issuer: did.String()}, &backend.URL{DID: otherDID, RawFragment: "#" + otherDID.SpecID}, otherSigner)
+	if _, err := v.Verify(context.Background(), token, now, nil); err == nil || !strings.Contains(err.Error(), "is not a verification method of issuer") {
+		t.Errorf("foreign kid got error %v", err)
+	}
+
+	// not in the relationship
+	token, _ = Sign(&Claims{Issuer: did.String()}, &backend.URL{DID: did, RawFragment: "#key-9"}, signer)
+	if _, err := v.Verify(context.Background(), token, now, nil); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("unknown kid got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestAudience(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := &Verifier{Resolver: new(didkey.Resolver), Audience: "https://idchain.example"}
+
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	keyID := &backend.URL{DID: did, RawFragment: "#" + did.SpecID}
+
+	tests := []struct {
+		payload string
+		ok      bool
+	}{
+		{`"https://idchain.example"`, true},
+		{`["https://other.example", "https://idchain.example"]`, true},
+		{`["https://idchain.example"]`, true},
+		{`"https://other.example"`, false},
+		{`["https://other.example"]`, false},
+		{`[]`, false},
+	}
+	for _, test := range tests {
+		claims := map[string]any{"iss": did.String(), "aud": json.RawMessage(test.payload)}
+		token, err := Sign(claims, keyID, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Claims
+		_, err = v.Verify(context.Background(), token, now, &got)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("audience %s: verify error: %s", test.payload, err)
+		case !test.ok && !errors.Is(err, ErrClaims):
+			t.Errorf("audience %s: got error %v, want ErrClaims", test.payload, err)
+		}
+	}
+
+	// single entry as a string
+	b, err := json.Marshal(Claims{Issuer: did.String(), Audience: Audience{"https://idchain.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"aud":"https://idchain.example"`; !strings.Contains(string(b), want) {
+		t.Errorf("got JSON %s, want %s", b, want)
+	}
+}
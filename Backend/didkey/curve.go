@@ -0,0 +1,71 @@
+package didkey
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Secp256k1PublicKey is a compressed point conform SEC 1, section 2.3.3. The
+// standard library has no secp256k1 support.
+type Secp256k1PublicKey []byte
+
+// Valid returns whether k is a point on the curve y² = x³ + 7.
+func (k Secp256k1PublicKey) Valid() bool {
+	if len(k) != 33 {
+		return false
+	}
+	_, err := secp256k1.ParsePubKey(k)
+	return err == nil
+}
+
+// Curve25519P is the field prime 2²⁵⁵ − 19.
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// X25519FromEd25519 converts the Edwards point to its birationally equivalent
+// Montgomery u-coordinate, with u = (1 + y) / (1 − y), as in RFC 7748,
+// section 4.1.
+func X25519FromEd25519(pub ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("didkey: Ed25519 public key size")
+	}
+	// little-endian y with the sign bit of x cleared
+	le := make([]byte, 32)
+	for i := range le {
+		le[i] = pub[31-i]
+	}
+	le[0] &= 0x7f
+	y := new(big.Int).SetBytes(le)
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, errors.New("didkey: Ed25519 y-coordinate out of range")
+	}
+
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, curve25519P)
+	if den.Sign() == 0 {
+		return nil, errors.New("didkey: Ed25519 point has no Montgomery form")
+	}
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, den.ModInverse(den, curve25519P)).Mod(u, curve25519P)
+
+	be := u.FillBytes(make([]byte, 32))
+	for i := range le {
+		le[i] = be[31-i]
+	}
+	return ecdh.X25519().NewPublicKey(le)
+}
+
+// X25519PrivateFromEd25519 returns the key agreement key of an Ed25519 key pair,
+// i.e., the private key of X25519FromEd25519. The scalar is the first half of
+// the SHA-512 of the seed, as in RFC 8032, section 5.1.5, which X25519 clamps.
+func X25519PrivateFromEd25519(key ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("didkey: Ed25519 private key size")
+	}
+	h := sha512.Sum512(key.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
@@ -0,0 +1,331 @@
+// Package didkey implements the did:key method, conform the W3C CCG DID Method
+// Specification. The identifier is a public key in Multibase encoding, which
+// expands into a DID document without network access.
+package didkey
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// Method is the DID method name.
+const Method = "key"
+
+// Multicodec identifiers of public keys
+const (
+	Ed25519   = multiformat.Ed25519Pub
+	X25519    = multiformat.X25519Pub
+	Secp256k1 = multiformat.Secp256k1Pub
+	P256      = multiformat.P256Pub
+	P384      = multiformat.P384Pub
+	P521      = multiformat.P521Pub
+)
+
+// ErrKeyType signals an unsupported (or malformed) kind of key. It is the
+// sentinel of package jose, such that one errors.Is covers both packages.
+var ErrKeyType = jose.ErrKeyType
+
+// New returns the did:key of pub, which is either an ed25519.PublicKey, an
+// X25519 *ecdh.PublicKey, an *ecdsa.PublicKey on P-256, P-384 or P-521, or a
+// Secp256k1PublicKey.
+func New(pub crypto.PublicKey) (backend.DID, error) {
+	s, err := EncodeKey(pub)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	return backend.DID{Method: Method, SpecID: s}, nil
+}
+
+// EncodeKey returns the Multibase of the Multicodec of pub, as in New.
+func EncodeKey(pub crypto.PublicKey) (string, error) {
+	codec, key, err := encodeKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return EncodeMultibase(multiformat.AddPrefix(codec, key)), nil
+}
+
+func encodeKey(pub crypto.PublicKey) (codec uint64, key []byte, err error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if len(pub) != ed25519.PublicKeySize {
+			return 0, nil, fmt.Errorf("%w: Ed25519 public key of %d bytes", ErrKeyType, len(pub))
+		}
+		return Ed25519, pub, nil
+	case *ecdh.PublicKey:
+		if pub.Curve() != ecdh.X25519() {
+			return 0, nil, fmt.Errorf("%w: ECDH curve %s", ErrKeyType, pub.Curve())
+		}
+		return X25519, pub.Bytes(), nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			codec = P256
+		case elliptic.P384():
+			codec = P384
+		case elliptic.P521():
+			codec = P521
+		default:
+			return 0, nil, fmt.Errorf("%w: ECDSA curve %s", ErrKeyType, pub.Curve.Params().Name)
+		}
+		return codec, elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y), nil
+	case Secp256k1PublicKey:
+		if !pub.Valid() {
+			return 0, nil, fmt.Errorf("%w: malformed secp256k1 key", ErrKeyType)
+		}
+		return Secp256k1, pub, nil
+	default:
+		return 0, nil, fmt.Errorf("%w: Go type %T", ErrKeyType, pub)
+	}
+}
+
+// PublicKey returns the key of a did:key in the Go representation of New.
+func PublicKey(did backend.DID) (crypto.PublicKey, error) {
+	_, pub, err := decode(did)
+	return pub, err
+}
+
+func decode(did backend.DID) (codec uint64, pub crypto.PublicKey, err error) {
+	if did.Method != Method {
+		return 0, nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	return DecodeKey(did.SpecID)
+}
+
+// DecodeKey parses the EncodeKey format. Errors wrap backend.ErrInvalid.
+func DecodeKey(s string) (codec uint64, pub crypto.PublicKey, err error) {
+	raw, err := DecodeMultibase(s)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: multibase key: %w", backend.ErrInvalid, err)
+	}
+	codec, key, err := multiformat.SplitPrefix(raw)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: multibase key: %w", backend.ErrInvalid, err)
+	}
+
+	switch codec {
+	case Ed25519:
+		if len(key) != ed25519.PublicKeySize {
+			break
+		}
+		return codec, ed25519.PublicKey(key), nil
+	case X25519:
+		pub, err := ecdh.X25519().NewPublicKey(key)
+		if err != nil {
+			break
+		}
+		return codec, pub, nil
+	case Secp256k1:
+		if !Secp256k1PublicKey(key).Valid() {
+			break
+		}
+		return codec, Secp256k1PublicKey(key), nil
+	case P256, P384, P521:
+		curve := map[uint64]elliptic.Curve{P256: elliptic.P256(), P384: elliptic.P384(), P521: elliptic.P521()}[codec]
+		x, y := elliptic.UnmarshalCompressed(curve, key)
+		if x == nil {
+			break
+		}
+		return codec, &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return 0, nil, fmt.Errorf("%w: %w: multicodec %#x", backend.ErrInvalid, ErrKeyType, codec)
+	}
+	return 0, nil, fmt.Errorf("%w: malformed key for multicodec %#x", backend.ErrInvalid, codec)
+}
+
+// Method Formats
+const (
+	Multikey       = "Multikey"       // with publicKeyMultibase
+	JsonWebKey2020 = "JsonWebKey2020" // with publicKeyJwk
+)
+
+// Resolver expands did:key identifiers into documents. The zero value is
+// ready to use.
+type Resolver struct {
+	// Format is the verification method type, which defaults to Multikey.
+	// JsonWebKey2020 supports Ed25519, X25519 and the P-curves only.
+	Format string
+
+	// DeriveKeyAgreement adds the X25519 equivalent of Ed25519 keys as
+	// key agreement method.
+	DeriveKeyAgreement bool
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *Resolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, err := r.Expand(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, new(backend.Meta), nil
+}
+
+// Expand returns the document of did.
+func (r *Resolver) Expand(did backend.DID) (*backend.Document, error) {
+	codec, pub, err := decode(did)
+	if err != nil {
+		return nil, err
+	}
+	// “the fragment identifier is the multibase value”
+	m, err := r.method(did, did.SpecID, pub)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &backend.Document{
+		Subject:             did,
+		VerificationMethods: []*backend.VerificationMethod{m},
+	}
+	ref := func(m *backend.VerificationMethod) *backend.VerificationRelationship {
+		return &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}}
+	}
+	if codec == X25519 {
+		// key agreement only
+		doc.KeyAgreement = ref(m)
+		return doc, nil
+	}
+	doc.Authentication = ref(m)
+	doc.AssertionMethod = ref(m)
+	doc.CapabilityInvocation = ref(m)
+	doc.CapabilityDelegation = ref(m)
+
+	if codec == Ed25519 && r.DeriveKeyAgreement {
+		x, err := X25519FromEd25519(pub.(ed25519.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := EncodeKey(x)
+		if err != nil {
+			return nil, err
+		}
+		km, err := r.method(did, encoded, x)
+		if err != nil {
+			return nil, err
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, km)
+		doc.KeyAgreement = ref(km)
+	}
+	return doc, nil
+}
+
+func (r *Resolver) method(did backend.DID, fragment string, pub crypto.PublicKey) (*backend.VerificationMethod, error) {
+	id := backend.URL{DID: did, RawFragment: "#" + fragment}
+	switch r.Format {
+	case "", Multikey:
+		return NewMethod(id, did, pub)
+	case JsonWebKey2020:
+		m, err := jose.NewMethod(id, did, pub)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrKeyType, err)
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("did:key format %q not supported", r.Format)
+	}
+}
+
+// NewMethod returns a Multikey verification method for pub.
+func NewMethod(id backend.URL, controller backend.DID, pub crypto.PublicKey) (*backend.VerificationMethod, error) {
+	s, err := EncodeKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return &backend.VerificationMethod{
+		ID:         id,
+		Type:       Multikey,
+		Controller: controller,
+		Additional: map[string]json.RawMessage{"publicKeyMultibase": value},
+	}, nil
+}
+
+func init() {
+	backend.RegisterProfile(Method, CheckDocument)
+	backend.RegisterMethodSyntax(Method, func(specID string) error {
+		_, _, err := DecodeKey(specID)
+		return err
+	})
+}
+
+// CheckDocument verifies that doc is an expansion of its subject, as in
+// Resolver.Expand. Each verification method must have a fragment equal to the
+// encoding of its key, and the key must be either the one of the identifier,
+// or its X25519 derivation. Documents with other keys are invalid. The check
+// runs on backend.Document.Validate.
+func CheckDocument(doc *backend.Document) error {
+	codec, pub, err := decode(doc.Subject)
+	if err != nil {
+		return err
+	}
+	allowed := map[string]bool{doc.Subject.SpecID: true}
+	if codec == Ed25519 {
+		x, err := X25519FromEd25519(pub.(ed25519.PublicKey))
+		if err != nil {
+			return err
+		}
+		encoded, err := EncodeKey(x)
+		if err != nil {
+			return err
+		}
+		allowed[encoded] = true
+	}
+
+	var errs []error
+	var found bool
+	for _, m := range doc.Methods() {
+		encoded, err := methodKey(m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("did:key verification method %s: %w", m.ID.String(), err))
+			continue
+		}
+		if !allowed[encoded] {
+			errs = append(errs, fmt.Errorf("did:key verification method %s has a key other than %s", m.ID.String(), doc.Subject.String()))
+			continue
+		}
+		// “the fragment identifier is the multibase value”
+		if m.ID.Fragment() != encoded {
+			errs = append(errs, fmt.Errorf("did:key verification method %s does not have its key as fragment", m.ID.String()))
+		}
+		if encoded == doc.Subject.SpecID {
+			found = true
+		}
+	}
+	if !found {
+		errs = append(errs, fmt.Errorf("did:key document has no verification method with the key of %s", doc.Subject.String()))
+	}
+	return errors.Join(errs...)
+}
+
+// MethodKey returns the EncodeKey of m, in either Format.
+func methodKey(m *backend.VerificationMethod) (string, error) {
+	if m.Type != Multikey {
+		pub, err := jose.MethodKey(m)
+		if err != nil {
+			return "", err
+		}
+		return EncodeKey(pub)
+	}
+	var s string
+	if err := json.Unmarshal(m.Additional["publicKeyMultibase"], &s); err != nil {
+		return "", fmt.Errorf("publicKeyMultibase: %w", err)
+	}
+	_, pub, err := DecodeKey(s)
+	if err != nil {
+		return "", err
+	}
+	return EncodeKey(pub)
+}
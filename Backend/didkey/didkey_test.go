@@ -0,0 +1,271 @@
+package didkey
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+func TestMultibase(t *testing.T) {
+	tests := []struct {
+		hex, encoding string
+	}{
+		{"", "z"},
+		{"00", "z1"},
+		{"0000ff", "z115Q"},
+		{"48656c6c6f20576f726c6421", "z2NEpo7TZRRrLZSi2U"},
+	}
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.hex)
+		if got := EncodeMultibase(data); got != test.encoding {
+			t.Errorf("%s got %q, want %q", test.hex, got, test.encoding)
+		}
+		got, err := DecodeMultibase(test.encoding)
+		if err != nil {
+			t.Errorf("%q got error: %s", test.encoding, err)
+		} else if !bytes.Equal(got, data) {
+			t.Errorf("%q got %x, want %s", test.encoding, got, test.hex)
+		}
+	}
+	for _, s := range []string{"", "f00", "z0OIl"} {
+		if _, err := DecodeMultibase(s); err == nil {
+			t.Errorf("%q got no error", s)
+		}
+	}
+}
+
+// Vector from the W3C CCG did:key specification.
+func TestKeyAgreementDerivation(t *testing.T) {
+	tests := []struct{ did, keyAgreement string }{
+		{"did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK", "z6LSj72tK8brWgZja8NLRwPigth2T9QRiG1uH9oKZuKjdh9p"},
+	}
+	r := Resolver{DeriveKeyAgreement: true}
+	for _, test := range tests {
+		did, err := backend.Parse(test.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, _, err := r.Resolve(context.Background(), did)
+		if err != nil {
+			t.Errorf("%s got error: %s", test.did, err)
+			continue
+		}
+		if err := doc.Validate(); err != nil {
+			t.Errorf("%s got invalid document: %s", test.did, err)
+		}
+		want := test.did + "#" + test.keyAgreement
+		if len(doc.KeyAgreement.URIRefs) != 1 || doc.KeyAgreement.URIRefs[0].String() != want {
+			t.Errorf("%s got key agreement %+v, want %s", test.did, doc.KeyAgreement.URIRefs, want)
+		}
+		if doc.Authentication.URIRefs[0].String() != test.did+"#"+did.SpecID {
+			t.Errorf("%s got authentication %s", test.did, doc.Authentication.URIRefs[0].String())
+		}
+	}
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := X25519FromEd25519(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := X25519PrivateFromEd25519(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.PublicKey().Equal(want) {
+		t.Error("private key conversion does not match the public key conversion")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	x, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	// generator point of secp256k1
+	k1, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
+	tests := []struct {
+		pub    any
+		prefix string
+	}{
+		{edPub, "z6Mk"},
+		{x.PublicKey(), "z6LS"},
+		{&p256.PublicKey, "zDn"},
+		{&p384.PublicKey, "z82"},
+		{&p521.PublicKey, "z2J9"},
+		{Secp256k1PublicKey(k1), "zQ3s"},
+	}
+	for _, test := range tests {
+		did, err := New(test.pub)
+		if err != nil {
+			t.Errorf("%T got error: %s", test.pub, err)
+			continue
+		}
+		if !strings.HasPrefix(did.SpecID, test.prefix) {
+			t.Errorf("%T got %s, want prefix %q", test.pub, did.String(), test.prefix)
+		}
+		// through the string form
+		parsed, err := backend.Parse(did.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PublicKey(parsed)
+		if err != nil {
+			t.Errorf("%s got error: %s", did.String(), err)
+			continue
+		}
+		switch want := test.pub.(type) {
+		case ed25519.PublicKey:
+			if !want.Equal(got) {
+				t.Errorf("%s got key %v", did.String(), got)
+			}
+		case *ecdh.PublicKey:
+			if !want.Equal(got) {
+				t.Errorf("%s got key %v", did.String(), got)
+			}
+		case *ecdsa.PublicKey:
+			if !want.Equal(got) {
+				t.Errorf("%s got key %v", did.String(), got)
+			}
+		case Secp256k1PublicKey:
+			if !bytes.Equal(want, got.(Secp256k1PublicKey)) {
+				t.Errorf("%s got key %v", did.String(), got)
+			}
+		}
+	}
+
+	// x-coordinate without a point on the curve
+	bad := append(Secp256k1PublicKey{2}, bytes.Repeat([]byte{0}, 31)...)
+	bad = append(bad, 5)
+	if _, err := New(bad); !errors.Is(err, ErrKeyType) {
+		t.Errorf("secp256k1 off curve got error %v, want ErrKeyType", err)
+	}
+}
+
+func TestJsonWebKey2020(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	did, _ := New(pub)
+	r := Resolver{Format: JsonWebKey2020}
+	doc, err := r.Expand(did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := doc.AuthorizedMethod(doc.Authentication, &doc.VerificationMethods[0].ID)
+	if m == nil {
+		t.Fatal("no authentication method")
+	}
+	got, err := jose.MethodKey(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(got) {
+		t.Errorf("got key %v, want %v", got, pub)
+	}
+
+	x, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	did, _ = New(x.PublicKey())
+	if _, err := r.Expand(did); err != nil {
+		t.Errorf("X25519 as JsonWebKey2020 got error: %s", err)
+	}
+	k1, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	did, _ = New(Secp256k1PublicKey(k1))
+	if _, err := r.Expand(did); !errors.Is(err, ErrKeyType) {
+		t.Errorf("secp256k1 as JsonWebKey2020 got error %v, want ErrKeyType", err)
+	}
+
+	b, _ := json.Marshal(doc)
+	if !bytes.Contains(b, []byte(`"publicKeyJwk"`)) {
+		t.Errorf("got JSON %s", b)
+	}
+}
+
+func TestCheckDocument(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	did, _ := New(pub)
+	for _, r := range []Resolver{{}, {Format: JsonWebKey2020}, {DeriveKeyAgreement: true}} {
+		doc, err := r.Expand(did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := doc.Validate(); err != nil {
+			t.Errorf("%+v: got validate error: %s", r, err)
+		}
+	}
+
+	doc, _ := new(Resolver).Expand(did)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	m, _ := NewMethod(doc.VerificationMethods[0].ID, did, other)
+	doc.VerificationMethods[0] = m
+	err := doc.Validate()
+	if err == nil || !strings.Contains(err.Error(), "has a key other than "+did.String()) {
+		t.Errorf("foreign key got validate error %v", err)
+	}
+
+	doc, _ = new(Resolver).Expand(did)
+	doc.VerificationMethods[0].ID.SetFragment("key-1")
+	doc.Authentication = nil
+	doc.AssertionMethod = nil
+	doc.CapabilityInvocation = nil
+	doc.CapabilityDelegation = nil
+	err = doc.Validate()
+	if err == nil || !strings.Contains(err.Error(), "does not have its key as fragment") {
+		t.Errorf("renamed method got validate error %v", err)
+	}
+}
+
+func TestMethodSyntax(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"did:key:z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7V": true,
+		"did:key:z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7":  false,
+		"did:key:u7QF6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8": false,
+	} {
+		err := backend.ValidateMethodSyntax(backend.MustParse(s))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, backend.ErrInvalid)) {
+			t.Errorf("%s got error %v", s, err)
+		}
+	}
+}
+
+// Any key which decodes must encode as is.
+func FuzzDecodeKey(f *testing.F) {
+	// W3C CCG did:key test vectors
+	for _, s := range []string{
+		"z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp",
+		"zQ3shokFTS3brHcDQrn82RUDfCZESWL1ZdCEJwekUDPQiYBme",
+		"zDnaerDaTF5BXEavCrfRZEk316dpbLsfPDZ3WJ5hRTPFU2169",
+		"z6LSeu9HkTHSfLLeUs2nnzUSNedgDUevfNQgQjQC23ZCit6F",
+		"z82Lm1MpAkeJcix9K8TMiLd5NMAhnwkjjCBeWHXyu3U4oT2MVJJKXkcVBgjGhnLBn2Kaau9",
+		"z",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		codec, pub, err := DecodeKey(s)
+		if err != nil {
+			return
+		}
+		encoded, err := EncodeKey(pub)
+		if err != nil {
+			t.Fatalf("%q got encode error: %s", s, err)
+		}
+		if encoded != s {
+			t.Errorf("%q decoded as multicodec %#x, which encoded as %q", s, codec, encoded)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package didkey
+
+import (
+	"errors"
+
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// EncodeMultibase returns the base58btc encoding with its 'z' prefix.
+func EncodeMultibase(data []byte) string {
+	return multiformat.Encode(multiformat.Base58BTC, data)
+}
+
+// DecodeMultibase returns the decoding of a base58btc encoding, which must
+// have its 'z' prefix.
+func DecodeMultibase(s string) ([]byte, error) {
+	if s == "" || s[0] != byte(multiformat.Base58BTC) {
+		return nil, errors.New("multibase encoding is not base58btc")
+	}
+	_, data, err := multiformat.Decode(s)
+	return data, err
+}
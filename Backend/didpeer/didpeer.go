@@ -0,0 +1,385 @@
+// Package didpeer implements the did:peer method, conform the DIF Peer DID
+// Method Specification, with numalgo 0, 1 and 2. Parties create pairwise DIDs
+// locally, without any registry.
+package didpeer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// Method is the DID method name.
+const Method = "peer"
+
+func init() {
+	backend.RegisterMethodSyntax(Method, checkSyntax)
+}
+
+// CheckSyntax requires the Multihash of a genesis document for numalgo 1, and
+// the expansion of numalgo 0 and 2.
+func checkSyntax(specID string) error {
+	if !strings.HasPrefix(specID, "1") {
+		_, err := Expand(backend.DID{Method: Method, SpecID: specID})
+		return err
+	}
+	multihash, err := didkey.DecodeMultibase(specID[1:])
+	if err != nil {
+		return fmt.Errorf("%w: did:peer numalgo 1: %w", backend.ErrInvalid, err)
+	}
+	code, digest, err := multiformat.DecodeMultihash(multihash)
+	if err != nil {
+		return fmt.Errorf("%w: did:peer numalgo 1: %w", backend.ErrInvalid, err)
+	}
+	if code != multiformat.SHA2_256 || len(digest) != sha256.Size {
+		return fmt.Errorf("%w: did:peer numalgo 1 multihash is not SHA2-256", backend.ErrInvalid)
+	}
+	return nil
+}
+
+// Purpose codes of numalgo 2 select the verification relationship of a key.
+type Purpose byte
+
+// Purposes
+const (
+	Assertion    Purpose = 'A' // assertionMethod
+	Encryption   Purpose = 'E' // keyAgreement
+	Verification Purpose = 'V' // authentication
+	Invocation   Purpose = 'I' // capabilityInvocation
+	Delegation   Purpose = 'D' // capabilityDelegation
+)
+
+// Service is the purpose code for service entries.
+const servicePurpose = 'S'
+
+// Key is an element of numalgo 2.
+type Key struct {
+	Purpose Purpose
+	Public  crypto.PublicKey // any type supported by didkey.EncodeKey
+}
+
+// New0 returns the numalgo 0 DID of an inception key. The document is that of
+// did:key.
+func New0(pub crypto.PublicKey) (backend.DID, error) {
+	s, err := didkey.EncodeKey(pub)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	return backend.DID{Method: Method, SpecID: "0" + s}, nil
+}
+
+// New1 returns the numalgo 1 DID of a genesis document, which is the stored
+// variant without "id". The DID commits to the exact bytes of genesis.
+func New1(genesis []byte) (backend.DID, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(genesis, &probe); err != nil {
+		return backend.DID{}, fmt.Errorf("did:peer genesis document: %w", err)
+	}
+	if _, ok := probe["id"]; ok {
+		return backend.DID{}, errors.New(`did:peer genesis document has an "id"`)
+	}
+	sum := sha256.Sum256(genesis)
+	multihash := multiformat.EncodeMultihash(multiformat.SHA2_256, sum[:])
+	return backend.DID{Method: Method, SpecID: "1" + didkey.EncodeMultibase(multihash)}, nil
+}
+
+// New2 returns the numalgo 2 DID of keys with services. Services get the
+// identifiers "#service", "#service-1", "#service-2", etc. in order of
+// appearance, unless their ID has another fragment.
+func New2(keys []Key, services []*backend.Service) (backend.DID, error) {
+	var b strings.Builder
+	b.WriteByte('2')
+	for _, k := range keys {
+		switch k.Purpose {
+		case Assertion, Encryption, Verification, Invocation, Delegation:
+			break
+		default:
+			return backend.DID{}, fmt.Errorf("did:peer purpose %q not supported", k.Purpose)
+		}
+		s, err := didkey.EncodeKey(k.Public)
+		if err != nil {
+			return backend.DID{}, err
+		}
+		b.WriteByte('.')
+		b.WriteByte(byte(k.Purpose))
+		b.WriteString(s)
+	}
+
+	for i, srv := range services {
+		raw, err := json.Marshal(srv)
+		if err != nil {
+			return backend.DID{}, err
+		}
+		var m map[string]any
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return backend.DID{}, err
+		}
+		if srv.ID.Fragment == serviceFragment(i) {
+			delete(m, "id") // implied
+		} else {
+			m["id"] = "#" + srv.ID.Fragment
+		}
+		raw, err = json.Marshal(abbreviate(m))
+		if err != nil {
+			return backend.DID{}, err
+		}
+		b.WriteByte('.')
+		b.WriteByte(servicePurpose)
+		b.WriteString(base64.RawURLEncoding.EncodeToString(raw))
+	}
+	return backend.DID{Method: Method, SpecID: b.String()}, nil
+}
+
+// ServiceFragment returns the implied identifier of service № i + 1.
+func serviceFragment(i int) string {
+	if i == 0 {
+		return "service"
+	}
+	return "service-" + strconv.Itoa(i)
+}
+
+// Abbreviations of numalgo 2 services apply to keys and values.
+var abbreviations = map[string]string{
+	"type":             "t",
+	"serviceEndpoint":  "s",
+	"routingKeys":      "r",
+	"accept":           "a",
+	"DIDCommMessaging": "dm",
+}
+
+func abbreviate(v any) any {
+	return replace(v, func(s string) string {
+		if a, ok := abbreviations[s]; ok {
+			return a
+		}
+		return s
+	})
+}
+
+func expand(v any) any {
+	return replace(v, func(s string) string {
+		for long, short := range abbreviations {
+			if s == short {
+				return long
+			}
+		}
+		return s
+	})
+}
+
+// Replace maps the object keys and the string values of v recursively.
+func replace(v any, f func(string) string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[f(k)] = replace(e, f)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, e := range v {
+			a[i] = replace(e, f)
+		}
+		return a
+	case string:
+		return f(v)
+	default:
+		return v
+	}
+}
+
+// Expand returns the document of a numalgo 0 or numalgo 2 DID. Numalgo 1
+// needs its genesis document from a Resolver.
+func Expand(did backend.DID) (*backend.Document, error) {
+	if did.Method != Method {
+		return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	if did.SpecID == "" {
+		return nil, fmt.Errorf("%w: did:peer without numalgo", backend.ErrInvalid)
+	}
+	switch did.SpecID[0] {
+	case '0':
+		return expand0(did)
+	case '2':
+		return expand2(did)
+	default:
+		return nil, fmt.Errorf("%w: did:peer numalgo %q", backend.ErrInvalid, did.SpecID[0])
+	}
+}
+
+func expand0(did backend.DID) (*backend.Document, error) {
+	codec, pub, err := didkey.DecodeKey(did.SpecID[1:])
+	if err != nil {
+		return nil, err
+	}
+	m, err := didkey.NewMethod(backend.URL{DID: did, RawFragment: "#" + did.SpecID[1:]}, did, pub)
+	if err != nil {
+		return nil, err
+	}
+	doc := &backend.Document{Subject: did, VerificationMethods: []*backend.VerificationMethod{m}}
+	if codec == didkey.X25519 {
+		doc.KeyAgreement = reference(nil, m)
+		return doc, nil
+	}
+	doc.Authentication = reference(nil, m)
+	doc.AssertionMethod = reference(nil, m)
+	doc.CapabilityInvocation = reference(nil, m)
+	doc.CapabilityDelegation = reference(nil, m)
+	return doc, nil
+}
+
+// Reference appends m to r.
+func reference(r *backend.VerificationRelationship, m *backend.VerificationMethod) *backend.VerificationRelationship {
+	if r == nil {
+		r = new(backend.VerificationRelationship)
+	}
+	r.URIRefs = append(r.URIRefs, &m.ID)
+	return r
+}
+
+func expand2(did backend.DID) (*backend.Document, error) {
+	doc := &backend.Document{Subject: did}
+	elements := strings.Split(did.SpecID, ".")
+	if elements[0] != "2" {
+		return nil, fmt.Errorf("%w: did:peer numalgo 2 prefix %q", backend.ErrInvalid, elements[0])
+	}
+	for _, e := range elements[1:] {
+		if e == "" {
+			return nil, fmt.Errorf("%w: did:peer numalgo 2 with empty element", backend.ErrInvalid)
+		}
+
+		if e[0] == servicePurpose {
+			srv, err := decodeService(did, e[1:], len(doc.Services))
+			if err != nil {
+				return nil, err
+			}
+			doc.Services = append(doc.Services, srv)
+			continue
+		}
+
+		_, pub, err := didkey.DecodeKey(e[1:])
+		if err != nil {
+			return nil, err
+		}
+		id := backend.URL{DID: did, RawFragment: "#key-" + strconv.Itoa(len(doc.VerificationMethods)+1)}
+		m, err := didkey.NewMethod(id, did, pub)
+		if err != nil {
+			return nil, err
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+
+		switch Purpose(e[0]) {
+		case Assertion:
+			doc.AssertionMethod = reference(doc.AssertionMethod, m)
+		case Encryption:
+			doc.KeyAgreement = reference(doc.KeyAgreement, m)
+		case Verification:
+			doc.Authentication = reference(doc.Authentication, m)
+		case Invocation:
+			doc.CapabilityInvocation = reference(doc.CapabilityInvocation, m)
+		case Delegation:
+			doc.CapabilityDelegation = reference(doc.CapabilityDelegation, m)
+		default:
+			return nil, fmt.Errorf("%w: did:peer purpose %q", backend.ErrInvalid, e[0])
+		}
+	}
+	return doc, nil
+}
+
+func decodeService(did backend.DID, encoded string, i int) (*backend.Service, error) {
+	// some implementations include padding
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: did:peer service encoding: %w", backend.ErrInvalid, err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%w: did:peer service JSON: %w", backend.ErrInvalid, err)
+	}
+	m = expand(m).(map[string]any)
+
+	fragment := serviceFragment(i)
+	if id, ok := m["id"].(string); ok {
+		fragment = strings.TrimPrefix(id, "#")
+	}
+	m["id"] = did.String() + "#" + url.PathEscape(fragment)
+
+	raw, err = json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	srv := new(backend.Service)
+	if err := json.Unmarshal(raw, srv); err != nil {
+		return nil, fmt.Errorf("%w: did:peer service: %w", backend.ErrInvalid, err)
+	}
+	return srv, nil
+}
+
+// Resolver resolves did:peer identifiers. Numalgo 1 requires its genesis
+// document to be Stored first. The zero value is ready to use. Multiple
+// goroutines may invoke methods on a Resolver simultaneously.
+type Resolver struct {
+	mutex   sync.RWMutex
+	genesis map[string][]byte // by SpecID
+}
+
+// Store retains a numalgo 1 genesis document, and it returns the DID.
+func (r *Resolver) Store(genesis []byte) (backend.DID, error) {
+	did, err := New1(genesis)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.genesis == nil {
+		r.genesis = make(map[string][]byte)
+	}
+	r.genesis[did.SpecID] = bytes.Clone(genesis)
+	return did, nil
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *Resolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	if did.Method != Method || !strings.HasPrefix(did.SpecID, "1") {
+		doc, err := Expand(did)
+		if err != nil {
+			return nil, nil, err
+		}
+		return doc, new(backend.Meta), nil
+	}
+
+	r.mutex.RLock()
+	genesis, ok := r.genesis[did.SpecID]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no genesis document for %s", backend.ErrNotFound, did.String())
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(genesis, &m); err != nil {
+		return nil, nil, err
+	}
+	m["id"], _ = json.Marshal(did)
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := new(backend.Document)
+	if err := json.Unmarshal(raw, doc); err != nil {
+		return nil, nil, fmt.Errorf("did:peer genesis document: %w", err)
+	}
+	return doc, new(backend.Meta), nil
+}
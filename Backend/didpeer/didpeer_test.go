@@ -0,0 +1,161 @@
+package didpeer
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Example from the DIF Peer DID Method Specification.
+const example2 = "did:peer:2.Ez6LSbysY2xFMRpGMhb7tFTLMpeuPRaqaWM1yECx2AtzE3KCc.Vz6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7V.Vz6MkgoLTnTypo3tDRwCkZXSccTPHRLhF4ZnjhueYAFpEX6vg.SeyJ0IjoiZG0iLCJzIjoiaHR0cHM6Ly9leGFtcGxlLmNvbS9lbmRwb2ludCIsInIiOlsiZGlkOmV4YW1wbGU6c29tZW1lZGlhdG9yI3NvbWVrZXkiXSwiYSI6WyJkaWRjb21tL3YyIiwiZGlkY29tbS9haXAyO2Vudj1yZmM1ODciXX0"
+
+func TestExpand2(t *testing.T) {
+	did, err := backend.Parse(example2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Expand(did)
+	if err != nil {
+		t.Fatal("expand error:", err)
+	}
+	if err := doc.Validate(); err != nil {
+		t.Error("invalid document:", err)
+	}
+	if len(doc.VerificationMethods) != 3 {
+		t.Fatalf("got %d verification methods, want 3", len(doc.VerificationMethods))
+	}
+	if got := doc.KeyAgreement.URIRefs[0].String(); got != example2+"#key-1" {
+		t.Errorf("got key agreement %s", got)
+	}
+	if len(doc.Authentication.URIRefs) != 2 || doc.Authentication.URIRefs[1].String() != example2+"#key-3" {
+		t.Errorf("got authentication %v", doc.Authentication.URIRefs)
+	}
+	if got := doc.VerificationMethods[0].AdditionalString("publicKeyMultibase"); got != "z6LSbysY2xFMRpGMhb7tFTLMpeuPRaqaWM1yECx2AtzE3KCc" {
+		t.Errorf("got first key %q", got)
+	}
+
+	if len(doc.Services) != 1 {
+		t.Fatalf("got %d services, want 1", len(doc.Services))
+	}
+	srv := doc.Services[0]
+	if srv.ID.String() != example2+"#service" || len(srv.Types) != 1 || srv.Types[0] != "DIDCommMessaging" {
+		t.Errorf("got service ID %s, types %q", srv.ID.String(), srv.Types)
+	}
+	if len(srv.Endpoint.URIRefs) != 1 || srv.Endpoint.URIRefs[0].String() != "https://example.com/endpoint" {
+		t.Errorf("got endpoint %+v", srv.Endpoint)
+	}
+	var routingKeys []string
+	json.Unmarshal(srv.Additional["routingKeys"], &routingKeys)
+	if len(routingKeys) != 1 || routingKeys[0] != "did:example:somemediator#somekey" {
+		t.Errorf("got routing keys %q", routingKeys)
+	}
+	if got := doc.Service("service"); got != srv {
+		t.Error("service not found by name")
+	}
+}
+
+func TestNew2(t *testing.T) {
+	auth, _, _ := ed25519.GenerateKey(rand.Reader)
+	agree, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	var services []*backend.Service
+	err := json.Unmarshal([]byte(`[
+		{"id": "#service", "type": "DIDCommMessaging", "serviceEndpoint": {"uri": "https://example.com/didcomm", "accept": ["didcomm/v2"]}},
+		{"id": "#files", "type": "LinkedDomains", "serviceEndpoint": "https://files.example.com/"}
+	]`), &services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	did, err := New2([]Key{{Verification, auth}, {Encryption, agree.PublicKey()}}, services)
+	if err != nil {
+		t.Fatal("new error:", err)
+	}
+	// through the string form
+	did, err = backend.Parse(did.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Expand(did)
+	if err != nil {
+		t.Fatal("expand error:", err)
+	}
+	if err := doc.Validate(); err != nil {
+		t.Error("invalid document:", err)
+	}
+	if doc.Service("service") == nil || doc.Service("files") == nil {
+		t.Errorf("got services %+v", doc.Services)
+	}
+	endpoint := string(doc.Service("service").Endpoint.Maps[0])
+	if endpoint != `{"accept":["didcomm/v2"],"uri":"https://example.com/didcomm"}` {
+		t.Errorf("got endpoint %s", endpoint)
+	}
+	if doc.AuthorizedMethod(doc.Authentication, &doc.VerificationMethods[0].ID) == nil {
+		t.Error("first key not for authentication")
+	}
+}
+
+func TestNumalgo0(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	did, err := New0(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Resolver
+	doc, _, err := r.Resolve(context.Background(), did)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	if len(doc.VerificationMethods) != 1 || doc.AssertionMethod == nil || doc.KeyAgreement != nil {
+		t.Errorf("got document %+v", doc)
+	}
+}
+
+func TestNumalgo1(t *testing.T) {
+	genesis := []byte(`{"authentication": [{"id": "#key-1", "type": "Multikey", "controller": "did:example:alice", "publicKeyMultibase": "z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7V"}]}`)
+	var r Resolver
+	did, _ := New1(genesis)
+	if _, _, err := r.Resolve(context.Background(), did); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("unknown genesis got error %v, want ErrNotFound", err)
+	}
+
+	stored, err := r.Store(genesis)
+	if err != nil {
+		t.Fatal("store error:", err)
+	}
+	if !stored.Equal(did) || stored.SpecID[:3] != "1zQ" {
+		t.Errorf("got %s, want %s", stored.String(), did.String())
+	}
+	doc, _, err := r.Resolve(context.Background(), did)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	if !doc.Subject.Equal(did) || len(doc.Authentication.Methods) != 1 {
+		t.Errorf("got document %+v", doc)
+	}
+
+	if _, err := New1([]byte(`{"id": "did:example:123"}`)); err == nil {
+		t.Error("genesis with id got no error")
+	}
+}
+
+func TestMethodSyntax(t *testing.T) {
+	for s, ok := range map[string]bool{
+		example2: true,
+		"did:peer:0z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7V": true,
+		"did:peer:1zQmWvQxTqbG2Z9HPJgG57jjwR154cKhbtJenbyYTWkjgF3e":  true,
+		"did:peer:1z2DrjgbF2bT8Mr":                                   false,
+		"did:peer:0z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7":  false,
+		"did:peer:3zQmWvQxTqbG2Z9HPJgG57jjwR154cKhbtJenbyYTWkjgF3e":  false,
+	} {
+		err := backend.ValidateMethodSyntax(backend.MustParse(s))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, backend.ErrInvalid)) {
+			t.Errorf("%s got error %v", s, err)
+		}
+	}
+}
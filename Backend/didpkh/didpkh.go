@@ -0,0 +1,179 @@
+// Package didpkh implements the did:pkh method, for blockchain accounts. The
+// identifier is a CAIP-10 account ID, which expands into a DID document
+// without network access.
+package didpkh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didethr"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// Method is the DID method name.
+const Method = "pkh"
+
+func init() {
+	backend.RegisterMethodSyntax(Method, func(specID string) error {
+		_, err := ParseAccount(specID)
+		return err
+	})
+}
+
+// CAIP-2 namespaces with verification support
+const (
+	EIP155 = "eip155" // Ethereum and EVM chains
+	BIP122 = "bip122" // Bitcoin and forks
+	Solana = "solana"
+)
+
+// CAIP-10 syntax
+var (
+	namespacePattern = regexp.MustCompile(`^[-a-z0-9]{3,8}$`)
+	referencePattern = regexp.MustCompile(`^[-_a-zA-Z0-9]{1,32}$`)
+	addressPattern   = regexp.MustCompile(`^[-.%a-zA-Z0-9]{1,128}$`)
+
+	eip155Pattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	bip122Pattern = regexp.MustCompile(`^[a-zA-Z0-9]{25,90}$`)
+)
+
+// Account is a CAIP-10 account ID.
+type Account struct {
+	Namespace string // CAIP-2, e.g., "eip155"
+	Reference string // CAIP-2, e.g., "1" for Ethereum mainnet
+	Address   string
+}
+
+// ParseAccount returns the account of a CAIP-10 string, with the address
+// validated for the namespaces supported.
+func ParseAccount(s string) (*Account, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: CAIP-10 account %q does not have 3 parts", backend.ErrInvalid, s)
+	}
+	a := &Account{Namespace: parts[0], Reference: parts[1], Address: parts[2]}
+	switch {
+	case !namespacePattern.MatchString(a.Namespace):
+		return nil, fmt.Errorf("%w: CAIP-2 namespace %q", backend.ErrInvalid, a.Namespace)
+	case !referencePattern.MatchString(a.Reference):
+		return nil, fmt.Errorf("%w: CAIP-2 reference %q", backend.ErrInvalid, a.Reference)
+	case !addressPattern.MatchString(a.Address):
+		return nil, fmt.Errorf("%w: CAIP-10 address %q", backend.ErrInvalid, a.Address)
+	}
+
+	switch a.Namespace {
+	case EIP155:
+		if !eip155Pattern.MatchString(a.Address) {
+			return nil, fmt.Errorf("%w: eip155 address %q", backend.ErrInvalid, a.Address)
+		}
+		// mixed case implies an EIP-55 checksum
+		lower, upper := strings.ToLower(a.Address[2:]), strings.ToUpper(a.Address[2:])
+		if a.Address[2:] != lower && a.Address[2:] != upper && didethr.Checksum(a.Address) != a.Address {
+			return nil, fmt.Errorf("%w: eip155 address %q has a wrong checksum", backend.ErrInvalid, a.Address)
+		}
+	case BIP122:
+		if !bip122Pattern.MatchString(a.Address) {
+			return nil, fmt.Errorf("%w: bip122 address %q", backend.ErrInvalid, a.Address)
+		}
+	case Solana:
+		if _, err := a.solanaKey(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// SolanaKey returns the Ed25519 public key of a Solana address.
+func (a *Account) solanaKey() ([]byte, error) {
+	_, key, err := multiformat.Decode(string(multiformat.Base58BTC) + a.Address)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%w: solana address %q is not an Ed25519 key in base58", backend.ErrInvalid, a.Address)
+	}
+	return key, nil
+}
+
+// String returns the CAIP-10 encoding.
+func (a *Account) String() string {
+	return a.Namespace + ":" + a.Reference + ":" + a.Address
+}
+
+// New returns the did:pkh of an account.
+func New(a *Account) backend.DID {
+	return backend.DID{Method: Method, SpecID: a.String()}
+}
+
+// Resolver expands did:pkh identifiers into documents. The zero value is
+// ready to use.
+type Resolver struct {
+	// Namespaces limits resolution to the CAIP-2 namespaces listed. Nil
+	// permits EIP155, BIP122 and Solana.
+	Namespaces []string
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *Resolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, err := r.Expand(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, new(backend.Meta), nil
+}
+
+// Expand returns the document of did.
+func (r *Resolver) Expand(did backend.DID) (*backend.Document, error) {
+	if did.Method != Method {
+		return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	a, err := ParseAccount(did.SpecID)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := r.Namespaces
+	if namespaces == nil {
+		namespaces = []string{EIP155, BIP122, Solana}
+	}
+	supported := false
+	for _, ns := range namespaces {
+		supported = supported || ns == a.Namespace
+	}
+	if !supported {
+		return nil, fmt.Errorf("%w: did:pkh namespace %q", backend.ErrMethodNotSupported, a.Namespace)
+	}
+
+	account, _ := json.Marshal(a.String())
+	m := &backend.VerificationMethod{
+		ID:         backend.URL{DID: did, RawFragment: "#blockchainAccountId"},
+		Type:       didethr.RecoveryMethod,
+		Controller: did,
+		Additional: map[string]json.RawMessage{"blockchainAccountId": account},
+	}
+	switch a.Namespace {
+	case EIP155, BIP122:
+		// key recovery from signatures
+	case Solana:
+		// “the public key is the address”
+		key, _ := a.solanaKey()
+		encoded, _ := json.Marshal(multiformat.Encode(multiformat.Base58BTC, key)[1:])
+		m.ID.RawFragment = "#controller"
+		m.Type = "Ed25519VerificationKey2018"
+		m.Additional["publicKeyBase58"] = encoded
+	default:
+		// namespace without a known signature scheme
+		m.Type = "BlockchainVerificationMethod2021"
+	}
+
+	ref := func() *backend.VerificationRelationship {
+		return &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}}
+	}
+	return &backend.Document{
+		Subject:             did,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		Authentication:      ref(),
+		AssertionMethod:     ref(),
+	}, nil
+}
@@ -0,0 +1,73 @@
+package didpkh
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		specID   string
+		fragment string
+		typ      string
+	}{
+		{"eip155:1:0xb9c5714089478a327f09197987f16f9e5d936e8a", "#blockchainAccountId", "EcdsaSecp256k1RecoveryMethod2020"},
+		{"eip155:1:0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "#blockchainAccountId", "EcdsaSecp256k1RecoveryMethod2020"},
+		{"bip122:000000000019d6689c085ae165831e93:128Lkh3S7CkDTBZ8W7BbpsN3YYizJMp8p6", "#blockchainAccountId", "EcdsaSecp256k1RecoveryMethod2020"},
+		{"solana:4sGjMW1sUnHzSxGspuhpqLDx6wiyjNtZ:CKg5d12Jhpej1JqtmxLJgaFqqeYjxgPqToJ4LBdvG9Ev", "#controller", "Ed25519VerificationKey2018"},
+	}
+	for _, test := range tests {
+		did := backend.DID{Method: Method, SpecID: test.specID}
+		doc, _, err := new(Resolver).Resolve(context.Background(), did)
+		if err != nil {
+			t.Errorf("%s got error: %s", test.specID, err)
+			continue
+		}
+		m := doc.VerificationMethods[0]
+		if m.ID.RawFragment != test.fragment || m.Type != test.typ || m.AdditionalString("blockchainAccountId") != test.specID {
+			t.Errorf("%s got verification method %+v", test.specID, m)
+		}
+		if len(doc.Authentication.URIRefs) != 1 || len(doc.AssertionMethod.URIRefs) != 1 {
+			t.Errorf("%s got document %+v", test.specID, doc)
+		}
+	}
+	solana, _ := new(Resolver).Expand(backend.DID{Method: Method, SpecID: tests[3].specID})
+	if got := solana.VerificationMethods[0].AdditionalString("publicKeyBase58"); got != "CKg5d12Jhpej1JqtmxLJgaFqqeYjxgPqToJ4LBdvG9Ev" {
+		t.Errorf("solana got key %q", got)
+	}
+
+	for _, s := range []string{
+		"eip155:1",
+		"eip155:1:0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", // checksum
+		"eip155:1:0x123",
+		"E:1:0xb9c5714089478a327f09197987f16f9e5d936e8a",
+		"solana:4sGjMW1sUnHzSxGspuhpqLDx6wiyjNtZ:0OIl",
+	} {
+		if _, err := new(Resolver).Expand(backend.DID{Method: Method, SpecID: s}); !errors.Is(err, backend.ErrInvalid) {
+			t.Errorf("%s got error %v, want ErrInvalid", s, err)
+		}
+	}
+	cosmos := backend.DID{Method: Method, SpecID: "cosmos:cosmoshub-3:cosmos1t2uflqwqe0fsj0shcfkrvpukewcw40yjj6hdc0"}
+	if _, err := new(Resolver).Expand(cosmos); !errors.Is(err, backend.ErrMethodNotSupported) {
+		t.Errorf("cosmos got error %v, want ErrMethodNotSupported", err)
+	}
+	if doc, err := (&Resolver{Namespaces: []string{"cosmos"}}).Expand(cosmos); err != nil || doc.VerificationMethods[0].Type != "BlockchainVerificationMethod2021" {
+		t.Errorf("cosmos permitted got document %+v, error %v", doc, err)
+	}
+}
+
+func TestMethodSyntax(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"did:pkh:eip155:1:0xb9c5714089478a327f09197987f16f9e5d936e8a": true,
+		"did:pkh:eip155:1":    false,
+		"did:pkh:EIP155:1:0x": false,
+	} {
+		err := backend.ValidateMethodSyntax(backend.MustParse(s))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, backend.ErrInvalid)) {
+			t.Errorf("%s got error %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package didweb implements the did:web method, conform the W3C CCG DID Method
+// Specification. Documents are fetched with HTTPS from the domain name in the
+// identifier.
+package didweb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/example"
+)
+
+// Method is the DID method name.
+const Method = "web"
+
+func init() {
+	backend.RegisterMethodSyntax(Method, checkSyntax)
+}
+
+// CheckSyntax requires a host name, with an optional port, followed by path
+// segments, as in URL.
+func checkSyntax(specID string) error {
+	u, err := URL(backend.DID{Method: Method, SpecID: specID})
+	if err != nil {
+		return err
+	}
+	if !isHostname(u.Hostname()) {
+		return fmt.Errorf("%w: did:web domain %q is not a host name", backend.ErrInvalid, u.Hostname())
+	}
+	return nil
+}
+
+// IsHostname returns whether s is a DNS name, conform RFC 1123.
+func isHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			switch c := label[i]; {
+			case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-':
+				continue
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// ErrSubject signals a document with an id other than the DID resolved. The
+// error wraps backend.ErrNotFound.
+var ErrSubject = fmt.Errorf("%w: did:web document id does not match the DID", backend.ErrNotFound)
+
+// URL returns the location of the document for did. “If no path has been
+// specified in the URL, append /.well-known”, and then “append /did.json”.
+//
+// The DID type decodes the percent-encoding of ports, which makes a port
+// indistinguishable from a path segment. Hence, a first path segment of
+// digits only reads as a port number.
+func URL(did backend.DID) (*url.URL, error) {
+	if did.Method != Method {
+		return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	segs := strings.Split(did.SpecID, ":")
+	host := segs[0]
+	segs = segs[1:]
+	if len(segs) != 0 && isPort(segs[0]) {
+		host += ":" + segs[0]
+		segs = segs[1:]
+	}
+	if host == "" || strings.ContainsAny(host, "/?#@[]") {
+		return nil, fmt.Errorf("%w: did:web domain %q", backend.ErrInvalid, host)
+	}
+
+	u := &url.URL{Scheme: "https", Host: strings.ToLower(host)}
+	if len(segs) == 0 {
+		u.Path = "/.well-known/did.json"
+		return u, nil
+	}
+	for _, seg := range segs {
+		if seg == "" || seg == "." || seg == ".." {
+			return nil, fmt.Errorf("%w: did:web path segment %q", backend.ErrInvalid, seg)
+		}
+	}
+	u.Path = "/" + strings.Join(segs, "/") + "/did.json"
+	return u, nil
+}
+
+// IsPort returns whether s is a decimal port number.
+func isPort(s string) bool {
+	if s == "" || len(s) > 5 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver implements the “Read” operation of did:web. Multiple goroutines
+// may invoke methods on a Resolver simultaneously.
+type Resolver struct {
+	// Client does the HTTP, including limits and caching.
+	example.Client
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *Resolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	u, err := URL(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, meta, err := r.Client.Resolve(ctx, u.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !doc.Subject.Equal(did) {
+		return nil, nil, fmt.Errorf("%w: got %s from %s, want %s", ErrSubject, doc.Subject.String(), u, did.String())
+	}
+	return doc, meta, nil
+}
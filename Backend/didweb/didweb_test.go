@@ -0,0 +1,100 @@
+package didweb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func TestURL(t *testing.T) {
+	tests := []struct{ did, want string }{
+		{"did:web:w3c-ccg.github.io", "https://w3c-ccg.github.io/.well-known/did.json"},
+		{"did:web:w3c-ccg.github.io:user:alice", "https://w3c-ccg.github.io/user/alice/did.json"},
+		{"did:web:example.com%3A3000", "https://example.com:3000/.well-known/did.json"},
+		{"did:web:example.com%3A3000:user:alice", "https://example.com:3000/user/alice/did.json"},
+		{"did:web:Example.COM:a%20b", "https://example.com/a%20b/did.json"},
+	}
+	for _, test := range tests {
+		did, err := backend.Parse(test.did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := URL(did)
+		if err != nil {
+			t.Errorf("%q got error: %s", test.did, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("%q got %q, want %q", test.did, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"did:example:123", "did:web:example.com::a", "did:web:example.com:..", "did:web:user%40example.com"} {
+		did, err := backend.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := URL(did); !errors.Is(err, backend.ErrInvalid) {
+			t.Errorf("%q got %v, error %v, want ErrInvalid", s, got, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user/alice/did.json":
+			host := strings.Replace(r.Host, ":", "%3A", 1)
+			w.Write([]byte(`{"id": "did:web:` + host + `:user:alice"}`))
+		case "/user/mallory/did.json":
+			w.Write([]byte(`{"id": "did:web:evil.example.com:user:mallory"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.Replace(strings.TrimPrefix(srv.URL, "https://"), ":", "%3A", 1)
+
+	var r Resolver
+	r.Client.Client = *srv.Client()
+	var _ backend.Resolver = &r
+
+	did, _ := backend.Parse("did:web:" + host + ":user:alice")
+	doc, _, err := r.Resolve(context.Background(), did)
+	if err != nil {
+		t.Fatal("resolve error:", err)
+	}
+	if !doc.Subject.Equal(did) {
+		t.Errorf("got id %s, want %s", doc.Subject.String(), did.String())
+	}
+
+	did, _ = backend.Parse("did:web:" + host + ":user:mallory")
+	if _, _, err := r.Resolve(context.Background(), did); !errors.Is(err, ErrSubject) {
+		t.Errorf("foreign document got error %v, want ErrSubject", err)
+	}
+	did, _ = backend.Parse("did:web:" + host + ":user:bob")
+	if _, _, err := r.Resolve(context.Background(), did); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("missing document got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestMethodSyntax(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"did:web:example.com":                   true,
+		"did:web:example.com%3A8443:user:alice": true,
+		"did:web:127.0.0.1%3A8080":              true,
+		"did:web:exa_mple.com":                  false,
+		"did:web:-example.com":                  false,
+		"did:web:example.com:user::x":           false,
+	} {
+		err := backend.ValidateMethodSyntax(backend.MustParse(s))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, backend.ErrInvalid)) {
+			t.Errorf("%s got error %v", s, err)
+		}
+	}
+}
@@ -1,17 +1,19 @@
 package backend
 
-// JSON-LD is omitted by design. According to the standard: “A remote context
-// may also be referenced using a relative URL, which is resolved relative to
-// the location of the document containing the reference.”. On top of that,
-// “JSON documents can be interpreted as JSON-LD without having to be modified
-// by referencing a context via an HTTP Link Header …”.
+// JSON-LD processing is omitted by design. According to the standard: “A
+// remote context may also be referenced using a relative URL, which is
+// resolved relative to the location of the document containing the
+// reference.”. On top of that, “JSON documents can be interpreted as JSON-LD
+// without having to be modified by referencing a context via an HTTP Link
+// Header …”. The "@context" is retained as is for interoperability, though.
 
 import (
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
-	"strconv"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -21,8 +23,15 @@ const V1 = "https://www.w3.org/ns/did/v1"
 // JSON is the (MIME) media type for JSON document production and consumption.
 const JSON = "application/did+json"
 
+// CBOR is the (MIME) media type for the CBOR representation of the JSON data
+// model. See package cbor.
+const CBOR = "application/did+cbor"
+
 // Document holds the “core properties” of a DID association [Subject].
 type Document struct {
+	// Context is the JSON-LD "@context", if any. See LD.
+	Context Context `json:"@context,omitempty"`
+
 	Subject DID `json:"id"` // required
 
 	AlsoKnownAs []string `json:"alsoKnownAs,omitempty"`
@@ -59,6 +68,11 @@ type Document struct {
 	// Services are used to express ways of communicating with the Subject
 	// or associated entities.
 	Services []*Service `json:"service,omitempty"`
+
+	// Proof is an embedded Data Integrity proof of the controller, if any,
+	// for integrity of documents from untrusted channels, such as mirrors.
+	// See vc.SignDocument.
+	Proof json.RawMessage `json:"proof,omitempty"`
 }
 
 // VerificationMethodRefs returns each VerificationRelationship.URIRefs pointer
@@ -126,6 +140,254 @@ func (doc *Document) VerificationMethodRefs() (perURI map[*URL]*VerificationMeth
 	return
 }
 
+// Relationship returns the verification relationship with its property name,
+// e.g., "authentication" or "assertionMethod". The return is nil for unknown
+// names, and for relationships absent in doc.
+func (doc *Document) Relationship(name string) *VerificationRelationship {
+	switch name {
+	case "authentication":
+		return doc.Authentication
+	case "assertionMethod":
+		return doc.AssertionMethod
+	case "keyAgreement":
+		return doc.KeyAgreement
+	case "capabilityInvocation":
+		return doc.CapabilityInvocation
+	case "capabilityDelegation":
+		return doc.CapabilityDelegation
+	}
+	return nil
+}
+
+// AuthorizedMethod returns the verification method with id, granted it is
+// either embedded in r, or referenced by r and present in doc. References
+// resolve against the Subject of doc. The return is nil when not found.
+func (doc *Document) AuthorizedMethod(r *VerificationRelationship, id *URL) *VerificationMethod {
+	if r == nil {
+		return nil
+	}
+	for _, m := range r.Methods {
+		if m.ID.Equal(id) {
+			return m
+		}
+	}
+	for _, ref := range r.URIRefs {
+		resolved := ref
+		if resolved.IsRelative() {
+			r := *resolved // copy
+			r.DID = doc.Subject
+			resolved = &r
+		}
+		if !resolved.Equal(id) {
+			continue
+		}
+		for _, m := range doc.VerificationMethods {
+			if m.ID.Equal(id) {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks doc against the constraints of the data model. Each
+// violation is reported, joined in one error, with nil for none.
+func (doc *Document) Validate() error {
+	var errs []error
+	if len(doc.Context) != 0 && doc.Context[0] != V1 {
+		errs = append(errs, fmt.Errorf("DID document @context does not start with %q", V1))
+	}
+	if doc.Subject.Method == "" || doc.Subject.SpecID == "" {
+		errs = append(errs, errors.New(`DID document has no "id"`))
+	}
+	for _, s := range doc.AlsoKnownAs {
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" {
+			errs = append(errs, fmt.Errorf("DID document alsoKnownAs %q is not a URI", s))
+		}
+	}
+	for _, c := range doc.Controllers {
+		if c.Method == "" || c.SpecID == "" {
+			errs = append(errs, fmt.Errorf("DID document controller %q is not a DID", c.String()))
+		}
+	}
+
+	// “If more than one verification method is present … with the same
+	// identifier, it is an error.”
+	methodIDs := make(map[string]bool)
+	checkMethod := func(m *VerificationMethod) {
+		id := m.ID
+		if id.IsRelative() {
+			id.DID = doc.Subject
+		}
+		switch {
+		case m.ID == URL{}:
+			errs = append(errs, errors.New(`DID verification method has no "id"`))
+		case methodIDs[id.String()]:
+			errs = append(errs, fmt.Errorf("DID verification method %s more than once", id.String()))
+		}
+		methodIDs[id.String()] = true
+		if m.Type == "" {
+			errs = append(errs, fmt.Errorf(`DID verification method %s has no "type"`, m.ID.String()))
+		}
+		if m.Controller == (DID{}) {
+			errs = append(errs, fmt.Errorf(`DID verification method %s has no "controller"`, m.ID.String()))
+		}
+	}
+	for _, m := range doc.VerificationMethods {
+		checkMethod(m)
+	}
+	for _, r := range [...]*VerificationRelationship{
+		doc.Authentication,
+		doc.AssertionMethod,
+		doc.KeyAgreement,
+		doc.CapabilityInvocation,
+		doc.CapabilityDelegation,
+	} {
+		if r != nil {
+			for _, m := range r.Methods {
+				checkMethod(m)
+			}
+		}
+	}
+	// references within the document must resolve
+	_, notFound := doc.VerificationMethodRefs()
+	for _, u := range notFound {
+		id := *u
+		if id.IsRelative() {
+			id.DID = doc.Subject
+		}
+		if id.DID.Equal(doc.Subject) && !methodIDs[id.String()] {
+			errs = append(errs, fmt.Errorf("DID verification relationship references %s, which is not in the document", id.String()))
+		}
+	}
+
+	serviceIDs := make(map[string]bool)
+	for _, srv := range doc.Services {
+		id := srv.ID.String()
+		if srv.ID.Scheme == "" {
+			// relative to the subject
+			if srv.ID.Fragment == "" || srv.ID.Host != "" || srv.ID.Path != "" || srv.ID.RawQuery != "" {
+				errs = append(errs, fmt.Errorf("DID service id %q is neither a URI nor a fragment reference", id))
+			}
+			u := URL{DID: doc.Subject}
+			u.SetFragment(srv.ID.Fragment)
+			id = u.String()
+		}
+		if serviceIDs[id] {
+			errs = append(errs, fmt.Errorf("DID service %s more than once", id))
+		}
+		serviceIDs[id] = true
+		if len(srv.Types) == 0 {
+			errs = append(errs, fmt.Errorf(`DID service %s has no "type"`, id))
+		}
+		for _, t := range srv.Types {
+			if t == "" {
+				errs = append(errs, fmt.Errorf("DID service %s has an empty type", id))
+			}
+		}
+		if len(srv.Endpoint.URIRefs) == 0 && len(srv.Endpoint.Maps) == 0 {
+			errs = append(errs, fmt.Errorf(`DID service %s has no "serviceEndpoint"`, id))
+		}
+	}
+
+	profilesMutex.RLock()
+	methodProfiles := profiles[doc.Subject.Method]
+	profilesMutex.RUnlock()
+	for _, p := range methodProfiles {
+		if err := p(doc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Profile checks documents against the rules of a DID method.
+type Profile func(*Document) error
+
+var (
+	profilesMutex sync.RWMutex
+	profiles      = make(map[string][]Profile) // by method name
+)
+
+// RegisterProfile adds p to the Validate of documents with a subject of
+// method. Packages of DID methods may register on init.
+func RegisterProfile(method string, p Profile) {
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+	profiles[method] = append(profiles[method], p)
+}
+
+// Methods returns the verification methods of doc, followed by the ones
+// embedded in verification relationships.
+func (doc *Document) Methods() []*VerificationMethod {
+	methods := doc.VerificationMethods
+	for _, r := range [...]*VerificationRelationship{
+		doc.Authentication,
+		doc.AssertionMethod,
+		doc.KeyAgreement,
+		doc.CapabilityInvocation,
+		doc.CapabilityDelegation,
+	} {
+		if r != nil {
+			methods = append(methods[:len(methods):len(methods)], r.Methods...)
+		}
+	}
+	return methods
+}
+
+// Service returns the service with a fragment of name in its id, granted the
+// id is either relative, or of doc Subject. The return is nil when not found.
+func (doc *Document) Service(name string) *Service {
+	for _, srv := range doc.Services {
+		if srv.ID.Fragment != name {
+			continue
+		}
+		if srv.ID.Scheme == "" && srv.ID.Opaque == "" && srv.ID.Path == "" {
+			return srv // relative
+		}
+		id, err := ParseURL(srv.ID.String())
+		if err == nil && id.DID.Equal(doc.Subject) {
+			return srv
+		}
+	}
+	return nil
+}
+
+// ServiceEndpoint dereferences the "service" and "relativeRef" parameters of
+// u into a concrete URL. For example, “did:example:123?service=files&relativeRef=/resume.pdf”
+// resolves the reference against the endpoint of service “#files”. A fragment
+// in u carries over to the result. Sets of endpoints select their first URI.
+// The error wraps ErrNotFound when doc has no such service.
+func (doc *Document) ServiceEndpoint(u *URL) (*url.URL, error) {
+	params, err := u.QueryValues()
+	if err != nil {
+		return nil, err
+	}
+	name, ref, err := ServiceParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, errors.New("DID URL has no service parameter")
+	}
+	srv := doc.Service(name)
+	if srv == nil {
+		return nil, fmt.Errorf("%w: no service %q in DID document %s", ErrNotFound, name, doc.Subject.String())
+	}
+	if len(srv.Endpoint.URIRefs) == 0 {
+		return nil, fmt.Errorf("DID service %q has no endpoint URI", name)
+	}
+	endpoint := *srv.Endpoint.URIRefs[0] // copy
+	if ref != nil {
+		endpoint = *endpoint.ResolveReference(ref)
+	}
+	if f := u.Fragment(); f != "" {
+		endpoint.Fragment = f
+		endpoint.RawFragment = ""
+	}
+	return &endpoint, nil
+}
+
 // Set represents a string, or a set of strings that confrom to the DID syntax.
 type Set []DID
 
@@ -195,7 +457,7 @@ type VerificationRelationship struct {
 // MarshalJSON implements the json.Marshaler interface.
 func (r VerificationRelationship) MarshalJSON() ([]byte, error) {
 	if len(r.Methods) == 0 && len(r.URIRefs) == 0 {
-		return []byte{'n', 'u', 'l', 'l'}, nil
+		return []byte{'[', ']'}, nil // the empty set
 	}
 
 	// embedded methods as JSON object array
@@ -205,7 +467,7 @@ func (r VerificationRelationship) MarshalJSON() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		buf = bytes
+		buf = bytes[:len(bytes)-1] // trim ']'
 	}
 
 	// URL refererences as JSON strings into array
@@ -215,7 +477,7 @@ func (r VerificationRelationship) MarshalJSON() ([]byte, error) {
 		} else {
 			buf = append(buf, ',')
 		}
-		buf = strconv.AppendQuote(buf, u.String())
+		buf = appendJSONString(buf, u.String())
 	}
 	buf = append(buf, ']')
 	return buf, nil
@@ -304,22 +566,23 @@ func (m *VerificationMethod) MarshalJSON() ([]byte, error) {
 	buf := make([]byte, 0, 256)
 
 	buf = append(buf, `{"id":`...)
-	buf = strconv.AppendQuote(buf, m.ID.String())
+	buf = appendJSONString(buf, m.ID.String())
 
 	buf = append(buf, `,"type":`...)
-	buf = strconv.AppendQuote(buf, m.Type)
+	buf = appendJSONString(buf, m.Type)
 
 	buf = append(buf, `,"controller":`...)
-	buf = strconv.AppendQuote(buf, m.Controller.String())
+	buf = appendJSONString(buf, m.Controller.String())
 
-	for property, value := range m.Additional {
+	for _, property := range sortedKeys(m.Additional) {
+		value := m.Additional[property]
 		switch property {
 		case "id", "type", "controller":
 			return nil, fmt.Errorf(`core DID verification-method property %q in additional set`, property)
 		}
 
 		buf = append(buf, ',')
-		buf = strconv.AppendQuote(buf, property)
+		buf = appendJSONString(buf, property)
 		buf = append(buf, ':')
 		buf = append(buf, value...)
 	}
@@ -398,14 +661,14 @@ func (srv *Service) MarshalJSON() ([]byte, error) {
 	buf := make([]byte, 0, 256)
 
 	buf = append(buf, `{"id":`...)
-	buf = strconv.AppendQuote(buf, srv.ID.String())
+	buf = appendJSONString(buf, srv.ID.String())
 
 	buf = append(buf, `,"type":`...)
 	switch len(srv.Types) {
 	case 0:
 		return nil, errors.New("no DID service type")
 	case 1:
-		buf = strconv.AppendQuote(buf, srv.Types[0])
+		buf = appendJSONString(buf, srv.Types[0])
 	default:
 		for i := range srv.Types {
 			if i == 0 {
@@ -413,7 +676,7 @@ func (srv *Service) MarshalJSON() ([]byte, error) {
 			} else {
 				buf = append(buf, ',')
 			}
-			buf = strconv.AppendQuote(buf, srv.Types[i])
+			buf = appendJSONString(buf, srv.Types[i])
 		}
 		buf = append(buf, ']')
 	}
@@ -425,14 +688,15 @@ func (srv *Service) MarshalJSON() ([]byte, error) {
 	}
 	buf = append(buf, bytes...)
 
-	for property, value := range srv.Additional {
+	for _, property := range sortedKeys(srv.Additional) {
+		value := srv.Additional[property]
 		switch property {
 		case "id", "type", "serviceEndpoint":
 			return nil, fmt.Errorf(`core DID service property %q in additional set`, property)
 		}
 
 		buf = append(buf, ',')
-		buf = strconv.AppendQuote(buf, property)
+		buf = appendJSONString(buf, property)
 		buf = append(buf, ':')
 		buf = append(buf, value...)
 	}
@@ -543,7 +807,7 @@ func (e ServiceEndpoint) MarshalJSON() ([]byte, error) {
 		if len(buf) > 1 {
 			buf = append(buf, ',')
 		}
-		buf = strconv.AppendQuote(buf, u.String())
+		buf = appendJSONString(buf, u.String())
 	}
 	for _, raw := range e.Maps {
 		if len(buf) > 1 {
@@ -645,6 +909,14 @@ var (
 	// accept input metadata property is not supported by the DID method
 	// and/or DID resolver implementation.”
 	ErrMediaType = errors.New("DID document media type not supported")
+
+	// “This error code is returned if the DID method is not supported by
+	// the DID resolver.”
+	ErrMethodNotSupported = errors.New("DID method not supported")
+
+	// The DID was deactivated with the “Deactivate” operation of the DID
+	// method. The Universal Resolver responds with HTTP 410 Gone.
+	ErrDeactivated = errors.New("DID deactivated")
 )
 
 // Resolve a DID into a Document by using the “Read” operation of the DID
@@ -652,7 +924,9 @@ var (
 //
 // Implementations should return ErrInvalid when encountering an "invalidDid"
 // error code, or ErrNotFound on the "notFound" code, or ErrMediaType on the
-// "representationNotSupported" code.
+// "representationNotSupported" code, or ErrMethodNotSupported on the
+// "methodNotSupported" code. Deactivated DIDs may either resolve with the
+// Meta.Deactivated set, or fail with ErrDeactivated.
 type Resolve func(DID) (*Document, *Meta, error)
 
 // Meta describes a Document. Note that all properties are optional.
@@ -661,7 +935,64 @@ type Meta struct {
 	Updated       time.Time `json:"updated,omitempty"`
 	Deactivated   time.Time `json:"deactivated,omitempty"`
 	NextUpdate    time.Time `json:"nextUpdate,omitempty"`
+	VersionID     string    `json:"versionId,omitempty"`
 	NextVersionID string    `json:"nextVersionId,omitempty"`
 	EquivalentIDs []DID     `json:"equivalentId,omitempty"`
 	CanonicalID   *DID      `json:"canonicalId,omitempty"`
+
+	// KeyRotations is the history of verification methods replaced, in
+	// chronological order. See package rotation.
+	KeyRotations []KeyRotation `json:"keyRotations,omitempty"`
+
+	// Expires is the end of freshness as signalled by the transport, such
+	// as HTTP caching, if any. See CachedResolver.
+	Expires time.Time `json:"-"`
+}
+
+// KeyRotation records the replacement of a verification method. Keys are in
+// the publicKeyMultibase format, and commitments are to the next key.
+type KeyRotation struct {
+	Method URL       `json:"method"`
+	Time   time.Time `json:"time"`
+
+	PreviousKey        string `json:"previousKey"`
+	PreviousCommitment string `json:"previousCommitment,omitempty"`
+	Key                string `json:"key"`
+	NextCommitment     string `json:"nextCommitment,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. Zero times are omitted,
+// which the omitempty option does not do for structs.
+func (m Meta) MarshalJSON() ([]byte, error) {
+	type plain Meta // without methods
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	return json.Marshal(struct {
+		plain
+		Created     *time.Time `json:"created,omitempty"`
+		Updated     *time.Time `json:"updated,omitempty"`
+		Deactivated *time.Time `json:"deactivated,omitempty"`
+		NextUpdate  *time.Time `json:"nextUpdate,omitempty"`
+	}{plain(m), optional(m.Created), optional(m.Updated), optional(m.Deactivated), optional(m.NextUpdate)})
+}
+
+// AppendJSONString appends s as a JSON string. Note that strconv.AppendQuote
+// produces Go escapes, such as "\x00", which are not valid JSON.
+func appendJSONString(buf []byte, s string) []byte {
+	bytes, _ := json.Marshal(s) // strings never fail
+	return append(buf, bytes...)
+}
+
+// SortedKeys returns the properties in order, for a stable encoding.
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,353 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Example31 is borrowed from the W3C.
+// https://www.w3.org/TR/did-core/#example-various-verification-method-types
+const example31 = `{
+	"@context": ["https://www.w3.org/ns/did/v1", "https://w3id.org/security/suites/jws-2020/v1"],
+	"id": "did:example:123456789abcdefghi",
+	"alsoKnownAs": ["https://example.com/alice"],
+	"controller": "did:example:bcehfew7h32f32h7af3",
+	"verificationMethod": [{
+		"id": "did:example:123#key-0",
+		"type": "JsonWebKey2020",
+		"controller": "did:example:123",
+		"publicKeyJwk": {"kty": "OKP", "crv": "Ed25519", "x": "VCpo2LMLhn6iWku8MKvSLg2ZAoC-nlOyPVQaO3FxVeQ"}
+	}],
+	"authentication": [
+		"did:example:123#key-0",
+		{
+			"id": "did:example:123#key-1",
+			"type": "Ed25519VerificationKey2020",
+			"controller": "did:example:123",
+			"publicKeyMultibase": "zH3C2AVvLMv6gmMNam3uVAjZpfkcJCwDwnZn6z3wXmqPV"
+		}
+	],
+	"keyAgreement": ["#key-0"],
+	"service": [{
+		"id": "did:example:123#linked-domain",
+		"type": "LinkedDomains",
+		"serviceEndpoint": "https://bar.example.com"
+	}]
+}`
+
+func TestDocumentJSON(t *testing.T) {
+	var doc Document
+	if err := json.Unmarshal([]byte(example31), &doc); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+	// the example has its method under another DID than the subject
+	const want = "DID verification relationship references did:example:123456789abcdefghi#key-0, which is not in the document"
+	if err := doc.Validate(); err == nil || err.Error() != want {
+		t.Errorf("got validate error %v, want %q", err, want)
+	}
+	if got := doc.Subject.String(); got != "did:example:123456789abcdefghi" {
+		t.Errorf("got id %q", got)
+	}
+	if len(doc.Controllers) != 1 || !doc.Controllers.ContainsString("did:example:bcehfew7h32f32h7af3") {
+		t.Errorf("got controllers %q", doc.Controllers)
+	}
+	if len(doc.Authentication.URIRefs) != 1 || len(doc.Authentication.Methods) != 1 {
+		t.Errorf("got authentication %+v", doc.Authentication)
+	}
+	if got := doc.Authentication.Methods[0].AdditionalString("publicKeyMultibase"); got != "zH3C2AVvLMv6gmMNam3uVAjZpfkcJCwDwnZn6z3wXmqPV" {
+		t.Errorf("got embedded publicKeyMultibase %q", got)
+	}
+
+	// round trip
+	b, err := json.Marshal(&doc)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+	var again Document
+	if err := json.Unmarshal(b, &again); err != nil {
+		t.Fatalf("unmarshal of %s: %s", b, err)
+	}
+	b2, err := json.Marshal(&again)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+	if string(b) != string(b2) {
+		t.Errorf("round trip got %s, want %s", b2, b)
+	}
+}
+
+func TestDocumentValidate(t *testing.T) {
+	var doc Document
+	err := json.Unmarshal([]byte(`{
+		"id": "did:example:123",
+		"alsoKnownAs": ["no scheme"],
+		"verificationMethod": [
+			{"id": "#key-0", "type": "", "controller": "did:example:123"},
+			{"id": "did:example:123#key-0", "type": "JsonWebKey2020", "controller": "did:example:123"}
+		],
+		"authentication": ["#key-0", "#key-9", "did:example:other#key-1"],
+		"service": [
+			{"id": "#relative", "type": "LinkedDomains", "serviceEndpoint": "https://bar.example.com"},
+			{"id": "did:example:123#relative", "type": "LinkedDomains", "serviceEndpoint": "https://bar.example.com"},
+			{"id": "other/path", "type": "LinkedDomains", "serviceEndpoint": "https://bar.example.com"},
+			{"id": "https://example.com/svc", "type": "", "serviceEndpoint": "https://bar.example.com"},
+			{"id": "https://example.com/svc", "type": "X", "serviceEndpoint": "https://bar.example.com"}
+		]
+	}`), &doc)
+	if err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+	err = doc.Validate()
+	if err == nil {
+		t.Fatal("no validation error")
+	}
+	want := []string{
+		`DID document alsoKnownAs "no scheme" is not a URI`,
+		`DID verification method #key-0 has no "type"`,
+		`DID verification method did:example:123#key-0 more than once`,
+		`DID verification relationship references did:example:123#key-9, which is not in the document`,
+		`DID service did:example:123#relative more than once`,
+		`DID service id "other/path" is neither a URI nor a fragment reference`,
+		`DID service https://example.com/svc has an empty type`,
+		`DID service https://example.com/svc more than once`,
+	}
+	got := strings.Split(err.Error(), "\n")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if err := new(Document).Validate(); err == nil || err.Error() != `DID document has no "id"` {
+		t.Errorf("zero document got error %v", err)
+	}
+}
+
+func TestServiceEndpoint(t *testing.T) {
+	var doc Document
+	err := json.Unmarshal([]byte(`{
+		"id": "did:example:123",
+		"service": [
+			{"id": "#agent", "type": "DIDCommMessaging", "serviceEndpoint": "https://agent.example.com/base/"},
+			{"id": "did:example:123#files", "type": "LinkedDomains", "serviceEndpoint": ["https://files.example.com/", {"uri": "ignored"}]},
+			{"id": "did:example:other#foreign", "type": "LinkedDomains", "serviceEndpoint": "https://foreign.example.com/"},
+			{"id": "#map", "type": "X", "serviceEndpoint": {"uri": "https://map.example.com/"}}
+		]
+	}`), &doc)
+	if err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	tests := []struct{ didURL, want string }{
+		{example6, "https://agent.example.com/credentials#degree"},
+		{example8, "https://files.example.com/resume.pdf"},
+		{"did:example:123?service=agent&relativeRef=sub%2Fpath%3Fq%3D1", "https://agent.example.com/base/sub/path?q=1"},
+		{"did:example:123?service=agent", "https://agent.example.com/base/"},
+	}
+	for _, test := range tests {
+		u, err := ParseURL(test.didURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := doc.ServiceEndpoint(u)
+		if err != nil {
+			t.Errorf("%q got error: %s", test.didURL, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("%q got %q, want %q", test.didURL, got, test.want)
+		}
+	}
+
+	for _, didURL := range []string{
+		"did:example:123?service=foreign",
+		"did:example:123?service=missing",
+	} {
+		u, _ := ParseURL(didURL)
+		if _, err := doc.ServiceEndpoint(u); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q got error %v, want ErrNotFound", didURL, err)
+		}
+	}
+	for _, didURL := range []string{
+		"did:example:123",
+		"did:example:123?service=map",
+		"did:example:123?service=agent&service=files",
+		"did:example:123?relativeRef=/x",
+		"did:example:123?service=agent&relativeRef=https://evil.example.com/",
+	} {
+		u, _ := ParseURL(didURL)
+		if got, err := doc.ServiceEndpoint(u); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("%q got %v, error %v", didURL, got, err)
+		}
+	}
+}
+
+func TestMethodRegistry(t *testing.T) {
+	var reg MethodRegistry
+	reg.Register("example", Resolve(func(did DID) (*Document, *Meta, error) {
+		return &Document{Subject: did}, nil, nil
+	}))
+	reg.Register("web", Resolve(func(DID) (*Document, *Meta, error) {
+		return nil, nil, ErrNotFound
+	}))
+	if got := strings.Join(reg.Methods(), " "); got != "example web" {
+		t.Errorf("got methods %q", got)
+	}
+
+	var r Resolver = &reg
+	doc, _, err := r.Resolve(context.Background(), DID{Method: "example", SpecID: "123"})
+	if err != nil || doc.Subject.SpecID != "123" {
+		t.Errorf("example method got %v, error %v", doc, err)
+	}
+	if _, _, err := r.Resolve(context.Background(), DID{Method: "web", SpecID: "a.example"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("web method got error %v, want ErrNotFound", err)
+	}
+	if _, _, err := reg.ResolveVersion(context.Background(), DID{Method: "example", SpecID: "123"}, "2", time.Time{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("version without support got error %v, want ErrNotFound", err)
+	}
+	reg.Unregister("web")
+	resolve := ResolveFunc(context.Background(), &reg)
+	if _, _, err := resolve(DID{Method: "web", SpecID: "a.example"}); !errors.Is(err, ErrMethodNotSupported) {
+		t.Errorf("unregistered method got error %v, want ErrMethodNotSupported", err)
+	}
+}
+
+func TestResolveTimed(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	// ignores the context on purpose
+	hang := Resolve(func(did DID) (*Document, *Meta, error) {
+		<-release
+		return &Document{Subject: did}, nil, nil
+	})
+	did := DID{Method: "example", SpecID: "123"}
+
+	_, _, meta, err := ResolveTimed(context.Background(), hang, did, 20*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout got error %v, want context.DeadlineExceeded", err)
+	}
+	if meta == nil || meta.Duration < 20*time.Millisecond {
+		t.Errorf("timeout got resolution metadata %+v, want a duration of at least 20ms", meta)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := ResolveTimed(ctx, hang, did, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancel got error %v, want context.Canceled", err)
+	}
+
+	quick := Resolve(func(did DID) (*Document, *Meta, error) {
+		return &Document{Subject: did}, new(Meta), nil
+	})
+	doc, _, meta, err := ResolveTimed(context.Background(), quick, did, time.Second)
+	if err != nil || !doc.Subject.Equal(did) {
+		t.Fatalf("got document %v, error %v", doc, err)
+	}
+	meta.Duration = 1500 * time.Microsecond
+	if got, _ := json.Marshal(meta); string(got) != `{"duration":1}` {
+		t.Errorf("got resolution metadata JSON %s, want {\"duration\":1}", got)
+	}
+}
+
+func TestDocumentLD(t *testing.T) {
+	const doc = `{"@context":["https://www.w3.org/ns/did/v1",{"@vocab":"https://example.com/#"}],"id":"did:example:123","verificationMethod":[{"id":"#key-1","type":"Multikey","controller":"did:example:123"}]}`
+	var d Document
+	if err := json.Unmarshal([]byte(doc), &d); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := json.Marshal(&d); err != nil || string(got) != doc {
+		t.Errorf("round trip got %s, error %v\nwant %s", got, err, doc)
+	}
+
+	ld := d.LD("https://example.com/custom/v1", V1)
+	got, err := json.Marshal(ld.Context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `["https://www.w3.org/ns/did/v1",{"@vocab":"https://example.com/#"},"https://w3id.org/security/multikey/v1","https://example.com/custom/v1"]`
+	if string(got) != want {
+		t.Errorf("got LD context %s\nwant %s", got, want)
+	}
+	if len(d.Context) != 2 {
+		t.Errorf("LD modified the original context to %v", d.Context)
+	}
+
+	plain := &Document{Subject: DID{Method: "example", SpecID: "123"}}
+	if got, _ := json.Marshal(plain.LD()); string(got) != `{"@context":"https://www.w3.org/ns/did/v1","id":"did:example:123"}` {
+		t.Errorf("plain LD got %s", got)
+	}
+
+	for _, s := range []string{`{"@context":42,"id":"did:example:123"}`, `{"@context":[true],"id":"did:example:123"}`} {
+		if err := json.Unmarshal([]byte(s), new(Document)); err == nil {
+			t.Errorf("%s got no error", s)
+		}
+	}
+	wrong := &Document{Context: Context{"https://example.com/v1"}, Subject: DID{Method: "example", SpecID: "123"}}
+	if err := wrong.Validate(); err == nil {
+		t.Error("context without DID v1 first got no validation error")
+	}
+}
+
+// Example1 is the simple document of the W3C.
+// https://www.w3.org/TR/did-core/#example-a-simple-did-document
+const example1 = `{
+	"@context": ["https://www.w3.org/ns/did/v1", "https://w3id.org/security/suites/ed25519-2020/v1"],
+	"id": "did:example:123456789abcdefghi",
+	"authentication": [{
+		"id": "did:example:123456789abcdefghi#keys-1",
+		"type": "Ed25519VerificationKey2020",
+		"controller": "did:example:123456789abcdefghi",
+		"publicKeyMultibase": "zH3C2AVvLMv6gmMNam3uVAjZpfkcJCwDwnZn6z3wXmqPV"
+	}]
+}`
+
+// Example22 has service endpoints in the map and in the set form.
+// https://www.w3.org/TR/did-core/#services
+const example22 = `{
+	"@context": "https://www.w3.org/ns/did/v1",
+	"id": "did:example:123",
+	"controller": ["did:example:123", "did:example:456"],
+	"service": [{
+		"id": "did:example:123#linked-domain",
+		"type": "LinkedDomains",
+		"serviceEndpoint": "https://bar.example.com"
+	}, {
+		"id": "#hub",
+		"type": ["DIDCommMessaging", "Hub"],
+		"serviceEndpoint": [{"uri": "https://hub.example.com", "accept": ["didcomm/v2"]}, "https://alt.example.com"]
+	}]
+}`
+
+// Any document which decodes must encode, and the encoding must be stable.
+func FuzzDocumentJSON(f *testing.F) {
+	for _, s := range []string{example1, example22, example31, `{"id":"did:a:b"}`, `{}`} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return
+		}
+		// no panics
+		doc.Validate()
+		doc.Index()
+
+		encoded, err := json.Marshal(&doc)
+		if err != nil {
+			t.Fatalf("%s decoded as %+v, which got encode error: %s", data, doc, err)
+		}
+		var again Document
+		if err := json.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("%s encoded as %s, which got decode error: %s", data, encoded, err)
+		}
+		reencoded, err := json.Marshal(&again)
+		if err != nil {
+			t.Fatalf("%s got encode error after round trip: %s", encoded, err)
+		}
+		if string(reencoded) != string(encoded) {
+			t.Errorf("%s encoded as %s, and then as %s", data, encoded, reencoded)
+		}
+	})
+}
@@ -0,0 +1,488 @@
+// Package edv is a client of Encrypted Data Vaults, conform the Confidential
+// Storage specification of DIF. A vault is keyed to a controller DID. Each
+// document is a JWE for the key agreement key of the controller, such that the
+// storage provider learns nothing but the size and the blinded index entries.
+// Attributes are indexed with HMAC-SHA256 over the name, and over the name and
+// value together, which allows for queries on exact matches without
+// disclosure.
+//
+//	POST   {base}                       create a vault
+//	GET    {vault}                      vault configuration
+//	POST   {vault}/documents            insert a document
+//	GET    {vault}/documents/{id}       read a document
+//	POST   {vault}/documents/{id}       update a document
+//	DELETE {vault}/documents/{id}       delete a document
+//	POST   {vault}/query                find documents on index
+//
+// Requests carry a DID Auth bearer token of the controller, as verified by
+// authz.DIDAuth, in place of authorization capabilities.
+package edv
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/didcomm"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// Key types of the configuration
+const (
+	KeyAgreementType = "X25519KeyAgreementKey2020"
+	HMACType         = "Sha256HmacKey2019"
+)
+
+// ResponseMax is the size limit for response bodies.
+const ResponseMax = 8 << 20
+
+// TokenLifetime is the validity period of the DID Auth tokens.
+const TokenLifetime = time.Minute
+
+var (
+	// ErrNotFound signals a vault or document which does not exist.
+	ErrNotFound = errors.New("EDV resource not found")
+
+	// ErrConflict signals a write with a sequence which is not the next
+	// one, or with a unique index entry in use.
+	ErrConflict = errors.New("EDV write conflict")
+)
+
+// KeyRef identifies a key of the controller.
+type KeyRef struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Config is a vault configuration.
+type Config struct {
+	ID              string `json:"id,omitempty"`
+	Sequence        uint64 `json:"sequence"`
+	Controller      string `json:"controller"`
+	ReferenceID     string `json:"referenceId,omitempty"`
+	KeyAgreementKey KeyRef `json:"keyAgreementKey"`
+	HMAC            KeyRef `json:"hmac"`
+}
+
+// Attribute is an index entry. Unique entries may occur only once per vault.
+type Attribute struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Unique bool   `json:"unique,omitempty"`
+}
+
+// IndexedAttributes are the blinded entries of one HMAC key.
+type IndexedAttributes struct {
+	HMAC       KeyRef      `json:"hmac"`
+	Sequence   uint64      `json:"sequence"`
+	Attributes []Attribute `json:"attributes"`
+}
+
+// EncryptedDocument is the stored form of a Document.
+type EncryptedDocument struct {
+	ID       string              `json:"id"`
+	Sequence uint64              `json:"sequence"`
+	Indexed  []IndexedAttributes `json:"indexed,omitempty"`
+	JWE      json.RawMessage     `json:"jwe"`
+}
+
+// Document is the plaintext of an EncryptedDocument, i.e., a “structured
+// document”.
+type Document struct {
+	ID      string          `json:"id"`
+	Meta    map[string]any  `json:"meta,omitempty"`
+	Content json.RawMessage `json:"content"`
+
+	// Sequence is the number of updates, as read from the vault.
+	Sequence uint64 `json:"-"`
+
+	// Attributes are the plaintext index entries. They are blinded on
+	// each write, and thus absent in documents read from the vault.
+	Attributes []Attribute `json:"-"`
+}
+
+// Query matches documents on blinded index entries. Equals matches when all
+// name–value pairs of any of its elements match. Has matches when each of the
+// names is present.
+type Query struct {
+	Index  string              `json:"index"`
+	Equals []map[string]string `json:"equals,omitempty"`
+	Has    []string            `json:"has,omitempty"`
+}
+
+// NewID returns a random document or vault identifier, i.e., 128 bits in
+// base58btc multibase.
+func NewID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return multiformat.Encode(multiformat.Base58BTC, id[:]), nil
+}
+
+// Client acts on vaults of one controller.
+type Client struct {
+	BaseURL string       // vault collection, e.g., "https://edv.example/edvs"
+	HTTP    *http.Client // nil for http.DefaultClient
+
+	// Resolver provides the key agreement keys of the controller.
+	Resolver backend.Resolver
+
+	// Signer with its authentication method KeyID authenticates each
+	// request on behalf of the controller, i.e., the DID of KeyID.
+	Signer crypto.Signer
+	KeyID  *backend.URL
+
+	// Audience is the "aud" of the tokens, which defaults to BaseURL.
+	Audience string
+
+	// Keys has the key agreement keys by DID URL of their method.
+	Keys map[string]*ecdh.PrivateKey
+
+	// HMACKeys has the index secrets by identifier.
+	HMACKeys map[string][]byte
+}
+
+// NewConfig returns a vault configuration for the controller of c, with the
+// key agreement key kid and the index secret hmacID, which must both be
+// available to c.
+func (c *Client) NewConfig(kid, hmacID, referenceID string) (*Config, error) {
+	if c.Keys[kid] == nil {
+		return nil, fmt.Errorf("no key agreement key %q available", kid)
+	}
+	if len(c.HMACKeys[hmacID]) < sha256.Size {
+		return nil, fmt.Errorf("index secret %q needs at least %d bytes", hmacID, sha256.Size)
+	}
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		ID:              id,
+		Controller:      c.KeyID.DID.String(),
+		ReferenceID:     referenceID,
+		KeyAgreementKey: KeyRef{ID: kid, Type: KeyAgreementType},
+		HMAC:            KeyRef{ID: hmacID, Type: HMACType},
+	}, nil
+}
+
+// Create registers a vault with conf, and it returns the vault at its new
+// location.
+func (c *Client) Create(ctx context.Context, conf *Config) (*Vault, error) {
+	if !c.KeyID.DID.EqualString(conf.Controller) {
+		return nil, fmt.Errorf("vault controller %q is not %s", conf.Controller, c.KeyID.DID.String())
+	}
+	resp, err := c.do(ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/"), conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{c: c, URL: loc, Config: conf}, nil
+}
+
+// Open returns the vault at vaultURL, with its configuration.
+func (c *Client) Open(ctx context.Context, vaultURL string) (*Vault, error) {
+	conf := new(Config)
+	if _, err := c.do(ctx, http.MethodGet, vaultURL, nil, conf); err != nil {
+		return nil, err
+	}
+	if !c.KeyID.DID.EqualString(conf.Controller) {
+		return nil, fmt.Errorf("vault controller %q is not %s", conf.Controller, c.KeyID.DID.String())
+	}
+	return &Vault{c: c, URL: strings.TrimSuffix(vaultURL, "/"), Config: conf}, nil
+}
+
+// Location returns the absolute Location of a creation.
+func location(resp *http.Response) (string, error) {
+	loc, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("EDV creation response: %w", err)
+	}
+	return strings.TrimSuffix(loc.String(), "/"), nil
+}
+
+// Token returns a DID Auth bearer token.
+func (c *Client) token() (string, error) {
+	aud := c.Audience
+	if aud == "" {
+		aud = c.BaseURL
+	}
+	now := time.Now().Unix()
+	payload, err := json.Marshal(&authz.Token{
+		Issuer:   c.KeyID.DID.String(),
+		Audience: aud,
+		IssuedAt: now,
+		Expires:  now + int64(TokenLifetime/time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	return jose.Sign(jose.Header{Kid: c.KeyID.String()}, payload, c.Signer)
+}
+
+// Do executes a call on location, and it decodes the response into out when
+// not nil.
+func (c *Client) do(ctx context.Context, method, location string, in, out any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, location, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("EDV unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ResponseMax+1))
+	if err != nil {
+		return nil, fmt.Errorf("EDV response: %w", err)
+	}
+	if len(data) > ResponseMax {
+		return nil, fmt.Errorf("EDV response exceeds %d bytes", ResponseMax)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		break
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s %s", ErrNotFound, method, location)
+	case http.StatusConflict:
+		return nil, fmt.Errorf("%w: %s", ErrConflict, bytes.TrimSpace(data))
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("%w: EDV got HTTP %q: %s", authz.ErrUnauthenticated, resp.Status, bytes.TrimSpace(data))
+	default:
+		return nil, fmt.Errorf("EDV got HTTP %q: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("EDV response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// Vault is a vault of the controller of a Client.
+type Vault struct {
+	c      *Client
+	URL    string // location of the vault
+	Config *Config
+}
+
+func (v *Vault) documentURL(id string) string {
+	return v.URL + "/documents/" + url.PathEscape(id)
+}
+
+// Insert stores a new document. The ID is set when zero.
+func (v *Vault) Insert(ctx context.Context, doc *Document) error {
+	if doc.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		doc.ID = id
+	}
+	doc.Sequence = 0
+	enc, err := v.encrypt(ctx, doc)
+	if err != nil {
+		return err
+	}
+	_, err = v.c.do(ctx, http.MethodPost, v.URL+"/documents", enc, nil)
+	return err
+}
+
+// Update replaces a document with the next sequence. Writes in between fail
+// with ErrConflict. Sequence is incremented on success.
+func (v *Vault) Update(ctx context.Context, doc *Document) error {
+	next := *doc // copy
+	next.Sequence++
+	enc, err := v.encrypt(ctx, &next)
+	if err != nil {
+		return err
+	}
+	if _, err := v.c.do(ctx, http.MethodPost, v.documentURL(doc.ID), enc, nil); err != nil {
+		return err
+	}
+	doc.Sequence = next.Sequence
+	return nil
+}
+
+// Get reads a document.
+func (v *Vault) Get(ctx context.Context, id string) (*Document, error) {
+	enc := new(EncryptedDocument)
+	if _, err := v.c.do(ctx, http.MethodGet, v.documentURL(id), nil, enc); err != nil {
+		return nil, err
+	}
+	if enc.ID != id {
+		return nil, fmt.Errorf("EDV served document %q for %q", enc.ID, id)
+	}
+	return v.decrypt(enc)
+}
+
+// Delete removes a document.
+func (v *Vault) Delete(ctx context.Context, id string) error {
+	_, err := v.c.do(ctx, http.MethodDelete, v.documentURL(id), nil, nil)
+	return err
+}
+
+// Find returns the documents with an attribute for each name–value pair.
+func (v *Vault) Find(ctx context.Context, equals map[string]string) ([]*Document, error) {
+	blinded := make(map[string]string, len(equals))
+	for name, value := range equals {
+		n, val, err := v.blind(name, value)
+		if err != nil {
+			return nil, err
+		}
+		blinded[n] = val
+	}
+	return v.query(ctx, &Query{Index: v.Config.HMAC.ID, Equals: []map[string]string{blinded}})
+}
+
+// Has returns the documents with an attribute for each of the names.
+func (v *Vault) Has(ctx context.Context, names ...string) ([]*Document, error) {
+	q := &Query{Index: v.Config.HMAC.ID}
+	for _, name := range names {
+		// the blinded name does not depend on the value
+		n, _, err := v.blind(name, "")
+		if err != nil {
+			return nil, err
+		}
+		q.Has = append(q.Has, n)
+	}
+	return v.query(ctx, q)
+}
+
+func (v *Vault) query(ctx context.Context, q *Query) ([]*Document, error) {
+	var found []*EncryptedDocument
+	if _, err := v.c.do(ctx, http.MethodPost, v.URL+"/query", q, &found); err != nil {
+		return nil, err
+	}
+	docs := make([]*Document, 0, len(found))
+	for _, enc := range found {
+		doc, err := v.decrypt(enc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// Blind returns the HMAC of the name, and the HMAC of the name–value pair as
+// a JSON object, i.e., {"name":"value"}, both in base64url. Equal values of
+// distinct names thus blind differently.
+func (v *Vault) blind(name, value string) (string, string, error) {
+	secret := v.c.HMACKeys[v.Config.HMAC.ID]
+	if secret == nil {
+		return "", "", fmt.Errorf("no index secret %q available", v.Config.HMAC.ID)
+	}
+	pair, err := json.Marshal(map[string]string{name: value})
+	if err != nil {
+		return "", "", err
+	}
+	sum := func(b []byte) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return sum([]byte(name)), sum(pair), nil
+}
+
+func (v *Vault) encrypt(ctx context.Context, doc *Document) (*EncryptedDocument, error) {
+	if doc.Content == nil {
+		return nil, errors.New("EDV document without content")
+	}
+	recipients, err := didcomm.RecipientKeys(ctx, v.c.Resolver, v.c.KeyID.DID)
+	if err != nil {
+		return nil, err
+	}
+	var recipient []didcomm.Recipient
+	for _, r := range recipients {
+		if r.KID == v.Config.KeyAgreementKey.ID {
+			recipient = append(recipient, r)
+		}
+	}
+	if len(recipient) == 0 {
+		return nil, fmt.Errorf("%w: no key agreement method %s in DID document", backend.ErrNotFound, v.Config.KeyAgreementKey.ID)
+	}
+	plaintext, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	jwe, err := didcomm.Encrypt(plaintext, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := &EncryptedDocument{ID: doc.ID, Sequence: doc.Sequence, JWE: jwe}
+	if len(doc.Attributes) != 0 {
+		index := IndexedAttributes{HMAC: v.Config.HMAC, Sequence: doc.Sequence}
+		for _, a := range doc.Attributes {
+			name, value, err := v.blind(a.Name, a.Value)
+			if err != nil {
+				return nil, err
+			}
+			index.Attributes = append(index.Attributes, Attribute{Name: name, Value: value, Unique: a.Unique})
+		}
+		enc.Indexed = []IndexedAttributes{index}
+	}
+	return enc, nil
+}
+
+func (v *Vault) decrypt(enc *EncryptedDocument) (*Document, error) {
+	plaintext, _, err := didcomm.Decrypt(enc.JWE, func(kid string) *ecdh.PrivateKey {
+		return v.c.Keys[kid]
+	})
+	if err != nil {
+		return nil, fmt.Errorf("EDV document %q: %w", enc.ID, err)
+	}
+	doc := new(Document)
+	if err := json.Unmarshal(plaintext, doc); err != nil {
+		return nil, fmt.Errorf("EDV document %q: %w", enc.ID, err)
+	}
+	// the plaintext binds the identifier
+	if doc.ID != enc.ID {
+		return nil, fmt.Errorf("EDV document %q has plaintext of %q", enc.ID, doc.ID)
+	}
+	doc.Sequence = enc.Sequence
+	return doc, nil
+}
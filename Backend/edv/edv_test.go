@@ -0,0 +1,320 @@
+package edv
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// Server is a minimal vault service in memory.
+type server struct {
+	auth *authz.DIDAuth
+
+	mutex  sync.Mutex
+	vaults map[string]*Config
+	docs   map[string]map[string]*EncryptedDocument // by vault and by ID
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /edvs", func(w http.ResponseWriter, r *http.Request) {
+		conf := new(Config)
+		if json.NewDecoder(r.Body).Decode(conf) != nil || conf.ID == "" {
+			http.Error(w, "malformed configuration", http.StatusBadRequest)
+			return
+		}
+		s.vaults[conf.ID] = conf
+		s.docs[conf.ID] = make(map[string]*EncryptedDocument)
+		w.Header().Set("Location", "/edvs/"+conf.ID)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /edvs/{vault}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(s.vaults[r.PathValue("vault")])
+	})
+	mux.HandleFunc("POST /edvs/{vault}/documents", func(w http.ResponseWriter, r *http.Request) {
+		s.write(w, r, "")
+	})
+	mux.HandleFunc("POST /edvs/{vault}/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s.write(w, r, r.PathValue("id"))
+	})
+	mux.HandleFunc("GET /edvs/{vault}/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := s.docs[r.PathValue("vault")][r.PathValue("id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(doc)
+	})
+	mux.HandleFunc("DELETE /edvs/{vault}/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		delete(s.docs[r.PathValue("vault")], r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /edvs/{vault}/query", func(w http.ResponseWriter, r *http.Request) {
+		var q Query
+		json.NewDecoder(r.Body).Decode(&q)
+		found := []*EncryptedDocument{}
+		for _, doc := range s.docs[r.PathValue("vault")] {
+			if matches(doc, &q) {
+				found = append(found, doc)
+			}
+		}
+		json.NewEncoder(w).Encode(found)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := s.auth.Authenticate(r)
+		if err != nil || p == nil {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Write inserts when id is zero, and it updates otherwise.
+func (s *server) write(w http.ResponseWriter, r *http.Request, id string) {
+	docs, ok := s.docs[r.PathValue("vault")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	doc := new(EncryptedDocument)
+	if json.NewDecoder(r.Body).Decode(doc) != nil {
+		http.Error(w, "malformed document", http.StatusBadRequest)
+		return
+	}
+	old, exists := docs[doc.ID]
+	switch {
+	case id == "" && exists:
+		http.Error(w, "duplicate document", http.StatusConflict)
+		return
+	case id != "" && (id != doc.ID || !exists):
+		http.NotFound(w, r)
+		return
+	case id != "" && doc.Sequence != old.Sequence+1:
+		http.Error(w, "sequence mismatch", http.StatusConflict)
+		return
+	}
+	for _, other := range docs {
+		if other.ID != doc.ID && uniqueConflict(doc, other) {
+			http.Error(w, "unique attribute in use", http.StatusConflict)
+			return
+		}
+	}
+	docs[doc.ID] = doc
+	if id == "" {
+		w.Header().Set("Location", r.URL.Path+"/"+doc.ID)
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func uniqueConflict(a, b *EncryptedDocument) bool {
+	for _, ia := range a.Indexed {
+		for _, x := range ia.Attributes {
+			for _, ib := range b.Indexed {
+				for _, y := range ib.Attributes {
+					if ia.HMAC.ID == ib.HMAC.ID && x.Unique && y.Unique && x.Name == y.Name && x.Value == y.Value {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matches(doc *EncryptedDocument, q *Query) bool {
+	get := func(name string) (string, bool) {
+		for _, index := range doc.Indexed {
+			if index.HMAC.ID != q.Index {
+				continue
+			}
+			for _, a := range index.Attributes {
+				if a.Name == name {
+					return a.Value, true
+				}
+			}
+		}
+		return "", false
+	}
+	for _, name := range q.Has {
+		if _, ok := get(name); !ok {
+			return false
+		}
+	}
+	if len(q.Equals) == 0 {
+		return len(q.Has) != 0
+	}
+	for _, equals := range q.Equals {
+		all := true
+		for name, value := range equals {
+			got, ok := get(name)
+			all = all && ok && got == value
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// Directory is a Resolver of fixed documents.
+type directory map[string]*backend.Document
+
+func (d directory) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, ok := d[did.String()]
+	if !ok {
+		return nil, nil, backend.ErrNotFound
+	}
+	return doc, new(backend.Meta), nil
+}
+
+// NewClient returns a client for a new controller in dir.
+func newClient(t *testing.T, dir directory, name, baseURL string) *Client {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	agree, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	did := backend.DID{Method: "example", SpecID: name}
+	auth, err := keys.NewMethod(backend.URL{DID: did, RawFragment: "#key-1"}, did, pub, keys.JsonWebKey2020)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := keys.NewMethod(backend.URL{DID: did, RawFragment: "#key-2"}, did, agree.PublicKey(), keys.JsonWebKey2020)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir[did.String()] = &backend.Document{
+		Subject:        did,
+		Authentication: &backend.VerificationRelationship{Methods: []*backend.VerificationMethod{auth}},
+		KeyAgreement:   &backend.VerificationRelationship{Methods: []*backend.VerificationMethod{enc}},
+	}
+
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return &Client{
+		BaseURL:  baseURL,
+		Resolver: dir,
+		Signer:   key,
+		KeyID:    &backend.URL{DID: did, RawFragment: "#key-1"},
+		Keys:     map[string]*ecdh.PrivateKey{did.String() + "#key-2": agree},
+		HMACKeys: map[string][]byte{"urn:example:hmac": secret},
+	}
+}
+
+func TestVault(t *testing.T) {
+	s := &server{
+		vaults: make(map[string]*Config),
+		docs:   make(map[string]map[string]*EncryptedDocument),
+	}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+	dir := make(directory)
+	s.auth = &authz.DIDAuth{Resolver: dir, Audience: srv.URL + "/edvs"}
+	ctx := context.Background()
+
+	c := newClient(t, dir, "alice", srv.URL+"/edvs")
+	conf, err := c.NewConfig(c.KeyID.DID.String()+"#key-2", "urn:example:hmac", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Create(ctx, conf); err != nil {
+		t.Fatal("create error:", err)
+	}
+	v, err := c.Open(ctx, srv.URL+"/edvs/"+conf.ID)
+	if err != nil {
+		t.Fatal("open error:", err)
+	}
+
+	doc := &Document{
+		Content:    json.RawMessage(`{"name":"diploma"}`),
+		Attributes: []Attribute{{Name: "type", Value: "VerifiableCredential"}, {Name: "serial", Value: "42", Unique: true}},
+	}
+	if err := v.Insert(ctx, doc); err != nil {
+		t.Fatal("insert error:", err)
+	}
+	stored := s.docs[conf.ID][doc.ID]
+	if bytes.Contains(stored.JWE, []byte("diploma")) || stored.Indexed[0].Attributes[0].Name == "type" {
+		t.Error("plaintext in storage")
+	}
+	got, err := v.Get(ctx, doc.ID)
+	if err != nil {
+		t.Fatal("get error:", err)
+	}
+	if string(got.Content) != `{"name":"diploma"}` || got.Sequence != 0 {
+		t.Errorf("got content %s with sequence %d", got.Content, got.Sequence)
+	}
+
+	dupe := &Document{Content: json.RawMessage(`{}`), Attributes: []Attribute{{Name: "serial", Value: "42", Unique: true}}}
+	if err := v.Insert(ctx, dupe); !errors.Is(err, ErrConflict) {
+		t.Errorf("unique attribute in use got error %v, want ErrConflict", err)
+	}
+
+	got.Content = json.RawMessage(`{"name":"diploma","grade":"A"}`)
+	got.Attributes = doc.Attributes
+	if err := v.Update(ctx, got); err != nil {
+		t.Fatal("update error:", err)
+	}
+	stale := *got
+	stale.Sequence = 0
+	if err := v.Update(ctx, &stale); !errors.Is(err, ErrConflict) {
+		t.Errorf("stale update got error %v, want ErrConflict", err)
+	}
+
+	found, err := v.Find(ctx, map[string]string{"type": "VerifiableCredential"})
+	if err != nil {
+		t.Fatal("find error:", err)
+	}
+	if len(found) != 1 || string(found[0].Content) != `{"name":"diploma","grade":"A"}` || found[0].Sequence != 1 {
+		t.Errorf("find got %d documents, want the update", len(found))
+	}
+	if found, err := v.Find(ctx, map[string]string{"type": "Other"}); err != nil || len(found) != 0 {
+		t.Errorf("find mismatch got %d documents, error %v", len(found), err)
+	}
+	if found, err := v.Has(ctx, "serial"); err != nil || len(found) != 1 {
+		t.Errorf("has got %d documents, error %v", len(found), err)
+	}
+
+	// equal values of distinct names do not correlate
+	twin := &Document{Content: json.RawMessage(`{}`), Attributes: []Attribute{{Name: "grade", Value: "42"}}}
+	if err := v.Insert(ctx, twin); err != nil {
+		t.Fatal("insert error:", err)
+	}
+	if a, b := s.docs[conf.ID][doc.ID].Indexed[0].Attributes[1], s.docs[conf.ID][twin.ID].Indexed[0].Attributes[0]; a.Value == b.Value {
+		t.Error("value 42 of serial and grade blinded alike")
+	}
+	if found, err := v.Find(ctx, map[string]string{"grade": "42"}); err != nil || len(found) != 1 || found[0].ID != twin.ID {
+		t.Errorf("find of grade got %d documents, error %v", len(found), err)
+	}
+	if err := v.Delete(ctx, twin.ID); err != nil {
+		t.Fatal("delete error:", err)
+	}
+
+	if err := v.Delete(ctx, doc.ID); err != nil {
+		t.Fatal("delete error:", err)
+	}
+	if _, err := v.Get(ctx, doc.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete got error %v, want ErrNotFound", err)
+	}
+
+	// another controller
+	mallory := newClient(t, dir, "mallory", srv.URL+"/edvs")
+	mallory.Audience = "https://other.example"
+	if _, err := mallory.Open(ctx, v.URL); !errors.Is(err, authz.ErrUnauthenticated) {
+		t.Errorf("wrong audience got error %v, want ErrUnauthenticated", err)
+	}
+}
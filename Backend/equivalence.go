@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrUnlinked signals an alsoKnownAs which is not reciprocated.
+var ErrUnlinked = errors.New("DID alsoKnownAs not reciprocated")
+
+// Equivalent returns whether did is the canonicalId, or one of the
+// equivalentId entries in m. The DID method guarantees such equivalence, as
+// opposed to alsoKnownAs claims. See VerifyAlsoKnownAs for the latter.
+func (m *Meta) Equivalent(did DID) bool {
+	if m.CanonicalID != nil && m.CanonicalID.Equal(did) {
+		return true
+	}
+	for _, e := range m.EquivalentIDs {
+		if e.Equal(did) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalResolver is a Resolver which follows the canonicalId in Meta
+// transparently. A DID resolves into the document of its canonicalId when the
+// method reports one. Only a canonicalId of the same DID method is followed,
+// as DID Core requires, and only once. Multiple goroutines may invoke methods
+// on a CanonicalResolver simultaneously, granted the Resolver permits.
+type CanonicalResolver struct {
+	Resolver Resolver
+}
+
+// Resolve implements the Resolver interface. The resolution of a canonicalId
+// is a "did.canonical" span with the method. A canonicalId of another DID
+// method gets ErrInvalid, and so does a document of the canonicalId with
+// another subject.
+func (r CanonicalResolver) Resolve(ctx context.Context, did DID) (*Document, *Meta, error) {
+	doc, meta, err := r.Resolver.Resolve(ctx, did)
+	if err != nil || meta == nil || meta.CanonicalID == nil {
+		return doc, meta, err
+	}
+	canonical := *meta.CanonicalID
+	if canonical.Equal(did) || (doc != nil && doc.Subject.Equal(canonical)) {
+		return doc, meta, nil // resolved already
+	}
+	if canonical.Method != did.Method {
+		return nil, nil, fmt.Errorf("%w: canonicalId %s of %s is of another method", ErrInvalid, canonical.String(), did.String())
+	}
+	return r.resolveCanonical(ctx, did, canonical)
+}
+
+func (r CanonicalResolver) resolveCanonical(ctx context.Context, did, canonical DID) (doc *Document, meta *Meta, err error) {
+	ctx, span := StartSpan(ctx, "did.canonical", slog.String("method", did.Method))
+	defer func() { span.End(err) }()
+	doc, meta, err = r.Resolver.Resolve(ctx, canonical)
+	if err != nil {
+		return nil, nil, fmt.Errorf("canonicalId %s of %s: %w", canonical.String(), did.String(), err)
+	}
+	if doc != nil && !doc.Subject.Equal(canonical) {
+		return nil, nil, fmt.Errorf("%w: canonicalId %s of %s resolved into document %s", ErrInvalid, canonical.String(), did.String(), doc.Subject.String())
+	}
+	return doc, meta, nil
+}
+
+// KnownAs returns whether doc lists did in its alsoKnownAs.
+func (doc *Document) KnownAs(did DID) bool {
+	for _, s := range doc.AlsoKnownAs {
+		if did.EqualString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyAlsoKnownAs confirms that doc and the document of alias reference each
+// other with alsoKnownAs, which is the only way for the identifiers to be
+// treated as equivalent by a relying party. DID Core warns that a one-sided
+// claim may be false. The document of alias comes from r. Missing links in
+// either direction get ErrUnlinked.
+func VerifyAlsoKnownAs(ctx context.Context, r Resolver, doc *Document, alias DID) error {
+	if !doc.KnownAs(alias) {
+		return fmt.Errorf("%w: %s does not list %s", ErrUnlinked, doc.Subject.String(), alias.String())
+	}
+	other, meta, err := r.Resolve(ctx, alias)
+	if err != nil {
+		return fmt.Errorf("alsoKnownAs %s of %s: %w", alias.String(), doc.Subject.String(), err)
+	}
+	if meta != nil && !meta.Deactivated.IsZero() {
+		return fmt.Errorf("alsoKnownAs %s of %s: %w", alias.String(), doc.Subject.String(), ErrDeactivated)
+	}
+	if other == nil || !other.KnownAs(doc.Subject) {
+		return fmt.Errorf("%w: %s does not list %s", ErrUnlinked, alias.String(), doc.Subject.String())
+	}
+	return nil
+}
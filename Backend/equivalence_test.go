@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// EquivalenceResolver has alice as the canonicalId of a, and alice with bob
+// linked by alsoKnownAs, while carol claims bob one-sided.
+var equivalenceResolver = Resolve(func(did DID) (*Document, *Meta, error) {
+	switch did.SpecID {
+	case "a":
+		alice := DID{Method: "example", SpecID: "alice"}
+		return &Document{Subject: did}, &Meta{CanonicalID: &alice}, nil
+	case "alice":
+		return &Document{Subject: did, AlsoKnownAs: []string{"did:example:bob"}}, &Meta{EquivalentIDs: []DID{{Method: "example", SpecID: "a"}}}, nil
+	case "bob":
+		return &Document{Subject: did, AlsoKnownAs: []string{"https://bob.example", "did:example:alice"}}, new(Meta), nil
+	case "carol":
+		return &Document{Subject: did, AlsoKnownAs: []string{"did:example:bob"}}, new(Meta), nil
+	case "other":
+		key := DID{Method: "key", SpecID: "z6Mk"}
+		return &Document{Subject: did}, &Meta{CanonicalID: &key}, nil
+	}
+	return nil, nil, ErrNotFound
+})
+
+func TestCanonicalResolver(t *testing.T) {
+	r := CanonicalResolver{equivalenceResolver}
+	ctx := context.Background()
+
+	doc, meta, err := r.Resolve(ctx, DID{Method: "example", SpecID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Subject.SpecID != "alice" {
+		t.Errorf("got document %s, want the canonicalId", doc.Subject.String())
+	}
+	if !meta.Equivalent(DID{Method: "example", SpecID: "a"}) {
+		t.Errorf("got metadata %+v without equivalentId", meta)
+	}
+
+	doc, _, err = r.Resolve(ctx, DID{Method: "example", SpecID: "bob"})
+	if err != nil || doc.Subject.SpecID != "bob" {
+		t.Errorf("without canonicalId got document %+v, error %v", doc, err)
+	}
+	if _, _, err := r.Resolve(ctx, DID{Method: "example", SpecID: "other"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("canonicalId of another method got error %v, want ErrInvalid", err)
+	}
+}
+
+func TestVerifyAlsoKnownAs(t *testing.T) {
+	ctx := context.Background()
+	alice, _, _ := equivalenceResolver(DID{Method: "example", SpecID: "alice"})
+	carol, _, _ := equivalenceResolver(DID{Method: "example", SpecID: "carol"})
+	bob := DID{Method: "example", SpecID: "bob"}
+
+	if err := VerifyAlsoKnownAs(ctx, equivalenceResolver, alice, bob); err != nil {
+		t.Errorf("mutual link got error: %s", err)
+	}
+	if err := VerifyAlsoKnownAs(ctx, equivalenceResolver, carol, bob); !errors.Is(err, ErrUnlinked) {
+		t.Errorf("one-sided link got error %v, want ErrUnlinked", err)
+	}
+	if err := VerifyAlsoKnownAs(ctx, equivalenceResolver, alice, DID{Method: "example", SpecID: "dave"}); !errors.Is(err, ErrUnlinked) {
+		t.Errorf("unlisted alias got error %v, want ErrUnlinked", err)
+	}
+	if err := VerifyAlsoKnownAs(ctx, equivalenceResolver, &Document{Subject: bob, AlsoKnownAs: []string{"did:example:nobody"}}, DID{Method: "example", SpecID: "nobody"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown alias got error %v, want ErrNotFound", err)
+	}
+}
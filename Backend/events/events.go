@@ -0,0 +1,258 @@
+// Package events publishes changes of DID state, of credential status and of
+// the ledger to subscribers. Events go into a Log first, where each gets a
+// sequence number, and subscribers read from the Log at their own pace, such
+// that none get lost, and such that any can replay from a sequence number.
+// Delivery is at least once: subscribers may see an event again, e.g., after
+// a reconnect or a reorganization of the ledger, so they must be idempotent.
+//
+// Subscribers either receive on a Go channel with Subscribe, or they get HTTP
+// POSTs with a Webhook, or they use the SubscribeEvents stream of package
+// nodeapi.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/chain"
+)
+
+// Type is a kind of event.
+type Type string
+
+// Event types
+const (
+	DIDCreated              Type = "did.created"
+	DIDUpdated              Type = "did.updated"
+	DIDDeactivated          Type = "did.deactivated"
+	CredentialStatusChanged Type = "credential.status"
+	NewBlock                Type = "block.new"
+)
+
+// Event is a change, with the fields of its type set.
+type Event struct {
+	Seq  uint64    `json:"seq"` // set by the Log
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+
+	// DID and VersionID are of DID events.
+	DID       string `json:"did,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+
+	// Block has the block of NewBlock events, and the block which
+	// confirmed DID events from the ledger.
+	Block *BlockRef `json:"block,omitempty"`
+
+	// Status is of CredentialStatusChanged events.
+	Status *StatusChange `json:"status,omitempty"`
+}
+
+// BlockRef identifies a block of the ledger.
+type BlockRef struct {
+	Height uint64     `json:"height"`
+	Hash   chain.Hash `json:"hash"`
+
+	// Reorganized marks a block which replaces a previous one of its
+	// height, including any events of the previous one.
+	Reorganized bool `json:"reorganized,omitempty"`
+}
+
+// StatusChange is an entry of a status list which changed.
+type StatusChange struct {
+	List    string `json:"statusListCredential"` // URL
+	Index   int    `json:"statusListIndex"`
+	Purpose string `json:"statusPurpose"` // e.g., "revocation"
+	Set     bool   `json:"set"`           // bit value after the change
+}
+
+// Filter selects events. The zero value selects all.
+type Filter struct {
+	Types []Type `json:"types,omitempty"` // any when empty
+	DID   string `json:"did,omitempty"`   // any when empty
+}
+
+// Match returns whether e passes the filter.
+func (f *Filter) Match(e *Event) bool {
+	if len(f.Types) != 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	return f.DID == "" || f.DID == e.DID
+}
+
+// ErrExpired signals a replay from a sequence number which is no longer in
+// the Log.
+var ErrExpired = errors.New("events expired from log")
+
+// Log is a sequence of events, with retention of the most recent ones.
+// Implementations must be safe for concurrent use.
+type Log interface {
+	// Append sets the Seq of e to the successor of the last one, starting
+	// at 1, and it adds e to the log.
+	Append(ctx context.Context, e *Event) error
+
+	// Read returns events in order of their sequence number, from seq
+	// from on, up to limit. Sequence numbers which are no longer retained
+	// get ErrExpired.
+	Read(ctx context.Context, from uint64, limit int) ([]*Event, error)
+
+	// Last returns the sequence number of the last event, or zero for none.
+	Last(ctx context.Context) (uint64, error)
+}
+
+// MemoryLog is a Log in memory. The zero value is ready to use.
+type MemoryLog struct {
+	Max int // events retained at least, default 10000
+
+	mutex  sync.Mutex
+	events []*Event // retained, in order
+	last   uint64
+}
+
+// Append implements the Log interface.
+func (l *MemoryLog) Append(_ context.Context, e *Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.last++
+	e.Seq = l.last
+	l.events = append(l.events, e)
+	max := l.Max
+	if max <= 0 {
+		max = 10000
+	}
+	if len(l.events) > 2*max {
+		l.events = slices.Clone(l.events[len(l.events)-max:])
+	}
+	return nil
+}
+
+// Read implements the Log interface.
+func (l *MemoryLog) Read(_ context.Context, from uint64, limit int) ([]*Event, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if from > l.last {
+		return nil, nil
+	}
+	first := l.last + 1 - uint64(len(l.events))
+	if from < first {
+		return nil, fmt.Errorf("%w: sequence number %d precedes %d", ErrExpired, from, first)
+	}
+	events := l.events[from-first:]
+	return slices.Clone(events[:min(limit, len(events))]), nil
+}
+
+// Last implements the Log interface.
+func (l *MemoryLog) Last(context.Context) (uint64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.last, nil
+}
+
+// Broker publishes events into a Log, and it wakes subscribers. Multiple
+// goroutines may invoke methods on a Broker simultaneously.
+type Broker struct {
+	Log Log
+
+	mutex   sync.Mutex
+	changed chan struct{} // closes on the next event, if any
+}
+
+// Changed returns a channel which closes on the next Publish.
+func (b *Broker) Changed() <-chan struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+// Publish adds e to the Log. The Time defaults to now.
+func (b *Broker) Publish(ctx context.Context, e *Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if err := b.Log.Append(ctx, e); err != nil {
+		return fmt.Errorf("event publication: %w", err)
+	}
+	b.mutex.Lock()
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+	b.mutex.Unlock()
+	return nil
+}
+
+// ReadBatch limits the events per Log read.
+const readBatch = 100
+
+// Follow invokes fn for each event which matches f, from sequence number from
+// on, with zero for new events only, until ctx is done or fn returns an error.
+// Events pass in order, each after the previous invocation returned.
+func (b *Broker) Follow(ctx context.Context, from uint64, f Filter, fn func(*Event) error) error {
+	if from == 0 {
+		last, err := b.Log.Last(ctx)
+		if err != nil {
+			return err
+		}
+		from = last + 1
+	}
+	for {
+		changed := b.Changed()
+		events, err := b.Log.Read(ctx, from, readBatch)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if f.Match(e) {
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+			from = e.Seq + 1
+		}
+		if len(events) == readBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Subscription is a stream of events on a Go channel.
+type Subscription struct {
+	// C receives the events. It closes when the context of Subscribe is
+	// done, or on failure.
+	C <-chan *Event
+
+	err error // set before C closes
+}
+
+// Err returns the cause once C is closed.
+func (s *Subscription) Err() error { return s.err }
+
+// Subscribe follows the events which match f, as Follow does, on a channel.
+// Subscribers which do not receive hold up their subscription only.
+func (b *Broker) Subscribe(ctx context.Context, from uint64, f Filter) *Subscription {
+	c := make(chan *Event)
+	s := &Subscription{C: c}
+	go func() {
+		defer close(c)
+		s.err = b.Follow(ctx, from, f, func(e *Event) error {
+			select {
+			case c <- e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return s
+}
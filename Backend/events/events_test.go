@@ -0,0 +1,279 @@
+package events
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/store"
+)
+
+func receive(t *testing.T, s *Subscription) *Event {
+	t.Helper()
+	select {
+	case e, ok := <-s.C:
+		if !ok {
+			t.Fatal("subscription closed:", s.Err())
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return nil
+	}
+}
+
+func TestBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := &Broker{Log: &MemoryLog{Max: 2}}
+	for _, did := range []string{"did:example:a", "did:example:b"} {
+		if err := b.Publish(ctx, &Event{Type: DIDCreated, DID: did}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replay := b.Subscribe(ctx, 1, Filter{})
+	live := b.Subscribe(ctx, 0, Filter{Types: []Type{DIDUpdated}, DID: "did:example:b"})
+	if e := receive(t, replay); e.Seq != 1 || e.DID != "did:example:a" {
+		t.Errorf("replay got %+v, want sequence number 1", e)
+	}
+	if e := receive(t, replay); e.Seq != 2 {
+		t.Errorf("replay got %+v, want sequence number 2", e)
+	}
+	b.Publish(ctx, &Event{Type: DIDUpdated, DID: "did:example:a"})
+	b.Publish(ctx, &Event{Type: DIDUpdated, DID: "did:example:b"})
+	if e := receive(t, live); e.Seq != 4 {
+		t.Errorf("filtered subscription got %+v, want sequence number 4", e)
+	}
+	if e := receive(t, replay); e.Seq != 3 {
+		t.Errorf("replay got %+v, want sequence number 3", e)
+	}
+
+	// retention of 2 to 4 events
+	b.Publish(ctx, &Event{Type: NewBlock})
+	expired := b.Subscribe(ctx, 1, Filter{})
+	if _, ok := <-expired.C; ok || !errors.Is(expired.Err(), ErrExpired) {
+		t.Errorf("subscription to expired events got error %v, want ErrExpired", expired.Err())
+	}
+	cancel()
+	for range live.C {
+	}
+	if !errors.Is(live.Err(), context.Canceled) {
+		t.Errorf("cancelled subscription got error %v", live.Err())
+	}
+}
+
+func TestFileLog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := OpenFileLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Broker{Log: l}
+	for range 6 {
+		if err := b.Publish(ctx, &Event{Type: DIDUpdated, DID: "did:example:a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	l, err = OpenFileLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if last, _ := l.Last(ctx); last != 6 {
+		t.Errorf("reopened log got last sequence number %d, want 6", last)
+	}
+	if _, err := l.Read(ctx, 1, 10); !errors.Is(err, ErrExpired) {
+		t.Errorf("read of compacted events got error %v, want ErrExpired", err)
+	}
+	got, err := l.Read(ctx, 5, 10)
+	if err != nil || len(got) != 2 || got[0].Seq != 5 || got[1].DID != "did:example:a" {
+		t.Errorf("read got %+v, error %v", got, err)
+	}
+	e := &Event{Type: NewBlock}
+	if err := l.Append(ctx, e); err != nil || e.Seq != 7 {
+		t.Errorf("append after reopen got sequence number %d, error %v", e.Seq, err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	secret := []byte("webhook secret")
+	var mutex sync.Mutex
+	var attempts int
+	received := make(chan *Event, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifySignature(secret, r, body) {
+			t.Error("webhook signature mismatch")
+		}
+		mutex.Lock()
+		attempts++
+		fail := attempts == 1
+		mutex.Unlock()
+		if fail {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		e := new(Event)
+		if err := json.Unmarshal(body, e); err != nil {
+			t.Error("webhook body:", err)
+		}
+		if r.Header.Get(SeqHeader) != "1" || r.Header.Get(TypeHeader) != string(DIDDeactivated) {
+			t.Errorf("webhook headers %v", r.Header)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	b := &Broker{Log: new(MemoryLog)}
+	b.Publish(ctx, &Event{Type: DIDDeactivated, DID: "did:example:a"})
+	delivered := make(chan uint64, 4)
+	h := &Webhook{
+		URL:        srv.URL,
+		Filter:     Filter{Types: []Type{DIDDeactivated}},
+		Secret:     secret,
+		Delivered:  func(seq uint64) { delivered <- seq },
+		MaxBackoff: time.Millisecond,
+	}
+	go h.Run(ctx, b, 1)
+	select {
+	case e := <-received:
+		if e.Seq != 1 || e.DID != "did:example:a" {
+			t.Errorf("webhook got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivery")
+	}
+	if seq := <-delivered; seq != 1 {
+		t.Errorf("delivered sequence number %d, want 1", seq)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2 with a retry", attempts)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := didkey.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority := &chain.Authority{
+		Validators: []backend.DID{validator},
+		Resolver:   new(didkey.Resolver),
+		KeyID:      &backend.URL{DID: validator, RawFragment: "#" + validator.SpecID},
+		Signer:     key,
+	}
+	bc := &chain.Blockchain{Consensus: authority}
+	addBlock := func() *chain.Block {
+		t.Helper()
+		b, err := authority.ProposeBlock(ctx, bc.Head(), bc.Pending())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	id := backend.URL{DID: idchain.Placeholder, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, idchain.Placeholder, pub, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis, did, err := idchain.NewGenesis(&backend.Document{
+		Subject:              idchain.Placeholder,
+		VerificationMethods:  []*backend.VerificationMethod{m},
+		CapabilityInvocation: &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}},
+	}, &id, key, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idchain.Submit(ctx, bc, genesis); err != nil {
+		t.Fatal(err)
+	}
+	b0 := addBlock()
+
+	broker := &Broker{Log: new(MemoryLog)}
+	all := broker.Subscribe(ctx, 1, Filter{})
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&Ledger{Broker: broker, Chain: bc}).Run(runCtx)
+	}()
+	if e := receive(t, all); e.Type != DIDCreated || e.DID != did.String() || e.VersionID != "1" || e.Block.Hash != b0.Hash() {
+		t.Errorf("got %+v, want creation of %s in block 0", e, did.String())
+	}
+	if e := receive(t, all); e.Type != NewBlock || e.Block.Height != 0 {
+		t.Errorf("got %+v, want block 0", e)
+	}
+
+	// restart continues after the last block
+	stop()
+	<-done
+	deactivate, err := idchain.NewDeactivate(genesis, &backend.URL{DID: did, RawFragment: "#key-1"}, key, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idchain.Submit(ctx, bc, deactivate); err != nil {
+		t.Fatal(err)
+	}
+	addBlock()
+	go (&Ledger{Broker: broker, Chain: bc}).Run(ctx)
+	if e := receive(t, all); e.Type != DIDDeactivated || e.VersionID != "2" || e.Block.Height != 1 {
+		t.Errorf("got %+v, want deactivation in block 1", e)
+	}
+	if e := receive(t, all); e.Type != NewBlock || e.Block.Height != 1 {
+		t.Errorf("got %+v, want block 1", e)
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := &Broker{Log: new(MemoryLog)}
+	s := &Store{Store: new(store.Memory), Broker: broker}
+	did := backend.DID{Method: "example", SpecID: "a"}
+	doc := &backend.Document{Subject: did}
+	s.Put(doc, nil)
+	s.Put(doc, nil)
+	s.Put(doc, &backend.Meta{Deactivated: time.Now()})
+
+	var got []Type
+	sub := broker.Subscribe(ctx, 1, Filter{DID: did.String()})
+	for range 3 {
+		got = append(got, receive(t, sub).Type)
+	}
+	if want := []Type{DIDCreated, DIDUpdated, DIDDeactivated}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
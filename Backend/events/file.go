@@ -0,0 +1,151 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileLog is a Log in a file of JSON lines, with one event per line, such
+// that replays survive restarts. The retained events are in memory too. The
+// file is rewritten atomically, with a rename, once it has twice the events
+// retained. Multiple processes must not share a file.
+type FileLog struct {
+	path string
+	mem  MemoryLog
+
+	mutex sync.Mutex // serializes writes
+	file  *os.File
+	lines int
+}
+
+// OpenFileLog loads the events of the file at path, if any. Max is the
+// retention in events, as with MemoryLog.
+func OpenFileLog(path string, max int) (*FileLog, error) {
+	l := &FileLog{path: path, mem: MemoryLog{Max: max}}
+	file, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		break
+	case err != nil:
+		return nil, err
+	default:
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			e := new(Event)
+			if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w", path, l.lines+1, err)
+			}
+			if l.lines != 0 && e.Seq != l.mem.last+1 {
+				return nil, fmt.Errorf("%s: line %d: sequence number %d follows %d", path, l.lines+1, e.Seq, l.mem.last)
+			}
+			l.mem.events = append(l.mem.events, e)
+			l.mem.last = e.Seq
+			l.lines++
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close releases the file.
+func (l *FileLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// Append implements the Log interface. Events are on disk before they are
+// visible to Read.
+func (l *FileLog) Append(ctx context.Context, e *Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	last, _ := l.mem.Last(ctx)
+	e.Seq = last + 1
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.lines++
+	l.mem.Append(ctx, e)
+
+	l.mem.mutex.Lock()
+	retained := len(l.mem.events)
+	l.mem.mutex.Unlock()
+	if l.lines > 2*retained {
+		return l.compact()
+	}
+	return nil
+}
+
+// Compact rewrites the file with the retained events only.
+func (l *FileLog) compact() error {
+	l.mem.mutex.Lock()
+	var buf []byte
+	for _, e := range l.mem.events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			l.mem.mutex.Unlock()
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	n := len(l.mem.events)
+	l.mem.mutex.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file, l.lines = file, n
+	return nil
+}
+
+// Read implements the Log interface.
+func (l *FileLog) Read(ctx context.Context, from uint64, limit int) ([]*Event, error) {
+	return l.mem.Read(ctx, from, limit)
+}
+
+// Last implements the Log interface.
+func (l *FileLog) Last(ctx context.Context) (uint64, error) {
+	return l.mem.Last(ctx)
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+// Ledger publishes the changes of a Blockchain. Each block gets a DID event
+// per operation, followed by a NewBlock event. Blocks which replace others in
+// a reorganization have their events published again, with Reorganized set.
+type Ledger struct {
+	Broker *Broker
+	Chain  *chain.Blockchain
+}
+
+// Run follows the chain until ctx is done. It continues after the last block
+// in the Log of the Broker, such that restarts repeat no more than the events
+// of one block.
+func (l *Ledger) Run(ctx context.Context) error {
+	next, prev, err := l.resume(ctx)
+	if err != nil {
+		return err
+	}
+	sent := make(map[uint64]chain.Hash) // blocks which may revert
+	if prev != nil {
+		sent[next-1] = *prev
+	}
+	for {
+		changed := l.Chain.Changed()
+
+		// rewind to the first block replaced
+		reorganized := false
+		for next > 0 {
+			hash, ok := sent[next-1]
+			if !ok {
+				break
+			}
+			b, err := l.Chain.Block(next - 1)
+			if err == nil && b.Hash() == hash {
+				break
+			}
+			delete(sent, next-1)
+			next, reorganized = next-1, true
+			if _, ok := sent[next-1]; !ok {
+				// history unknown, as with resumes
+				next = min(next, l.Chain.Final())
+			}
+		}
+
+		for ; next < l.Chain.Len(); next++ {
+			b, err := l.Chain.Block(next)
+			if err != nil {
+				break // reorganized in the meantime
+			}
+			if err := l.publish(ctx, b, reorganized); err != nil {
+				return err
+			}
+			sent[next] = b.Hash()
+			reorganized = false
+		}
+		final := l.Chain.Final()
+		for h := range sent {
+			if h+1 < final {
+				delete(sent, h) // retains the last final one for resumes
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Publish adds the events of b.
+func (l *Ledger) publish(ctx context.Context, b *chain.Block, reorganized bool) error {
+	ref := &BlockRef{Height: b.Height, Hash: b.Hash(), Reorganized: reorganized}
+	for i := range b.Transactions {
+		op, err := b.Transactions[i].Operation()
+		if err != nil {
+			continue // validated by the chain
+		}
+		e := &Event{DID: op.DID.String(), Block: ref}
+		switch op.Type {
+		case idchain.Create:
+			e.Type = DIDCreated
+		case idchain.Update:
+			e.Type = DIDUpdated
+		case idchain.Deactivate:
+			e.Type = DIDDeactivated
+		default:
+			continue
+		}
+		// the version is the position in the log
+		if entries, err := l.Chain.Entries(ctx, op.DID); err == nil {
+			if n := slices.Index(entries, b.Transactions[i].Entry); n >= 0 {
+				e.VersionID = strconv.Itoa(n + 1)
+			}
+		}
+		if err := l.Broker.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return l.Broker.Publish(ctx, &Event{Type: NewBlock, Time: b.Time, Block: ref})
+}
+
+// Resume returns the height after the last NewBlock in the Log, with the hash
+// of that block. A block with part of its events only is repeated.
+func (l *Ledger) resume(ctx context.Context) (next uint64, prev *chain.Hash, err error) {
+	end, err := l.Broker.Log.Last(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for end > 0 {
+		start := uint64(1)
+		if end > readBatch {
+			start = end - readBatch + 1
+		}
+		events, err := l.Broker.Log.Read(ctx, start, int(end-start+1))
+		if errors.Is(err, ErrExpired) {
+			return 0, nil, nil // from the start again
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		for i := len(events) - 1; i >= 0; i-- {
+			e := events[i]
+			switch {
+			case e.Block == nil:
+				continue
+			case e.Type == NewBlock:
+				hash := e.Block.Hash
+				return e.Block.Height + 1, &hash, nil
+			default:
+				return e.Block.Height, nil, nil
+			}
+		}
+		end = start - 1
+	}
+	return 0, nil, nil
+}
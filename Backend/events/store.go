@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"errors"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/store"
+)
+
+// Store publishes a DID event for each version added to a store.Store, such
+// as the one of a registrar.Store, for DIDs outside of the ledger.
+type Store struct {
+	store.Store
+	Broker *Broker
+}
+
+// Put implements the store.Store interface. The first version of a DID is a
+// DIDCreated, and versions with the Deactivated metadata are DIDDeactivated.
+// Failed publications return with the version stored.
+func (s *Store) Put(doc *backend.Document, meta *backend.Meta) (*backend.Meta, error) {
+	created := false
+	if doc != nil {
+		_, _, err := s.Store.Get(doc.Subject)
+		created = errors.Is(err, backend.ErrNotFound)
+	}
+	m, err := s.Store.Put(doc, meta)
+	if err != nil {
+		return nil, err
+	}
+	e := &Event{Type: DIDUpdated, DID: doc.Subject.String(), VersionID: m.VersionID}
+	switch {
+	case created:
+		e.Type = DIDCreated
+	case !m.Deactivated.IsZero():
+		e.Type = DIDDeactivated
+	}
+	return m, s.Broker.Publish(context.Background(), e)
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTP headers of webhook requests
+const (
+	SeqHeader       = "X-IDChain-Event-Seq"
+	TypeHeader      = "X-IDChain-Event-Type"
+	SignatureHeader = "X-IDChain-Signature" // "sha256=" and the hex HMAC
+)
+
+// Webhook delivers events with an HTTP POST each, with the event in JSON as
+// the body. Deliveries retry with exponential backoff until the receiver
+// responds with a 2xx status, and the next event waits until then.
+type Webhook struct {
+	URL    string
+	Filter Filter
+
+	// Secret, when set, keys an HMAC-SHA256 of the body in the
+	// SignatureHeader, such that receivers can authenticate the origin.
+	Secret []byte
+
+	// Delivered, when set, gets the sequence number of each event
+	// acknowledged, e.g., to persist where to resume after a restart.
+	Delivered func(seq uint64)
+
+	HTTP       *http.Client  // nil for http.DefaultClient
+	Timeout    time.Duration // per request, default 10 s
+	MaxBackoff time.Duration // retry delay limit, default 5 min
+
+	Log *slog.Logger // nil for slog.Default
+}
+
+func (h *Webhook) log() *slog.Logger {
+	if h.Log != nil {
+		return h.Log
+	}
+	return slog.Default()
+}
+
+// Run delivers the events of b from sequence number from on, as Follow does,
+// until ctx is done.
+func (h *Webhook) Run(ctx context.Context, b *Broker, from uint64) error {
+	return b.Follow(ctx, from, h.Filter, func(e *Event) error {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		maxBackoff := h.MaxBackoff
+		if maxBackoff <= 0 {
+			maxBackoff = 5 * time.Minute
+		}
+		for backoff := time.Second; ; backoff = min(2*backoff, maxBackoff) {
+			err := h.post(ctx, e, body)
+			if err == nil {
+				break
+			}
+			h.log().Info("webhook delivery failed", "url", h.URL, "seq", e.Seq, "error", err, "retry", backoff)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+		if h.Delivered != nil {
+			h.Delivered(e.Seq)
+		}
+		return nil
+	})
+}
+
+// Post executes one delivery attempt.
+func (h *Webhook) post(ctx context.Context, e *Event, body []byte) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SeqHeader, strconv.FormatUint(e.Seq, 10))
+	req.Header.Set(TypeHeader, string(e.Type))
+	if len(h.Secret) != 0 {
+		req.Header.Set(SignatureHeader, Signature(h.Secret, body))
+	}
+	client := h.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook got HTTP %q", resp.Status)
+	}
+	return nil
+}
+
+// Signature returns the value of the SignatureHeader for a body.
+func Signature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns whether the SignatureHeader of r matches body, for
+// receivers of webhooks.
+func VerifySignature(secret []byte, r *http.Request, body []byte) bool {
+	return hmac.Equal([]byte(r.Header.Get(SignatureHeader)), []byte(Signature(secret, body)))
+}
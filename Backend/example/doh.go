@@ -0,0 +1,250 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// DNSMessageMax limits the size of DNS-over-HTTPS responses in bytes.
+const dnsMessageMax = 1 << 16
+
+// DNS record types and header flags from RFC 1035, RFC 4035 and RFC 6891.
+const (
+	dnsTypeA    = 1
+	dnsTypeTXT  = 16
+	dnsTypeAAAA = 28
+	dnsTypeOPT  = 41
+	dnsClassIN  = 1
+
+	dnsFlagQR = 0x8000 // response
+	dnsFlagRD = 0x0100 // recursion desired
+	dnsFlagAD = 0x0020 // authentic data
+	dnsFlagDO = 0x8000 // DNSSEC OK, in the TTL of OPT
+)
+
+var errDNSMessage = errors.New("malformed DNS message")
+
+// LookupDoH returns the addresses of host from the DNSOverHTTPS service. The
+// requests go with the http.Client, without the security options, such that
+// the service itself may be on a private network.
+func (c *Client) lookupDoH(ctx context.Context, host string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		res, err := c.queryDoH(ctx, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		records, err := dnsRecords(res, qtype)
+		if err != nil {
+			return nil, fmt.Errorf("DNS over HTTPS for %s: %w", host, err)
+		}
+		for _, rdata := range records {
+			switch {
+			case qtype == dnsTypeA && len(rdata) == 4:
+				addrs = append(addrs, netip.AddrFrom4([4]byte(rdata)))
+			case qtype == dnsTypeAAAA && len(rdata) == 16:
+				addrs = append(addrs, netip.AddrFrom16([16]byte(rdata)))
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// LookupTXT returns the text records of name, with the character strings of
+// each record concatenated. The DNSOverHTTPS service applies when set, with
+// RequireDNSSEC. Otherwise, the system resolver applies, which can not
+// authenticate with DNSSEC.
+func (c *Client) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if c.DNSOverHTTPS == "" {
+		if c.RequireDNSSEC {
+			return nil, fmt.Errorf("%w: %s without DNS over HTTPS", ErrDNSSEC, name)
+		}
+		return net.DefaultResolver.LookupTXT(ctx, name)
+	}
+
+	res, err := c.queryDoH(ctx, name, dnsTypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	records, err := dnsRecords(res, dnsTypeTXT)
+	if err != nil {
+		return nil, fmt.Errorf("DNS over HTTPS for %s: %w", name, err)
+	}
+	texts := make([]string, 0, len(records))
+	for _, rdata := range records {
+		var b strings.Builder
+		for len(rdata) != 0 {
+			l := int(rdata[0])
+			if 1+l > len(rdata) {
+				return nil, fmt.Errorf("DNS over HTTPS for %s: %w", name, errDNSMessage)
+			}
+			b.Write(rdata[1 : 1+l])
+			rdata = rdata[1+l:]
+		}
+		texts = append(texts, b.String())
+	}
+	if len(texts) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return texts, nil
+}
+
+// QueryDoH returns the response on a query for name of qtype, with the
+// response code and the authentic data checked.
+func (c *Client) queryDoH(ctx context.Context, name string, qtype uint16) ([]byte, error) {
+	query, err := dnsQuery(name, qtype, c.RequireDNSSEC)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.exchangeDoH(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("DNS over HTTPS for %s: %w", name, err)
+	}
+	flags := binary.BigEndian.Uint16(res[2:])
+	switch rcode := flags & 0xf; rcode {
+	case 0:
+		break
+	case 3:
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: fmt.Sprintf("DNS over HTTPS response code %d", rcode), Name: name}
+	}
+	if c.RequireDNSSEC && flags&dnsFlagAD == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDNSSEC, name)
+	}
+	return res, nil
+}
+
+// ExchangeDoH posts query conform RFC 8484, and it returns the response with
+// at least a complete header.
+func (c *Client) exchangeDoH(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.DNSOverHTTPS, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %q", res.Status)
+	}
+	msg, err := io.ReadAll(io.LimitReader(res.Body, dnsMessageMax))
+	if err != nil {
+		return nil, err
+	}
+	// “DNS API clients using the DNS wire format MUST use a DNS ID of 0”
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != 0 || binary.BigEndian.Uint16(msg[2:])&dnsFlagQR == 0 {
+		return nil, errDNSMessage
+	}
+	return msg, nil
+}
+
+// DNSQuery returns the wire format of a recursive query. DNSSEC asks for
+// validation with the AD flag and the DO bit.
+func dnsQuery(host string, qtype uint16, dnssec bool) ([]byte, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return nil, fmt.Errorf("invalid host name %q", host)
+	}
+	msg := make([]byte, 12, 12+len(host)+2+4+11)
+	flags := uint16(dnsFlagRD)
+	if dnssec {
+		flags |= dnsFlagAD
+	}
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	if dnssec {
+		binary.BigEndian.PutUint16(msg[10:], 1) // ARCOUNT
+		msg = append(msg, 0)                    // root name
+		msg = binary.BigEndian.AppendUint16(msg, dnsTypeOPT)
+		msg = binary.BigEndian.AppendUint16(msg, 4096) // UDP payload size
+		msg = binary.BigEndian.AppendUint32(msg, dnsFlagDO)
+		msg = binary.BigEndian.AppendUint16(msg, 0) // RDLENGTH
+	}
+	return msg, nil
+}
+
+// DNSRecords returns the data of the rrType records in the answer section of
+// msg, which includes those of any CNAME chain.
+func dnsRecords(msg []byte, rrType uint16) ([][]byte, error) {
+	qdCount := int(binary.BigEndian.Uint16(msg[4:]))
+	anCount := int(binary.BigEndian.Uint16(msg[6:]))
+	i := 12
+	for n := 0; n < qdCount; n++ {
+		var err error
+		i, err = skipDNSName(msg, i)
+		if err != nil {
+			return nil, err
+		}
+		i += 4 // QTYPE and QCLASS
+	}
+
+	var records [][]byte
+	for n := 0; n < anCount; n++ {
+		var err error
+		i, err = skipDNSName(msg, i)
+		if err != nil {
+			return nil, err
+		}
+		if i+10 > len(msg) {
+			return nil, errDNSMessage
+		}
+		t := binary.BigEndian.Uint16(msg[i:])
+		class := binary.BigEndian.Uint16(msg[i+2:])
+		rdLen := int(binary.BigEndian.Uint16(msg[i+8:]))
+		i += 10
+		if i+rdLen > len(msg) {
+			return nil, errDNSMessage
+		}
+		if t == rrType && class == dnsClassIN {
+			records = append(records, msg[i:i+rdLen])
+		}
+		i += rdLen
+	}
+	return records, nil
+}
+
+// SkipDNSName returns the offset after the (compressed) domain name at i.
+func skipDNSName(msg []byte, i int) (int, error) {
+	for i < len(msg) {
+		l := int(msg[i])
+		switch {
+		case l == 0:
+			return i + 1, nil
+		case l&0xc0 == 0xc0:
+			if i+2 > len(msg) {
+				return 0, errDNSMessage
+			}
+			return i + 2, nil // pointer ends the name
+		case l&0xc0 != 0:
+			return 0, errDNSMessage
+		}
+		i += 1 + l
+	}
+	return 0, errDNSMessage
+}
@@ -0,0 +1,209 @@
+package example
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Errors from the security options of Client.
+var (
+	ErrRedirectMax = errors.New("DID document redirect limit reached")
+	ErrBlocked     = errors.New("DID document address blocked")
+	ErrPin         = errors.New("DID document TLS certificate not pinned")
+	ErrDNSSEC      = errors.New("DID document host name not authenticated with DNSSEC")
+)
+
+// Client returns the HTTP client with the security options applied.
+func (c *Client) client() (*http.Client, error) {
+	if c.RedirectMax == 0 && !c.BlockPrivate && len(c.Pins) == 0 && c.DNSOverHTTPS == "" && !c.RequireDNSSEC {
+		return &c.Client, nil
+	}
+	c.hardenOnce.Do(func() {
+		c.hardened, c.hardenErr = c.harden()
+	})
+	return c.hardened, c.hardenErr
+}
+
+func (c *Client) harden() (*http.Client, error) {
+	if c.RequireDNSSEC && c.DNSOverHTTPS == "" {
+		return nil, errors.New("DID document client requires DNSSEC without a DNS-over-HTTPS service")
+	}
+	hardened := c.Client // copy
+
+	if c.RedirectMax != 0 {
+		max := c.RedirectMax
+		if max < 0 {
+			max = 0
+		}
+		next := c.CheckRedirect
+		hardened.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > max {
+				return fmt.Errorf("%w: %d redirects", ErrRedirectMax, max)
+			}
+			if next != nil {
+				return next(req, via)
+			}
+			return nil
+		}
+	}
+
+	if !c.BlockPrivate && len(c.Pins) == 0 && c.DNSOverHTTPS == "" {
+		return &hardened, nil
+	}
+	var t *http.Transport
+	switch rt := c.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		return nil, fmt.Errorf("DID document client security options require an *http.Transport, got %T", rt)
+	}
+
+	// same as http.DefaultTransport
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.BlockPrivate {
+		t.Proxy = nil
+		dialer.Control = c.checkDial
+	}
+	t.DialContext = dialer.DialContext
+	if c.DNSOverHTTPS != "" {
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return c.dialDoH(ctx, dialer, network, addr)
+		}
+	}
+
+	if len(c.Pins) != 0 {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = new(tls.Config)
+		} else {
+			t.TLSClientConfig = t.TLSClientConfig.Clone()
+		}
+		next := t.TLSClientConfig.VerifyConnection
+		t.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if err := c.checkPins(cs); err != nil {
+				return err
+			}
+			if next != nil {
+				return next(cs)
+			}
+			return nil
+		}
+	}
+
+	hardened.Transport = t
+	return &hardened, nil
+}
+
+// DialDoH connects to the first address of the host in addr which accepts,
+// with the host name resolved by DNSOverHTTPS.
+func (c *Client) dialDoH(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	ips, err := c.lookupDoH(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// CheckDial implements net.Dialer Control for BlockPrivate.
+func (c *Client) checkDial(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := addrPort.Addr().Unmap()
+	for _, p := range c.AllowPrefixes {
+		if p.Contains(ip) {
+			return nil
+		}
+	}
+	if !isPublic(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrBlocked, ip)
+	}
+	return nil
+}
+
+// SpecialPrefixes are the address ranges reserved by the IANA for other than
+// global unicast, which net/netip does not cover.
+var specialPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // “this network”
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space, i.e., CGN
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which may map private
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, which may map private
+}
+
+// IsPublic returns whether ip is a global unicast address.
+func isPublic(ip netip.Addr) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range specialPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPins matches the verified chain against the Pins of the server name.
+func (c *Client) checkPins(cs tls.ConnectionState) error {
+	host := strings.TrimSuffix(strings.ToLower(cs.ServerName), ".")
+	pins, ok := c.Pins[host]
+	if !ok {
+		return nil
+	}
+	chains := cs.VerifiedChains
+	if len(chains) == 0 {
+		// InsecureSkipVerify
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			pin := base64.StdEncoding.EncodeToString(sum[:])
+			for _, want := range pins {
+				if pin == want {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w: no match for %s", ErrPin, host)
+}
@@ -0,0 +1,238 @@
+package example
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+func docHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`{"id":"did:example:alice"}`))
+}
+
+func TestRedirectMax(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/doc", http.StatusMovedPermanently)
+		default:
+			docHandler(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		max     int
+		wantErr error
+	}{
+		{0, nil},
+		{2, nil},
+		{1, ErrRedirectMax},
+		{-1, ErrRedirectMax},
+	}
+	for _, test := range tests {
+		c := &Client{RedirectMax: test.max}
+		_, _, err := c.Resolve(context.Background(), srv.URL+"/a")
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("redirect max %d got error %v, want %v", test.max, err, test.wantErr)
+		}
+	}
+}
+
+func TestBlockPrivate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(docHandler))
+	defer srv.Close()
+
+	c := &Client{BlockPrivate: true}
+	if _, _, err := c.Resolve(context.Background(), srv.URL+"/doc"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("loopback got error %v, want ErrBlocked", err)
+	}
+	c = &Client{BlockPrivate: true, AllowPrefixes: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+	if _, _, err := c.Resolve(context.Background(), srv.URL+"/doc"); err != nil {
+		t.Errorf("loopback allowed got error: %s", err)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.215.14":        true,
+		"2606:2800:21f::1":     true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false, // cloud metadata
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"255.255.255.255":      false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"64:ff9b::a00:1":       false,
+		"2002:a00:1::":         false,
+		"::ffff:10.0.0.1":      false,
+		"ff02::1":              false,
+		"2001:db8::1":          false,
+		"2001:4860:4860::8888": true,
+	}
+	for s, want := range tests {
+		if got := isPublic(netip.MustParseAddr(s).Unmap()); got != want {
+			t.Errorf("%s got public %t, want %t", s, got, want)
+		}
+	}
+}
+
+func TestPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(docHandler))
+	defer srv.Close()
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	// certificate is for example.com
+	doh := dohServer(false)
+	defer doh.Close()
+	u, _ := url.Parse(srv.URL)
+	webURL := "https://example.com:" + u.Port() + "/doc"
+
+	tests := []struct {
+		pins    map[string][]string
+		wantErr error
+	}{
+		{map[string][]string{"example.com": {"AAAA", pin}}, nil},
+		{map[string][]string{"example.com": {"AAAA"}}, ErrPin},
+		{map[string][]string{"example.org": {"AAAA"}}, nil},
+	}
+	for _, test := range tests {
+		c := &Client{Client: *srv.Client(), DNSOverHTTPS: doh.URL, Pins: test.pins}
+		if _, _, err := c.Resolve(context.Background(), webURL); !errors.Is(err, test.wantErr) {
+			t.Errorf("pins %q got error %v, want %v", test.pins, err, test.wantErr)
+		}
+	}
+}
+
+// DoHServer answers A queries for did.test and example.com with the loopback
+// address, and TXT queries for _did.example.com with DIDs, with the AD flag
+// when authentic.
+func dohServer(authentic bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "want DNS message", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		end, err := skipDNSName(query, 12)
+		if err != nil || end+4 > len(query) {
+			http.Error(w, "malformed query", http.StatusBadRequest)
+			return
+		}
+		qtype := binary.BigEndian.Uint16(query[end:])
+		name := string(query[12:end])
+		res := append([]byte(nil), query[:end+4]...)
+		flags := uint16(dnsFlagQR | dnsFlagRD | 0x0080) // RA
+		if authentic {
+			flags |= dnsFlagAD
+		}
+		binary.BigEndian.PutUint16(res[10:], 0) // ARCOUNT
+		switch {
+		case name == "\x04_did\x07example\x03com\x00":
+			if qtype != dnsTypeTXT {
+				break
+			}
+			binary.BigEndian.PutUint16(res[6:], 2) // ANCOUNT
+			for _, strings := range [][]string{{"did=did:example:", "123"}, {"did=did:web:example.com"}} {
+				rdata := []byte(nil)
+				for _, s := range strings {
+					rdata = append(append(rdata, byte(len(s))), s...)
+				}
+				res = append(res, 0xc0, 12) // name pointer
+				res = binary.BigEndian.AppendUint16(res, dnsTypeTXT)
+				res = binary.BigEndian.AppendUint16(res, dnsClassIN)
+				res = binary.BigEndian.AppendUint32(res, 60) // TTL
+				res = binary.BigEndian.AppendUint16(res, uint16(len(rdata)))
+				res = append(res, rdata...)
+			}
+		case name != "\x03did\x04test\x00" && name != "\x07example\x03com\x00":
+			flags |= 3 // NXDOMAIN
+		case qtype == dnsTypeA:
+			binary.BigEndian.PutUint16(res[6:], 1) // ANCOUNT
+			res = append(res, 0xc0, 12)            // name pointer
+			res = binary.BigEndian.AppendUint16(res, dnsTypeA)
+			res = binary.BigEndian.AppendUint16(res, dnsClassIN)
+			res = binary.BigEndian.AppendUint32(res, 60) // TTL
+			res = binary.BigEndian.AppendUint16(res, 4)
+			res = append(res, 127, 0, 0, 1)
+		}
+		binary.BigEndian.PutUint16(res[2:], flags)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(res)
+	}))
+}
+
+func TestDNSOverHTTPS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(docHandler))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	webURL := "http://did.test:" + u.Port() + "/doc"
+
+	doh := dohServer(true)
+	defer doh.Close()
+	c := &Client{DNSOverHTTPS: doh.URL, RequireDNSSEC: true}
+	if _, _, err := c.Resolve(context.Background(), webURL); err != nil {
+		t.Errorf("got error: %s", err)
+	}
+	var dnsErr *net.DNSError
+	if _, _, err := c.Resolve(context.Background(), "http://nx.test/doc"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("unknown host got error %v, want not found", err)
+	}
+
+	// loopback from DNS is blocked too
+	c = &Client{DNSOverHTTPS: doh.URL, BlockPrivate: true}
+	if _, _, err := c.Resolve(context.Background(), webURL); !errors.Is(err, ErrBlocked) {
+		t.Errorf("private address got error %v, want ErrBlocked", err)
+	}
+
+	insecure := dohServer(false)
+	defer insecure.Close()
+	c = &Client{DNSOverHTTPS: insecure.URL, RequireDNSSEC: true}
+	if _, _, err := c.Resolve(context.Background(), webURL); !errors.Is(err, ErrDNSSEC) {
+		t.Errorf("without authentic data got error %v, want ErrDNSSEC", err)
+	}
+	c = &Client{RequireDNSSEC: true}
+	if _, _, err := c.Resolve(context.Background(), webURL); err == nil {
+		t.Error("DNSSEC without DNS over HTTPS got no error")
+	}
+}
+
+func TestLookupTXT(t *testing.T) {
+	doh := dohServer(true)
+	defer doh.Close()
+	c := &Client{DNSOverHTTPS: doh.URL, RequireDNSSEC: true}
+	got, err := c.LookupTXT(context.Background(), "_did.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "did=did:example:123" || got[1] != "did=did:web:example.com" {
+		t.Errorf("got %q", got)
+	}
+	var dnsErr *net.DNSError
+	if _, err := c.LookupTXT(context.Background(), "_did.did.test"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("unknown name got error %v, want not found", err)
+	}
+
+	insecure := dohServer(false)
+	defer insecure.Close()
+	c = &Client{DNSOverHTTPS: insecure.URL, RequireDNSSEC: true}
+	if _, err := c.LookupTXT(context.Background(), "_did.example.com"); !errors.Is(err, ErrDNSSEC) {
+		t.Errorf("without authentic data got error %v, want ErrDNSSEC", err)
+	}
+}
@@ -1,16 +1,30 @@
 package example
 
 import (
-	backend "EncrypteDL/IDChain/Backend"
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	backend "EncrypteDL/IDChain/Backend"
 )
 
 // DownloadMaxDefault is an upper boundary for byte sizes.
-// The default of 64 KiB provides good protection for most use-cases.
+// The default of 64 KiB provides good protection for most use-cases.
 const DownloadMaxDefault = 1 << 16
 
 // ErrDownloadMax signals an upper-boundary breach.
@@ -23,48 +37,173 @@ type Client struct {
 	// DownloadMax is the upper boundary for byte sizes. Zero defaults to
 	// DownloadMaxDefault. Negative values disable the limit.
 	DownloadMax int
+
+	// CacheSize is the maximum number of documents retained for
+	// conditional requests. Zero disables caching.
+	CacheSize int
+
+	// RedirectMax limits the number of redirects followed. Zero keeps the
+	// policy of the http.Client, which defaults to 10. Negative values
+	// disable redirects.
+	RedirectMax int
+
+	// BlockPrivate denies connections to loopback, private, link-local,
+	// and other non-public addresses, against server-side request forgery.
+	// The check applies to each address dialed, including redirects, which
+	// defeats DNS rebinding too. Proxies are not used when set.
+	BlockPrivate bool
+	// AllowPrefixes exempt address ranges from BlockPrivate.
+	AllowPrefixes []netip.Prefix
+
+	// Pins are the SHA-256 hashes of the expected SubjectPublicKeyInfo per
+	// host name, in base64, as with the pin-sha256 of RFC 7469. Any of the
+	// certificates in the verified chain may match. Hosts without pins are
+	// not restricted. IP addresses have no server name to pin.
+	Pins map[string][]string
+
+	// DNSOverHTTPS is the URL of an RFC 8484 service for the resolution of
+	// host names, e.g., "https://cloudflare-dns.com/dns-query". The system
+	// resolver applies when empty.
+	DNSOverHTTPS string
+	// RequireDNSSEC denies host names without authenticated data from the
+	// DNSOverHTTPS service, which must thus validate DNSSEC.
+	RequireDNSSEC bool
+
+	mutex sync.Mutex
+	cache map[string]*cached // by URL
+
+	// options apply once, on first use
+	hardenOnce sync.Once
+	hardened   *http.Client
+	hardenErr  error
+}
+
+// Cached is a response for revalidation. The document is shared, and thus
+// read-only.
+type cached struct {
+	doc          *backend.Document
+	meta         *backend.Meta
+	etag         string
+	lastModified string
+	fresh        time.Time // no revalidation until
 }
 
-// Resolve fetches a documentin a standard compliant manner
-func (c *Client) Resolve(webURL string) (*backend.Document, backend.DID) {
-	req, err := http.NewRequest(http.MethodGet, webURL, nil)
+func (c *Client) cached(webURL string) *cached {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cache[webURL]
+}
+
+func (c *Client) store(webURL string, e *cached) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cache == nil {
+		c.cache = make(map[string]*cached)
+	}
+	// random eviction by map order
+	for k := range c.cache {
+		if len(c.cache) < c.CacheSize {
+			break
+		}
+		delete(c.cache, k)
+	}
+	c.cache[webURL] = e
+}
+
+// Resolve fetches a document in a standard compliant manner. With caching
+// enabled, documents are revalidated with conditional requests once their
+// Cache-Control max-age passed. Cached documents are shared, and thus
+// read-only. The request is bound to ctx, including the download of the body.
+// Each lookup is an "http.get" span with the URL, and with the status code.
+func (c *Client) Resolve(ctx context.Context, webURL string) (doc *backend.Document, meta *backend.Meta, err error) {
+	ctx, span := backend.StartSpan(ctx, "http.get", slog.String("url", webURL))
+	defer func() { span.End(err) }()
+	return c.resolve(ctx, webURL, span)
+}
+
+func (c *Client) resolve(ctx context.Context, webURL string, span backend.Span) (*backend.Document, *backend.Meta, error) {
+	var prev *cached
+	if c.CacheSize > 0 {
+		prev = c.cached(webURL)
+		if prev != nil && time.Now().Before(prev.fresh) {
+			span.SetAttributes(slog.String("cache", "hit"))
+			return prev.doc, prev.meta, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, webURL, nil)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%w: %s", did.ErrNotFound, err)
+		return nil, nil, fmt.Errorf("%w: %s", backend.ErrNotFound, err)
 	}
 	req.Header.Set("Accept", "application/did+json, application/did+ld+json;q=0.7, application/json;q=0.1")
+	// explicit, which disables the transparent gzip of http.Transport
+	req.Header.Set("Accept-Encoding", AcceptEncoding)
+	if prev != nil {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
 
-	res, err := http.DefaultClient.Do(req)
+	client, err := c.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("DID document lookup: %w", err)
 	}
+	defer res.Body.Close()
+	span.SetAttributes(slog.Int("status", res.StatusCode))
 	switch res.StatusCode {
 	case http.StatusOK:
 		break
+	case http.StatusNotModified:
+		span.SetAttributes(slog.String("cache", "revalidated"))
+		if prev == nil {
+			return nil, nil, fmt.Errorf("HTTP %q for unconditional DID document request %s", res.Status, webURL)
+		}
+		meta := *prev.meta // shared
+		meta.Expires = freshUntil(res.Header)
+		c.store(webURL, &cached{prev.doc, &meta, prev.etag, prev.lastModified, meta.Expires})
+		return prev.doc, &meta, nil
 	case http.StatusNotFound:
-		return nil, nil, did.ErrNotFound
+		return nil, nil, backend.ErrNotFound
+	case http.StatusGone:
+		return nil, nil, backend.ErrDeactivated
 	case http.StatusNotAcceptable:
-		return nil, nil, fmt.Errorf("%w—want JSON", did.ErrMediaType)
+		return nil, nil, fmt.Errorf("%w—want JSON", backend.ErrMediaType)
 	default:
 		// best-effort error code resolution
 		buf := make([]byte, 32*1023)
 		var meta struct {
-			Error string `json:"error"`
+			Error      string `json:"error"`
+			Resolution struct {
+				Error string `json:"error"`
+			} `json:"didResolutionMetadata"`
 		}
 		n, _ := io.ReadFull(res.Body, buf[:])
 		json.Unmarshal(buf[:n], &meta)
+		if meta.Error == "" {
+			meta.Error = meta.Resolution.Error
+		}
 		switch meta.Error {
 		case "invalidDid":
-			return nil, nil, Document.ErrInvalid
+			return nil, nil, backend.ErrInvalid
 		case "notFound":
-			return nil, nil, did.ErrNotFound
+			return nil, nil, backend.ErrNotFound
 		case "representationNotSupported":
-			return nil, nil, did.ErrMediaType
+			return nil, nil, backend.ErrMediaType
+		case "methodNotSupported":
+			return nil, nil, backend.ErrMethodNotSupported
 		}
 
 		return nil, nil, fmt.Errorf("HTTP %q for DID document %s", res.Status, webURL)
 	}
 
-	var m backend.Meta
+	m := backend.Meta{Expires: freshUntil(res.Header)}
 	if s := res.Header.Get("Last-Modified"); s != "" {
 		// best-effort basis
 		m.Updated, _ = http.ParseTime(s)
@@ -75,11 +214,17 @@ func (c *Client) Resolve(webURL string) (*backend.Document, backend.DID) {
 	case c.DownloadMax > 0:
 		max = c.DownloadMax
 	case c.DownloadMax < 0:
-		// 1 GiB hard limit
+		// 1 GiB hard limit
 		max = 1 << 30
 	}
+	body, err := decodeContent(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DID document %q unavailable: %w", webURL, err)
+	}
+	defer body.Close()
+	// limit applies to the decompressed size, against compression bombs
 	r := io.LimitedReader{
-		R: res.Body,
+		R: body,
 		N: int64(max),
 	}
 
@@ -87,10 +232,84 @@ func (c *Client) Resolve(webURL string) (*backend.Document, backend.DID) {
 	err = json.NewDecoder(&r).Decode(&d)
 	switch {
 	case err == nil:
-		return &d, &m, nil
+		span.SetAttributes(slog.Int64("bytes", int64(max)-r.N)) // decompressed, with any read-ahead
 	case r.N <= 0:
 		return nil, nil, fmt.Errorf("%w: %s reached %d bytes", ErrDownloadMax, webURL, max)
 	default:
 		return nil, nil, fmt.Errorf("DID document %q unavailable: %w", webURL, err)
 	}
+
+	if c.CacheSize > 0 {
+		etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+		noStore := strings.Contains(res.Header.Get("Cache-Control"), "no-store")
+		if (etag != "" || lastModified != "") && !noStore {
+			c.store(webURL, &cached{&d, &m, etag, lastModified, m.Expires})
+		}
+	}
+	return &d, &m, nil
+}
+
+// FreshUntil returns the expiry of the Cache-Control max-age, or the Expires
+// header otherwise, with the current time for none. “If a response includes a
+// Cache-Control header field with the max-age directive, a recipient MUST
+// ignore the Expires header field.”
+func freshUntil(h http.Header) time.Time {
+	now := time.Now()
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache", directive == "no-store":
+			return now
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(directive[len("max-age="):])
+			if err != nil || seconds <= 0 {
+				return now
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if s := h.Get("Expires"); s != "" {
+		// “invalid date formats, especially the value "0"” are in the past
+		t, err := http.ParseTime(s)
+		if err == nil && t.After(now) {
+			return t
+		}
+	}
+	return now
+}
+
+// AcceptEncoding lists the content codings supported.
+const AcceptEncoding = "zstd, gzip, deflate"
+
+// ZstdWindowMax limits the memory of zstd decoding in bytes.
+const zstdWindowMax = 8 << 20
+
+// DecodeContent returns the body of res with the Content-Encoding removed.
+func decodeContent(res *http.Response) (io.ReadCloser, error) {
+	switch coding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))); coding {
+	case "", "identity":
+		return io.NopCloser(res.Body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(res.Body)
+	case "deflate":
+		// RFC 9110 specifies the zlib format, yet some servers send raw
+		// deflate instead
+		buf := bufio.NewReader(res.Body)
+		head, _ := buf.Peek(2)
+		if len(head) == 2 && head[0]&0x0f == 8 && (uint(head[0])<<8|uint(head[1]))%31 == 0 {
+			return zlib.NewReader(buf)
+		}
+		return flate.NewReader(buf), nil
+	case "zstd":
+		d, err := zstd.NewReader(res.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(zstdWindowMax),
+			zstd.WithDecoderMaxMemory(zstdWindowMax))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content coding %q", coding)
+	}
 }
@@ -1,2 +1,136 @@
 package example
 
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/httpserver"
+)
+
+func TestRevalidation(t *testing.T) {
+	var full, notModified atomic.Int32
+	resolver := &httpserver.Server{
+		Resolver: backend.Resolve(func(did backend.DID) (*backend.Document, *backend.Meta, error) {
+			return &backend.Document{Subject: did}, &backend.Meta{Updated: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, nil
+		}),
+		Log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		resolver.ServeHTTP(rec, r)
+		switch rec.Code {
+		case http.StatusOK:
+			full.Add(1)
+		case http.StatusNotModified:
+			notModified.Add(1)
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	c := &Client{CacheSize: 10}
+	webURL := srv.URL + httpserver.Path + "did:example:alice"
+	for i := 0; i < 3; i++ {
+		doc, meta, err := c.Resolve(context.Background(), webURL)
+		if err != nil {
+			t.Fatalf("resolve № %d got error: %s", i+1, err)
+		}
+		if doc.Subject.String() != "did:example:alice" || !meta.Updated.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("resolve № %d got subject %s, updated %s", i+1, doc.Subject.String(), meta.Updated)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 2 {
+		t.Errorf("got %d full and %d not-modified responses, want 1 and 2", full.Load(), notModified.Load())
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	doc := []byte(`{"id":"did:example:alice","alsoKnownAs":["` + strings.Repeat("a", 4000) + `"]}`)
+	bomb := []byte(`{"id":"did:example:bomb","alsoKnownAs":["` + strings.Repeat("b", 1<<20) + `"]}`)
+
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+	}
+	for name, newWriter := range encoders {
+		var accept string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept = r.Header.Get("Accept-Encoding")
+			var buf bytes.Buffer
+			enc := newWriter(&buf)
+			if strings.HasSuffix(r.URL.Path, "bomb") {
+				enc.Write(bomb)
+			} else {
+				enc.Write(doc)
+			}
+			enc.Close()
+			w.Header().Set("Content-Encoding", strings.TrimPrefix(name, "raw-"))
+			w.Write(buf.Bytes())
+		}))
+
+		var c Client
+		got, _, err := c.Resolve(context.Background(), srv.URL+"/doc")
+		if err != nil {
+			t.Errorf("%s got error: %s", name, err)
+		} else if got.Subject.String() != "did:example:alice" || len(got.AlsoKnownAs) != 1 {
+			t.Errorf("%s got document %+v", name, got)
+		}
+		if accept != AcceptEncoding {
+			t.Errorf("%s got Accept-Encoding %q, want %q", name, accept, AcceptEncoding)
+		}
+
+		_, _, err = c.Resolve(context.Background(), srv.URL+"/bomb")
+		if !errors.Is(err, ErrDownloadMax) {
+			t.Errorf("%s compression bomb got error %v, want ErrDownloadMax", name, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestFreshUntil(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		header http.Header
+		fresh  bool
+	}{
+		{http.Header{}, false},
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, true},
+		{http.Header{"Cache-Control": {"no-cache, max-age=60"}}, false},
+		{http.Header{"Expires": {future}}, true},
+		{http.Header{"Expires": {"0"}}, false},
+		{http.Header{"Cache-Control": {"max-age=0"}, "Expires": {future}}, false},
+	}
+	for _, test := range tests {
+		got := freshUntil(test.header).After(time.Now().Add(time.Second))
+		if got != test.fresh {
+			t.Errorf("%v got fresh %t, want %t", test.header, got, test.fresh)
+		}
+	}
+}
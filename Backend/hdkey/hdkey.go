@@ -0,0 +1,258 @@
+// Package hdkey derives keys hierarchically from a seed, conform BIP-32 and
+// SLIP-0010, such that one backup of the seed recovers each of the keys. DID
+// keys follow Path, with a level for the account (one per DID), the verification
+// relationship and the key index. Index n + 1 is the pre-rotation key of n.
+// Seeds may come from a BIP-39 mnemonic, with MnemonicSeed.
+package hdkey
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Hardened is the offset of hardened child indices.
+const Hardened uint32 = 1 << 31
+
+// Purpose is the first level of Path, which is "DID" in ASCII.
+const Purpose = 0x444944
+
+// Role is the second level of Path, one per verification relationship.
+type Role uint32
+
+// Roles in Path
+const (
+	Authentication Role = iota
+	AssertionMethod
+	KeyAgreement
+	CapabilityInvocation
+	CapabilityDelegation
+)
+
+// Path returns the well-known derivation path of a DID key, with all levels
+// hardened. The key with index + 1 is the next key for pre-rotation.
+func Path(account uint32, r Role, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d'", Purpose, account, r, index)
+}
+
+// DIDKey derives the private key at Path from seed. Key agreement gets X25519,
+// and the other roles get t, with keys.Ed25519 as the default when empty.
+func DIDKey(seed []byte, t keys.Type, account uint32, r Role, index uint32) (crypto.PrivateKey, error) {
+	switch {
+	case r == KeyAgreement:
+		t = keys.X25519
+	case t == "":
+		t = keys.Ed25519
+	}
+	master, err := NewMaster(seed, t)
+	if err != nil {
+		return nil, err
+	}
+	k, err := master.Derive(Path(account, r, index))
+	if err != nil {
+		return nil, err
+	}
+	return k.PrivateKey()
+}
+
+// ErrPath signals a derivation path which is malformed, or which is not
+// supported by the curve, such as non-hardened levels with Ed25519.
+var ErrPath = errors.New("key derivation path not supported")
+
+// Curves as in SLIP-0010, by key type
+var curves = map[keys.Type]struct {
+	seedKey string
+	order   *big.Int // nil for Edwards and Montgomery curves
+}{
+	keys.Ed25519:   {"ed25519 seed", nil},
+	keys.X25519:    {"curve25519 seed", nil},
+	keys.Secp256k1: {"Bitcoin seed", secp256k1.Params().N},
+	keys.P256:      {"Nist256p1 seed", elliptic.P256().Params().N},
+}
+
+// Key is an extended private key.
+type Key struct {
+	Type      keys.Type
+	Depth     int
+	ChainCode [32]byte
+	secret    [32]byte
+}
+
+// NewMaster returns the master key of seed for a type of key, which is one of
+// keys.Ed25519, keys.X25519, keys.Secp256k1 or keys.P256. Seeds are 16 to 64
+// bytes in size.
+func NewMaster(seed []byte, t keys.Type) (*Key, error) {
+	curve, ok := curves[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q for key derivation", keys.ErrKeyType, t)
+	}
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("key derivation seed of %d bytes, want 16 to 64", len(seed))
+	}
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, []byte(curve.seedKey))
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		k := &Key{Type: t}
+		copy(k.secret[:], sum[:32])
+		copy(k.ChainCode[:], sum[32:])
+		if curve.order == nil || validScalar(sum[:32], curve.order) {
+			return k, nil
+		}
+		data = sum // retry, conform SLIP-0010
+	}
+}
+
+func validScalar(b []byte, order *big.Int) bool {
+	n := new(big.Int).SetBytes(b)
+	return n.Sign() != 0 && n.Cmp(order) < 0
+}
+
+// Child returns the key with index i. Indices from Hardened on are hardened
+// derivations. Ed25519 and X25519 support hardened derivation only.
+func (k *Key) Child(i uint32) (*Key, error) {
+	order := curves[k.Type].order
+	if i < Hardened && order == nil {
+		return nil, fmt.Errorf("%w: %s needs hardened levels only", ErrPath, k.Type)
+	}
+
+	data := make([]byte, 0, 37)
+	if i >= Hardened {
+		data = append(data, 0)
+		data = append(data, k.secret[:]...)
+	} else {
+		pub, err := k.compressedPublic()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, pub...)
+	}
+	data = binary.BigEndian.AppendUint32(data, i)
+
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode[:])
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		child := &Key{Type: k.Type, Depth: k.Depth + 1}
+		copy(child.ChainCode[:], sum[32:])
+		if order == nil {
+			copy(child.secret[:], sum[:32])
+			return child, nil
+		}
+
+		// child = IL + parent (mod n), retried on an invalid outcome
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Cmp(order) < 0 {
+			s := il.Add(il, new(big.Int).SetBytes(k.secret[:]))
+			s.Mod(s, order)
+			if s.Sign() != 0 {
+				s.FillBytes(child.secret[:])
+				return child, nil
+			}
+		}
+		data = append(append(data[:0], 1), sum[32:]...)
+		data = binary.BigEndian.AppendUint32(data, i)
+	}
+}
+
+// Derive returns the key at path, e.g., "m/44'/0'/0'", relative to k. Both
+// the apostrophe and "H" mark hardened levels.
+func (k *Key) Derive(path string) (*Key, error) {
+	indices, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range indices {
+		k, err = k.Child(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ParsePath returns the child indices of path.
+func ParsePath(path string) ([]uint32, error) {
+	levels := strings.Split(path, "/")
+	if levels[0] != "m" {
+		return nil, fmt.Errorf("%w: %q does not start with m", ErrPath, path)
+	}
+	indices := make([]uint32, 0, len(levels)-1)
+	for _, level := range levels[1:] {
+		s, hardened := strings.CutSuffix(level, "'")
+		if !hardened {
+			s, hardened = strings.CutSuffix(level, "H")
+		}
+		n, err := strconv.ParseUint(s, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%w: level %q of %q", ErrPath, level, path)
+		}
+		i := uint32(n)
+		if hardened {
+			i += Hardened
+		}
+		indices = append(indices, i)
+	}
+	return indices, nil
+}
+
+// PrivateKey returns the key in the form of keys.Generate.
+func (k *Key) PrivateKey() (crypto.PrivateKey, error) {
+	switch k.Type {
+	case keys.Ed25519:
+		return ed25519.NewKeyFromSeed(k.secret[:]), nil
+	case keys.X25519:
+		return ecdh.X25519().NewPrivateKey(k.secret[:])
+	case keys.Secp256k1:
+		return keys.NewSecp256k1(k.secret[:])
+	case keys.P256:
+		e, err := ecdh.P256().NewPrivateKey(k.secret[:])
+		if err != nil {
+			return nil, err
+		}
+		point := e.PublicKey().Bytes() // uncompressed
+		return &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(point[1:33]),
+				Y:     new(big.Int).SetBytes(point[33:]),
+			},
+			D: new(big.Int).SetBytes(k.secret[:]),
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", keys.ErrKeyType, k.Type)
+}
+
+// CompressedPublic returns the SEC 1 compressed point of k.
+func (k *Key) compressedPublic() ([]byte, error) {
+	private, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	switch private := private.(type) {
+	case *keys.Secp256k1PrivateKey:
+		return []byte(private.Public().(didkey.Secp256k1PublicKey)), nil
+	case *ecdsa.PrivateKey:
+		pub := make([]byte, 33)
+		pub[0] = 2 | byte(private.Y.Bit(0))
+		private.X.FillBytes(pub[1:])
+		return pub, nil
+	}
+	return nil, fmt.Errorf("%w: %s has no compressed form", keys.ErrKeyType, k.Type)
+}
@@ -0,0 +1,174 @@
+package hdkey
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/rotation"
+)
+
+// Test vector 1 of SLIP-0010 (and BIP-32 for secp256k1)
+var goldenSeed, _ = hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+func TestVectors(t *testing.T) {
+	tests := []struct {
+		typ             keys.Type
+		path            string
+		chain, expected string
+	}{
+		{keys.Ed25519, "m",
+			"90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+			"2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{keys.Ed25519, "m/0'",
+			"8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+			"68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+		{keys.Secp256k1, "m",
+			"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+			"e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{keys.Secp256k1, "m/0H",
+			"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+			"edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{keys.Secp256k1, "m/0H/1",
+			"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+			"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{keys.P256, "m",
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{keys.P256, "m/0'",
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+	}
+	for _, test := range tests {
+		master, err := NewMaster(goldenSeed, test.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := master.Derive(test.path)
+		if err != nil {
+			t.Errorf("%s %s got error: %s", test.typ, test.path, err)
+			continue
+		}
+		if got := hex.EncodeToString(k.ChainCode[:]); got != test.chain {
+			t.Errorf("%s %s got chain code %s, want %s", test.typ, test.path, got, test.chain)
+		}
+		if got := hex.EncodeToString(k.secret[:]); got != test.expected {
+			t.Errorf("%s %s got private key %s, want %s", test.typ, test.path, got, test.expected)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	got, err := ParsePath("m/44'/0H/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != Hardened+44 || got[1] != Hardened || got[2] != 7 {
+		t.Errorf("got indices %d", got)
+	}
+	for _, path := range []string{"", "44'/0'", "m/", "m/x", "m/2147483648", "m/-1'"} {
+		if _, err := ParsePath(path); !errors.Is(err, ErrPath) {
+			t.Errorf("path %q got error %v, want ErrPath", path, err)
+		}
+	}
+
+	master, _ := NewMaster(goldenSeed, keys.Ed25519)
+	if _, err := master.Derive("m/0'/1"); !errors.Is(err, ErrPath) {
+		t.Errorf("non-hardened Ed25519 got error %v, want ErrPath", err)
+	}
+}
+
+func TestDIDKey(t *testing.T) {
+	auth, err := DIDKey(goldenSeed, "", 0, Authentication, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := DIDKey(goldenSeed, keys.Ed25519, 0, Authentication, 0)
+	if !auth.(ed25519.PrivateKey).Equal(again) {
+		t.Error("derivation not deterministic")
+	}
+	other, _ := DIDKey(goldenSeed, "", 1, Authentication, 0)
+	if auth.(ed25519.PrivateKey).Equal(other) {
+		t.Error("accounts share keys")
+	}
+
+	agreement, err := DIDKey(goldenSeed, keys.Ed25519, 0, KeyAgreement, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := agreement.(*ecdh.PrivateKey); !ok {
+		t.Errorf("key agreement got Go type %T", agreement)
+	}
+
+	// pre-rotation commitment recovers from the seed alone
+	next, _ := DIDKey(goldenSeed, "", 0, Authentication, 1)
+	c1, _ := rotation.Commitment(next.(ed25519.PrivateKey).Public())
+	recovered, _ := DIDKey(goldenSeed, "", 0, Authentication, 1)
+	c2, _ := rotation.Commitment(recovered.(ed25519.PrivateKey).Public())
+	if c1 == "" || c1 != c2 {
+		t.Errorf("got commitments %q and %q", c1, c2)
+	}
+
+	for _, typ := range []keys.Type{keys.Secp256k1, keys.P256} {
+		k, err := DIDKey(goldenSeed, typ, 0, CapabilityInvocation, 0)
+		if err != nil {
+			t.Fatalf("%s error: %s", typ, err)
+		}
+		if _, err := keys.Signer(k); err != nil {
+			t.Errorf("%s not a signer: %s", typ, err)
+		}
+	}
+	if _, err := DIDKey(goldenSeed, keys.P384, 0, Authentication, 0); !errors.Is(err, keys.ErrKeyType) {
+		t.Errorf("P-384 got error %v, want ErrKeyType", err)
+	}
+}
+
+func TestMnemonic(t *testing.T) {
+	// test vectors of the BIP-39 reference implementation, with passphrase "TREZOR"
+	tests := []struct{ entropy, mnemonic, seed string }{
+		{"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"},
+		{"80808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8"},
+		{"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069"},
+		{"000000000000000000000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon agent",
+			"035895f2f481b1b0f01fcf8c289c794660b289981a78f8106447707fdd9666ca06da5a9a565181599b79f53b844d8a71dd9f439c52a3d7b3e8a79c906ac845fa"},
+	}
+	for _, test := range tests {
+		entropy, _ := hex.DecodeString(test.entropy)
+		got, err := NewMnemonic(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.mnemonic {
+			t.Errorf("%s got mnemonic %q, want %q", test.entropy, got, test.mnemonic)
+		}
+		decoded, err := MnemonicEntropy(test.mnemonic)
+		if err != nil || hex.EncodeToString(decoded) != test.entropy {
+			t.Errorf("%q got entropy %x, error %v", test.mnemonic, decoded, err)
+		}
+		seed, err := MnemonicSeed(test.mnemonic, "TREZOR")
+		if err != nil || hex.EncodeToString(seed) != test.seed {
+			t.Errorf("%q got seed %x, error %v", test.mnemonic, seed, err)
+		}
+	}
+
+	for _, mnemonic := range []string{
+		"",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon aboot",
+	} {
+		if _, err := MnemonicEntropy(mnemonic); !errors.Is(err, ErrMnemonic) {
+			t.Errorf("%q got error %v, want ErrMnemonic", mnemonic, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package hdkey
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// English is the word list of BIP-39.
+//
+//go:embed english.txt
+var english string
+
+var (
+	words     = strings.Fields(english)
+	wordIndex = make(map[string]int, len(words))
+)
+
+func init() {
+	for i, w := range words {
+		wordIndex[w] = i
+	}
+}
+
+// ErrMnemonic signals a mnemonic with an unknown word, with a wrong number of
+// words, or with a checksum mismatch.
+var ErrMnemonic = errors.New("invalid mnemonic")
+
+// NewMnemonic encodes entropy as a BIP-39 mnemonic sentence, in English. The
+// entropy is 16 to 32 bytes in size, in steps of 4, for 12 to 24 words.
+func NewMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("mnemonic entropy of %d bytes, want 16, 20, 24, 28 or 32", len(entropy))
+	}
+	checksum := sha256.Sum256(entropy)
+	bits := append(entropy[:len(entropy):len(entropy)], checksum[0])
+
+	n := (len(entropy)*8 + len(entropy)/4) / 11
+	sentence := make([]string, n)
+	for i := range sentence {
+		// 11 bits from offset i × 11
+		var index int
+		for b := i * 11; b < (i+1)*11; b++ {
+			index = index<<1 | int(bits[b/8]>>(7-b%8)&1)
+		}
+		sentence[i] = words[index]
+	}
+	return strings.Join(sentence, " "), nil
+}
+
+// MnemonicEntropy decodes a mnemonic sentence of NewMnemonic, with its checksum
+// verified. Words are separated by white space in any amount.
+func MnemonicEntropy(mnemonic string) ([]byte, error) {
+	sentence := strings.Fields(mnemonic)
+	switch len(sentence) {
+	case 12, 15, 18, 21, 24:
+		break
+	default:
+		return nil, fmt.Errorf("%w: %d words, want 12, 15, 18, 21 or 24", ErrMnemonic, len(sentence))
+	}
+	bits := make([]byte, (len(sentence)*11+7)/8)
+	for i, w := range sentence {
+		index, ok := wordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("%w: word № %d not in the word list", ErrMnemonic, i+1)
+		}
+		for b := 0; b < 11; b++ {
+			if index>>(10-b)&1 != 0 {
+				offset := i*11 + b
+				bits[offset/8] |= 0x80 >> (offset % 8)
+			}
+		}
+	}
+
+	size := len(sentence) * 4 / 3 // entropy bytes
+	entropy := bits[:size]
+	checksum := sha256.Sum256(entropy)
+	checksumBits := uint(size / 4)
+	mask := byte(0xff) << (8 - checksumBits)
+	if bits[size]&mask != checksum[0]&mask {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrMnemonic)
+	}
+	return entropy, nil
+}
+
+// MnemonicSeed returns the seed of a mnemonic sentence, for NewMaster, as in
+// BIP-39. The optional passphrase must be in Unicode normalization form NFKD,
+// which holds for ASCII.
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
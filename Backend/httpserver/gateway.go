@@ -0,0 +1,334 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Gateway errors map to HTTP status codes.
+var (
+	errMethod  = fmt.Errorf("%w by gateway", backend.ErrMethodNotSupported)
+	errTimeout = errors.New("DID resolution exceeded the time budget")
+	errSize    = errors.New("DID document exceeds the size budget")
+)
+
+// Duration is a time.Duration with text encoding, e.g., "5s".
+type Duration time.Duration
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = Duration(v)
+	return err
+}
+
+// Gateway is the hardened mode, for exposure of a Server on the open internet.
+// The zero values of the budgets apply defaults.
+type Gateway struct {
+	Enabled bool `json:"enabled"`
+
+	// Methods is the allowlist of DID methods. Empty denies all.
+	Methods []string `json:"methods"`
+
+	MaxURLLength int      `json:"maxURLLength"` // default 1 KiB
+	MaxDocument  int      `json:"maxDocument"`  // bytes, default 64 KiB
+	Timeout      Duration `json:"timeout"`      // per resolution, default 5 s
+	MaxInFlight  int      `json:"maxInFlight"`  // concurrent resolutions, default 64
+
+	CacheTTL  Duration `json:"cacheTTL"`  // default 1 min
+	CacheSize int      `json:"cacheSize"` // entries, default 10 000
+
+	// RatePerClient is the sustained number of requests per second for
+	// each client network (IPv4 /24 or IPv6 /48), with Burst on top.
+	RatePerClient float64 `json:"ratePerClient"` // default 5
+	Burst         int     `json:"burst"`         // default 20
+
+	// TrustProxy takes the client address from the last X-Forwarded-For
+	// entry, for deployment behind a reverse proxy.
+	TrustProxy bool `json:"trustProxy"`
+
+	inFlight chan struct{}
+}
+
+func (g *Gateway) timeout() time.Duration {
+	if g.Timeout > 0 {
+		return time.Duration(g.Timeout)
+	}
+	return 5 * time.Second
+}
+
+func (g *Gateway) cacheTTL() time.Duration {
+	if g.CacheTTL > 0 {
+		return time.Duration(g.CacheTTL)
+	}
+	return time.Minute
+}
+
+func (g *Gateway) cacheMaxAge() string {
+	return strconv.Itoa(int(g.cacheTTL() / time.Second))
+}
+
+// Setup applies the Gateway configuration.
+func (s *Server) setup() {
+	g := &s.Gateway
+	if !g.Enabled {
+		return
+	}
+	n := g.MaxInFlight
+	if n <= 0 {
+		n = 64
+	}
+	g.inFlight = make(chan struct{}, n)
+	size := g.CacheSize
+	if size <= 0 {
+		size = 10000
+	}
+	s.cache = &cache{max: size, entries: make(map[string]*cacheEntry)}
+	rate, burst := g.RatePerClient, g.Burst
+	if rate <= 0 {
+		rate = 5
+	}
+	if burst <= 0 {
+		burst = 20
+	}
+	s.limiter = &limiter{rate: rate, burst: float64(burst), clients: make(map[string]*bucket)}
+}
+
+// Admit applies the request budgets and the throttle.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request) bool {
+	max := s.Gateway.MaxURLLength
+	if max <= 0 {
+		max = 1 << 10
+	}
+	if len(r.URL.EscapedPath())+len(r.URL.RawQuery) > max {
+		http.Error(w, "request URL exceeds size budget", http.StatusRequestURITooLong)
+		return false
+	}
+	if wait := s.limiter.take(s.Gateway.clientNet(r), time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// ClientNet returns the anonymized client address, with the host part of
+// IPv4 (/24) and IPv6 (/48) zeroed.
+func (g *Gateway) clientNet(r *http.Request) string {
+	addr := r.RemoteAddr
+	if g.TrustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) != 0 {
+			last := fwd[len(fwd)-1]
+			addr = strings.TrimSpace(last[strings.LastIndexByte(last, ',')+1:])
+		}
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return "unknown"
+	case ip.To4() != nil:
+		return ip.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	default:
+		return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+	}
+}
+
+// GatewayResolve applies the allowlist, the cache and the budgets.
+func (s *Server) gatewayResolve(ctx context.Context, did backend.DID) ([]byte, *backend.Meta, error) {
+	allowed := false
+	for _, m := range s.Gateway.Methods {
+		if m == did.Method {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("%w: %q", errMethod, did.Method)
+	}
+
+	key := did.String()
+	if e, ok := s.cache.get(key, time.Now()); ok {
+		return e.body, e.meta, e.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Gateway.timeout())
+	defer cancel()
+	select {
+	case s.Gateway.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, errTimeout
+	}
+
+	type result struct {
+		body []byte
+		meta *backend.Meta
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// the slot frees once the resolution completes, timeout or not
+		defer func() { <-s.Gateway.inFlight }()
+		doc, meta, err := s.Resolver.Resolve(ctx, did)
+		var body []byte
+		if err == nil {
+			body, err = json.Marshal(doc)
+		}
+		done <- result{body, meta, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return nil, nil, errTimeout
+	}
+
+	max := s.Gateway.MaxDocument
+	if max <= 0 {
+		max = 64 << 10
+	}
+	if res.err == nil && len(res.body) > max {
+		res.body, res.err = nil, errSize
+	}
+	// cache misses too, against enumeration
+	if res.err == nil || errors.Is(res.err, backend.ErrNotFound) {
+		s.cache.put(key, &cacheEntry{res.body, res.meta, res.err, time.Now().Add(s.Gateway.cacheTTL())})
+	}
+	return res.body, res.meta, res.err
+}
+
+// GatewayResolver applies the gateway budgets on dereferencing.
+type gatewayResolver struct {
+	*Server
+}
+
+// Resolve implements the backend.Resolver interface.
+func (g gatewayResolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	body, meta, err := g.gatewayResolve(ctx, did)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := new(backend.Document)
+	if err := json.Unmarshal(body, doc); err != nil {
+		return nil, nil, err
+	}
+	return doc, meta, nil
+}
+
+// GatewayLog omits the DID, which may be personal data, and the client
+// address beyond its network.
+func (s *Server) gatewayLog(r *http.Request, status int, d time.Duration) {
+	method := "-"
+	if rest, ok := strings.CutPrefix(r.URL.Path, Path+"did:"); ok {
+		if i := strings.IndexByte(rest, ':'); i > 0 {
+			method = rest[:i]
+		}
+	}
+	s.log().Info("DID resolution request", "didMethod", method, "status", status, "duration", d, "clientNet", s.Gateway.clientNet(r))
+}
+
+type cacheEntry struct {
+	body    []byte
+	meta    *backend.Meta
+	err     error
+	expires time.Time
+}
+
+// Cache is a bounded map with expiry.
+type cache struct {
+	mutex   sync.Mutex
+	max     int
+	entries map[string]*cacheEntry
+}
+
+func (c *cache) get(key string, now time.Time) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expires) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *cache) put(key string, e *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.entries) >= c.max {
+		now := time.Now()
+		for k, v := range c.entries {
+			if now.After(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// random eviction by map order when still full
+		for k := range c.entries {
+			if len(c.entries) < c.max {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = e
+}
+
+// Limiter is a token bucket per client network.
+type limiter struct {
+	mutex   sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	clients map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	filled time.Time
+}
+
+// Take returns zero when admitted, or the time until a token is available.
+func (l *limiter) take(client string, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// drop full buckets once a minute
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.clients {
+			if b.tokens+now.Sub(b.filled).Seconds()*l.rate >= l.burst {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, filled: now}
+		l.clients[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.filled).Seconds()*l.rate)
+	b.filled = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
@@ -0,0 +1,335 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// TestResolver serves did:example:alice only.
+type testResolver struct {
+	calls *atomic.Int32 // optional
+	delay time.Duration // optional
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r testResolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	if r.calls != nil {
+		r.calls.Add(1)
+	}
+	time.Sleep(r.delay)
+	switch did.SpecID {
+	case "alice":
+		return &backend.Document{Subject: did}, &backend.Meta{Updated: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, nil
+	case "slow":
+		select {
+		case <-time.After(time.Second):
+			return &backend.Document{Subject: did}, nil, nil
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	case "gone":
+		return nil, nil, backend.ErrDeactivated
+	case "huge":
+		return &backend.Document{Subject: did, AlsoKnownAs: []string{strings.Repeat("x", 1000)}}, nil, nil
+	}
+	return nil, nil, backend.ErrNotFound
+}
+
+func get(h http.Handler, path, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if remote != "" {
+		req.RemoteAddr = remote
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer(t *testing.T) {
+	s := &Server{
+		Resolver: testResolver{},
+		Timeout:  50 * time.Millisecond,
+		Log:      slog.New(slog.NewTextHandler(new(bytes.Buffer), nil)),
+	}
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/1.0/identifiers/did:example:alice", http.StatusOK},
+		{"/1.0/identifiers/did:example:slow", http.StatusGatewayTimeout},
+		{"/1.0/identifiers/did:example:bob", http.StatusNotFound},
+		{"/1.0/identifiers/did:example:gone", http.StatusGone},
+		{"/1.0/identifiers/did:example", http.StatusBadRequest},
+		{"/2.0/identifiers/did:example:alice", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := get(s, test.path, "")
+		if rec.Code != test.status {
+			t.Errorf("%s got status %d, want %d", test.path, rec.Code, test.status)
+		}
+	}
+
+	rec := get(s, "/1.0/identifiers/did:example:alice", "")
+	if got := rec.Header().Get("Content-Type"); got != backend.JSON {
+		t.Errorf("got content type %q, want %q", got, backend.JSON)
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Errorf("got Last-Modified %q", got)
+	}
+	if got := rec.Body.String(); !strings.Contains(got, `"id":"did:example:alice"`) {
+		t.Errorf("got body %s", got)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	s := &Server{Resolver: testResolver{}, Log: slog.New(slog.NewTextHandler(new(bytes.Buffer), nil))}
+	const path = "/1.0/identifiers/did:example:alice"
+	etag := get(s, path, "").Header().Get("ETag")
+	if len(etag) != 34 {
+		t.Fatalf("got ETag %q, want 32 hex digits quoted", etag)
+	}
+
+	tests := []struct {
+		header, value string
+		status        int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"If-None-Match", "*", http.StatusNotModified},
+		{"If-None-Match", `"other"`, http.StatusOK},
+		{"If-Modified-Since", "Tue, 02 Jan 2024 03:04:05 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Tue, 02 Jan 2024 03:04:04 GMT", http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(test.header, test.value)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: %s got status %d, want %d", test.header, test.value, rec.Code, test.status)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: %s got a body with 304", test.header, test.value)
+		}
+	}
+
+	// resolution results differ in duration only
+	var resultTags []string
+	for _, delay := range []time.Duration{0, 5 * time.Millisecond} {
+		s.Resolver = testResolver{delay: delay}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", ResultType)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		resultTags = append(resultTags, rec.Header().Get("ETag"))
+	}
+	if resultTags[0] != resultTags[1] {
+		t.Errorf("got resolution result ETags %q, want one", resultTags)
+	}
+	if resultTags[0] == etag {
+		t.Error("resolution result got the ETag of the JSON representation")
+	}
+}
+
+func TestGateway(t *testing.T) {
+	var calls atomic.Int32
+	var logs bytes.Buffer
+	s := &Server{
+		Resolver: testResolver{calls: &calls},
+		Log:      slog.New(slog.NewTextHandler(&logs, nil)),
+		Gateway: Gateway{
+			Enabled:     true,
+			Methods:     []string{"example"},
+			MaxDocument: 512,
+			Timeout:     Duration(50 * time.Millisecond),
+			Burst:       100,
+		},
+	}
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/1.0/identifiers/did:example:alice", http.StatusOK},
+		{"/1.0/identifiers/did:other:alice", http.StatusNotImplemented},
+		{"/1.0/identifiers/did:example:slow", http.StatusGatewayTimeout},
+		{"/1.0/identifiers/did:example:huge", http.StatusBadGateway},
+		{"/1.0/identifiers/did:example:" + strings.Repeat("a", 2000), http.StatusRequestURITooLong},
+	}
+	for _, test := range tests {
+		rec := get(s, test.path, "192.0.2.10:1234")
+		if rec.Code != test.status {
+			t.Errorf("%.60s got status %d, want %d", test.path, rec.Code, test.status)
+		}
+	}
+
+	// cache
+	before := calls.Load()
+	for i := 0; i < 3; i++ {
+		get(s, "/1.0/identifiers/did:example:alice", "192.0.2.10:1234")
+		get(s, "/1.0/identifiers/did:example:nobody", "192.0.2.10:1234")
+	}
+	if got := calls.Load() - before; got != 1 {
+		t.Errorf("got %d resolutions after cache fill, want 1 for the miss", got)
+	}
+
+	if strings.Contains(logs.String(), "alice") || strings.Contains(logs.String(), "192.0.2.10") {
+		t.Errorf("logs not anonymized:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "clientNet=192.0.2.0/24") {
+		t.Errorf("logs miss the client network:\n%s", logs.String())
+	}
+}
+
+func TestGatewayThrottle(t *testing.T) {
+	s := &Server{
+		Resolver: testResolver{},
+		Log:      slog.New(slog.NewTextHandler(new(bytes.Buffer), nil)),
+		Gateway:  Gateway{Enabled: true, Methods: []string{"example"}, RatePerClient: 1, Burst: 3},
+	}
+	var got []int
+	for i := 0; i < 4; i++ {
+		got = append(got, get(s, "/1.0/identifiers/did:example:alice", "198.51.100.7:999").Code)
+	}
+	if got[2] != http.StatusOK || got[3] != http.StatusTooManyRequests {
+		t.Errorf("got statuses %d, want burst of 3 then 429", got)
+	}
+	// other network
+	if rec := get(s, "/1.0/identifiers/did:example:alice", "203.0.113.1:999"); rec.Code != http.StatusOK {
+		t.Errorf("other client network got status %d", rec.Code)
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	s := &Server{Resolver: testResolver{}, Log: slog.New(slog.NewTextHandler(new(bytes.Buffer), nil))}
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"", http.StatusOK, backend.JSON},
+		{"*/*", http.StatusOK, backend.JSON},
+		{"application/json", http.StatusOK, backend.JSON},
+		{"application/did+ld+json", http.StatusOK, backend.LDJSON},
+		{"application/did+ld+json;q=0.9, application/did+json;q=0.5", http.StatusOK, backend.LDJSON},
+		{`application/ld+json; profile="https://w3id.org/did-resolution"`, http.StatusOK, ResultType},
+		{"application/*, application/did+json;q=0", http.StatusOK, backend.LDJSON},
+		{"application/did+cbor", http.StatusOK, backend.CBOR},
+		{"text/html", http.StatusNotAcceptable, ResultType},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/1.0/identifiers/did:example:alice", nil)
+		req.Header.Set("Accept", test.accept)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.status || rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("Accept %q got status %d with %q, want %d with %q", test.accept, rec.Code, rec.Header().Get("Content-Type"), test.status, test.contentType)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/1.0/identifiers/did:example:alice", nil)
+	req.Header.Set("Accept", backend.LDJSON)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if got, want := rec.Body.String(), `{"@context":"https://www.w3.org/ns/did/v1","id":"did:example:alice"}`; got != want {
+		t.Errorf("JSON-LD got %s, want %s", got, want)
+	}
+
+	req.Header.Set("Accept", ResultType)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var res struct {
+		Document   map[string]any         `json:"didDocument"`
+		DocMeta    backend.Meta           `json:"didDocumentMetadata"`
+		Resolution backend.ResolutionMeta `json:"didResolutionMetadata"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("resolution result %s: %s", rec.Body, err)
+	}
+	if res.Document["id"] != "did:example:alice" || res.DocMeta.Updated.IsZero() || res.Resolution.ContentType != backend.LDJSON {
+		t.Errorf("got resolution result %s", rec.Body)
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	s := &Server{Resolver: testResolver{}, Log: slog.New(slog.NewTextHandler(new(bytes.Buffer), nil))}
+	tests := []struct {
+		path string
+		code string
+	}{
+		{"/1.0/identifiers/did:example:bob", "notFound"},
+		{"/1.0/identifiers/did:example", "invalidDid"},
+		{"/1.0/identifiers/did:example:gone", ""},
+	}
+	for _, test := range tests {
+		rec := get(s, test.path, "")
+		var res struct {
+			Document   json.RawMessage        `json:"didDocument"`
+			Resolution backend.ResolutionMeta `json:"didResolutionMetadata"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Errorf("%s got body %q: %s", test.path, rec.Body, err)
+			continue
+		}
+		if res.Resolution.Error != test.code || string(res.Document) != "null" {
+			t.Errorf("%s got body %s, want error code %q", test.path, rec.Body, test.code)
+		}
+	}
+}
+
+func TestDereference(t *testing.T) {
+	const doc = `{
+		"id": "did:example:alice",
+		"verificationMethod": [{"id": "#key-1", "type": "Multikey", "controller": "did:example:alice"}],
+		"service": [{"id": "#agent", "type": "DIDCommMessaging", "serviceEndpoint": "https://agent.example.com/"}]
+	}`
+	s := &Server{
+		Resolver: backend.Resolve(func(did backend.DID) (*backend.Document, *backend.Meta, error) {
+			if did.SpecID != "alice" {
+				return nil, nil, backend.ErrNotFound
+			}
+			d := new(backend.Document)
+			err := json.Unmarshal([]byte(doc), d)
+			return d, nil, err
+		}),
+		Resources: func(_ context.Context, u *backend.URL, _ *backend.Document) (io.ReadCloser, error) {
+			if u.RawPath != "/readme" {
+				return nil, backend.ErrNotFound
+			}
+			return io.NopCloser(strings.NewReader("hello")), nil
+		},
+		Log: slog.New(slog.NewTextHandler(new(bytes.Buffer), nil)),
+	}
+
+	rec := get(s, "/1.0/identifiers/did:example:alice%23key-1", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"type":"Multikey"`) {
+		t.Errorf("method got status %d, body %s", rec.Code, rec.Body)
+	}
+	rec = get(s, "/1.0/identifiers/did:example:alice?service=agent&relativeRef=/inbox", "")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "https://agent.example.com/inbox" {
+		t.Errorf("service endpoint got status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = get(s, "/1.0/identifiers/did:example:alice/readme", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("resource got status %d, content type %q, body %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	for _, path := range []string{
+		"/1.0/identifiers/did:example:alice%23key-2",
+		"/1.0/identifiers/did:example:alice/other",
+		"/1.0/identifiers/did:example:bob%23key-1",
+	} {
+		if rec := get(s, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s got status %d, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+// Package httpserver exposes DID resolution and DID URL dereferencing over
+// HTTP, compatible with the Universal Resolver.
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/cbor"
+	"EncrypteDL/IDChain/Backend/dereference"
+)
+
+// Path is the resolution endpoint, as in the Universal Resolver.
+const Path = "/1.0/identifiers/"
+
+// ResultType is the “DID resolution result”, which has the DID document in
+// backend.LDJSON with the metadata of both the document and the resolution
+// process.
+const ResultType = `application/ld+json;profile="` + resultProfile + `"`
+
+const resultProfile = "https://w3id.org/did-resolution"
+
+// Server resolves DIDs, and it dereferences DID URLs, with GET on Path, conform
+// the HTTP binding of the DID Resolution specification. Multiple goroutines
+// may invoke methods on a Server simultaneously.
+type Server struct {
+	Resolver backend.Resolver
+
+	// Resources serves the paths of DID URLs, as dereference.Dereferencer
+	// does. The nil function makes all paths not found. Resources stream
+	// without the budgets of the Gateway.
+	Resources func(ctx context.Context, u *backend.URL, doc *backend.Document) (io.ReadCloser, error)
+
+	// Contexts are added to the "@context" of JSON-LD documents, as in
+	// backend.Document.LD.
+	Contexts []any
+
+	// Timeout limits resolution when positive. The Gateway has its own
+	// budget instead.
+	Timeout time.Duration
+
+	// Gateway applies the hardened mode when enabled.
+	Gateway Gateway
+
+	Log *slog.Logger // nil for slog.Default
+
+	// Tracer, when set, gets an "http.request" span for each request, with
+	// the status code and the body size, and with the spans of resolution
+	// nested.
+	Tracer backend.Tracer
+
+	setupOnce sync.Once
+	cache     *cache
+	limiter   *limiter
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return slog.Default()
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.setupOnce.Do(s.setup)
+	start := time.Now()
+	ctx := r.Context()
+	if s.Tracer != nil {
+		ctx = backend.WithTracer(ctx, s.Tracer)
+	}
+	ctx, span := backend.StartSpan(ctx, "http.request", slog.String("path", r.URL.Path))
+	r = r.WithContext(ctx)
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.serve(rec, r, start)
+	span.SetAttributes(slog.Int("status", rec.status), slog.Int64("bytes", rec.bytes))
+	span.End(nil)
+	s.logRequest(r, rec.status, time.Since(start))
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, start time.Time) {
+	if !strings.HasPrefix(r.URL.Path, Path) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Gateway.Enabled && !s.admit(w, r) {
+		return
+	}
+
+	// fragments arrive percent-encoded, if at all
+	raw, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), Path))
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: malformed path escape", backend.ErrInvalid), start)
+		return
+	}
+	if r.URL.RawQuery != "" {
+		raw += "?" + r.URL.RawQuery
+	}
+	u, err := backend.ParseURL(raw)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: %w", backend.ErrInvalid, err), start)
+		return
+	}
+	if u.IsRelative() {
+		s.writeError(w, fmt.Errorf("%w: relative DID URL", backend.ErrInvalid), start)
+		return
+	}
+	w.Header().Set("Vary", "Accept")
+	mediaType, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		s.writeError(w, fmt.Errorf("%w: want %s, %s, %s or %s", backend.ErrMediaType, backend.JSON, backend.LDJSON, backend.CBOR, ResultType), start)
+		return
+	}
+
+	if u.RawPath == "" && u.RawQuery == "" && u.RawFragment == "" {
+		s.serveDocument(w, r, u.DID, mediaType, start)
+	} else {
+		s.serveDereference(w, r, raw, mediaType, start)
+	}
+}
+
+func (s *Server) serveDocument(w http.ResponseWriter, r *http.Request, did backend.DID, mediaType string, start time.Time) {
+	doc, meta, err := s.resolve(r, did)
+	if err == nil && (mediaType == backend.LDJSON || mediaType == ResultType) {
+		doc, err = s.ld(doc)
+	}
+	if err != nil {
+		s.writeError(w, err, start)
+		return
+	}
+	body, err := represent(doc, meta, mediaType, start)
+	if err != nil {
+		s.writeError(w, err, start)
+		return
+	}
+
+	etag := entityTag(doc, mediaType)
+	w.Header().Set("ETag", etag)
+	var modified time.Time
+	if meta != nil && !meta.Updated.IsZero() {
+		modified = meta.Updated.UTC().Truncate(time.Second)
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	if s.Gateway.Enabled {
+		w.Header().Set("Cache-Control", "public, max-age="+s.Gateway.cacheMaxAge())
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeBody(w, r, mediaType, body)
+}
+
+func (s *Server) serveDereference(w http.ResponseWriter, r *http.Request, didURL, mediaType string, start time.Time) {
+	d := &dereference.Dereferencer{
+		Resolver:  s.Resolver,
+		Resources: s.Resources,
+		Timeout:   s.Timeout,
+	}
+	if s.Gateway.Enabled {
+		d.Resolver = gatewayResolver{s}
+	}
+	res, err := d.Dereference(r.Context(), didURL)
+	if err != nil {
+		s.writeError(w, err, start)
+		return
+	}
+
+	var content any
+	switch {
+	case res.Resource != nil:
+		s.stream(w, r, res.Resource, start)
+		return
+	case res.Endpoint != nil:
+		http.Redirect(w, r, res.Endpoint.String(), http.StatusSeeOther)
+		return
+	case res.Method != nil:
+		content = res.Method
+	case res.Service != nil:
+		content = res.Service
+	case mediaType == backend.LDJSON || mediaType == ResultType:
+		content = res.Document.LD(s.Contexts...)
+	default:
+		content = res.Document
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		s.writeError(w, err, start)
+		return
+	}
+	body, err := represent(raw, res.Meta, mediaType, start)
+	if err != nil {
+		s.writeError(w, err, start)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeBody(w, r, mediaType, body)
+}
+
+// Stream copies a DID URL resource, with its media type sniffed. Failures
+// after the header abort the response, such that clients can not mistake a
+// partial resource for a complete one.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, resource io.ReadCloser, start time.Time) {
+	defer resource.Close()
+	buf := bufio.NewReader(resource)
+	// early detection of hashlink mismatches on small resources
+	head, err := buf.Peek(512)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		s.writeError(w, err, start)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(head))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, buf); err != nil {
+		s.log().Warn("DID URL resource aborted", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Result is the “DID resolution result”.
+type result struct {
+	Document   json.RawMessage         `json:"didDocument"`
+	DocMeta    any                     `json:"didDocumentMetadata"`
+	Resolution *backend.ResolutionMeta `json:"didResolutionMetadata"`
+}
+
+// Represent returns a resolution outcome in mediaType, with the JSON of the
+// DID document (or any part of it) as raw.
+func represent(raw []byte, meta *backend.Meta, mediaType string, start time.Time) ([]byte, error) {
+	switch mediaType {
+	case backend.JSON:
+		return raw, nil
+	case backend.LDJSON:
+		return withContext(raw), nil
+	case backend.CBOR:
+		return cbor.FromJSON(raw)
+	}
+	if meta == nil {
+		meta = new(backend.Meta)
+	}
+	return json.Marshal(&result{
+		Document:   withContext(raw),
+		DocMeta:    meta,
+		Resolution: &backend.ResolutionMeta{ContentType: backend.LDJSON, Duration: time.Since(start)},
+	})
+}
+
+// EntityTag returns the validator of a DID document in mediaType. The hash
+// covers the document rather than its representation, as the resolution
+// result of ResultType has the duration of each request.
+func entityTag(doc []byte, mediaType string) string {
+	h := sha256.New()
+	h.Write([]byte(mediaType))
+	h.Write([]byte{0})
+	h.Write(doc)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// LD returns the JSON-LD of a JSON document.
+func (s *Server) ld(doc []byte) ([]byte, error) {
+	var d backend.Document
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	return json.Marshal(d.LD(s.Contexts...))
+}
+
+// WithContext inserts the "@context" of backend.V1 into a JSON object, unless
+// it has one already.
+func withContext(object []byte) []byte {
+	if len(object) < 2 || object[0] != '{' || bytes.HasPrefix(object, []byte(`{"@context"`)) {
+		return object
+	}
+	const member = `"@context":"` + backend.V1 + `"`
+	buf := make([]byte, 0, len(object)+len(member)+1)
+	buf = append(buf, '{')
+	buf = append(buf, member...)
+	if rest := bytes.TrimSpace(object[1:]); len(rest) != 0 && rest[0] != '}' {
+		buf = append(buf, ',')
+	}
+	return append(buf, object[1:]...)
+}
+
+func writeBody(w http.ResponseWriter, r *http.Request, mediaType string, body []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// ErrorStatus returns the error code with the HTTP status code for err.
+func errorStatus(err error) (code string, status int) {
+	switch {
+	case errors.Is(err, backend.ErrInvalid):
+		return "invalidDid", http.StatusBadRequest
+	case errors.Is(err, backend.ErrMediaType):
+		return "representationNotSupported", http.StatusNotAcceptable
+	case errors.Is(err, backend.ErrMethodNotSupported):
+		return "methodNotSupported", http.StatusNotImplemented
+	case errors.Is(err, backend.ErrNotFound):
+		return "notFound", http.StatusNotFound
+	case errors.Is(err, backend.ErrDeactivated):
+		// not an error by specification
+		return "", http.StatusGone
+	case errors.Is(err, errTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "internalError", http.StatusGatewayTimeout
+	case errors.Is(err, errSize):
+		return "internalError", http.StatusBadGateway
+	default:
+		return "internalError", http.StatusInternalServerError
+	}
+}
+
+// WriteError responds with a DID resolution result without document.
+func (s *Server) writeError(w http.ResponseWriter, err error, start time.Time) {
+	code, status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		s.log().Error("DID resolution failed", "error", err)
+	}
+	res := result{
+		DocMeta:    struct{}{},
+		Resolution: &backend.ResolutionMeta{Error: code, Duration: time.Since(start)},
+	}
+	if status == http.StatusGone {
+		res.DocMeta = map[string]bool{"deactivated": true}
+	}
+	body, _ := json.Marshal(&res)
+	w.Header().Set("Content-Type", ResultType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Negotiate returns the representation for an Accept header, conform RFC 9110,
+// subsection 12.5.1. Ties go to backend.JSON, then backend.LDJSON, and then
+// backend.CBOR. A plain JSON range selects backend.JSON.
+func negotiate(accept string) (mediaType string, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return backend.JSON, true
+	}
+	var bestQ float64
+	for _, offer := range [...]string{backend.JSON, backend.LDJSON, backend.CBOR, ResultType} {
+		// the most specific range applies
+		q, specificity := 0.0, 0
+		for _, s := range strings.Split(accept, ",") {
+			t, params, err := mime.ParseMediaType(s)
+			if err != nil {
+				continue
+			}
+			n := matchRange(t, params, offer)
+			if n <= specificity {
+				continue
+			}
+			specificity, q = n, 1
+			if v, ok := params["q"]; ok {
+				q, err = strconv.ParseFloat(v, 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > bestQ {
+			mediaType, bestQ = offer, q
+		}
+	}
+	return mediaType, bestQ > 0
+}
+
+// MatchRange returns the specificity of a media range match, with zero for no
+// match.
+func matchRange(t string, params map[string]string, offer string) int {
+	switch t {
+	case "*/*":
+		return 1
+	case "application/*":
+		return 2
+	case "application/json":
+		if offer == backend.JSON {
+			return 3
+		}
+	case backend.JSON, backend.LDJSON, backend.CBOR:
+		if t == offer {
+			return 3
+		}
+	case "application/ld+json":
+		if offer != ResultType {
+			return 0
+		}
+		profile, ok := params["profile"]
+		if !ok {
+			return 3
+		}
+		for _, p := range strings.Fields(profile) {
+			if p == resultProfile {
+				return 4
+			}
+		}
+	}
+	return 0
+}
+
+// NotModified evaluates the preconditions of RFC 9110, subsection 13.2.2.
+// If-Modified-Since applies only in the absence of If-None-Match.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/") // weak comparison
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.After(t)
+	}
+	return false
+}
+
+// Resolve returns the JSON encoding of the document.
+func (s *Server) resolve(r *http.Request, did backend.DID) ([]byte, *backend.Meta, error) {
+	if s.Gateway.Enabled {
+		return s.gatewayResolve(r.Context(), did)
+	}
+	doc, meta, _, err := backend.ResolveTimed(r.Context(), s.Resolver, did, s.Timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(doc)
+	return body, meta, err
+}
+
+func (s *Server) logRequest(r *http.Request, status int, d time.Duration) {
+	if s.Gateway.Enabled {
+		s.gatewayLog(r, status, d)
+		return
+	}
+	s.log().Info("DID resolution request", "path", r.URL.Path, "status", status, "duration", d, "remote", r.RemoteAddr)
+}
+
+// StatusRecorder captures the status code and the body size for logs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// Write implements the http.ResponseWriter interface.
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,311 @@
+// Package idchain implements the did:idchain method. Each DID has a log of
+// operations, which are signed and hash-linked. The method-specific identifier
+// is a hash of the genesis (“create”) operation, such that the identifier is
+// self-certifying. Resolution replays the log from the genesis on.
+//
+// The genesis document can not contain its own DID before the hash is known.
+// Instead, it uses Placeholder as the subject, and the placeholder is
+// substituted once the identifier is derived, like the SCID of did:tdw.
+package idchain
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/store"
+)
+
+// Method is the DID method name.
+const Method = "idchain"
+
+func init() {
+	backend.RegisterMethodSyntax(Method, checkSyntax)
+}
+
+// CheckSyntax requires the hash of a genesis entry.
+func checkSyntax(specID string) error {
+	if len(specID) != 52 || strings.Trim(specID, "abcdefghijklmnopqrstuvwxyz234567") != "" {
+		return fmt.Errorf("%w: did:idchain identifier %q is not a lower-case base32 SHA-256", backend.ErrInvalid, specID)
+	}
+	return nil
+}
+
+// Operation types
+const (
+	Create     = "create"
+	Update     = "update"
+	Deactivate = "deactivate"
+)
+
+// Relationship authorizes operations, i.e., the signing key of an operation
+// must be a capability invocation method in the document before it, or in
+// the document of the genesis itself.
+const Relationship = "capabilityInvocation"
+
+// EntryType is the JWS "typ" of log entries.
+const EntryType = "idchain-op+jws"
+
+// Placeholder is the subject of genesis documents before the identifier is
+// derived.
+var Placeholder = backend.DID{Method: Method, SpecID: "{SCID}"}
+
+// ErrLog signals an operation log which does not validate. The error wraps
+// backend.ErrInvalid.
+var ErrLog = fmt.Errorf("%w: did:idchain operation log", backend.ErrInvalid)
+
+// Operation is the payload of a log entry.
+type Operation struct {
+	Type string      `json:"type"`
+	DID  backend.DID `json:"did"`
+
+	// Previous is the Hash of the preceding entry, which is empty for the
+	// genesis only.
+	Previous string `json:"previous,omitempty"`
+
+	// Document is the content in effect after the operation. Deactivate
+	// has none.
+	Document *backend.Document `json:"didDocument,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+var hashEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Hash returns the lower-case base32 of the SHA-256 over data.
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return strings.ToLower(hashEncoding.EncodeToString(sum[:]))
+}
+
+// Hash returns the identifier of an entry, as referenced by the Previous of
+// its successor.
+func Hash(entry string) string {
+	return hash([]byte(entry))
+}
+
+// NewGenesis returns the create operation of doc, signed with the
+// verification method keyID, together with the DID derived. The subject of
+// doc must be Placeholder, and keyID must be a capability invocation method
+// of doc.
+func NewGenesis(doc *backend.Document, keyID *backend.URL, signer crypto.Signer, now time.Time) (entry string, did backend.DID, err error) {
+	if doc.Subject != Placeholder {
+		return "", backend.DID{}, fmt.Errorf("did:idchain genesis document has subject %s, want the placeholder", doc.Subject.String())
+	}
+	op := &Operation{Type: Create, DID: Placeholder, Document: doc, Time: now.UTC()}
+	payload, err := json.Marshal(op)
+	if err != nil {
+		return "", backend.DID{}, err
+	}
+	did = backend.DID{Method: Method, SpecID: hash(payload)}
+	payload = bytes.ReplaceAll(payload, []byte(Placeholder.String()), []byte(did.String()))
+
+	id := *keyID
+	if id.DID == Placeholder {
+		id.DID = did
+	}
+	entry, err = jose.Sign(jose.Header{Kid: id.String(), Typ: EntryType}, payload, signer)
+	if err != nil {
+		return "", backend.DID{}, err
+	}
+	return entry, did, nil
+}
+
+// NewUpdate returns an update operation with doc after prev, which is the
+// last entry in the log, signed with the verification method keyID.
+func NewUpdate(prev string, doc *backend.Document, keyID *backend.URL, signer crypto.Signer, now time.Time) (string, error) {
+	return sign(prev, &Operation{Type: Update, Document: doc, Time: now.UTC()}, keyID, signer)
+}
+
+// NewDeactivate returns a deactivate operation after prev, which is the last
+// entry in the log, signed with the verification method keyID.
+func NewDeactivate(prev string, keyID *backend.URL, signer crypto.Signer, now time.Time) (string, error) {
+	return sign(prev, &Operation{Type: Deactivate, Time: now.UTC()}, keyID, signer)
+}
+
+func sign(prev string, op *Operation, keyID *backend.URL, signer crypto.Signer) (string, error) {
+	_, prevOp, err := ParseEntry(prev)
+	if err != nil {
+		return "", err
+	}
+	op.DID = prevOp.DID
+	op.Previous = Hash(prev)
+	payload, err := json.Marshal(op)
+	if err != nil {
+		return "", err
+	}
+	return jose.Sign(jose.Header{Kid: keyID.String(), Typ: EntryType}, payload, signer)
+}
+
+// ParseEntry decodes an entry without verification.
+func ParseEntry(entry string) (*jose.JWS, *Operation, error) {
+	jws, err := jose.ParseCompact(entry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrLog, err)
+	}
+	if jws.Header.Typ != EntryType {
+		return nil, nil, fmt.Errorf("%w: entry of type %q", ErrLog, jws.Header.Typ)
+	}
+	op := new(Operation)
+	if err := json.Unmarshal(jws.Payload, op); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrLog, err)
+	}
+	return jws, op, nil
+}
+
+// Replay validates the log of did, and it returns each version. The last
+// version of a deactivated DID has the Deactivated metadata set, with the
+// document of its predecessor. The VersionID is the position in the log,
+// starting at "1".
+func Replay(did backend.DID, entries []string) ([]store.Version, error) {
+	if did.Method != Method {
+		return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s has no operations", backend.ErrNotFound, did.String())
+	}
+
+	var versions []store.Version
+	var current *backend.Document
+	var last time.Time
+	for i, entry := range entries {
+		jws, op, err := ParseEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("operation № %d: %w", i+1, err)
+		}
+		if !op.DID.Equal(did) {
+			return nil, fmt.Errorf("%w: operation № %d is for %s", ErrLog, i+1, op.DID.String())
+		}
+		if op.Time.Before(last) {
+			return nil, fmt.Errorf("%w: operation № %d precedes its predecessor in time", ErrLog, i+1)
+		}
+		last = op.Time
+
+		switch {
+		case i == 0:
+			if op.Type != Create || op.Previous != "" {
+				return nil, fmt.Errorf("%w: genesis is a %q operation", ErrLog, op.Type)
+			}
+			placeholder := bytes.ReplaceAll(jws.Payload, []byte(did.String()), []byte(Placeholder.String()))
+			if hash(placeholder) != did.SpecID {
+				return nil, fmt.Errorf("%w: genesis does not match %s", ErrLog, did.String())
+			}
+			// self-signed
+			current = op.Document
+		case !versions[len(versions)-1].Meta.Deactivated.IsZero():
+			return nil, fmt.Errorf("%w: operation № %d after deactivation", ErrLog, i+1)
+		case op.Previous != Hash(entries[i-1]):
+			return nil, fmt.Errorf("%w: operation № %d does not link to its predecessor", ErrLog, i+1)
+		case op.Type != Update && op.Type != Deactivate:
+			return nil, fmt.Errorf("%w: operation № %d of type %q", ErrLog, i+1, op.Type)
+		}
+		if op.Type != Deactivate && (op.Document == nil || !op.Document.Subject.Equal(did)) {
+			return nil, fmt.Errorf("%w: operation № %d has no document for %s", ErrLog, i+1, did.String())
+		}
+		if err := verify(current, jws); err != nil {
+			return nil, fmt.Errorf("%w: operation № %d: %w", ErrLog, i+1, err)
+		}
+
+		meta := &backend.Meta{VersionID: strconv.Itoa(i + 1)}
+		if i == 0 {
+			meta.Created = op.Time
+		} else {
+			meta.Created = versions[0].Meta.Created
+			meta.Updated = op.Time
+			versions[i-1].Meta.NextVersionID = meta.VersionID
+			versions[i-1].Meta.NextUpdate = op.Time
+		}
+		if op.Type == Deactivate {
+			meta.Deactivated = op.Time
+		} else {
+			current = op.Document
+		}
+		versions = append(versions, store.Version{Document: current, Meta: meta})
+	}
+	return versions, nil
+}
+
+// Verify checks the signature of jws against the authorized methods of doc.
+func verify(doc *backend.Document, jws *jose.JWS) error {
+	id, err := backend.ParseURL(jws.Header.Kid)
+	if err != nil {
+		return fmt.Errorf("signature key id: %w", err)
+	}
+	if id.IsRelative() {
+		id.DID = doc.Subject
+	}
+	m := doc.AuthorizedMethod(doc.Relationship(Relationship), id)
+	if m == nil {
+		return fmt.Errorf("no %s method %s in DID document", Relationship, id.String())
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return err
+	}
+	return jws.Verify(pub)
+}
+
+// Resolver resolves did:idchain identifiers from a Ledger.
+type Resolver struct {
+	Ledger Ledger
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *Resolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return r.ResolveVersion(ctx, did, "", time.Time{})
+}
+
+// ResolveVersion implements the backend.VersionResolver interface. A version
+// time selects the last operation at or before it. The replay of the operation
+// log is a "ledger.replay" span with the number of entries.
+func (r *Resolver) ResolveVersion(ctx context.Context, did backend.DID, versionID string, versionTime time.Time) (*backend.Document, *backend.Meta, error) {
+	if did.Method != Method {
+		return nil, nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, Method)
+	}
+	entries, err := r.Ledger.Entries(ctx, did)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, span := backend.StartSpan(ctx, "ledger.replay", slog.Int("entries", len(entries)))
+	versions, err := Replay(did, entries)
+	span.End(err)
+	if err != nil {
+		return nil, nil, err
+	}
+	if versionID == "" && versionTime.IsZero() {
+		v := versions[len(versions)-1]
+		return v.Document, v.Meta, nil
+	}
+	var match *store.Version
+	for i := range versions {
+		v := &versions[i]
+		if versionID != "" && v.Meta.VersionID != versionID {
+			continue
+		}
+		if !versionTime.IsZero() {
+			t := v.Meta.Updated
+			if t.IsZero() {
+				t = v.Meta.Created
+			}
+			if t.After(versionTime) {
+				continue
+			}
+		}
+		match = v
+	}
+	if match == nil {
+		return nil, nil, fmt.Errorf("%w: no such version of %s", backend.ErrNotFound, did.String())
+	}
+	return match.Document, match.Meta, nil
+}
@@ -0,0 +1,157 @@
+package idchain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/registrar"
+)
+
+func genesisDocument(t *testing.T, pub ed25519.PublicKey) (*backend.Document, *backend.URL) {
+	id := backend.URL{DID: Placeholder, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, Placeholder, pub, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &backend.Document{
+		Subject:              Placeholder,
+		VerificationMethods:  []*backend.VerificationMethod{m},
+		CapabilityInvocation: &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}},
+	}, &id
+}
+
+func TestReplay(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, keyID := genesisDocument(t, pub)
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	genesis, did, err := NewGenesis(doc, keyID, key, t0)
+	if err != nil {
+		t.Fatal("genesis error:", err)
+	}
+	if did.Method != Method || len(did.SpecID) != 52 {
+		t.Errorf("got DID %s", did.String())
+	}
+
+	versions, err := Replay(did, []string{genesis})
+	if err != nil {
+		t.Fatal("replay error:", err)
+	}
+	got := versions[0].Document
+	if !got.Subject.Equal(did) || !got.VerificationMethods[0].Controller.Equal(did) {
+		t.Errorf("placeholder not substituted in %+v", got)
+	}
+	keyID = &got.VerificationMethods[0].ID
+
+	updated := *got
+	updated.AlsoKnownAs = []string{"https://example.com"}
+	update, err := NewUpdate(genesis, &updated, keyID, key, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal("update error:", err)
+	}
+	deactivate, err := NewDeactivate(update, keyID, key, t0.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal("deactivate error:", err)
+	}
+	versions, err = Replay(did, []string{genesis, update, deactivate})
+	if err != nil {
+		t.Fatal("replay error:", err)
+	}
+	if len(versions) != 3 || len(versions[1].Document.AlsoKnownAs) != 1 {
+		t.Fatalf("got versions %+v", versions)
+	}
+	if m := versions[0].Meta; m.NextVersionID != "2" || !m.Created.Equal(t0) {
+		t.Errorf("first version got meta %+v", m)
+	}
+	if m := versions[2].Meta; !m.Deactivated.Equal(t0.Add(2 * time.Hour)) {
+		t.Errorf("last version got meta %+v", m)
+	}
+
+	if _, err := Replay(did, []string{genesis, deactivate}); !errors.Is(err, ErrLog) {
+		t.Errorf("replay with gap got error %v, want ErrLog", err)
+	}
+	other := backend.DID{Method: Method, SpecID: "aaaa"}
+	if _, err := Replay(other, []string{genesis}); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("replay for other DID got error %v, want ErrInvalid", err)
+	}
+
+	_, stranger, _ := ed25519.GenerateKey(rand.Reader)
+	forged, err := NewUpdate(genesis, &updated, keyID, stranger, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Replay(did, []string{genesis, forged}); !errors.Is(err, ErrLog) {
+		t.Errorf("replay with forged update got error %v, want ErrLog", err)
+	}
+}
+
+func TestRegistrar(t *testing.T) {
+	ctx := context.Background()
+	ledger := new(Memory)
+	r := &Registrar{Ledger: ledger, Keys: new(keystore.Memory)}
+
+	res, err := r.Create(ctx, new(registrar.CreateRequest))
+	if err != nil {
+		t.Fatal("create error:", err)
+	}
+	did := *res.State.DID
+	if res.State.Secret == nil || len(res.State.Secret.KeyRefs) != 1 {
+		t.Fatalf("create got secret %+v", res.State.Secret)
+	}
+
+	if _, err := r.Update(ctx, &registrar.UpdateRequest{DID: did, Document: &backend.Document{}}); err == nil {
+		t.Error("update without secret passed")
+	}
+	update := *res.State.Document
+	update.AlsoKnownAs = []string{"https://example.com"}
+	res, err = r.Update(ctx, &registrar.UpdateRequest{DID: did, Secret: res.State.Secret, Document: &update})
+	if err != nil {
+		t.Fatal("update error:", err)
+	}
+	if res.DocumentMeta.VersionID != "2" {
+		t.Errorf("update got meta %+v", res.DocumentMeta)
+	}
+
+	// relative key reference
+	refs, _ := r.Keys.List()
+	secret := &registrar.Secret{KeyRefs: map[string]string{"#key-1": refs[0]}}
+	if _, err := r.Deactivate(ctx, &registrar.DeactivateRequest{DID: did, Secret: secret}); err != nil {
+		t.Fatal("deactivate error:", err)
+	}
+
+	doc, meta, err := (&Resolver{Ledger: ledger}).Resolve(ctx, did)
+	if err != nil || meta.Deactivated.IsZero() || len(doc.AlsoKnownAs) != 1 {
+		t.Errorf("resolve got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+	_, meta, err = (&Resolver{Ledger: ledger}).ResolveVersion(ctx, did, "1", time.Time{})
+	if err != nil || meta.VersionID != "1" || meta.NextVersionID != "2" {
+		t.Errorf("resolve version 1 got meta %+v, error %v", meta, err)
+	}
+	if _, err := r.Deactivate(ctx, &registrar.DeactivateRequest{DID: did, Secret: secret}); !errors.Is(err, backend.ErrDeactivated) {
+		t.Errorf("second deactivate got error %v, want ErrDeactivated", err)
+	}
+}
+
+func TestMethodSyntax(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"did:idchain:" + strings.Repeat("a2", 26): true,
+		"did:idchain:" + strings.Repeat("a2", 25): false,
+		"did:idchain:" + strings.Repeat("A2", 26): false,
+		"did:idchain:" + strings.Repeat("a1", 26): false,
+	} {
+		err := backend.ValidateMethodSyntax(backend.MustParse(s))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, backend.ErrInvalid)) {
+			t.Errorf("%s got error %v", s, err)
+		}
+	}
+}
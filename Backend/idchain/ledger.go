@@ -0,0 +1,88 @@
+package idchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// ErrConflict signals a concurrent modification of an operation log.
+var ErrConflict = errors.New("did:idchain operation log changed concurrently")
+
+// Ledger is an append-only collection of operation logs. Implementations must
+// be safe for concurrent use.
+type Ledger interface {
+	// Entries returns the log of did, oldest first. Unknown DIDs get
+	// backend.ErrNotFound.
+	Entries(ctx context.Context, did backend.DID) ([]string, error)
+
+	// Append adds entry to the log of did, provided the log has n entries
+	// exactly. Otherwise, the error is ErrConflict.
+	Append(ctx context.Context, did backend.DID, n int, entry string) error
+}
+
+// Submit validates entry as the successor of the log it applies to, and it
+// appends the entry to l. The DID of the log is returned.
+func Submit(ctx context.Context, l Ledger, entry string) (backend.DID, error) {
+	_, op, err := ParseEntry(entry)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	did := op.DID
+	if did.Method != Method {
+		return backend.DID{}, fmt.Errorf("%w: entry for %s", ErrLog, did.String())
+	}
+	entries, err := l.Entries(ctx, did)
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		return backend.DID{}, err
+	}
+	if _, err := Replay(did, append(entries[:len(entries):len(entries)], entry)); err != nil {
+		return backend.DID{}, err
+	}
+	return did, l.Append(ctx, did, len(entries), entry)
+}
+
+// Memory is a volatile Ledger. The zero value is ready to use.
+type Memory struct {
+	mutex sync.RWMutex
+	logs  map[backend.DID][]string
+}
+
+// Entries implements the Ledger interface.
+func (l *Memory) Entries(_ context.Context, did backend.DID) ([]string, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	entries, ok := l.logs[did]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not on ledger", backend.ErrNotFound, did.String())
+	}
+	return entries[:len(entries):len(entries)], nil
+}
+
+// Append implements the Ledger interface.
+func (l *Memory) Append(_ context.Context, did backend.DID, n int, entry string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.logs[did]) != n {
+		return fmt.Errorf("%w: %s has %d entries, not %d", ErrConflict, did.String(), len(l.logs[did]), n)
+	}
+	if l.logs == nil {
+		l.logs = make(map[backend.DID][]string)
+	}
+	l.logs[did] = append(l.logs[did], entry)
+	return nil
+}
+
+// DIDs returns each DID on the ledger in no particular order.
+func (l *Memory) DIDs() []backend.DID {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	dids := make([]backend.DID, 0, len(l.logs))
+	for did := range l.logs {
+		dids = append(dids, did)
+	}
+	return dids
+}
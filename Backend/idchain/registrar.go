@@ -0,0 +1,214 @@
+package idchain
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/registrar"
+)
+
+// Registrar submits operations to a Ledger. Operations are signed with a key
+// from the keystore, which is either generated on Create, or selected from the
+// key references in the request secret.
+type Registrar struct {
+	Ledger Ledger
+	Keys   keystore.KeyStore
+
+	// KeyType defaults to keystore.Ed25519.
+	KeyType keystore.KeyType
+}
+
+// Create implements the registrar.Registrar interface. Documents without
+// verification methods get a key generated. Otherwise, the secret must
+// reference a capability invocation key of the document.
+func (r *Registrar) Create(ctx context.Context, req *registrar.CreateRequest) (*registrar.Result, error) {
+	if req.JobID != "" {
+		return nil, fmt.Errorf("%w: %q", registrar.ErrJob, req.JobID)
+	}
+	if req.DID != nil {
+		return nil, fmt.Errorf("%w: did:idchain identifiers are derived", registrar.ErrNotSupported)
+	}
+
+	doc := new(backend.Document)
+	if req.Document != nil {
+		*doc = *req.Document
+	}
+	doc.Subject = Placeholder
+	var keyID *backend.URL
+	var signer crypto.Signer
+	var newRef string // generated key, if any
+	if len(doc.VerificationMethods) == 0 {
+		var err error
+		keyID, signer, newRef, err = r.provision(doc)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		keyID, signer, err = r.signer(doc, req.Secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry, did, err := NewGenesis(doc, keyID, signer, time.Now())
+	if err == nil {
+		_, err = Submit(ctx, r.Ledger, entry)
+	}
+	if err != nil {
+		if newRef != "" {
+			r.Keys.Delete(newRef)
+		}
+		return nil, err
+	}
+	var secret *registrar.Secret
+	if newRef != "" {
+		id := backend.URL{DID: did, RawFragment: keyID.RawFragment}
+		secret = &registrar.Secret{KeyRefs: map[string]string{id.String(): newRef}}
+	}
+	return r.result(ctx, did, secret)
+}
+
+// Provision adds a new key to doc as "#key-1", for authentication, assertions
+// and capability invocation.
+func (r *Registrar) provision(doc *backend.Document) (*backend.URL, crypto.Signer, string, error) {
+	keyType := r.KeyType
+	if keyType == "" {
+		keyType = keystore.Ed25519
+	}
+	ref, pub, err := r.Keys.Create(keyType)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	id := backend.URL{DID: doc.Subject, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, doc.Subject, pub, keys.Multikey)
+	if err == nil {
+		var signer crypto.Signer
+		signer, err = r.Keys.Signer(ref)
+		if err == nil {
+			relationship := &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}}
+			doc.VerificationMethods = []*backend.VerificationMethod{m}
+			doc.Authentication = relationship
+			doc.AssertionMethod = relationship
+			doc.CapabilityInvocation = relationship
+			return &id, signer, ref, nil
+		}
+	}
+	r.Keys.Delete(ref)
+	return nil, nil, "", err
+}
+
+// Update implements the registrar.Registrar interface. The secret must
+// reference a capability invocation key of the current document.
+func (r *Registrar) Update(ctx context.Context, req *registrar.UpdateRequest) (*registrar.Result, error) {
+	if req.JobID != "" {
+		return nil, fmt.Errorf("%w: %q", registrar.ErrJob, req.JobID)
+	}
+	last, current, err := r.current(ctx, req.DID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := registrar.Apply(current, req)
+	if err != nil {
+		return nil, err
+	}
+	keyID, signer, err := r.signer(current, req.Secret)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := NewUpdate(last, doc, keyID, signer, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Submit(ctx, r.Ledger, entry); err != nil {
+		return nil, err
+	}
+	return r.result(ctx, req.DID, nil)
+}
+
+// Deactivate implements the registrar.Registrar interface. The secret must
+// reference a capability invocation key of the current document.
+func (r *Registrar) Deactivate(ctx context.Context, req *registrar.DeactivateRequest) (*registrar.Result, error) {
+	if req.JobID != "" {
+		return nil, fmt.Errorf("%w: %q", registrar.ErrJob, req.JobID)
+	}
+	last, current, err := r.current(ctx, req.DID)
+	if err != nil {
+		return nil, err
+	}
+	keyID, signer, err := r.signer(current, req.Secret)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := NewDeactivate(last, keyID, signer, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Submit(ctx, r.Ledger, entry); err != nil {
+		return nil, err
+	}
+	return r.result(ctx, req.DID, nil)
+}
+
+// Current returns the last entry and the document in effect.
+func (r *Registrar) current(ctx context.Context, did backend.DID) (last string, doc *backend.Document, err error) {
+	entries, err := r.Ledger.Entries(ctx, did)
+	if err != nil {
+		return "", nil, err
+	}
+	versions, err := Replay(did, entries)
+	if err != nil {
+		return "", nil, err
+	}
+	v := versions[len(versions)-1]
+	if !v.Meta.Deactivated.IsZero() {
+		return "", nil, fmt.Errorf("%w: %s", backend.ErrDeactivated, did.String())
+	}
+	return entries[len(entries)-1], v.Document, nil
+}
+
+// Signer returns the first key from secret which is authorized in doc.
+func (r *Registrar) signer(doc *backend.Document, secret *registrar.Secret) (*backend.URL, crypto.Signer, error) {
+	if secret != nil {
+		for s, ref := range secret.KeyRefs {
+			id, err := backend.ParseURL(s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("secret key reference: %w", err)
+			}
+			if id.IsRelative() {
+				id.DID = doc.Subject
+			}
+			if doc.AuthorizedMethod(doc.Relationship(Relationship), id) == nil {
+				continue
+			}
+			signer, err := r.Keys.Signer(ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			return id, signer, nil
+		}
+	}
+	return nil, nil, errors.New("did:idchain operation needs a secret with a capability invocation key")
+}
+
+func (r *Registrar) result(ctx context.Context, did backend.DID, secret *registrar.Secret) (*registrar.Result, error) {
+	doc, meta, err := (&Resolver{Ledger: r.Ledger}).Resolve(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	return &registrar.Result{
+		State: registrar.State{
+			State:    registrar.Finished,
+			DID:      &did,
+			Secret:   secret,
+			Document: doc,
+		},
+		DocumentMeta: meta,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package backend
+
+// Index is a lookup table for the verification methods and the services of a
+// Document, as built by Document.Index. The identifiers resolve against the
+// Subject, and they compare in their Canonical form. An Index does not follow
+// changes to its document. Multiple goroutines may invoke methods on an Index
+// simultaneously.
+type Index struct {
+	subject  DID
+	methods  map[string]*VerificationMethod // by key
+	services map[string]*Service            // by key
+
+	// authorized has the AuthorizedMethod of each relationship
+	authorized map[string]map[string]*VerificationMethod // by name, by key
+}
+
+// relationshipNames are the properties of the verification relationships.
+var relationshipNames = [...]string{
+	"authentication",
+	"assertionMethod",
+	"keyAgreement",
+	"capabilityInvocation",
+	"capabilityDelegation",
+}
+
+// Index returns the lookup table of doc, which makes repeated lookups O(1)
+// instead of scans. The first occurrence wins on duplicate identifiers, as
+// with Methods order.
+func (doc *Document) Index() *Index {
+	x := &Index{
+		subject:    doc.Subject,
+		methods:    make(map[string]*VerificationMethod),
+		services:   make(map[string]*Service, len(doc.Services)),
+		authorized: make(map[string]map[string]*VerificationMethod, len(relationshipNames)),
+	}
+	// listed ones are eligible for references from relationships
+	listed := make(map[string]*VerificationMethod, len(doc.VerificationMethods))
+	for _, m := range doc.VerificationMethods {
+		key := x.key(&m.ID)
+		if _, ok := listed[key]; !ok {
+			listed[key] = m
+		}
+	}
+	for _, m := range doc.Methods() {
+		key := x.key(&m.ID)
+		if _, ok := x.methods[key]; !ok {
+			x.methods[key] = m
+		}
+	}
+
+	for _, name := range relationshipNames {
+		r := doc.Relationship(name)
+		if r == nil {
+			continue
+		}
+		authorized := make(map[string]*VerificationMethod, len(r.Methods)+len(r.URIRefs))
+		for _, m := range r.Methods {
+			key := x.key(&m.ID)
+			if _, ok := authorized[key]; !ok {
+				authorized[key] = m
+			}
+		}
+		for _, ref := range r.URIRefs {
+			key := x.key(ref)
+			if _, ok := authorized[key]; ok {
+				continue
+			}
+			if m, ok := listed[key]; ok {
+				authorized[key] = m
+			}
+		}
+		x.authorized[name] = authorized
+	}
+
+	for _, srv := range doc.Services {
+		id, err := ParseURL(srv.ID.String())
+		if err != nil {
+			continue // invalid
+		}
+		key := x.key(id)
+		if _, ok := x.services[key]; !ok {
+			x.services[key] = srv
+		}
+	}
+	return x
+}
+
+// Key returns the Canonical of id, with relative identifiers resolved against
+// the subject.
+func (x *Index) key(id *URL) string {
+	if id.IsRelative() {
+		resolved := *id // copy
+		resolved.DID = x.subject
+		return resolved.Canonical()
+	}
+	return id.Canonical()
+}
+
+// Method returns the verification method with id, which may be relative to
+// the Subject, e.g., "#key-1". Methods embedded in verification relationships
+// are included. The return is nil when not found.
+func (x *Index) Method(id *URL) *VerificationMethod {
+	return x.methods[x.key(id)]
+}
+
+// Service returns the service with id, which may be relative to the Subject.
+// The return is nil when not found.
+func (x *Index) Service(id *URL) *Service {
+	return x.services[x.key(id)]
+}
+
+// AuthorizedMethod returns the verification method with id, granted it is
+// authorized by the verification relationship with name, e.g.,
+// "authentication", like Document.AuthorizedMethod does. The return is nil
+// when not found, and for unknown names.
+func (x *Index) AuthorizedMethod(name string, id *URL) *VerificationMethod {
+	return x.authorized[name][x.key(id)]
+}
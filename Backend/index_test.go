@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const indexDoc = `{
+	"id": "did:example:123",
+	"verificationMethod": [{
+		"id": "did:example:123#key-0",
+		"type": "Multikey",
+		"controller": "did:example:123",
+		"publicKeyMultibase": "z6MkqRYqQiSgvZQdnBytw86Qbs2ZWUkGv22od935YF4s8M7V"
+	}, {
+		"id": "#key-2",
+		"type": "Multikey",
+		"controller": "did:example:123",
+		"publicKeyMultibase": "z6MkgoLTnTypo3tDRwCkZXSccTPHRLhF4ZnjhueYAFpEX6vg"
+	}],
+	"authentication": [
+		"#key-0",
+		{
+			"id": "did:example:123#key-1",
+			"type": "Multikey",
+			"controller": "did:example:123",
+			"publicKeyMultibase": "z6MkgoLTnTypo3tDRwCkZXSccTPHRLhF4ZnjhueYAFpEX6vg"
+		}
+	],
+	"assertionMethod": ["did:example:123#key-2", "did:example:123#key-9"],
+	"service": [
+		{"id": "#files", "type": "LinkedDomains", "serviceEndpoint": "https://files.example.com/"},
+		{"id": "did:example:123#agent", "type": "DIDCommMessaging", "serviceEndpoint": "https://agent.example.com/"}
+	]
+}`
+
+func TestDocumentIndex(t *testing.T) {
+	var doc Document
+	if err := json.Unmarshal([]byte(indexDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	x := doc.Index()
+
+	methods := []struct {
+		id   string
+		want int // index in Methods, or -1 for none
+	}{
+		{"did:example:123#key-0", 0},
+		{"#key-0", 0},
+		{"did:example:123#%6Bey-0", 0},
+		{"did:example:123#key-2", 1},
+		{"#key-2", 1},
+		{"did:example:123#key-1", 2},
+		{"did:example:456#key-0", -1},
+		{"did:example:123#key-9", -1},
+	}
+	all := doc.Methods()
+	for _, test := range methods {
+		got := x.Method(MustParseURL(test.id))
+		switch {
+		case test.want < 0 && got != nil:
+			t.Errorf("%s got method %s, want none", test.id, got.ID.String())
+		case test.want >= 0 && got != all[test.want]:
+			t.Errorf("%s got method %v, want %s", test.id, got, all[test.want].ID.String())
+		}
+	}
+
+	authorized := []struct {
+		relationship, id string
+		want             bool
+	}{
+		{"authentication", "did:example:123#key-0", true},
+		{"authentication", "did:example:123#key-1", true},
+		{"authentication", "did:example:123#key-2", false},
+		{"assertionMethod", "#key-2", true},
+		{"assertionMethod", "did:example:123#key-1", false}, // embedded elsewhere
+		{"assertionMethod", "did:example:123#key-9", false}, // not present
+		{"keyAgreement", "did:example:123#key-0", false},
+		{"unknown", "did:example:123#key-0", false},
+	}
+	for _, test := range authorized {
+		id := MustParseURL(test.id)
+		got := x.AuthorizedMethod(test.relationship, id)
+		if (got != nil) != test.want {
+			t.Errorf("%s of %s got %v, want authorized %t", test.id, test.relationship, got, test.want)
+		}
+		if !id.IsRelative() && got != doc.AuthorizedMethod(doc.Relationship(test.relationship), id) {
+			t.Errorf("%s of %s differs from Document.AuthorizedMethod", test.id, test.relationship)
+		}
+	}
+
+	if srv := x.Service(MustParseURL("did:example:123#files")); srv != doc.Services[0] {
+		t.Errorf("relative service got %v", srv)
+	}
+	if srv := x.Service(MustParseURL("#agent")); srv != doc.Services[1] {
+		t.Errorf("absolute service got %v", srv)
+	}
+	if srv := x.Service(MustParseURL("#none")); srv != nil {
+		t.Errorf("unknown service got %v", srv)
+	}
+}
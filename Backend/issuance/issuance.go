@@ -0,0 +1,304 @@
+// Package issuance signs verifiable credentials in bulk. Credentials follow
+// the W3C data model 1.1, with the JWT encoding from section 6.3.1.
+package issuance
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// V1 is the base context of credentials.
+const V1 = "https://www.w3.org/2018/credentials/v1"
+
+// Credential is a verifiable credential, without proof.
+type Credential struct {
+	Context        []string       `json:"@context"`
+	ID             string         `json:"id,omitempty"`
+	Types          []string       `json:"type"`
+	Issuer         string         `json:"issuer"`
+	IssuanceDate   time.Time      `json:"issuanceDate"`
+	ExpirationDate *time.Time     `json:"expirationDate,omitempty"`
+	Subject        map[string]any `json:"credentialSubject"`
+	Status         *Status        `json:"credentialStatus,omitempty"`
+}
+
+// Status is a “StatusList2021Entry”.
+type Status struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	StatusPurpose        string `json:"statusPurpose"`
+	StatusListIndex      string `json:"statusListIndex"`
+	StatusListCredential string `json:"statusListCredential"`
+}
+
+// Template is the base of each credential in a run.
+type Template struct {
+	// Types are added to "VerifiableCredential".
+	Types []string `json:"type"`
+	// Contexts are added to V1.
+	Contexts []string `json:"@context,omitempty"`
+
+	// Claims apply to each subject. Subject claims take precedence.
+	Claims map[string]any `json:"claims,omitempty"`
+
+	// Validity sets the expiry, if any.
+	Validity time.Duration `json:"validity,omitempty"`
+
+	// StatusList is the URL of a status list credential. When set, each
+	// credential gets an index from the Issuer StatusAllocator.
+	StatusList    string `json:"statusList,omitempty"`
+	StatusPurpose string `json:"statusPurpose,omitempty"` // default "revocation"
+}
+
+// Subject is the input per credential.
+type Subject struct {
+	ID     string         `json:"id,omitempty"` // e.g., a DID
+	Claims map[string]any `json:"claims"`
+}
+
+// Iterator yields subjects until io.EOF.
+type Iterator interface {
+	Next() (*Subject, error)
+}
+
+// List is an Iterator over a slice.
+type List struct {
+	Subjects []Subject
+	i        int
+}
+
+// Next implements the Iterator interface.
+func (l *List) Next() (*Subject, error) {
+	if l.i >= len(l.Subjects) {
+		return nil, io.EOF
+	}
+	l.i++
+	return &l.Subjects[l.i-1], nil
+}
+
+// Decoder is an Iterator over a stream of JSON subjects, e.g., JSON Lines.
+type Decoder struct {
+	*json.Decoder
+}
+
+// NewDecoder returns a new Iterator which reads from r.
+func NewDecoder(r io.Reader) Decoder {
+	return Decoder{json.NewDecoder(r)}
+}
+
+// Next implements the Iterator interface.
+func (d Decoder) Next() (*Subject, error) {
+	s := new(Subject)
+	if err := d.Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StatusAllocator reserves status list indices.
+type StatusAllocator interface {
+	// Allocate reserves n consecutive indices, and it returns the first.
+	Allocate(ctx context.Context, n int) (first int, err error)
+}
+
+// Counter is an in-memory StatusAllocator.
+type Counter struct {
+	next atomic.Int64
+}
+
+// Allocate implements the StatusAllocator interface.
+func (c *Counter) Allocate(ctx context.Context, n int) (int, error) {
+	return int(c.next.Add(int64(n)) - int64(n)), nil
+}
+
+// Result is the outcome per subject.
+type Result struct {
+	Seq     int    // position in the input, zero-based
+	Subject string // ID, if any
+	JWT     string // credential
+	Status  int    // list index, or -1 for none
+	Err     error
+}
+
+// Issuer signs credentials with a worker pool.
+type Issuer struct {
+	// KeyID is the DID URL of an assertion method of the issuer.
+	KeyID  backend.URL
+	Signer crypto.Signer
+
+	Workers int // default GOMAXPROCS
+
+	Status StatusAllocator // required for templates with a StatusList
+	// StatusBatch is the number of indices per allocation. Unused indices
+	// of the last batch are lost. Default 1.
+	StatusBatch int
+}
+
+// Job is a unit of work.
+type job struct {
+	seq     int
+	subject *Subject
+	status  int
+}
+
+// Issue signs a credential per subject. Results stream in order of
+// completion, and the channel closes once all subjects are done. Callers must
+// receive until then. Errors of the iterator or of the status allocation end
+// the run, with a final Result for the error.
+func (iss *Issuer) Issue(ctx context.Context, t *Template, subjects Iterator) <-chan Result {
+	workers := iss.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	jobs := make(chan job, workers)
+	results := make(chan Result, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := Result{Seq: j.seq, Subject: j.subject.ID, Status: j.status}
+				r.JWT, r.Err = iss.sign(t, j.subject, j.status)
+				results <- r
+			}
+		}()
+	}
+
+	go func() {
+		seq, err := iss.feed(ctx, t, subjects, jobs)
+		close(jobs)
+		wg.Wait()
+		if err != nil {
+			results <- Result{Seq: seq, Status: -1, Err: err}
+		}
+		close(results)
+	}()
+	return results
+}
+
+// Feed submits jobs until the end of subjects.
+func (iss *Issuer) feed(ctx context.Context, t *Template, subjects Iterator, jobs chan<- job) (seq int, err error) {
+	batch := iss.StatusBatch
+	if batch <= 0 {
+		batch = 1
+	}
+	var next, end int // allocated indices
+	for ; ; seq++ {
+		s, err := subjects.Next()
+		if err == io.EOF {
+			return seq, nil
+		}
+		if err != nil {
+			return seq, fmt.Errorf("credential subject № %d: %w", seq+1, err)
+		}
+
+		status := -1
+		if t.StatusList != "" {
+			if iss.Status == nil {
+				return seq, errors.New("template with status list needs a StatusAllocator")
+			}
+			if next == end {
+				next, err = iss.Status.Allocate(ctx, batch)
+				if err != nil {
+					return seq, fmt.Errorf("status list allocation: %w", err)
+				}
+				end = next + batch
+			}
+			status = next
+			next++
+		}
+
+		select {
+		case jobs <- job{seq, s, status}:
+		case <-ctx.Done():
+			return seq, ctx.Err()
+		}
+	}
+}
+
+// Sign returns the JWT for a subject.
+func (iss *Issuer) sign(t *Template, s *Subject, status int) (string, error) {
+	now := time.Now()
+	id, err := uuidURN()
+	if err != nil {
+		return "", err
+	}
+	c := Credential{
+		Context:      append([]string{V1}, t.Contexts...),
+		ID:           id,
+		Types:        append([]string{"VerifiableCredential"}, t.Types...),
+		Issuer:       iss.KeyID.DID.String(),
+		IssuanceDate: now.UTC().Truncate(time.Second),
+		Subject:      make(map[string]any, len(t.Claims)+len(s.Claims)+1),
+	}
+	for k, v := range t.Claims {
+		c.Subject[k] = v
+	}
+	for k, v := range s.Claims {
+		c.Subject[k] = v
+	}
+	if s.ID != "" {
+		c.Subject["id"] = s.ID
+	}
+
+	claims := map[string]any{
+		"iss": c.Issuer,
+		"nbf": now.Unix(),
+		"jti": c.ID,
+	}
+	if s.ID != "" {
+		claims["sub"] = s.ID
+	}
+	if t.Validity > 0 {
+		expires := c.IssuanceDate.Add(t.Validity)
+		c.ExpirationDate = &expires
+		claims["exp"] = expires.Unix()
+	}
+	if status >= 0 {
+		purpose := t.StatusPurpose
+		if purpose == "" {
+			purpose = "revocation"
+		}
+		index := strconv.Itoa(status)
+		c.Status = &Status{
+			ID:                   t.StatusList + "#" + index,
+			Type:                 "StatusList2021Entry",
+			StatusPurpose:        purpose,
+			StatusListIndex:      index,
+			StatusListCredential: t.StatusList,
+		}
+	}
+	claims["vc"] = &c
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("credential of %q: %w", s.ID, err)
+	}
+	return jose.Sign(jose.Header{Kid: iss.KeyID.String(), Typ: "JWT"}, payload, iss.Signer)
+}
+
+// UUIDURN returns a random (version 4) UUID URN.
+func uuidURN() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
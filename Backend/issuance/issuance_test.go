@@ -0,0 +1,132 @@
+package issuance
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// CountingAllocator records the number of allocations.
+type countingAllocator struct {
+	Counter
+	calls int
+}
+
+func (c *countingAllocator) Allocate(ctx context.Context, n int) (int, error) {
+	c.calls++ // single feeder
+	return c.Counter.Allocate(ctx, n)
+}
+
+func TestIssue(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alloc countingAllocator
+	iss := &Issuer{
+		KeyID:       backend.URL{DID: backend.DID{Method: "example", SpecID: "issuer"}, RawFragment: "#assert-1"},
+		Signer:      key,
+		Workers:     4,
+		Status:      &alloc,
+		StatusBatch: 100,
+	}
+	tmpl := &Template{
+		Types:      []string{"EmployeeCredential"},
+		Claims:     map[string]any{"employer": "ACME"},
+		StatusList: "https://issuer.example/status/1",
+	}
+
+	const n = 1000
+	subjects := make([]Subject, n)
+	for i := range subjects {
+		subjects[i] = Subject{
+			ID:     "did:example:" + strconv.Itoa(i),
+			Claims: map[string]any{"employeeNumber": i},
+		}
+	}
+	subjects[7].Claims["bad"] = make(chan int) // not JSON
+
+	seen := make(map[int]bool)
+	indices := make(map[int]bool)
+	var failed []int
+	for r := range iss.Issue(context.Background(), tmpl, &List{Subjects: subjects}) {
+		if seen[r.Seq] {
+			t.Fatalf("sequence № %d got more than one result", r.Seq)
+		}
+		seen[r.Seq] = true
+		if indices[r.Status] {
+			t.Errorf("status index %d issued twice", r.Status)
+		}
+		indices[r.Status] = true
+		if r.Err != nil {
+			failed = append(failed, r.Seq)
+			continue
+		}
+		if r.Seq != 42 {
+			continue
+		}
+
+		jws, err := jose.ParseCompact(r.JWT)
+		if err != nil {
+			t.Fatal("credential parse error:", err)
+		}
+		if err := jws.Verify(pub); err != nil {
+			t.Error("credential signature error:", err)
+		}
+		var claims struct {
+			Sub string     `json:"sub"`
+			VC  Credential `json:"vc"`
+		}
+		if err := json.Unmarshal(jws.Payload, &claims); err != nil {
+			t.Fatal("credential payload:", err)
+		}
+		if claims.Sub != "did:example:42" || claims.VC.Subject["employer"] != "ACME" || claims.VC.Subject["employeeNumber"] != 42.0 {
+			t.Errorf("got claims %+v", claims)
+		}
+		if got := claims.VC.Types; len(got) != 2 || got[1] != "EmployeeCredential" {
+			t.Errorf("got types %q", got)
+		}
+		if claims.VC.Status == nil || claims.VC.Status.StatusListIndex != strconv.Itoa(r.Status) {
+			t.Errorf("got status %+v, want index %d", claims.VC.Status, r.Status)
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("got %d results, want %d", len(seen), n)
+	}
+	if len(failed) != 1 || failed[0] != 7 {
+		t.Errorf("got failures for %v, want [7]", failed)
+	}
+	if alloc.calls != n/100 {
+		t.Errorf("got %d status allocations, want %d", alloc.calls, n/100)
+	}
+}
+
+func TestIssueDecoderError(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	iss := &Issuer{KeyID: backend.URL{DID: backend.DID{Method: "example", SpecID: "issuer"}, RawFragment: "#k"}, Signer: key}
+	in := NewDecoder(strings.NewReader(`{"id":"did:example:a","claims":{}}
+{"id":"did:example:b","claims":{}}
+{"id":`))
+	var ok int
+	var last Result
+	for r := range iss.Issue(context.Background(), &Template{}, in) {
+		if r.Err == nil {
+			ok++
+		} else {
+			last = r
+		}
+	}
+	if ok != 2 {
+		t.Errorf("got %d credentials, want 2", ok)
+	}
+	if last.Err == nil || last.Seq != 2 {
+		t.Errorf("got final result %+v, want decode error at sequence № 2", last)
+	}
+}
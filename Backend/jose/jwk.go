@@ -0,0 +1,240 @@
+// Package jose provides the subset of JSON Object Signing and Encryption in
+// use with DID verification methods.
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// JWK is a JSON Web Key, limited to public key material.
+type JWK struct {
+	Kty string `json:"kty"`           // required
+	Crv string `json:"crv,omitempty"` // for EC and OKP
+	X   string `json:"x,omitempty"`   // base64url encoded
+	Y   string `json:"y,omitempty"`   // base64url encoded
+
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// ErrKeyType signals an unsupported (or malformed) kind of key.
+var ErrKeyType = errors.New("unsupported key type")
+
+// PublicKey returns the Go representation of k, which is either an
+// ed25519.PublicKey, an X25519 *ecdh.PublicKey, or an *ecdsa.PublicKey.
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "OKP":
+		switch k.Crv {
+		case "Ed25519":
+			break
+		case "X25519":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("JWK X25519 \"x\": %w", err)
+			}
+			pub, err := ecdh.X25519().NewPublicKey(x)
+			if err != nil {
+				return nil, fmt.Errorf("JWK X25519 \"x\": %w", err)
+			}
+			return pub, nil
+		default:
+			return nil, fmt.Errorf("%w: JWK OKP curve %q", ErrKeyType, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("JWK Ed25519 \"x\": %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWK Ed25519 \"x\" has %d bytes, want %d", len(x), ed25519.PublicKeySize)
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: JWK EC curve %q", ErrKeyType, k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("JWK EC \"x\": %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("JWK EC \"y\": %w", err)
+		}
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("JWK %s coordinates have %d and %d bytes, want %d", k.Crv, len(x), len(y), size)
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("JWK %s point not on curve", k.Crv)
+		}
+		return pub, nil
+
+	default:
+		return nil, fmt.Errorf("%w: JWK kty %q", ErrKeyType, k.Kty)
+	}
+}
+
+// NewJWK returns the JSON Web Key of pub, which is either an
+// ed25519.PublicKey, an X25519 *ecdh.PublicKey, or an *ecdsa.PublicKey.
+func NewJWK(pub crypto.PublicKey) (*JWK, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, nil
+
+	case *ecdh.PublicKey:
+		if pub.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("%w: ECDH curve %s", ErrKeyType, pub.Curve())
+		}
+		return &JWK{
+			Kty: "OKP",
+			Crv: "X25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub.Bytes()),
+		}, nil
+
+	case *ecdsa.PublicKey:
+		var crv string
+		switch pub.Curve {
+		case elliptic.P256():
+			crv = "P-256"
+		case elliptic.P384():
+			crv = "P-384"
+		case elliptic.P521():
+			crv = "P-521"
+		default:
+			return nil, fmt.Errorf("%w: ECDSA curve %s", ErrKeyType, pub.Curve.Params().Name)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: crv,
+			X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: Go type %T", ErrKeyType, pub)
+	}
+}
+
+// Thumbprint returns the JWK Thumbprint of k, conform RFC 7638, with SHA-256
+// in base64url encoding. The value is suitable as a key identifier, and as a
+// fragment in verification method ids.
+func (k *JWK) Thumbprint() (string, error) {
+	// “The required members for an elliptic curve public key are … "crv",
+	// "kty", "x", "y"”, and for octet key pairs “"crv", "kty", "x"”,
+	// in lexicographic order without whitespace.
+	var members []byte
+	switch k.Kty {
+	case "EC":
+		members = fmt.Appendf(nil, `{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		members = fmt.Appendf(nil, `{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	default:
+		return "", fmt.Errorf("%w: JWK kty %q", ErrKeyType, k.Kty)
+	}
+	if k.Crv == "" || k.X == "" || (k.Kty == "EC" && k.Y == "") {
+		return "", fmt.Errorf("JWK %s without required members", k.Kty)
+	}
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// MethodID returns the verification method id of pub under did, with the JWK
+// Thumbprint as fragment.
+func MethodID(did backend.DID, pub crypto.PublicKey) (backend.URL, error) {
+	k, err := NewJWK(pub)
+	if err != nil {
+		return backend.URL{}, err
+	}
+	thumbprint, err := k.Thumbprint()
+	if err != nil {
+		return backend.URL{}, err
+	}
+	return backend.URL{DID: did, RawFragment: "#" + thumbprint}, nil
+}
+
+// ParseMethodJWK returns the "publicKeyJwk" property of a verification method.
+// “The JWK MUST NOT contain "d", or any other members of the private
+// information class as described in Registration Template.”
+func ParseMethodJWK(m *backend.VerificationMethod) (*JWK, error) {
+	raw, ok := m.Additional["publicKeyJwk"]
+	if !ok {
+		return nil, fmt.Errorf("%w: DID verification method %s has no publicKeyJwk", ErrKeyType, m.ID.String())
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &members); err != nil {
+		return nil, fmt.Errorf("DID verification method %s publicKeyJwk: %w", m.ID.String(), err)
+	}
+	for _, private := range [...]string{"d", "p", "q", "dp", "dq", "qi", "oth", "k"} {
+		if _, ok := members[private]; ok {
+			return nil, fmt.Errorf("DID verification method %s publicKeyJwk has private member %q", m.ID.String(), private)
+		}
+	}
+	k := new(JWK)
+	if err := json.Unmarshal([]byte(raw), k); err != nil {
+		return nil, fmt.Errorf("DID verification method %s publicKeyJwk: %w", m.ID.String(), err)
+	}
+	return k, nil
+}
+
+// MethodKey returns the public key of a verification method, as expressed by
+// its "publicKeyJwk" property.
+func MethodKey(m *backend.VerificationMethod) (crypto.PublicKey, error) {
+	k, err := ParseMethodJWK(m)
+	if err != nil {
+		return nil, err
+	}
+	return k.PublicKey()
+}
+
+// NewMethod returns a JsonWebKey2020 verification method for pub.
+func NewMethod(id backend.URL, controller backend.DID, pub crypto.PublicKey) (*backend.VerificationMethod, error) {
+	k, err := NewJWK(pub)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+	return &backend.VerificationMethod{
+		ID:         id,
+		Type:       "JsonWebKey2020",
+		Controller: controller,
+		Additional: map[string]json.RawMessage{"publicKeyJwk": bytes},
+	}, nil
+}
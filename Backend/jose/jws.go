@@ -0,0 +1,221 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+// Signature algorithms conform the JWA registry.
+const (
+	EdDSA = "EdDSA" // Ed25519 as per RFC 8037
+	ES256 = "ES256" // ECDSA with P-256 and SHA-256
+	ES384 = "ES384" // ECDSA with P-384 and SHA-384
+	ES512 = "ES512" // ECDSA with P-521 and SHA-512
+)
+
+// ErrSignature signals a JWS with a signature that does not match the key.
+var ErrSignature = errors.New("JWS signature verification failed")
+
+// ErrAlg signals an algorithm mismatch, or an algorithm not supported.
+var ErrAlg = errors.New("JWS algorithm not applicable")
+
+// Header is the JOSE header of a JWS. Only protected headers are supported.
+type Header struct {
+	Alg string `json:"alg"`           // required
+	Kid string `json:"kid,omitempty"` // DID URL of the verification method
+	Typ string `json:"typ,omitempty"`
+	Cty string `json:"cty,omitempty"`
+}
+
+// AlgFor returns the signature algorithm for the public key.
+func AlgFor(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return ES256, nil
+		case elliptic.P384():
+			return ES384, nil
+		case elliptic.P521():
+			return ES512, nil
+		}
+		return "", fmt.Errorf("%w: ECDSA curve %s", ErrAlg, pub.Curve.Params().Name)
+	default:
+		return "", fmt.Errorf("%w: key type %T", ErrAlg, pub)
+	}
+}
+
+// Sign returns the compact serialization of a JWS. The algorithm is set from
+// the key when h.Alg is zero.
+func Sign(h Header, payload []byte, key crypto.Signer) (string, error) {
+	alg, err := AlgFor(key.Public())
+	if err != nil {
+		return "", err
+	}
+	if h.Alg == "" {
+		h.Alg = alg
+	} else if h.Alg != alg {
+		return "", fmt.Errorf("%w: %q header with %s key", ErrAlg, h.Alg, alg)
+	}
+
+	headerJSON, err := json.Marshal(&h)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.Grow(base64.RawURLEncoding.EncodedLen(len(headerJSON)) + base64.RawURLEncoding.EncodedLen(len(payload)) + 180)
+	b.WriteString(base64.RawURLEncoding.EncodeToString(headerJSON))
+	b.WriteByte('.')
+	b.WriteString(base64.RawURLEncoding.EncodeToString(payload))
+
+	sig, err := signInput(alg, []byte(b.String()), key)
+	if err != nil {
+		return "", err
+	}
+	b.WriteByte('.')
+	b.WriteString(base64.RawURLEncoding.EncodeToString(sig))
+	return b.String(), nil
+}
+
+func signInput(alg string, input []byte, key crypto.Signer) ([]byte, error) {
+	if alg == EdDSA {
+		return key.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+
+	h, opts := hashFor(alg)
+	h.Write(input)
+	der, err := key.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (key.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+	return ECDSASignature(der, size)
+}
+
+// ECDSASignature converts an ASN.1 signature, as produced by crypto.Signer
+// implementations, into the fixed-size JWA format of RFC 7518, section 3.4.
+// The size is the byte length of the curve order, e.g., 32 for P-256.
+func ECDSASignature(der []byte, size int) ([]byte, error) {
+	var parsed struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &parsed); err != nil {
+		return nil, fmt.Errorf("ECDSA signature from signer: %w", err)
+	}
+	if parsed.R.Sign() <= 0 || parsed.S.Sign() <= 0 || parsed.R.BitLen() > 8*size || parsed.S.BitLen() > 8*size {
+		return nil, errors.New("ECDSA signature from signer out of range")
+	}
+	sig := make([]byte, 2*size)
+	parsed.R.FillBytes(sig[:size])
+	parsed.S.FillBytes(sig[size:])
+	return sig, nil
+}
+
+func hashFor(alg string) (hash.Hash, crypto.Hash) {
+	switch alg {
+	case ES384:
+		return sha512.New384(), crypto.SHA384
+	case ES512:
+		return sha512.New(), crypto.SHA512
+	default:
+		return sha256.New(), crypto.SHA256
+	}
+}
+
+// JWS is a parsed compact serialization.
+type JWS struct {
+	Header    Header
+	Payload   []byte
+	Signature []byte
+
+	signingInput string // header and payload in their encoded form
+}
+
+// ParseCompact decodes s without verification.
+func ParseCompact(s string) (*JWS, error) {
+	i := strings.IndexByte(s, '.')
+	j := strings.LastIndexByte(s, '.')
+	if i < 0 || i == j {
+		return nil, errors.New("JWS compact serialization needs 3 parts")
+	}
+	if strings.IndexByte(s[i+1:j], '.') >= 0 {
+		return nil, errors.New("JWS compact serialization has more than 3 parts")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(s[:i])
+	if err != nil {
+		return nil, fmt.Errorf("JWS header: %w", err)
+	}
+	jws := JWS{signingInput: s[:j]}
+	err = json.Unmarshal(headerJSON, &jws.Header)
+	if err != nil {
+		return nil, fmt.Errorf("JWS header: %w", err)
+	}
+	if jws.Header.Alg == "" {
+		return nil, errors.New(`JWS header has no "alg"`)
+	}
+
+	jws.Payload, err = base64.RawURLEncoding.DecodeString(s[i+1 : j])
+	if err != nil {
+		return nil, fmt.Errorf("JWS payload: %w", err)
+	}
+	jws.Signature, err = base64.RawURLEncoding.DecodeString(s[j+1:])
+	if err != nil {
+		return nil, fmt.Errorf("JWS signature: %w", err)
+	}
+	return &jws, nil
+}
+
+// SigningInput returns the header and the payload in their encoded form, as
+// covered by the signature.
+func (jws *JWS) SigningInput() []byte {
+	return []byte(jws.signingInput)
+}
+
+// Verify checks the signature with pub, including whether the algorithm from
+// the header matches the key.
+func (jws *JWS) Verify(pub crypto.PublicKey) error {
+	alg, err := AlgFor(pub)
+	if err != nil {
+		return err
+	}
+	if alg != jws.Header.Alg {
+		return fmt.Errorf("%w: %q header with %s key", ErrAlg, jws.Header.Alg, alg)
+	}
+
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, []byte(jws.signingInput), jws.Signature) {
+			return ErrSignature
+		}
+
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(jws.Signature) != 2*size {
+			return ErrSignature
+		}
+		h, _ := hashFor(alg)
+		h.Write([]byte(jws.signingInput))
+		r := new(big.Int).SetBytes(jws.Signature[:size])
+		s := new(big.Int).SetBytes(jws.Signature[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return ErrSignature
+		}
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package jsonld
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ActiveContext is the result of context processing.
+type activeContext struct {
+	terms    map[string]*termDef
+	base     string
+	vocab    string
+	hasVocab bool
+	language string // lower case
+
+	// Previous is the context to revert to for nested node objects, as
+	// type-scoped contexts do not propagate by default.
+	previous *activeContext
+}
+
+func (ac *activeContext) clone() *activeContext {
+	c := *ac
+	c.terms = make(map[string]*termDef, len(ac.terms))
+	for k, v := range ac.terms {
+		c.terms[k] = v
+	}
+	return &c
+}
+
+// TermDef is a term definition.
+type termDef struct {
+	id          string // IRI, blank node identifier, or keyword; empty for null
+	typ         string // "@id", "@vocab", "@json", "@none", or a datatype IRI
+	container   map[string]bool
+	language    string // lower case
+	hasLanguage bool   // with the empty language for null
+	context     any    // property-scoped context
+	hasContext  bool
+	prefix      bool
+	protected   bool
+}
+
+// Same returns whether the definitions are equal, regardless of protection.
+func (d *termDef) same(o *termDef) bool {
+	a, b := *d, *o
+	a.protected, b.protected = false, false
+	if len(a.container) == 0 && len(b.container) == 0 {
+		a.container, b.container = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+var keywords = map[string]bool{
+	"@base": true, "@container": true, "@context": true, "@direction": true,
+	"@graph": true, "@id": true, "@import": true, "@included": true,
+	"@index": true, "@json": true, "@language": true, "@list": true,
+	"@nest": true, "@none": true, "@prefix": true, "@propagate": true,
+	"@protected": true, "@reverse": true, "@set": true, "@type": true,
+	"@value": true, "@version": true, "@vocab": true,
+}
+
+// KeywordLike returns whether s has the form of a keyword, i.e., "@" followed
+// by one or more letters. Such terms are reserved, and they are ignored.
+func keywordLike(s string) bool {
+	if len(s) < 2 || s[0] != '@' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAbsolute returns whether s has an IRI scheme.
+func isAbsolute(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			continue
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+			continue
+		case i > 0 && c == ':':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func resolve(base, ref string) string {
+	if base == "" {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// Process applies a local context. Property-scoped contexts override
+// protected terms, and type-scoped contexts do not propagate.
+func (c *converter) process(active *activeContext, local any, override, propagate bool, remotes []string) (*activeContext, error) {
+	result := active.clone()
+	if m, ok := local.(map[string]any); ok {
+		if p, ok := m["@propagate"]; ok {
+			b, ok := p.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%w: @propagate is not a boolean", ErrContext)
+			}
+			propagate = b
+		}
+	}
+	if !propagate && result.previous == nil {
+		result.previous = active
+	}
+
+	list, ok := local.([]any)
+	if !ok {
+		list = []any{local}
+	}
+	for _, ctx := range list {
+		switch ctx := ctx.(type) {
+		case nil:
+			if !override {
+				for term, def := range result.terms {
+					if def.protected {
+						return nil, fmt.Errorf("%w: null context clears %q", ErrProtected, term)
+					}
+				}
+			}
+			result = &activeContext{
+				terms:    make(map[string]*termDef),
+				base:     active.base,
+				previous: result.previous,
+			}
+
+		case string:
+			u := resolve(result.base, ctx)
+			if !isAbsolute(u) {
+				return nil, fmt.Errorf("%w: remote context %q is not an absolute URL", ErrContext, ctx)
+			}
+			for _, r := range remotes {
+				if r == u {
+					return nil, fmt.Errorf("%w: recursive inclusion of %q", ErrContext, u)
+				}
+			}
+			c.contexts++
+			if c.contexts > ContextMax {
+				return nil, fmt.Errorf("%w: more than %d remote contexts", ErrContext, ContextMax)
+			}
+			if c.loader == nil {
+				return nil, fmt.Errorf("%w: no loader for remote context %q", ErrContext, u)
+			}
+			doc, err := c.loader.LoadContext(u)
+			if err != nil {
+				return nil, err
+			}
+			m, ok := doc.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%w: remote context %q is not a JSON object", ErrContext, u)
+			}
+			inner, ok := m["@context"]
+			if !ok {
+				return nil, fmt.Errorf("%w: remote context %q has no @context", ErrContext, u)
+			}
+			result, err = c.process(result, inner, override, true, append(remotes, u))
+			if err != nil {
+				return nil, err
+			}
+
+		case map[string]any:
+			if err := c.define(result, ctx, override, len(remotes) != 0); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("%w: context entry of type %T", ErrContext, ctx)
+		}
+	}
+	return result, nil
+}
+
+// Define applies a context definition on ac.
+func (c *converter) define(ac *activeContext, ctx map[string]any, override, remote bool) error {
+	if v, ok := ctx["@version"]; ok && fmt.Sprint(v) != "1.1" {
+		return fmt.Errorf("%w: @version %v", ErrContext, v)
+	}
+	if _, ok := ctx["@import"]; ok {
+		return fmt.Errorf("%w: @import", ErrUnsupported)
+	}
+	if v, ok := ctx["@base"]; ok && !remote {
+		switch v := v.(type) {
+		case nil:
+			ac.base = ""
+		case string:
+			ac.base = resolve(ac.base, v)
+		default:
+			return fmt.Errorf("%w: @base is not a string", ErrContext)
+		}
+	}
+	d := definer{c: c, ac: ac, local: ctx, defined: make(map[string]bool), override: override}
+	if v, ok := ctx["@protected"]; ok {
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("%w: @protected is not a boolean", ErrContext)
+		}
+		d.protected = b
+	}
+	if v, ok := ctx["@vocab"]; ok {
+		switch v := v.(type) {
+		case nil:
+			ac.vocab, ac.hasVocab = "", false
+		case string:
+			iri, err := d.expand(v, true, true)
+			if err != nil {
+				return err
+			}
+			if !isAbsolute(iri) && !strings.HasPrefix(iri, "_:") {
+				return fmt.Errorf("%w: @vocab %q is not an IRI", ErrContext, v)
+			}
+			ac.vocab, ac.hasVocab = iri, true
+		default:
+			return fmt.Errorf("%w: @vocab is not a string", ErrContext)
+		}
+	}
+	if v, ok := ctx["@language"]; ok {
+		switch v := v.(type) {
+		case nil:
+			ac.language = ""
+		case string:
+			ac.language = strings.ToLower(v)
+		default:
+			return fmt.Errorf("%w: @language is not a string", ErrContext)
+		}
+	}
+
+	terms := make([]string, 0, len(ctx))
+	for term := range ctx {
+		switch term {
+		case "@base", "@direction", "@import", "@language", "@propagate", "@protected", "@version", "@vocab":
+			continue
+		}
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	for _, term := range terms {
+		if err := d.term(term); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Definer creates the term definitions of a local context, in dependency
+// order.
+type definer struct {
+	c         *converter
+	ac        *activeContext
+	local     map[string]any
+	defined   map[string]bool // done per term, with false for in progress
+	protected bool            // default
+	override  bool
+}
+
+func (d *definer) term(term string) error {
+	if done, ok := d.defined[term]; ok {
+		if !done {
+			return fmt.Errorf("%w: cyclic definition of %q", ErrContext, term)
+		}
+		return nil
+	}
+	d.defined[term] = false
+	if keywords[term] {
+		return fmt.Errorf("%w: keyword %q redefined", ErrContext, term)
+	}
+	if keywordLike(term) {
+		d.defined[term] = true
+		return nil // reserved
+	}
+
+	var m map[string]any
+	simple := false
+	switch v := d.local[term].(type) {
+	case nil:
+		m = map[string]any{"@id": nil}
+	case string:
+		m = map[string]any{"@id": v}
+		simple = true
+	case map[string]any:
+		m = v
+	default:
+		return fmt.Errorf("%w: definition of %q is of type %T", ErrContext, term, v)
+	}
+
+	def := termDef{protected: d.protected}
+	for k, v := range m {
+		switch k {
+		case "@id", "@type", "@container", "@language", "@direction", "@context", "@prefix":
+			break
+		case "@protected":
+			b, ok := v.(bool)
+			if !ok {
+				return fmt.Errorf("%w: @protected of %q is not a boolean", ErrContext, term)
+			}
+			def.protected = b
+		case "@reverse", "@nest", "@index":
+			return fmt.Errorf("%w: %s in definition of %q", ErrUnsupported, k, term)
+		default:
+			return fmt.Errorf("%w: %q in definition of %q", ErrContext, k, term)
+		}
+	}
+
+	if v, ok := m["@type"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%w: @type of %q is not a string", ErrContext, term)
+		}
+		switch s {
+		case "@id", "@vocab", "@json", "@none":
+			def.typ = s
+		default:
+			iri, err := d.expand(s, false, true)
+			if err != nil {
+				return err
+			}
+			if !isAbsolute(iri) {
+				return fmt.Errorf("%w: @type %q of %q is not an IRI", ErrContext, s, term)
+			}
+			def.typ = iri
+		}
+	}
+
+	if v, ok := m["@id"]; ok {
+		switch v := v.(type) {
+		case nil:
+			break // null mapping
+		case string:
+			if !keywords[v] && keywordLike(v) {
+				break // reserved, as null
+			}
+			iri, err := d.expand(v, false, true)
+			if err != nil {
+				return err
+			}
+			if iri == "@context" {
+				return fmt.Errorf("%w: alias of @context", ErrContext)
+			}
+			if !keywords[iri] && !isAbsolute(iri) && !strings.HasPrefix(iri, "_:") {
+				return fmt.Errorf("%w: IRI mapping %q of %q", ErrContext, v, term)
+			}
+			def.id = iri
+			if simple && !strings.ContainsAny(term, ":/") && strings.ContainsRune(":/?#[]@", rune(iri[len(iri)-1])) {
+				def.prefix = true
+			}
+		default:
+			return fmt.Errorf("%w: @id of %q is not a string", ErrContext, term)
+		}
+	} else if i := strings.IndexByte(term, ':'); i > 0 {
+		prefix, suffix := term[:i], term[i+1:]
+		if _, ok := d.local[prefix]; ok {
+			if err := d.term(prefix); err != nil {
+				return err
+			}
+		}
+		if p, ok := d.ac.terms[prefix]; ok && p.id != "" && !strings.HasPrefix(suffix, "//") {
+			def.id = p.id + suffix
+		} else {
+			def.id = term // absolute IRI or blank node
+		}
+	} else if strings.Contains(term, "/") {
+		iri, err := d.expand(term, false, true)
+		if err != nil {
+			return err
+		}
+		def.id = iri
+	} else if d.ac.hasVocab {
+		def.id = d.ac.vocab + term
+	} else {
+		return fmt.Errorf("%w: no IRI mapping for %q without @vocab", ErrContext, term)
+	}
+
+	if v, ok := m["@container"]; ok {
+		def.container = make(map[string]bool)
+		list, ok := v.([]any)
+		if !ok {
+			list = []any{v}
+		}
+		for _, e := range list {
+			s, _ := e.(string)
+			switch s {
+			case "@list", "@set", "@graph", "@language", "@index", "@id", "@type":
+				def.container[s] = true
+			default:
+				return fmt.Errorf("%w: @container %v of %q", ErrContext, e, term)
+			}
+		}
+	}
+	if v, ok := m["@language"]; ok {
+		switch v := v.(type) {
+		case nil:
+			def.hasLanguage = true
+		case string:
+			def.language, def.hasLanguage = strings.ToLower(v), true
+		default:
+			return fmt.Errorf("%w: @language of %q is not a string", ErrContext, term)
+		}
+	}
+	if v, ok := m["@context"]; ok {
+		def.context, def.hasContext = v, true
+	}
+	if v, ok := m["@prefix"]; ok {
+		b, ok := v.(bool)
+		if !ok || strings.ContainsAny(term, ":/") {
+			return fmt.Errorf("%w: @prefix of %q", ErrContext, term)
+		}
+		def.prefix = b
+	}
+
+	if prev, ok := d.ac.terms[term]; ok && prev.protected && !d.override {
+		if !prev.same(&def) {
+			return fmt.Errorf("%w: %q", ErrProtected, term)
+		}
+		def = *prev
+	}
+	d.ac.terms[term] = &def
+	d.defined[term] = true
+	return nil
+}
+
+// Expand applies IRI expansion during context processing, i.e., with terms
+// of the local context defined on demand.
+func (d *definer) expand(value string, documentRelative, vocab bool) (string, error) {
+	if _, ok := d.local[value]; ok && !keywords[value] {
+		if err := d.term(value); err != nil {
+			return "", err
+		}
+	}
+	if i := strings.IndexByte(value, ':'); i > 0 {
+		if _, ok := d.local[value[:i]]; ok {
+			if err := d.term(value[:i]); err != nil {
+				return "", err
+			}
+		}
+	}
+	return expandIRI(d.ac, value, documentRelative, vocab), nil
+}
+
+// ExpandIRI returns the IRI, the blank node identifier, or the keyword of
+// value. The empty string is returned for null mappings, and for reserved
+// keywords.
+func expandIRI(ac *activeContext, value string, documentRelative, vocab bool) string {
+	if keywords[value] {
+		return value
+	}
+	if keywordLike(value) {
+		return ""
+	}
+	if def, ok := ac.terms[value]; ok && (vocab || keywords[def.id]) {
+		return def.id
+	}
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		prefix, suffix := value[:i], value[i+1:]
+		if prefix == "_" || strings.HasPrefix(suffix, "//") {
+			return value
+		}
+		if def, ok := ac.terms[prefix]; ok && def.id != "" && def.prefix {
+			return def.id + suffix
+		}
+		if isAbsolute(value) {
+			return value
+		}
+	}
+	if vocab && ac.hasVocab {
+		return ac.vocab + value
+	}
+	if documentRelative {
+		return resolve(ac.base, value)
+	}
+	return value
+}
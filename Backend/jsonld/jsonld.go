@@ -0,0 +1,89 @@
+// Package jsonld converts JSON-LD documents into RDF datasets, for the
+// "-rdfc-" cryptosuites of Data Integrity. The implementation covers the
+// subset of JSON-LD 1.1 in use by verifiable credentials and DID documents.
+// Features outside of the subset fail with ErrUnsupported, rather than being
+// ignored.
+//
+// Conversion operates in “safe mode”, i.e., properties and types which do not
+// map to an absolute IRI fail with ErrUndefined, instead of being dropped
+// silently, as dropped terms would escape the signature.
+package jsonld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"EncrypteDL/IDChain/Backend/rdfc"
+)
+
+// Conversion Errors
+var (
+	ErrContext     = errors.New("JSON-LD context invalid")
+	ErrUndefined   = errors.New("JSON-LD term undefined")
+	ErrUnsupported = errors.New("JSON-LD feature not supported")
+	ErrProtected   = errors.New("JSON-LD protected term redefinition")
+)
+
+// Limits protect against resource exhaustion.
+const (
+	DepthMax   = 64 // nesting of node objects
+	ContextMax = 32 // remote contexts per document
+)
+
+// Loader provides remote contexts. Contexts are security critical, as they
+// define what a signature covers, so any retrieval over the network should
+// be subject to strict caching and pinning.
+type Loader interface {
+	// LoadContext returns the JSON document at url, in the form of
+	// json.Unmarshal into an any.
+	LoadContext(url string) (any, error)
+}
+
+// Contexts is a Loader of static JSON documents by URL.
+type Contexts map[string][]byte
+
+// LoadContext implements the Loader interface.
+func (c Contexts) LoadContext(url string) (any, error) {
+	data, ok := c[url]
+	if !ok {
+		return nil, fmt.Errorf("%w: remote context %q not available", ErrContext, url)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: remote context %q: %w", ErrContext, url, err)
+	}
+	return doc, nil
+}
+
+// ToRDF returns the dataset of a JSON-LD document, in the form of
+// json.Unmarshal into an any, optionally with json.Number values. Blank nodes
+// get arbitrary labels, as canonicalization replaces them.
+func ToRDF(doc any, loader Loader) ([]rdfc.Quad, error) {
+	c := converter{
+		loader: loader,
+		blanks: make(map[string]string),
+	}
+	active := &activeContext{terms: make(map[string]*termDef)}
+	var err error
+	switch doc := doc.(type) {
+	case map[string]any:
+		_, err = c.node(active, nil, doc, rdfc.Term{}, 0, true)
+	case []any:
+		for _, e := range doc {
+			obj, ok := e.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%w: top-level array with a non-object", ErrUnsupported)
+			}
+			if _, err = c.node(active, nil, obj, rdfc.Term{}, 0, true); err != nil {
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: document is not an object nor an array", ErrUnsupported)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.quads, nil
+}
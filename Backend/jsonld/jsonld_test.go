@@ -0,0 +1,104 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"EncrypteDL/IDChain/Backend/rdfc"
+)
+
+var exampleContexts = Contexts{
+	"https://example.com/v1": []byte(`{"@context": {
+		"@version": 1.1, "@protected": true, "id": "@id", "type": "@type",
+		"ex": "https://example.com/vocab#",
+		"xsd": "http://www.w3.org/2001/XMLSchema#",
+		"Person": {"@id": "ex:Person", "@context": {
+			"@propagate": false,
+			"knows": {"@id": "ex:knows", "@type": "@id"}
+		}},
+		"name": {"@id": "ex:name", "@container": "@language"},
+		"born": {"@id": "ex:born", "@type": "xsd:dateTime"},
+		"steps": {"@id": "ex:steps", "@container": "@list"},
+		"claims": {"@id": "ex:claims", "@type": "@id", "@container": "@graph"},
+		"score": "ex:score"
+	}}`),
+}
+
+func canonical(t *testing.T, doc string) (string, error) {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	quads, err := ToRDF(v, exampleContexts)
+	if err != nil {
+		return "", err
+	}
+	b, err := rdfc.Canonical(quads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+func TestToRDF(t *testing.T) {
+	got, err := canonical(t, `{
+		"@context": "https://example.com/v1",
+		"id": "https://example.com/alice",
+		"type": "Person",
+		"name": {"en": "Alice", "nl": "Alies"},
+		"born": "1990-01-01T00:00:00Z",
+		"knows": "https://example.com/bob",
+		"steps": ["one", 2, 2.5, true],
+		"score": {"@value": "A+", "@language": "en"},
+		"claims": {"type": "Person", "score": 1e21}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `<https://example.com/alice> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <https://example.com/vocab#Person> .
+<https://example.com/alice> <https://example.com/vocab#born> "1990-01-01T00:00:00Z"^^<http://www.w3.org/2001/XMLSchema#dateTime> .
+<https://example.com/alice> <https://example.com/vocab#claims> _:c14n4 .
+<https://example.com/alice> <https://example.com/vocab#knows> <https://example.com/bob> .
+<https://example.com/alice> <https://example.com/vocab#name> "Alice"@en .
+<https://example.com/alice> <https://example.com/vocab#name> "Alies"@nl .
+<https://example.com/alice> <https://example.com/vocab#score> "A+"@en .
+<https://example.com/alice> <https://example.com/vocab#steps> _:c14n2 .
+_:c14n0 <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <https://example.com/vocab#Person> _:c14n4 .
+_:c14n0 <https://example.com/vocab#score> "1.0E21"^^<http://www.w3.org/2001/XMLSchema#double> _:c14n4 .
+_:c14n1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "2.5E0"^^<http://www.w3.org/2001/XMLSchema#double> .
+_:c14n1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> _:c14n5 .
+_:c14n2 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "one" .
+_:c14n2 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> _:c14n3 .
+_:c14n3 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "2"^^<http://www.w3.org/2001/XMLSchema#integer> .
+_:c14n3 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> _:c14n1 .
+_:c14n5 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "true"^^<http://www.w3.org/2001/XMLSchema#boolean> .
+_:c14n5 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> <http://www.w3.org/1999/02/22-rdf-syntax-ns#nil> .
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestToRDFErrors(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want error
+	}{
+		{`{"@context": "https://example.com/v1", "nickname": "Al"}`, ErrUndefined},
+		{`{"@context": "https://example.com/v1", "type": "Robot"}`, ErrUndefined},
+		// type-scoped contexts do not propagate into embedded nodes
+		{`{"@context": "https://example.com/v1", "type": "Person", "claims": {"knows": "x"}}`, ErrUndefined},
+		{`{"@context": ["https://example.com/v1", {"name": "https://example.com/other#name"}]}`, ErrProtected},
+		{`{"@context": "https://example.com/v2"}`, ErrContext},
+		{`{"@context": {"@import": "https://example.com/v1"}}`, ErrUnsupported},
+		{`"text"`, ErrUnsupported},
+	}
+	for _, test := range tests {
+		_, err := canonical(t, test.doc)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s got error %v, want %v", test.doc, err, test.want)
+		}
+	}
+}
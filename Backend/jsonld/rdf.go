@@ -0,0 +1,528 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"EncrypteDL/IDChain/Backend/rdfc"
+)
+
+// RDF Vocabulary
+const (
+	rdfType  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+	rdfFirst = "http://www.w3.org/1999/02/22-rdf-syntax-ns#first"
+	rdfRest  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#rest"
+	rdfNil   = "http://www.w3.org/1999/02/22-rdf-syntax-ns#nil"
+)
+
+// Converter holds the state of ToRDF.
+type converter struct {
+	loader   Loader
+	quads    []rdfc.Quad
+	blanks   map[string]string // document labels to generated ones
+	n        int               // blank node sequence
+	contexts int               // remote contexts loaded
+}
+
+// Blank returns the node for a document label, or a new node for the empty
+// label.
+func (c *converter) blank(label string) rdfc.Term {
+	if id, ok := c.blanks[label]; ok && label != "" {
+		return rdfc.NewBlank(id)
+	}
+	id := "b" + strconv.Itoa(c.n)
+	c.n++
+	if label != "" {
+		c.blanks[label] = id
+	}
+	return rdfc.NewBlank(id)
+}
+
+// Emit adds a quad, excluding generalized RDF, i.e., blank node predicates.
+func (c *converter) emit(s rdfc.Term, p string, o, g rdfc.Term) {
+	if strings.HasPrefix(p, "_:") {
+		return
+	}
+	c.quads = append(c.quads, rdfc.Quad{Subject: s, Predicate: rdfc.NewIRI(p), Object: o, Graph: g})
+}
+
+// Reference returns the node of an IRI or blank node identifier.
+func (c *converter) reference(ac *activeContext, value string, vocab bool) (rdfc.Term, error) {
+	iri := expandIRI(ac, value, true, vocab)
+	switch {
+	case strings.HasPrefix(iri, "_:"):
+		return c.blank(iri[2:]), nil
+	case isAbsolute(iri):
+		return rdfc.NewIRI(iri), nil
+	}
+	return rdfc.Term{}, fmt.Errorf("%w: %q is not an absolute IRI", ErrUndefined, value)
+}
+
+// Node emits a node object, and it returns the subject. The property-scoped
+// context comes from def, if any. The top-level flag enables the default
+// graph for documents with just a "@graph".
+func (c *converter) node(ac *activeContext, def *termDef, obj map[string]any, graph rdfc.Term, depth int, top bool) (rdfc.Term, error) {
+	if depth > DepthMax {
+		return rdfc.Term{}, fmt.Errorf("%w: node objects nested over %d levels", ErrUnsupported, DepthMax)
+	}
+	var err error
+	if ac.previous != nil {
+		ac = ac.previous
+	}
+	if def != nil && def.hasContext {
+		if ac, err = c.process(ac, def.context, true, true, nil); err != nil {
+			return rdfc.Term{}, err
+		}
+	}
+	if local, ok := obj["@context"]; ok {
+		if ac, err = c.process(ac, local, false, true, nil); err != nil {
+			return rdfc.Term{}, err
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		if k != "@context" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	// type-scoped contexts, in lexicographical order of the types
+	typeCtx := ac
+	var types []string
+	for _, k := range keys {
+		if expandIRI(typeCtx, k, false, true) != "@type" {
+			continue
+		}
+		switch v := obj[k].(type) {
+		case string:
+			types = append(types, v)
+		case []any:
+			for _, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return rdfc.Term{}, fmt.Errorf("%w: @type entry of type %T", ErrUndefined, e)
+				}
+				types = append(types, s)
+			}
+		default:
+			return rdfc.Term{}, fmt.Errorf("%w: @type of type %T", ErrUndefined, v)
+		}
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if d, ok := typeCtx.terms[t]; ok && d.hasContext {
+			if ac, err = c.process(ac, d.context, false, false, nil); err != nil {
+				return rdfc.Term{}, err
+			}
+		}
+	}
+
+	expanded := make(map[string]string, len(keys))
+	graphOnly := top
+	var subject rdfc.Term
+	for _, k := range keys {
+		e := expandIRI(ac, k, false, true)
+		expanded[k] = e
+		switch e {
+		case "@id":
+			s, ok := obj[k].(string)
+			if !ok {
+				return rdfc.Term{}, fmt.Errorf("%w: @id of type %T", ErrUndefined, obj[k])
+			}
+			if subject, err = c.reference(ac, s, false); err != nil {
+				return rdfc.Term{}, err
+			}
+			graphOnly = false
+		case "@graph", "@index":
+			break
+		default:
+			graphOnly = false
+		}
+	}
+	if subject.Kind == rdfc.DefaultGraph {
+		subject = c.blank("")
+	}
+
+	for _, k := range keys {
+		switch e := expanded[k]; e {
+		case "@id", "@index":
+			continue
+
+		case "@type":
+			for _, t := range types {
+				o, err := c.reference(typeCtx, t, true)
+				if err != nil {
+					return rdfc.Term{}, err
+				}
+				c.emit(subject, rdfType, o, graph)
+			}
+
+		case "@graph":
+			g := subject
+			if graphOnly {
+				g = graph
+			}
+			for _, e := range asArray(obj[k]) {
+				m, ok := e.(map[string]any)
+				if !ok {
+					return rdfc.Term{}, fmt.Errorf("%w: @graph entry of type %T", ErrUnsupported, e)
+				}
+				if _, err := c.node(ac, nil, m, g, depth+1, false); err != nil {
+					return rdfc.Term{}, err
+				}
+			}
+
+		case "":
+			if keywordLike(k) {
+				continue // reserved
+			}
+			return rdfc.Term{}, fmt.Errorf("%w: property %q", ErrUndefined, k)
+
+		default:
+			if keywords[e] {
+				return rdfc.Term{}, fmt.Errorf("%w: %s in node object", ErrUnsupported, e)
+			}
+			if !isAbsolute(e) && !strings.HasPrefix(e, "_:") {
+				return rdfc.Term{}, fmt.Errorf("%w: property %q maps to %q", ErrUndefined, k, e)
+			}
+			objects, err := c.values(ac, k, obj[k], graph, depth)
+			if err != nil {
+				return rdfc.Term{}, err
+			}
+			for _, o := range objects {
+				c.emit(subject, e, o, graph)
+			}
+		}
+	}
+	return subject, nil
+}
+
+// Values returns the objects of property key.
+func (c *converter) values(ac *activeContext, key string, value any, graph rdfc.Term, depth int) ([]rdfc.Term, error) {
+	def := ac.terms[key]
+	var container map[string]bool
+	if def != nil {
+		container = def.container
+	}
+
+	m, isMap := value.(map[string]any)
+	switch {
+	case container["@language"] && isMap:
+		return c.languageMap(m)
+	case container["@index"] && isMap:
+		var items []any
+		for _, k := range sortedKeys(m) {
+			items = append(items, asArray(m[k])...)
+		}
+		value = items
+	case container["@id"] && isMap, container["@type"] && isMap:
+		return nil, fmt.Errorf("%w: map container of %q", ErrUnsupported, key)
+	case container["@list"]:
+		l, err := c.list(ac, def, asArray(value), graph, depth)
+		if err != nil {
+			return nil, err
+		}
+		return []rdfc.Term{l}, nil
+	}
+
+	var terms []rdfc.Term
+	for _, item := range asArray(value) {
+		if container["@graph"] {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%w: graph container of %q with a %T", ErrUnsupported, key, item)
+			}
+			g := c.blank("")
+			if _, err := c.node(ac, def, obj, g, depth+1, false); err != nil {
+				return nil, err
+			}
+			terms = append(terms, g)
+			continue
+		}
+		t, err := c.item(ac, def, key, item, graph, depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t...)
+	}
+	return terms, nil
+}
+
+// Item returns the objects of a single value, with a set possibly empty.
+func (c *converter) item(ac *activeContext, def *termDef, key string, v any, graph rdfc.Term, depth int) ([]rdfc.Term, error) {
+	// the property-scoped context applies to values as is
+	valueCtx, valueDef := ac, def
+	if def != nil && def.hasContext {
+		var err error
+		if valueCtx, err = c.process(ac, def.context, true, true, nil); err != nil {
+			return nil, err
+		}
+		if d, ok := valueCtx.terms[key]; ok {
+			valueDef = d
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		return nil, fmt.Errorf("%w: nested array in %q", ErrUnsupported, key)
+	case map[string]any:
+		switch {
+		case hasKeyword(valueCtx, v, "@value"):
+			t, ok, err := c.valueObject(valueCtx, v)
+			if !ok || err != nil {
+				return nil, err
+			}
+			return []rdfc.Term{t}, nil
+		case hasKeyword(valueCtx, v, "@list"):
+			for k, e := range v {
+				if expandIRI(valueCtx, k, false, true) == "@list" {
+					l, err := c.list(ac, def, asArray(e), graph, depth)
+					if err != nil {
+						return nil, err
+					}
+					return []rdfc.Term{l}, nil
+				}
+			}
+		case hasKeyword(valueCtx, v, "@set"):
+			var terms []rdfc.Term
+			for k, e := range v {
+				if expandIRI(valueCtx, k, false, true) != "@set" {
+					continue
+				}
+				for _, x := range asArray(e) {
+					t, err := c.item(ac, def, key, x, graph, depth)
+					if err != nil {
+						return nil, err
+					}
+					terms = append(terms, t...)
+				}
+			}
+			return terms, nil
+		}
+		s, err := c.node(ac, def, v, graph, depth+1, false)
+		if err != nil {
+			return nil, err
+		}
+		return []rdfc.Term{s}, nil
+	}
+
+	t, err := c.scalar(valueCtx, valueDef, v)
+	if err != nil {
+		return nil, err
+	}
+	return []rdfc.Term{t}, nil
+}
+
+// Scalar returns the object of a string, a number, or a boolean.
+func (c *converter) scalar(ac *activeContext, def *termDef, v any) (rdfc.Term, error) {
+	var typ string
+	if def != nil {
+		typ = def.typ
+	}
+	if s, ok := v.(string); ok {
+		switch typ {
+		case "@id":
+			return c.reference(ac, s, false)
+		case "@vocab":
+			return c.reference(ac, s, true)
+		case "@json":
+			return rdfc.Term{}, fmt.Errorf("%w: @json", ErrUnsupported)
+		case "", "@none":
+			lang := ac.language
+			if def != nil && def.hasLanguage {
+				lang = def.language
+			}
+			if lang != "" {
+				return rdfc.NewLangString(s, lang), nil
+			}
+			return rdfc.NewLiteral(s, ""), nil
+		default:
+			return rdfc.NewLiteral(s, typ), nil
+		}
+	}
+	if keywords[typ] {
+		typ = "" // no datatype
+	}
+	return native(v, typ)
+}
+
+// Native returns the literal of a boolean or a number, with an optional
+// datatype IRI.
+func native(v any, datatype string) (rdfc.Term, error) {
+	if b, ok := v.(bool); ok {
+		if datatype == "" {
+			datatype = rdfc.XSDBoolean
+		}
+		return rdfc.NewLiteral(strconv.FormatBool(b), datatype), nil
+	}
+	f, ok := number(v)
+	if !ok {
+		return rdfc.Term{}, fmt.Errorf("%w: value of type %T", ErrUnsupported, v)
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1e21 && datatype != rdfc.XSDDouble {
+		if datatype == "" {
+			datatype = rdfc.XSDInteger
+		}
+		return rdfc.NewLiteral(strconv.FormatFloat(f, 'f', -1, 64), datatype), nil
+	}
+	if datatype == "" {
+		datatype = rdfc.XSDDouble
+	}
+	return rdfc.NewLiteral(canonicalDouble(f), datatype), nil
+}
+
+// CanonicalDouble returns the canonical lexical form of an xsd:double, e.g.,
+// "1.1E0", with at most 16 significant digits, conform the JSON-LD reference
+// implementation.
+func canonicalDouble(f float64) string {
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', 15, 64), "e")
+	mantissa = strings.TrimRight(mantissa, "0")
+	if strings.HasSuffix(mantissa, ".") {
+		mantissa += "0"
+	}
+	n, _ := strconv.Atoi(exp)
+	return mantissa + "E" + strconv.Itoa(n)
+}
+
+// Number returns the value of a JSON number.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ValueObject returns the literal of a value object, if not null.
+func (c *converter) valueObject(ac *activeContext, m map[string]any) (rdfc.Term, bool, error) {
+	var value any
+	var typ, lang string
+	for k, v := range m {
+		switch expandIRI(ac, k, false, true) {
+		case "@value":
+			value = v
+		case "@type":
+			s, ok := v.(string)
+			if !ok {
+				return rdfc.Term{}, false, fmt.Errorf("%w: value object @type of type %T", ErrUndefined, v)
+			}
+			if s == "@json" {
+				return rdfc.Term{}, false, fmt.Errorf("%w: @json", ErrUnsupported)
+			}
+			typ = expandIRI(ac, s, true, true)
+			if !isAbsolute(typ) {
+				return rdfc.Term{}, false, fmt.Errorf("%w: datatype %q", ErrUndefined, s)
+			}
+		case "@language":
+			s, ok := v.(string)
+			if !ok {
+				return rdfc.Term{}, false, fmt.Errorf("%w: value object @language of type %T", ErrUndefined, v)
+			}
+			lang = strings.ToLower(s)
+		case "@direction", "@index":
+			break
+		default:
+			return rdfc.Term{}, false, fmt.Errorf("%w: %q in value object", ErrUndefined, k)
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return rdfc.Term{}, false, nil
+	case string:
+		switch {
+		case typ != "":
+			return rdfc.NewLiteral(v, typ), true, nil
+		case lang != "":
+			return rdfc.NewLangString(v, lang), true, nil
+		}
+		return rdfc.NewLiteral(v, ""), true, nil
+	}
+	t, err := native(value, typ)
+	return t, err == nil, err
+}
+
+// LanguageMap returns the language-tagged strings of a map.
+func (c *converter) languageMap(m map[string]any) ([]rdfc.Term, error) {
+	var terms []rdfc.Term
+	for _, lang := range sortedKeys(m) {
+		for _, v := range asArray(m[lang]) {
+			switch v := v.(type) {
+			case nil:
+				continue
+			case string:
+				if lang == "@none" {
+					terms = append(terms, rdfc.NewLiteral(v, ""))
+				} else {
+					terms = append(terms, rdfc.NewLangString(v, strings.ToLower(lang)))
+				}
+			default:
+				return nil, fmt.Errorf("%w: language map entry of type %T", ErrUndefined, v)
+			}
+		}
+	}
+	return terms, nil
+}
+
+// List emits an RDF collection, and it returns its head.
+func (c *converter) list(ac *activeContext, def *termDef, items []any, graph rdfc.Term, depth int) (rdfc.Term, error) {
+	var terms []rdfc.Term
+	for _, item := range items {
+		t, err := c.item(ac, def, "", item, graph, depth)
+		if err != nil {
+			return rdfc.Term{}, err
+		}
+		terms = append(terms, t...)
+	}
+	if len(terms) == 0 {
+		return rdfc.NewIRI(rdfNil), nil
+	}
+	head := c.blank("")
+	node := head
+	for i, t := range terms {
+		c.emit(node, rdfFirst, t, graph)
+		next := rdfc.NewIRI(rdfNil)
+		if i+1 < len(terms) {
+			next = c.blank("")
+		}
+		c.emit(node, rdfRest, next, graph)
+		node = next
+	}
+	return head, nil
+}
+
+// HasKeyword returns whether any key of m expands to keyword.
+func hasKeyword(ac *activeContext, m map[string]any, keyword string) bool {
+	for k := range m {
+		if expandIRI(ac, k, false, true) == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+func asArray(v any) []any {
+	if a, ok := v.([]any); ok {
+		return a
+	}
+	return []any{v}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,411 @@
+// Package jsonpatch expresses DID document updates as deltas, conform RFC 6902,
+// JavaScript Object Notation (JSON) Patch. Patches operate on the JSON
+// representation, such that they can be transmitted and audited as is.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// MediaType is the (MIME) media type of a patch sequence.
+const MediaType = "application/json-patch+json"
+
+// Operation names
+const (
+	Add     = "add"
+	Remove  = "remove"
+	Replace = "replace"
+	Move    = "move"
+	Copy    = "copy"
+	Test    = "test"
+)
+
+// Patch is a single operation. Path and From are JSON Pointers, conform
+// RFC 6901.
+type Patch struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ErrTest signals a failed "test" operation.
+var ErrTest = errors.New("JSON Patch test failed")
+
+// Diff returns the operations which turn old into new. Arrays of equal length
+// patch per element. Otherwise, the elements in between a common head and tail
+// are removed and added.
+func Diff(old, new *backend.Document) ([]Patch, error) {
+	a, err := toValue(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toValue(new)
+	if err != nil {
+		return nil, err
+	}
+	var patches []Patch
+	if err := diff(&patches, "", a, b); err != nil {
+		return nil, err
+	}
+	return patches, nil
+}
+
+func diff(patches *[]Patch, path string, a, b any) error {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + escape(k)
+			av, inA := a[k]
+			bv, inB := b[k]
+			switch {
+			case !inB:
+				*patches = append(*patches, Patch{Op: Remove, Path: p})
+			case !inA:
+				if err := appendValue(patches, Add, p, bv); err != nil {
+					return err
+				}
+			default:
+				if err := diff(patches, p, av, bv); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+
+	case []any:
+		b, ok := b.([]any)
+		if !ok {
+			break
+		}
+		if len(a) == len(b) {
+			for i := range a {
+				if err := diff(patches, path+"/"+strconv.Itoa(i), a[i], b[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		var head, tail int
+		for head < len(a) && head < len(b) && reflect.DeepEqual(a[head], b[head]) {
+			head++
+		}
+		for tail < len(a)-head && tail < len(b)-head && reflect.DeepEqual(a[len(a)-1-tail], b[len(b)-1-tail]) {
+			tail++
+		}
+		// remove backwards to keep the indices in place
+		for i := len(a) - tail - 1; i >= head; i-- {
+			*patches = append(*patches, Patch{Op: Remove, Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := head; i < len(b)-tail; i++ {
+			if err := appendValue(patches, Add, path+"/"+strconv.Itoa(i), b[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return appendValue(patches, Replace, path, b)
+}
+
+func appendValue(patches *[]Patch, op, path string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	*patches = append(*patches, Patch{Op: op, Path: path, Value: raw})
+	return nil
+}
+
+// Apply returns the result of patches on doc. The operations are atomic, i.e.,
+// doc remains unmodified. Errors other than ErrTest wrap backend.ErrInvalid.
+func Apply(doc *backend.Document, patches []Patch) (*backend.Document, error) {
+	v, err := toValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range patches {
+		v, err = apply(v, p)
+		if err != nil {
+			if errors.Is(err, ErrTest) {
+				return nil, fmt.Errorf("JSON Patch operation № %d: %w", i+1, err)
+			}
+			return nil, fmt.Errorf("%w: JSON Patch operation № %d: %w", backend.ErrInvalid, i+1, err)
+		}
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	patched := new(backend.Document)
+	if err := json.Unmarshal(raw, patched); err != nil {
+		return nil, fmt.Errorf("%w: patched document: %w", backend.ErrInvalid, err)
+	}
+	return patched, nil
+}
+
+func apply(doc any, p Patch) (any, error) {
+	path, err := parsePointer(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch p.Op {
+	case Add, Replace, Test:
+		if p.Value == nil {
+			return nil, fmt.Errorf("%s %q has no value", p.Op, p.Path)
+		}
+		value, err := decode(p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q value: %w", p.Op, p.Path, err)
+		}
+		switch p.Op {
+		case Add:
+			return add(doc, path, value)
+		case Replace:
+			doc, _, err = remove(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			got, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(got, value) {
+				return nil, fmt.Errorf("%w: %q does not match", ErrTest, p.Path)
+			}
+			return doc, nil
+		}
+
+	case Remove:
+		doc, _, err = remove(doc, path)
+		return doc, err
+
+	case Move, Copy:
+		from, err := parsePointer(p.From)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if p.Op == Move {
+			// “The "from" location MUST NOT be a proper prefix of the "path" location”
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, fmt.Errorf("move from %q into its own child %q", p.From, p.Path)
+			}
+			doc, value, err = remove(doc, from)
+		} else {
+			value, err = get(doc, from)
+			if err == nil {
+				// no shared state with the source
+				value, err = clone(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+
+	default:
+		return nil, fmt.Errorf("unknown op %q", p.Op)
+	}
+}
+
+// ParsePointer returns the reference tokens of a JSON Pointer.
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("JSON Pointer %q does not start with a slash", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		// “first transforming any occurrence of the sequence '~1' to '/',
+		// and then transforming any occurrence of the sequence '~0' to '~'”
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// Index parses an array index, with len(array) for "-" when end is set.
+func index(token string, array []any, end bool) (int, error) {
+	if token == "-" && end {
+		return len(array), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("array index %q is not a number", token)
+	}
+	max := len(array)
+	if !end {
+		max--
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, t := range path {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			doc, ok = v[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", t)
+			}
+		case []any:
+			i, err := index(t, v, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("pointer token %q on a primitive", t)
+		}
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	t := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		v[t] = value
+		return doc, nil
+	case []any:
+		i, err := index(t, v, true)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, nil)
+		copy(v[i+1:], v[i:])
+		v[i] = value
+		return set(doc, path[:len(path)-1], v)
+	default:
+		return nil, fmt.Errorf("add %q to a primitive", t)
+	}
+}
+
+func remove(doc any, path []string) (root, removed any, err error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	t := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		removed, ok := v[t]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", t)
+		}
+		delete(v, t)
+		return doc, removed, nil
+	case []any:
+		i, err := index(t, v, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := v[i]
+		v = append(v[:i:i], v[i+1:]...)
+		doc, err = set(doc, path[:len(path)-1], v)
+		return doc, removed, err
+	default:
+		return nil, nil, fmt.Errorf("remove %q from a primitive", t)
+	}
+}
+
+// Set replaces the value at path, as arrays change on resize.
+func set(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	t := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		v[t] = value
+	case []any:
+		i, err := index(t, v, false)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = value
+	}
+	return doc, nil
+}
+
+func toValue(doc *backend.Document) (any, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return decode(raw)
+}
+
+func clone(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decode(raw)
+}
+
+// Decode retains numbers as is.
+func decode(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("data after JSON value")
+	}
+	return v, nil
+}
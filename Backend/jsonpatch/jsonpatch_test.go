@@ -0,0 +1,101 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func parseDoc(t *testing.T, s string) *backend.Document {
+	t.Helper()
+	doc := new(backend.Document)
+	if err := json.Unmarshal([]byte(s), doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDiff(t *testing.T) {
+	old := parseDoc(t, `{"id":"did:example:123","alsoKnownAs":["https://a.example/","https://b.example/","https://c.example/"],"service":[{"id":"#agent","type":"Agent","serviceEndpoint":"https://agent.example.com/"}]}`)
+	new := parseDoc(t, `{"id":"did:example:123","alsoKnownAs":["https://a.example/","https://c.example/"],"controller":"did:example:456","service":[{"id":"#agent","type":"Agent","serviceEndpoint":"https://agent2.example.com/"}]}`)
+
+	patches, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(patches)
+	const want = `[{"op":"remove","path":"/alsoKnownAs/1"},{"op":"add","path":"/controller","value":["did:example:456"]},{"op":"replace","path":"/service/0/serviceEndpoint","value":"https://agent2.example.com/"}]`
+	if string(got) != want {
+		t.Errorf("got patches %s\nwant %s", got, want)
+	}
+
+	patched, err := Apply(old, patches)
+	if err != nil {
+		t.Fatal("apply error:", err)
+	}
+	gotDoc, _ := json.Marshal(patched)
+	wantDoc, _ := json.Marshal(new)
+	if string(gotDoc) != string(wantDoc) {
+		t.Errorf("apply got %s\nwant %s", gotDoc, wantDoc)
+	}
+
+	if patches, err := Diff(new, new); err != nil || len(patches) != 0 {
+		t.Errorf("diff on equal documents got %v, error %v", patches, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := parseDoc(t, `{"id":"did:example:123","alsoKnownAs":["https://a.example/"]}`)
+
+	golden := []struct {
+		patches string
+		want    string // JSON or error
+	}{
+		{`[{"op":"add","path":"/alsoKnownAs/0","value":"https://0.example/"}]`,
+			`{"id":"did:example:123","alsoKnownAs":["https://0.example/","https://a.example/"]}`},
+		{`[{"op":"add","path":"/alsoKnownAs/-","value":"https://z.example/"}]`,
+			`{"id":"did:example:123","alsoKnownAs":["https://a.example/","https://z.example/"]}`},
+		{`[{"op":"copy","from":"/id","path":"/controller"}]`,
+			`{"id":"did:example:123","alsoKnownAs":["https://a.example/"],"controller":["did:example:123"]}`},
+		{`[{"op":"move","from":"/alsoKnownAs/0","path":"/alsoKnownAs/-"}]`,
+			`{"id":"did:example:123","alsoKnownAs":["https://a.example/"]}`},
+		{`[{"op":"test","path":"/alsoKnownAs/0","value":"https://a.example/"},{"op":"remove","path":"/alsoKnownAs"}]`,
+			`{"id":"did:example:123"}`},
+		{`[{"op":"test","path":"/id","value":"did:example:456"}]`,
+			`JSON Patch operation № 1: JSON Patch test failed: "/id" does not match`},
+		{`[{"op":"remove","path":"/alsoKnownAs/1"}]`,
+			`invalid DID: JSON Patch operation № 1: array index 1 out of bounds`},
+		{`[{"op":"move","from":"/alsoKnownAs","path":"/alsoKnownAs/0"}]`,
+			`invalid DID: JSON Patch operation № 1: move from "/alsoKnownAs" into its own child "/alsoKnownAs/0"`},
+		{`[{"op":"replace","path":"/id","value":"no DID"}]`,
+			`invalid DID: patched document: JSON string content: invalid DID "no DID": illegal 'n' at byte № 1`},
+	}
+	for _, gold := range golden {
+		var patches []Patch
+		if err := json.Unmarshal([]byte(gold.patches), &patches); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Apply(doc, patches)
+		if err != nil {
+			if err.Error() != gold.want {
+				t.Errorf("%s got error %q, want %q", gold.patches, err, gold.want)
+			}
+			continue
+		}
+		if b, _ := json.Marshal(got); string(b) != gold.want {
+			t.Errorf("%s got %s, want %s", gold.patches, b, gold.want)
+		}
+	}
+
+	// atomic operation
+	if b, _ := json.Marshal(doc); string(b) != `{"id":"did:example:123","alsoKnownAs":["https://a.example/"]}` {
+		t.Errorf("document modified to %s", b)
+	}
+
+	_, err := Apply(doc, []Patch{{Op: Test, Path: "/id", Value: json.RawMessage(`"did:example:0"`)}})
+	if !errors.Is(err, ErrTest) {
+		t.Errorf("got error %v, want ErrTest", err)
+	}
+}
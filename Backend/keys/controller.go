@@ -0,0 +1,102 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// ControllerDepthMax limits the chain of controllers in VerifyController.
+const ControllerDepthMax = 4
+
+// ErrUnauthorized signals a key which is not authorized by any controller.
+var ErrUnauthorized = errors.New("key not authorized by a DID controller")
+
+// VerifyController checks sig on data against the verification method keyID,
+// granted the method is a "capabilityInvocation" of a controller of doc, as
+// required for update operations. The controllers are the "controller" of
+// doc, or its Subject when absent. Controllers with a "controller" of their
+// own delegate to those, recursively, up to ControllerDepthMax levels deep.
+// Cycles end the chain. Documents of controllers other than the Subject come
+// from r, and deactivated ones authorize nothing. A relative keyID resolves
+// against the Subject of doc. The return is the verification method which
+// signed. Unauthorized keys get ErrUnauthorized.
+func VerifyController(ctx context.Context, doc *backend.Document, r backend.Resolver, keyID string, data, sig []byte) (*backend.VerificationMethod, error) {
+	id, err := backend.ParseURL(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("signature key id: %w", err)
+	}
+	if id.IsRelative() {
+		id.DID = doc.Subject
+	}
+
+	// breadth-first, such that the shortest chain wins
+	visited := map[string]bool{doc.Subject.Canonical(): len(doc.Controllers) != 0}
+	level := controllers(doc)
+	var resolveErr error // first one, if any
+	for depth := 1; depth <= ControllerDepthMax && len(level) != 0; depth++ {
+		var next []backend.DID
+		for _, c := range level {
+			key := c.Canonical()
+			if visited[key] {
+				continue // cycle
+			}
+			visited[key] = true
+
+			cdoc := doc
+			if c != doc.Subject {
+				var meta *backend.Meta
+				cdoc, meta, err = r.Resolve(ctx, c)
+				if errors.Is(err, backend.ErrDeactivated) {
+					continue
+				}
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, err
+					}
+					if resolveErr == nil {
+						resolveErr = fmt.Errorf("DID controller %s: %w", c.String(), err)
+					}
+					continue
+				}
+				if meta != nil && !meta.Deactivated.IsZero() {
+					continue
+				}
+			}
+
+			if id.DID.Equal(c) {
+				m := cdoc.AuthorizedMethod(cdoc.CapabilityInvocation, id)
+				if m == nil {
+					continue
+				}
+				pub, err := MethodKey(m)
+				if err != nil {
+					return nil, err
+				}
+				if err := Verify(pub, data, sig); err != nil {
+					return nil, fmt.Errorf("DID verification method %s: %w", id.String(), err)
+				}
+				return m, nil
+			}
+			if len(cdoc.Controllers) != 0 {
+				next = append(next, cdoc.Controllers...)
+			}
+		}
+		level = next
+	}
+
+	if resolveErr != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrUnauthorized, id.String(), resolveErr)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnauthorized, id.String())
+}
+
+// Controllers returns the controllers of doc, with its Subject when absent.
+func controllers(doc *backend.Document) []backend.DID {
+	if len(doc.Controllers) != 0 {
+		return doc.Controllers
+	}
+	return []backend.DID{doc.Subject}
+}
@@ -0,0 +1,215 @@
+// Package keys generates key pairs for DID documents, and converts public keys
+// between their Go, JWK and Multibase representations.
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/jose"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Type identifies the kind of key pair.
+type Type string
+
+// Supported key types
+const (
+	Ed25519   Type = "Ed25519"
+	X25519    Type = "X25519"
+	Secp256k1 Type = "secp256k1"
+	P256      Type = "P-256"
+	P384      Type = "P-384"
+	P521      Type = "P-521"
+)
+
+// ErrKeyType signals an unsupported (or malformed) kind of key. It is the
+// sentinel of packages jose and didkey, which MethodKey passes on.
+var ErrKeyType = jose.ErrKeyType
+
+// Generate returns a new private key of the type, which is either an
+// ed25519.PrivateKey, an X25519 *ecdh.PrivateKey, a *Secp256k1PrivateKey, or
+// an *ecdsa.PrivateKey.
+func Generate(t Type) (crypto.PrivateKey, error) {
+	switch t {
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case X25519:
+		return ecdh.X25519().GenerateKey(rand.Reader)
+	case Secp256k1:
+		return GenerateSecp256k1(rand.Reader)
+	case P256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case P384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case P521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrKeyType, t)
+}
+
+// Signer returns key as a crypto.Signer. Key agreement keys (X25519) get
+// ErrKeyType.
+func Signer(key crypto.PrivateKey) (crypto.Signer, error) {
+	switch key := key.(type) {
+	case ed25519.PrivateKey, *ecdsa.PrivateKey, *Secp256k1PrivateKey:
+		return key.(crypto.Signer), nil
+	case *ecdh.PrivateKey:
+		return nil, fmt.Errorf("%w: ECDH keys do not sign", ErrKeyType)
+	}
+	return nil, fmt.Errorf("%w: Go type %T", ErrKeyType, key)
+}
+
+// Public returns the public key of a Generate return.
+func Public(key crypto.PrivateKey) (crypto.PublicKey, error) {
+	if k, ok := key.(*ecdh.PrivateKey); ok {
+		return k.PublicKey(), nil
+	}
+	s, err := Signer(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Public(), nil
+}
+
+// TypeOf returns the key type of pub.
+func TypeOf(pub crypto.PublicKey) (Type, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return Ed25519, nil
+	case *ecdh.PublicKey:
+		if pub.Curve() == ecdh.X25519() {
+			return X25519, nil
+		}
+	case didkey.Secp256k1PublicKey:
+		return Secp256k1, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return P256, nil
+		case elliptic.P384():
+			return P384, nil
+		case elliptic.P521():
+			return P521, nil
+		}
+		return "", fmt.Errorf("%w: ECDSA curve %s", ErrKeyType, pub.Curve.Params().Name)
+	}
+	return "", fmt.Errorf("%w: Go type %T", ErrKeyType, pub)
+}
+
+// JWK returns the JSON Web Key of pub. In addition to jose.NewJWK, secp256k1
+// keys are supported conform RFC 8812.
+func JWK(pub crypto.PublicKey) (*jose.JWK, error) {
+	if pub, ok := pub.(didkey.Secp256k1PublicKey); ok {
+		p, err := decompress(pub)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrKeyType, err)
+		}
+		point := p.SerializeUncompressed()
+		return &jose.JWK{
+			Kty: "EC",
+			Crv: "secp256k1",
+			X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+		}, nil
+	}
+	return jose.NewJWK(pub)
+}
+
+// FromJWK returns the public key of k, in the Go representation of Generate.
+func FromJWK(k *jose.JWK) (crypto.PublicKey, error) {
+	if k.Kty == "EC" && k.Crv == "secp256k1" {
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("JWK secp256k1 \"x\": %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("JWK secp256k1 \"y\": %w", err)
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("JWK secp256k1 coordinates have %d and %d bytes, want 32", len(x), len(y))
+		}
+		p, err := secp256k1.ParsePubKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, errors.New("JWK secp256k1 point not on curve")
+		}
+		return didkey.Secp256k1PublicKey(p.SerializeCompressed()), nil
+	}
+	return k.PublicKey()
+}
+
+// Multibase returns the publicKeyMultibase of pub, which is the Multikey
+// encoding of didkey.EncodeKey.
+func Multibase(pub crypto.PublicKey) (string, error) {
+	return didkey.EncodeKey(pub)
+}
+
+// FromMultibase parses the Multibase format.
+func FromMultibase(s string) (crypto.PublicKey, error) {
+	_, pub, err := didkey.DecodeKey(s)
+	return pub, err
+}
+
+// Method Formats
+const (
+	Multikey       = didkey.Multikey       // with publicKeyMultibase
+	JsonWebKey2020 = didkey.JsonWebKey2020 // with publicKeyJwk
+)
+
+// NewMethod returns a verification method for pub in format, which is either
+// Multikey or JsonWebKey2020.
+func NewMethod(id backend.URL, controller backend.DID, pub crypto.PublicKey, format string) (*backend.VerificationMethod, error) {
+	switch format {
+	case Multikey:
+		return didkey.NewMethod(id, controller, pub)
+	case JsonWebKey2020:
+		k, err := JWK(pub)
+		if err != nil {
+			return nil, err
+		}
+		bytes, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		return &backend.VerificationMethod{
+			ID:         id,
+			Type:       JsonWebKey2020,
+			Controller: controller,
+			Additional: map[string]json.RawMessage{"publicKeyJwk": bytes},
+		}, nil
+	}
+	return nil, fmt.Errorf("verification method format %q not supported", format)
+}
+
+// MethodKey returns the public key of a verification method, from either its
+// publicKeyMultibase or its publicKeyJwk.
+func MethodKey(m *backend.VerificationMethod) (crypto.PublicKey, error) {
+	if raw, ok := m.Additional["publicKeyMultibase"]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("DID verification method %s publicKeyMultibase: %w", m.ID.String(), err)
+		}
+		return FromMultibase(s)
+	}
+	if _, ok := m.Additional["publicKeyJwk"]; ok {
+		k, err := jose.ParseMethodJWK(m)
+		if err != nil {
+			return nil, err
+		}
+		return FromJWK(k)
+	}
+	return nil, fmt.Errorf("%w: DID verification method %s has no public key", ErrKeyType, m.ID.String())
+}
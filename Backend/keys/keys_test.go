@@ -0,0 +1,276 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+var allTypes = []Type{Ed25519, X25519, Secp256k1, P256, P384, P521}
+
+func TestConversions(t *testing.T) {
+	did := backend.DID{Method: "example", SpecID: "123"}
+	for _, kt := range allTypes {
+		key, err := Generate(kt)
+		if err != nil {
+			t.Fatalf("%s: generate error: %s", kt, err)
+		}
+		pub, err := Public(key)
+		if err != nil {
+			t.Fatalf("%s: public key error: %s", kt, err)
+		}
+		if got, err := TypeOf(pub); err != nil || got != kt {
+			t.Errorf("%s: got type %q, error %v", kt, got, err)
+		}
+
+		k, err := JWK(pub)
+		if err != nil {
+			t.Errorf("%s: JWK error: %s", kt, err)
+		} else if got, err := FromJWK(k); err != nil {
+			t.Errorf("%s: from JWK error: %s", kt, err)
+		} else if !reflect.DeepEqual(got, pub) {
+			t.Errorf("%s: JWK round trip got %v, want %v", kt, got, pub)
+		}
+
+		s, err := Multibase(pub)
+		if err != nil {
+			t.Errorf("%s: multibase error: %s", kt, err)
+		} else if got, err := FromMultibase(s); err != nil {
+			t.Errorf("%s: from multibase %q error: %s", kt, s, err)
+		} else if !reflect.DeepEqual(got, pub) {
+			t.Errorf("%s: multibase round trip got %v, want %v", kt, got, pub)
+		}
+
+		for _, format := range []string{Multikey, JsonWebKey2020} {
+			m, err := NewMethod(backend.URL{DID: did, RawFragment: "#key-1"}, did, pub, format)
+			if err != nil {
+				t.Errorf("%s: %s method error: %s", kt, format, err)
+				continue
+			}
+			got, err := MethodKey(m)
+			if err != nil {
+				t.Errorf("%s: %s method key error: %s", kt, format, err)
+			} else if !reflect.DeepEqual(got, pub) {
+				t.Errorf("%s: %s method got key %v, want %v", kt, format, got, pub)
+			}
+		}
+
+		_, err = Signer(key)
+		if wantErr := kt == X25519; (err != nil) != wantErr {
+			t.Errorf("%s: got signer error %v", kt, err)
+		}
+	}
+}
+
+func TestMethodKeyType(t *testing.T) {
+	id := backend.URL{DID: backend.DID{Method: "example", SpecID: "123"}, RawFragment: "#key-1"}
+	rsa := &backend.VerificationMethod{ID: id, Additional: map[string]json.RawMessage{
+		"publicKeyJwk": json.RawMessage(`{"kty":"RSA","n":"AQAB","e":"AQAB"}`),
+	}}
+	// multicodec 0x1205 is an RSA public key
+	unknown := &backend.VerificationMethod{ID: id, Additional: map[string]json.RawMessage{
+		"publicKeyMultibase": json.RawMessage(`"` + multiformat.Encode(multiformat.Base58BTC, multiformat.AddPrefix(0x1205, []byte{1, 2, 3})) + `"`),
+	}}
+	for _, m := range []*backend.VerificationMethod{rsa, unknown} {
+		if _, err := MethodKey(m); !errors.Is(err, ErrKeyType) {
+			t.Errorf("%s got error %v, want ErrKeyType", m.Additional, err)
+		}
+	}
+}
+
+func TestSecp256k1(t *testing.T) {
+	// generator point as public key of scalar 1
+	one, err := NewSecp256k1(append(make([]byte, 31), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	if got := hex.EncodeToString(one.Public().(didkey.Secp256k1PublicKey)); got != want {
+		t.Errorf("got public key %s, want %s", got, want)
+	}
+
+	key, err := GenerateSecp256k1(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := key.Sign(rand.Reader, digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.Public().(didkey.Secp256k1PublicKey)
+	if !pub.Valid() {
+		t.Fatal("public key not on curve")
+	}
+	if !VerifySecp256k1(pub, digest[:], sig) {
+		t.Error("signature rejected")
+	}
+	digest[0] ^= 1
+	if VerifySecp256k1(pub, digest[:], sig) {
+		t.Error("signature of other digest accepted")
+	}
+	// RFC 6979 nonces need no randomness
+	again, err := key.Sign(nil, digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, _ := key.Sign(nil, digest[:], nil); !bytes.Equal(sig, again) {
+		t.Error("signatures of the same digest differ")
+	}
+
+	if _, err := NewSecp256k1(make([]byte, 32)); !errors.Is(err, ErrKeyType) {
+		t.Errorf("zero secret got error %v, want ErrKeyType", err)
+	}
+
+	if _, err := Generate("RSA"); !errors.Is(err, ErrKeyType) {
+		t.Errorf("RSA got error %v, want ErrKeyType", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	did := backend.DID{Method: "example", SpecID: "123"}
+	doc := &backend.Document{Subject: did, AssertionMethod: new(backend.VerificationRelationship)}
+	data := []byte("hello")
+	for i, kt := range []Type{Ed25519, Secp256k1, P256, P384, P521} {
+		key, _ := Generate(kt)
+		signer, err := Signer(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := backend.URL{DID: did, RawFragment: "#key-" + string(kt)}
+		m, err := NewMethod(id, did, signer.Public(), []string{Multikey, JsonWebKey2020}[i%2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+		doc.AssertionMethod.URIRefs = append(doc.AssertionMethod.URIRefs, &backend.URL{RawFragment: id.RawFragment})
+
+		var sig []byte
+		switch kt {
+		case Ed25519:
+			sig, err = signer.Sign(rand.Reader, data, crypto.Hash(0))
+		case P384:
+			sum := sha512.Sum384(data)
+			sig, err = signer.Sign(rand.Reader, sum[:], crypto.SHA384)
+		case P521:
+			sum := sha512.Sum512(data)
+			sig, err = signer.Sign(rand.Reader, sum[:], crypto.SHA512)
+		default:
+			sum := sha256.Sum256(data)
+			sig, err = signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := VerifySignature(doc, "assertionMethod", id.RawFragment, data, sig); err != nil {
+			t.Errorf("%s: got error: %s", kt, err)
+		}
+		if err := VerifySignature(doc, "authentication", id.String(), data, sig); !errors.Is(err, backend.ErrNotFound) {
+			t.Errorf("%s: authentication got error %v, want ErrNotFound", kt, err)
+		}
+		if err := VerifySignature(doc, "assertionMethod", id.String(), []byte("hellO"), sig); !errors.Is(err, ErrSignature) {
+			t.Errorf("%s: other data got error %v, want ErrSignature", kt, err)
+		}
+	}
+}
+
+// DocResolver resolves from a map by method-specific identifier.
+type docResolver map[string]*backend.Document
+
+func (r docResolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, ok := r[did.SpecID]
+	if !ok {
+		return nil, nil, backend.ErrNotFound
+	}
+	return doc, new(backend.Meta), nil
+}
+
+func TestVerifyController(t *testing.T) {
+	key, _ := Generate(Ed25519)
+	signer, err := Signer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("update")
+	sig, err := signer.Sign(rand.Reader, data, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// document of did:example:<name> with controllers
+	newDoc := func(name string, controllers ...string) *backend.Document {
+		doc := &backend.Document{Subject: backend.DID{Method: "example", SpecID: name}}
+		for _, c := range controllers {
+			doc.Controllers = append(doc.Controllers, backend.DID{Method: "example", SpecID: c})
+		}
+		return doc
+	}
+	// invocation key on did:example:<name>
+	withKey := func(doc *backend.Document) *backend.Document {
+		id := backend.URL{DID: doc.Subject, RawFragment: "#update"}
+		m, err := NewMethod(id, doc.Subject, signer.Public(), Multikey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+		doc.CapabilityInvocation = &backend.VerificationRelationship{URIRefs: []*backend.URL{{RawFragment: "#update"}}}
+		return doc
+	}
+
+	r := docResolver{
+		"alice": withKey(newDoc("alice")),
+		"bob":   newDoc("bob", "alice"),
+		"carol": newDoc("carol", "dave"),
+		"dave":  newDoc("dave", "carol"),
+		"e1":    newDoc("e1", "e2"),
+		"e2":    newDoc("e2", "e3"),
+		"e3":    newDoc("e3", "e4"),
+		"e4":    newDoc("e4", "e5"),
+		"e5":    withKey(newDoc("e5")),
+	}
+
+	tests := []struct {
+		doc     *backend.Document
+		keyID   string
+		wantErr error
+	}{
+		{withKey(newDoc("self")), "#update", nil},
+		{newDoc("subject", "alice"), "did:example:alice#update", nil},
+		{newDoc("subject", "bob"), "did:example:alice#update", nil},
+		{newDoc("subject", "carol"), "did:example:alice#update", ErrUnauthorized},
+		{newDoc("subject", "e1"), "did:example:e5#update", ErrUnauthorized},
+		{newDoc("subject", "e2"), "did:example:e5#update", nil},
+		{newDoc("subject", "alice"), "#update", ErrUnauthorized},
+		{newDoc("subject", "unknown"), "did:example:unknown#update", backend.ErrNotFound},
+		{withKey(newDoc("subject", "alice")), "#update", ErrUnauthorized},
+	}
+	for _, test := range tests {
+		m, err := VerifyController(context.Background(), test.doc, r, test.keyID, data, sig)
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("%s with controllers %v got error: %s", test.keyID, test.doc.Controllers, err)
+		case test.wantErr == nil && m.ID.RawFragment != "#update":
+			t.Errorf("%s with controllers %v got verification method %s", test.keyID, test.doc.Controllers, m.ID.String())
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("%s with controllers %v got error %v, want %v", test.keyID, test.doc.Controllers, err, test.wantErr)
+		}
+	}
+
+	_, err = VerifyController(context.Background(), newDoc("subject", "alice"), r, "did:example:alice#update", []byte("forged"), sig)
+	if !errors.Is(err, ErrSignature) {
+		t.Errorf("forged data got error %v, want ErrSignature", err)
+	}
+}
@@ -0,0 +1,78 @@
+package keys
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+
+	"EncrypteDL/IDChain/Backend/didkey"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Secp256k1PrivateKey signs with ECDSA on secp256k1, as the standard library
+// has no support for the curve. The arithmetic is constant-time, and nonces
+// are deterministic conform RFC 6979.
+type Secp256k1PrivateKey struct {
+	key *secp256k1.PrivateKey
+}
+
+// NewSecp256k1 returns the key of a 32-byte, big-endian secret scalar in
+// [1, n − 1].
+func NewSecp256k1(d []byte) (*Secp256k1PrivateKey, error) {
+	if len(d) != 32 {
+		return nil, fmt.Errorf("%w: secp256k1 secret of %d bytes, want 32", ErrKeyType, len(d))
+	}
+	var s secp256k1.ModNScalar
+	if overflow := s.SetByteSlice(d); overflow || s.IsZero() {
+		return nil, fmt.Errorf("%w: secp256k1 secret out of range", ErrKeyType)
+	}
+	return &Secp256k1PrivateKey{secp256k1.NewPrivateKey(&s)}, nil
+}
+
+// GenerateSecp256k1 returns a new key pair.
+func GenerateSecp256k1(rand io.Reader) (*Secp256k1PrivateKey, error) {
+	key, err := secp256k1.GeneratePrivateKeyFromRand(rand)
+	if err != nil {
+		return nil, fmt.Errorf("secp256k1 scalar unavailable: %w", err)
+	}
+	return &Secp256k1PrivateKey{key}, nil
+}
+
+// Public implements the crypto.Signer interface. The return is a
+// didkey.Secp256k1PublicKey.
+func (k *Secp256k1PrivateKey) Public() crypto.PublicKey {
+	return didkey.Secp256k1PublicKey(k.key.PubKey().SerializeCompressed())
+}
+
+// Sign implements the crypto.Signer interface. The digest is the hash of the
+// message, and the signature is in ASN.1 DER, as with crypto/ecdsa. S is
+// normalized to the lower half of the order. The nonce comes from RFC 6979,
+// which is why rand is not used.
+func (k *Secp256k1PrivateKey) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return ecdsa.Sign(k.key, digest).Serialize(), nil
+}
+
+// VerifySecp256k1 returns whether sig is an ASN.1 DER signature of digest by
+// pub.
+func VerifySecp256k1(pub didkey.Secp256k1PublicKey, digest, sig []byte) bool {
+	q, err := decompress(pub)
+	if err != nil {
+		return false
+	}
+	parsed, err := ecdsa.ParseDERSignature(sig)
+	if err != nil {
+		return false
+	}
+	return parsed.Verify(digest, q)
+}
+
+// Decompress returns the point of a valid key.
+func decompress(pub didkey.Secp256k1PublicKey) (*secp256k1.PublicKey, error) {
+	if !pub.Valid() {
+		return nil, errors.New("malformed secp256k1 public key")
+	}
+	return secp256k1.ParsePubKey(pub)
+}
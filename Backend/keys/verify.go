@@ -0,0 +1,108 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+)
+
+// ErrSignature signals a signature mismatch.
+var ErrSignature = errors.New("signature verification failed")
+
+// VerifySignature checks sig on data against the verification method keyID,
+// granted the method is authorized for relationship in doc, e.g., with
+// "assertionMethod". A relative keyID resolves against the Subject of doc.
+// Absent methods get backend.ErrNotFound. See Verify for the signatures.
+func VerifySignature(doc *backend.Document, relationship, keyID string, data, sig []byte) error {
+	id, err := backend.ParseURL(keyID)
+	if err != nil {
+		return fmt.Errorf("signature key id: %w", err)
+	}
+	if id.IsRelative() {
+		id.DID = doc.Subject
+	}
+	m := doc.AuthorizedMethod(doc.Relationship(relationship), id)
+	if m == nil {
+		return fmt.Errorf("%w: no %s method %s in DID document", backend.ErrNotFound, relationship, id.String())
+	}
+	pub, err := MethodKey(m)
+	if err != nil {
+		return err
+	}
+	if err := Verify(pub, data, sig); err != nil {
+		return fmt.Errorf("DID verification method %s: %w", id.String(), err)
+	}
+	return nil
+}
+
+// Verify checks sig on data against pub. Ed25519 signs the data as is. ECDSA
+// signs the SHA-256 of data, or SHA-384 with P-384, or SHA-512 with P-521,
+// with either the fixed-size encoding of JWA (R‖S), or with ASN.1 DER.
+func Verify(pub crypto.PublicKey, data, sig []byte) error {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig) {
+			return ErrSignature
+		}
+		return nil
+
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch pub.Curve {
+		case elliptic.P384():
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		case elliptic.P521():
+			sum := sha512.Sum512(data)
+			digest = sum[:]
+		default:
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			if !ecdsa.Verify(pub, digest, r, s) {
+				return ErrSignature
+			}
+			return nil
+		}
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return ErrSignature
+		}
+		return nil
+
+	case didkey.Secp256k1PublicKey:
+		digest := sha256.Sum256(data)
+		if len(sig) == 64 {
+			der, err := asn1.Marshal(struct{ R, S *big.Int }{
+				new(big.Int).SetBytes(sig[:32]),
+				new(big.Int).SetBytes(sig[32:]),
+			})
+			if err != nil {
+				return err
+			}
+			sig = der
+		}
+		if !VerifySecp256k1(pub, digest[:], sig) {
+			return ErrSignature
+		}
+		return nil
+
+	case *ecdh.PublicKey:
+		return fmt.Errorf("%w: ECDH keys do not sign", ErrKeyType)
+	}
+	return fmt.Errorf("%w: Go type %T", ErrKeyType, pub)
+}
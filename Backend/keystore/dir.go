@@ -0,0 +1,110 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirStorage is a Storage with one file per key in a directory. Slashes in
+// keys map to subdirectories. Files are private to the user (mode 0600), and
+// they are replaced atomically.
+type DirStorage struct {
+	Dir string
+}
+
+// Path returns the file of key, or false when key escapes the directory.
+func (d *DirStorage) path(key string) (string, bool) {
+	for _, elem := range strings.Split(key, "/") {
+		if elem == "" || elem == "." || elem == ".." || strings.HasPrefix(elem, ".tmp-") {
+			return "", false
+		}
+	}
+	return filepath.Join(d.Dir, filepath.FromSlash(key)), true
+}
+
+// Get implements the Storage interface.
+func (d *DirStorage) Get(key string) ([]byte, error) {
+	path, ok := d.path(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	v, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return v, err
+}
+
+// Put implements the Storage interface.
+func (d *DirStorage) Put(key string, value []byte) error {
+	path, ok := d.path(key)
+	if !ok {
+		return fmt.Errorf("keystore storage key %q malformed", key)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after rename
+	_, err = f.Write(value)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Delete implements the Storage interface.
+func (d *DirStorage) Delete(key string) error {
+	path, ok := d.path(key)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return err
+}
+
+// List implements the Storage interface.
+func (d *DirStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.Dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == d.Dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Dir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
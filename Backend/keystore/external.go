@@ -0,0 +1,61 @@
+package keystore
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+// External is a KeyStore with keys held by another system, such as an HSM or a
+// cloud KMS, which exposes them as crypto.Signer through its Go SDK. Private
+// keys never pass through the KeyStore. Functions left nil get
+// errors.ErrUnsupported.
+type External struct {
+	// Open returns the signer of ref, or ErrNotFound.
+	Open func(ref string) (crypto.Signer, error)
+
+	// Refs lists the available keys.
+	Refs func() ([]string, error)
+
+	// New creates a key pair.
+	New func(KeyType) (ref string, key crypto.Signer, err error)
+
+	// Remove destroys a key pair.
+	Remove func(ref string) error
+}
+
+// Create implements the KeyStore interface.
+func (e *External) Create(kt KeyType) (string, crypto.PublicKey, error) {
+	if e.New == nil {
+		return "", nil, fmt.Errorf("external keystore creation: %w", errors.ErrUnsupported)
+	}
+	ref, key, err := e.New(kt)
+	if err != nil {
+		return "", nil, err
+	}
+	return ref, key.Public(), nil
+}
+
+// Signer implements the KeyStore interface.
+func (e *External) Signer(ref string) (crypto.Signer, error) {
+	if e.Open == nil {
+		return nil, fmt.Errorf("external keystore signing: %w", errors.ErrUnsupported)
+	}
+	return e.Open(ref)
+}
+
+// List implements the KeyStore interface.
+func (e *External) List() ([]string, error) {
+	if e.Refs == nil {
+		return nil, fmt.Errorf("external keystore listing: %w", errors.ErrUnsupported)
+	}
+	return e.Refs()
+}
+
+// Delete implements the KeyStore interface.
+func (e *External) Delete(ref string) error {
+	if e.Remove == nil {
+		return fmt.Errorf("external keystore deletion: %w", errors.ErrUnsupported)
+	}
+	return e.Remove(ref)
+}
@@ -0,0 +1,66 @@
+// Package keystore manages private keys for DID operations and proofs. Keys
+// are addressed by reference, such that private key material need not leave
+// the backend in use. Backends include Memory, Sealed and Passphrase for keys
+// in software, TPM for a local device, and External for an HSM or a cloud KMS.
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+)
+
+// KeyType identifies the kind of key pair.
+type KeyType string
+
+// Supported key types
+const (
+	Ed25519 KeyType = "Ed25519"
+	P256    KeyType = "P-256"
+	P384    KeyType = "P-384"
+)
+
+// ErrNotFound signals an unknown key reference.
+var ErrNotFound = errors.New("key not found in keystore")
+
+// ErrKeyType signals a key type not supported by the backend.
+var ErrKeyType = errors.New("key type not supported by keystore")
+
+// KeyStore is a backend for private keys. Implementations must be safe for
+// concurrent use.
+type KeyStore interface {
+	// Create generates a new key pair. The reference is unique within the
+	// KeyStore.
+	Create(KeyType) (ref string, pub crypto.PublicKey, err error)
+
+	// Signer returns the key pair of ref. The public key is available
+	// without a round trip to the backend.
+	Signer(ref string) (crypto.Signer, error)
+
+	// List returns all references in the KeyStore.
+	List() ([]string, error)
+
+	// Delete removes a key pair. Deletion of an unknown reference gets
+	// ErrNotFound.
+	Delete(ref string) error
+}
+
+// TypeOf returns the key type of pub.
+func TypeOf(pub crypto.PublicKey) (KeyType, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return Ed25519, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return P256, nil
+		case elliptic.P384():
+			return P384, nil
+		}
+		return "", fmt.Errorf("%w: ECDSA curve %s", ErrKeyType, pub.Curve.Params().Name)
+	}
+	return "", fmt.Errorf("%w: Go type %T", ErrKeyType, pub)
+}
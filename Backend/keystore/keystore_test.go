@@ -0,0 +1,345 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+func TestMemory(t *testing.T) {
+	var store Memory
+	for _, kt := range []KeyType{Ed25519, P256, P384} {
+		ref, pub, err := store.Create(kt)
+		if err != nil {
+			t.Fatalf("%q got error: %s", kt, err)
+		}
+		if got, err := TypeOf(pub); err != nil || got != kt {
+			t.Errorf("%q got type %q, error %v", kt, got, err)
+		}
+
+		signer, err := store.Signer(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte("hello")
+		switch pub := pub.(type) {
+		case ed25519.PublicKey:
+			sig, err := signer.Sign(rand.Reader, msg, crypto.Hash(0))
+			if err != nil || !ed25519.Verify(pub, msg, sig) {
+				t.Errorf("%q signature invalid, error %v", kt, err)
+			}
+		case *ecdsa.PublicKey:
+			digest := sha256.Sum256(msg)
+			sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil || !ecdsa.VerifyASN1(pub, digest[:], sig) {
+				t.Errorf("%q signature invalid, error %v", kt, err)
+			}
+		}
+	}
+
+	refs, err := store.List()
+	if err != nil || len(refs) != 3 {
+		t.Fatalf("got references %q, error %v", refs, err)
+	}
+	if err := store.Delete(refs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Signer(refs[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted key got error %v, want ErrNotFound", err)
+	}
+	if _, _, err := store.Create("RSA"); !errors.Is(err, ErrKeyType) {
+		t.Errorf("RSA got error %v, want ErrKeyType", err)
+	}
+}
+
+// TestAttestation mimics TPM2_Certify with a software attestation key, such
+// that it runs without TPM. The device tests are in tpm_test.go, with build
+// tag tpm.
+func TestAttestation(t *testing.T) {
+	ak, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("relying party nonce")
+
+	certify := func(public tpm2.TPMTPublic) *Attestation {
+		name, err := tpm2.ObjectName(&public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := tpm2.Marshal(tpm2.TPMSAttest{
+			Magic:     tpm2.TPMGeneratedValue,
+			Type:      tpm2.TPMSTAttestCertify,
+			ExtraData: tpm2.TPM2BData{Buffer: nonce},
+			Attested: tpm2.NewTPMUAttest(tpm2.TPMSTAttestCertify,
+				&tpm2.TPMSCertifyInfo{Name: *name}),
+		})
+		digest := sha256.Sum256(info)
+		r, s, err := ecdsa.Sign(rand.Reader, ak, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := tpm2.Marshal(tpm2.TPMTSignature{
+			SigAlg: tpm2.TPMAlgECDSA,
+			Signature: tpm2.NewTPMUSignature(tpm2.TPMAlgECDSA, &tpm2.TPMSSignatureECC{
+				Hash:       tpm2.TPMAlgSHA256,
+				SignatureR: tpm2.TPM2BECCParameter{Buffer: r.Bytes()},
+				SignatureS: tpm2.TPM2BECCParameter{Buffer: s.Bytes()},
+			}),
+		})
+		return &Attestation{Public: tpm2.Marshal(public), CertifyInfo: info, Signature: sig}
+	}
+
+	public := signingTemplate(false)
+	public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+		X: tpm2.TPM2BECCParameter{Buffer: key.X.FillBytes(make([]byte, 32))},
+		Y: tpm2.TPM2BECCParameter{Buffer: key.Y.FillBytes(make([]byte, 32))},
+	})
+	a := certify(public)
+	got, err := a.Verify(&ak.PublicKey, nonce)
+	if err != nil {
+		t.Fatal("attestation error:", err)
+	}
+	if !got.Equal(&key.PublicKey) {
+		t.Error("attested key differs")
+	}
+
+	if _, err := a.Verify(&key.PublicKey, nonce); !errors.Is(err, ErrAttestation) {
+		t.Errorf("foreign attestation key got error %v, want ErrAttestation", err)
+	}
+	if _, err := a.Verify(&ak.PublicKey, []byte("replay")); !errors.Is(err, ErrAttestation) {
+		t.Errorf("nonce mismatch got error %v, want ErrAttestation", err)
+	}
+
+	// public area swapped after certification
+	other := public
+	other.ObjectAttributes.UserWithAuth = false
+	swapped := *a
+	swapped.Public = tpm2.Marshal(other)
+	if _, err := swapped.Verify(&ak.PublicKey, nonce); !errors.Is(err, ErrAttestation) {
+		t.Errorf("name mismatch got error %v, want ErrAttestation", err)
+	}
+
+	// key imported from outside the TPM
+	imported := public
+	imported.ObjectAttributes.SensitiveDataOrigin = false
+	if _, err := certify(imported).Verify(&ak.PublicKey, nonce); !errors.Is(err, ErrAttestation) {
+		t.Errorf("imported key got error %v, want ErrAttestation", err)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	storage := new(MapStorage)
+	tenants := &Tenants{Storage: storage, MasterKey: make([]byte, 32), Quota: 2}
+	for _, id := range []string{"acme", "globex"} {
+		if err := tenants.Add(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"", "../acme", "a/b", ".."} {
+		if err := tenants.Add(id); !errors.Is(err, ErrTenant) {
+			t.Errorf("tenant %q got error %v, want ErrTenant", id, err)
+		}
+	}
+	if ids, err := tenants.List(); err != nil || len(ids) != 2 || ids[0] != "acme" || ids[1] != "globex" {
+		t.Errorf("got tenants %q, error %v", ids, err)
+	}
+
+	acme, err := tenants.Tenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globex, err := tenants.Tenant("globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, _, err := acme.Create(Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acme.Signer(ref); err != nil {
+		t.Error("own key got error:", err)
+	}
+	if _, err := globex.Signer(ref); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cross-tenant key got error %v, want ErrNotFound", err)
+	}
+	if refs, err := globex.List(); err != nil || len(refs) != 0 {
+		t.Errorf("other tenant lists %q, error %v", refs, err)
+	}
+
+	// blob moved into the namespace of another tenant
+	blob, err := storage.Get("tenants/acme/keys/" + ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Put("tenants/globex/keys/"+ref, blob)
+	if _, err := globex.Signer(ref); !errors.Is(err, ErrSealed) {
+		t.Errorf("moved blob got error %v, want ErrSealed", err)
+	}
+
+	if _, _, err := acme.Create(P256); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := acme.Create(P256); !errors.Is(err, ErrQuota) {
+		t.Errorf("create over quota got error %v, want ErrQuota", err)
+	}
+	importer := acme.(interface {
+		Import(string, crypto.Signer) error
+	})
+	key, err := GenerateKey(P256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := importer.Import("imported", key); !errors.Is(err, ErrQuota) {
+		t.Errorf("import over quota got error %v, want ErrQuota", err)
+	}
+	if err := importer.Import(ref, key); err != nil {
+		t.Error("replacement at quota got error:", err)
+	}
+
+	if err := tenants.Remove("acme"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenants.Tenant("acme"); !errors.Is(err, ErrTenant) {
+		t.Errorf("removed tenant got error %v, want ErrTenant", err)
+	}
+	if names, _ := storage.List("tenants/acme/"); len(names) != 0 {
+		t.Errorf("removed tenant left %q", names)
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	key, err := GenerateKey(Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kdf := range []KDF{{N: 1 << 10}, {Name: Argon2id, Time: 1, Memory: 1 << 10, Threads: 1}} {
+		blob, err := EncryptKey(key, []byte("correct horse"), kdf)
+		if err != nil {
+			t.Fatalf("%s encrypt error: %s", kdf.Name, err)
+		}
+		got, err := DecryptKey(blob, []byte("correct horse"))
+		if err != nil {
+			t.Fatalf("%s decrypt error: %s", kdf.Name, err)
+		}
+		if !got.Public().(ed25519.PublicKey).Equal(key.Public()) {
+			t.Errorf("%s decrypted another key", kdf.Name)
+		}
+		if _, err := DecryptKey(blob, []byte("battery staple")); !errors.Is(err, ErrSealed) {
+			t.Errorf("%s wrong passphrase got error %v, want ErrSealed", kdf.Name, err)
+		}
+	}
+
+	data, err := EncryptData([]byte("secret"), []byte("correct horse"), KDF{N: 1 << 10})
+	if err != nil {
+		t.Fatal("encrypt data error:", err)
+	}
+	if got, err := DecryptData(data, []byte("correct horse")); err != nil || string(got) != "secret" {
+		t.Errorf("decrypt data got %q, error %v", got, err)
+	}
+	if _, err := DecryptKey(data, []byte("correct horse")); err == nil {
+		t.Error("data decrypted as a key")
+	}
+
+	// hostile cost parameters
+	blob, _ := EncryptKey(key, nil, KDF{N: 1 << 10})
+	blob = bytes.Replace(blob, []byte(`"n":1024`), []byte(`"n":1073741824`), 1)
+	if _, err := DecryptKey(blob, nil); err == nil || errors.Is(err, ErrSealed) {
+		t.Errorf("excessive scrypt cost got error %v", err)
+	}
+	for _, hostile := range []KDF{
+		{Name: Scrypt, N: 1 << 10, R: 8, P: KDFPassesMax + 1},
+		{Name: Argon2id, Time: KDFPassesMax + 1, Memory: 1 << 10, Threads: 1},
+		{Name: Argon2id, Time: 1, Memory: 1 << 10, Threads: KDFThreadsMax + 1},
+	} {
+		if _, err := hostile.deriveKey(nil); err == nil {
+			t.Errorf("excessive %s cost %+v got no error", hostile.Name, hostile)
+		}
+	}
+
+	dir := t.TempDir()
+	store := &Passphrase{Storage: &DirStorage{Dir: dir}, Passphrase: []byte("pass"), KDF: KDF{N: 1 << 10}}
+	ref, pub, err := store.Create(P256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "keys", ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file has mode %s", info.Mode())
+	}
+	reopened := &Passphrase{Storage: &DirStorage{Dir: dir}, Passphrase: []byte("pass")}
+
+	// entries are bound to their reference
+	other, _, err := store.Create(P256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped, err := os.ReadFile(filepath.Join(dir, "keys", ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Storage.Put("keys/"+other, swapped); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Signer(other); !errors.Is(err, ErrSealed) {
+		t.Errorf("swapped entry got error %v, want ErrSealed", err)
+	}
+	if err := reopened.Delete(other); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := reopened.Signer(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Public().(*ecdsa.PublicKey).Equal(pub) {
+		t.Error("reopened keystore has another key")
+	}
+	if refs, err := reopened.List(); err != nil || len(refs) != 1 || refs[0] != ref {
+		t.Errorf("got references %q, error %v", refs, err)
+	}
+	if err := reopened.Delete(ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Signer(ref); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted key got error %v, want ErrNotFound", err)
+	}
+	if _, err := (&DirStorage{Dir: dir}).Get("../escape"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("path traversal got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestExternal(t *testing.T) {
+	var hsm Memory
+	ref, _, err := hsm.Create(P256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var store KeyStore = &External{Open: hsm.Signer, Refs: hsm.List}
+	if _, err := store.Signer(ref); err != nil {
+		t.Error("signer error:", err)
+	}
+	if _, _, err := store.Create(P256); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("create got error %v, want ErrUnsupported", err)
+	}
+	if err := store.Delete(ref); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("delete got error %v, want ErrUnsupported", err)
+	}
+}
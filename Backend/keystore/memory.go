@@ -0,0 +1,101 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Memory is a volatile KeyStore. The zero value is ready for use.
+type Memory struct {
+	mutex sync.RWMutex
+	keys  map[string]crypto.Signer
+}
+
+// GenerateKey returns a new private key of the type.
+func GenerateKey(kt KeyType) (crypto.Signer, error) {
+	switch kt {
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case P256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case P384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrKeyType, kt)
+}
+
+// NewRef returns a random reference.
+func newRef() (string, error) {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("keystore reference unavailable: %w", err)
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// Create implements the KeyStore interface.
+func (m *Memory) Create(kt KeyType) (string, crypto.PublicKey, error) {
+	key, err := GenerateKey(kt)
+	if err != nil {
+		return "", nil, err
+	}
+	ref, err := newRef()
+	if err != nil {
+		return "", nil, err
+	}
+	m.Import(ref, key)
+	return ref, key.Public(), nil
+}
+
+// Import installs key under ref, replacing any previous key with the same
+// reference.
+func (m *Memory) Import(ref string, key crypto.Signer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.keys == nil {
+		m.keys = make(map[string]crypto.Signer)
+	}
+	m.keys[ref] = key
+}
+
+// Signer implements the KeyStore interface.
+func (m *Memory) Signer(ref string) (crypto.Signer, error) {
+	m.mutex.RLock()
+	key, ok := m.keys[ref]
+	m.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	return key, nil
+}
+
+// List implements the KeyStore interface.
+func (m *Memory) List() ([]string, error) {
+	m.mutex.RLock()
+	refs := make([]string, 0, len(m.keys))
+	for ref := range m.keys {
+		refs = append(refs, ref)
+	}
+	m.mutex.RUnlock()
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// Delete implements the KeyStore interface.
+func (m *Memory) Delete(ref string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.keys[ref]; !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	delete(m.keys, ref)
+	return nil
+}
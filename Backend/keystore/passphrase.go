@@ -0,0 +1,309 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions for passphrases
+const (
+	Scrypt   = "scrypt"
+	Argon2id = "argon2id"
+)
+
+// Cipher is the content encryption of EncryptedKey.
+const Cipher = "xchacha20-poly1305"
+
+// KDF has the parameters of a passphrase derivation. The zero value selects
+// scrypt with N = 2¹⁵, r = 8 and p = 1.
+type KDF struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// argon2id
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"` // KiB
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// KDFMemoryMax limits the memory cost of decryption, such that hostile files
+// can not exhaust resources.
+const KDFMemoryMax = 1 << 30
+
+// KDFPassesMax and KDFThreadsMax limit the processing cost of decryption, like
+// KDFMemoryMax does for memory. Passes are the scrypt p and the argon2id time.
+const (
+	KDFPassesMax  = 16
+	KDFThreadsMax = 16
+)
+
+// WithDefaults returns a copy with the parameters set to default when zero.
+func (kdf KDF) withDefaults() KDF {
+	switch kdf.Name {
+	case "":
+		kdf.Name = Scrypt
+		fallthrough
+	case Scrypt:
+		if kdf.N == 0 {
+			kdf.N = 1 << 15
+		}
+		if kdf.R == 0 {
+			kdf.R = 8
+		}
+		if kdf.P == 0 {
+			kdf.P = 1
+		}
+	case Argon2id:
+		if kdf.Time == 0 {
+			kdf.Time = 3
+		}
+		if kdf.Memory == 0 {
+			kdf.Memory = 64 << 10
+		}
+		if kdf.Threads == 0 {
+			kdf.Threads = 4
+		}
+	}
+	return kdf
+}
+
+func (kdf *KDF) deriveKey(passphrase []byte) ([]byte, error) {
+	switch kdf.Name {
+	case Scrypt:
+		if int64(kdf.N)*int64(kdf.R)*128 > KDFMemoryMax {
+			return nil, fmt.Errorf("keystore scrypt parameters exceed %d bytes of memory", KDFMemoryMax)
+		}
+		if kdf.P < 1 || kdf.P > KDFPassesMax {
+			return nil, fmt.Errorf("keystore scrypt parallelization %d out of bounds", kdf.P)
+		}
+		return scrypt.Key(passphrase, kdf.Salt, kdf.N, kdf.R, kdf.P, chacha20poly1305.KeySize)
+	case Argon2id:
+		if kdf.Memory > KDFMemoryMax>>10 || kdf.Time == 0 || kdf.Time > KDFPassesMax || kdf.Threads == 0 || kdf.Threads > KDFThreadsMax {
+			return nil, fmt.Errorf("keystore argon2id parameters out of bounds")
+		}
+		return argon2.IDKey(passphrase, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, chacha20poly1305.KeySize), nil
+	}
+	return nil, fmt.Errorf("keystore key derivation %q not supported", kdf.Name)
+}
+
+// EncryptedKey is the file format of a private key under passphrase, in JSON.
+// The plaintext is PKCS #8, or any data without a Type. See EncryptData.
+type EncryptedKey struct {
+	Version    int     `json:"version"` // 1
+	Type       KeyType `json:"type"`
+	KDF        KDF     `json:"kdf"`
+	Cipher     string  `json:"cipher"`
+	Nonce      []byte  `json:"nonce"`
+	Ciphertext []byte  `json:"ciphertext"`
+}
+
+// AdditionalData binds the parameters to the ciphertext, and the storage name,
+// if any, such that entries can not be swapped.
+func (e *EncryptedKey) additionalData(name string) []byte {
+	return []byte(fmt.Sprintf("%d %s %s %s %s", e.Version, e.Type, e.KDF.Name, e.Cipher, name))
+}
+
+// EncryptKey returns the EncryptedKey of key in JSON. Unset parameters in kdf
+// get their default, and the salt is always random.
+func EncryptKey(key crypto.Signer, passphrase []byte, kdf KDF) ([]byte, error) {
+	return encryptKey(key, passphrase, kdf, "")
+}
+
+// EncryptKey is EncryptKey with the storage name of the result.
+func encryptKey(key crypto.Signer, passphrase []byte, kdf KDF, name string) ([]byte, error) {
+	kt, err := TypeOf(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyType, err)
+	}
+	return encrypt(kt, der, passphrase, kdf, name)
+}
+
+// EncryptData returns plaintext in the EncryptedKey format, without a key
+// type, for secrets other than private keys.
+func EncryptData(plaintext, passphrase []byte, kdf KDF) ([]byte, error) {
+	return encrypt("", plaintext, passphrase, kdf, "")
+}
+
+// Encrypt has the storage name of the result, or the empty string for none.
+func encrypt(kt KeyType, plaintext, passphrase []byte, kdf KDF, name string) ([]byte, error) {
+	e := EncryptedKey{Version: 1, Type: kt, KDF: kdf.withDefaults(), Cipher: Cipher}
+	e.KDF.Salt = make([]byte, 16)
+	e.Nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(e.KDF.Salt); err != nil {
+		return nil, fmt.Errorf("keystore salt unavailable: %w", err)
+	}
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, fmt.Errorf("keystore nonce unavailable: %w", err)
+	}
+	k, err := e.KDF.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, e.additionalData(name))
+	return json.Marshal(&e)
+}
+
+// DecryptKey is the inverse of EncryptKey. A wrong passphrase gets ErrSealed.
+func DecryptKey(blob, passphrase []byte) (crypto.Signer, error) {
+	return decryptKey(blob, passphrase, "")
+}
+
+// DecryptKey is DecryptKey with the storage name of blob.
+func decryptKey(blob, passphrase []byte, name string) (crypto.Signer, error) {
+	e, der, err := decrypt(blob, passphrase, name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("keystore encrypted key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: Go type %T", ErrKeyType, key)
+	}
+	if kt, err := TypeOf(signer.Public()); err != nil || kt != e.Type {
+		return nil, fmt.Errorf("%w: encrypted key of type %q does not match", ErrKeyType, e.Type)
+	}
+	return signer, nil
+}
+
+// DecryptData is the inverse of EncryptData. A wrong passphrase gets
+// ErrSealed.
+func DecryptData(blob, passphrase []byte) ([]byte, error) {
+	e, plaintext, err := decrypt(blob, passphrase, "")
+	if err != nil {
+		return nil, err
+	}
+	if e.Type != "" {
+		return nil, fmt.Errorf("keystore encrypted data is a key of type %q", e.Type)
+	}
+	return plaintext, nil
+}
+
+func decrypt(blob, passphrase []byte, name string) (*EncryptedKey, []byte, error) {
+	var e EncryptedKey
+	if err := json.Unmarshal(blob, &e); err != nil {
+		return nil, nil, fmt.Errorf("keystore encrypted key: %w", err)
+	}
+	if e.Version != 1 || e.Cipher != Cipher {
+		return nil, nil, fmt.Errorf("keystore encrypted key version %d with cipher %q not supported", e.Version, e.Cipher)
+	}
+	k, err := e.KDF.deriveKey(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, nil, fmt.Errorf("%w: nonce of %d bytes", ErrSealed, len(e.Nonce))
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, e.additionalData(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: passphrase mismatch or corrupt data", ErrSealed)
+	}
+	return &e, plaintext, nil
+}
+
+// Passphrase is a KeyStore with private keys in the EncryptedKey format in a
+// Storage. Entries go under Prefix + "keys/" + reference, and they are bound
+// to that name. Each Signer call pays the cost of the key derivation.
+type Passphrase struct {
+	Storage    Storage
+	Passphrase []byte
+	KDF        KDF // parameters for new entries
+	Prefix     string
+}
+
+func (p *Passphrase) name(ref string) string {
+	return p.Prefix + "keys/" + ref
+}
+
+// Create implements the KeyStore interface.
+func (p *Passphrase) Create(kt KeyType) (string, crypto.PublicKey, error) {
+	key, err := GenerateKey(kt)
+	if err != nil {
+		return "", nil, err
+	}
+	ref, err := newRef()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := p.Import(ref, key); err != nil {
+		return "", nil, err
+	}
+	return ref, key.Public(), nil
+}
+
+// Import installs key under ref, replacing any previous key with the same
+// reference.
+func (p *Passphrase) Import(ref string, key crypto.Signer) error {
+	if strings.Contains(ref, "/") {
+		return fmt.Errorf("keystore reference %q contains a slash", ref)
+	}
+	blob, err := encryptKey(key, p.Passphrase, p.KDF, p.name(ref))
+	if err != nil {
+		return err
+	}
+	return p.Storage.Put(p.name(ref), blob)
+}
+
+// Signer implements the KeyStore interface.
+func (p *Passphrase) Signer(ref string) (crypto.Signer, error) {
+	if strings.Contains(ref, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	blob, err := p.Storage.Get(p.name(ref))
+	if err != nil {
+		return nil, err
+	}
+	key, err := decryptKey(blob, p.Passphrase, p.name(ref))
+	if err != nil {
+		return nil, fmt.Errorf("keystore entry %q: %w", ref, err)
+	}
+	return key, nil
+}
+
+// List implements the KeyStore interface.
+func (p *Passphrase) List() ([]string, error) {
+	names, err := p.Storage.List(p.name(""))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]string, len(names))
+	for i, name := range names {
+		refs[i] = strings.TrimPrefix(name, p.name(""))
+	}
+	return refs, nil
+}
+
+// Delete implements the KeyStore interface.
+func (p *Passphrase) Delete(ref string) error {
+	if strings.Contains(ref, "/") {
+		return fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	return p.Storage.Delete(p.name(ref))
+}
@@ -0,0 +1,244 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Storage is a key–value store for opaque blobs. Implementations must be safe
+// for concurrent use.
+type Storage interface {
+	// Get returns the value of key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Put sets the value of key.
+	Put(key string, value []byte) error
+	// Delete removes key, or it returns ErrNotFound.
+	Delete(key string) error
+	// List returns all keys with the prefix in ascending order.
+	List(prefix string) ([]string, error)
+}
+
+// MapStorage is a volatile Storage. The zero value is ready for use.
+type MapStorage struct {
+	mutex sync.RWMutex
+	m     map[string][]byte
+}
+
+// Get implements the Storage interface.
+func (s *MapStorage) Get(key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.m[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Put implements the Storage interface.
+func (s *MapStorage) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.m == nil {
+		s.m = make(map[string][]byte)
+	}
+	s.m[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements the Storage interface.
+func (s *MapStorage) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	delete(s.m, key)
+	return nil
+}
+
+// List implements the Storage interface.
+func (s *MapStorage) List(prefix string) ([]string, error) {
+	s.mutex.RLock()
+	var keys []string
+	for k := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	s.mutex.RUnlock()
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Prefixed is a Storage in the namespace Prefix of another Storage.
+type Prefixed struct {
+	Storage Storage
+	Prefix  string
+}
+
+// Get implements the Storage interface.
+func (s *Prefixed) Get(key string) ([]byte, error) {
+	return s.Storage.Get(s.Prefix + key)
+}
+
+// Put implements the Storage interface.
+func (s *Prefixed) Put(key string, value []byte) error {
+	return s.Storage.Put(s.Prefix+key, value)
+}
+
+// Delete implements the Storage interface.
+func (s *Prefixed) Delete(key string) error {
+	return s.Storage.Delete(s.Prefix + key)
+}
+
+// List implements the Storage interface.
+func (s *Prefixed) List(prefix string) ([]string, error) {
+	names, err := s.Storage.List(s.Prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, s.Prefix)
+	}
+	return names, nil
+}
+
+// ErrSealed signals a blob which does not decrypt with the key in use.
+var ErrSealed = errors.New("keystore blob does not unseal")
+
+// Seal encrypts plaintext with AES-GCM. The storage key goes in as additional
+// data, which prevents blobs from being moved to another name.
+func seal(key []byte, name string, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("keystore nonce unavailable: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(name)), nil
+}
+
+// Unseal is the inverse of seal.
+func unseal(key []byte, name string, blob []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %q truncated", ErrSealed, name)
+	}
+	plaintext, err := aead.Open(nil, blob[:aead.NonceSize()], blob[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrSealed, name)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("keystore encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Sealed is a KeyStore with private keys encrypted in a Storage. Entries go
+// under Prefix + "keys/" + reference.
+type Sealed struct {
+	Storage Storage
+	Key     []byte // AES key of 16, 24 or 32 bytes
+	Prefix  string
+}
+
+func (s *Sealed) name(ref string) string {
+	return s.Prefix + "keys/" + ref
+}
+
+// Create implements the KeyStore interface.
+func (s *Sealed) Create(kt KeyType) (string, crypto.PublicKey, error) {
+	key, err := GenerateKey(kt)
+	if err != nil {
+		return "", nil, err
+	}
+	ref, err := newRef()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.Import(ref, key); err != nil {
+		return "", nil, err
+	}
+	return ref, key.Public(), nil
+}
+
+// Import installs key under ref, replacing any previous key with the same
+// reference.
+func (s *Sealed) Import(ref string, key crypto.Signer) error {
+	if strings.Contains(ref, "/") {
+		return fmt.Errorf("keystore reference %q contains a slash", ref)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyType, err)
+	}
+	blob, err := seal(s.Key, s.name(ref), der)
+	if err != nil {
+		return err
+	}
+	return s.Storage.Put(s.name(ref), blob)
+}
+
+// Signer implements the KeyStore interface.
+func (s *Sealed) Signer(ref string) (crypto.Signer, error) {
+	if strings.Contains(ref, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	blob, err := s.Storage.Get(s.name(ref))
+	if err != nil {
+		return nil, err
+	}
+	der, err := unseal(s.Key, s.name(ref), blob)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("keystore entry %q: %w", ref, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: Go type %T", ErrKeyType, key)
+	}
+	return signer, nil
+}
+
+// List implements the KeyStore interface.
+func (s *Sealed) List() ([]string, error) {
+	names, err := s.Storage.List(s.name(""))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]string, len(names))
+	for i, name := range names {
+		refs[i] = strings.TrimPrefix(name, s.name(""))
+	}
+	return refs, nil
+}
+
+// Delete implements the KeyStore interface.
+func (s *Sealed) Delete(ref string) error {
+	if strings.Contains(ref, "/") {
+		return fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	return s.Storage.Delete(s.name(ref))
+}
@@ -0,0 +1,210 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrQuota signals a tenant at its key limit.
+var ErrQuota = errors.New("keystore quota exceeded")
+
+// ErrTenant signals an unknown or malformed tenant identifier.
+var ErrTenant = errors.New("keystore tenant unknown")
+
+// Tenants hosts isolated key stores for many customers in one Storage. Each
+// tenant has its own data encryption key, wrapped by the master key, and its
+// own namespace under "tenants/{id}/", with room for other data through
+// Namespace. Removal of a tenant discards its data
+// encryption key, which renders any leftover blob (e.g., in backups) useless.
+type Tenants struct {
+	Storage   Storage
+	MasterKey []byte // AES key of 16, 24 or 32 bytes
+
+	// Quota limits the number of keys per tenant. Zero means no limit.
+	Quota int
+
+	mutex sync.Mutex // serializes tenant and key creation
+}
+
+// TenantIDMax is the size limit for tenant identifiers.
+const TenantIDMax = 64
+
+// ValidTenantID returns whether id is safe for use as a namespace.
+func validTenantID(id string) bool {
+	if id == "" || len(id) > TenantIDMax {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			continue
+		}
+		return false
+	}
+	return id != "." && id != ".."
+}
+
+func tenantPrefix(id string) string {
+	return "tenants/" + id + "/"
+}
+
+func namespacePrefix(id string) string {
+	return tenantPrefix(id) + "data/"
+}
+
+func dataKeyName(id string) string {
+	return tenantPrefix(id) + "dek"
+}
+
+// Add registers a new tenant. Adding an existing tenant is a no-op.
+func (t *Tenants) Add(id string) error {
+	if !validTenantID(id) {
+		return fmt.Errorf("%w: malformed identifier %q", ErrTenant, id)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	_, err := t.Storage.Get(dataKeyName(id))
+	switch {
+	case err == nil:
+		return nil
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return fmt.Errorf("keystore data key unavailable: %w", err)
+	}
+	wrapped, err := seal(t.MasterKey, dataKeyName(id), dek)
+	if err != nil {
+		return err
+	}
+	return t.Storage.Put(dataKeyName(id), wrapped)
+}
+
+// Tenant returns the key store of a registered tenant.
+func (t *Tenants) Tenant(id string) (KeyStore, error) {
+	if !validTenantID(id) {
+		return nil, fmt.Errorf("%w: malformed identifier %q", ErrTenant, id)
+	}
+	wrapped, err := t.Storage.Get(dataKeyName(id))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %q", ErrTenant, id)
+		}
+		return nil, err
+	}
+	dek, err := unseal(t.MasterKey, dataKeyName(id), wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantStore{
+		Sealed:  Sealed{Storage: t.Storage, Key: dek, Prefix: tenantPrefix(id)},
+		tenants: t,
+	}, nil
+}
+
+// Namespace returns the Storage of a registered tenant for data other than
+// keys, such as a wallet.Wallet. The entries are not encrypted with the data
+// encryption key of the tenant, yet they are removed with the tenant.
+func (t *Tenants) Namespace(id string) (Storage, error) {
+	if !validTenantID(id) {
+		return nil, fmt.Errorf("%w: malformed identifier %q", ErrTenant, id)
+	}
+	if _, err := t.Storage.Get(dataKeyName(id)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %q", ErrTenant, id)
+		}
+		return nil, err
+	}
+	return &Prefixed{Storage: t.Storage, Prefix: namespacePrefix(id)}, nil
+}
+
+// List returns the identifiers of all tenants.
+func (t *Tenants) List() ([]string, error) {
+	names, err := t.Storage.List("tenants/")
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, name := range names {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(name, "tenants/"), "/dek")
+		if ok && !strings.Contains(id, "/") {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Remove deletes a tenant with all of its keys.
+func (t *Tenants) Remove(id string) error {
+	if !validTenantID(id) {
+		return fmt.Errorf("%w: malformed identifier %q", ErrTenant, id)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// data key first, for crypto-shredding in case of partial failure
+	if err := t.Storage.Delete(dataKeyName(id)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: %q", ErrTenant, id)
+		}
+		return err
+	}
+	names, err := t.Storage.List(tenantPrefix(id))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := t.Storage.Delete(name); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// TenantStore applies the quota on a Sealed namespace.
+type tenantStore struct {
+	Sealed
+	tenants *Tenants
+}
+
+// Create implements the KeyStore interface.
+func (s *tenantStore) Create(kt KeyType) (string, crypto.PublicKey, error) {
+	if s.tenants.Quota <= 0 {
+		return s.Sealed.Create(kt)
+	}
+	s.tenants.mutex.Lock()
+	defer s.tenants.mutex.Unlock()
+	refs, err := s.Sealed.List()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(refs) >= s.tenants.Quota {
+		return "", nil, fmt.Errorf("%w: %d keys", ErrQuota, len(refs))
+	}
+	return s.Sealed.Create(kt)
+}
+
+// Import installs key under ref, like Sealed does, within the quota. The
+// replacement of a key does not count.
+func (s *tenantStore) Import(ref string, key crypto.Signer) error {
+	if s.tenants.Quota <= 0 {
+		return s.Sealed.Import(ref, key)
+	}
+	s.tenants.mutex.Lock()
+	defer s.tenants.mutex.Unlock()
+	refs, err := s.Sealed.List()
+	if err != nil {
+		return err
+	}
+	if len(refs) >= s.tenants.Quota && !slices.Contains(refs, ref) {
+		return fmt.Errorf("%w: %d keys", ErrQuota, len(refs))
+	}
+	return s.Sealed.Import(ref, key)
+}
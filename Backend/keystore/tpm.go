@@ -0,0 +1,480 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrAttestation signals key attestation which does not verify.
+var ErrAttestation = errors.New("TPM key attestation denied")
+
+// TPM is a KeyStore with keys resident in a TPM 2.0 device. Keys are P-256
+// children of a storage root key (SRK) in the owner hierarchy. The private
+// parts leave the device only when wrapped by the SRK, and signing happens on
+// the device. Ed25519 and P-384 are not available.
+type TPM struct {
+	device transport.TPM
+
+	mutex sync.Mutex // serializes device access
+	srk   tpm2.NamedHandle
+	ak    *tpmKey // attestation key, if any
+	keys  map[string]*tpmKey
+}
+
+// TPMKey is a key pair wrapped by the SRK.
+type tpmKey struct {
+	public  tpm2.TPM2BPublic
+	private tpm2.TPM2BPrivate
+	pub     *ecdsa.PublicKey
+}
+
+// KeyBlob is the persistent form of a TPM key. It is useless without the TPM
+// which created it.
+type KeyBlob struct {
+	Public  []byte // TPM2B_PUBLIC contents
+	Private []byte // TPM2B_PRIVATE contents
+}
+
+// OpenTPM creates the SRK on device. Keys survive a restart only through
+// Blob and Restore.
+func OpenTPM(device transport.TPM) (*TPM, error) {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(device)
+	if err != nil {
+		return nil, fmt.Errorf("TPM storage root key unavailable: %w", err)
+	}
+	return &TPM{
+		device: device,
+		srk:    tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name},
+		keys:   make(map[string]*tpmKey),
+	}, nil
+}
+
+// Close flushes the SRK from the device. The device itself remains open.
+func (t *TPM) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	_, err := tpm2.FlushContext{FlushHandle: t.srk.Handle}.Execute(t.device)
+	return err
+}
+
+// SigningTemplate returns the public template of TPM keys. Restricted keys
+// sign TPM-generated data only, which makes them fit for attestation.
+func signingTemplate(restricted bool) tpm2.TPMTPublic {
+	return tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgECC,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			Restricted:          restricted,
+			SignEncrypt:         true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			Scheme: tpm2.TPMTECCScheme{
+				Scheme: tpm2.TPMAlgECDSA,
+				Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA,
+					&tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+			},
+			CurveID: tpm2.TPMECCNistP256,
+		}),
+		Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: make([]byte, 32)},
+			Y: tpm2.TPM2BECCParameter{Buffer: make([]byte, 32)},
+		}),
+	}
+}
+
+// PublicKey returns the ECDSA key of a TPMT_PUBLIC.
+func publicKey(public *tpm2.TPMTPublic) (*ecdsa.PublicKey, error) {
+	pub, err := tpm2.Pub(*public)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: TPM key of Go type %T", ErrKeyType, pub)
+	}
+	return key, nil
+}
+
+func (t *TPM) create(restricted bool) (*tpmKey, error) {
+	rsp, err := tpm2.Create{
+		ParentHandle: t.srk,
+		InPublic:     tpm2.New2B(signingTemplate(restricted)),
+	}.Execute(t.device)
+	if err != nil {
+		return nil, fmt.Errorf("TPM key creation: %w", err)
+	}
+	public, err := rsp.OutPublic.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("TPM key creation: %w", err)
+	}
+	pub, err := publicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	return &tpmKey{public: rsp.OutPublic, private: rsp.OutPrivate, pub: pub}, nil
+}
+
+// Load puts key on the device. The caller must flush the return.
+func (t *TPM) load(key *tpmKey) (tpm2.NamedHandle, error) {
+	rsp, err := tpm2.Load{
+		ParentHandle: t.srk,
+		InPrivate:    key.private,
+		InPublic:     key.public,
+	}.Execute(t.device)
+	if err != nil {
+		return tpm2.NamedHandle{}, fmt.Errorf("TPM key load: %w", err)
+	}
+	return tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, nil
+}
+
+func (t *TPM) flush(h tpm2.NamedHandle) {
+	tpm2.FlushContext{FlushHandle: h.Handle}.Execute(t.device)
+}
+
+// Create implements the KeyStore interface. Only P256 is supported.
+func (t *TPM) Create(kt KeyType) (string, crypto.PublicKey, error) {
+	if kt != P256 {
+		return "", nil, fmt.Errorf("%w: %q on TPM", ErrKeyType, kt)
+	}
+	ref, err := newRef()
+	if err != nil {
+		return "", nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key, err := t.create(false)
+	if err != nil {
+		return "", nil, err
+	}
+	t.keys[ref] = key
+	return ref, key.pub, nil
+}
+
+// Signer implements the KeyStore interface. The signer accepts SHA-256
+// digests only, and it produces ASN.1 DER signatures, like ecdsa.PrivateKey.
+func (t *TPM) Signer(ref string) (crypto.Signer, error) {
+	t.mutex.Lock()
+	key, ok := t.keys[ref]
+	t.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	return &tpmSigner{t, key}, nil
+}
+
+// List implements the KeyStore interface.
+func (t *TPM) List() ([]string, error) {
+	t.mutex.Lock()
+	refs := make([]string, 0, len(t.keys))
+	for ref := range t.keys {
+		refs = append(refs, ref)
+	}
+	t.mutex.Unlock()
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// Delete implements the KeyStore interface. The wrapped key is discarded,
+// which is final unless a Blob was kept elsewhere.
+func (t *TPM) Delete(ref string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.keys[ref]; !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	delete(t.keys, ref)
+	return nil
+}
+
+// Blob returns the wrapped key of ref for storage.
+func (t *TPM) Blob(ref string) (*KeyBlob, error) {
+	t.mutex.Lock()
+	key, ok := t.keys[ref]
+	t.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	return &KeyBlob{
+		Public:  key.public.Bytes(),
+		Private: key.private.Buffer,
+	}, nil
+}
+
+// Restore installs a wrapped key from Blob under ref. The device must hold
+// the same SRK, i.e., the same owner seed.
+func (t *TPM) Restore(ref string, blob *KeyBlob) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key, err := t.restore(blob)
+	if err != nil {
+		return err
+	}
+	t.keys[ref] = key
+	return nil
+}
+
+// Restore unpacks blob, and it verifies that the SRK can unwrap.
+func (t *TPM) restore(blob *KeyBlob) (*tpmKey, error) {
+	public := tpm2.BytesAs2B[tpm2.TPMTPublic](blob.Public)
+	contents, err := public.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("TPM key blob: %w", err)
+	}
+	pub, err := publicKey(contents)
+	if err != nil {
+		return nil, err
+	}
+	key := &tpmKey{
+		public:  public,
+		private: tpm2.TPM2BPrivate{Buffer: blob.Private},
+		pub:     pub,
+	}
+	h, err := t.load(key)
+	if err != nil {
+		return nil, err
+	}
+	t.flush(h)
+	return key, nil
+}
+
+type tpmSigner struct {
+	t   *TPM
+	key *tpmKey
+}
+
+// Public implements the crypto.Signer interface.
+func (s *tpmSigner) Public() crypto.PublicKey { return s.key.pub }
+
+// Sign implements the crypto.Signer interface. The random source is ignored,
+// as the TPM has its own.
+func (s *tpmSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%w: TPM signs SHA-256 digests only", ErrKeyType)
+	}
+
+	s.t.mutex.Lock()
+	defer s.t.mutex.Unlock()
+	h, err := s.t.load(s.key)
+	if err != nil {
+		return nil, err
+	}
+	defer s.t.flush(h)
+
+	rsp, err := tpm2.Sign{
+		KeyHandle: tpm2.AuthHandle{Handle: h.Handle, Name: h.Name, Auth: tpm2.PasswordAuth(nil)},
+		Digest:    tpm2.TPM2BDigest{Buffer: digest},
+		InScheme: tpm2.TPMTSigScheme{
+			Scheme: tpm2.TPMAlgECDSA,
+			Details: tpm2.NewTPMUSigScheme(tpm2.TPMAlgECDSA,
+				&tpm2.TPMSSchemeHash{HashAlg: tpm2.TPMAlgSHA256}),
+		},
+		Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck, Hierarchy: tpm2.TPMRHNull},
+	}.Execute(s.t.device)
+	if err != nil {
+		return nil, fmt.Errorf("TPM signature: %w", err)
+	}
+	r, ss, err := ecdsaSignature(&rsp.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, ss})
+}
+
+// EcdsaSignature returns the ECDSA-SHA256 components of sig.
+func ecdsaSignature(sig *tpm2.TPMTSignature) (r, s *big.Int, err error) {
+	if sig.SigAlg != tpm2.TPMAlgECDSA {
+		return nil, nil, fmt.Errorf("TPM signature algorithm %#x, want ECDSA", sig.SigAlg)
+	}
+	ecc, err := sig.Signature.ECDSA()
+	if err != nil {
+		return nil, nil, err
+	}
+	if ecc.Hash != tpm2.TPMAlgSHA256 {
+		return nil, nil, fmt.Errorf("TPM signature hash %#x, want SHA-256", ecc.Hash)
+	}
+	return new(big.Int).SetBytes(ecc.SignatureR.Buffer), new(big.Int).SetBytes(ecc.SignatureS.Buffer), nil
+}
+
+// Attestation is evidence from TPM2_Certify that a key resides in a TPM. All
+// fields are in the TPM wire format.
+type Attestation struct {
+	Public      []byte // TPMT_PUBLIC of the certified key
+	CertifyInfo []byte // TPMS_ATTEST signed by the attestation key
+	Signature   []byte // TPMT_SIGNATURE over CertifyInfo
+}
+
+// AttestationKey returns the public key which signs attestations, creating
+// it on first use. Relying parties must establish trust in this key
+// independently, e.g., with an endorsement key certificate and
+// TPM2_ActivateCredential, or by enrolment.
+func (t *TPM) AttestationKey() (*ecdsa.PublicKey, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.ak == nil {
+		ak, err := t.create(true)
+		if err != nil {
+			return nil, err
+		}
+		t.ak = ak
+	}
+	return t.ak.pub, nil
+}
+
+// AttestationKeyBlob returns the wrapped attestation key for storage, like
+// Blob does for signing keys, creating it on first use. Relying parties trust
+// the attestation key by enrolment, so it should survive restarts through
+// RestoreAttestationKey.
+func (t *TPM) AttestationKeyBlob() (*KeyBlob, error) {
+	if _, err := t.AttestationKey(); err != nil {
+		return nil, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return &KeyBlob{
+		Public:  t.ak.public.Bytes(),
+		Private: t.ak.private.Buffer,
+	}, nil
+}
+
+// RestoreAttestationKey installs a wrapped attestation key from
+// AttestationKeyBlob, in place of the current one, if any. The device must
+// hold the same SRK, i.e., the same owner seed.
+func (t *TPM) RestoreAttestationKey(blob *KeyBlob) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key, err := t.restore(blob)
+	if err != nil {
+		return err
+	}
+	public, err := key.public.Contents()
+	if err != nil {
+		return fmt.Errorf("TPM key blob: %w", err)
+	}
+	if !public.ObjectAttributes.Restricted {
+		return fmt.Errorf("%w: attestation key not restricted", ErrKeyType)
+	}
+	t.ak = key
+	return nil
+}
+
+// Attest certifies the key of ref with the attestation key. The nonce from
+// the relying party prevents replay.
+func (t *TPM) Attest(ref string, nonce []byte) (*Attestation, error) {
+	if _, err := t.AttestationKey(); err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key, ok := t.keys[ref]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, ref)
+	}
+	h, err := t.load(key)
+	if err != nil {
+		return nil, err
+	}
+	defer t.flush(h)
+	ak, err := t.load(t.ak)
+	if err != nil {
+		return nil, err
+	}
+	defer t.flush(ak)
+
+	rsp, err := tpm2.Certify{
+		ObjectHandle:   tpm2.AuthHandle{Handle: h.Handle, Name: h.Name, Auth: tpm2.PasswordAuth(nil)},
+		SignHandle:     tpm2.AuthHandle{Handle: ak.Handle, Name: ak.Name, Auth: tpm2.PasswordAuth(nil)},
+		QualifyingData: tpm2.TPM2BData{Buffer: nonce},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+	}.Execute(t.device)
+	if err != nil {
+		return nil, fmt.Errorf("TPM key certification: %w", err)
+	}
+	return &Attestation{
+		Public:      key.public.Bytes(),
+		CertifyInfo: rsp.CertifyInfo.Bytes(),
+		Signature:   tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// Verify checks the attestation against a trusted attestation key and the
+// nonce issued. Keys must be hardware-bound, i.e., generated inside the TPM
+// and never duplicable. The return is the attested public key, which the
+// relying party then matches with the verification method in use.
+func (a *Attestation) Verify(akPub *ecdsa.PublicKey, nonce []byte) (*ecdsa.PublicKey, error) {
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](a.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrAttestation, err)
+	}
+	r, s, err := ecdsaSignature(sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAttestation, err)
+	}
+	digest := sha256.Sum256(a.CertifyInfo)
+	if !ecdsa.Verify(akPub, digest[:], r, s) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrAttestation)
+	}
+
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](a.CertifyInfo)
+	if err != nil {
+		return nil, fmt.Errorf("%w: certify info: %w", ErrAttestation, err)
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue {
+		return nil, fmt.Errorf("%w: not TPM generated", ErrAttestation)
+	}
+	if attest.Type != tpm2.TPMSTAttestCertify {
+		return nil, fmt.Errorf("%w: attestation type %#x, want certify", ErrAttestation, attest.Type)
+	}
+	if subtle.ConstantTimeCompare(attest.ExtraData.Buffer, nonce) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrAttestation)
+	}
+	info, err := attest.Attested.Certify()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAttestation, err)
+	}
+
+	public, err := tpm2.Unmarshal[tpm2.TPMTPublic](a.Public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: public area: %w", ErrAttestation, err)
+	}
+	name, err := tpm2.ObjectName(public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAttestation, err)
+	}
+	if subtle.ConstantTimeCompare(name.Buffer, info.Name.Buffer) != 1 {
+		return nil, fmt.Errorf("%w: public area does not match certified name", ErrAttestation)
+	}
+	attrs := public.ObjectAttributes
+	if !attrs.FixedTPM || !attrs.FixedParent || !attrs.SensitiveDataOrigin {
+		return nil, fmt.Errorf("%w: key not hardware-bound", ErrAttestation)
+	}
+	pub, err := publicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAttestation, err)
+	}
+	if pub.Curve != elliptic.P256() || !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("%w: invalid P-256 key", ErrAttestation)
+	}
+	return pub, nil
+}
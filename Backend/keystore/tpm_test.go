@@ -0,0 +1,197 @@
+//go:build tpm
+
+// The tests of this file need a TPM 2.0 device or simulator:
+//
+//	go test -tags tpm ./keystore -tpm /dev/tpmrm0
+//	go test -tags tpm ./keystore -tpm localhost:2321
+//
+// Addresses are of the command port of the TCG reference simulator, with the
+// platform port one higher, e.g., tpm2-simulator or swtpm with --tpm2 and
+// socket interfaces.
+
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+	"github.com/google/go-tpm/tpm2/transport/tcp"
+)
+
+var tpmFlag = flag.String("tpm", "", "TPM device `path`, or simulator `host:port`")
+
+// OpenTestTPM returns a TPM from the -tpm flag, or it skips the test.
+func openTestTPM(t *testing.T) *TPM {
+	t.Helper()
+	var device transport.TPMCloser
+	switch {
+	case *tpmFlag == "":
+		t.Skip("no TPM; set -tpm to a device or simulator")
+	case strings.HasPrefix(*tpmFlag, "/"):
+		d, err := linuxtpm.Open(*tpmFlag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		device = d
+	default:
+		host, port, err := net.SplitHostPort(*tpmFlag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			t.Fatal("simulator port:", err)
+		}
+		sim, err := tcp.Open(tcp.Config{
+			CommandAddress:  *tpmFlag,
+			PlatformAddress: net.JoinHostPort(host, strconv.Itoa(n+1)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sim.PowerOn(); err != nil {
+			t.Fatal("simulator power on:", err)
+		}
+		// fails with TPM_RC_INITIALIZE when started already
+		tpm2.Startup{StartupType: tpm2.TPMSUClear}.Execute(sim)
+		device = sim
+	}
+	t.Cleanup(func() { device.Close() })
+
+	tpm, err := OpenTPM(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tpm.Close() })
+	return tpm
+}
+
+func TestTPMSigner(t *testing.T) {
+	tpm := openTestTPM(t)
+
+	if _, _, err := tpm.Create(Ed25519); !errors.Is(err, ErrKeyType) {
+		t.Errorf("Ed25519 got error %v, want ErrKeyType", err)
+	}
+	ref, pub, err := tpm.Create(P256)
+	if err != nil {
+		t.Fatal("create error:", err)
+	}
+	signer, err := tpm.Signer(ref)
+	if err != nil {
+		t.Fatal("signer error:", err)
+	}
+	if !signer.Public().(*ecdsa.PublicKey).Equal(pub) {
+		t.Error("signer public key differs from the one created")
+	}
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], sig) {
+		t.Error("signature does not verify")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA384); !errors.Is(err, ErrKeyType) {
+		t.Errorf("SHA-384 got error %v, want ErrKeyType", err)
+	}
+
+	// wrapped key survives deletion
+	blob, err := tpm.Blob(ref)
+	if err != nil {
+		t.Fatal("blob error:", err)
+	}
+	if err := tpm.Delete(ref); err != nil {
+		t.Fatal("delete error:", err)
+	}
+	if _, err := tpm.Signer(ref); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted key got error %v, want ErrNotFound", err)
+	}
+	if err := tpm.Restore("restored", blob); err != nil {
+		t.Fatal("restore error:", err)
+	}
+	signer, err = tpm.Signer("restored")
+	if err != nil {
+		t.Fatal("restored signer error:", err)
+	}
+	if sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Error("restored sign error:", err)
+	} else if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], sig) {
+		t.Error("restored signature does not verify")
+	}
+	if refs, err := tpm.List(); err != nil || len(refs) != 1 || refs[0] != "restored" {
+		t.Errorf("got list %q, error %v", refs, err)
+	}
+}
+
+func TestTPMAttest(t *testing.T) {
+	tpm := openTestTPM(t)
+	ref, pub, err := tpm.Create(P256)
+	if err != nil {
+		t.Fatal("create error:", err)
+	}
+	akPub, err := tpm.AttestationKey()
+	if err != nil {
+		t.Fatal("attestation key error:", err)
+	}
+
+	nonce := []byte("relying party nonce")
+	a, err := tpm.Attest(ref, nonce)
+	if err != nil {
+		t.Fatal("attest error:", err)
+	}
+	got, err := a.Verify(akPub, nonce)
+	if err != nil {
+		t.Fatal("attestation error:", err)
+	}
+	if !got.Equal(pub) {
+		t.Error("attested key differs from the one created")
+	}
+	if _, err := a.Verify(akPub, []byte("replay")); !errors.Is(err, ErrAttestation) {
+		t.Errorf("nonce mismatch got error %v, want ErrAttestation", err)
+	}
+
+	// enrolled attestation key survives a restart
+	akBlob, err := tpm.AttestationKeyBlob()
+	if err != nil {
+		t.Fatal("attestation key blob error:", err)
+	}
+	keyBlob, err := tpm.Blob(ref)
+	if err != nil {
+		t.Fatal("blob error:", err)
+	}
+	restarted, err := OpenTPM(tpm.device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	if err := restarted.RestoreAttestationKey(keyBlob); !errors.Is(err, ErrKeyType) {
+		t.Errorf("unrestricted attestation key got error %v, want ErrKeyType", err)
+	}
+	if err := restarted.RestoreAttestationKey(akBlob); err != nil {
+		t.Fatal("attestation key restore error:", err)
+	}
+	if err := restarted.Restore(ref, keyBlob); err != nil {
+		t.Fatal("restore error:", err)
+	}
+	if restoredAK, err := restarted.AttestationKey(); err != nil || !restoredAK.Equal(akPub) {
+		t.Fatalf("got restored attestation key error %v, or another key", err)
+	}
+	a, err = restarted.Attest(ref, nonce)
+	if err != nil {
+		t.Fatal("attest after restore error:", err)
+	}
+	if _, err := a.Verify(akPub, nonce); err != nil {
+		t.Error("attestation after restore error:", err)
+	}
+}
@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// LDJSON is the (MIME) media type for the JSON-LD representation, which
+// requires a "@context". See Document.LD.
+const LDJSON = "application/did+ld+json"
+
+// Context is a JSON-LD "@context". Entries are either a URI string, or a
+// context definition as a map[string]any. The context is retained as is,
+// i.e., without any JSON-LD processing.
+type Context []any
+
+// Contains returns whether c has an entry with uri.
+func (c Context) Contains(uri string) bool {
+	for _, e := range c {
+		if s, ok := e.(string); ok && s == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface. A single URI encodes as
+// a string, and anything else as an ordered set.
+func (c Context) MarshalJSON() ([]byte, error) {
+	if len(c) == 1 {
+		if s, ok := c[0].(string); ok {
+			return json.Marshal(s)
+		}
+	}
+	return json.Marshal([]any(c))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (c *Context) UnmarshalJSON(bytes []byte) error {
+	var v any
+	if err := json.Unmarshal(bytes, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		*c = nil
+	case string, map[string]any:
+		*c = Context{v}
+	case []any:
+		for i, e := range v {
+			switch e.(type) {
+			case string, map[string]any:
+				break
+			default:
+				return fmt.Errorf("JSON-LD @context entry № %d is neither a URI nor a context definition", i+1)
+			}
+		}
+		*c = v
+	default:
+		return errors.New("JSON-LD @context is neither a URI, a context definition, nor an ordered set")
+	}
+	return nil
+}
+
+// MethodContexts has the JSON-LD context per verification method type, for
+// use by Document.LD. Applications may add their own types before use.
+var MethodContexts = map[string]string{
+	"Multikey":                          "https://w3id.org/security/multikey/v1",
+	"JsonWebKey":                        "https://w3id.org/security/jwk/v1",
+	"JsonWebKey2020":                    "https://w3id.org/security/suites/jws-2020/v1",
+	"Ed25519VerificationKey2020":        "https://w3id.org/security/suites/ed25519-2020/v1",
+	"X25519KeyAgreementKey2020":         "https://w3id.org/security/suites/x25519-2020/v1",
+	"EcdsaSecp256k1VerificationKey2019": "https://w3id.org/security/suites/secp256k1-2019/v1",
+}
+
+// LD returns a shallow copy of doc for the JSON-LD representation. “The value
+// of @context MUST be the string https://www.w3.org/ns/did/v1, or an ordered
+// set where the first item is the string https://www.w3.org/ns/did/v1”. The
+// existing entries of doc follow, then the MethodContexts of the verification
+// method types in use, and then extra, without duplicate URIs.
+func (doc *Document) LD(extra ...any) *Document {
+	c := Context{V1}
+	add := func(e any) {
+		if s, ok := e.(string); !ok || !c.Contains(s) {
+			c = append(c, e)
+		}
+	}
+	for _, e := range doc.Context {
+		add(e)
+	}
+
+	for _, m := range doc.Methods() {
+		if uri, ok := MethodContexts[m.Type]; ok {
+			add(uri)
+		}
+	}
+
+	for _, e := range extra {
+		add(e)
+	}
+	ld := *doc
+	ld.Context = c
+	return &ld
+}
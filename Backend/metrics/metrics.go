@@ -0,0 +1,191 @@
+// Package metrics exposes Prometheus metrics in the text exposition format,
+// version 0.0.4. The package has no dependency on the Prometheus client.
+// Instead, collectors register with a Registerer, which a shim to a
+// prometheus.Registerer may satisfy as well.
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the exposition.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ErrDuplicate signals a metric name registered before.
+var ErrDuplicate = errors.New("metric name registered before")
+
+// Metric types
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// Family is a metric with its samples, as collected.
+type Family struct {
+	Name string
+	Help string
+	Type string // Counter, Gauge or Histogram
+
+	LabelNames []string
+	Bounds     []float64 // upper bounds of the histogram buckets
+
+	Samples []Sample
+}
+
+// Sample is a value with its labels, in the order of the label names.
+type Sample struct {
+	Labels []string // values
+	Value  float64  // count for histograms
+
+	// histogram only
+	Buckets []uint64 // cumulative counts per bound
+	Sum     float64
+}
+
+// Collector provides metrics. Implementations must be safe for concurrent
+// use.
+type Collector interface {
+	// Names returns the metric names, which are fixed.
+	Names() []string
+
+	// Collect returns the current values.
+	Collect() []Family
+}
+
+// Registerer accepts collectors.
+type Registerer interface {
+	Register(Collector) error
+}
+
+// Registry is a Registerer which serves the metrics of its collectors over
+// HTTP. The zero value is ready to use. Multiple goroutines may invoke methods
+// on a Registry simultaneously.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []Collector
+	names      map[string]bool
+}
+
+// Register implements the Registerer interface. Names must be unique.
+func (reg *Registry) Register(c Collector) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	names := c.Names()
+	for _, name := range names {
+		if reg.names[name] {
+			return fmt.Errorf("%w: %q", ErrDuplicate, name)
+		}
+	}
+	if reg.names == nil {
+		reg.names = make(map[string]bool)
+	}
+	for _, name := range names {
+		reg.names[name] = true
+	}
+	reg.collectors = append(reg.collectors, c)
+	return nil
+}
+
+// Gather returns the metrics of all collectors in order of name.
+func (reg *Registry) Gather() []Family {
+	reg.mutex.Lock()
+	collectors := reg.collectors[:len(reg.collectors):len(reg.collectors)]
+	reg.mutex.Unlock()
+	var families []Family
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// ServeHTTP implements the http.Handler interface, with the exposition.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	buf := bufio.NewWriter(w)
+	for _, f := range reg.Gather() {
+		f.write(buf)
+	}
+	buf.Flush()
+}
+
+func (f *Family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.Name, escapeHelp(f.Help), f.Name, f.Type)
+	for _, s := range f.Samples {
+		labels := formatLabels(f.LabelNames, s.Labels)
+		if f.Type != Histogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.Name, labels, formatFloat(s.Value))
+			continue
+		}
+		for i, n := range s.Buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.Name, withLabel(labels, "le", formatFloat(f.Bounds[i])), n)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", f.Name, withLabel(labels, "le", "+Inf"), formatFloat(s.Value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.Name, labels, formatFloat(s.Sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", f.Name, labels, formatFloat(s.Value))
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// FormatLabels returns the label set of a sample, as {name="value",…}.
+func formatLabels(names, values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(names[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
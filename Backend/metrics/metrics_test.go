@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/p2p"
+)
+
+func exposition(t *testing.T, reg *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("got content type %q, want %q", got, ContentType)
+	}
+	b, _ := io.ReadAll(rec.Body)
+	return string(b)
+}
+
+func TestRegistry(t *testing.T) {
+	reg := new(Registry)
+	requests := NewCounter("requests_total", "Requests by \"path\".\nSecond line.", "path")
+	latency := NewHistogram("latency_seconds", "Latency.", []float64{.1, 1})
+	if err := register(reg, requests, latency); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(NewCounter("requests_total", "again")); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate registration got error %v, want ErrDuplicate", err)
+	}
+	requests.Add(1, `/a"b`)
+	requests.Add(2, "/")
+	latency.Observe(.05)
+	latency.Observe(.5)
+	latency.Observe(3)
+
+	const want = `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+# HELP requests_total Requests by "path".\nSecond line.
+# TYPE requests_total counter
+requests_total{path="/"} 2
+requests_total{path="/a\"b"} 1
+`
+	if got := exposition(t, reg); got != want {
+		t.Errorf("got exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// StaticResolver resolves did:example:alice only.
+type staticResolver struct{}
+
+func (staticResolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	if did.SpecID != "alice" {
+		return nil, nil, backend.ErrNotFound
+	}
+	return &backend.Document{Subject: did}, new(backend.Meta), nil
+}
+
+func TestResolution(t *testing.T) {
+	reg := new(Registry)
+	m, err := NewResolution(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewNode(reg, new(chain.Blockchain)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewResolution(reg); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("second registration got error %v, want ErrDuplicate", err)
+	}
+
+	methods := new(backend.MethodRegistry)
+	methods.Register("example", staticResolver{})
+	r := &backend.CachedResolver{Resolver: methods, TTL: 60e9}
+	ctx := backend.WithTracer(context.Background(), m)
+	for _, id := range []string{"alice", "alice", "bob"} {
+		r.Resolve(ctx, backend.DID{Method: "example", SpecID: id})
+	}
+	// clients choose methods at will
+	for _, method := range []string{"aaa1", "aaa2"} {
+		r.Resolve(ctx, backend.DID{Method: method, SpecID: "x"})
+	}
+
+	got := exposition(t, reg)
+	for _, line := range []string{
+		`idchain_resolutions_total{method="example",outcome="notFound"} 1`,
+		`idchain_resolutions_total{method="example",outcome="ok"} 1`,
+		`idchain_resolution_duration_seconds_count{method="example"} 2`,
+		`idchain_cache_lookups_total{method="example",result="hit"} 1`,
+		`idchain_cache_lookups_total{method="example",result="miss"} 2`,
+		`idchain_resolutions_total{method="unsupported",outcome="methodNotSupported"} 2`,
+		`idchain_cache_lookups_total{method="unsupported",result="miss"} 2`,
+		`idchain_chain_height 0`,
+		`idchain_pending_operations 0`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("exposition misses %q:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "aaa") {
+		t.Errorf("exposition has the method labels of unregistered methods:\n%s", got)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	reg := new(Registry)
+	validator := backend.DID{Method: "example", SpecID: "validator"}
+	m, err := NewPeers(reg, []backend.DID{validator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	observe := m.Observer("tls")
+	observe(&p2p.Peer{ID: validator.String() + "#key-1", DID: validator, Transport: "tls"}, nil)
+	observe(&p2p.Peer{ID: "did:example:other#key-1", DID: backend.DID{Method: "example", SpecID: "other"}, Transport: "tls"}, nil)
+	observe(nil, p2p.ErrPeer)
+
+	got := exposition(t, reg)
+	for _, line := range []string{
+		`idchain_peer_handshakes_total{peer="did:example:validator",transport="tls",outcome="ok"} 1`,
+		`idchain_peer_handshakes_total{peer="other",transport="tls",outcome="ok"} 1`,
+		`idchain_peer_handshakes_total{peer="unknown",transport="tls",outcome="failed"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("exposition misses %q:\n%s", line, got)
+		}
+	}
+}
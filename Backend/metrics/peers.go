@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/p2p"
+)
+
+// Peer labels other than DIDs
+const (
+	PeerOther   = "other"   // authenticated, without a known DID
+	PeerUnknown = "unknown" // failed before identification
+)
+
+// Peers derives metrics from the handshakes of the peer network. Install
+// with the OnHandshake of a p2p.Transport.
+type Peers struct {
+	handshakes *Vec // by peer, transport and outcome
+	known      map[string]bool
+}
+
+// NewPeers registers the metrics of the peer network with reg:
+//
+//   - idchain_peer_handshakes_total by peer, transport and outcome, with
+//     "ok" or "failed"
+//
+// The peer label is the DID of the peer when in known, e.g., the validators.
+// Other peers are labelled PeerOther, or PeerUnknown when the handshake
+// failed before identification, such that peers can not grow the number of
+// samples at will.
+func NewPeers(reg Registerer, known []backend.DID) (*Peers, error) {
+	p := &Peers{
+		handshakes: NewCounter("idchain_peer_handshakes_total", "Peer network handshakes by peer DID, transport and outcome.", "peer", "transport", "outcome"),
+		known:      make(map[string]bool, len(known)),
+	}
+	for _, did := range known {
+		p.known[did.String()] = true
+	}
+	if err := register(reg, p.handshakes); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Observer returns the HandshakeFunc of a transport, e.g., "noise" or "tls".
+func (p *Peers) Observer(transport string) p2p.HandshakeFunc {
+	return func(peer *p2p.Peer, err error) {
+		label := PeerUnknown
+		if peer != nil {
+			label = PeerOther
+			if did := peer.DID.String(); p.known[did] {
+				label = did
+			}
+		}
+		outcome := "ok"
+		if err != nil {
+			outcome = "failed"
+		}
+		p.handshakes.Add(1, label, transport, outcome)
+	}
+}
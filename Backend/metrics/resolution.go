@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+)
+
+// Resolution is a backend.Tracer which derives metrics from the spans of
+// resolution. Install with backend.WithTracer, or with the Tracer of a
+// server, and combine with logs by backend.Tracers.
+type Resolution struct {
+	resolutions *Vec // by method and outcome
+	duration    *Vec // by method
+	cache       *Vec // by method and result
+	size        *Vec // by source
+
+	mutex   sync.Mutex
+	methods map[string]bool // labels of resolutions
+}
+
+// NewResolution registers the metrics of resolution with reg:
+//
+//   - idchain_resolutions_total by method and outcome, with "ok" or the
+//     backend.ErrorCategory
+//   - idchain_resolution_duration_seconds by method
+//   - idchain_cache_lookups_total by method and result, with "hit", "stale"
+//     or "miss"
+//   - idchain_document_size_bytes by source, with "fetched" for HTTP
+//     lookups and "served" for the responses of an httpserver.Server
+//
+// Methods without a resolver are labelled backend.UnsupportedMethod, such
+// that clients can not grow the number of samples at will. Cache lookups
+// get the method label of the resolutions seen only.
+func NewResolution(reg Registerer) (*Resolution, error) {
+	r := &Resolution{
+		resolutions: NewCounter("idchain_resolutions_total", "DID resolutions by method and outcome.", "method", "outcome"),
+		duration:    NewHistogram("idchain_resolution_duration_seconds", "DID resolution latency by method.", DurationBounds, "method"),
+		cache:       NewCounter("idchain_cache_lookups_total", "DID document cache lookups by method and result.", "method", "result"),
+		size:        NewHistogram("idchain_document_size_bytes", "DID document sizes by source.", SizeBounds, "source"),
+	}
+	if err := register(reg, r.resolutions, r.duration, r.cache, r.size); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func register(reg Registerer, collectors ...Collector) error {
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start implements the backend.Tracer interface.
+func (r *Resolution) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, backend.Span) {
+	return ctx, &span{metrics: r, name: name, start: time.Now(), attrs: attrs}
+}
+
+type span struct {
+	metrics *Resolution
+	name    string
+	start   time.Time
+	attrs   []slog.Attr
+}
+
+// SetAttributes implements the backend.Span interface.
+func (s *span) SetAttributes(attrs ...slog.Attr) {
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// Attr returns the last value of key, if any.
+func (s *span) attr(key string) (slog.Value, bool) {
+	for i := len(s.attrs) - 1; i >= 0; i-- {
+		if s.attrs[i].Key == key {
+			return s.attrs[i].Value, true
+		}
+	}
+	return slog.Value{}, false
+}
+
+// End implements the backend.Span interface.
+func (s *span) End(err error) {
+	method, _ := s.attr("method")
+	switch s.name {
+	case "did.resolve":
+		outcome := "ok"
+		if err != nil {
+			outcome = backend.ErrorCategory(err)
+		}
+		s.metrics.resolutions.Add(1, method.String(), outcome)
+		s.metrics.duration.Observe(time.Since(s.start).Seconds(), method.String())
+		s.metrics.mutex.Lock()
+		if s.metrics.methods == nil {
+			s.metrics.methods = make(map[string]bool)
+		}
+		s.metrics.methods[method.String()] = true
+		s.metrics.mutex.Unlock()
+	case "did.cache":
+		if result, ok := s.attr("cache"); ok {
+			s.metrics.cache.Add(1, s.metrics.methodLabel(method.String()), result.String())
+		}
+	case "http.get":
+		if n, ok := s.attr("bytes"); ok && err == nil {
+			s.metrics.size.Observe(float64(n.Int64()), "fetched")
+		}
+	case "http.request":
+		status, _ := s.attr("status")
+		if n, ok := s.attr("bytes"); ok && status.Int64() == 200 {
+			s.metrics.size.Observe(float64(n.Int64()), "served")
+		}
+	}
+}
+
+// MethodLabel returns method when a resolution had it as label, and
+// backend.UnsupportedMethod otherwise.
+func (r *Resolution) methodLabel(method string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.methods[method] {
+		return method
+	}
+	return backend.UnsupportedMethod
+}
+
+// NewNode registers the state of c with reg:
+//
+//   - idchain_chain_height, the number of blocks
+//   - idchain_chain_final_height, the number of final blocks
+//   - idchain_pending_operations, the operations not in a block yet
+func NewNode(reg Registerer, c *chain.Blockchain) error {
+	return register(reg,
+		&GaugeFunc{
+			Name: "idchain_chain_height",
+			Help: "Number of blocks on the local chain.",
+			Func: func() float64 { return float64(c.Len()) },
+		},
+		&GaugeFunc{
+			Name: "idchain_chain_final_height",
+			Help: "Number of blocks which can not revert.",
+			Func: func() float64 { return float64(c.Final()) },
+		},
+		&GaugeFunc{
+			Name: "idchain_pending_operations",
+			Help: "DID operations waiting for a block.",
+			Func: func() float64 { return float64(len(c.Pending())) },
+		},
+	)
+}
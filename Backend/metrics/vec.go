@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DurationBounds are histogram buckets in seconds, from 1 ms up to 10 s.
+var DurationBounds = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBounds are histogram buckets in bytes, from 256 B up to 1 MiB.
+var SizeBounds = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Vec is a Collector of one counter or histogram, with a sample per
+// combination of label values. Multiple goroutines may invoke methods on a Vec
+// simultaneously.
+type Vec struct {
+	family Family // without samples
+
+	mutex   sync.Mutex
+	samples map[string]*Sample // by joined label values
+}
+
+// NewCounter returns a counter with the label names.
+func NewCounter(name, help string, labelNames ...string) *Vec {
+	return &Vec{family: Family{Name: name, Help: help, Type: Counter, LabelNames: labelNames}}
+}
+
+// NewHistogram returns a histogram with the upper bounds of its buckets, in
+// ascending order, and with the label names.
+func NewHistogram(name, help string, bounds []float64, labelNames ...string) *Vec {
+	return &Vec{family: Family{Name: name, Help: help, Type: Histogram, LabelNames: labelNames, Bounds: bounds}}
+}
+
+// Sample returns the entry of the label values, in the order of the names,
+// with the mutex held.
+func (v *Vec) sample(labels []string) *Sample {
+	if len(labels) != len(v.family.LabelNames) {
+		panic("metrics: " + v.family.Name + " got wrong number of label values")
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := v.samples[key]
+	if !ok {
+		if v.samples == nil {
+			v.samples = make(map[string]*Sample)
+		}
+		s = &Sample{Labels: append([]string(nil), labels...)}
+		if v.family.Type == Histogram {
+			s.Buckets = make([]uint64, len(v.family.Bounds))
+		}
+		v.samples[key] = s
+	}
+	return s
+}
+
+// Add increments a counter with delta, which must not be negative.
+func (v *Vec) Add(delta float64, labels ...string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.sample(labels).Value += delta
+}
+
+// Observe adds a value to a histogram.
+func (v *Vec) Observe(value float64, labels ...string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	s := v.sample(labels)
+	s.Value++
+	s.Sum += value
+	for i, bound := range v.family.Bounds {
+		if value <= bound {
+			s.Buckets[i]++
+		}
+	}
+}
+
+// Names implements the Collector interface.
+func (v *Vec) Names() []string { return []string{v.family.Name} }
+
+// Collect implements the Collector interface. Samples are in order of their
+// label values.
+func (v *Vec) Collect() []Family {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	f := v.family
+	f.Samples = make([]Sample, 0, len(v.samples))
+	for _, s := range v.samples {
+		c := *s
+		c.Buckets = append([]uint64(nil), s.Buckets...)
+		f.Samples = append(f.Samples, c)
+	}
+	sort.Slice(f.Samples, func(i, j int) bool {
+		return strings.Join(f.Samples[i].Labels, "\xff") < strings.Join(f.Samples[j].Labels, "\xff")
+	})
+	return []Family{f}
+}
+
+// GaugeFunc is a Collector of a gauge without labels, which reads its value
+// on collection.
+type GaugeFunc struct {
+	Name string
+	Help string
+	Func func() float64 // must be safe for concurrent use
+}
+
+// Names implements the Collector interface.
+func (g *GaugeFunc) Names() []string { return []string{g.Name} }
+
+// Collect implements the Collector interface.
+func (g *GaugeFunc) Collect() []Family {
+	return []Family{{Name: g.Name, Help: g.Help, Type: Gauge, Samples: []Sample{{Value: g.Func()}}}}
+}
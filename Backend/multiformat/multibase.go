@@ -0,0 +1,146 @@
+// Package multiformat implements the Multibase and Multicodec encodings of the
+// Multiformats project, as in use by did:key, publicKeyMultibase and CIDs.
+// Decoding is strict, i.e., each value has exactly one valid encoding.
+package multiformat
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Base is a Multibase prefix character.
+type Base byte
+
+// Supported Multibase encodings
+const (
+	Base16    Base = 'f' // hexadecimal, lowercase
+	Base32    Base = 'b' // RFC 4648, lowercase, no padding
+	Base58BTC Base = 'z' // Bitcoin alphabet
+	Base64URL Base = 'u' // RFC 4648, no padding
+)
+
+// ErrBase signals an unsupported (or missing) Multibase prefix.
+var ErrBase = errors.New("multibase encoding not supported")
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Encode returns the encoding of data in base, including its prefix. Encode
+// panics on an unsupported base.
+func Encode(base Base, data []byte) string {
+	switch base {
+	case Base16:
+		return string(base) + hex.EncodeToString(data)
+	case Base32:
+		return string(base) + base32Lower.EncodeToString(data)
+	case Base58BTC:
+		return string(base) + encodeBase58(data)
+	case Base64URL:
+		return string(base) + base64.RawURLEncoding.EncodeToString(data)
+	}
+	panic(fmt.Sprintf("multiformat: unsupported multibase %q", rune(base)))
+}
+
+// Decode returns the data of a Multibase encoding, together with its base.
+// Errors other than ErrBase reject non-canonical encodings too.
+func Decode(s string) (Base, []byte, error) {
+	if s == "" {
+		return 0, nil, fmt.Errorf("%w: empty string", ErrBase)
+	}
+	base, body := Base(s[0]), s[1:]
+	// the standard library skips newlines
+	if strings.ContainsAny(body, "\r\n") {
+		return 0, nil, fmt.Errorf("multibase %q with line break", s[0])
+	}
+	var data []byte
+	var err error
+	switch base {
+	case Base16:
+		if strings.ToLower(body) != body {
+			return 0, nil, errors.New("multibase base16 in uppercase")
+		}
+		data, err = hex.DecodeString(body)
+	case Base32:
+		data, err = base32Lower.DecodeString(body)
+		// no strict mode for trailing bits
+		if err == nil && base32Lower.EncodeToString(data) != body {
+			return 0, nil, errors.New("multibase base32 not canonical")
+		}
+	case Base58BTC:
+		data, err = decodeBase58(body)
+	case Base64URL:
+		data, err = base64.RawURLEncoding.Strict().DecodeString(body)
+	default:
+		return 0, nil, fmt.Errorf("%w: prefix %q", ErrBase, s[0])
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("multibase %q: %w", s[0], err)
+	}
+	return base, data, nil
+}
+
+// Base58Alphabet is the Bitcoin variant, as in the base58btc of Multibase.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func encodeBase58(data []byte) string {
+	// leading zeros map to leading ones
+	var zeros int
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	// base conversion with big-endian digits; log(256)/log(58) < 1.37
+	digits := make([]byte, 0, len(data)*137/100+1)
+	for _, b := range data[zeros:] {
+		carry := int(b)
+		for i := len(digits) - 1; i >= 0; i-- {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry != 0 {
+			digits = append([]byte{byte(carry % 58)}, digits...)
+			carry /= 58
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(zeros + len(digits))
+	for i := 0; i < zeros; i++ {
+		b.WriteByte('1')
+	}
+	for _, d := range digits {
+		b.WriteByte(base58Alphabet[d])
+	}
+	return b.String()
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	var zeros int
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+
+	// base conversion with big-endian bytes
+	var bytes []byte
+	for i := zeros; i < len(s); i++ {
+		v := strings.IndexByte(base58Alphabet, s[i])
+		if v < 0 {
+			return nil, fmt.Errorf("illegal base58 character %q at byte № %d", s[i], i+2)
+		}
+		carry := v
+		for j := len(bytes) - 1; j >= 0; j-- {
+			carry += int(bytes[j]) * 58
+			bytes[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry != 0 {
+			bytes = append([]byte{byte(carry)}, bytes...)
+			carry >>= 8
+		}
+	}
+	return append(make([]byte, zeros, zeros+len(bytes)), bytes...), nil
+}
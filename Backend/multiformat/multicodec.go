@@ -0,0 +1,87 @@
+package multiformat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Multicodec identifiers in use
+const (
+	Identity = 0x00 // multihash
+	SHA2_256 = 0x12 // multihash
+	SHA2_512 = 0x13 // multihash
+	Raw      = 0x55 // IPLD
+	DagPB    = 0x70 // IPLD
+	DagCBOR  = 0x71 // IPLD
+
+	Secp256k1Pub = 0xe7
+	X25519Pub    = 0xec
+	Ed25519Pub   = 0xed
+	P256Pub      = 0x1200
+	P384Pub      = 0x1201
+	P521Pub      = 0x1202
+)
+
+// AppendUvarint appends the unsigned varint of Multiformats.
+func AppendUvarint(p []byte, v uint64) []byte {
+	for v >= 0x80 {
+		p = append(p, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(p, byte(v))
+}
+
+// ReadUvarint returns the unsigned varint of Multiformats, with its size.
+// Varints must be minimal, and at most 9 bytes.
+func ReadUvarint(p []byte) (v uint64, n int, err error) {
+	for i := 0; i < len(p) && i < 9; i++ {
+		b := p[i]
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			if b == 0 && i != 0 {
+				return 0, 0, errors.New("multicodec varint not minimal")
+			}
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("multicodec varint incomplete")
+}
+
+// AddPrefix returns data with the Multicodec prefix of codec.
+func AddPrefix(codec uint64, data []byte) []byte {
+	return append(AppendUvarint(make([]byte, 0, 3+len(data)), codec), data...)
+}
+
+// SplitPrefix returns the Multicodec of p, and the data that follows.
+func SplitPrefix(p []byte) (codec uint64, data []byte, err error) {
+	codec, n, err := ReadUvarint(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	return codec, p[n:], nil
+}
+
+// EncodeMultihash returns the Multihash of a digest, conform the function
+// code of the hash.
+func EncodeMultihash(code uint64, digest []byte) []byte {
+	p := AppendUvarint(make([]byte, 0, 4+len(digest)), code)
+	p = AppendUvarint(p, uint64(len(digest)))
+	return append(p, digest...)
+}
+
+// DecodeMultihash returns the function code and the digest of a Multihash.
+func DecodeMultihash(p []byte) (code uint64, digest []byte, err error) {
+	code, n, err := ReadUvarint(p)
+	if err != nil {
+		return 0, nil, fmt.Errorf("multihash code: %w", err)
+	}
+	size, m, err := ReadUvarint(p[n:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("multihash size: %w", err)
+	}
+	digest = p[n+m:]
+	if uint64(len(digest)) != size {
+		return 0, nil, fmt.Errorf("multihash digest has %d bytes, want %d", len(digest), size)
+	}
+	return code, digest, nil
+}
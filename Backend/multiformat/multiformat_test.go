@@ -0,0 +1,119 @@
+package multiformat
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Vectors from the Multibase test suite.
+func TestMultibase(t *testing.T) {
+	data := []byte("yes mani !")
+	tests := []struct {
+		base Base
+		want string
+	}{
+		{Base16, "f796573206d616e692021"},
+		{Base32, "bpfsxgidnmfxgsibb"},
+		{Base58BTC, "z7paNL19xttacUY"},
+		{Base64URL, "ueWVzIG1hbmkgIQ"},
+	}
+	for _, test := range tests {
+		got := Encode(test.base, data)
+		if got != test.want {
+			t.Errorf("%c got %q, want %q", test.base, got, test.want)
+		}
+		base, decoded, err := Decode(test.want)
+		if err != nil {
+			t.Errorf("%q got error: %s", test.want, err)
+			continue
+		}
+		if base != test.base || !bytes.Equal(decoded, data) {
+			t.Errorf("%q got %c %q, want %c %q", test.want, base, decoded, test.base, data)
+		}
+	}
+}
+
+func TestMultibaseStrict(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"F796573",              // uppercase base16 prefix
+		"f79657",               // odd length
+		"f79ABCD",              // uppercase digits
+		"bpfsxgidnmfxgsibb===", // padding
+		"bab",                  // non-zero trailing bits
+		"z0OIl",                // not in alphabet
+		"ueWVzIG1hbmkgIR",      // non-zero trailing bits
+		"ueWVzIG1hbmkgIQ==",    // padding
+		"m8J+Yhg",              // standard base64
+	} {
+		if _, _, err := Decode(s); err == nil {
+			t.Errorf("%q got no error", s)
+		}
+	}
+	if _, _, err := Decode("m8J+Yhg"); !errors.Is(err, ErrBase) {
+		t.Errorf("base64 got error %v, want ErrBase", err)
+	}
+}
+
+func TestMultihash(t *testing.T) {
+	digest := bytes.Repeat([]byte{0xaa}, 32)
+	p := EncodeMultihash(SHA2_256, digest)
+	if !bytes.HasPrefix(p, []byte{0x12, 0x20}) || len(p) != 34 {
+		t.Errorf("got multihash %x", p)
+	}
+	code, got, err := DecodeMultihash(p)
+	if err != nil || code != SHA2_256 || !bytes.Equal(got, digest) {
+		t.Errorf("got code %#x, digest %x, error %v", code, got, err)
+	}
+	if _, _, err := DecodeMultihash(p[:33]); err == nil {
+		t.Error("truncated multihash got no error")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	p := AddPrefix(P256Pub, []byte{1, 2})
+	if want := []byte{0x80, 0x24, 1, 2}; !bytes.Equal(p, want) {
+		t.Errorf("got %x, want %x", p, want)
+	}
+	codec, data, err := SplitPrefix(p)
+	if err != nil || codec != P256Pub || !bytes.Equal(data, []byte{1, 2}) {
+		t.Errorf("got codec %#x, data %x, error %v", codec, data, err)
+	}
+	for _, p := range [][]byte{nil, {0x80}, {0x80, 0x00}, bytes.Repeat([]byte{0xff}, 10)} {
+		if _, _, err := SplitPrefix(p); err == nil {
+			t.Errorf("%x got no error", p)
+		}
+	}
+}
+
+// Decoding is strict, so any valid input encodes back into itself.
+func FuzzMultibase(f *testing.F) {
+	for _, s := range []string{"f796573206d616e692021", "bpfsxgidnmfxgsibb", "z7paNL19xttacUY", "ueWVzIG1hbmkgIQ", "z1", "u"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		base, data, err := Decode(s)
+		if err != nil {
+			return
+		}
+		if got := Encode(base, data); got != s {
+			t.Errorf("%q decoded to %x, which encodes as %q", s, data, got)
+		}
+	})
+}
+
+// Varints are minimal, so any valid input encodes back into itself.
+func FuzzUvarint(f *testing.F) {
+	f.Add([]byte{0xed, 0x01})
+	f.Add([]byte{0x80, 0x24})
+	f.Fuzz(func(t *testing.T, p []byte) {
+		v, n, err := ReadUvarint(p)
+		if err != nil {
+			return
+		}
+		if got := AppendUvarint(nil, v); !bytes.Equal(got, p[:n]) {
+			t.Errorf("%x read as %d, which encodes as %x", p[:n], v, got)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package nodeapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/events"
+)
+
+// Client invokes the service of a node. It implements
+// backend.VersionResolver with the Resolve call.
+type Client struct {
+	URL string // base, e.g., "https://node.example:7443"
+
+	// HTTP must support HTTP/2, which the http.DefaultClient does over
+	// TLS. Nil defaults to the http.DefaultClient.
+	HTTP *http.Client
+
+	// Header, when set, goes with each call, e.g., an authz.APIKeyHeader
+	// for nodes with access control.
+	Header http.Header
+}
+
+// Call executes method with in, and it decodes the response into out.
+func (c *Client) call(ctx context.Context, method string, in, out message) error {
+	resp, err := c.open(ctx, method, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 5+MessageMax))
+	if err != nil {
+		return &Status{Code: Unavailable, Message: "response: " + err.Error()}
+	}
+	if err := responseStatus(resp); err != nil {
+		return err
+	}
+	if err := readMessage(bytes.NewReader(data), out); err != nil {
+		return fmt.Errorf("nodeapi: %s response: %w", method, err)
+	}
+	return nil
+}
+
+// Open sends a request of method with in, and it returns the response once
+// the headers arrived.
+func (c *Client) open(ctx context.Context, method string, in message) (*http.Response, error) {
+	body := in.marshal()
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(body)))
+	url := strings.TrimSuffix(c.URL, "/") + "/" + ServiceName + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(append(frame, body...)))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", formatTimeout(time.Until(deadline)))
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &Status{Code: Unavailable, Message: err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, &Status{Code: Unknown, Message: fmt.Sprintf("node got HTTP %q: %s", resp.Status, bytes.TrimSpace(data))}
+	}
+	return resp, nil
+}
+
+// ResponseStatus returns the status of a response, after its body was read,
+// as an error, or nil for OK.
+func responseStatus(resp *http.Response) error {
+	// status in trailers, or in the headers of trailers-only responses
+	code, msg := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code, msg = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	n, err := strconv.ParseUint(code, 10, 32)
+	if err != nil {
+		return &Status{Code: Internal, Message: fmt.Sprintf("node response without gRPC status; got %q", code)}
+	}
+	if Code(n) != OK {
+		return &Status{Code: Code(n), Message: decodeStatusMessage(msg)}
+	}
+	return nil
+}
+
+// SubmitOperation adds a did:idchain log entry to the ledger of the node.
+func (c *Client) SubmitOperation(ctx context.Context, entry string) (backend.DID, error) {
+	var resp submitResponse
+	if err := c.call(ctx, "SubmitOperation", &submitRequest{Entry: entry}, &resp); err != nil {
+		return backend.DID{}, err
+	}
+	return backend.Parse(resp.DID)
+}
+
+// Resolve implements the backend.Resolver interface.
+func (c *Client) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return c.ResolveVersion(ctx, did, "", time.Time{})
+}
+
+// ResolveVersion implements the backend.VersionResolver interface.
+func (c *Client) ResolveVersion(ctx context.Context, did backend.DID, versionID string, versionTime time.Time) (*backend.Document, *backend.Meta, error) {
+	req := resolveRequest{DID: did.String(), VersionID: versionID}
+	if !versionTime.IsZero() {
+		req.VersionTime = versionTime.UTC().Format(time.RFC3339)
+	}
+	var resp resolveResponse
+	if err := c.call(ctx, "Resolve", &req, &resp); err != nil {
+		return nil, nil, err
+	}
+	doc := new(backend.Document)
+	if err := json.Unmarshal(resp.Document, doc); err != nil {
+		return nil, nil, fmt.Errorf("nodeapi: DID document: %w", err)
+	}
+	meta := new(backend.Meta)
+	if len(resp.Meta) != 0 {
+		if err := json.Unmarshal(resp.Meta, meta); err != nil {
+			return nil, nil, fmt.Errorf("nodeapi: DID document metadata: %w", err)
+		}
+	}
+	return doc, meta, nil
+}
+
+// OperationLog invokes GetOperationLog.
+func (c *Client) OperationLog(ctx context.Context, did backend.DID) ([]string, error) {
+	var resp logResponse
+	if err := c.call(ctx, "GetOperationLog", &logRequest{DID: did.String()}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// ChainInfo invokes GetChainInfo.
+func (c *Client) ChainInfo(ctx context.Context) (*ChainInfo, error) {
+	info := new(ChainInfo)
+	if err := c.call(ctx, "GetChainInfo", new(chainInfoRequest), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// SubscribeEvents invokes the SubscribeEvents stream, and it passes each event
+// which matches f to fn, from sequence number from on, with zero for new
+// events only. It returns when ctx is done, when fn fails, or when the stream
+// ends. Resume from the sequence number after the last event passed, for
+// delivery at least once.
+func (c *Client) SubscribeEvents(ctx context.Context, from uint64, f events.Filter, fn func(*events.Event) error) error {
+	resp, err := c.open(ctx, "SubscribeEvents", &subscribeRequest{From: from, Filter: f})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Grpc-Status") != "" {
+		return responseStatus(resp) // trailers-only
+	}
+	r := bufio.NewReader(resp.Body)
+	for {
+		if _, err := r.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &Status{Code: Unavailable, Message: "event stream: " + err.Error()}
+		}
+		m := new(eventMessage)
+		if err := readMessage(r, m); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("nodeapi: SubscribeEvents response: %w", err)
+		}
+		if err := fn(m.Event); err != nil {
+			return err
+		}
+	}
+	return responseStatus(resp)
+}
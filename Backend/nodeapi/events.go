@@ -0,0 +1,235 @@
+package nodeapi
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+// EventsPath is the WebSocket endpoint of the block stream, next to the gRPC
+// service, as gRPC has no browser support and no reconnect semantics.
+const EventsPath = "/events"
+
+// EventsRequest is the first message from the client of a block stream, after
+// authentication, if any.
+type EventsRequest struct {
+	From uint64 `json:"from"` // height of the first block
+
+	// After is the hash of the block before From, as received, if any.
+	// The stream goes back to the final blocks when it was replaced.
+	After *chain.Hash `json:"after,omitempty"`
+}
+
+// BlockEvent is a message of the block stream. Blocks go in order of height.
+// After a reorganization, the stream continues from the first block replaced,
+// with Reorganized set, and the block replaces any previous one of its height.
+type BlockEvent struct {
+	Block       *chain.Block `json:"block"`
+	Final       uint64       `json:"final"` // number of final blocks
+	Reorganized bool         `json:"reorganized,omitempty"`
+}
+
+// ServeEvents runs the server side of a block stream on conn.
+func (s *Server) serveEvents(ctx context.Context, conn *websocket.Conn) {
+	defer conn.Close()
+	var p *authz.Principal
+	if s.Auth != nil {
+		var err error
+		p, err = s.Auth.AuthenticateConn(ctx, conn)
+		if err != nil {
+			s.log().Info("node event stream authentication failed", "error", err)
+			return
+		}
+		s.log().Info("node event stream authenticated", "did", p.ID)
+	}
+	if s.Policy != nil {
+		if err := s.Policy.Authorize(p, http.MethodGet, EventsPath); err != nil {
+			s.log().Warn("node event stream denied", "error", err)
+			conn.CloseStatus(websocket.ClosePolicy, "permission denied")
+			return
+		}
+	}
+	interval := s.PingInterval
+	if interval <= 0 {
+		interval = websocket.PingIntervalDefault
+	}
+	defer conn.KeepAlive(interval)()
+
+	var req EventsRequest
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		err = json.Unmarshal(data, &req)
+	}
+	if err != nil {
+		s.log().Info("node event stream request failed", "error", err)
+		conn.CloseStatus(websocket.CloseProtocol, "events request required")
+		return
+	}
+
+	// reads detect the close of the client
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	next := req.From
+	sent := make(map[uint64]chain.Hash) // blocks which may revert
+	if req.After != nil && next > 0 {
+		sent[next-1] = *req.After
+	}
+	var final uint64
+	for {
+		changed := s.Chain.Changed()
+
+		// rewind to the first block replaced
+		reorganized := false
+		for next > 0 {
+			hash, ok := sent[next-1]
+			if !ok {
+				break
+			}
+			b, err := s.Chain.Block(next - 1)
+			if err == nil && b.Hash() == hash {
+				break
+			}
+			delete(sent, next-1)
+			next, reorganized = next-1, true
+			if _, ok := sent[next-1]; !ok {
+				// history unknown, as with resumes
+				next = min(next, s.Chain.Final())
+			}
+		}
+
+		for ; next < s.Chain.Len(); next++ {
+			b, err := s.Chain.Block(next)
+			if err != nil {
+				break // reorganized to a shorter chain in the meantime
+			}
+			final = s.Chain.Final()
+			if err := writeEvent(conn, &BlockEvent{Block: b, Final: final, Reorganized: reorganized}); err != nil {
+				return
+			}
+			sent[next] = b.Hash()
+			reorganized = false
+		}
+		if f := s.Chain.Final(); f != final {
+			final = f
+			if next != 0 {
+				// finality update with the last block again
+				b, err := s.Chain.Block(next - 1)
+				if err == nil {
+					if err := writeEvent(conn, &BlockEvent{Block: b, Final: final}); err != nil {
+						return
+					}
+				}
+			}
+		}
+		for h := range sent {
+			if h < final {
+				delete(sent, h)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case <-changed:
+		}
+	}
+}
+
+func writeEvent(conn *websocket.Conn, e *BlockEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Events follows the block stream of a node, with reconnects which resume
+// after the last block received. Blocks may repeat, e.g., for updates of
+// finality, so handlers must be idempotent.
+type Events struct {
+	// Client has the WebSocket URL of the node, with EventsPath, e.g.,
+	// "wss://node.example:7443/events". Run sets the Hello and the
+	// Receive.
+	Client websocket.Client
+
+	// Audience, when set, answers the challenge of a Server with Auth
+	// with the authentication method KeyID and its Signer.
+	Audience string
+	KeyID    *backend.URL
+	Signer   crypto.Signer
+
+	// Handle gets each event, in order of arrival.
+	Handle func(e *BlockEvent)
+
+	mutex sync.Mutex
+	next  uint64      // height to resume from
+	after *chain.Hash // of the block before next, if any
+}
+
+// Run follows the stream from the block at height from on, until ctx is done.
+func (e *Events) Run(ctx context.Context, from uint64) error {
+	e.mutex.Lock()
+	e.next, e.after = from, nil
+	e.mutex.Unlock()
+
+	e.Client.Hello = func(ctx context.Context, conn *websocket.Conn) error {
+		if e.Audience != "" {
+			if err := authz.AnswerChallenge(conn, e.Audience, e.KeyID, e.Signer); err != nil {
+				return err
+			}
+		}
+		e.mutex.Lock()
+		req := EventsRequest{From: e.next, After: e.after}
+		e.mutex.Unlock()
+		data, err := json.Marshal(&req)
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+	e.Client.Receive = func(_ int, data []byte) {
+		event := new(BlockEvent)
+		if err := json.Unmarshal(data, event); err != nil || event.Block == nil {
+			return
+		}
+		hash := event.Block.Hash()
+		e.mutex.Lock()
+		e.next, e.after = event.Block.Height+1, &hash
+		e.mutex.Unlock()
+		if e.Handle != nil {
+			e.Handle(event)
+		}
+	}
+	return e.Client.Run(ctx)
+}
+
+// EventsURL returns the WebSocket URL of the block stream for the base URL of
+// a Client.
+func EventsURL(base string) (string, error) {
+	switch {
+	case strings.HasPrefix(base, "https://"):
+		return "wss://" + strings.TrimSuffix(strings.TrimPrefix(base, "https://"), "/") + EventsPath, nil
+	case strings.HasPrefix(base, "http://"):
+		return "ws://" + strings.TrimSuffix(strings.TrimPrefix(base, "http://"), "/") + EventsPath, nil
+	}
+	return "", fmt.Errorf("node URL %q is not HTTP", base)
+}
@@ -0,0 +1,523 @@
+// Package nodeapi provides the gRPC API of IDChain nodes, as defined in
+// node.proto, such that services can submit DID operations and resolve DIDs
+// without embedding the library. Server and Client speak the gRPC protocol
+// over HTTP/2 with the standard library only. Both the protobuf encoding of
+// the messages and the framing are implemented here, without code generation.
+// Compression is not supported.
+package nodeapi
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/events"
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+// ServiceName is the fully qualified name of the gRPC service.
+const ServiceName = "idchain.node.v1.Node"
+
+// MessageMax is the size limit of messages in bytes, which is the gRPC default.
+const MessageMax = 4 << 20
+
+// Code is a gRPC status code.
+type Code uint32
+
+// Status codes in use
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	Unauthenticated    Code = 16
+)
+
+// Status is the error of a failed call.
+type Status struct {
+	Code    Code
+	Message string
+}
+
+// Error implements the error interface.
+func (s *Status) Error() string {
+	return fmt.Sprintf("gRPC status %d: %s", s.Code, s.Message)
+}
+
+// Is matches the errors of the library which map to the status code, such
+// that errors.Is works the same on both ends.
+func (s *Status) Is(target error) bool {
+	switch target {
+	case backend.ErrInvalid:
+		return s.Code == InvalidArgument
+	case backend.ErrNotFound:
+		return s.Code == NotFound
+	case backend.ErrMethodNotSupported:
+		return s.Code == Unimplemented
+	case backend.ErrDeactivated:
+		return s.Code == FailedPrecondition
+	case idchain.ErrConflict:
+		return s.Code == Aborted
+	case events.ErrExpired:
+		return s.Code == OutOfRange
+	case authz.ErrUnauthenticated:
+		return s.Code == Unauthenticated
+	case authz.ErrForbidden:
+		return s.Code == PermissionDenied
+	case context.Canceled:
+		return s.Code == Canceled
+	case context.DeadlineExceeded:
+		return s.Code == DeadlineExceeded
+	}
+	return false
+}
+
+// StatusOf returns the status of an error.
+func statusOf(err error) *Status {
+	var s *Status
+	if errors.As(err, &s) {
+		return s
+	}
+	code := Internal
+	switch {
+	case errors.Is(err, backend.ErrInvalid):
+		code = InvalidArgument
+	case errors.Is(err, backend.ErrNotFound):
+		code = NotFound
+	case errors.Is(err, backend.ErrMethodNotSupported):
+		code = Unimplemented
+	case errors.Is(err, backend.ErrDeactivated):
+		code = FailedPrecondition
+	case errors.Is(err, idchain.ErrConflict):
+		code = Aborted
+	case errors.Is(err, events.ErrExpired):
+		code = OutOfRange
+	case errors.Is(err, authz.ErrUnauthenticated):
+		code = Unauthenticated
+	case errors.Is(err, authz.ErrForbidden):
+		code = PermissionDenied
+	case errors.Is(err, context.Canceled):
+		code = Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = DeadlineExceeded
+	}
+	return &Status{Code: code, Message: err.Error()}
+}
+
+// EncodeStatusMessage applies the percent-encoding of the grpc-message header.
+func encodeStatusMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// DecodeStatusMessage reverts encodeStatusMessage. Malformed escapes pass as
+// is, conform the gRPC specification.
+func decodeStatusMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// FormatTimeout returns the grpc-timeout header value of d.
+func formatTimeout(d time.Duration) string {
+	if d < time.Millisecond {
+		return strconv.FormatInt(max(int64(d/time.Microsecond), 1), 10) + "u"
+	}
+	// at most 8 digits
+	if ms := d / time.Millisecond; ms < 1e8 {
+		return strconv.FormatInt(int64(ms), 10) + "m"
+	}
+	return strconv.FormatInt(min(int64(d/time.Second), 1e8-1), 10) + "S"
+}
+
+// ParseTimeout returns the duration of a grpc-timeout header value.
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[s[len(s)-1]]
+	return time.Duration(n) * unit, ok
+}
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errProto = errors.New("nodeapi: malformed protobuf message")
+
+// Message is a protobuf message of the service.
+type message interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// AppendBytes adds a length-delimited field, unless empty.
+func appendBytes[T string | []byte](p []byte, num int, v T) []byte {
+	if len(v) == 0 {
+		return p
+	}
+	p = binary.AppendUvarint(p, uint64(num)<<3|wireBytes)
+	p = binary.AppendUvarint(p, uint64(len(v)))
+	return append(p, v...)
+}
+
+// AppendUint adds a varint field, unless zero.
+func appendUint(p []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return p
+	}
+	p = binary.AppendUvarint(p, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(p, v)
+}
+
+// Field is a decoded protobuf field.
+type field struct {
+	num, wire int
+	varint    uint64 // wire type varint
+	data      []byte // wire type length-delimited
+}
+
+func (f *field) string() (string, error) {
+	if f.wire != wireBytes {
+		return "", fmt.Errorf("%w: field %d of wire type %d, want length-delimited", errProto, f.num, f.wire)
+	}
+	return string(f.data), nil
+}
+
+func (f *field) bytes() ([]byte, error) {
+	s, err := f.string()
+	return []byte(s), err
+}
+
+func (f *field) uint64() (uint64, error) {
+	if f.wire != wireVarint {
+		return 0, fmt.Errorf("%w: field %d of wire type %d, want varint", errProto, f.num, f.wire)
+	}
+	return f.varint, nil
+}
+
+// ParseFields invokes fn for each field in order of appearance. Fields of
+// fixed size are passed without their value.
+func parseFields(p []byte, fn func(f *field) error) error {
+	for len(p) != 0 {
+		tag, n := binary.Uvarint(p)
+		if n <= 0 || tag>>3 == 0 || tag>>3 > 1<<29-1 {
+			return fmt.Errorf("%w: tag", errProto)
+		}
+		p = p[n:]
+		f := field{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(p)
+			if n <= 0 {
+				return fmt.Errorf("%w: varint of field %d", errProto, f.num)
+			}
+		case wireBytes:
+			size, m := binary.Uvarint(p)
+			if m <= 0 || size > uint64(len(p)-m) {
+				return fmt.Errorf("%w: length of field %d", errProto, f.num)
+			}
+			f.data = p[m : m+int(size)]
+			n = m + int(size)
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		default:
+			return fmt.Errorf("%w: wire type %d of field %d", errProto, f.wire, f.num)
+		}
+		if n > len(p) {
+			return fmt.Errorf("%w: field %d truncated", errProto, f.num)
+		}
+		p = p[n:]
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type submitRequest struct {
+	Entry string
+}
+
+func (m *submitRequest) marshal() []byte {
+	return appendBytes(nil, 1, m.Entry)
+}
+
+func (m *submitRequest) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		if f.num == 1 {
+			m.Entry, err = f.string()
+		}
+		return err
+	})
+}
+
+type submitResponse struct {
+	DID           string
+	OperationHash string
+}
+
+func (m *submitResponse) marshal() []byte {
+	p := appendBytes(nil, 1, m.DID)
+	return appendBytes(p, 2, m.OperationHash)
+}
+
+func (m *submitResponse) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			m.DID, err = f.string()
+		case 2:
+			m.OperationHash, err = f.string()
+		}
+		return err
+	})
+}
+
+type resolveRequest struct {
+	DID         string
+	VersionID   string
+	VersionTime string // RFC 3339
+}
+
+func (m *resolveRequest) marshal() []byte {
+	p := appendBytes(nil, 1, m.DID)
+	p = appendBytes(p, 2, m.VersionID)
+	return appendBytes(p, 3, m.VersionTime)
+}
+
+func (m *resolveRequest) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			m.DID, err = f.string()
+		case 2:
+			m.VersionID, err = f.string()
+		case 3:
+			m.VersionTime, err = f.string()
+		}
+		return err
+	})
+}
+
+type resolveResponse struct {
+	Document []byte // JSON
+	Meta     []byte // JSON
+}
+
+func (m *resolveResponse) marshal() []byte {
+	p := appendBytes(nil, 1, m.Document)
+	return appendBytes(p, 2, m.Meta)
+}
+
+func (m *resolveResponse) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			m.Document, err = f.bytes()
+		case 2:
+			m.Meta, err = f.bytes()
+		}
+		return err
+	})
+}
+
+type logRequest struct {
+	DID string
+}
+
+func (m *logRequest) marshal() []byte {
+	return appendBytes(nil, 1, m.DID)
+}
+
+func (m *logRequest) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		if f.num == 1 {
+			m.DID, err = f.string()
+		}
+		return err
+	})
+}
+
+type logResponse struct {
+	Entries []string
+}
+
+func (m *logResponse) marshal() []byte {
+	var p []byte
+	for _, e := range m.Entries {
+		// repeated fields include empty values
+		p = binary.AppendUvarint(p, 1<<3|wireBytes)
+		p = binary.AppendUvarint(p, uint64(len(e)))
+		p = append(p, e...)
+	}
+	return p
+}
+
+func (m *logResponse) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) error {
+		if f.num != 1 {
+			return nil
+		}
+		e, err := f.string()
+		m.Entries = append(m.Entries, e)
+		return err
+	})
+}
+
+type chainInfoRequest struct{}
+
+func (*chainInfoRequest) marshal() []byte        { return nil }
+func (*chainInfoRequest) unmarshal([]byte) error { return nil }
+
+// ChainInfo is the status of the ledger of a node.
+type ChainInfo struct {
+	Blocks      uint64     // chain length
+	FinalBlocks uint64     // blocks which can not revert
+	HeadHash    chain.Hash // zero without blocks
+	HeadTime    time.Time  // zero without blocks
+	Pending     uint64     // transactions not in a block yet
+}
+
+func (m *ChainInfo) marshal() []byte {
+	p := appendUint(nil, 1, m.Blocks)
+	p = appendUint(p, 2, m.FinalBlocks)
+	if m.Blocks != 0 {
+		p = appendBytes(p, 3, m.HeadHash.String())
+		p = appendBytes(p, 4, m.HeadTime.UTC().Format(time.RFC3339Nano))
+	}
+	return appendUint(p, 5, m.Pending)
+}
+
+func (m *ChainInfo) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		var s string
+		switch f.num {
+		case 1:
+			m.Blocks, err = f.uint64()
+		case 2:
+			m.FinalBlocks, err = f.uint64()
+		case 3:
+			if s, err = f.string(); err == nil {
+				err = m.HeadHash.UnmarshalText([]byte(s))
+			}
+		case 4:
+			if s, err = f.string(); err == nil {
+				m.HeadTime, err = time.Parse(time.RFC3339Nano, s)
+			}
+		case 5:
+			m.Pending, err = f.uint64()
+		}
+		return err
+	})
+}
+
+type subscribeRequest struct {
+	From   uint64
+	Filter events.Filter
+}
+
+func (m *subscribeRequest) marshal() []byte {
+	p := appendUint(nil, 1, m.From)
+	for _, t := range m.Filter.Types {
+		p = appendBytes(p, 2, string(t))
+	}
+	return appendBytes(p, 3, m.Filter.DID)
+}
+
+func (m *subscribeRequest) unmarshal(p []byte) error {
+	return parseFields(p, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			m.From, err = f.uint64()
+		case 2:
+			var s string
+			if s, err = f.string(); err == nil {
+				m.Filter.Types = append(m.Filter.Types, events.Type(s))
+			}
+		case 3:
+			m.Filter.DID, err = f.string()
+		}
+		return err
+	})
+}
+
+// EventMessage has the event in JSON, with the sequence number and the type
+// in fields of their own for routing without decoding.
+type eventMessage struct {
+	Event *events.Event
+}
+
+func (m *eventMessage) marshal() []byte {
+	p := appendUint(nil, 1, m.Event.Seq)
+	p = appendBytes(p, 2, string(m.Event.Type))
+	data, _ := json.Marshal(m.Event) // no failing fields
+	return appendBytes(p, 3, data)
+}
+
+func (m *eventMessage) unmarshal(p []byte) error {
+	m.Event = nil
+	err := parseFields(p, func(f *field) error {
+		if f.num != 3 {
+			return nil
+		}
+		data, err := f.bytes()
+		if err != nil {
+			return err
+		}
+		m.Event = new(events.Event)
+		if err := json.Unmarshal(data, m.Event); err != nil {
+			return fmt.Errorf("%w: event JSON: %w", errProto, err)
+		}
+		return nil
+	})
+	if err == nil && m.Event == nil {
+		err = fmt.Errorf("%w: event without JSON", errProto)
+	}
+	return err
+}
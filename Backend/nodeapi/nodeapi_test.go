@@ -0,0 +1,313 @@
+package nodeapi
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/events"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+func TestMessages(t *testing.T) {
+	in := &logResponse{Entries: []string{"a", "", "c"}}
+	out := new(logResponse)
+	if err := out.unmarshal(in.marshal()); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("repeated field round trip got %q, error %v", out.Entries, err)
+	}
+
+	info := &ChainInfo{Blocks: 300, FinalBlocks: 2, HeadHash: chain.Hash{1, 2}, HeadTime: time.Unix(1e9, 5).UTC(), Pending: 1}
+	got := new(ChainInfo)
+	if err := got.unmarshal(info.marshal()); err != nil || !reflect.DeepEqual(info, got) {
+		t.Errorf("chain info round trip got %+v, error %v", got, err)
+	}
+
+	// unknown fields of all wire types skip
+	p := []byte{0x10, 0x96, 0x01, 0x19, 1, 2, 3, 4, 5, 6, 7, 8, 0x25, 1, 2, 3, 4}
+	p = appendBytes(p, 1, "x")
+	var req submitRequest
+	if err := req.unmarshal(p); err != nil || req.Entry != "x" {
+		t.Errorf("with unknown fields got %q, error %v", req.Entry, err)
+	}
+	for _, p := range [][]byte{{0x0a, 5, 'x'}, {0x08, 0x80}, {0x0b}, {0x0a}} {
+		if err := req.unmarshal(p); !errors.Is(err, errProto) {
+			t.Errorf("%#x got error %v, want errProto", p, err)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, d := range []time.Duration{time.Nanosecond, 3 * time.Millisecond, time.Minute, 48 * time.Hour} {
+		got, ok := parseTimeout(formatTimeout(d))
+		if !ok || got < d-time.Microsecond || got > d+time.Microsecond {
+			t.Errorf("%s got %s, %t", d, got, ok)
+		}
+	}
+	if msg := "1% of Ω\n"; decodeStatusMessage(encodeStatusMessage(msg)) != msg {
+		t.Errorf("status message %q got encoded as %q", msg, encodeStatusMessage(msg))
+	}
+}
+
+func TestNode(t *testing.T) {
+	ctx := context.Background()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := didkey.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority := &chain.Authority{
+		Validators: []backend.DID{validator},
+		Resolver:   new(didkey.Resolver),
+		KeyID:      &backend.URL{DID: validator, RawFragment: "#" + validator.SpecID},
+		Signer:     key,
+	}
+	bc := &chain.Blockchain{Consensus: authority}
+
+	broker := &events.Broker{Log: &events.MemoryLog{Max: 1}}
+	ledgerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go (&events.Ledger{Broker: broker, Chain: bc}).Run(ledgerCtx)
+
+	var submitted []backend.DID
+	srv := httptest.NewUnstartedServer(&Server{Chain: bc,
+		Submitted: func(_ string, did backend.DID) { submitted = append(submitted, did) },
+		Events:    broker,
+	})
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	c := &Client{URL: srv.URL, HTTP: srv.Client()}
+
+	id := backend.URL{DID: idchain.Placeholder, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, idchain.Placeholder, pub, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis, did, err := idchain.NewGenesis(&backend.Document{
+		Subject:              idchain.Placeholder,
+		VerificationMethods:  []*backend.VerificationMethod{m},
+		CapabilityInvocation: &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}},
+	}, &id, key, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.SubmitOperation(ctx, genesis)
+	if err != nil {
+		t.Fatal("submit:", err)
+	}
+	if !got.Equal(did) || len(submitted) != 1 {
+		t.Errorf("submit got DID %s, %d notifications", got.String(), len(submitted))
+	}
+	if _, err := c.SubmitOperation(ctx, genesis); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("second submit got error %v, want ErrInvalid", err)
+	}
+	if _, err := c.SubmitOperation(ctx, "junk"); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("junk submit got error %v, want ErrInvalid", err)
+	}
+
+	doc, meta, err := c.Resolve(ctx, did)
+	if err != nil {
+		t.Fatal("resolve:", err)
+	}
+	if !doc.Subject.Equal(did) || meta.VersionID != "1" {
+		t.Errorf("resolve got document %+v, meta %+v", doc, meta)
+	}
+	if _, meta, err := c.ResolveVersion(ctx, did, "1", time.Time{}); err != nil || meta.VersionID != "1" {
+		t.Errorf("resolve version got meta %+v, error %v", meta, err)
+	}
+	unknown := backend.DID{Method: idchain.Method, SpecID: "unknown"}
+	if _, _, err := c.Resolve(ctx, unknown); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("resolve unknown got error %v, want ErrNotFound", err)
+	}
+
+	entries, err := c.OperationLog(ctx, did)
+	if err != nil || len(entries) != 1 || entries[0] != genesis {
+		t.Errorf("operation log got %q, error %v", entries, err)
+	}
+
+	info, err := c.ChainInfo(ctx)
+	if err != nil || info.Blocks != 0 || info.Pending != 1 {
+		t.Errorf("chain info got %+v, error %v", info, err)
+	}
+	b, err := authority.ProposeBlock(ctx, nil, bc.Pending())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	bc.Finalize(0)
+	info, err = c.ChainInfo(ctx)
+	want := &ChainInfo{Blocks: 1, FinalBlocks: 1, HeadHash: b.Hash(), HeadTime: b.Time}
+	if err != nil || !reflect.DeepEqual(info, want) {
+		t.Errorf("chain info got %+v, error %v, want %+v", info, err, want)
+	}
+
+	var types []events.Type
+	errDone := errors.New("done")
+	err = c.SubscribeEvents(ctx, 1, events.Filter{}, func(e *events.Event) error {
+		types = append(types, e.Type)
+		if e.Type == events.NewBlock {
+			return errDone
+		}
+		return nil
+	})
+	if want := []events.Type{events.DIDCreated, events.NewBlock}; err != errDone || !reflect.DeepEqual(types, want) {
+		t.Errorf("event subscription got %q, error %v, want %q", types, err, want)
+	}
+	for range 3 {
+		broker.Publish(ctx, &events.Event{Type: events.DIDUpdated})
+	}
+	if err := c.SubscribeEvents(ctx, 1, events.Filter{}, nil); !errors.Is(err, events.ErrExpired) {
+		t.Errorf("subscription to expired events got error %v, want ErrExpired", err)
+	}
+
+	err = (&Client{URL: srv.URL + "/other", HTTP: srv.Client()}).call(ctx, "GetChainInfo", new(chainInfoRequest), new(ChainInfo))
+	if st := new(Status); !errors.As(err, &st) || st.Code != Unimplemented {
+		t.Errorf("unknown service got error %v, want Unimplemented status", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := didkey.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := &backend.URL{DID: validator, RawFragment: "#" + validator.SpecID}
+	authority := &chain.Authority{
+		Validators: []backend.DID{validator},
+		Resolver:   new(didkey.Resolver),
+		KeyID:      keyID,
+		Signer:     key,
+	}
+	bc := &chain.Blockchain{Consensus: authority}
+	propose := func(prev *chain.Block) *chain.Block {
+		t.Helper()
+		b, err := authority.ProposeBlock(ctx, prev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	b0 := propose(nil)
+	b1 := propose(b0)
+	for _, b := range []*chain.Block{b0, b1} {
+		if err := bc.AddBlock(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewUnstartedServer(&Server{Chain: bc,
+		Auth: &authz.DIDAuth{Resolver: new(didkey.Resolver), Audience: "https://node.example"},
+	})
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	url, err := EventsURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan *BlockEvent, 8)
+	e := &Events{
+		Client: websocket.Client{
+			URL:    url,
+			Dialer: websocket.Dialer{TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig},
+		},
+		Audience: "https://node.example",
+		KeyID:    keyID,
+		Signer:   key,
+		Handle:   func(e *BlockEvent) { events <- e },
+	}
+	go e.Run(ctx, 0)
+	next := func() *BlockEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no block event")
+			return nil
+		}
+	}
+	for _, want := range []*chain.Block{b0, b1} {
+		if got := next(); got.Block.Hash() != want.Hash() || got.Reorganized {
+			t.Fatalf("got block %d event %+v, want block %d", got.Block.Height, got, want.Height)
+		}
+	}
+
+	bc.Finalize(0)
+	if got := next(); got.Block.Hash() != b1.Hash() || got.Final != 1 {
+		t.Errorf("got finality event %+v, want final 1 with block 1", got)
+	}
+
+	rival := propose(b0)
+	for rival.Hash() == b1.Hash() {
+		rival = propose(b0)
+	}
+	b2 := propose(rival)
+	if err := bc.Reorganize(ctx, []*chain.Block{rival, b2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(); got.Block.Hash() != rival.Hash() || !got.Reorganized {
+		t.Errorf("got event %+v, want reorganization to rival block 1", got)
+	}
+	if got := next(); got.Block.Hash() != b2.Hash() || got.Reorganized {
+		t.Errorf("got event %+v, want block 2", got)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte("s3cr3t"))
+	apiKeys, err := authz.NewAPIKeys(map[string]authz.APIKeyConfig{
+		"reader": {SHA256: hex.EncodeToString(sum[:]), Roles: []authz.Role{authz.Resolver}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(&Server{
+		Chain:         new(chain.Blockchain),
+		Policy:        &authz.DefaultPolicy,
+		Authenticator: apiKeys,
+	})
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	anonymous := &Client{URL: srv.URL, HTTP: srv.Client()}
+	if _, err := anonymous.ChainInfo(ctx); !errors.Is(err, authz.ErrUnauthenticated) {
+		t.Errorf("anonymous chain info got error %v, want ErrUnauthenticated", err)
+	}
+	reader := &Client{URL: srv.URL, HTTP: srv.Client(), Header: http.Header{authz.APIKeyHeader: {"s3cr3t"}}}
+	if _, err := reader.ChainInfo(ctx); err != nil {
+		t.Errorf("chain info with resolver role got error %v", err)
+	}
+	if _, err := reader.SubmitOperation(ctx, "junk"); !errors.Is(err, authz.ErrForbidden) {
+		t.Errorf("submit with resolver role got error %v, want ErrForbidden", err)
+	}
+}
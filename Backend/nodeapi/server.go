@@ -0,0 +1,334 @@
+package nodeapi
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/events"
+	"EncrypteDL/IDChain/Backend/idchain"
+	"EncrypteDL/IDChain/Backend/websocket"
+)
+
+// Server implements the service on a Blockchain. Serve with HTTP/2, which
+// the standard library does over TLS only. Multiple goroutines may invoke
+// methods on a Server simultaneously.
+type Server struct {
+	Chain *chain.Blockchain
+
+	// Resolver defaults to the idchain.Resolver of Chain. Versions need a
+	// backend.VersionResolver.
+	Resolver backend.Resolver
+
+	// Submitted, when set, receives each operation accepted, e.g., to
+	// publish with p2p.OperationMessage.
+	Submitted func(entry string, did backend.DID)
+
+	Log *slog.Logger // nil for slog.Default
+
+	// Tracer, when set, gets a "grpc.call" span for each call, with the
+	// spans of the ledger nested.
+	Tracer backend.Tracer
+
+	// Auth, when set, authenticates the WebSocket connections of the
+	// block stream at EventsPath, as in authz.DIDAuth.AuthenticateConn.
+	Auth *authz.DIDAuth
+
+	// PingInterval is the keepalive of the block stream, with
+	// websocket.PingIntervalDefault for zero.
+	PingInterval time.Duration
+
+	// Events, when set, serves the SubscribeEvents stream.
+	Events *events.Broker
+
+	// Policy, when set, authorizes each call with POST and the full
+	// method name as path, e.g., "/idchain.node.v1.Node/Resolve", and the
+	// block stream with GET on EventsPath. Calls get their principal from
+	// Authenticator, and the block stream gets its principal from Auth.
+	Policy        *authz.Policy
+	Authenticator authz.Authenticator
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return slog.Default()
+}
+
+func (s *Server) resolver() backend.Resolver {
+	if s.Resolver != nil {
+		return s.Resolver
+	}
+	return &idchain.Resolver{Ledger: s.Chain}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == EventsPath && websocket.IsUpgrade(r) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			s.log().Info("node event stream upgrade failed", "error", err)
+			return
+		}
+		s.serveEvents(r.Context(), conn)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "gRPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/grpc" && mediaType != "application/grpc+proto" {
+		http.Error(w, "gRPC content type required", http.StatusUnsupportedMediaType)
+		return
+	}
+	ctx := r.Context()
+	if s.Tracer != nil {
+		ctx = backend.WithTracer(ctx, s.Tracer)
+	}
+	if d, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	ctx, err := s.authorize(ctx, r)
+	if err != nil {
+		writeStatus(w, statusOf(err))
+		return
+	}
+
+	if r.URL.Path == "/"+ServiceName+"/SubscribeEvents" {
+		s.subscribeEvents(ctx, w, r)
+		return
+	}
+
+	start := time.Now()
+	var out message
+	method, ok := strings.CutPrefix(r.URL.Path, "/"+ServiceName+"/")
+	if ok {
+		var span backend.Span
+		ctx, span = backend.StartSpan(ctx, "grpc.call", slog.String("method", method))
+		out, err = s.call(ctx, method, r)
+		span.End(err)
+	} else {
+		err = &Status{Code: Unimplemented, Message: fmt.Sprintf("service of %q unknown", r.URL.Path)}
+	}
+	st := &Status{Code: OK}
+	if err != nil {
+		st = statusOf(err)
+	}
+	s.log().Info("gRPC call", "method", method, "code", st.Code, "duration", time.Since(start))
+
+	if st.Code != OK {
+		writeStatus(w, st)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	body := out.marshal()
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(body)))
+	w.Write(append(frame, body...))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+// Authorize applies the Policy, if any, to a call. The principal, if any,
+// is in the context returned.
+func (s *Server) authorize(ctx context.Context, r *http.Request) (context.Context, error) {
+	if s.Policy == nil {
+		return ctx, nil
+	}
+	var p *authz.Principal
+	var err error
+	if s.Authenticator != nil {
+		p, err = s.Authenticator.Authenticate(r)
+	}
+	if err == nil {
+		err = s.Policy.Authorize(p, r.Method, r.URL.Path)
+	}
+	if err != nil {
+		id := ""
+		if p != nil {
+			id = p.ID
+		}
+		s.log().Warn("gRPC call denied", "principal", id, "path", r.URL.Path, "error", err)
+		return ctx, err
+	}
+	if p != nil {
+		ctx = authz.NewContext(ctx, p)
+	}
+	return ctx, nil
+}
+
+// WriteStatus sends a trailers-only response.
+func writeStatus(w http.ResponseWriter, st *Status) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.FormatUint(uint64(st.Code), 10))
+	w.Header().Set("Grpc-Message", encodeStatusMessage(st.Message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// SubscribeEvents serves the stream of events, until the client cancels.
+func (s *Server) subscribeEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var req subscribeRequest
+	err := readMessage(r.Body, &req)
+	if err == nil && s.Events == nil {
+		err = &Status{Code: Unimplemented, Message: "node without event subscriptions"}
+	}
+	if err == nil && req.From != 0 {
+		// replays of expired events fail before the stream starts
+		_, err = s.Events.Log.Read(ctx, req.From, 1)
+	}
+	if err != nil {
+		writeStatus(w, statusOf(err))
+		return
+	}
+	s.log().Info("gRPC event subscription", "from", req.From, "types", req.Filter.Types, "did", req.Filter.DID)
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+	err = s.Events.Follow(ctx, req.From, req.Filter, func(e *events.Event) error {
+		body := (&eventMessage{Event: e}).marshal()
+		frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(body)))
+		if _, err := w.Write(append(frame, body...)); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	st := statusOf(err)
+	w.Header().Set("Grpc-Status", strconv.FormatUint(uint64(st.Code), 10))
+	w.Header().Set("Grpc-Message", encodeStatusMessage(st.Message))
+}
+
+// ReadMessage decodes the message of a unary call.
+func readMessage(r io.Reader, m message) error {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return &Status{Code: InvalidArgument, Message: "gRPC message prefix: " + err.Error()}
+	}
+	if prefix[0] != 0 {
+		return &Status{Code: Unimplemented, Message: "gRPC message compression not supported"}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > MessageMax {
+		return &Status{Code: ResourceExhausted, Message: fmt.Sprintf("gRPC message of %d bytes exceeds limit", size)}
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return &Status{Code: InvalidArgument, Message: "gRPC message: " + err.Error()}
+	}
+	if err := m.unmarshal(body); err != nil {
+		return &Status{Code: InvalidArgument, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) call(ctx context.Context, method string, r *http.Request) (message, error) {
+	switch method {
+	case "SubmitOperation":
+		var req submitRequest
+		if err := readMessage(r.Body, &req); err != nil {
+			return nil, err
+		}
+		did, err := idchain.Submit(ctx, s.Chain, req.Entry)
+		if err != nil {
+			return nil, err
+		}
+		if s.Submitted != nil {
+			s.Submitted(req.Entry, did)
+		}
+		return &submitResponse{DID: did.String(), OperationHash: idchain.Hash(req.Entry)}, nil
+
+	case "Resolve":
+		var req resolveRequest
+		if err := readMessage(r.Body, &req); err != nil {
+			return nil, err
+		}
+		return s.resolve(ctx, &req)
+
+	case "GetOperationLog":
+		var req logRequest
+		if err := readMessage(r.Body, &req); err != nil {
+			return nil, err
+		}
+		did, err := backend.Parse(req.DID)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := s.Chain.Entries(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+		return &logResponse{Entries: entries}, nil
+
+	case "GetChainInfo":
+		if err := readMessage(r.Body, new(chainInfoRequest)); err != nil {
+			return nil, err
+		}
+		info := &ChainInfo{
+			Blocks:      s.Chain.Len(),
+			FinalBlocks: s.Chain.Final(),
+			Pending:     uint64(len(s.Chain.Pending())),
+		}
+		if head := s.Chain.Head(); head != nil {
+			info.HeadHash, info.HeadTime = head.Hash(), head.Time
+		}
+		return info, nil
+	}
+	return nil, &Status{Code: Unimplemented, Message: fmt.Sprintf("method %s/%s unknown", ServiceName, method)}
+}
+
+func (s *Server) resolve(ctx context.Context, req *resolveRequest) (message, error) {
+	did, err := backend.Parse(req.DID)
+	if err != nil {
+		return nil, err
+	}
+	var versionTime time.Time
+	if req.VersionTime != "" {
+		versionTime, err = time.Parse(time.RFC3339, req.VersionTime)
+		if err != nil {
+			return nil, &Status{Code: InvalidArgument, Message: "version time: " + err.Error()}
+		}
+	}
+
+	var doc *backend.Document
+	var meta *backend.Meta
+	if req.VersionID == "" && versionTime.IsZero() {
+		doc, meta, err = s.resolver().Resolve(ctx, did)
+	} else if vr, ok := s.resolver().(backend.VersionResolver); ok {
+		doc, meta, err = vr.ResolveVersion(ctx, did, req.VersionID, versionTime)
+	} else {
+		err = &Status{Code: Unimplemented, Message: "resolver without version support"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(resolveResponse)
+	if resp.Document, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		if resp.Meta, err = json.Marshal(meta); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
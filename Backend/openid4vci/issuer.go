@@ -0,0 +1,457 @@
+package openid4vci
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// DefaultTTL is the lifespan of offers and of access tokens when not
+// configured otherwise.
+const DefaultTTL = 10 * time.Minute
+
+// RequestMax is the upper boundary for requests to the endpoints in bytes.
+const RequestMax = 1 << 16
+
+// ProofType is the JWT "typ" of proofs of possession.
+const ProofType = "openid4vci-proof+jwt"
+
+// Credential formats
+const (
+	FormatJWT = "jwt_vc_json" // VC-JWT
+	FormatLDP = "ldp_vc"      // Data Integrity
+)
+
+// Paths of the endpoints, relative to the credential issuer identifier
+const (
+	IssuerMetadataPath = "/.well-known/openid-credential-issuer"
+	ServerMetadataPath = "/.well-known/oauth-authorization-server"
+	TokenPath          = "/token"
+	CredentialPath     = "/credential"
+)
+
+// Metadata of the credential issuer
+type Metadata struct {
+	CredentialIssuer   string                    `json:"credential_issuer"`
+	CredentialEndpoint string                    `json:"credential_endpoint"`
+	Configurations     map[string]*Configuration `json:"credential_configurations_supported"`
+}
+
+// ServerMetadata of the authorization server, conform RFC 8414
+type ServerMetadata struct {
+	Issuer                 string `json:"issuer"`
+	TokenEndpoint          string `json:"token_endpoint"`
+	PreAuthorizedAnonymous bool   `json:"pre-authorized_grant_anonymous_access_supported"`
+}
+
+// Configuration describes a type of credential the issuer offers.
+type Configuration struct {
+	Format string `json:"format"` // FormatJWT or FormatLDP
+	// BindingMethods are the cryptographic binding methods, i.e., "did".
+	BindingMethods []string `json:"cryptographic_binding_methods_supported,omitempty"`
+	// ProofTypes has the proof types by name, i.e., "jwt".
+	ProofTypes map[string]ProofTypeSupport `json:"proof_types_supported,omitempty"`
+
+	Definition struct {
+		Context []any    `json:"@context,omitempty"`
+		Types   []string `json:"type"`
+	} `json:"credential_definition"`
+}
+
+// ProofTypeSupport lists the algorithms for a proof type.
+type ProofTypeSupport struct {
+	Algs []string `json:"proof_signing_alg_values_supported"`
+}
+
+// Error is an OAuth error response.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+
+	// CNonce is a fresh nonce for a retry with "invalid_proof".
+	CNonce string `json:"c_nonce,omitempty"`
+
+	status int // HTTP
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "OpenID4VCI " + e.Code
+	}
+	return "OpenID4VCI " + e.Code + ": " + e.Description
+}
+
+// Token is the response of the token endpoint.
+type Token struct {
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"` // "Bearer"
+	ExpiresIn       int64  `json:"expires_in"` // seconds
+	CNonce          string `json:"c_nonce"`
+	CNonceExpiresIn int64  `json:"c_nonce_expires_in"` // seconds
+}
+
+// CredentialRequest is the body posted to the credential endpoint.
+type CredentialRequest struct {
+	ConfigurationID string `json:"credential_configuration_id"`
+	Proof           *Proof `json:"proof"`
+}
+
+// Proof of possession
+type Proof struct {
+	ProofType string `json:"proof_type"` // "jwt"
+	JWT       string `json:"jwt"`
+}
+
+// ProofClaims are the claims of a JWT proof. The issuer must be the DID of the
+// holder.
+type ProofClaims struct {
+	didjwt.Claims
+	Nonce string `json:"nonce"`
+}
+
+// CredentialResponse is the response of the credential endpoint.
+type CredentialResponse struct {
+	// Credential is a JSON string with a VC-JWT, or a JSON object with a
+	// Data Integrity proof.
+	Credential json.RawMessage `json:"credential"`
+	CNonce     string          `json:"c_nonce,omitempty"`
+}
+
+// Issuer offers credentials, and it serves the endpoints of the pre-authorized
+// code flow with ServeHTTP. Multiple goroutines may invoke methods on an
+// Issuer simultaneously.
+type Issuer struct {
+	// URL is the credential issuer identifier, which is the location of
+	// the ServeHTTP handler, without a trailing slash.
+	URL string
+
+	// Configurations has the credentials supported by ID.
+	Configurations map[string]*Configuration
+
+	// KeyID is the DID URL of the assertion method from Signer.
+	KeyID  backend.URL
+	Signer crypto.Signer
+
+	// Resolver is required for the verification of proofs.
+	Resolver backend.Resolver
+	// Leeway is the tolerance for clock skew on proofs.
+	Leeway time.Duration
+
+	// TTL is the lifespan of offers and of access tokens. Zero defaults
+	// to DefaultTTL.
+	TTL time.Duration
+
+	mutex  sync.Mutex
+	codes  map[string]*grant // by pre-authorized code
+	tokens map[string]*grant // by access token
+}
+
+// Grant is a credential pending issuance.
+type grant struct {
+	configurationID string
+	credential      *vc.Credential
+	txCode          string
+	nonce           string
+	expires         time.Time
+}
+
+func (iss *Issuer) ttl() time.Duration {
+	if iss.TTL != 0 {
+		return iss.TTL
+	}
+	return DefaultTTL
+}
+
+// NewOffer returns a credential offer for c, as a credential of
+// configurationID. The issuer and the subject ID are set on issuance, with the
+// DID from the proof of possession as the subject. A non-empty txCode must be
+// passed to the holder through another channel.
+func (iss *Issuer) NewOffer(configurationID string, c *vc.Credential, txCode string) (*Offer, error) {
+	if _, ok := iss.Configurations[configurationID]; !ok {
+		return nil, fmt.Errorf("credential configuration %q not supported", configurationID)
+	}
+	if len(c.Subjects) != 1 {
+		return nil, fmt.Errorf("credential offer needs 1 subject, got %d", len(c.Subjects))
+	}
+	code, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	g := &grant{
+		configurationID: configurationID,
+		credential:      c,
+		txCode:          txCode,
+		expires:         now.Add(iss.ttl()),
+	}
+
+	iss.mutex.Lock()
+	defer iss.mutex.Unlock()
+	if iss.codes == nil {
+		iss.codes = make(map[string]*grant)
+		iss.tokens = make(map[string]*grant)
+	}
+	for _, m := range []map[string]*grant{iss.codes, iss.tokens} {
+		maps.DeleteFunc(m, func(_ string, g *grant) bool {
+			return now.After(g.expires)
+		})
+	}
+	iss.codes[code] = g
+
+	o := &Offer{
+		CredentialIssuer:           iss.URL,
+		CredentialConfigurationIDs: []string{configurationID},
+		Grants:                     Grants{PreAuthorizedCode: &PreAuthorizedCode{Code: code}},
+	}
+	if txCode != "" {
+		mode := "numeric"
+		if strings.Trim(txCode, "0123456789") != "" {
+			mode = "text"
+		}
+		o.Grants.PreAuthorizedCode.TxCode = &TxCode{InputMode: mode, Length: len(txCode)}
+	}
+	return o, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (iss *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := strings.TrimSuffix(pathOf(iss.URL), "/")
+	p, ok := strings.CutPrefix(r.URL.Path, base)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch p {
+	case IssuerMetadataPath, ServerMetadataPath:
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if p == IssuerMetadataPath {
+			writeJSON(w, http.StatusOK, &Metadata{
+				CredentialIssuer:   iss.URL,
+				CredentialEndpoint: iss.URL + CredentialPath,
+				Configurations:     iss.Configurations,
+			})
+		} else {
+			writeJSON(w, http.StatusOK, &ServerMetadata{
+				Issuer:                 iss.URL,
+				TokenEndpoint:          iss.URL + TokenPath,
+				PreAuthorizedAnonymous: true,
+			})
+		}
+
+	case TokenPath, CredentialPath:
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, RequestMax)
+		var v any
+		var err error
+		if p == TokenPath {
+			v, err = iss.token(r)
+		} else {
+			v, err = iss.credential(r)
+		}
+		if err != nil {
+			var e *Error
+			if !errors.As(err, &e) {
+				e = &Error{Code: "server_error", status: http.StatusInternalServerError}
+			}
+			if e.status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer error="`+e.Code+`"`)
+			}
+			writeJSON(w, e.status, e)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (iss *Issuer) token(r *http.Request) (*Token, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &Error{Code: "invalid_request", Description: err.Error(), status: http.StatusBadRequest}
+	}
+	if t := r.PostForm.Get("grant_type"); t != PreAuthorizedGrant {
+		return nil, &Error{Code: "unsupported_grant_type", status: http.StatusBadRequest}
+	}
+	code := r.PostForm.Get("pre-authorized_code")
+	accessToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// codes are redeemed once, including the failed attempts
+	iss.mutex.Lock()
+	defer iss.mutex.Unlock()
+	g, ok := iss.codes[code]
+	delete(iss.codes, code)
+	now := time.Now()
+	if !ok || now.After(g.expires) {
+		return nil, &Error{Code: "invalid_grant", Description: "pre-authorized code unknown or expired", status: http.StatusBadRequest}
+	}
+	if g.txCode != "" && r.PostForm.Get("tx_code") != g.txCode {
+		return nil, &Error{Code: "invalid_grant", Description: "transaction code mismatch", status: http.StatusBadRequest}
+	}
+	g.nonce = nonce
+	g.expires = now.Add(iss.ttl())
+	iss.tokens[accessToken] = g
+
+	ttl := int64(iss.ttl() / time.Second)
+	return &Token{
+		AccessToken:     accessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       ttl,
+		CNonce:          nonce,
+		CNonceExpiresIn: ttl,
+	}, nil
+}
+
+func (iss *Issuer) credential(r *http.Request) (*CredentialResponse, error) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, &Error{Code: "invalid_token", Description: "no bearer token", status: http.StatusUnauthorized}
+	}
+	iss.mutex.Lock()
+	g, ok := iss.tokens[accessToken]
+	iss.mutex.Unlock()
+	if !ok || time.Now().After(g.expires) {
+		return nil, &Error{Code: "invalid_token", status: http.StatusUnauthorized}
+	}
+
+	var req CredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &Error{Code: "invalid_credential_request", Description: err.Error(), status: http.StatusBadRequest}
+	}
+	if req.ConfigurationID != g.configurationID {
+		return nil, &Error{Code: "unsupported_credential_type", status: http.StatusBadRequest}
+	}
+	if req.Proof == nil || req.Proof.ProofType != "jwt" {
+		return nil, &Error{Code: "invalid_proof", Description: "JWT proof required", CNonce: g.nonce, status: http.StatusBadRequest}
+	}
+	holder, err := iss.VerifyProof(r.Context(), req.Proof.JWT, g.nonce, time.Now())
+	if err != nil {
+		return nil, &Error{Code: "invalid_proof", Description: err.Error(), CNonce: g.nonce, status: http.StatusBadRequest}
+	}
+
+	// access tokens are for one credential
+	iss.mutex.Lock()
+	_, ok = iss.tokens[accessToken]
+	delete(iss.tokens, accessToken)
+	iss.mutex.Unlock()
+	if !ok {
+		return nil, &Error{Code: "invalid_token", status: http.StatusUnauthorized}
+	}
+
+	c := *g.credential // copy
+	c.Issuer.ID = iss.KeyID.DID.String()
+	c.Subjects = bindSubject(c.Subjects, holder)
+	now := time.Now().UTC().Truncate(time.Second)
+	switch {
+	case c.V2() && c.ValidFrom == nil:
+		c.ValidFrom = &now
+	case !c.V2() && c.IssuanceDate == nil:
+		c.IssuanceDate = &now
+	}
+	format := vc.JWT
+	if iss.Configurations[g.configurationID].Format == FormatLDP {
+		format = vc.DataIntegrity
+	}
+	secured, err := vc.Issue(&c, iss.Signer, &iss.KeyID, format)
+	if err != nil {
+		return nil, fmt.Errorf("credential issuance: %w", err)
+	}
+	if format == vc.JWT {
+		secured, _ = json.Marshal(string(secured))
+	}
+	return &CredentialResponse{Credential: secured}, nil
+}
+
+// BindSubject returns a copy of subjects, with the ID of the first one set to
+// holder.
+func bindSubject(subjects vc.Subjects, holder backend.DID) vc.Subjects {
+	s := make(vc.Subjects, len(subjects))
+	copy(s, subjects)
+	s[0] = maps.Clone(s[0])
+	s[0]["id"] = holder.String()
+	return s
+}
+
+// VerifyProof checks a JWT proof of possession for the issuer, and it returns
+// the DID of the holder. The signing key must be an authentication method of
+// the holder.
+func (iss *Issuer) VerifyProof(ctx context.Context, token, nonce string, now time.Time) (backend.DID, error) {
+	jws, err := jose.ParseCompact(token)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	if jws.Header.Typ != ProofType {
+		return backend.DID{}, fmt.Errorf("proof JWT typ %q, want %q", jws.Header.Typ, ProofType)
+	}
+	var claims ProofClaims
+	v := didjwt.Verifier{Resolver: iss.Resolver, Relationship: "authentication", Audience: iss.URL, Leeway: iss.Leeway}
+	holder, err := v.Verify(ctx, token, now, &claims)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	if claims.IssuedAt == 0 {
+		return backend.DID{}, fmt.Errorf("%w: proof without iat", didjwt.ErrClaims)
+	}
+	if claims.Nonce != nonce {
+		return backend.DID{}, fmt.Errorf("%w: proof nonce %q mismatch", didjwt.ErrClaims, claims.Nonce)
+	}
+	return holder, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// PathOf returns the path component of an HTTP URL.
+func pathOf(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			return s[i:]
+		}
+		return ""
+	}
+	return s
+}
+
+func randomToken() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", errors.New("credential issuance token unavailable: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
@@ -0,0 +1,96 @@
+// Package openid4vci implements OpenID for Verifiable Credential Issuance with
+// the pre-authorized code flow. An issuer hands out a credential offer (on a
+// web page or in a QR code), and the wallet redeems its code for an access
+// token. The wallet then requests the credential with a proof of possession,
+// signed by a DID of the holder, to which the credential gets bound.
+package openid4vci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// OfferScheme is the default for credential offer URLs.
+const OfferScheme = "openid-credential-offer"
+
+// PreAuthorizedGrant is the grant type of the pre-authorized code flow.
+const PreAuthorizedGrant = "urn:ietf:params:oauth:grant-type:pre-authorized_code"
+
+// Offer is a credential offer, passed by value.
+type Offer struct {
+	CredentialIssuer           string   `json:"credential_issuer"` // HTTPS URL
+	CredentialConfigurationIDs []string `json:"credential_configuration_ids"`
+	Grants                     Grants   `json:"grants"`
+}
+
+// Grants of an offer. Only the pre-authorized code is supported.
+type Grants struct {
+	PreAuthorizedCode *PreAuthorizedCode `json:"urn:ietf:params:oauth:grant-type:pre-authorized_code,omitempty"`
+}
+
+// PreAuthorizedCode is a grant for the token endpoint.
+type PreAuthorizedCode struct {
+	Code string `json:"pre-authorized_code"`
+	// TxCode is set when a transaction code is required with the code.
+	TxCode *TxCode `json:"tx_code,omitempty"`
+}
+
+// TxCode describes a transaction code, which reaches the holder through
+// another channel, such as e-mail or SMS.
+type TxCode struct {
+	InputMode   string `json:"input_mode,omitempty"` // "numeric" or "text"
+	Length      int    `json:"length,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// String returns the URL encoding, with the OfferScheme.
+func (o *Offer) String() string {
+	raw, err := json.Marshal(o)
+	if err != nil {
+		panic(err) // plain types
+	}
+	return OfferScheme + "://?" + url.Values{"credential_offer": {string(raw)}}.Encode()
+}
+
+// ParseOffer decodes a credential offer URL. Any scheme is accepted, including
+// HTTPS for links which fall back to a web page without a wallet installed.
+// Offers by reference, with a "credential_offer_uri", are not supported.
+func ParseOffer(s string) (*Offer, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		var wrap *url.Error // not useful
+		if errors.As(err, &wrap) {
+			err = wrap.Err // trim
+		}
+		return nil, fmt.Errorf("malformed credential offer: %w", err)
+	}
+	params := u.Query()
+	switch a := params["credential_offer"]; len(a) {
+	case 0:
+		if params.Has("credential_offer_uri") {
+			return nil, errors.New("credential offer by reference not supported")
+		}
+		return nil, errors.New("credential offer URL has no credential_offer")
+	case 1:
+		break
+	default:
+		return nil, errors.New("duplicate credential_offer in URL")
+	}
+
+	o := new(Offer)
+	if err := json.Unmarshal([]byte(params.Get("credential_offer")), o); err != nil {
+		return nil, fmt.Errorf("credential offer: %w", err)
+	}
+	if u, err := url.Parse(o.CredentialIssuer); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("credential offer credential_issuer %q is not an HTTP URL", o.CredentialIssuer)
+	}
+	if len(o.CredentialConfigurationIDs) == 0 {
+		return nil, errors.New("credential offer has no credential_configuration_ids")
+	}
+	if o.Grants.PreAuthorizedCode == nil || o.Grants.PreAuthorizedCode.Code == "" {
+		return nil, errors.New("credential offer has no pre-authorized code")
+	}
+	return o, nil
+}
@@ -0,0 +1,145 @@
+package openid4vci
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+func TestOfferString(t *testing.T) {
+	o := &Offer{
+		CredentialIssuer:           "https://issuer.example",
+		CredentialConfigurationIDs: []string{"Membership"},
+		Grants:                     Grants{PreAuthorizedCode: &PreAuthorizedCode{Code: "abc", TxCode: &TxCode{InputMode: "numeric", Length: 4}}},
+	}
+	const want = "openid-credential-offer://?credential_offer=%7B%22credential_issuer%22%3A%22https%3A%2F%2Fissuer.example%22%2C%22credential_configuration_ids%22%3A%5B%22Membership%22%5D%2C%22grants%22%3A%7B%22urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Apre-authorized_code%22%3A%7B%22pre-authorized_code%22%3A%22abc%22%2C%22tx_code%22%3A%7B%22input_mode%22%3A%22numeric%22%2C%22length%22%3A4%7D%7D%7D%7D"
+	if got := o.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got, err := ParseOffer(want)
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+	if got.CredentialIssuer != o.CredentialIssuer || got.Grants.PreAuthorizedCode.Code != "abc" || got.Grants.PreAuthorizedCode.TxCode.Length != 4 {
+		t.Errorf("parse got %+v", got)
+	}
+
+	for _, s := range []string{
+		"openid-credential-offer://?credential_offer_uri=https%3A%2F%2Fissuer.example%2Foffer",
+		"openid-credential-offer://?credential_offer=%7B%7D",
+		`openid-credential-offer://?credential_offer={"credential_issuer":"file:///etc","credential_configuration_ids":["a"]}`,
+		`openid-credential-offer://?credential_offer={"credential_issuer":"https://issuer.example","credential_configuration_ids":["a"],"grants":{}}`,
+	} {
+		if got, err := ParseOffer(s); err == nil {
+			t.Errorf("%q got %+v, want error", s, got)
+		}
+	}
+}
+
+func newDID(t *testing.T) (backend.URL, crypto.Signer) {
+	key, err := keys.Generate(keys.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keys.Signer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	did, err := didkey.New(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend.URL{DID: did, RawFragment: "#" + did.SpecID}, signer
+}
+
+func TestIssue(t *testing.T) {
+	issuerKeyID, issuerSigner := newDID(t)
+	holderKeyID, holderSigner := newDID(t)
+	iss := &Issuer{
+		Configurations: map[string]*Configuration{"MembershipJWT": {Format: FormatJWT}, "MembershipLDP": {Format: FormatLDP}},
+		KeyID:          issuerKeyID,
+		Signer:         issuerSigner,
+		Resolver:       new(didkey.Resolver),
+	}
+	srv := httptest.NewServer(iss)
+	defer srv.Close()
+	iss.URL = srv.URL
+	wallet := &Wallet{KeyID: holderKeyID, Signer: holderSigner}
+	verifier := &vc.Verifier{Resolver: new(didkey.Resolver)}
+
+	for _, id := range []string{"MembershipJWT", "MembershipLDP"} {
+		c := &vc.Credential{
+			Context:  []any{vc.V2},
+			Types:    []string{"VerifiableCredential", "Membership"},
+			Subjects: vc.Subjects{{"member": "yes"}},
+		}
+		offer, err := iss.NewOffer(id, c, "493536")
+		if err != nil {
+			t.Fatal(err)
+		}
+		offer, err = ParseOffer(offer.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := wallet.Accept(context.Background(), offer, ""); err == nil {
+			t.Fatalf("%s: accepted without transaction code", id)
+		}
+		secured, err := wallet.Accept(context.Background(), offer, "493536")
+		if err != nil {
+			t.Fatalf("%s: accept error: %s", id, err)
+		}
+		got, err := verifier.VerifyCredential(context.Background(), secured, time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatalf("%s: issued credential: %s", id, err)
+		}
+		if !holderKeyID.DID.EqualString(got.Subjects[0]["id"].(string)) || got.Subjects[0]["member"] != "yes" || !issuerKeyID.DID.EqualString(got.Issuer.ID) {
+			t.Errorf("%s: got credential %+v", id, got)
+		}
+		if _, ok := c.Subjects[0]["id"]; ok {
+			t.Errorf("%s: offered credential modified", id)
+		}
+
+		_, err = wallet.Accept(context.Background(), offer, "493536")
+		var e *Error
+		if !errors.As(err, &e) || e.Code != "invalid_grant" {
+			t.Errorf("%s: second redemption got error %v, want invalid_grant", id, err)
+		}
+	}
+}
+
+func TestVerifyProof(t *testing.T) {
+	holderKeyID, holderSigner := newDID(t)
+	iss := &Issuer{URL: "https://issuer.example", Resolver: new(didkey.Resolver)}
+	wallet := &Wallet{KeyID: holderKeyID, Signer: holderSigner}
+	ctx := context.Background()
+
+	proof, err := wallet.Proof(iss.URL, "n-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := iss.VerifyProof(ctx, proof, "n-1", time.Now())
+	if err != nil || !holder.Equal(holderKeyID.DID) {
+		t.Errorf("got holder %s, error %v", holder.String(), err)
+	}
+	if _, err := iss.VerifyProof(ctx, proof, "n-2", time.Now()); !errors.Is(err, didjwt.ErrClaims) {
+		t.Errorf("nonce mismatch got error %v, want ErrClaims", err)
+	}
+	other, _ := wallet.Proof("https://other.example", "n-1")
+	if _, err := iss.VerifyProof(ctx, other, "n-1", time.Now()); !errors.Is(err, didjwt.ErrClaims) {
+		t.Errorf("audience mismatch got error %v, want ErrClaims", err)
+	}
+	untyped, _ := didjwt.Sign(&ProofClaims{Claims: didjwt.Claims{Issuer: holderKeyID.DID.String(), Audience: didjwt.Audience{iss.URL}, IssuedAt: time.Now().Unix()}, Nonce: "n-1"}, &holderKeyID, holderSigner)
+	if _, err := iss.VerifyProof(ctx, untyped, "n-1", time.Now()); err == nil {
+		t.Error("proof without typ passed")
+	}
+}
@@ -0,0 +1,197 @@
+package openid4vci
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+)
+
+// ResponseMax is the upper boundary for responses of the issuer in bytes.
+const ResponseMax = 1 << 20
+
+// Wallet redeems credential offers. Multiple goroutines may invoke methods
+// on a Wallet simultaneously.
+type Wallet struct {
+	// Client defaults to http.DefaultClient when nil.
+	Client *http.Client
+
+	// KeyID is the DID URL of the authentication method from Signer. The
+	// credentials get bound to its DID.
+	KeyID  backend.URL
+	Signer crypto.Signer
+}
+
+func (w *Wallet) client() *http.Client {
+	if w.Client != nil {
+		return w.Client
+	}
+	return http.DefaultClient
+}
+
+// Accept redeems the pre-authorized code of o, and it requests the first
+// credential offered. The transaction code is ignored when not required by
+// the offer. The return is the secured credential, i.e., either a VC-JWT or
+// the JSON of a credential with a proof, as accepted by vc.Presentation Add.
+func (w *Wallet) Accept(ctx context.Context, o *Offer, txCode string) ([]byte, error) {
+	var server ServerMetadata
+	if err := w.get(ctx, o.CredentialIssuer+ServerMetadataPath, &server); err != nil {
+		return nil, err
+	}
+	var meta Metadata
+	if err := w.get(ctx, o.CredentialIssuer+IssuerMetadataPath, &meta); err != nil {
+		return nil, err
+	}
+	if meta.CredentialIssuer != o.CredentialIssuer {
+		return nil, fmt.Errorf("credential issuer metadata of %q for offer of %q", meta.CredentialIssuer, o.CredentialIssuer)
+	}
+
+	token, err := w.Redeem(ctx, server.TokenEndpoint, o, txCode)
+	if err != nil {
+		return nil, err
+	}
+	return w.Request(ctx, &meta, token, o.CredentialConfigurationIDs[0])
+}
+
+// Redeem exchanges the pre-authorized code of o for an access token.
+func (w *Wallet) Redeem(ctx context.Context, tokenEndpoint string, o *Offer, txCode string) (*Token, error) {
+	grant := o.Grants.PreAuthorizedCode
+	if grant == nil {
+		return nil, errors.New("credential offer has no pre-authorized code")
+	}
+	form := url.Values{
+		"grant_type":          {PreAuthorizedGrant},
+		"pre-authorized_code": {grant.Code},
+	}
+	if grant.TxCode != nil {
+		if txCode == "" {
+			return nil, errors.New("credential offer requires a transaction code")
+		}
+		form.Set("tx_code", txCode)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("credential offer token: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token := new(Token)
+	if err := w.do(req, token); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(token.TokenType, "Bearer") {
+		return nil, fmt.Errorf("credential offer token type %q not supported", token.TokenType)
+	}
+	return token, nil
+}
+
+// Request retrieves a credential of configurationID with token. A proof
+// rejected for its nonce is retried once, with the nonce from the error.
+func (w *Wallet) Request(ctx context.Context, meta *Metadata, token *Token, configurationID string) ([]byte, error) {
+	nonce := token.CNonce
+	for retry := false; ; retry = true {
+		proof, err := w.Proof(meta.CredentialIssuer, nonce)
+		if err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(&CredentialRequest{
+			ConfigurationID: configurationID,
+			Proof:           &Proof{ProofType: "jwt", JWT: proof},
+		})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.CredentialEndpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("credential request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+		var resp CredentialResponse
+		err = w.do(req, &resp)
+		var e *Error
+		if !retry && errors.As(err, &e) && e.Code == "invalid_proof" && e.CNonce != "" && e.CNonce != nonce {
+			nonce = e.CNonce
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case len(resp.Credential) == 0:
+			return nil, errors.New("credential response has no credential")
+		case resp.Credential[0] == '"':
+			var s string
+			if err := json.Unmarshal(resp.Credential, &s); err != nil {
+				return nil, fmt.Errorf("credential response: %w", err)
+			}
+			return []byte(s), nil
+		default:
+			return resp.Credential, nil
+		}
+	}
+}
+
+// Proof returns a JWT proof of possession for the credential issuer.
+func (w *Wallet) Proof(issuer, nonce string) (string, error) {
+	claims := ProofClaims{
+		Claims: didjwt.Claims{
+			Issuer:   w.KeyID.DID.String(),
+			Audience: didjwt.Audience{issuer},
+			IssuedAt: time.Now().Unix(),
+		},
+		Nonce: nonce,
+	}
+	return didjwt.SignTyp(ProofType, &claims, &w.KeyID, w.Signer)
+}
+
+func (w *Wallet) get(ctx context.Context, location string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return fmt.Errorf("credential issuer metadata: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	return w.do(req, v)
+}
+
+// Do sends req, and it decodes the JSON response into v. OAuth error
+// responses are returned as an *Error.
+func (w *Wallet) do(req *http.Request, v any) error {
+	res, err := w.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("credential issuer: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, ResponseMax+1))
+	if err != nil {
+		return fmt.Errorf("credential issuer %s unavailable: %w", req.URL, err)
+	}
+	if len(body) > ResponseMax {
+		return fmt.Errorf("credential issuer %s exceeds %d bytes", req.URL, ResponseMax)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		e := new(Error)
+		if json.Unmarshal(body, e) == nil && e.Code != "" {
+			e.status = res.StatusCode
+			return e
+		}
+		return fmt.Errorf("HTTP %q from credential issuer %s", res.Status, req.URL)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("credential issuer %s: %w", req.URL, err)
+	}
+	return nil
+}
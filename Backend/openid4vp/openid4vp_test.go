@@ -0,0 +1,146 @@
+package openid4vp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/proofreq"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+func TestJSONPath(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"vc":{"type":["VerifiableCredential","Membership"],"credentialSubject":{"given name":"Ada","age":36}}}`), &doc)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$.vc.type[1]", `["Membership"]`},
+		{"$['vc']['credentialSubject']['given name']", `["Ada"]`},
+		{`$.vc["credentialSubject"].age`, `[36]`},
+		{"$.vc.type[*]", `["VerifiableCredential","Membership"]`},
+		{"$.vc.type[2]", `null`},
+		{"$.nothing.here", `null`},
+	}
+	for _, test := range tests {
+		got, err := JSONPath(doc, test.path)
+		if err != nil {
+			t.Errorf("%s: error %s", test.path, err)
+			continue
+		}
+		if b, _ := json.Marshal(got); string(b) != test.want {
+			t.Errorf("%s: got %s, want %s", test.path, b, test.want)
+		}
+	}
+	for _, path := range []string{"vc.type", "$..type", "$.vc[", "$.vc[-1]", "$.vc['type]"} {
+		if _, err := JSONPath(doc, path); err == nil {
+			t.Errorf("%s: no error", path)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	in := &InputDescriptor{ID: "membership", Constraints: Constraints{Fields: []*Field{
+		{Path: []string{"$.type", "$.vc.type"}, Filter: json.RawMessage(`{"type":"array","contains":{"const":"Membership"}}`)},
+		{ID: "age", Path: []string{"$.credentialSubject.age", "$.vc.credentialSubject.age"}, Filter: json.RawMessage(`{"type":"integer","minimum":18}`)},
+		{Path: []string{"$.vc.credentialSubject.nickname"}, Optional: true},
+	}}}
+	if err := (&Definition{ID: "d", InputDescriptors: []*InputDescriptor{in}}).Validate(); err != nil {
+		t.Fatal("validate error:", err)
+	}
+
+	var claims any
+	json.Unmarshal([]byte(`{"vc":{"type":["VerifiableCredential","Membership"],"credentialSubject":{"age":36}}}`), &claims)
+	selected, err := in.Match(claims)
+	if err != nil || selected["age"] != 36.0 {
+		t.Errorf("got selected %v, error %v", selected, err)
+	}
+	json.Unmarshal([]byte(`{"vc":{"type":["VerifiableCredential","Membership"],"credentialSubject":{"age":17}}}`), &claims)
+	if _, err := in.Match(claims); !errors.Is(err, ErrConstraint) {
+		t.Errorf("minor got error %v, want ErrConstraint", err)
+	}
+
+	bad := &Definition{ID: "d", InputDescriptors: []*InputDescriptor{{ID: "x", Constraints: Constraints{Fields: []*Field{
+		{Path: []string{"$.a"}, Filter: json.RawMessage(`{"if":{}}`)},
+	}}}}}
+	if err := bad.Validate(); err == nil {
+		t.Error("unsupported schema keyword passed validation")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	issuerKey, _ := keys.Generate(keys.Ed25519)
+	issuerSigner, _ := keys.Signer(issuerKey)
+	issuer, _ := didkey.New(issuerSigner.Public())
+	issuerKeyID := &backend.URL{DID: issuer, RawFragment: "#" + issuer.SpecID}
+	holderKey, _ := keys.Generate(keys.Ed25519)
+	holderSigner, _ := keys.Signer(holderKey)
+	holder, _ := didkey.New(holderSigner.Public())
+	holderKeyID := &backend.URL{DID: holder, RawFragment: "#" + holder.SpecID}
+
+	now := time.Now()
+	issued := now.Add(-time.Hour).UTC().Truncate(time.Second)
+	c := &vc.Credential{
+		Context:      []any{vc.V1},
+		Types:        []string{"VerifiableCredential", "Membership"},
+		Issuer:       vc.Issuer{ID: issuer.String()},
+		IssuanceDate: &issued,
+		Subjects:     vc.Subjects{{"id": holder.String(), "age": 36}},
+	}
+	def := &Definition{ID: "age-check", InputDescriptors: []*InputDescriptor{{
+		ID: "adult",
+		Constraints: Constraints{Fields: []*Field{
+			{ID: "age", Path: []string{"$.vc.credentialSubject.age", "$.credentialSubject.age"}, Filter: json.RawMessage(`{"type":"number","minimum":18}`)},
+		}},
+	}}}
+	request := &proofreq.Request{ClientID: "did:example:verifier", Nonce: "n-0S6_WzA2Mj"}
+	v := &Verifier{Credentials: &vc.Verifier{Resolver: new(didkey.Resolver), BindSubject: true}}
+
+	for _, format := range []vc.Format{vc.JWT, vc.DataIntegrity} {
+		credential, err := vc.Issue(c, issuerSigner, issuerKeyID, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := vc.NewPresentation(holder)
+		p.Add(credential)
+		token, err := vc.Present(p, holderSigner, holderKeyID, request.Nonce, request.ClientID, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := &Descriptor{ID: "adult", Format: JWTVP, Path: "$", PathNested: &Descriptor{ID: "adult", Format: JWTVC, Path: "$.vp.verifiableCredential[0]"}}
+		if format == vc.DataIntegrity {
+			d = &Descriptor{ID: "adult", Format: LDPVP, Path: "$", PathNested: &Descriptor{ID: "adult", Format: LDPVC, Path: "$.verifiableCredential[0]"}}
+		}
+		submission, _ := json.Marshal(&Submission{ID: "s", DefinitionID: def.ID, DescriptorMap: []*Descriptor{d}})
+		resp := &proofreq.Response{VPToken: string(token), PresentationSubmission: submission, Request: request}
+		result, err := v.Verify(context.Background(), def, resp)
+		if err != nil {
+			t.Fatalf("%s: verify error: %s", format, err)
+		}
+		if result.Credentials["adult"] == nil || result.Fields["age"] != 36.0 || len(result.Presentations) != 1 {
+			t.Errorf("%s: got result %+v", format, result)
+		}
+
+		// replay at another verifier
+		other := *resp
+		other.Request = &proofreq.Request{ClientID: "did:example:other", Nonce: request.Nonce}
+		if _, err := v.Verify(context.Background(), def, &other); err == nil {
+			t.Errorf("%s: verified for another audience", format)
+		}
+
+		// descriptor to nowhere
+		d.PathNested.Path = "$.verifiableCredential[1]"
+		other = *resp
+		other.PresentationSubmission, _ = json.Marshal(&Submission{ID: "s", DefinitionID: def.ID, DescriptorMap: []*Descriptor{d}})
+		if _, err := v.Verify(context.Background(), def, &other); !errors.Is(err, ErrConstraint) {
+			t.Errorf("%s: bad nested path got error %v, want ErrConstraint", format, err)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package openid4vp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Claim formats of Presentation Exchange
+const (
+	JWTVP     = "jwt_vp"
+	JWTVPJSON = "jwt_vp_json"
+	LDPVP     = "ldp_vp"
+	JWTVC     = "jwt_vc"
+	JWTVCJSON = "jwt_vc_json"
+	LDPVC     = "ldp_vc"
+)
+
+// ErrConstraint signals a presentation which does not satisfy the definition.
+var ErrConstraint = errors.New("presentation does not satisfy the definition")
+
+// Definition is a presentation definition, conform Presentation Exchange 2.0.
+// Submission requirements are not supported; each input descriptor applies.
+type Definition struct {
+	ID               string             `json:"id"`
+	Name             string             `json:"name,omitempty"`
+	Purpose          string             `json:"purpose,omitempty"`
+	InputDescriptors []*InputDescriptor `json:"input_descriptors"`
+}
+
+// InputDescriptor describes a credential required.
+type InputDescriptor struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name,omitempty"`
+	Purpose     string      `json:"purpose,omitempty"`
+	Constraints Constraints `json:"constraints"`
+}
+
+// Constraints of an input descriptor
+type Constraints struct {
+	Fields []*Field `json:"fields,omitempty"`
+
+	// LimitDisclosure is either "required" or "preferred".
+	LimitDisclosure string `json:"limit_disclosure,omitempty"`
+}
+
+// Field selects a claim with JSONPath, with an optional JSON Schema to
+// satisfy. The first path found, with a filter match, applies.
+type Field struct {
+	ID       string          `json:"id,omitempty"`
+	Path     []string        `json:"path"`
+	Purpose  string          `json:"purpose,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Filter   json.RawMessage `json:"filter,omitempty"`
+	Optional bool            `json:"optional,omitempty"`
+}
+
+// Submission maps the input descriptors of a definition to a vp_token.
+type Submission struct {
+	ID            string        `json:"id"`
+	DefinitionID  string        `json:"definition_id"`
+	DescriptorMap []*Descriptor `json:"descriptor_map"`
+}
+
+// Descriptor locates the credential for an input descriptor. The Path of a
+// presentation applies to the vp_token, and PathNested locates the credential
+// within.
+type Descriptor struct {
+	ID         string      `json:"id"` // input descriptor
+	Format     string      `json:"format"`
+	Path       string      `json:"path"`
+	PathNested *Descriptor `json:"path_nested,omitempty"`
+}
+
+// Validate checks the syntax of d, including the paths and filters.
+func (d *Definition) Validate() error {
+	if d.ID == "" {
+		return errors.New(`presentation definition has no "id"`)
+	}
+	seen := make(map[string]bool, len(d.InputDescriptors))
+	for _, in := range d.InputDescriptors {
+		if in.ID == "" || seen[in.ID] {
+			return fmt.Errorf("presentation definition %q has an input descriptor with an empty or duplicate id", d.ID)
+		}
+		seen[in.ID] = true
+		for _, f := range in.Constraints.Fields {
+			if len(f.Path) == 0 {
+				return fmt.Errorf("input descriptor %q has a field without path", in.ID)
+			}
+			for _, p := range f.Path {
+				if _, err := parsePath(p); err != nil {
+					return fmt.Errorf("input descriptor %q: %w", in.ID, err)
+				}
+			}
+			if len(f.Filter) != 0 {
+				var schema map[string]any
+				if err := json.Unmarshal(f.Filter, &schema); err != nil {
+					return fmt.Errorf("input descriptor %q filter: %w", in.ID, err)
+				}
+				if err := checkSchema(schema); err != nil {
+					return fmt.Errorf("input descriptor %q filter: %w", in.ID, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns whether the claims of a credential, as JSON in the form of
+// the claim format, satisfy the constraints of in. The values selected are
+// returned by field ID, for fields with an ID.
+func (in *InputDescriptor) Match(claims any) (map[string]any, error) {
+	selected := make(map[string]any)
+	for i, f := range in.Constraints.Fields {
+		var schema map[string]any
+		if len(f.Filter) != 0 {
+			if err := json.Unmarshal(f.Filter, &schema); err != nil {
+				return nil, fmt.Errorf("input descriptor %q filter: %w", in.ID, err)
+			}
+		}
+		found := false
+	Paths:
+		for _, p := range f.Path {
+			values, err := JSONPath(claims, p)
+			if err != nil {
+				return nil, fmt.Errorf("input descriptor %q: %w", in.ID, err)
+			}
+			for _, v := range values {
+				if schema == nil || matchSchema(schema, v) {
+					found = true
+					if f.ID != "" {
+						selected[f.ID] = v
+					}
+					break Paths
+				}
+			}
+		}
+		if !found && !f.Optional {
+			return nil, fmt.Errorf("%w: input descriptor %q field № %d not satisfied", ErrConstraint, in.ID, i+1)
+		}
+	}
+	return selected, nil
+}
+
+type pathStep struct {
+	name  string
+	index int  // when name is empty
+	all   bool // wildcard
+}
+
+// ParsePath supports the root "$", with child names in dot or in bracket
+// notation, array indices, and wildcards.
+func parsePath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %q does not start at root $", path)
+	}
+	var steps []pathStep
+	s := path[1:]
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			return nil, fmt.Errorf("JSONPath %q: recursive descent not supported", path)
+		case s[0] == '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch {
+			case name == "*":
+				steps = append(steps, pathStep{all: true})
+			case name == "":
+				return nil, fmt.Errorf("JSONPath %q has an empty name", path)
+			default:
+				steps = append(steps, pathStep{name: name})
+			}
+		case s[0] == '[':
+			if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+				end := strings.IndexByte(s[2:], s[1])
+				if end < 0 || len(s) < end+4 || s[end+3] != ']' {
+					return nil, fmt.Errorf("JSONPath %q has an unterminated name", path)
+				}
+				steps = append(steps, pathStep{name: s[2 : end+2]})
+				s = s[end+4:]
+				continue
+			}
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has an unterminated bracket", path)
+			}
+			if inner := s[1:end]; inner == "*" {
+				steps = append(steps, pathStep{all: true})
+			} else {
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("JSONPath %q: index %q not supported", path, inner)
+				}
+				steps = append(steps, pathStep{index: i})
+			}
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath %q: unexpected %q", path, s[0])
+		}
+	}
+	return steps, nil
+}
+
+// JSONPath returns the values at path within v, as decoded by encoding/json.
+// See parsePath for the subset supported.
+func JSONPath(v any, path string) ([]any, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	values := []any{v}
+	for _, step := range steps {
+		var next []any
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]any:
+				if step.all {
+					for _, e := range v {
+						next = append(next, e)
+					}
+				} else if e, ok := v[step.name]; ok && step.name != "" {
+					next = append(next, e)
+				}
+			case []any:
+				if step.all {
+					next = append(next, v...)
+				} else if step.name == "" && step.index < len(v) {
+					next = append(next, v[step.index])
+				}
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// SchemaKeywords are the JSON Schema validation keywords supported.
+var schemaKeywords = map[string]bool{
+	"$schema": true, "type": true, "const": true, "enum": true, "pattern": true, "format": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"minLength": true, "maxLength": true, "contains": true, "items": true, "not": true,
+}
+
+func checkSchema(schema map[string]any) error {
+	for k, v := range schema {
+		if !schemaKeywords[k] {
+			return fmt.Errorf("JSON Schema keyword %q not supported", k)
+		}
+		switch k {
+		case "pattern":
+			s, _ := v.(string)
+			if _, err := regexp.Compile(s); err != nil {
+				return fmt.Errorf("JSON Schema pattern: %w", err)
+			}
+		case "contains", "items", "not":
+			sub, ok := v.(map[string]any)
+			if !ok {
+				return fmt.Errorf("JSON Schema %q is not an object", k)
+			}
+			if err := checkSchema(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MatchSchema evaluates the subset of JSON Schema in schemaKeywords. Formats
+// are annotations only.
+func matchSchema(schema map[string]any, v any) bool {
+	if t, ok := schema["type"]; ok {
+		types, isList := t.([]any)
+		if !isList {
+			types = []any{t}
+		}
+		match := false
+		for _, t := range types {
+			match = match || isType(v, t)
+		}
+		if !match {
+			return false
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		return false
+	}
+	if e, ok := schema["enum"].([]any); ok {
+		match := false
+		for _, c := range e {
+			match = match || jsonEqual(c, v)
+		}
+		if !match {
+			return false
+		}
+	}
+	if not, ok := schema["not"].(map[string]any); ok && matchSchema(not, v) {
+		return false
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && n < min {
+			return false
+		}
+		if max, ok := schema["maxLength"].(float64); ok && n > max {
+			return false
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			if err != nil || !re.MatchString(v) {
+				return false
+			}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return false
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return false
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && v <= min {
+			return false
+		}
+		if max, ok := schema["exclusiveMaximum"].(float64); ok && v >= max {
+			return false
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for _, e := range v {
+				if !matchSchema(items, e) {
+					return false
+				}
+			}
+		}
+		if contains, ok := schema["contains"].(map[string]any); ok {
+			match := false
+			for _, e := range v {
+				match = match || matchSchema(contains, e)
+			}
+			if !match {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isType(v any, t any) bool {
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func jsonEqual(a, b any) bool {
+	x, err1 := json.Marshal(a)
+	y, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(x) == string(y)
+}
@@ -0,0 +1,281 @@
+// Package openid4vp implements the verifier role of OpenID for Verifiable
+// Presentations. Authorization requests carry a presentation definition, and
+// the vp_token responses are checked against it, conform Presentation Exchange
+// 2.0. The transport of requests and responses is in package proofreq.
+package openid4vp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/proofreq"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Verifier requests presentations, and it verifies the responses.
+type Verifier struct {
+	Requests    *proofreq.Verifier
+	Credentials *vc.Verifier
+
+	Now func() time.Time // defaults to time.Now
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+// Result has the outcome of a successful verification.
+type Result struct {
+	// Presentations are in order of appearance in the vp_token.
+	Presentations []*vc.Presentation
+
+	// Credentials has the credential submitted per input descriptor.
+	Credentials map[string]*vc.Credential
+	// Fields has the values selected per field ID.
+	Fields map[string]any
+}
+
+// NewRequest publishes an authorization request for def. See
+// proofreq.Verifier NewRequest for the semantics of the channel.
+func (v *Verifier) NewRequest(def *Definition) (*proofreq.Reference, <-chan *proofreq.Response, error) {
+	if err := def.Validate(); err != nil {
+		return nil, nil, err
+	}
+	raw, err := json.Marshal(def)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v.Requests.NewRequest(raw)
+}
+
+// Verify checks a response to a request for def. Each presentation in the
+// vp_token must be signed by its holder with the nonce of the request, and
+// with the client ID as domain (or audience). Each input descriptor of def
+// must be satisfied by a credential from the presentation submission.
+// Constraint violations are reported with ErrConstraint.
+func (v *Verifier) Verify(ctx context.Context, def *Definition, resp *proofreq.Response) (*Result, error) {
+	if resp.Request == nil {
+		return nil, errors.New("OpenID4VP response without request")
+	}
+	if len(resp.PresentationSubmission) == 0 {
+		return nil, fmt.Errorf("%w: response has no presentation_submission", ErrConstraint)
+	}
+	var submission Submission
+	if err := json.Unmarshal(resp.PresentationSubmission, &submission); err != nil {
+		return nil, fmt.Errorf("OpenID4VP presentation_submission: %w", err)
+	}
+	if submission.DefinitionID != def.ID {
+		return nil, fmt.Errorf("%w: submission for definition %q, want %q", ErrConstraint, submission.DefinitionID, def.ID)
+	}
+
+	token, elements, err := parseToken(resp.VPToken)
+	if err != nil {
+		return nil, err
+	}
+	now := v.now()
+	result := &Result{
+		Credentials: make(map[string]*vc.Credential, len(def.InputDescriptors)),
+		Fields:      make(map[string]any),
+	}
+	verified := make([][]*vc.Credential, len(elements))
+	for i, e := range elements {
+		secured, _ := e.(string)
+		if secured == "" {
+			secured = string(mustMarshal(e))
+		}
+		p, credentials, err := v.Credentials.VerifyPresentation(ctx, []byte(secured), resp.Request.Nonce, resp.Request.ClientID, now)
+		if err != nil {
+			return nil, fmt.Errorf("vp_token presentation № %d: %w", i+1, err)
+		}
+		result.Presentations = append(result.Presentations, p)
+		verified[i] = credentials
+	}
+
+	for _, in := range def.InputDescriptors {
+		var errs []error
+		for _, d := range submission.DescriptorMap {
+			if d.ID != in.ID {
+				continue
+			}
+			c, claims, err := locate(d, token, elements, verified)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			selected, err := in.Match(claims)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			result.Credentials[in.ID] = c
+			for id, v := range selected {
+				result.Fields[id] = v
+			}
+			errs = nil
+			break
+		}
+		switch {
+		case len(errs) != 0:
+			return nil, errors.Join(errs...)
+		case result.Credentials[in.ID] == nil:
+			return nil, fmt.Errorf("%w: no submission for input descriptor %q", ErrConstraint, in.ID)
+		}
+	}
+	return result, nil
+}
+
+// ParseToken decodes a vp_token, which is either a JSON array, a JSON object,
+// or a JWT. Elements are the presentations contained.
+func parseToken(s string) (token any, elements []any, err error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return nil, nil, fmt.Errorf("%w: empty vp_token", ErrConstraint)
+	case s[0] == '[':
+		var a []any
+		if err := json.Unmarshal([]byte(s), &a); err != nil {
+			return nil, nil, fmt.Errorf("OpenID4VP vp_token: %w", err)
+		}
+		if len(a) == 0 {
+			return nil, nil, fmt.Errorf("%w: empty vp_token", ErrConstraint)
+		}
+		return a, a, nil
+	case s[0] == '{':
+		var o map[string]any
+		if err := json.Unmarshal([]byte(s), &o); err != nil {
+			return nil, nil, fmt.Errorf("OpenID4VP vp_token: %w", err)
+		}
+		return o, []any{o}, nil
+	default:
+		return s, []any{s}, nil
+	}
+}
+
+// Locate resolves the path of d to a presentation within token, and its
+// nested path to one of the credentials verified. The claims are in the
+// form of the nested format.
+func locate(d *Descriptor, token any, elements []any, verified [][]*vc.Credential) (*vc.Credential, any, error) {
+	values, err := JSONPath(token, d.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("descriptor %q: %w", d.ID, err)
+	}
+	if len(values) != 1 {
+		return nil, nil, fmt.Errorf("%w: descriptor %q path %q matches %d values, want 1", ErrConstraint, d.ID, d.Path, len(values))
+	}
+	index := -1
+	for i, e := range elements {
+		if jsonEqual(e, values[0]) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil, fmt.Errorf("%w: descriptor %q path %q is not a presentation", ErrConstraint, d.ID, d.Path)
+	}
+
+	// The nested path applies to the presentation in the form of its format.
+	var presentation any
+	switch d.Format {
+	case JWTVP, JWTVPJSON:
+		s, ok := values[0].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: descriptor %q has format %q for a JSON object", ErrConstraint, d.ID, d.Format)
+		}
+		presentation, err = jwtClaims(s)
+		if err != nil {
+			return nil, nil, err
+		}
+	case LDPVP:
+		if _, ok := values[0].(map[string]any); !ok {
+			return nil, nil, fmt.Errorf("%w: descriptor %q has format %q for a JWT", ErrConstraint, d.ID, d.Format)
+		}
+		presentation = values[0]
+	default:
+		return nil, nil, fmt.Errorf("%w: descriptor %q format %q not supported", ErrConstraint, d.ID, d.Format)
+	}
+
+	nested := d.PathNested
+	if nested == nil {
+		return nil, nil, fmt.Errorf("%w: descriptor %q has no path_nested to a credential", ErrConstraint, d.ID)
+	}
+	if nested.ID != "" && nested.ID != d.ID {
+		return nil, nil, fmt.Errorf("%w: descriptor %q has path_nested for %q", ErrConstraint, d.ID, nested.ID)
+	}
+	values, err = JSONPath(presentation, nested.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("descriptor %q: %w", d.ID, err)
+	}
+	if len(values) != 1 {
+		return nil, nil, fmt.Errorf("%w: descriptor %q nested path %q matches %d values, want 1", ErrConstraint, d.ID, nested.Path, len(values))
+	}
+
+	var claims any
+	switch nested.Format {
+	case JWTVC, JWTVCJSON:
+		s, ok := values[0].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: descriptor %q nested format %q for a JSON object", ErrConstraint, d.ID, nested.Format)
+		}
+		claims, err = jwtClaims(s)
+		if err != nil {
+			return nil, nil, err
+		}
+	case LDPVC:
+		if _, ok := values[0].(map[string]any); !ok {
+			return nil, nil, fmt.Errorf("%w: descriptor %q nested format %q for a JWT", ErrConstraint, d.ID, nested.Format)
+		}
+		claims = values[0]
+	default:
+		return nil, nil, fmt.Errorf("%w: descriptor %q nested format %q not supported", ErrConstraint, d.ID, nested.Format)
+	}
+
+	// match the credential to the ones verified
+	credentials, err := JSONPath(presentation, pathCredentials(d.Format)+"[*]")
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, c := range credentials {
+		if jsonEqual(c, values[0]) && i < len(verified[index]) {
+			return verified[index][i], claims, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: descriptor %q nested path %q is not a credential of the presentation", ErrConstraint, d.ID, nested.Path)
+}
+
+// PathCredentials returns the location of the credentials in a presentation.
+func pathCredentials(format string) string {
+	if format == LDPVP {
+		return "$.verifiableCredential"
+	}
+	return "$.vp.verifiableCredential"
+}
+
+// JWTClaims decodes the payload of a JWT, which must have been verified
+// already.
+func jwtClaims(token string) (map[string]any, error) {
+	jws, err := jose.ParseCompact(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConstraint, err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(jws.Payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: JWT claims: %w", ErrConstraint, err)
+	}
+	return claims, nil
+}
+
+func mustMarshal(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err) // decoded JSON
+	}
+	return b
+}
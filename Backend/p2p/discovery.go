@@ -0,0 +1,441 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerAddr is a discovered node.
+type PeerAddr struct {
+	Addr   string // host and port of the node Transport
+	ID     string // Peer.ID when announced, which the handshake confirms
+	Source string // e.g., "bootstrap", "mdns" or "rendezvous"
+}
+
+// Discoverer finds peers. Discover runs until ctx is done, and it calls found
+// for each peer seen, possibly more than once. Multicast and Rendezvous cover
+// the local network and the wide area respectively. Other mechanisms, such as
+// a libp2p DHT, plug in the same way.
+type Discoverer interface {
+	Discover(ctx context.Context, found func(PeerAddr)) error
+}
+
+// Topology is the peer discovery strategy.
+type Topology string
+
+// Topology options
+const (
+	// BootstrapOnly connects with the configured peers only.
+	BootstrapOnly Topology = "bootstrap"
+	// Dynamic adds peers from discovery mechanisms.
+	Dynamic Topology = "dynamic"
+)
+
+// DiscoveryConfig is the configuration form of peer discovery.
+type DiscoveryConfig struct {
+	Topology  Topology `json:"topology"`  // default BootstrapOnly
+	Bootstrap []string `json:"bootstrap"` // addresses
+
+	// MDNS enables Multicast on the local network.
+	MDNS bool `json:"mdns"`
+	// Rendezvous has the base URLs of RendezvousServers, for discovery
+	// across networks.
+	Rendezvous []string `json:"rendezvous"`
+	// Namespace separates networks at rendezvous. Default "idchain".
+	Namespace string `json:"namespace"`
+
+	// MaxPeers limits the peer book. Zero means no limit.
+	MaxPeers int `json:"maxPeers"`
+}
+
+// Discoverers returns the dynamic mechanisms enabled, with self as the local
+// node announcement.
+func (c *DiscoveryConfig) Discoverers(self PeerAddr) []Discoverer {
+	var list []Discoverer
+	if c.MDNS {
+		list = append(list, &Multicast{Self: self})
+	}
+	if len(c.Rendezvous) != 0 {
+		ns := c.Namespace
+		if ns == "" {
+			ns = "idchain"
+		}
+		list = append(list, &Rendezvous{Servers: c.Rendezvous, Namespace: ns, Self: self})
+	}
+	return list
+}
+
+// Static is a Discoverer of fixed addresses.
+type Static []string
+
+// Discover implements the Discoverer interface.
+func (s Static) Discover(ctx context.Context, found func(PeerAddr)) error {
+	for _, addr := range s {
+		found(PeerAddr{Addr: addr, Source: "bootstrap"})
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// PeerBook collects discovered peers, deduplicated by address. The zero
+// value is ready for use.
+type PeerBook struct {
+	// Max limits the number of entries. Zero means no limit. Bootstrap
+	// peers are exempt.
+	Max int
+
+	mutex sync.Mutex
+	peers map[string]PeerAddr
+}
+
+// Add installs p, and it returns whether p is new.
+func (b *PeerBook) Add(p PeerAddr) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.peers == nil {
+		b.peers = make(map[string]PeerAddr)
+	}
+	if prev, ok := b.peers[p.Addr]; ok {
+		if prev.ID == "" && p.ID != "" {
+			prev.ID = p.ID
+			b.peers[p.Addr] = prev
+		}
+		return false
+	}
+	if b.Max > 0 && len(b.peers) >= b.Max && p.Source != "bootstrap" {
+		return false
+	}
+	b.peers[p.Addr] = p
+	return true
+}
+
+// Remove drops the entry of addr, e.g., after repeated connect failures.
+func (b *PeerBook) Remove(addr string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.peers, addr)
+}
+
+// List returns all entries ordered by address.
+func (b *PeerBook) List() []PeerAddr {
+	b.mutex.Lock()
+	list := make([]PeerAddr, 0, len(b.peers))
+	for _, p := range b.peers {
+		list = append(list, p)
+	}
+	b.mutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Addr < list[j].Addr })
+	return list
+}
+
+// Discover fills book conform config until ctx is done. The bootstrap peers
+// always apply. The dynamic discoverers, e.g., from config.Discoverers, apply only
+// with the Dynamic topology. Added receives each new entry when not nil.
+func Discover(ctx context.Context, config *DiscoveryConfig, dynamic []Discoverer, book *PeerBook, added func(PeerAddr)) error {
+	discoverers := []Discoverer{Static(config.Bootstrap)}
+	switch config.Topology {
+	case "", BootstrapOnly:
+		break
+	case Dynamic:
+		discoverers = append(discoverers, dynamic...)
+	default:
+		return fmt.Errorf("unknown peer discovery topology %q", config.Topology)
+	}
+	if book.Max == 0 {
+		book.Max = config.MaxPeers
+	}
+
+	found := func(p PeerAddr) {
+		if book.Add(p) && added != nil {
+			added(p)
+		}
+	}
+	errs := make(chan error, len(discoverers))
+	for _, d := range discoverers {
+		go func(d Discoverer) {
+			errs <- d.Discover(ctx, found)
+		}(d)
+	}
+	var err error
+	for range discoverers {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+// MulticastGroupDefault applies when Multicast.Group is empty.
+const MulticastGroupDefault = "239.255.73.68:7374"
+
+// Multicast discovers peers on the local network with periodic announcements
+// on a UDP multicast group. It serves the role of mDNS, without the DNS
+// encoding.
+type Multicast struct {
+	Group     string         // default MulticastGroupDefault
+	Interface *net.Interface // nil for the system default
+	Interval  time.Duration  // default 10 s
+
+	// Self is announced when Addr is not empty.
+	Self PeerAddr
+}
+
+// Announcement is the multicast payload.
+type announcement struct {
+	Protocol string `json:"proto"`
+	Addr     string `json:"addr"`
+	ID       string `json:"id,omitempty"`
+}
+
+const announcementProtocol = "idchain-discovery/1"
+
+// ParseAnnouncement returns the peer of a datagram, if any.
+func parseAnnouncement(datagram []byte) (PeerAddr, bool) {
+	var a announcement
+	if json.Unmarshal(datagram, &a) != nil || a.Protocol != announcementProtocol || a.Addr == "" {
+		return PeerAddr{}, false
+	}
+	return PeerAddr{Addr: a.Addr, ID: a.ID, Source: "mdns"}, true
+}
+
+// Discover implements the Discoverer interface.
+func (m *Multicast) Discover(ctx context.Context, found func(PeerAddr)) error {
+	group := m.Group
+	if group == "" {
+		group = MulticastGroupDefault
+	}
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return fmt.Errorf("multicast discovery group: %w", err)
+	}
+	conn, err := net.ListenMulticastUDP("udp", m.Interface, addr)
+	if err != nil {
+		return fmt.Errorf("multicast discovery unavailable: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if m.Self.Addr != "" {
+		msg, err := json.Marshal(&announcement{announcementProtocol, m.Self.Addr, m.Self.ID})
+		if err != nil {
+			return err
+		}
+		interval := m.Interval
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				conn.WriteToUDP(msg, addr)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("multicast discovery: %w", err)
+		}
+		if p, ok := parseAnnouncement(buf[:n]); ok && p.Addr != m.Self.Addr {
+			found(p)
+		}
+	}
+}
+
+// RendezvousServer keeps peer registrations per namespace, as a meeting
+// point for nodes across networks. Bootstrap nodes typically serve it.
+//
+//	POST {base}/{namespace}  register the PeerAddr in the body
+//	GET  {base}/{namespace}  list the registered PeerAddrs
+//
+// Registrations are not authenticated. Peers confirm their identity on
+// handshake, and MaxPerNamespace limits the damage of spam.
+type RendezvousServer struct {
+	TTL             time.Duration // default 5 min
+	MaxPerNamespace int           // default 1000
+
+	mutex      sync.Mutex
+	namespaces map[string]map[string]registration
+}
+
+type registration struct {
+	PeerAddr
+	expires time.Time
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *RendezvousServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns := r.URL.Path[strings.LastIndexByte(r.URL.Path, '/')+1:]
+	if ns == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var p PeerAddr
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&p); err != nil || p.Addr == "" {
+			http.Error(w, "malformed registration", http.StatusBadRequest)
+			return
+		}
+		if !s.register(ns, p) {
+			http.Error(w, "namespace full", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(s.list(ns))
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *RendezvousServer) register(ns string, p PeerAddr) bool {
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	max := s.MaxPerNamespace
+	if max <= 0 {
+		max = 1000
+	}
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.namespaces == nil {
+		s.namespaces = make(map[string]map[string]registration)
+	}
+	regs := s.namespaces[ns]
+	if regs == nil {
+		regs = make(map[string]registration)
+		s.namespaces[ns] = regs
+	}
+	for addr, reg := range regs {
+		if now.After(reg.expires) {
+			delete(regs, addr)
+		}
+	}
+	if _, ok := regs[p.Addr]; !ok && len(regs) >= max {
+		return false
+	}
+	p.Source = "rendezvous"
+	regs[p.Addr] = registration{p, now.Add(ttl)}
+	return true
+}
+
+func (s *RendezvousServer) list(ns string) []PeerAddr {
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	list := []PeerAddr{}
+	for _, reg := range s.namespaces[ns] {
+		if now.Before(reg.expires) {
+			list = append(list, reg.PeerAddr)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Addr < list[j].Addr })
+	return list
+}
+
+// Rendezvous is a Discoverer which registers with RendezvousServers, and
+// which polls them for other peers.
+type Rendezvous struct {
+	Servers   []string // base URLs
+	Namespace string   // e.g., the network name
+
+	// Self is registered when Addr is not empty.
+	Self PeerAddr
+
+	Interval time.Duration // default 1 min
+	HTTP     *http.Client  // nil for http.DefaultClient
+}
+
+// Discover implements the Discoverer interface. Unreachable servers are
+// retried on the next round.
+func (r *Rendezvous) Discover(ctx context.Context, found func(PeerAddr)) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, server := range r.Servers {
+			r.round(ctx, strings.TrimSuffix(server, "/")+"/"+url.PathEscape(r.Namespace), found)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Rendezvous) round(ctx context.Context, location string, found func(PeerAddr)) {
+	client := r.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if r.Self.Addr != "" {
+		body, _ := json.Marshal(&r.Self)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, location, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	var list []PeerAddr
+	if json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&list) != nil {
+		return
+	}
+	for _, p := range list {
+		if p.Addr != "" && p.Addr != r.Self.Addr {
+			p.Source = "rendezvous"
+			found(p)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package p2p
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Message kinds
+const (
+	KindOperation = "op"    // DID operation
+	KindBlock     = "block" // block announcement
+)
+
+// Message is a unit of gossip.
+type Message struct {
+	Kind    string `json:"kind"`
+	Payload []byte `json:"payload"`
+}
+
+// ID returns the hex encoding of the SHA-256 over the kind and the payload.
+func (m *Message) ID() string {
+	h := sha256.New()
+	h.Write([]byte(m.Kind))
+	h.Write([]byte{0})
+	h.Write(m.Payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GossipFrameMax is the size limit of gossip frames in bytes.
+const GossipFrameMax = 1 << 20
+
+// ErrFrame signals a gossip frame beyond GossipFrameMax.
+var ErrFrame = errors.New("gossip frame exceeds size limit")
+
+// Frame is the wire unit, encoded as JSON after a 4-byte big-endian length.
+type frame struct {
+	Msg   *Message `json:"msg,omitempty"`   // push
+	IHave []string `json:"ihave,omitempty"` // anti-entropy digest
+	IWant []string `json:"iwant,omitempty"` // anti-entropy request
+}
+
+// Gossip disseminates messages, such as DID operations and block
+// announcements, through the peer network. New messages go to a random subset
+// of peers. Periodic anti-entropy rounds exchange the IDs of recent messages
+// with a random peer to recover anything missed. Duplicates are dropped by ID.
+type Gossip struct {
+	// Deliver receives each new message once. Messages with an error are
+	// not forwarded.
+	Deliver func(from *Peer, m *Message) error
+
+	Fanout   int           // push peers per message, default 4
+	Interval time.Duration // anti-entropy period, default 5 s
+	Retain   time.Duration // message retention, default 10 min
+
+	// BytesPerSecond limits the outbound messages per peer. Messages over
+	// budget are skipped on push, to arrive with anti-entropy instead. Zero
+	// means no limit.
+	BytesPerSecond int
+
+	Log *slog.Logger // nil for slog.Default
+
+	mutex sync.Mutex
+	peers map[*gossipPeer]struct{}
+	msgs  map[string]*retained // by message ID
+}
+
+type retained struct {
+	msg  *Message // nil when rejected
+	seen time.Time
+}
+
+func (g *Gossip) log() *slog.Logger {
+	if g.Log != nil {
+		return g.Log
+	}
+	return slog.Default()
+}
+
+type gossipPeer struct {
+	conn Conn
+	out  chan *frame
+	done chan struct{}
+
+	// byte budget
+	tokens float64
+	filled time.Time
+}
+
+// Allow applies the byte budget for n bytes. Once the budget is positive, a
+// message of any size passes, and the excess is debt.
+func (p *gossipPeer) allow(g *Gossip, n int) bool {
+	rate := float64(g.BytesPerSecond)
+	if rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	if p.filled.IsZero() {
+		p.tokens = rate
+	} else {
+		p.tokens = min(rate, p.tokens+now.Sub(p.filled).Seconds()*rate)
+	}
+	p.filled = now
+	if p.tokens < 0 {
+		return false
+	}
+	p.tokens -= float64(n)
+	return true
+}
+
+// Send queues f without blocking. Full queues drop the frame.
+func (p *gossipPeer) send(f *frame) bool {
+	select {
+	case p.out <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// Join runs the gossip protocol on conn until conn fails or ctx is done.
+func (g *Gossip) Join(ctx context.Context, conn Conn) error {
+	p := &gossipPeer{conn: conn, out: make(chan *frame, 64), done: make(chan struct{})}
+	g.mutex.Lock()
+	if g.peers == nil {
+		g.peers = make(map[*gossipPeer]struct{})
+	}
+	if g.msgs == nil {
+		g.msgs = make(map[string]*retained)
+	}
+	g.peers[p] = struct{}{}
+	g.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-p.done:
+		}
+		conn.Close()
+	}()
+	go g.writeLoop(p)
+
+	err := g.readLoop(p)
+	g.mutex.Lock()
+	delete(g.peers, p)
+	g.mutex.Unlock()
+	close(p.done)
+	if ctx.Err() != nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func (g *Gossip) writeLoop(p *gossipPeer) {
+	var buf []byte
+	for {
+		var f *frame
+		select {
+		case <-p.done:
+			return
+		case f = <-p.out:
+		}
+		body, err := json.Marshal(f)
+		if err != nil {
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf[:0], uint32(len(body)))
+		buf = append(buf, body...)
+		if _, err := p.conn.Write(buf); err != nil {
+			p.conn.Close()
+			return
+		}
+	}
+}
+
+func (g *Gossip) readLoop(p *gossipPeer) error {
+	var head [4]byte
+	for {
+		if _, err := io.ReadFull(p.conn, head[:]); err != nil {
+			return err
+		}
+		size := binary.BigEndian.Uint32(head[:])
+		if size > GossipFrameMax {
+			return fmt.Errorf("%w: %d bytes from peer %s", ErrFrame, size, p.conn.Peer().ID)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(p.conn, body); err != nil {
+			return err
+		}
+		var f frame
+		if err := json.Unmarshal(body, &f); err != nil {
+			return fmt.Errorf("gossip frame from peer %s: %w", p.conn.Peer().ID, err)
+		}
+
+		if f.Msg != nil {
+			g.receive(p, f.Msg)
+		}
+		if len(f.IHave) != 0 {
+			if want := g.missing(f.IHave); len(want) != 0 {
+				p.send(&frame{IWant: want})
+			}
+		}
+		for _, id := range f.IWant {
+			g.mutex.Lock()
+			r := g.msgs[id]
+			ok := r != nil && r.msg != nil && p.allow(g, len(r.msg.Payload))
+			g.mutex.Unlock()
+			if ok {
+				p.send(&frame{Msg: r.msg})
+			}
+		}
+	}
+}
+
+// Receive handles a push from p.
+func (g *Gossip) receive(p *gossipPeer, m *Message) {
+	id := m.ID()
+	g.mutex.Lock()
+	if _, ok := g.msgs[id]; ok {
+		g.mutex.Unlock()
+		return // duplicate
+	}
+	r := &retained{seen: time.Now()}
+	g.msgs[id] = r
+	g.mutex.Unlock()
+
+	if g.Deliver != nil {
+		if err := g.Deliver(p.conn.Peer(), m); err != nil {
+			g.log().Debug("gossip message rejected", "peer", p.conn.Peer(), "kind", m.Kind, "id", id, "error", err)
+			return
+		}
+	}
+	g.mutex.Lock()
+	r.msg = m
+	g.mutex.Unlock()
+	g.push(m, p)
+}
+
+// Publish disseminates a local message. It returns false for duplicates.
+func (g *Gossip) Publish(m *Message) bool {
+	id := m.ID()
+	g.mutex.Lock()
+	if g.msgs == nil {
+		g.msgs = make(map[string]*retained)
+	}
+	if _, ok := g.msgs[id]; ok {
+		g.mutex.Unlock()
+		return false
+	}
+	g.msgs[id] = &retained{msg: m, seen: time.Now()}
+	g.mutex.Unlock()
+	g.push(m, nil)
+	return true
+}
+
+// Push sends m to Fanout random peers other than source.
+func (g *Gossip) push(m *Message, source *gossipPeer) {
+	fanout := g.Fanout
+	if fanout <= 0 {
+		fanout = 4
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	// map iteration order is random
+	for p := range g.peers {
+		if fanout == 0 {
+			break
+		}
+		if p == source {
+			continue
+		}
+		fanout--
+		if !p.allow(g, len(m.Payload)) {
+			g.log().Debug("gossip push over byte budget", "peer", p.conn.Peer(), "id", m.ID())
+			continue
+		}
+		p.send(&frame{Msg: m})
+	}
+}
+
+// Missing returns the IDs not seen.
+func (g *Gossip) missing(ids []string) []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var want []string
+	for _, id := range ids {
+		if _, ok := g.msgs[id]; !ok {
+			want = append(want, id)
+		}
+	}
+	return want
+}
+
+// Run does anti-entropy rounds, and it expires messages, until ctx is done.
+func (g *Gossip) Run(ctx context.Context) {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.round()
+		}
+	}
+}
+
+func (g *Gossip) round() {
+	retain := g.Retain
+	if retain <= 0 {
+		retain = 10 * time.Minute
+	}
+	expire := time.Now().Add(-retain)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var ids []string
+	for id, r := range g.msgs {
+		switch {
+		case r.seen.Before(expire):
+			delete(g.msgs, id)
+		case r.msg != nil:
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(g.peers) == 0 {
+		return
+	}
+	// digest limited to the frame size with 65 bytes per ID
+	if max := GossipFrameMax/65 - 1; len(ids) > max {
+		rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+		ids = ids[:max]
+	}
+	pick := rand.IntN(len(g.peers))
+	for p := range g.peers {
+		if pick == 0 {
+			p.send(&frame{IHave: ids})
+			break
+		}
+		pick--
+	}
+}
@@ -0,0 +1,527 @@
+package p2p
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// NoiseProtocol is the protocol name conform “The Noise Protocol Framework”,
+// revision 34.
+const NoiseProtocol = "Noise_XX_25519_AESGCM_SHA256"
+
+// NoisePrologue binds handshakes to this application.
+const NoisePrologue = "IDChain p2p"
+
+// Noise messages, handshake and transport alike, go in frames with a 16-bit
+// length prefix. “The maximum Noise message length is 65535 bytes.”
+const noiseMax = 65535
+
+// NoiseIdentityPrefix precedes the static key in identity signatures.
+const noiseIdentityPrefix = "idchain-noise-static-key:"
+
+// Noise is a Transport with the Noise XX handshake. Nodes need no certificate
+// authority. Instead, each side proves its static Diffie–Hellman key with a
+// signature from an authentication method of its DID, as a compact JWS in
+// the handshake payload.
+type Noise struct {
+	KeyID    backend.URL   // authentication method of the node DID
+	Signer   crypto.Signer // key of KeyID
+	Resolver backend.Resolver
+
+	Log         *slog.Logger // nil for slog.Default
+	OnHandshake HandshakeFunc
+
+	once     sync.Once
+	static   *ecdh.PrivateKey
+	identity []byte // JWS over static public key
+	initErr  error
+}
+
+func (n *Noise) log() *slog.Logger {
+	if n.Log != nil {
+		return n.Log
+	}
+	return slog.Default()
+}
+
+// Init generates the static key with its identity proof.
+func (n *Noise) init() error {
+	n.once.Do(func() {
+		n.static, n.initErr = ecdh.X25519().GenerateKey(rand.Reader)
+		if n.initErr != nil {
+			return
+		}
+		alg, err := jose.AlgFor(n.Signer.Public())
+		if err != nil {
+			n.initErr = err
+			return
+		}
+		payload := append([]byte(noiseIdentityPrefix), n.static.PublicKey().Bytes()...)
+		jws, err := jose.Sign(jose.Header{Alg: alg, Kid: n.KeyID.String()}, payload, n.Signer)
+		n.identity, n.initErr = []byte(jws), err
+	})
+	return n.initErr
+}
+
+// VerifyIdentity checks a handshake payload for the remote static key.
+func (n *Noise) verifyIdentity(ctx context.Context, payload, remoteStatic []byte) (*Peer, error) {
+	jws, err := jose.ParseCompact(string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: noise identity: %w", ErrPeer, err)
+	}
+	if string(jws.Payload) != noiseIdentityPrefix+string(remoteStatic) {
+		return nil, fmt.Errorf("%w: noise identity for another static key", ErrPeer)
+	}
+	keyID, err := backend.ParseURL(jws.Header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: noise identity kid: %w", ErrPeer, err)
+	}
+	doc, _, err := n.Resolver.Resolve(ctx, keyID.DID)
+	if err != nil {
+		return nil, fmt.Errorf("peer DID resolution: %w", err)
+	}
+	m := doc.AuthorizedMethod(doc.Authentication, keyID)
+	if m == nil {
+		return nil, fmt.Errorf("%w: no authentication method %s in DID document", ErrPeer, keyID.String())
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPeer, err)
+	}
+	if err := jws.Verify(pub); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPeer, err)
+	}
+	return &Peer{ID: keyID.String(), DID: keyID.DID, Transport: "noise"}, nil
+}
+
+// Client implements the Transport interface.
+func (n *Noise) Client(ctx context.Context, raw net.Conn) (Conn, error) {
+	return n.handshake(ctx, raw, true)
+}
+
+// Server implements the Transport interface.
+func (n *Noise) Server(ctx context.Context, raw net.Conn) (Conn, error) {
+	return n.handshake(ctx, raw, false)
+}
+
+func (n *Noise) handshake(ctx context.Context, raw net.Conn, initiator bool) (Conn, error) {
+	if err := n.init(); err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+		defer raw.SetDeadline(time.Time{})
+	}
+
+	var c *noiseConn
+	var err error
+	if initiator {
+		c, err = n.initiate(ctx, raw)
+	} else {
+		c, err = n.respond(ctx, raw)
+	}
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	var p *Peer
+	if c != nil {
+		p = c.peer
+	}
+	if n.OnHandshake != nil {
+		n.OnHandshake(p, err)
+	}
+	if err != nil {
+		n.log().Warn("peer handshake failed", "remote", raw.RemoteAddr().String(), "transport", "noise", "error", err)
+		raw.Close()
+		return nil, err
+	}
+	n.log().Info("peer connected", "peer", p, "remote", raw.RemoteAddr().String())
+	return c, nil
+}
+
+func dh(priv *ecdh.PrivateKey, pub []byte) ([]byte, error) {
+	remote, err := ecdh.X25519().NewPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: noise public key: %w", ErrPeer, err)
+	}
+	secret, err := priv.ECDH(remote)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPeer, err)
+	}
+	return secret, nil
+}
+
+const (
+	dhLen       = 32         // X25519
+	sealedDHLen = dhLen + 16 // with AES-GCM tag
+	noiseTagLen = 16         // AES-GCM tag
+	noiseChunk  = noiseMax - noiseTagLen
+)
+
+// Initiate runs the initiator side of XX.
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s, se
+func (n *Noise) initiate(ctx context.Context, raw net.Conn) (*noiseConn, error) {
+	ss := newSymmetricState()
+	e, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// -> e
+	ePub := e.PublicKey().Bytes()
+	ss.mixHash(ePub)
+	msg := append(ePub, ss.encryptAndHash(nil)...)
+	if err := writeFrame(raw, msg); err != nil {
+		return nil, err
+	}
+
+	// <- e, ee, s, es
+	msg, err = readFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < dhLen+sealedDHLen {
+		return nil, fmt.Errorf("%w: noise message 2 of %d bytes", ErrPeer, len(msg))
+	}
+	re := msg[:dhLen]
+	ss.mixHash(re)
+	if err := ss.mixDH(e, re); err != nil {
+		return nil, err
+	}
+	rs, err := ss.decryptAndHash(msg[dhLen : dhLen+sealedDHLen])
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.mixDH(e, rs); err != nil {
+		return nil, err
+	}
+	payload, err := ss.decryptAndHash(msg[dhLen+sealedDHLen:])
+	if err != nil {
+		return nil, err
+	}
+	peer, err := n.verifyIdentity(ctx, payload, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	// -> s, se
+	msg = ss.encryptAndHash(n.static.PublicKey().Bytes())
+	if err := ss.mixDH(n.static, re); err != nil {
+		return nil, err
+	}
+	msg = append(msg, ss.encryptAndHash(n.identity)...)
+	if err := writeFrame(raw, msg); err != nil {
+		return nil, err
+	}
+
+	c := &noiseConn{Conn: raw, peer: peer}
+	c.send, c.recv = ss.split()
+	return c, nil
+}
+
+// Respond runs the responder side of XX.
+func (n *Noise) respond(ctx context.Context, raw net.Conn) (*noiseConn, error) {
+	ss := newSymmetricState()
+
+	// -> e
+	msg, err := readFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < dhLen {
+		return nil, fmt.Errorf("%w: noise message 1 of %d bytes", ErrPeer, len(msg))
+	}
+	re := msg[:dhLen]
+	ss.mixHash(re)
+	if _, err := ss.decryptAndHash(msg[dhLen:]); err != nil {
+		return nil, err
+	}
+
+	// <- e, ee, s, es
+	e, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	msg = e.PublicKey().Bytes()
+	ss.mixHash(msg)
+	if err := ss.mixDH(e, re); err != nil {
+		return nil, err
+	}
+	msg = append(msg, ss.encryptAndHash(n.static.PublicKey().Bytes())...)
+	if err := ss.mixDH(n.static, re); err != nil {
+		return nil, err
+	}
+	msg = append(msg, ss.encryptAndHash(n.identity)...)
+	if err := writeFrame(raw, msg); err != nil {
+		return nil, err
+	}
+
+	// -> s, se
+	msg, err = readFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < sealedDHLen {
+		return nil, fmt.Errorf("%w: noise message 3 of %d bytes", ErrPeer, len(msg))
+	}
+	rs, err := ss.decryptAndHash(msg[:sealedDHLen])
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.mixDH(e, rs); err != nil {
+		return nil, err
+	}
+	payload, err := ss.decryptAndHash(msg[sealedDHLen:])
+	if err != nil {
+		return nil, err
+	}
+	peer, err := n.verifyIdentity(ctx, payload, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &noiseConn{Conn: raw, peer: peer}
+	c.recv, c.send = ss.split()
+	return c, nil
+}
+
+func writeFrame(w io.Writer, msg []byte) error {
+	if len(msg) > noiseMax {
+		return fmt.Errorf("noise message of %d bytes exceeds limit", len(msg))
+	}
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// CipherState is conform section 5.1 of the Noise specification.
+type cipherState struct {
+	aead cipher.AEAD // nil for no key
+	n    uint64
+}
+
+func (c *cipherState) initializeKey(k []byte) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		panic(err) // key size fixed
+	}
+	c.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	c.n = 0
+}
+
+// “AESGCM: … 96-bit nonce is formed by encoding 32 bits of zeros followed by
+// big-endian encoding of n.”
+func (c *cipherState) nonce() []byte {
+	var nonce [12]byte
+	binary.BigEndian.PutUint64(nonce[4:], c.n)
+	return nonce[:]
+}
+
+var errNonceExhausted = errors.New("noise nonce exhausted")
+
+func (c *cipherState) encrypt(ad, plaintext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return plaintext, nil
+	}
+	if c.n == math.MaxUint64 {
+		return nil, errNonceExhausted
+	}
+	ciphertext := c.aead.Seal(nil, c.nonce(), plaintext, ad)
+	c.n++
+	return ciphertext, nil
+}
+
+func (c *cipherState) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return ciphertext, nil
+	}
+	if c.n == math.MaxUint64 {
+		return nil, errNonceExhausted
+	}
+	plaintext, err := c.aead.Open(nil, c.nonce(), ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: noise decryption", ErrPeer)
+	}
+	c.n++
+	return plaintext, nil
+}
+
+// SymmetricState is conform section 5.2 of the Noise specification.
+type symmetricState struct {
+	cs    cipherState
+	ck, h [sha256.Size]byte
+}
+
+func newSymmetricState() *symmetricState {
+	ss := new(symmetricState)
+	// protocol name fits in the hash length
+	copy(ss.h[:], NoiseProtocol)
+	ss.ck = ss.h
+	ss.mixHash([]byte(NoisePrologue))
+	return ss
+}
+
+func (ss *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(ss.h[:])
+	h.Write(data)
+	h.Sum(ss.h[:0])
+}
+
+func (ss *symmetricState) mixKey(ikm []byte) {
+	var k [sha256.Size]byte
+	ss.ck, k = hkdf2(ss.ck[:], ikm)
+	ss.cs.initializeKey(k[:])
+}
+
+// MixDH mixes the Diffie–Hellman result of priv and pub into the key.
+func (ss *symmetricState) mixDH(priv *ecdh.PrivateKey, pub []byte) error {
+	secret, err := dh(priv, pub)
+	if err != nil {
+		return err
+	}
+	ss.mixKey(secret)
+	return nil
+}
+
+// EncryptAndHash never fails during handshakes, as nonces start at zero.
+func (ss *symmetricState) encryptAndHash(plaintext []byte) []byte {
+	ciphertext, _ := ss.cs.encrypt(ss.h[:], plaintext)
+	ss.mixHash(ciphertext)
+	return ciphertext
+}
+
+func (ss *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := ss.cs.decrypt(ss.h[:], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	ss.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// Split returns the initiator-to-responder and the responder-to-initiator
+// ciphers, in that order.
+func (ss *symmetricState) split() (c1, c2 cipherState) {
+	k1, k2 := hkdf2(ss.ck[:], nil)
+	c1.initializeKey(k1[:])
+	c2.initializeKey(k2[:])
+	return
+}
+
+// Hkdf2 is HKDF with two outputs conform section 4.3.
+func hkdf2(chainingKey, ikm []byte) (o1, o2 [sha256.Size]byte) {
+	m := hmac.New(sha256.New, chainingKey)
+	m.Write(ikm)
+	temp := m.Sum(nil)
+
+	m = hmac.New(sha256.New, temp)
+	m.Write([]byte{1})
+	m.Sum(o1[:0])
+
+	m = hmac.New(sha256.New, temp)
+	m.Write(o1[:])
+	m.Write([]byte{2})
+	m.Sum(o2[:0])
+	return
+}
+
+// NoiseConn is a transport session.
+type noiseConn struct {
+	net.Conn
+	peer *Peer
+
+	readMutex sync.Mutex
+	recv      cipherState
+	pending   []byte // decrypted, not read yet
+
+	writeMutex sync.Mutex
+	send       cipherState
+}
+
+// Peer implements the Conn interface.
+func (c *noiseConn) Peer() *Peer { return c.peer }
+
+// Read implements the io.Reader interface.
+func (c *noiseConn) Read(p []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	for len(c.pending) == 0 {
+		msg, err := readFrame(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.pending, err = c.recv.decrypt(nil, msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write implements the io.Writer interface.
+func (c *noiseConn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	var n int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > noiseChunk {
+			chunk = chunk[:noiseChunk]
+		}
+		msg, err := c.send.encrypt(nil, chunk)
+		if err != nil {
+			return n, err
+		}
+		if err := writeFrame(c.Conn, msg); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
@@ -0,0 +1,58 @@
+// Package p2p provides authenticated connections between IDChain nodes. Each
+// connection identifies the remote node as a Peer, optionally bound to a DID,
+// for use in logs, metrics and access decisions of the layers on top.
+package p2p
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// ErrPeer signals a peer which fails authentication.
+var ErrPeer = errors.New("peer authentication denied")
+
+// Peer is the authenticated identity of a remote node.
+type Peer struct {
+	// ID is a stable identifier for logs and metrics, e.g., the DID URL of
+	// the node key or the certificate subject.
+	ID string
+
+	// DID is the node DID, or the zero value when not DID-bound.
+	DID backend.DID
+
+	// Transport is the name of the security protocol, e.g., "tls".
+	Transport string
+}
+
+// LogValue implements the slog.LogValuer interface.
+func (p *Peer) LogValue() slog.Value {
+	if p == nil {
+		return slog.StringValue("")
+	}
+	return slog.GroupValue(
+		slog.String("id", p.ID),
+		slog.String("transport", p.Transport))
+}
+
+// Conn is an authenticated connection.
+type Conn interface {
+	net.Conn
+	Peer() *Peer
+}
+
+// HandshakeFunc observes each handshake outcome, e.g., for metrics. The peer
+// is nil when authentication failed before identification.
+type HandshakeFunc func(p *Peer, err error)
+
+// Transport secures raw connections. The handshake honors the context
+// deadline.
+type Transport interface {
+	// Client runs the initiator side of the handshake.
+	Client(ctx context.Context, raw net.Conn) (Conn, error)
+	// Server runs the responder side of the handshake.
+	Server(ctx context.Context, raw net.Conn) (Conn, error)
+}
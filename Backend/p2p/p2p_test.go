@@ -0,0 +1,576 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// TestNode is a node identity with its DID document.
+type testNode struct {
+	keyID backend.URL
+	key   ed25519.PrivateKey
+	doc   *backend.Document
+}
+
+func newTestNode(t *testing.T, name string) *testNode {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := backend.DID{Method: "example", SpecID: name}
+	keyID := backend.URL{DID: subject, RawFragment: "#node"}
+	m, err := jose.NewMethod(keyID, subject, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testNode{keyID, key, &backend.Document{
+		Subject:             subject,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		Authentication: &backend.VerificationRelationship{
+			URIRefs: []*backend.URL{{RawFragment: "#node"}},
+		},
+	}}
+}
+
+func testResolve(nodes ...*testNode) backend.Resolve {
+	return func(did backend.DID) (*backend.Document, *backend.Meta, error) {
+		for _, n := range nodes {
+			if n.doc.Subject.Equal(did) {
+				return n.doc, nil, nil
+			}
+		}
+		return nil, nil, backend.ErrNotFound
+	}
+}
+
+// Handshake connects a client and a server transport over loopback.
+func handshake(t *testing.T, client, server Transport) (clientConn, serverConn Conn, clientErr, serverErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serverConn, serverErr = server.Server(ctx, b)
+		if serverErr != nil {
+			b.Close()
+		}
+	}()
+	clientConn, clientErr = client.Client(ctx, a)
+	if clientErr != nil {
+		a.Close()
+	}
+	<-done
+	return
+}
+
+func TestTLSDIDBinding(t *testing.T) {
+	alice, bob := newTestNode(t, "alice"), newTestNode(t, "bob")
+	resolve := testResolve(alice, bob)
+	transport := func(n *testNode, certKey ed25519.PrivateKey) *TLS {
+		cert, err := NewDIDCertificate(&n.keyID, certKey, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &TLS{
+			Certificate: func() (*tls.Certificate, error) { return cert, nil },
+			Resolver:    resolve,
+		}
+	}
+
+	c, s, cErr, sErr := handshake(t, transport(alice, alice.key), transport(bob, bob.key))
+	if cErr != nil || sErr != nil {
+		t.Fatalf("got client error %v, server error %v", cErr, sErr)
+	}
+	if got := c.Peer().ID; got != "did:example:bob#node" {
+		t.Errorf("client got peer %q, want did:example:bob#node", got)
+	}
+	if got := s.Peer().DID; !got.Equal(alice.doc.Subject) {
+		t.Errorf("server got peer DID %s, want did:example:alice", got.String())
+	}
+	c.Close()
+	s.Close()
+
+	// certificate claims the DID of alice with another key
+	_, mallory, _ := ed25519.GenerateKey(rand.Reader)
+	_, _, _, sErr = handshake(t, transport(alice, mallory), transport(bob, bob.key))
+	if !errors.Is(sErr, ErrPeer) {
+		t.Errorf("impostor got server error %v, want ErrPeer", sErr)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	r := &CertReloader{
+		CertFile: filepath.Join(dir, "node.crt"),
+		KeyFile:  filepath.Join(dir, "node.key"),
+	}
+	write := func(n *testNode) {
+		cert, err := NewDIDCertificate(&n.keyID, n.key, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(n.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(r.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(r.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := newTestNode(t, "first")
+	write(first)
+	cert, err := r.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.key.Equal(cert.PrivateKey) {
+		t.Error("initial load got another key")
+	}
+
+	second := newTestNode(t, "second")
+	write(second)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(r.CertFile, later, later)
+	r.checked = time.Time{} // skip interval
+	cert, err = r.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.key.Equal(cert.PrivateKey) {
+		t.Error("rotation got the previous key")
+	}
+}
+
+func TestNoise(t *testing.T) {
+	alice, bob := newTestNode(t, "alice"), newTestNode(t, "bob")
+	resolve := testResolve(alice, bob)
+
+	c, s, cErr, sErr := handshake(t,
+		&Noise{KeyID: alice.keyID, Signer: alice.key, Resolver: resolve},
+		&Noise{KeyID: bob.keyID, Signer: bob.key, Resolver: resolve})
+	if cErr != nil || sErr != nil {
+		t.Fatalf("got client error %v, server error %v", cErr, sErr)
+	}
+	defer c.Close()
+	defer s.Close()
+	if got := c.Peer().ID; got != "did:example:bob#node" {
+		t.Errorf("client got peer %q, want did:example:bob#node", got)
+	}
+	if got := s.Peer().ID; got != "did:example:alice#node" {
+		t.Errorf("server got peer %q, want did:example:alice#node", got)
+	}
+
+	// exceed the message limit in both directions
+	data := make([]byte, 3*noiseMax)
+	rand.Read(data)
+	for _, pair := range [][2]Conn{{c, s}, {s, c}} {
+		go pair[0].Write(data)
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(pair[1], got); err != nil {
+			t.Fatal("transport read error:", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("transport data corrupted")
+		}
+	}
+
+	// signer not in the DID document of alice
+	_, mallory, _ := ed25519.GenerateKey(rand.Reader)
+	_, _, _, sErr = handshake(t,
+		&Noise{KeyID: alice.keyID, Signer: mallory, Resolver: resolve},
+		&Noise{KeyID: bob.keyID, Signer: bob.key, Resolver: resolve})
+	if !errors.Is(sErr, ErrPeer) {
+		t.Errorf("impostor got server error %v, want ErrPeer", sErr)
+	}
+
+	// Multikey methods of did:key
+	pub, carolKey, _ := ed25519.GenerateKey(rand.Reader)
+	carol, err := didkey.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolID := backend.URL{DID: carol, RawFragment: "#" + carol.SpecID}
+	withKey := func(did backend.DID) (*backend.Document, *backend.Meta, error) {
+		if did.Method == didkey.Method {
+			return new(didkey.Resolver).Resolve(context.Background(), did)
+		}
+		return resolve(did)
+	}
+	c, s, cErr, sErr = handshake(t,
+		&Noise{KeyID: carolID, Signer: carolKey, Resolver: backend.Resolve(withKey)},
+		&Noise{KeyID: bob.keyID, Signer: bob.key, Resolver: backend.Resolve(withKey)})
+	if cErr != nil || sErr != nil {
+		t.Fatalf("did:key got client error %v, server error %v", cErr, sErr)
+	}
+	c.Close()
+	s.Close()
+}
+
+// Found is a Discoverer of a fixed peer.
+type found PeerAddr
+
+func (f found) Discover(ctx context.Context, callback func(PeerAddr)) error {
+	callback(PeerAddr(f))
+	<-ctx.Done()
+	return nil
+}
+
+func TestDiscoverTopology(t *testing.T) {
+	dynamic := []Discoverer{found{Addr: "10.0.0.9:7373", Source: "mdns"}}
+	tests := []struct {
+		topology Topology
+		want     []string
+	}{
+		{BootstrapOnly, []string{"10.0.0.1:7373"}},
+		{Dynamic, []string{"10.0.0.1:7373", "10.0.0.9:7373"}},
+	}
+	for _, test := range tests {
+		config := &DiscoveryConfig{Topology: test.topology, Bootstrap: []string{"10.0.0.1:7373"}}
+		var book PeerBook
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err := Discover(ctx, config, dynamic, &book, nil)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s got error: %s", test.topology, err)
+		}
+		var got []string
+		for _, p := range book.List() {
+			got = append(got, p.Addr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s got peers %q, want %q", test.topology, got, test.want)
+		}
+	}
+
+	err := Discover(context.Background(), &DiscoveryConfig{Topology: "mesh"}, nil, new(PeerBook), nil)
+	if err == nil {
+		t.Error("unknown topology got no error")
+	}
+}
+
+func TestPeerBook(t *testing.T) {
+	book := PeerBook{Max: 1}
+	if !book.Add(PeerAddr{Addr: "a:1", Source: "mdns"}) {
+		t.Error("first entry not added")
+	}
+	if book.Add(PeerAddr{Addr: "b:1", Source: "mdns"}) {
+		t.Error("entry beyond Max added")
+	}
+	if !book.Add(PeerAddr{Addr: "c:1", Source: "bootstrap"}) {
+		t.Error("bootstrap entry beyond Max not added")
+	}
+	if book.Add(PeerAddr{Addr: "a:1", ID: "did:example:a#node", Source: "rendezvous"}) {
+		t.Error("duplicate address added")
+	}
+	want := []PeerAddr{
+		{Addr: "a:1", ID: "did:example:a#node", Source: "mdns"},
+		{Addr: "c:1", Source: "bootstrap"},
+	}
+	if got := book.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestRendezvous(t *testing.T) {
+	srv := httptest.NewServer(&RendezvousServer{})
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mutex sync.Mutex
+	seen := make(map[string]PeerAddr)
+	var wg sync.WaitGroup
+	for _, addr := range []string{"10.0.0.1:7373", "10.0.0.2:7373"} {
+		r := &Rendezvous{
+			Servers:   []string{srv.URL + "/rendezvous/"},
+			Namespace: "testnet",
+			Self:      PeerAddr{Addr: addr, ID: "node@" + addr},
+			Interval:  10 * time.Millisecond,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Discover(ctx, func(p PeerAddr) {
+				mutex.Lock()
+				seen[r.Self.Addr+" -> "+p.Addr] = p
+				mutex.Unlock()
+			})
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mutex.Lock()
+		n := len(seen)
+		mutex.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	want := map[string]PeerAddr{
+		"10.0.0.1:7373 -> 10.0.0.2:7373": {Addr: "10.0.0.2:7373", ID: "node@10.0.0.2:7373", Source: "rendezvous"},
+		"10.0.0.2:7373 -> 10.0.0.1:7373": {Addr: "10.0.0.1:7373", ID: "node@10.0.0.1:7373", Source: "rendezvous"},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("got %+v, want %+v", seen, want)
+	}
+}
+
+func TestParseAnnouncement(t *testing.T) {
+	p, ok := parseAnnouncement([]byte(`{"proto":"idchain-discovery/1","addr":"10.0.0.1:7373","id":"did:example:a#node"}`))
+	if want := (PeerAddr{Addr: "10.0.0.1:7373", ID: "did:example:a#node", Source: "mdns"}); !ok || p != want {
+		t.Errorf("got %+v, %t, want %+v", p, ok, want)
+	}
+	for _, s := range []string{`{"proto":"other","addr":"10.0.0.1:7373"}`, `{"proto":"idchain-discovery/1"}`, `junk`} {
+		if _, ok := parseAnnouncement([]byte(s)); ok {
+			t.Errorf("%q got accepted", s)
+		}
+	}
+}
+
+// PipeConn is an in-memory Conn.
+type pipeConn struct {
+	net.Conn
+	peer *Peer
+}
+
+func (c pipeConn) Peer() *Peer { return c.peer }
+
+// Link runs gossip between a and b until ctx is done.
+func link(ctx context.Context, a, b *Gossip, aID, bID string) {
+	x, y := net.Pipe()
+	go a.Join(ctx, pipeConn{x, &Peer{ID: bID}})
+	go b.Join(ctx, pipeConn{y, &Peer{ID: aID}})
+}
+
+// Inbox collects gossip deliveries.
+type inbox struct {
+	sync.Mutex
+	got []string
+}
+
+func (in *inbox) deliver(from *Peer, m *Message) error {
+	in.Lock()
+	defer in.Unlock()
+	in.got = append(in.got, string(m.Payload))
+	return nil
+}
+
+func (in *inbox) await(t *testing.T, name string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		in.Lock()
+		got := append([]string(nil), in.got...)
+		in.Unlock()
+		if len(got) >= n || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGossip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// chain a–b–c, with a cycle back to a for duplicates
+	var inA, inB, inC inbox
+	a := &Gossip{Deliver: inA.deliver}
+	b := &Gossip{Deliver: inB.deliver}
+	c := &Gossip{Deliver: inC.deliver}
+	link(ctx, a, b, "a", "b")
+	link(ctx, b, c, "b", "c")
+	link(ctx, c, a, "c", "a")
+	time.Sleep(10 * time.Millisecond) // registration
+
+	m := &Message{Kind: KindOperation, Payload: []byte("op1")}
+	if !a.Publish(m) {
+		t.Fatal("publish rejected")
+	}
+	if a.Publish(m) {
+		t.Error("duplicate publish accepted")
+	}
+	for name, in := range map[string]*inbox{"b": &inB, "c": &inC} {
+		if got := in.await(t, name, 1); len(got) != 1 || got[0] != "op1" {
+			t.Errorf("%s got %q, want [op1]", name, got)
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // late duplicates
+	for name, in := range map[string]*inbox{"a": &inA, "b": &inB, "c": &inC} {
+		in.Lock()
+		if name == "a" && len(in.got) != 0 || name != "a" && len(in.got) != 1 {
+			t.Errorf("%s got deliveries %q", name, in.got)
+		}
+		in.Unlock()
+	}
+}
+
+func TestGossipAntiEntropy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// budget allows one push per second
+	var inB inbox
+	a := &Gossip{BytesPerSecond: 1000, Interval: 10 * time.Millisecond}
+	b := &Gossip{Deliver: inB.deliver}
+	link(ctx, a, b, "a", "b")
+	time.Sleep(10 * time.Millisecond) // registration
+
+	pad := string(make([]byte, 1994))
+	a.Publish(&Message{Kind: KindBlock, Payload: []byte("block1" + pad)})
+	a.Publish(&Message{Kind: KindBlock, Payload: []byte("block2" + pad)})
+	if got := inB.await(t, "b", 1); len(got) != 1 || got[0][:6] != "block1" {
+		t.Fatalf("push got %d deliveries, want block1 only", len(got))
+	}
+	time.Sleep(50 * time.Millisecond)
+	inB.Lock()
+	n := len(inB.got)
+	inB.Unlock()
+	if n != 1 {
+		t.Fatalf("push over byte budget got %d deliveries, want 1", n)
+	}
+
+	go a.Run(ctx)
+	if got := inB.await(t, "b", 2); len(got) != 2 || got[1][:6] != "block2" {
+		t.Errorf("anti-entropy got %d deliveries, want block2 second", len(got))
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := didkey.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clock sync.Mutex
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	authority := &chain.Authority{
+		Validators: []backend.DID{validator},
+		Resolver:   new(didkey.Resolver),
+		KeyID:      &backend.URL{DID: validator, RawFragment: "#" + validator.SpecID},
+		Signer:     key,
+		Now: func() time.Time {
+			clock.Lock()
+			defer clock.Unlock()
+			now = now.Add(time.Second) // distinct blocks on each branch
+			return now
+		},
+	}
+	grow := func(c *chain.Blockchain, n int) []*chain.Block {
+		t.Helper()
+		var blocks []*chain.Block
+		for i := 0; i < n; i++ {
+			b, err := authority.ProposeBlock(ctx, c.Head(), nil)
+			if err != nil {
+				t.Fatal("proposal:", err)
+			}
+			if err := c.AddBlock(ctx, b); err != nil {
+				t.Fatal("add block:", err)
+			}
+			blocks = append(blocks, b)
+		}
+		return blocks
+	}
+
+	a := &Sync{Chain: &chain.Blockchain{Consensus: authority}}
+	var forks []uint64
+	b := &Sync{Chain: &chain.Blockchain{Consensus: authority}, Batch: 2,
+		OnFork: func(_ *Peer, height uint64, _ error) { forks = append(forks, height) },
+	}
+	x, y := net.Pipe()
+	go a.Serve(ctx, pipeConn{x, &Peer{ID: "b"}})
+	toA := pipeConn{y, &Peer{ID: "a"}}
+
+	grow(a.Chain, 3)
+	if err := b.Pull(ctx, toA); err != nil {
+		t.Fatal("initial pull:", err)
+	}
+	if b.Chain.Len() != 3 || b.Chain.Head().Hash() != a.Chain.Head().Hash() {
+		t.Fatalf("initial pull got %d blocks", b.Chain.Len())
+	}
+	if err := b.Pull(ctx, toA); err != nil {
+		t.Error("pull when in sync:", err)
+	}
+
+	// b diverges at height 3, while a gets ahead
+	grow(b.Chain, 1)
+	branch := grow(a.Chain, 3)
+	for _, blk := range branch[:2] {
+		m, err := BlockMessage(blk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Deliver(&Peer{ID: "a"}, m); !errors.Is(err, chain.ErrFork) {
+			t.Errorf("block %d announcement got error %v, want ErrFork", blk.Height, err)
+		}
+	}
+	m, _ := BlockMessage(branch[2])
+	if err := b.Deliver(&Peer{ID: "a"}, m); !errors.Is(err, ErrBehind) {
+		t.Errorf("announcement ahead got error %v, want ErrBehind", err)
+	}
+	if err := b.Pull(ctx, toA); err != nil {
+		t.Fatal("pull of longer branch:", err)
+	}
+	if b.Chain.Len() != 6 || b.Chain.Head().Hash() != a.Chain.Head().Hash() {
+		t.Errorf("pull of longer branch got %d blocks", b.Chain.Len())
+	}
+	if !reflect.DeepEqual(forks, []uint64{3, 4, 3}) {
+		t.Errorf("got forks at %v, want [3 4 3]", forks)
+	}
+
+	// announcement extends the head
+	next := grow(a.Chain, 1)[0]
+	m, _ = BlockMessage(next)
+	if err := b.Deliver(&Peer{ID: "a"}, m); err != nil || b.Chain.Len() != 7 {
+		t.Errorf("announcement of next block got error %v, %d blocks", err, b.Chain.Len())
+	}
+}
@@ -0,0 +1,296 @@
+package p2p
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"EncrypteDL/IDChain/Backend/chain"
+	"EncrypteDL/IDChain/Backend/idchain"
+)
+
+// ErrBehind signals a block announcement beyond the local chain. The node
+// should Pull from the peer.
+var ErrBehind = errors.New("block announcement ahead of local chain")
+
+// SyncFrameMax is the size limit of sync frames in bytes.
+const SyncFrameMax = 32 << 20
+
+// SyncRequest asks for Count blocks from height From on. A zero Count asks
+// for the status only.
+type syncRequest struct {
+	From  uint64 `json:"from"`
+	Count int    `json:"count,omitempty"`
+}
+
+// SyncResponse has the status of the chain, with any blocks requested.
+type syncResponse struct {
+	Len    uint64         `json:"len"`
+	Head   chain.Hash     `json:"head"`
+	Blocks []*chain.Block `json:"blocks,omitempty"`
+}
+
+// OperationMessage returns the gossip of a did:idchain log entry.
+func OperationMessage(entry string) *Message {
+	return &Message{Kind: KindOperation, Payload: []byte(entry)}
+}
+
+// BlockMessage returns the gossip of a block announcement.
+func BlockMessage(b *chain.Block) (*Message, error) {
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Kind: KindBlock, Payload: payload}, nil
+}
+
+// Sync keeps a Blockchain in line with the network. Deliver takes gossip,
+// Serve answers block requests, and Pull catches up with a peer, including
+// the initial block download. Forks resolve to the longest valid chain, as
+// far as the Blockchain permits reorganization.
+type Sync struct {
+	Chain *chain.Blockchain
+
+	Batch int // blocks per request, default 64
+
+	// OnFork observes each fork detected, with the height of divergence.
+	OnFork func(p *Peer, height uint64, err error)
+
+	Log *slog.Logger // nil for slog.Default
+}
+
+func (s *Sync) log() *slog.Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return slog.Default()
+}
+
+func (s *Sync) batch() int {
+	if s.Batch > 0 {
+		return s.Batch
+	}
+	return 64
+}
+
+func (s *Sync) fork(p *Peer, height uint64, err error) error {
+	s.log().Warn("ledger fork detected", "peer", p, "height", height, "error", err)
+	if s.OnFork != nil {
+		s.OnFork(p, height, err)
+	}
+	return err
+}
+
+// Deliver is a Gossip.Deliver for operations and blocks. Operations become
+// pending on the Blockchain. Blocks are added when they extend the head.
+// Blocks ahead of the head get ErrBehind.
+func (s *Sync) Deliver(from *Peer, m *Message) error {
+	ctx := context.Background()
+	switch m.Kind {
+	case KindOperation:
+		_, err := idchain.Submit(ctx, s.Chain, string(m.Payload))
+		return err
+
+	case KindBlock:
+		b := new(chain.Block)
+		if err := json.Unmarshal(m.Payload, b); err != nil {
+			return fmt.Errorf("block announcement: %w", err)
+		}
+		n := s.Chain.Len()
+		switch {
+		case b.Height > n:
+			return fmt.Errorf("%w: block %d on chain of %d blocks", ErrBehind, b.Height, n)
+		case b.Height < n:
+			local, err := s.Chain.Block(b.Height)
+			if err != nil {
+				return err
+			}
+			if local.Hash() == b.Hash() {
+				return errors.New("block announced before")
+			}
+			return s.fork(from, b.Height, fmt.Errorf("%w: block %d is %s, announced %s", chain.ErrFork, b.Height, local.Hash(), b.Hash()))
+		}
+		err := s.Chain.AddBlock(ctx, b)
+		if errors.Is(err, chain.ErrLink) {
+			return s.fork(from, b.Height, fmt.Errorf("%w: %w", chain.ErrFork, err))
+		}
+		return err
+
+	default:
+		return fmt.Errorf("gossip message kind %q unknown", m.Kind)
+	}
+}
+
+// Serve answers the requests of Pull on conn until conn fails or ctx is done.
+func (s *Sync) Serve(ctx context.Context, conn Conn) error {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	for {
+		var req syncRequest
+		if err := readJSONFrame(conn, &req); err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var resp syncResponse
+		for i := 0; i < min(req.Count, s.batch()); i++ {
+			b, err := s.Chain.Block(req.From + uint64(i))
+			if err != nil {
+				break // end of chain
+			}
+			resp.Blocks = append(resp.Blocks, b)
+		}
+		resp.Len = s.Chain.Len()
+		if head := s.Chain.Head(); head != nil {
+			resp.Head = head.Hash()
+		}
+		if err := writeJSONFrame(conn, &resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Sync) request(conn Conn, from uint64, count int) (*syncResponse, error) {
+	if err := writeJSONFrame(conn, &syncRequest{From: from, Count: count}); err != nil {
+		return nil, err
+	}
+	resp := new(syncResponse)
+	if err := readJSONFrame(conn, resp); err != nil {
+		return nil, fmt.Errorf("sync response from peer %s: %w", conn.Peer().ID, err)
+	}
+	return resp, nil
+}
+
+// Pull downloads the blocks of the peer on conn beyond the local chain. When
+// the chains diverge, the peer chain replaces the local blocks from the last
+// common block on, granted it is longer. The peer must Serve conn.
+func (s *Sync) Pull(ctx context.Context, conn Conn) error {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	status, err := s.request(conn, 0, 0)
+	if err != nil {
+		return err
+	}
+	local := s.Chain.Len()
+	if status.Len <= local {
+		if status.Len == 0 {
+			return nil
+		}
+		b, err := s.Chain.Block(status.Len - 1)
+		if err != nil {
+			return err
+		}
+		if b.Hash() != status.Head {
+			return s.fork(conn.Peer(), status.Len-1, fmt.Errorf("%w: peer chain of %d blocks is not longer", chain.ErrFork, status.Len))
+		}
+		return nil // peer has a prefix of the local chain
+	}
+
+	common, err := s.commonLen(conn, min(local, status.Len))
+	if err != nil {
+		return err
+	}
+	if common < local {
+		s.fork(conn.Peer(), common, fmt.Errorf("%w: chains diverge after %d blocks", chain.ErrFork, common))
+	}
+
+	var replacement []*chain.Block
+	for from := common; from < status.Len; {
+		resp, err := s.request(conn, from, s.batch())
+		if err != nil {
+			return err
+		}
+		if len(resp.Blocks) == 0 {
+			return fmt.Errorf("peer %s has no block at height %d", conn.Peer().ID, from)
+		}
+		for _, b := range resp.Blocks {
+			if b.Height != from {
+				return fmt.Errorf("peer %s sent block %d for height %d", conn.Peer().ID, b.Height, from)
+			}
+			if common < local {
+				replacement = append(replacement, b)
+			} else if err := s.Chain.AddBlock(ctx, b); err != nil {
+				return fmt.Errorf("block %d from peer %s: %w", b.Height, conn.Peer().ID, err)
+			}
+			from++
+		}
+	}
+	if replacement != nil {
+		if err := s.Chain.Reorganize(ctx, replacement); err != nil {
+			return fmt.Errorf("reorganization to chain of peer %s: %w", conn.Peer().ID, err)
+		}
+		s.log().Info("ledger reorganized", "peer", conn.Peer(), "from", common, "len", s.Chain.Len())
+	}
+	return nil
+}
+
+// CommonLen returns the number of leading blocks shared with the peer, with
+// n as an upper bound.
+func (s *Sync) commonLen(conn Conn, n uint64) (uint64, error) {
+	matches := func(height uint64) (bool, error) {
+		resp, err := s.request(conn, height, 1)
+		if err != nil {
+			return false, err
+		}
+		if len(resp.Blocks) != 1 {
+			return false, fmt.Errorf("peer %s has no block at height %d", conn.Peer().ID, height)
+		}
+		local, err := s.Chain.Block(height)
+		if err != nil {
+			return false, err
+		}
+		return local.Hash() == resp.Blocks[0].Hash(), nil
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if ok, err := matches(n - 1); err != nil || ok {
+		return n, err
+	}
+	// binary search for the first mismatch, as blocks link to their predecessor
+	low, high := uint64(0), n-1
+	for low < high {
+		mid := low + (high-low)/2
+		ok, err := matches(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+func writeJSONFrame(w io.Writer, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(body)), uint32(len(body)))
+	_, err = w.Write(append(buf, body...))
+	return err
+}
+
+func readJSONFrame(r io.Reader, v any) error {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(head[:])
+	if size > SyncFrameMax {
+		return fmt.Errorf("sync frame of %d bytes exceeds limit", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,284 @@
+package p2p
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// TLS is a Transport with mutual TLS 1.3. Peers identify by certificate
+// rather than by host name, as node addresses tend to change.
+//
+// A certificate may bind to a DID with a URI subject alternative name, which
+// holds the DID URL of an authentication method. When Resolver is set, such
+// bindings must match the public key in the DID document. Without Roots,
+// peers need a DID binding, and self-signed certificates are accepted.
+type TLS struct {
+	// Certificate returns the chain of the local node. It is called on each
+	// handshake, which permits certificate rotation. See CertReloader.
+	Certificate func() (*tls.Certificate, error)
+
+	// Roots has the certificate authorities for peers.
+	Roots *x509.CertPool
+
+	// Resolver enables DID binding verification.
+	Resolver backend.Resolver
+
+	Log         *slog.Logger // nil for slog.Default
+	OnHandshake HandshakeFunc
+}
+
+func (t *TLS) log() *slog.Logger {
+	if t.Log != nil {
+		return t.Log
+	}
+	return slog.Default()
+}
+
+// Config binds DID resolution to ctx.
+func (t *TLS) config(ctx context.Context) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return t.Certificate()
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return t.Certificate()
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+		// verification by peer identity instead of host name
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return t.verify(ctx, cs)
+		},
+	}
+}
+
+// Verify is the tls.Config VerifyConnection.
+func (t *TLS) verify(ctx context.Context, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: no certificate", ErrPeer)
+	}
+	leaf := cs.PeerCertificates[0]
+	keyID, hasDID, err := certKeyID(leaf)
+	if err != nil {
+		return err
+	}
+
+	if t.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         t.Roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPeer, err)
+		}
+	} else {
+		if !hasDID || t.Resolver == nil {
+			return fmt.Errorf("%w: certificate without authority needs a DID binding", ErrPeer)
+		}
+		now := time.Now()
+		if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return fmt.Errorf("%w: certificate not valid at %s", ErrPeer, now.Format(time.RFC3339))
+		}
+		if err := leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+			return fmt.Errorf("%w: self-signed certificate: %w", ErrPeer, err)
+		}
+	}
+
+	if hasDID && t.Resolver != nil {
+		if err := VerifyDIDBinding(ctx, t.Resolver, keyID, leaf.PublicKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CertKeyID returns the DID URL binding of a certificate, if any.
+func certKeyID(cert *x509.Certificate) (keyID *backend.URL, ok bool, err error) {
+	for _, u := range cert.URIs {
+		if u.Scheme != "did" {
+			continue
+		}
+		keyID, err := backend.ParseURL(u.String())
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: certificate DID binding: %w", ErrPeer, err)
+		}
+		return keyID, true, nil
+	}
+	return nil, false, nil
+}
+
+// VerifyDIDBinding checks that pub is the key of keyID, and that keyID is an
+// authentication method of its DID.
+func VerifyDIDBinding(ctx context.Context, resolver backend.Resolver, keyID *backend.URL, pub crypto.PublicKey) error {
+	doc, _, err := resolver.Resolve(ctx, keyID.DID)
+	if err != nil {
+		return fmt.Errorf("peer DID resolution: %w", err)
+	}
+	m := doc.AuthorizedMethod(doc.Authentication, keyID)
+	if m == nil {
+		return fmt.Errorf("%w: no authentication method %s in DID document", ErrPeer, keyID.String())
+	}
+	want, err := keys.MethodKey(m)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPeer, err)
+	}
+	k, ok := want.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !k.Equal(pub) {
+		return fmt.Errorf("%w: key of %s does not match", ErrPeer, keyID.String())
+	}
+	return nil
+}
+
+// PeerOf returns the identity of a verified connection state.
+func peerOf(cs tls.ConnectionState) (*Peer, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("%w: no certificate", ErrPeer)
+	}
+	leaf := cs.PeerCertificates[0]
+	p := &Peer{ID: leaf.Subject.String(), Transport: "tls"}
+	keyID, ok, err := certKeyID(leaf)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		p.ID = keyID.String()
+		p.DID = keyID.DID
+	}
+	return p, nil
+}
+
+type tlsConn struct {
+	*tls.Conn
+	peer *Peer
+}
+
+// Peer implements the Conn interface.
+func (c *tlsConn) Peer() *Peer { return c.peer }
+
+func (t *TLS) handshake(ctx context.Context, conn *tls.Conn) (Conn, error) {
+	err := conn.HandshakeContext(ctx)
+	var p *Peer
+	if err == nil {
+		p, err = peerOf(conn.ConnectionState())
+	}
+	if t.OnHandshake != nil {
+		t.OnHandshake(p, err)
+	}
+	if err != nil {
+		t.log().Warn("peer handshake failed", "remote", conn.RemoteAddr().String(), "transport", "tls", "error", err)
+		conn.Close()
+		return nil, err
+	}
+	t.log().Info("peer connected", "peer", p, "remote", conn.RemoteAddr().String())
+	return &tlsConn{conn, p}, nil
+}
+
+// Client implements the Transport interface.
+func (t *TLS) Client(ctx context.Context, raw net.Conn) (Conn, error) {
+	return t.handshake(ctx, tls.Client(raw, t.config(ctx)))
+}
+
+// Server implements the Transport interface.
+func (t *TLS) Server(ctx context.Context, raw net.Conn) (Conn, error) {
+	return t.handshake(ctx, tls.Server(raw, t.config(ctx)))
+}
+
+// CertReloader reads a certificate chain and its key from PEM files, and it
+// reloads them once the certificate file changes. Replace the key file before
+// the certificate file for a consistent rotation.
+type CertReloader struct {
+	CertFile, KeyFile string
+
+	mutex   sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// ReloadInterval is the minimum time between file checks.
+const ReloadInterval = time.Second
+
+// Certificate returns the current chain. It fits TLS.Certificate.
+func (r *CertReloader) Certificate() (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if r.cert != nil && now.Sub(r.checked) < ReloadInterval {
+		return r.cert, nil
+	}
+	r.checked = now
+
+	info, err := os.Stat(r.CertFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil // keep serving during rotation
+		}
+		return nil, err
+	}
+	if r.cert != nil && info.ModTime().Equal(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil // retry on next check
+		}
+		return nil, err
+	}
+	r.cert, r.modTime = &cert, info.ModTime()
+	return r.cert, nil
+}
+
+// NewDIDCertificate returns a self-signed certificate for key, bound to the
+// authentication method keyID.
+func NewDIDCertificate(keyID *backend.URL, key crypto.Signer, validity time.Duration) (*tls.Certificate, error) {
+	u, err := url.Parse(keyID.String())
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: keyID.DID.String()},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validity),
+		URIs:         []*url.URL{u},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Option is a parse policy for ParseWith. Deployments may restrict the DID URL
+// syntax further than the W3C does, without a parser of their own.
+type Option func(*parsePolicy)
+
+type parsePolicy struct {
+	maxLen           int  // zero for unlimited
+	noEmptySegments  bool // no two consecutive slashes
+	utf8SpecID       bool // decoded method-specific identifier
+	rejectsRelatives bool
+}
+
+// MaxLength denies input of more than n bytes, before any parsing. The limit
+// does not apply when n is not positive.
+func MaxLength(n int) Option {
+	return func(p *parsePolicy) { p.maxLen = n }
+}
+
+// RejectEmptySegments denies paths with empty segments, i.e., two consecutive
+// slashes ('/'). A trailing slash is permitted.
+func RejectEmptySegments() Option {
+	return func(p *parsePolicy) { p.noEmptySegments = true }
+}
+
+// RequireUTF8 denies method-specific identifiers which are not valid UTF-8
+// once percent-decoded.
+func RequireUTF8() Option {
+	return func(p *parsePolicy) { p.utf8SpecID = true }
+}
+
+// AllowRelative permits relative DID URLs [URL.IsRelative] when ok, which is
+// the default.
+func AllowRelative(ok bool) Option {
+	return func(p *parsePolicy) { p.rejectsRelatives = !ok }
+}
+
+// Strict applies the W3C syntax to the letter: relative DID URLs are denied,
+// and method-specific identifiers must decode into UTF-8.
+func Strict() Option {
+	return func(p *parsePolicy) {
+		p.rejectsRelatives = true
+		p.utf8SpecID = true
+	}
+}
+
+// ParseWith is ParseURL with policies applied in order. Syntax errors are of
+// type *SyntaxError. Policy violations wrap ErrInvalid.
+func ParseWith(s string, opts ...Option) (*URL, error) {
+	var p parsePolicy
+	for _, o := range opts {
+		o(&p)
+	}
+
+	if p.maxLen > 0 && len(s) > p.maxLen {
+		return nil, fmt.Errorf("%w: DID URL of %d bytes exceeds limit of %d", ErrInvalid, len(s), p.maxLen)
+	}
+	u, err := ParseURL(s)
+	if err != nil {
+		return nil, err
+	}
+	if p.rejectsRelatives && u.IsRelative() {
+		return nil, fmt.Errorf("%w: relative DID URL %q", ErrInvalid, s)
+	}
+	if p.noEmptySegments && strings.Contains(u.RawPath, "//") {
+		return nil, fmt.Errorf("%w: DID URL %q has an empty path segment", ErrInvalid, s)
+	}
+	if p.utf8SpecID && !utf8.ValidString(u.SpecID) {
+		return nil, fmt.Errorf("%w: DID %q has a method-specific identifier which is not UTF-8", ErrInvalid, u.DID.String())
+	}
+	return u, nil
+}
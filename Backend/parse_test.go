@@ -0,0 +1,44 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseWith(t *testing.T) {
+	tests := []struct {
+		s    string
+		opts []Option
+		ok   bool
+	}{
+		{"did:example:123/a//b", nil, true},
+		{"did:example:123/a//b", []Option{RejectEmptySegments()}, false},
+		{"did:example:123/a/b/", []Option{RejectEmptySegments()}, true},
+		{"did:example:%FF", nil, true},
+		{"did:example:%FF", []Option{RequireUTF8()}, false},
+		{"did:example:%E2%9C%A8", []Option{RequireUTF8()}, true},
+		{"#key-1", nil, true},
+		{"#key-1", []Option{AllowRelative(false)}, false},
+		{"#key-1", []Option{Strict(), AllowRelative(true)}, true},
+		{"did:example:%FF", []Option{Strict()}, false},
+		{"did:example:123", []Option{MaxLength(15)}, true},
+		{"did:example:123", []Option{MaxLength(14)}, false},
+		{"did:example:123", []Option{MaxLength(14), MaxLength(0)}, true},
+	}
+	for _, test := range tests {
+		u, err := ParseWith(test.s, test.opts...)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%s with %d options got error: %s", test.s, len(test.opts), err)
+		case test.ok && u.String() != test.s:
+			t.Errorf("%s with %d options got %s", test.s, len(test.opts), u)
+		case !test.ok && !errors.Is(err, ErrInvalid):
+			t.Errorf("%s with %d options got error %v, want ErrInvalid", test.s, len(test.opts), err)
+		}
+	}
+
+	var syntaxErr *SyntaxError
+	if _, err := ParseWith("did:X:1", Strict()); !errors.As(err, &syntaxErr) {
+		t.Errorf("syntax error got %T", err)
+	}
+}
@@ -0,0 +1,251 @@
+// Package pkcs11 signs with keys in PKCS #11 tokens, such as HSMs and smart
+// cards. The package has no cgo dependency. Instead, Token is the subset of a
+// session in use, which a binding such as github.com/miekg/pkcs11 satisfies
+// with a small shim. Private keys never leave the token.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Attribute types (CKA_*) in use
+const (
+	AttrClass    uint = 0x000 // CKA_CLASS
+	AttrLabel    uint = 0x003 // CKA_LABEL
+	AttrKeyType  uint = 0x100 // CKA_KEY_TYPE
+	AttrID       uint = 0x102 // CKA_ID
+	AttrECParams uint = 0x180 // CKA_EC_PARAMS
+	AttrECPoint  uint = 0x181 // CKA_EC_POINT
+)
+
+// Object classes (CKO_*) in use
+const (
+	ClassPublicKey  uint = 2 // CKO_PUBLIC_KEY
+	ClassPrivateKey uint = 3 // CKO_PRIVATE_KEY
+)
+
+// Mechanisms (CKM_*) in use
+const (
+	MechanismECDSA uint = 0x1041 // CKM_ECDSA, over a digest
+	MechanismEdDSA uint = 0x1057 // CKM_EDDSA, over the message
+)
+
+// ErrNotFound signals a label without key pair on the token.
+var ErrNotFound = errors.New("PKCS #11 key not found")
+
+// ErrKey signals a key which is not supported, or which is malformed.
+var ErrKey = errors.New("PKCS #11 key not supported")
+
+// Object is a handle of a token object (CK_OBJECT_HANDLE).
+type Object uint
+
+// Token is a logged-in session. Attribute values are in their PKCS #11 byte
+// encoding, with CK_ULONG as 8 bytes in native byte order (as on 64-bit Unix).
+// Implementations must be safe for concurrent use.
+type Token interface {
+	// FindObjects returns the objects which match all attributes of the
+	// template (C_FindObjectsInit, C_FindObjects and C_FindObjectsFinal).
+	FindObjects(template map[uint][]byte) ([]Object, error)
+
+	// Attribute returns the value of an attribute (C_GetAttributeValue).
+	Attribute(o Object, attr uint) ([]byte, error)
+
+	// Sign signs data with the private key (C_SignInit and C_Sign).
+	Sign(mechanism uint, key Object, data []byte) ([]byte, error)
+}
+
+// Ulong returns the CK_ULONG encoding of v, as in templates.
+func Ulong(v uint) []byte {
+	return binary.NativeEndian.AppendUint64(nil, uint64(v))
+}
+
+// Curve object identifiers in CKA_EC_PARAMS
+var (
+	oidP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidP384      = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidP521      = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+	oidSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	oidEd25519   = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// Labels returns the label of each private key on the token.
+func Labels(t Token) ([]string, error) {
+	objects, err := t.FindObjects(map[uint][]byte{AttrClass: Ulong(ClassPrivateKey)})
+	if err != nil {
+		return nil, fmt.Errorf("PKCS #11 key discovery: %w", err)
+	}
+	labels := make([]string, 0, len(objects))
+	for _, o := range objects {
+		label, err := t.Attribute(o, AttrLabel)
+		if err != nil {
+			return nil, fmt.Errorf("PKCS #11 key label: %w", err)
+		}
+		labels = append(labels, string(label))
+	}
+	return labels, nil
+}
+
+// Signer is a crypto.Signer with a private key on a token.
+type Signer struct {
+	token Token
+	key   Object
+	pub   crypto.PublicKey
+}
+
+// FindKey returns the private key with label. The public key comes from the
+// public key object with the same CKA_ID, or with the same label when the
+// private key has no CKA_ID.
+func FindKey(t Token, label string) (*Signer, error) {
+	private, err := findOne(t, ClassPrivateKey, AttrLabel, []byte(label))
+	if err != nil {
+		return nil, err
+	}
+	public, err := findOne(t, ClassPublicKey, AttrLabel, []byte(label))
+	if id, idErr := t.Attribute(private, AttrID); idErr == nil && len(id) != 0 {
+		public, err = findOne(t, ClassPublicKey, AttrID, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := t.Attribute(public, AttrECParams)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS #11 key %q parameters: %w", label, err)
+	}
+	point, err := t.Attribute(public, AttrECPoint)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS #11 key %q point: %w", label, err)
+	}
+	pub, err := publicKey(params, point)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrKey, label, err)
+	}
+	return &Signer{token: t, key: private, pub: pub}, nil
+}
+
+func findOne(t Token, class, attr uint, value []byte) (Object, error) {
+	objects, err := t.FindObjects(map[uint][]byte{AttrClass: Ulong(class), attr: value})
+	if err != nil {
+		return 0, fmt.Errorf("PKCS #11 key discovery: %w", err)
+	}
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("%w: no object of class %d with attribute %#x %q", ErrNotFound, class, attr, value)
+	case 1:
+		return objects[0], nil
+	}
+	return 0, fmt.Errorf("%w: %d objects of class %d with attribute %#x %q", ErrKey, len(objects), class, attr, value)
+}
+
+// PublicKey decodes CKA_EC_PARAMS and CKA_EC_POINT.
+func publicKey(params, point []byte) (crypto.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		// PKCS #11 3.0 permits a curve name for Edwards curves
+		var name string
+		if _, err := asn1.UnmarshalWithParams(params, &name, "printable"); err != nil || name != "edwards25519" {
+			return nil, fmt.Errorf("curve parameters unknown")
+		}
+		oid = oidEd25519
+	}
+	// The point is a DER octet string, although some tokens omit the wrapping.
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) != 0 {
+		raw = point
+	}
+
+	switch {
+	case oid.Equal(oidEd25519):
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Ed25519 point of %d bytes", len(raw))
+		}
+		return ed25519.PublicKey(raw), nil
+	case oid.Equal(oidSecp256k1):
+		if len(raw) != 65 || raw[0] != 4 {
+			return nil, fmt.Errorf("secp256k1 point not uncompressed")
+		}
+		compressed := append([]byte{2 | raw[64]&1}, raw[1:33]...)
+		return didkey.Secp256k1PublicKey(compressed), nil
+	}
+	var curve elliptic.Curve
+	var ec ecdh.Curve
+	switch {
+	case oid.Equal(oidP256):
+		curve, ec = elliptic.P256(), ecdh.P256()
+	case oid.Equal(oidP384):
+		curve, ec = elliptic.P384(), ecdh.P384()
+	case oid.Equal(oidP521):
+		curve, ec = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("curve %s not supported", oid)
+	}
+	if _, err := ec.NewPublicKey(raw); err != nil { // validates the point
+		return nil, err
+	}
+	size := (len(raw) - 1) / 2
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(raw[1 : 1+size]),
+		Y:     new(big.Int).SetBytes(raw[1+size:]),
+	}, nil
+}
+
+// Public implements the crypto.Signer interface. The return is one of
+// ed25519.PublicKey, *ecdsa.PublicKey or didkey.Secp256k1PublicKey.
+func (s *Signer) Public() crypto.PublicKey { return s.pub }
+
+// Sign implements the crypto.Signer interface. Ed25519 signs the message with
+// a zero hash in opts, and ECDSA signs a digest with an ASN.1 DER result, like
+// the standard library. The random source is ignored, as the token has its
+// own.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := s.pub.(ed25519.PublicKey); ok {
+		if opts.HashFunc() != 0 {
+			return nil, fmt.Errorf("%w: Ed25519 with prehash", ErrKey)
+		}
+		sig, err := s.token.Sign(MechanismEdDSA, s.key, digest)
+		if err != nil {
+			return nil, fmt.Errorf("PKCS #11 signature: %w", err)
+		}
+		return sig, nil
+	}
+
+	sig, err := s.token.Sign(MechanismECDSA, s.key, digest)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS #11 signature: %w", err)
+	}
+	// the token returns r ‖ s, each the size of the order
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("PKCS #11 ECDSA signature of %d bytes", len(sig))
+	}
+	r := new(big.Int).SetBytes(sig[:len(sig)/2])
+	ss := new(big.Int).SetBytes(sig[len(sig)/2:])
+	if _, ok := s.pub.(didkey.Secp256k1PublicKey); ok {
+		// normalize to the lower half, as keys.Secp256k1PrivateKey
+		if ss.Cmp(new(big.Int).Rsh(secp256k1.Params().N, 1)) > 0 {
+			ss.Sub(secp256k1.Params().N, ss)
+		}
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, ss})
+}
+
+// Method returns a verification method with the public key of s.
+func (s *Signer) Method(id backend.URL, controller backend.DID, format string) (*backend.VerificationMethod, error) {
+	return keys.NewMethod(id, controller, s.pub, format)
+}
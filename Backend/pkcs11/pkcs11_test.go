@@ -0,0 +1,157 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// SoftToken mimics a token with software keys.
+type softToken struct {
+	attrs []map[uint][]byte // by object handle
+	keys  map[Object]crypto.Signer
+}
+
+func (t *softToken) add(label string, id []byte, key crypto.Signer, params, point []byte) {
+	if t.keys == nil {
+		t.keys = make(map[Object]crypto.Signer)
+	}
+	t.keys[Object(len(t.attrs))] = key
+	t.attrs = append(t.attrs,
+		map[uint][]byte{AttrClass: Ulong(ClassPrivateKey), AttrLabel: []byte(label), AttrID: id},
+		map[uint][]byte{AttrClass: Ulong(ClassPublicKey), AttrLabel: []byte(label), AttrID: id,
+			AttrECParams: params, AttrECPoint: point})
+}
+
+func (t *softToken) FindObjects(template map[uint][]byte) ([]Object, error) {
+	var objects []Object
+next:
+	for i, attrs := range t.attrs {
+		for attr, v := range template {
+			if !bytes.Equal(attrs[attr], v) {
+				continue next
+			}
+		}
+		objects = append(objects, Object(i))
+	}
+	return objects, nil
+}
+
+func (t *softToken) Attribute(o Object, attr uint) ([]byte, error) {
+	v, ok := t.attrs[o][attr]
+	if !ok {
+		return nil, fmt.Errorf("CKR_ATTRIBUTE_TYPE_INVALID")
+	}
+	return v, nil
+}
+
+func (t *softToken) Sign(mechanism uint, o Object, data []byte) ([]byte, error) {
+	key := t.keys[o]
+	switch mechanism {
+	case MechanismEdDSA:
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	case MechanismECDSA:
+		der, err := key.Sign(rand.Reader, data, crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		var sig struct{ R, S *big.Int }
+		asn1.Unmarshal(der, &sig)
+		size := 32
+		if k, ok := key.(*ecdsa.PrivateKey); ok {
+			size = (k.Curve.Params().BitSize + 7) / 8
+		} else {
+			sig.S.Sub(secp256k1.Params().N, sig.S) // high S, as HSMs may do
+		}
+		return append(sig.R.FillBytes(make([]byte, size)), sig.S.FillBytes(make([]byte, size))...), nil
+	}
+	return nil, fmt.Errorf("CKR_MECHANISM_INVALID")
+}
+
+func octets(b []byte) []byte {
+	der, _ := asn1.Marshal(b)
+	return der
+}
+
+func TestFindKey(t *testing.T) {
+	token := new(softToken)
+
+	ec, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ecPoint, _ := ec.PublicKey.ECDH()
+	ecParams, _ := asn1.Marshal(oidP384)
+	token.add("issuer", []byte{1}, ec, ecParams, octets(ecPoint.Bytes()))
+
+	_, ed, _ := ed25519.GenerateKey(rand.Reader)
+	edParams, _ := asn1.MarshalWithParams("edwards25519", "printable")
+	token.add("auth", nil, ed, edParams, octets(ed.Public().(ed25519.PublicKey)))
+
+	k1, _ := keys.Generate(keys.Secp256k1)
+	k1Pub := k1.(*keys.Secp256k1PrivateKey).Public().(didkey.Secp256k1PublicKey)
+	k1Params, _ := asn1.Marshal(oidSecp256k1)
+	k1Parsed, err := secp256k1.ParsePubKey(k1Pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1Point := k1Parsed.SerializeUncompressed()
+	token.add("chain", []byte{3}, k1.(crypto.Signer), k1Params, k1Point) // raw point, not wrapped
+
+	labels, err := Labels(token)
+	if err != nil || len(labels) != 3 {
+		t.Fatalf("got labels %q, error %v", labels, err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	signer, err := FindKey(token, "issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil || !ecdsa.VerifyASN1(&ec.PublicKey, digest[:], sig) {
+		t.Errorf("P-384 signature invalid, error %v", err)
+	}
+
+	signer, err = FindKey(token, "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err = signer.Sign(nil, []byte("hello"), crypto.Hash(0))
+	if err != nil || !ed25519.Verify(ed.Public().(ed25519.PublicKey), []byte("hello"), sig) {
+		t.Errorf("Ed25519 signature invalid, error %v", err)
+	}
+	id := backend.URL{DID: backend.DID{Method: "example", SpecID: "hsm"}, RawFragment: "#auth"}
+	m, err := signer.Method(id, id.DID, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, err := keys.MethodKey(m); err != nil || !ed25519.PublicKey(pub.(ed25519.PublicKey)).Equal(ed.Public()) {
+		t.Errorf("verification method has key %v, error %v", pub, err)
+	}
+
+	signer, err = FindKey(token, "chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err = signer.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil || !keys.VerifySecp256k1(k1Pub, digest[:], sig) {
+		t.Errorf("secp256k1 signature invalid, error %v", err)
+	}
+
+	if _, err := FindKey(token, "nonexistent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown label got error %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,152 @@
+package proofreq
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+func TestReferenceString(t *testing.T) {
+	ref := Reference{
+		ClientID:   backend.DID{Method: "example", SpecID: "verifier"},
+		RequestURI: "https://verifier.example/request/abc",
+	}
+	const want = "openid4vp://?client_id=did%3Aexample%3Averifier&request_uri=https%3A%2F%2Fverifier.example%2Frequest%2Fabc"
+	if got := ref.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got, err := ParseReference(want)
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+	if got.ClientID != ref.ClientID || got.RequestURI != ref.RequestURI || got.Scheme != Scheme {
+		t.Errorf("parse got %+v, want %+v", got, ref)
+	}
+}
+
+func TestParseReferenceErrors(t *testing.T) {
+	for _, s := range []string{
+		"openid4vp://?request_uri=https%3A%2F%2Fverifier.example%2F",
+		"openid4vp://?client_id=did%3Aexample%3Av",
+		"openid4vp://?client_id=nodid&request_uri=https%3A%2F%2Fverifier.example%2F",
+		"openid4vp://?client_id=did%3Aexample%3Av&request_uri=file%3A%2F%2F%2Fetc%2Fpasswd",
+		"openid4vp://?client_id=did%3Aexample%3Av&client_id=did%3Aexample%3Aw&request_uri=https%3A%2F%2Fverifier.example%2F",
+	} {
+		if got, err := ParseReference(s); err == nil {
+			t.Errorf("%q got %+v, want error", s, got)
+		}
+	}
+}
+
+// NewTestVerifier returns a verifier with its DID document.
+func newTestVerifier(t *testing.T) (*Verifier, *backend.Document) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := backend.DID{Method: "example", SpecID: "verifier"}
+	keyID := backend.URL{DID: subject, RawFragment: "#key-1"}
+	m, err := jose.NewMethod(keyID, subject, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &backend.Document{
+		Subject:             subject,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		AssertionMethod: &backend.VerificationRelationship{
+			URIRefs: []*backend.URL{{RawFragment: "#key-1"}},
+		},
+	}
+	return &Verifier{KeyID: keyID, Signer: key}, doc
+}
+
+func TestRoundTrip(t *testing.T) {
+	v, doc := newTestVerifier(t)
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	v.BaseURL = srv.URL + "/present/"
+
+	definition := json.RawMessage(`{"id":"age-check","input_descriptors":[]}`)
+	ref, responses, err := v.NewRequest(definition)
+	if err != nil {
+		t.Fatal("new request error:", err)
+	}
+
+	// wallet side
+	ref, err = ParseReference(ref.String())
+	if err != nil {
+		t.Fatal("reference parse error:", err)
+	}
+	f := Fetcher{
+		Client: srv.Client(),
+		Resolver: backend.Resolve(func(d backend.DID) (*backend.Document, *backend.Meta, error) {
+			if !d.Equal(doc.Subject) {
+				return nil, nil, backend.ErrNotFound
+			}
+			return doc, new(backend.Meta), nil
+		}),
+	}
+	req, err := f.Fetch(context.Background(), ref)
+	if err != nil {
+		t.Fatal("fetch error:", err)
+	}
+	if string(req.PresentationDefinition) != string(definition) {
+		t.Errorf("got presentation definition %s, want %s", req.PresentationDefinition, definition)
+	}
+	if req.Nonce == "" {
+		t.Error("request has no nonce")
+	}
+
+	err = f.Respond(context.Background(), req, &Response{VPToken: "eyJ.test.token"})
+	if err != nil {
+		t.Fatal("respond error:", err)
+	}
+	select {
+	case resp := <-responses:
+		if resp.VPToken != "eyJ.test.token" || resp.State != req.State || resp.Request == nil || resp.Request.Nonce != req.Nonce {
+			t.Errorf("verifier got response %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("verifier got no response")
+	}
+
+	// one response per request only
+	err = f.Respond(context.Background(), req, &Response{VPToken: "again"})
+	if err == nil {
+		t.Error("second response got no error")
+	}
+}
+
+func TestFetchClientMismatch(t *testing.T) {
+	v, doc := newTestVerifier(t)
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	v.BaseURL = srv.URL + "/"
+
+	ref, _, err := v.NewRequest(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// claim someone else's identity
+	ref.ClientID = backend.DID{Method: "example", SpecID: "impostor"}
+
+	f := Fetcher{
+		Client: srv.Client(),
+		Resolver: backend.Resolve(func(backend.DID) (*backend.Document, *backend.Meta, error) {
+			return doc, new(backend.Meta), nil
+		}),
+	}
+	_, err = f.Fetch(context.Background(), ref)
+	if !errors.Is(err, ErrClientMismatch) {
+		t.Errorf("got error %v, want ErrClientMismatch", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package proofreq implements connectionless presentation requests. A verifier
+// publishes a signed request object, and it hands out a reference URL (on a web
+// page or in a QR code) for wallets to fetch it by. Wallets post the response
+// directly to the verifier. No prior DIDComm connection is needed.
+//
+// The wire format follows OpenID for Verifiable Presentations, with the
+// "request_uri" reference from RFC 9101, and with the "did" client identifier
+// scheme.
+package proofreq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Scheme is the default for reference URLs.
+const Scheme = "openid4vp"
+
+// MediaType is the content type of a signed request object.
+const MediaType = "application/oauth-authz-req+jwt"
+
+// Request is the payload of a signed request object.
+type Request struct {
+	Issuer   string `json:"iss"` // equals ClientID
+	Audience string `json:"aud,omitempty"`
+
+	ClientID       string `json:"client_id"`        // verifier DID
+	ClientIDScheme string `json:"client_id_scheme"` // "did"
+	ResponseType   string `json:"response_type"`    // "vp_token"
+	ResponseMode   string `json:"response_mode"`    // "direct_post"
+	ResponseURI    string `json:"response_uri"`
+	Nonce          string `json:"nonce"`
+	State          string `json:"state,omitempty"`
+
+	// The presentation definition is passed as is.
+	PresentationDefinition json.RawMessage `json:"presentation_definition,omitempty"`
+
+	IssuedAt int64 `json:"iat"`           // Unix time
+	Expires  int64 `json:"exp,omitempty"` // Unix time
+}
+
+// Expired returns whether the request is past its expiry at t.
+func (r *Request) Expired(t time.Time) bool {
+	return r.Expires != 0 && t.Unix() >= r.Expires
+}
+
+// Reference is the out-of-band link to a request object.
+type Reference struct {
+	// Scheme defaults to the Scheme constant when zero.
+	Scheme string
+	// ClientID has the DID of the verifier.
+	ClientID backend.DID
+	// RequestURI locates the signed request object.
+	RequestURI string
+}
+
+// String returns the URL encoding.
+func (ref *Reference) String() string {
+	scheme := ref.Scheme
+	if scheme == "" {
+		scheme = Scheme
+	}
+	params := make(url.Values, 2)
+	params.Set("client_id", ref.ClientID.String())
+	params.Set("request_uri", ref.RequestURI)
+	return scheme + "://?" + params.Encode()
+}
+
+// ParseReference decodes a reference URL. Any scheme is accepted, including
+// HTTPS for links which fall back to a web page without a wallet installed.
+func ParseReference(s string) (*Reference, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		var wrap *url.Error // not useful
+		if errors.As(err, &wrap) {
+			err = wrap.Err // trim
+		}
+		return nil, fmt.Errorf("malformed presentation request reference: %w", err)
+	}
+	params := u.Query()
+
+	var ref Reference
+	ref.Scheme = u.Scheme
+	switch a := params["client_id"]; len(a) {
+	case 0:
+		return nil, errors.New("presentation request reference has no client_id")
+	case 1:
+		ref.ClientID, err = backend.Parse(a[0])
+		if err != nil {
+			return nil, fmt.Errorf("presentation request reference client_id: %w", err)
+		}
+	default:
+		return nil, errors.New("duplicate client_id in presentation request reference")
+	}
+
+	switch a := params["request_uri"]; len(a) {
+	case 0:
+		return nil, errors.New("presentation request reference has no request_uri")
+	case 1:
+		ref.RequestURI = a[0]
+	default:
+		return nil, errors.New("duplicate request_uri in presentation request reference")
+	}
+	if !strings.HasPrefix(ref.RequestURI, "https://") && !strings.HasPrefix(ref.RequestURI, "http://") {
+		return nil, fmt.Errorf("presentation request_uri %q is not an HTTP URL", ref.RequestURI)
+	}
+	return &ref, nil
+}
+
+// Response is the direct post of a wallet.
+type Response struct {
+	// State matches the request.
+	State string
+	// VPToken has the presentation(s) in encoded form.
+	VPToken string
+	// PresentationSubmission maps the definition to the presentation(s).
+	PresentationSubmission json.RawMessage
+
+	// Request is the request object answered. Verifier sets it for the
+	// validation of the nonce and the audience.
+	Request *Request
+}
@@ -0,0 +1,221 @@
+package proofreq
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// DefaultTTL is the lifespan of requests when not configured otherwise.
+const DefaultTTL = 5 * time.Minute
+
+// ResponseMax is the upper boundary for response posts in bytes.
+const ResponseMax = 1 << 20
+
+// Verifier publishes request objects, and it collects the responses with
+// ServeHTTP. Multiple goroutines may invoke methods on a Verifier
+// simultaneously.
+type Verifier struct {
+	// KeyID is the DID URL of the verification method from Signer. The
+	// method must be an assertion method (or an authentication method) of
+	// the verifier DID.
+	KeyID  backend.URL
+	Signer crypto.Signer
+
+	// BaseURL is the public location of the ServeHTTP handler, with a
+	// trailing slash, e.g., "https://verifier.example/present/".
+	BaseURL string
+
+	// TTL is the lifespan of requests. Zero defaults to DefaultTTL.
+	TTL time.Duration
+
+	mutex   sync.Mutex
+	pending map[string]*pending // by identifier
+}
+
+type pending struct {
+	request       *Request
+	requestObject string // JWS compact serialization
+	expires       time.Time
+	responses     chan *Response // buffered for 1
+}
+
+// NewRequest publishes a signed request object for the presentation
+// definition. The channel receives at most one response. It is never closed,
+// so callers should apply a timeout of their own.
+func (v *Verifier) NewRequest(definition json.RawMessage) (*Reference, <-chan *Response, error) {
+	id, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	ttl := v.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	client := v.KeyID.DID.String()
+	req := Request{
+		Issuer:                 client,
+		ClientID:               client,
+		ClientIDScheme:         "did",
+		ResponseType:           "vp_token",
+		ResponseMode:           "direct_post",
+		ResponseURI:            v.BaseURL + "response/" + id,
+		Nonce:                  nonce,
+		State:                  id,
+		PresentationDefinition: definition,
+		IssuedAt:               now.Unix(),
+		Expires:                expires.Unix(),
+	}
+	payload, err := json.Marshal(&req)
+	if err != nil {
+		return nil, nil, err
+	}
+	requestObject, err := jose.Sign(jose.Header{
+		Kid: v.KeyID.String(),
+		Typ: "oauth-authz-req+jwt",
+	}, payload, v.Signer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &pending{
+		request:       &req,
+		requestObject: requestObject,
+		expires:       expires,
+		responses:     make(chan *Response, 1),
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.pending == nil {
+		v.pending = make(map[string]*pending)
+	}
+	for id, p := range v.pending {
+		if now.After(p.expires) {
+			delete(v.pending, id)
+		}
+	}
+	v.pending[id] = p
+
+	ref := &Reference{
+		ClientID:   v.KeyID.DID,
+		RequestURI: v.BaseURL + "request/" + id,
+	}
+	return ref, p.responses, nil
+}
+
+// ServeHTTP implements the http.Handler interface. Requests are served with
+// GET on "request/{id}", and responses are accepted with POST on
+// "response/{id}", relative to the BaseURL.
+func (v *Verifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	i := strings.LastIndexByte(p, '/')
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	id := p[i+1:]
+	p = p[:i]
+
+	switch {
+	case strings.HasSuffix(p, "/request"):
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		v.serveRequest(w, id)
+
+	case strings.HasSuffix(p, "/response"):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		v.serveResponse(w, r, id)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (v *Verifier) serveRequest(w http.ResponseWriter, id string) {
+	v.mutex.Lock()
+	p, ok := v.pending[id]
+	v.mutex.Unlock()
+	if !ok || time.Now().After(p.expires) {
+		http.Error(w, "presentation request not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(p.requestObject))
+}
+
+func (v *Verifier) serveResponse(w http.ResponseWriter, r *http.Request, id string) {
+	r.Body = http.MaxBytesReader(w, r.Body, ResponseMax)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "malformed form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := Response{
+		State:   r.PostForm.Get("state"),
+		VPToken: r.PostForm.Get("vp_token"),
+	}
+	if resp.State != id {
+		http.Error(w, "state mismatch", http.StatusBadRequest)
+		return
+	}
+	if resp.VPToken == "" {
+		http.Error(w, "no vp_token", http.StatusBadRequest)
+		return
+	}
+	if s := r.PostForm.Get("presentation_submission"); s != "" {
+		if !json.Valid([]byte(s)) {
+			http.Error(w, "presentation_submission is not JSON", http.StatusBadRequest)
+			return
+		}
+		resp.PresentationSubmission = json.RawMessage(s)
+	}
+
+	// responses are accepted once
+	v.mutex.Lock()
+	p, ok := v.pending[id]
+	delete(v.pending, id)
+	v.mutex.Unlock()
+	if !ok || time.Now().After(p.expires) {
+		http.Error(w, "presentation request not found", http.StatusNotFound)
+		return
+	}
+	resp.Request = p.request
+	p.responses <- &resp
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("{}"))
+}
+
+func randomToken() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", errors.New("presentation request identifier unavailable: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
@@ -0,0 +1,155 @@
+package proofreq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// FetchMaxDefault is an upper boundary for request objects in bytes.
+const FetchMaxDefault = 1 << 16
+
+// ErrClientMismatch signals a request object which was not signed on behalf of
+// the client_id from the reference.
+var ErrClientMismatch = errors.New("presentation request not signed by client")
+
+// Fetcher retrieves request objects for wallets. Multiple goroutines may
+// invoke methods on a Fetcher simultaneously.
+type Fetcher struct {
+	// Client defaults to http.DefaultClient when nil.
+	Client *http.Client
+
+	// Resolver is required for the verification of request objects.
+	Resolver backend.Resolver
+
+	// FetchMax is the upper boundary for request objects in bytes. Zero
+	// defaults to FetchMaxDefault.
+	FetchMax int
+}
+
+func (f *Fetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+// Fetch retrieves the request object from ref, and it verifies the signature
+// against the DID document of the client.
+func (f *Fetcher) Fetch(ctx context.Context, ref *Reference) (*Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref.RequestURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("presentation request lookup: %w", err)
+	}
+	req.Header.Set("Accept", MediaType)
+
+	res, err := f.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("presentation request lookup: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %q for presentation request %s", res.Status, ref.RequestURI)
+	}
+
+	max := f.FetchMax
+	if max == 0 {
+		max = FetchMaxDefault
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, int64(max)+1))
+	if err != nil {
+		return nil, fmt.Errorf("presentation request %s unavailable: %w", ref.RequestURI, err)
+	}
+	if len(body) > max {
+		return nil, fmt.Errorf("presentation request %s exceeds %d bytes", ref.RequestURI, max)
+	}
+
+	return f.verify(ctx, strings.TrimSpace(string(body)), ref.ClientID)
+}
+
+func (f *Fetcher) verify(ctx context.Context, requestObject string, client backend.DID) (*Request, error) {
+	jws, err := jose.ParseCompact(requestObject)
+	if err != nil {
+		return nil, fmt.Errorf("presentation request object: %w", err)
+	}
+	keyID, err := backend.ParseURL(jws.Header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("presentation request object kid: %w", err)
+	}
+	if !keyID.DID.Equal(client) {
+		return nil, fmt.Errorf("%w: key %s for client %s", ErrClientMismatch, jws.Header.Kid, client)
+	}
+
+	doc, _, err := f.Resolver.Resolve(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("presentation request client: %w", err)
+	}
+	m := doc.AuthorizedMethod(doc.AssertionMethod, keyID)
+	if m == nil {
+		m = doc.AuthorizedMethod(doc.Authentication, keyID)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%w: no assertion method %s in DID document", ErrClientMismatch, jws.Header.Kid)
+	}
+	pub, err := jose.MethodKey(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := jws.Verify(pub); err != nil {
+		return nil, fmt.Errorf("presentation request object: %w", err)
+	}
+
+	var req Request
+	if err := json.Unmarshal(jws.Payload, &req); err != nil {
+		return nil, fmt.Errorf("presentation request object payload: %w", err)
+	}
+	if !client.EqualString(req.ClientID) || !client.EqualString(req.Issuer) {
+		return nil, fmt.Errorf("%w: client_id %q and iss %q for %s", ErrClientMismatch, req.ClientID, req.Issuer, client)
+	}
+	if req.ClientIDScheme != "did" {
+		return nil, fmt.Errorf("presentation request client_id_scheme %q not supported", req.ClientIDScheme)
+	}
+	if req.ResponseMode != "direct_post" {
+		return nil, fmt.Errorf("presentation request response_mode %q not supported", req.ResponseMode)
+	}
+	if req.Expired(time.Now()) {
+		return nil, errors.New("presentation request expired")
+	}
+	return &req, nil
+}
+
+// Respond posts the presentation to the verifier of req.
+func (f *Fetcher) Respond(ctx context.Context, req *Request, resp *Response) error {
+	form := make(url.Values, 3)
+	form.Set("vp_token", resp.VPToken)
+	form.Set("state", req.State)
+	if len(resp.PresentationSubmission) != 0 {
+		form.Set("presentation_submission", string(resp.PresentationSubmission))
+	}
+
+	post, err := http.NewRequestWithContext(ctx, http.MethodPost, req.ResponseURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("presentation response: %w", err)
+	}
+	post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := f.client().Do(post)
+	if err != nil {
+		return fmt.Errorf("presentation response: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %q for presentation response to %s", res.Status, req.ResponseURI)
+	}
+	return nil
+}
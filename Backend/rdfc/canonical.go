@@ -0,0 +1,343 @@
+package rdfc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+)
+
+// ErrPoison signals a dataset which exceeds the work limit of canonicalization.
+var ErrPoison = errors.New("RDF dataset canonicalization exceeds the work limit")
+
+// CallMaxDefault is the default limit on Hash N-Degree Quads invocations.
+const CallMaxDefault = 4096
+
+// Canonicalizer configures RDFC-1.0. The zero value is ready to use.
+type Canonicalizer struct {
+	// Hash defaults to SHA-256.
+	Hash func() hash.Hash
+
+	// CallMax limits the number of Hash N-Degree Quads invocations, as
+	// a defense against poison graphs. Zero defaults to CallMaxDefault.
+	CallMax int
+}
+
+// Canonicalize returns the dataset with canonical blank node labels, in the
+// code point order of the canonical N-Quads, and without duplicates. Marshal
+// produces the canonical form of the return. The input is not modified.
+func (c *Canonicalizer) Canonicalize(dataset []Quad) ([]Quad, error) {
+	// a dataset is a set
+	seen := make(map[string]bool, len(dataset))
+	var unique []Quad
+	var buf []byte
+	for _, q := range dataset {
+		buf = AppendQuad(buf[:0], &q)
+		if !seen[string(buf)] {
+			seen[string(buf)] = true
+			unique = append(unique, q)
+		}
+	}
+	dataset = unique
+
+	s := state{
+		Canonicalizer: c,
+		quads:         dataset,
+		blanks:        make(map[string][]int),
+		canonical:     newIssuer("c14n"),
+	}
+	if s.Hash == nil {
+		s.Hash = sha256.New
+	}
+	if s.CallMax == 0 {
+		s.CallMax = CallMaxDefault
+	}
+	for i := range dataset {
+		q := &dataset[i]
+		for _, t := range [...]*Term{&q.Subject, &q.Object, &q.Graph} {
+			if t.Kind == Blank {
+				ids := s.blanks[t.Value]
+				if len(ids) == 0 || ids[len(ids)-1] != i {
+					s.blanks[t.Value] = append(ids, i)
+				}
+			}
+		}
+	}
+
+	// label the blank nodes which have a unique first degree hash
+	byHash := make(map[string][]string)
+	for id := range s.blanks {
+		h := s.hashFirstDegree(id)
+		byHash[h] = append(byHash[h], id)
+	}
+	hashes := make([]string, 0, len(byHash))
+	for h := range byHash {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+	var shared []string // hashes of multiple blank nodes
+	for _, h := range hashes {
+		if len(byHash[h]) == 1 {
+			s.canonical.issue(byHash[h][0])
+		} else {
+			shared = append(shared, h)
+		}
+	}
+
+	// label the rest with their n-degree hashes
+	for _, h := range shared {
+		type result struct {
+			hash   string
+			issuer *issuer
+		}
+		var results []result
+		ids := byHash[h]
+		sort.Strings(ids) // deterministic error path only
+		for _, id := range ids {
+			if _, ok := s.canonical.issued[id]; ok {
+				continue
+			}
+			temp := newIssuer("b")
+			temp.issue(id)
+			h, issued, err := s.hashNDegree(id, temp)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result{h, issued})
+		}
+		sort.SliceStable(results, func(i, j int) bool { return results[i].hash < results[j].hash })
+		for _, r := range results {
+			for _, id := range r.issuer.order {
+				s.canonical.issue(id)
+			}
+		}
+	}
+
+	// relabel and sort
+	type line struct {
+		nquad string
+		quad  Quad
+	}
+	lines := make([]line, len(dataset))
+	for i, q := range dataset {
+		for _, t := range [...]*Term{&q.Subject, &q.Object, &q.Graph} {
+			if t.Kind == Blank {
+				t.Value = s.canonical.issued[t.Value]
+			}
+		}
+		buf = AppendQuad(buf[:0], &q)
+		lines[i] = line{string(buf), q}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].nquad < lines[j].nquad })
+	out := make([]Quad, len(lines))
+	for i, l := range lines {
+		out[i] = l.quad
+	}
+	return out, nil
+}
+
+// Canonical returns the canonical N-Quads of dataset, with the defaults of
+// Canonicalizer.
+func Canonical(dataset []Quad) ([]byte, error) {
+	quads, err := new(Canonicalizer).Canonicalize(dataset)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(quads), nil
+}
+
+// State is the canonicalization state of a single run.
+type state struct {
+	*Canonicalizer
+	quads     []Quad
+	blanks    map[string][]int // quad indices per blank node identifier
+	canonical *issuer
+	calls     int
+}
+
+func (s *state) sum(data []byte) string {
+	h := s.Hash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashFirstDegree implements Hash First Degree Quads.
+func (s *state) hashFirstDegree(id string) string {
+	nquads := make([]string, 0, len(s.blanks[id]))
+	var buf []byte
+	for _, i := range s.blanks[id] {
+		q := s.quads[i]
+		for _, t := range [...]*Term{&q.Subject, &q.Object, &q.Graph} {
+			if t.Kind == Blank {
+				if t.Value == id {
+					t.Value = "a"
+				} else {
+					t.Value = "z"
+				}
+			}
+		}
+		buf = AppendQuad(buf[:0], &q)
+		nquads = append(nquads, string(buf))
+	}
+	sort.Strings(nquads)
+	buf = buf[:0]
+	for _, l := range nquads {
+		buf = append(buf, l...)
+	}
+	return s.sum(buf)
+}
+
+// HashRelated implements Hash Related Blank Node.
+func (s *state) hashRelated(related string, q *Quad, temp *issuer, position byte) string {
+	id, ok := s.canonical.issued[related]
+	if !ok {
+		id, ok = temp.issued[related]
+	}
+	if ok {
+		id = "_:" + id
+	} else {
+		id = s.hashFirstDegree(related)
+	}
+	buf := []byte{position}
+	if position != 'g' {
+		buf = append(buf, '<')
+		buf = append(buf, q.Predicate.Value...)
+		buf = append(buf, '>')
+	}
+	buf = append(buf, id...)
+	return s.sum(buf)
+}
+
+// HashNDegree implements Hash N-Degree Quads.
+func (s *state) hashNDegree(id string, temp *issuer) (string, *issuer, error) {
+	s.calls++
+	if s.calls > s.CallMax {
+		return "", nil, fmt.Errorf("%w: %d Hash N-Degree Quads invocations", ErrPoison, s.CallMax)
+	}
+
+	related := make(map[string][]string) // blank nodes per hash
+	for _, i := range s.blanks[id] {
+		q := &s.quads[i]
+		for _, c := range [...]struct {
+			t        *Term
+			position byte
+		}{{&q.Subject, 's'}, {&q.Object, 'o'}, {&q.Graph, 'g'}} {
+			if c.t.Kind == Blank && c.t.Value != id {
+				h := s.hashRelated(c.t.Value, q, temp, c.position)
+				related[h] = append(related[h], c.t.Value)
+			}
+		}
+	}
+	hashes := make([]string, 0, len(related))
+	for h := range related {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+
+	var data []byte
+	for _, h := range hashes {
+		data = append(data, h...)
+		var chosenPath string
+		var chosenIssuer *issuer
+
+		list := related[h]
+		sort.Strings(list)
+	Permutations:
+		for perm := list; perm != nil; perm = nextPermutation(perm) {
+			issuerCopy := temp.clone()
+			var path []byte
+			var recursion []string
+			for _, r := range perm {
+				if c, ok := s.canonical.issued[r]; ok {
+					path = append(append(path, "_:"...), c...)
+				} else {
+					if _, ok := issuerCopy.issued[r]; !ok {
+						recursion = append(recursion, r)
+					}
+					path = append(append(path, "_:"...), issuerCopy.issue(r)...)
+				}
+				if chosenPath != "" && len(path) >= len(chosenPath) && string(path) > chosenPath {
+					continue Permutations
+				}
+			}
+			for _, r := range recursion {
+				result, resultIssuer, err := s.hashNDegree(r, issuerCopy)
+				if err != nil {
+					return "", nil, err
+				}
+				path = append(append(path, "_:"...), issuerCopy.issue(r)...)
+				path = append(append(append(path, '<'), result...), '>')
+				issuerCopy = resultIssuer
+				if chosenPath != "" && len(path) >= len(chosenPath) && string(path) > chosenPath {
+					continue Permutations
+				}
+			}
+			if chosenPath == "" || string(path) < chosenPath {
+				chosenPath = string(path)
+				chosenIssuer = issuerCopy
+			}
+		}
+		data = append(data, chosenPath...)
+		temp = chosenIssuer
+	}
+	return s.sum(data), temp, nil
+}
+
+// NextPermutation returns the lexicographic successor of p, or nil when p is
+// the last one. The argument is not modified.
+func nextPermutation(p []string) []string {
+	i := len(p) - 2
+	for i >= 0 && p[i] >= p[i+1] {
+		i--
+	}
+	if i < 0 {
+		return nil
+	}
+	next := append([]string(nil), p...)
+	j := len(next) - 1
+	for next[j] <= next[i] {
+		j--
+	}
+	next[i], next[j] = next[j], next[i]
+	for l, r := i+1, len(next)-1; l < r; l, r = l+1, r-1 {
+		next[l], next[r] = next[r], next[l]
+	}
+	return next
+}
+
+// Issuer is an Identifier Issuer.
+type issuer struct {
+	prefix string
+	issued map[string]string // existing to issued identifier
+	order  []string          // existing identifiers
+}
+
+func newIssuer(prefix string) *issuer {
+	return &issuer{prefix: prefix, issued: make(map[string]string)}
+}
+
+// Issue returns the identifier for existing, which is issued on first use.
+func (i *issuer) issue(existing string) string {
+	if id, ok := i.issued[existing]; ok {
+		return id
+	}
+	id := i.prefix + strconv.Itoa(len(i.order))
+	i.issued[existing] = id
+	i.order = append(i.order, existing)
+	return id
+}
+
+func (i *issuer) clone() *issuer {
+	c := &issuer{
+		prefix: i.prefix,
+		issued: make(map[string]string, len(i.issued)),
+		order:  append([]string(nil), i.order...),
+	}
+	for k, v := range i.issued {
+		c.issued[k] = v
+	}
+	return c
+}
@@ -0,0 +1,386 @@
+package rdfc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// AppendQuad appends the N-Quads statement of q in canonical form, including
+// the terminating line feed.
+func AppendQuad(buf []byte, q *Quad) []byte {
+	buf = appendTerm(buf, &q.Subject)
+	buf = append(buf, ' ')
+	buf = appendTerm(buf, &q.Predicate)
+	buf = append(buf, ' ')
+	buf = appendTerm(buf, &q.Object)
+	if q.Graph.Kind != DefaultGraph {
+		buf = append(buf, ' ')
+		buf = appendTerm(buf, &q.Graph)
+	}
+	return append(buf, " .\n"...)
+}
+
+func appendTerm(buf []byte, t *Term) []byte {
+	switch t.Kind {
+	case IRI:
+		buf = append(buf, '<')
+		buf = append(buf, t.Value...)
+		return append(buf, '>')
+	case Blank:
+		buf = append(buf, "_:"...)
+		return append(buf, t.Value...)
+	case Literal:
+		buf = append(buf, '"')
+		buf = appendEscaped(buf, t.Value)
+		buf = append(buf, '"')
+		switch {
+		case t.Language != "":
+			buf = append(buf, '@')
+			buf = append(buf, t.Language...)
+		case t.Datatype != "" && t.Datatype != XSDString:
+			buf = append(buf, "^^<"...)
+			buf = append(buf, t.Datatype...)
+			buf = append(buf, '>')
+		}
+		return buf
+	default:
+		return buf // default graph
+	}
+}
+
+// AppendEscaped applies the canonical escapes of N-Quads to a string literal,
+// i.e., an ECHAR where available, and a UCHAR for the other control
+// characters.
+func appendEscaped(buf []byte, s string) []byte {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\b':
+			buf = append(buf, `\b`...)
+		case '\t':
+			buf = append(buf, `\t`...)
+		case '\n':
+			buf = append(buf, `\n`...)
+		case '\f':
+			buf = append(buf, `\f`...)
+		case '\r':
+			buf = append(buf, `\r`...)
+		case '"':
+			buf = append(buf, `\"`...)
+		case '\\':
+			buf = append(buf, `\\`...)
+		default:
+			if c < 0x20 || c == 0x7f {
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return buf
+}
+
+// Writer serializes quads as N-Quads in canonical form.
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter returns a new Writer which writes to w. Invoke Flush when done.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write appends one statement.
+func (w *Writer) Write(q *Quad) error {
+	w.buf = AppendQuad(w.buf[:0], q)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Marshal returns the N-Quads document of quads, in order.
+func Marshal(quads []Quad) []byte {
+	var buf []byte
+	for i := range quads {
+		buf = AppendQuad(buf, &quads[i])
+	}
+	return buf
+}
+
+// ErrSyntax signals malformed N-Quads.
+var ErrSyntax = errors.New("N-Quads syntax error")
+
+// Reader parses N-Quads, one statement per line.
+type Reader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewReader returns a new Reader which reads from r.
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	return &Reader{s: s}
+}
+
+// Read returns the next statement, or io.EOF when done. Errors other than
+// from the underlying io.Reader wrap ErrSyntax.
+func (r *Reader) Read() (Quad, error) {
+	for r.s.Scan() {
+		r.line++
+		p := parser{s: r.s.Text()}
+		p.space()
+		if p.done() {
+			continue // blank or comment
+		}
+		q, err := p.quad()
+		if err != nil {
+			return Quad{}, fmt.Errorf("%w: line %d: %s", ErrSyntax, r.line, err)
+		}
+		return q, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return Quad{}, err
+	}
+	return Quad{}, io.EOF
+}
+
+// Parse returns each statement of an N-Quads document.
+func Parse(data string) ([]Quad, error) {
+	r := NewReader(strings.NewReader(data))
+	var quads []Quad
+	for {
+		q, err := r.Read()
+		if err == io.EOF {
+			return quads, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		quads = append(quads, q)
+	}
+}
+
+// Parser reads a single line.
+type parser struct {
+	s string
+	i int
+}
+
+// Done returns whether the remainder is either empty or a comment.
+func (p *parser) done() bool {
+	return p.i >= len(p.s) || p.s[p.i] == '#'
+}
+
+func (p *parser) space() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *parser) quad() (Quad, error) {
+	var q Quad
+	var err error
+	if q.Subject, err = p.term(); err != nil {
+		return q, err
+	}
+	if q.Subject.Kind == Literal {
+		return q, errors.New("literal as subject")
+	}
+	if q.Predicate, err = p.term(); err != nil {
+		return q, err
+	}
+	if q.Predicate.Kind != IRI {
+		return q, errors.New("predicate is not an IRI")
+	}
+	if q.Object, err = p.term(); err != nil {
+		return q, err
+	}
+	if p.i < len(p.s) && p.s[p.i] != '.' {
+		if q.Graph, err = p.term(); err != nil {
+			return q, err
+		}
+		if q.Graph.Kind == Literal {
+			return q, errors.New("literal as graph name")
+		}
+	}
+	if p.i >= len(p.s) || p.s[p.i] != '.' {
+		return q, errors.New(`statement not terminated by "."`)
+	}
+	p.i++
+	p.space()
+	if !p.done() {
+		return q, fmt.Errorf("trailing %q", p.s[p.i:])
+	}
+	return q, nil
+}
+
+// Term reads one term, with any trailing white space.
+func (p *parser) term() (Term, error) {
+	if p.i >= len(p.s) {
+		return Term{}, errors.New("statement incomplete")
+	}
+	var t Term
+	var err error
+	switch p.s[p.i] {
+	case '<':
+		t.Kind = IRI
+		t.Value, err = p.iri()
+	case '_':
+		t.Kind = Blank
+		t.Value, err = p.label()
+	case '"':
+		t.Kind = Literal
+		t.Value, err = p.quoted()
+		if err != nil {
+			break
+		}
+		switch {
+		case strings.HasPrefix(p.s[p.i:], "^^"):
+			p.i += 2
+			if p.i >= len(p.s) || p.s[p.i] != '<' {
+				return t, errors.New("datatype is not an IRI")
+			}
+			t.Datatype, err = p.iri()
+			if t.Datatype == XSDString {
+				t.Datatype = ""
+			}
+		case strings.HasPrefix(p.s[p.i:], "@"):
+			t.Datatype = RDFLangString
+			t.Language, err = p.langTag()
+		}
+	default:
+		return t, fmt.Errorf("unexpected %q", p.s[p.i])
+	}
+	if err != nil {
+		return t, err
+	}
+	p.space()
+	return t, nil
+}
+
+func (p *parser) iri() (string, error) {
+	p.i++ // '<'
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == '>':
+			p.i++
+			return b.String(), nil
+		case c == '\\':
+			r, err := p.uchar()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+			continue
+		case c <= ' ' || strings.IndexByte(`<"{}|^`+"`", c) >= 0:
+			return "", fmt.Errorf("illegal %q in IRI", c)
+		}
+		b.WriteByte(c)
+		p.i++
+	}
+	return "", errors.New("IRI not terminated")
+}
+
+func (p *parser) label() (string, error) {
+	if !strings.HasPrefix(p.s[p.i:], "_:") {
+		return "", errors.New(`blank node without "_:"`)
+	}
+	p.i += 2
+	start := p.i
+	for p.i < len(p.s) && p.s[p.i] != ' ' && p.s[p.i] != '\t' {
+		p.i++
+	}
+	// a label does not end with a '.'
+	for p.i > start && p.s[p.i-1] == '.' {
+		p.i--
+	}
+	if p.i == start {
+		return "", errors.New("blank node label empty")
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *parser) quoted() (string, error) {
+	p.i++ // '"'
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch c {
+		case '"':
+			p.i++
+			return b.String(), nil
+		case '\n', '\r':
+			return "", errors.New("line break in literal")
+		case '\\':
+			if p.i+1 >= len(p.s) {
+				return "", errors.New("escape incomplete")
+			}
+			if e := p.s[p.i+1]; e != 'u' && e != 'U' {
+				i := strings.IndexByte(`tbnrf"'\`, e)
+				if i < 0 {
+					return "", fmt.Errorf("illegal escape %q", e)
+				}
+				b.WriteByte("\t\b\n\r\f\"'\\"[i])
+				p.i += 2
+				continue
+			}
+			r, err := p.uchar()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte(c)
+		p.i++
+	}
+	return "", errors.New("literal not terminated")
+}
+
+// Uchar reads a \u or \U escape.
+func (p *parser) uchar() (rune, error) {
+	n := 4
+	if strings.HasPrefix(p.s[p.i:], `\U`) {
+		n = 8
+	} else if !strings.HasPrefix(p.s[p.i:], `\u`) {
+		return 0, errors.New(`illegal escape in IRI`)
+	}
+	if p.i+2+n > len(p.s) {
+		return 0, errors.New("escape incomplete")
+	}
+	v, err := strconv.ParseUint(p.s[p.i+2:p.i+2+n], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(v)) {
+		return 0, fmt.Errorf("illegal escape %q", p.s[p.i:p.i+2+n])
+	}
+	p.i += 2 + n
+	return rune(v), nil
+}
+
+func (p *parser) langTag() (string, error) {
+	p.i++ // '@'
+	start := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || p.i > start && c >= '0' && c <= '9') {
+			break
+		}
+		p.i++
+	}
+	if p.i == start {
+		return "", errors.New("language tag empty")
+	}
+	return p.s[start:p.i], nil
+}
@@ -0,0 +1,70 @@
+// Package rdfc implements the RDF Dataset Canonicalization algorithm, i.e.,
+// W3C RDFC-1.0, formerly known as URDNA2015, with N-Quads in canonical form.
+// Data Integrity proofs of the "-rdfc-" cryptosuites sign such canonical
+// N-Quads.
+package rdfc
+
+// Kind is the type of RDF term.
+type Kind uint8
+
+// RDF Term Kinds
+const (
+	DefaultGraph Kind = iota // zero Term, for graph names only
+	IRI
+	Blank
+	Literal
+)
+
+// Datatype IRIs
+const (
+	XSDString     = "http://www.w3.org/2001/XMLSchema#string"
+	XSDBoolean    = "http://www.w3.org/2001/XMLSchema#boolean"
+	XSDInteger    = "http://www.w3.org/2001/XMLSchema#integer"
+	XSDDouble     = "http://www.w3.org/2001/XMLSchema#double"
+	RDFLangString = "http://www.w3.org/1999/02/22-rdf-syntax-ns#langString"
+	RDFJSON       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#JSON"
+)
+
+// Term is an IRI, a blank node, or a literal. The zero value is the default
+// graph.
+type Term struct {
+	Kind Kind
+	// Value is either the IRI, the blank node label without its "_:"
+	// prefix, or the lexical form of the literal.
+	Value string
+	// Datatype is the IRI of a literal. The empty string is XSDString,
+	// or RDFLangString when Language is set.
+	Datatype string
+	// Language is the tag of a language-tagged string.
+	Language string
+}
+
+// NewIRI returns the IRI term.
+func NewIRI(iri string) Term { return Term{Kind: IRI, Value: iri} }
+
+// NewBlank returns the blank node term, with label excluding the "_:".
+func NewBlank(label string) Term { return Term{Kind: Blank, Value: label} }
+
+// NewLiteral returns the literal term, with an optional datatype IRI.
+func NewLiteral(lexical, datatype string) Term {
+	if datatype == XSDString {
+		datatype = ""
+	}
+	return Term{Kind: Literal, Value: lexical, Datatype: datatype}
+}
+
+// NewLangString returns the language-tagged string term.
+func NewLangString(lexical, language string) Term {
+	return Term{Kind: Literal, Value: lexical, Datatype: RDFLangString, Language: language}
+}
+
+// Quad is an RDF triple in a graph. The zero Graph is the default graph.
+type Quad struct {
+	Subject, Predicate, Object, Graph Term
+}
+
+// String returns the N-Quads statement without the line feed.
+func (q *Quad) String() string {
+	line := AppendQuad(nil, q)
+	return string(line[:len(line)-1])
+}
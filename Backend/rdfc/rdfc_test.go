@@ -0,0 +1,189 @@
+package rdfc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Examples from the RDFC-1.0 specification.
+var specTests = []struct{ in, want string }{
+	{ // unique hashes
+		in: `<http://example.com/#p> <http://example.com/#q> _:e0 .
+<http://example.com/#p> <http://example.com/#r> _:e1 .
+_:e0 <http://example.com/#s> <http://example.com/#u> .
+_:e1 <http://example.com/#t> <http://example.com/#u> .
+`,
+		want: `<http://example.com/#p> <http://example.com/#q> _:c14n0 .
+<http://example.com/#p> <http://example.com/#r> _:c14n1 .
+_:c14n0 <http://example.com/#s> <http://example.com/#u> .
+_:c14n1 <http://example.com/#t> <http://example.com/#u> .
+`,
+	}, { // shared hashes
+		in: `<http://example.com/#p> <http://example.com/#q> _:e0 .
+<http://example.com/#p> <http://example.com/#q> _:e1 .
+_:e0 <http://example.com/#p> _:e2 .
+_:e1 <http://example.com/#p> _:e3 .
+_:e2 <http://example.com/#r> _:e3 .
+`,
+		want: `<http://example.com/#p> <http://example.com/#q> _:c14n2 .
+<http://example.com/#p> <http://example.com/#q> _:c14n3 .
+_:c14n0 <http://example.com/#r> _:c14n1 .
+_:c14n2 <http://example.com/#p> _:c14n1 .
+_:c14n3 <http://example.com/#p> _:c14n0 .
+`,
+	},
+}
+
+func TestCanonical(t *testing.T) {
+	for _, test := range specTests {
+		dataset, err := Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Canonical(dataset)
+		if err != nil {
+			t.Errorf("got error: %s", err)
+		} else if string(got) != test.want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+		}
+	}
+}
+
+// Relabeled and reordered datasets must produce the same canonical form.
+func TestCanonicalIsomorphic(t *testing.T) {
+	const cycles = `_:a <http://example.com/#next> _:b .
+_:b <http://example.com/#next> _:c .
+_:c <http://example.com/#next> _:a .
+_:d <http://example.com/#next> _:e .
+_:e <http://example.com/#next> _:f .
+_:f <http://example.com/#next> _:d .
+_:a <http://example.com/#name> "a" _:g .
+_:g <http://example.com/#label> "graph"@en .
+_:a <http://example.com/#next> _:a .
+`
+	dataset, err := Parse(cycles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Canonical(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd := rand.New(rand.NewSource(42))
+	for n := 0; n < 20; n++ {
+		perm := rnd.Perm(26)
+		relabel := func(t *Term) {
+			if t.Kind == Blank {
+				t.Value = fmt.Sprintf("n%d", perm[t.Value[0]-'a'])
+			}
+		}
+		shuffled := make([]Quad, len(dataset))
+		for i, j := range rnd.Perm(len(dataset)) {
+			q := dataset[j]
+			relabel(&q.Subject)
+			relabel(&q.Object)
+			relabel(&q.Graph)
+			shuffled[i] = q
+		}
+		// duplicates do not count
+		shuffled = append(shuffled, shuffled[0])
+
+		got, err := Canonical(shuffled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestPoison(t *testing.T) {
+	// a clique of blank nodes is indistinguishable by first degree
+	var b strings.Builder
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			if i != j {
+				fmt.Fprintf(&b, "_:n%d <http://example.com/#p> _:n%d .\n", i, j)
+			}
+		}
+	}
+	dataset, err := Parse(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Canonicalizer{CallMax: 100}
+	if _, err := c.Canonicalize(dataset); !errors.Is(err, ErrPoison) {
+		t.Errorf("got error %v, want ErrPoison", err)
+	}
+}
+
+func TestNQuads(t *testing.T) {
+	const doc = `# comment
+<http://example.com/s> <http://example.com/p> "tab\tquote\"back\\slash\u0001\U0001F600" .
+<http://example.com/s> <http://example.com/p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> <http://example.com/g> .
+_:b0 <http://example.com/p> "chat"@fr-BE _:g.
+
+<http://example.com/s> <http://example.com/p> "plain"^^<http://www.w3.org/2001/XMLSchema#string> .
+`
+	quads, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `<http://example.com/s> <http://example.com/p> "tab\tquote\"back\\slash\u0001😀" .
+<http://example.com/s> <http://example.com/p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> <http://example.com/g> .
+_:b0 <http://example.com/p> "chat"@fr-BE _:g .
+<http://example.com/s> <http://example.com/p> "plain" .
+`
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := range quads {
+		if err := w.Write(&quads[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, s := range []string{
+		`<http://example.com/s> <http://example.com/p> "o"`,
+		`"s" <http://example.com/p> "o" .`,
+		`<http://example.com/s> _:p "o" .`,
+		`<http://example.com/s> <http://example.com/p> "o" "g" .`,
+		`<http://example.com/s> <http://example.com/p> "\x" .`,
+		`<http://exa mple.com/s> <http://example.com/p> "o" .`,
+		`<http://example.com/s> <http://example.com/p> "o" . trailing`,
+	} {
+		if _, err := Parse(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%s got error %v, want ErrSyntax", s, err)
+		}
+	}
+}
+
+// Any statement which parses must serialize into an equivalent statement.
+func FuzzParse(f *testing.F) {
+	f.Add(specTests[1].in)
+	f.Add(`<http://example.com/s> <http://example.com/p> "x\u0000"@en-US _:g .`)
+	f.Fuzz(func(t *testing.T, doc string) {
+		quads, err := Parse(doc)
+		if err != nil {
+			return
+		}
+		again, err := Parse(string(Marshal(quads)))
+		if err != nil {
+			t.Fatalf("%q serialized as %q, which got error: %s", doc, Marshal(quads), err)
+		}
+		if !bytes.Equal(Marshal(again), Marshal(quads)) {
+			t.Errorf("%q serialized as %q, and then as %q", doc, Marshal(quads), Marshal(again))
+		}
+	})
+}
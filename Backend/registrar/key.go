@@ -0,0 +1,64 @@
+package registrar
+
+import (
+	"context"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// Key registers did:key identifiers. The method is purely generative: Create
+// makes a key pair, and the document follows from the public key. Update and
+// Deactivate get ErrNotSupported.
+type Key struct {
+	Keys keystore.KeyStore
+
+	// KeyType defaults to keystore.Ed25519.
+	KeyType keystore.KeyType
+
+	// Resolver expands the documents, including its format options.
+	didkey.Resolver
+}
+
+// Create implements the Registrar interface. Any document in req is denied,
+// as did:key documents can not have custom content.
+func (r *Key) Create(_ context.Context, req *CreateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	if req.DID != nil || req.Document != nil {
+		return nil, fmt.Errorf("%w: did:key create with a DID or a document", ErrNotSupported)
+	}
+
+	ref, pub, err := createKey(r.Keys, r.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	did, err := didkey.New(pub)
+	if err != nil {
+		r.Keys.Delete(ref)
+		return nil, err
+	}
+	doc, err := r.Expand(did)
+	if err != nil {
+		r.Keys.Delete(ref)
+		return nil, err
+	}
+	secret := &Secret{KeyRefs: make(map[string]string, len(doc.VerificationMethods))}
+	for _, m := range doc.VerificationMethods {
+		secret.KeyRefs[m.ID.String()] = ref
+	}
+	return finish(doc, new(backend.Meta), secret), nil
+}
+
+// Update implements the Registrar interface with ErrNotSupported.
+func (r *Key) Update(_ context.Context, req *UpdateRequest) (*Result, error) {
+	return nil, fmt.Errorf("%w: did:key is immutable", ErrNotSupported)
+}
+
+// Deactivate implements the Registrar interface with ErrNotSupported.
+func (r *Key) Deactivate(_ context.Context, req *DeactivateRequest) (*Result, error) {
+	return nil, fmt.Errorf("%w: did:key can not be deactivated", ErrNotSupported)
+}
@@ -0,0 +1,212 @@
+// Package registrar implements the “Create”, “Update” and “Deactivate”
+// operations of DID methods, conform the DID Registration specification of
+// the Decentralized Identity Foundation. Resolution (“Read”) is left to the
+// respective resolver.
+package registrar
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jsonpatch"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// Registration errors
+var (
+	// ErrNotSupported signals an operation which the DID method lacks,
+	// such as an update of a did:key.
+	ErrNotSupported = errors.New("DID operation not supported")
+
+	// ErrExists signals a Create for a DID in use.
+	ErrExists = errors.New("DID exists already")
+
+	// ErrJob signals an unknown job ID.
+	ErrJob = errors.New("DID registration job not found")
+)
+
+// Job states, as in the didState property
+const (
+	Finished = "finished" // operation complete
+	Failed   = "failed"   // operation aborted with a reason
+	Action   = "action"   // client input required
+	Wait     = "wait"     // operation pending
+)
+
+// Registrar executes DID operations. Each call either completes with a
+// Finished state, or it returns a JobID for continuation with another call.
+// Implementations must be safe for concurrent use.
+type Registrar interface {
+	Create(ctx context.Context, req *CreateRequest) (*Result, error)
+	Update(ctx context.Context, req *UpdateRequest) (*Result, error)
+	Deactivate(ctx context.Context, req *DeactivateRequest) (*Result, error)
+}
+
+// Secret carries key material in either direction. In the “internal secret
+// mode”, the registrar returns the keys it generated. Private keys never leave
+// the keystore; only their references do.
+type Secret struct {
+	// KeyRefs has the keystore reference per verification method ID.
+	KeyRefs map[string]string `json:"keyRefs,omitempty"`
+}
+
+// CreateRequest is the input of Create.
+type CreateRequest struct {
+	// JobID continues a pending operation, if any.
+	JobID string `json:"jobId,omitempty"`
+
+	// DID is the identifier desired, for methods which do not derive it,
+	// such as did:web.
+	DID *backend.DID `json:"did,omitempty"`
+
+	Options map[string]any `json:"options,omitempty"`
+	Secret  *Secret        `json:"secret,omitempty"`
+
+	// Document is the initial content, if any. The subject is set by
+	// the registrar. Methods without verification methods get a key
+	// generated.
+	Document *backend.Document `json:"didDocument,omitempty"`
+}
+
+// UpdateRequest is the input of Update. Either Document replaces the current
+// version (“setDidDocument”), or Patch applies to it.
+type UpdateRequest struct {
+	JobID string      `json:"jobId,omitempty"`
+	DID   backend.DID `json:"did"`
+
+	Options map[string]any `json:"options,omitempty"`
+	Secret  *Secret        `json:"secret,omitempty"`
+
+	Document *backend.Document `json:"didDocument,omitempty"`
+	Patch    []jsonpatch.Patch `json:"patch,omitempty"`
+}
+
+// DeactivateRequest is the input of Deactivate.
+type DeactivateRequest struct {
+	JobID string      `json:"jobId,omitempty"`
+	DID   backend.DID `json:"did"`
+
+	Options map[string]any `json:"options,omitempty"`
+	Secret  *Secret        `json:"secret,omitempty"`
+}
+
+// State is the “didState” of a job.
+type State struct {
+	State string `json:"state"`
+
+	DID      *backend.DID      `json:"did,omitempty"`
+	Secret   *Secret           `json:"secret,omitempty"`
+	Document *backend.Document `json:"didDocument,omitempty"`
+
+	// Reason explains a Failed state.
+	Reason string `json:"reason,omitempty"`
+	// Action names the client input for an Action state.
+	Action string `json:"action,omitempty"`
+}
+
+// Result is the output of each operation.
+type Result struct {
+	// JobID identifies the operation when not Finished.
+	JobID string `json:"jobId,omitempty"`
+
+	State State `json:"didState"`
+
+	RegistrationMeta map[string]any `json:"didRegistrationMetadata,omitempty"`
+	DocumentMeta     *backend.Meta  `json:"didDocumentMetadata,omitempty"`
+}
+
+// Finish returns the result of a completed operation.
+func finish(doc *backend.Document, meta *backend.Meta, secret *Secret) *Result {
+	did := doc.Subject
+	return &Result{
+		State: State{
+			State:    Finished,
+			DID:      &did,
+			Secret:   secret,
+			Document: doc,
+		},
+		DocumentMeta: meta,
+	}
+}
+
+// CheckJob denies continuation, for registrars which complete synchronously.
+func checkJob(jobID string) error {
+	if jobID != "" {
+		return fmt.Errorf("%w: %q", ErrJob, jobID)
+	}
+	return nil
+}
+
+// Apply returns the document after req is applied to current, for use in
+// Registrar implementations.
+func Apply(current *backend.Document, req *UpdateRequest) (*backend.Document, error) {
+	switch {
+	case req.Document != nil && req.Patch != nil:
+		return nil, fmt.Errorf("%w: DID update with both a document and a patch", backend.ErrInvalid)
+	case req.Document != nil:
+		doc := *req.Document
+		if doc.Subject.Method == "" {
+			doc.Subject = req.DID
+		}
+		if !doc.Subject.Equal(req.DID) {
+			return nil, fmt.Errorf("%w: DID update of %s with document of %s", backend.ErrInvalid, req.DID.String(), doc.Subject.String())
+		}
+		return &doc, nil
+	case req.Patch != nil:
+		doc, err := jsonpatch.Apply(current, req.Patch)
+		if err != nil {
+			return nil, err
+		}
+		if !doc.Subject.Equal(req.DID) {
+			return nil, fmt.Errorf("%w: DID update patch changes the subject", backend.ErrInvalid)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("%w: DID update without document nor patch", backend.ErrInvalid)
+	}
+}
+
+// Provision completes doc for subject. Without any verification methods, a key
+// of keyType is generated in ks, and it is authorized for authentication and
+// for assertions as "#key-1".
+func provision(ks keystore.KeyStore, keyType keystore.KeyType, subject backend.DID, doc *backend.Document) (*backend.Document, *Secret, error) {
+	if doc == nil {
+		doc = new(backend.Document)
+	} else {
+		c := *doc
+		doc = &c
+	}
+	doc.Subject = subject
+	if len(doc.VerificationMethods) != 0 {
+		return doc, nil, nil
+	}
+
+	ref, pub, err := createKey(ks, keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := backend.URL{DID: subject, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(id, subject, pub, keys.Multikey)
+	if err != nil {
+		ks.Delete(ref)
+		return nil, nil, err
+	}
+	doc.VerificationMethods = []*backend.VerificationMethod{m}
+	doc.Authentication = &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}}
+	doc.AssertionMethod = &backend.VerificationRelationship{URIRefs: []*backend.URL{&m.ID}}
+	return doc, &Secret{KeyRefs: map[string]string{id.String(): ref}}, nil
+}
+
+func createKey(ks keystore.KeyStore, keyType keystore.KeyType) (ref string, pub crypto.PublicKey, err error) {
+	if ks == nil {
+		return "", nil, errors.New("DID registrar has no keystore")
+	}
+	if keyType == "" {
+		keyType = keystore.Ed25519
+	}
+	return ks.Create(keyType)
+}
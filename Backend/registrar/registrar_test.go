@@ -0,0 +1,134 @@
+package registrar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/jsonpatch"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/store"
+)
+
+func TestKey(t *testing.T) {
+	r := &Key{Keys: new(keystore.Memory)}
+	res, err := r.Create(context.Background(), new(CreateRequest))
+	if err != nil {
+		t.Fatal("create error:", err)
+	}
+	if res.State.State != Finished || res.State.DID.Method != didkey.Method {
+		t.Fatalf("got state %+v", res.State)
+	}
+	if err := didkey.CheckDocument(res.State.Document); err != nil {
+		t.Error("document check:", err)
+	}
+	for id, ref := range res.State.Secret.KeyRefs {
+		if _, err := r.Keys.Signer(ref); err != nil {
+			t.Errorf("key reference %q of %s: %s", ref, id, err)
+		}
+	}
+
+	_, err = r.Update(context.Background(), &UpdateRequest{DID: *res.State.DID})
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("update got error %v, want ErrNotSupported", err)
+	}
+	if _, err := r.Create(context.Background(), &CreateRequest{JobID: "j1"}); !errors.Is(err, ErrJob) {
+		t.Errorf("create with job ID got error %v, want ErrJob", err)
+	}
+}
+
+func TestWeb(t *testing.T) {
+	root := t.TempDir()
+	r := &Web{Root: root, Keys: new(keystore.Memory)}
+	did := backend.DID{Method: "web", SpecID: "example.com:user:alice"}
+
+	res, err := r.Create(context.Background(), &CreateRequest{DID: &did})
+	if err != nil {
+		t.Fatal("create error:", err)
+	}
+	if n := len(res.State.Secret.KeyRefs); n != 1 {
+		t.Errorf("got %d key references, want 1", n)
+	}
+	path := filepath.Join(root, "user", "alice", "did.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc backend.Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Subject.Equal(did) || len(doc.VerificationMethods) != 1 || doc.Authentication == nil {
+		t.Errorf("got document %s", b)
+	}
+	if _, err := r.Create(context.Background(), &CreateRequest{DID: &did}); !errors.Is(err, ErrExists) {
+		t.Errorf("second create got error %v, want ErrExists", err)
+	}
+
+	res, err = r.Update(context.Background(), &UpdateRequest{
+		DID:   did,
+		Patch: []jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/alsoKnownAs", Value: json.RawMessage(`["https://example.com/alice"]`)}},
+	})
+	if err != nil {
+		t.Fatal("update error:", err)
+	}
+	if got := res.State.Document.AlsoKnownAs; len(got) != 1 {
+		t.Errorf("got alsoKnownAs %q after patch", got)
+	}
+	other := backend.DID{Method: "web", SpecID: "example.com"}
+	_, err = r.Update(context.Background(), &UpdateRequest{DID: did, Document: &backend.Document{Subject: other}})
+	if !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("update with other subject got error %v, want ErrInvalid", err)
+	}
+
+	if _, err := r.Deactivate(context.Background(), &DeactivateRequest{DID: did}); err != nil {
+		t.Fatal("deactivate error:", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("document stat after deactivate got error %v", err)
+	}
+	if _, err := r.Deactivate(context.Background(), &DeactivateRequest{DID: did}); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("second deactivate got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := new(store.Memory)
+	r := &Store{Store: s, Method: "idchain", Keys: new(keystore.Memory)}
+
+	res, err := r.Create(context.Background(), &CreateRequest{
+		Document: &backend.Document{AlsoKnownAs: []string{"https://example.com"}},
+	})
+	if err != nil {
+		t.Fatal("create error:", err)
+	}
+	did := *res.State.DID
+	if did.Method != "idchain" || res.DocumentMeta.VersionID != "1" {
+		t.Errorf("got DID %s, meta %+v", did.String(), res.DocumentMeta)
+	}
+
+	res, err = r.Update(context.Background(), &UpdateRequest{DID: did, Document: &backend.Document{}})
+	if err != nil {
+		t.Fatal("update error:", err)
+	}
+	if res.DocumentMeta.VersionID != "2" || len(res.State.Document.AlsoKnownAs) != 0 {
+		t.Errorf("update got document %+v, meta %+v", res.State.Document, res.DocumentMeta)
+	}
+
+	if _, err := r.Deactivate(context.Background(), &DeactivateRequest{DID: did}); err != nil {
+		t.Fatal("deactivate error:", err)
+	}
+	_, meta, err := store.Resolver{Store: s}.Resolve(context.Background(), did)
+	if err != nil || meta.Deactivated.IsZero() {
+		t.Errorf("resolve after deactivate got meta %+v, error %v", meta, err)
+	}
+	_, err = r.Update(context.Background(), &UpdateRequest{DID: did, Document: &backend.Document{}})
+	if !errors.Is(err, backend.ErrDeactivated) {
+		t.Errorf("update after deactivate got error %v, want ErrDeactivated", err)
+	}
+}
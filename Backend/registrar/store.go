@@ -0,0 +1,136 @@
+package registrar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/store"
+)
+
+// Store registers DIDs of a method for which a store.Store is authoritative,
+// such as the local ledger of an IDChain node. Each operation adds a version,
+// which store.Resolver serves with the version parameters. Deactivation is a
+// final version with the Deactivated metadata set.
+type Store struct {
+	Store store.Store
+
+	// Method is the DID method name. New identifiers are random.
+	Method string
+
+	Keys keystore.KeyStore
+
+	// KeyType defaults to keystore.Ed25519.
+	KeyType keystore.KeyType
+
+	mutex sync.Mutex // serializes read-modify-write on Store
+}
+
+// Create implements the Registrar interface. The request may have the DID,
+// in which case it must be of the Method.
+func (r *Store) Create(_ context.Context, req *CreateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	var did backend.DID
+	if req.DID != nil {
+		if req.DID.Method != r.Method {
+			return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, req.DID.Method, r.Method)
+		}
+		did = *req.DID
+	} else {
+		var specID [16]byte
+		if _, err := rand.Read(specID[:]); err != nil {
+			return nil, err
+		}
+		did = backend.DID{
+			Method: r.Method,
+			SpecID: strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(specID[:])),
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch _, _, err := r.Store.Get(did); {
+	case err == nil:
+		return nil, fmt.Errorf("%w: %s", ErrExists, did.String())
+	case !errors.Is(err, backend.ErrNotFound):
+		return nil, err
+	}
+	doc, secret, err := provision(r.Keys, r.KeyType, did, req.Document)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.Store.Put(doc, nil)
+	if err != nil {
+		if secret != nil {
+			for _, ref := range secret.KeyRefs {
+				r.Keys.Delete(ref)
+			}
+		}
+		return nil, err
+	}
+	return finish(doc, meta, secret), nil
+}
+
+// Update implements the Registrar interface.
+func (r *Store) Update(_ context.Context, req *UpdateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	current, err := r.current(req.DID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Apply(current, req)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.Store.Put(doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return finish(doc, meta, nil), nil
+}
+
+// Deactivate implements the Registrar interface.
+func (r *Store) Deactivate(_ context.Context, req *DeactivateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	doc, err := r.current(req.DID)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.Store.Put(doc, &backend.Meta{Deactivated: time.Now().UTC().Truncate(time.Second)})
+	if err != nil {
+		return nil, err
+	}
+	return finish(doc, meta, nil), nil
+}
+
+// Current returns the latest version of did, with ErrDeactivated when final.
+func (r *Store) current(did backend.DID) (*backend.Document, error) {
+	if did.Method != r.Method {
+		return nil, fmt.Errorf("%w: method %q is not %q", backend.ErrInvalid, did.Method, r.Method)
+	}
+	doc, meta, err := r.Store.Get(did)
+	if err != nil {
+		return nil, err
+	}
+	if !meta.Deactivated.IsZero() {
+		return nil, fmt.Errorf("%w: %s", backend.ErrDeactivated, did.String())
+	}
+	return doc, nil
+}
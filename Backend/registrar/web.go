@@ -0,0 +1,174 @@
+package registrar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didweb"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// Web registers did:web identifiers by writing their documents into the
+// document root of the web server for the domain. Deactivate removes the
+// document, as the method has no deactivation state. Multiple processes must
+// not share a Root.
+type Web struct {
+	// Root is the directory served as the HTTPS root of the domain.
+	Root string
+
+	Keys keystore.KeyStore
+
+	// KeyType defaults to keystore.Ed25519.
+	KeyType keystore.KeyType
+
+	mutex sync.Mutex
+}
+
+// Path returns the file location of did within Root.
+func (r *Web) path(did backend.DID) (string, error) {
+	u, err := didweb.URL(did)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(r.Root, filepath.FromSlash(u.Path)), nil
+}
+
+// Create implements the Registrar interface. The request must have the DID.
+func (r *Web) Create(_ context.Context, req *CreateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	if req.DID == nil {
+		return nil, fmt.Errorf("%w: did:web create without DID", backend.ErrInvalid)
+	}
+	path, err := r.path(*req.DID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch _, err := os.Stat(path); {
+	case err == nil:
+		return nil, fmt.Errorf("%w: %s", ErrExists, req.DID.String())
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	doc, secret, err := provision(r.Keys, r.KeyType, *req.DID, req.Document)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDocument(path, doc); err != nil {
+		if secret != nil {
+			for _, ref := range secret.KeyRefs {
+				r.Keys.Delete(ref)
+			}
+		}
+		return nil, err
+	}
+	return finish(doc, new(backend.Meta), secret), nil
+}
+
+// Update implements the Registrar interface.
+func (r *Web) Update(_ context.Context, req *UpdateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	path, err := r.path(req.DID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	current, err := readDocument(path, req.DID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Apply(current, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDocument(path, doc); err != nil {
+		return nil, err
+	}
+	return finish(doc, new(backend.Meta), nil), nil
+}
+
+// Deactivate implements the Registrar interface.
+func (r *Web) Deactivate(_ context.Context, req *DeactivateRequest) (*Result, error) {
+	if err := checkJob(req.JobID); err != nil {
+		return nil, err
+	}
+	path, err := r.path(req.DID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	doc, err := readDocument(path, req.DID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return finish(doc, new(backend.Meta), nil), nil
+}
+
+func readDocument(path string, did backend.DID) (*backend.Document, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s has no document at %s", backend.ErrNotFound, did.String(), path)
+		}
+		return nil, err
+	}
+	doc := new(backend.Document)
+	if err := json.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// WriteDocument replaces the content of path atomically, with any missing
+// directories created.
+func writeDocument(path string, doc *backend.Document) error {
+	data, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package remotesign
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// ResponseMax is the size limit for response bodies.
+const ResponseMax = 64 << 10
+
+// Client is a keystore.KeyStore with keys held by a Server.
+type Client struct {
+	BaseURL  string // e.g., "https://signer.internal/v1"
+	ClientID string
+	Secret   []byte
+
+	HTTP *http.Client // nil for http.DefaultClient
+	Log  *slog.Logger // audit log; nil for slog.Default
+}
+
+func (c *Client) log() *slog.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return slog.Default()
+}
+
+// Do executes a call on an escaped path, and it decodes the response into out
+// when not nil.
+func (c *Client) do(method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.BaseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	a, err := newAuth(c.ClientID, c.Secret, method, path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", a.String())
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		c.log().Error("remote signer unreachable", "method", method, "path", path, "error", err)
+		return fmt.Errorf("remote signer unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ResponseMax))
+	if err != nil {
+		return fmt.Errorf("remote signer response: %w", err)
+	}
+	c.log().Info("remote signer call", "method", method, "path", path, "status", resp.StatusCode)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		break
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: remote: %s", keystore.ErrNotFound, bytes.TrimSpace(data))
+	case http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w: remote: %s", keystore.ErrKeyType, bytes.TrimSpace(data))
+	case http.StatusInsufficientStorage:
+		return fmt.Errorf("%w: remote: %s", keystore.ErrQuota, bytes.TrimSpace(data))
+	case http.StatusUnauthorized:
+		return ErrAuth
+	default:
+		return fmt.Errorf("remote signer got HTTP %q: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("remote signer response: %w", err)
+	}
+	return nil
+}
+
+func keyPath(ref string) string {
+	return "/keys/" + url.PathEscape(ref)
+}
+
+// Create implements the keystore.KeyStore interface.
+func (c *Client) Create(kt keystore.KeyType) (string, crypto.PublicKey, error) {
+	var resp KeyResponse
+	if err := c.do(http.MethodPost, "/keys", &CreateRequest{Type: string(kt)}, &resp); err != nil {
+		return "", nil, err
+	}
+	if resp.PublicKey == nil {
+		return "", nil, fmt.Errorf("remote signer response without public key")
+	}
+	pub, err := resp.PublicKey.PublicKey()
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.Ref, pub, nil
+}
+
+// Signer implements the keystore.KeyStore interface. The public key is
+// retrieved once, ahead of any signing.
+func (c *Client) Signer(ref string) (crypto.Signer, error) {
+	var resp KeyResponse
+	if err := c.do(http.MethodGet, keyPath(ref), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.PublicKey == nil {
+		return nil, fmt.Errorf("remote signer response without public key")
+	}
+	pub, err := resp.PublicKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &remoteSigner{c, ref, pub}, nil
+}
+
+// List implements the keystore.KeyStore interface.
+func (c *Client) List() ([]string, error) {
+	var resp ListResponse
+	if err := c.do(http.MethodGet, "/keys", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Refs, nil
+}
+
+// Delete implements the keystore.KeyStore interface.
+func (c *Client) Delete(ref string) error {
+	return c.do(http.MethodDelete, keyPath(ref), nil, nil)
+}
+
+type remoteSigner struct {
+	c   *Client
+	ref string
+	pub crypto.PublicKey
+}
+
+// Public implements the crypto.Signer interface.
+func (s *remoteSigner) Public() crypto.PublicKey { return s.pub }
+
+// Sign implements the crypto.Signer interface. The random source is ignored.
+func (s *remoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	name, err := hashName(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+	var resp SignResponse
+	err = s.c.do(http.MethodPost, keyPath(s.ref)+"/sign", &SignRequest{Hash: name, Data: digest}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
@@ -0,0 +1,174 @@
+// Package remotesign separates key custody from the resolver and the wallet.
+// An isolated signer service holds the private keys, and callers hold key
+// references only. Client implements keystore.KeyStore, such that remote keys
+// plug into any code which works with local ones.
+//
+// The protocol is JSON over HTTP. Each request carries an HMAC-SHA256 over its
+// method, path, timestamp, nonce and body, keyed with a secret per client. Requests
+// outside of the clock skew tolerance, and replays within, are denied. The
+// transport must provide confidentiality and server authentication, i.e.,
+// HTTPS. Both sides log every operation to an audit log.
+//
+//	POST   {base}/keys             create a key pair
+//	GET    {base}/keys             list key references
+//	GET    {base}/keys/{ref}       get the public key
+//	DELETE {base}/keys/{ref}       delete a key pair
+//	POST   {base}/keys/{ref}/sign  sign a digest
+package remotesign
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// AuthScheme is the HTTP authentication scheme of the protocol.
+const AuthScheme = "IDC-HMAC-SHA256"
+
+// ErrAuth signals a request which does not authenticate.
+var ErrAuth = errors.New("remote signing authentication denied")
+
+// CreateRequest is the body of a key creation.
+type CreateRequest struct {
+	Type string `json:"type"` // keystore.KeyType
+}
+
+// KeyResponse describes a key pair.
+type KeyResponse struct {
+	Ref       string    `json:"ref"`
+	PublicKey *jose.JWK `json:"publicKeyJwk"`
+}
+
+// ListResponse has all key references.
+type ListResponse struct {
+	Refs []string `json:"refs"`
+}
+
+// SignRequest is the body of a signature operation.
+type SignRequest struct {
+	// Hash names the digest function, or it is empty for signature schemes
+	// which hash internally, i.e., Ed25519.
+	Hash string `json:"hash,omitempty"`
+	Data []byte `json:"data"` // digest or message
+}
+
+// SignResponse has the signature in the encoding of the crypto.Signer in use.
+type SignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA-256",
+	crypto.SHA384: "SHA-384",
+	crypto.SHA512: "SHA-512",
+}
+
+// HashName returns the protocol name of h.
+func hashName(h crypto.Hash) (string, error) {
+	if h == 0 {
+		return "", nil
+	}
+	name, ok := hashNames[h]
+	if !ok {
+		return "", fmt.Errorf("remote signing of %s digests not supported", h)
+	}
+	return name, nil
+}
+
+// HashByName returns the hash function of a protocol name.
+func hashByName(name string) (crypto.Hash, bool) {
+	if name == "" {
+		return 0, true
+	}
+	for h, s := range hashNames {
+		if s == name {
+			return h, true
+		}
+	}
+	return 0, false
+}
+
+// Mac returns the request authentication code. The path is relative to the
+// base of the service, and in escaped form.
+func mac(secret []byte, method, path string, a *auth, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(method + "\n" + path + "\n" + strconv.FormatInt(a.Timestamp, 10) + "\n" + a.Nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return m.Sum(nil)
+}
+
+// Auth has the parameters of the Authorization header.
+type auth struct {
+	ClientID  string
+	Timestamp int64  // Unix time
+	Nonce     string // unique per request
+	Signature []byte // HMAC
+}
+
+// String returns the header value.
+func (a *auth) String() string {
+	return fmt.Sprintf("%s Credential=%s, Timestamp=%d, Nonce=%s, Signature=%s",
+		AuthScheme, a.ClientID, a.Timestamp, a.Nonce,
+		base64.RawURLEncoding.EncodeToString(a.Signature))
+}
+
+// ParseAuth returns the parameters of a header value.
+func parseAuth(s string) (*auth, error) {
+	params, ok := strings.CutPrefix(s, AuthScheme+" ")
+	if !ok {
+		return nil, fmt.Errorf("%w: authorization scheme not %s", ErrAuth, AuthScheme)
+	}
+	var a auth
+	var tsSeen bool
+	for _, p := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+		switch name {
+		case "Credential":
+			a.ClientID = value
+		case "Timestamp":
+			var err error
+			a.Timestamp, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: malformed timestamp", ErrAuth)
+			}
+			tsSeen = true
+		case "Nonce":
+			a.Nonce = value
+		case "Signature":
+			var err error
+			a.Signature, err = base64.RawURLEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: malformed signature", ErrAuth)
+			}
+		}
+	}
+	if a.ClientID == "" || !tsSeen || a.Nonce == "" || len(a.Signature) == 0 {
+		return nil, fmt.Errorf("%w: incomplete authorization", ErrAuth)
+	}
+	return &a, nil
+}
+
+// NewAuth returns the authorization for a request, timestamped now.
+func newAuth(clientID string, secret []byte, method, path string, body []byte) (*auth, error) {
+	var nonce [12]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("remote signing nonce unavailable: %w", err)
+	}
+	a := &auth{
+		ClientID:  clientID,
+		Timestamp: time.Now().Unix(),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce[:]),
+	}
+	a.Signature = mac(secret, method, path, a, body)
+	return a, nil
+}
@@ -0,0 +1,159 @@
+package remotesign
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+func newTestService(t *testing.T) (*Server, *Client, *bytes.Buffer) {
+	var audit bytes.Buffer
+	server := &Server{
+		Store:   new(keystore.Memory),
+		Clients: map[string][]byte{"wallet": []byte("shared secret")},
+		Log:     slog.New(slog.NewTextHandler(&audit, nil)),
+	}
+	ts := httptest.NewServer(http.StripPrefix("/v1", server))
+	t.Cleanup(ts.Close)
+	client := &Client{
+		BaseURL:  ts.URL + "/v1",
+		ClientID: "wallet",
+		Secret:   []byte("shared secret"),
+		HTTP:     ts.Client(),
+		Log:      slog.New(slog.NewTextHandler(&audit, nil)),
+	}
+	return server, client, &audit
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, client, audit := newTestService(t)
+
+	// the client is a drop-in keystore
+	var store keystore.KeyStore = client
+	for _, kt := range []keystore.KeyType{keystore.Ed25519, keystore.P256, keystore.P384} {
+		ref, pub, err := store.Create(kt)
+		if err != nil {
+			t.Fatalf("%q got error: %s", kt, err)
+		}
+		signer, err := store.Signer(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alg, err := jose.AlgFor(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jws, err := jose.Sign(jose.Header{Alg: alg}, []byte("payload"), signer)
+		if err != nil {
+			t.Fatalf("%q got signature error: %s", kt, err)
+		}
+		parsed, err := jose.ParseCompact(jws)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parsed.Verify(pub); err != nil {
+			t.Errorf("%q got verification error: %s", kt, err)
+		}
+	}
+
+	refs, err := store.List()
+	if err != nil || len(refs) != 3 {
+		t.Fatalf("got references %q, error %v", refs, err)
+	}
+	if err := store.Delete(refs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Signer(refs[0]); !errors.Is(err, keystore.ErrNotFound) {
+		t.Errorf("deleted key got error %v, want keystore.ErrNotFound", err)
+	}
+	if _, _, err := store.Create("RSA"); !errors.Is(err, keystore.ErrKeyType) {
+		t.Errorf("RSA got error %v, want keystore.ErrKeyType", err)
+	}
+
+	for _, want := range []string{"remote key created", "remote signature issued", "remote key deleted", "remote signer call"} {
+		if !strings.Contains(audit.String(), want) {
+			t.Errorf("audit log misses %q", want)
+		}
+	}
+}
+
+func TestAuthDenied(t *testing.T) {
+	server, client, _ := newTestService(t)
+
+	client.Secret = []byte("wrong")
+	if _, err := client.List(); !errors.Is(err, ErrAuth) {
+		t.Errorf("wrong secret got error %v, want ErrAuth", err)
+	}
+	client.Secret = []byte("shared secret")
+	client.ClientID = "intruder"
+	if _, err := client.List(); !errors.Is(err, ErrAuth) {
+		t.Errorf("unknown client got error %v, want ErrAuth", err)
+	}
+
+	// replay and stale requests direct on the handler
+	now := time.Now().Unix()
+	for _, test := range []struct {
+		timestamp int64
+		want      []int
+	}{
+		{now, []int{http.StatusOK, http.StatusUnauthorized}},
+		{now - 3600, []int{http.StatusUnauthorized}},
+	} {
+		for i, want := range test.want {
+			a := &auth{ClientID: "wallet", Timestamp: test.timestamp, Nonce: "fixed"}
+			a.Signature = mac([]byte("shared secret"), http.MethodGet, "/keys", a, nil)
+			req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+			req.Header.Set("Authorization", a.String())
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != want {
+				t.Errorf("timestamp %d request %d got HTTP %d, want %d", test.timestamp, i+1, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"Bearer token",
+		AuthScheme + " Credential=wallet",
+		AuthScheme + " Credential=wallet, Timestamp=x, Nonce=n, Signature=AA",
+		AuthScheme + " Credential=wallet, Timestamp=1, Nonce=n, Signature=!",
+		AuthScheme + " Credential=wallet, Timestamp=1, Signature=AA",
+	} {
+		if _, err := parseAuth(s); !errors.Is(err, ErrAuth) {
+			t.Errorf("%q got error %v, want ErrAuth", s, err)
+		}
+	}
+}
+
+func TestTenants(t *testing.T) {
+	server, client, _ := newTestService(t)
+	server.Tenants = &keystore.Tenants{
+		Storage:   new(keystore.MapStorage),
+		MasterKey: make([]byte, 32),
+		Quota:     1,
+	}
+
+	if _, err := client.List(); err == nil {
+		t.Error("unregistered tenant got no error")
+	}
+	if err := server.Tenants.Add("wallet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Create(keystore.P256); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Create(keystore.P256); !errors.Is(err, keystore.ErrQuota) {
+		t.Errorf("create over quota got error %v, want keystore.ErrQuota", err)
+	}
+}
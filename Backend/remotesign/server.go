@@ -0,0 +1,289 @@
+package remotesign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// RequestMax is the size limit for request bodies.
+const RequestMax = 64 << 10
+
+// DefaultMaxSkew is the clock skew tolerance when Server.MaxSkew is zero.
+const DefaultMaxSkew = time.Minute
+
+// Server is the signer service. Paths are relative to the base, so mount with
+// http.StripPrefix when the base is not the root.
+type Server struct {
+	Store keystore.KeyStore
+
+	// Tenants, when set, confines each client to the tenant with the same
+	// identifier, and Store is not used.
+	Tenants *keystore.Tenants
+
+	// Clients maps client identifiers to their shared secret. Without
+	// Tenants, each client has access to all keys in Store.
+	Clients map[string][]byte
+
+	Log     *slog.Logger  // audit log; nil for slog.Default
+	MaxSkew time.Duration // clock skew tolerance
+
+	mutex sync.Mutex
+	seen  map[string]time.Time // nonces in skew window
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return slog.Default()
+}
+
+func (s *Server) maxSkew() time.Duration {
+	if s.MaxSkew > 0 {
+		return s.MaxSkew
+	}
+	return DefaultMaxSkew
+}
+
+// Authenticate returns the client identifier of r.
+func (s *Server) authenticate(r *http.Request, body []byte) (string, error) {
+	a, err := parseAuth(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	secret, ok := s.Clients[a.ClientID]
+	if !ok {
+		return "", ErrAuth
+	}
+	if !hmac.Equal(a.Signature, mac(secret, r.Method, r.URL.EscapedPath(), a, body)) {
+		return "", ErrAuth
+	}
+
+	now := time.Now()
+	skew := s.maxSkew()
+	t := time.Unix(a.Timestamp, 0)
+	if t.Before(now.Add(-skew)) || t.After(now.Add(skew)) {
+		return "", ErrAuth
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[string]time.Time)
+	}
+	for k, expire := range s.seen {
+		if now.After(expire) {
+			delete(s.seen, k)
+		}
+	}
+	key := a.ClientID + " " + a.Nonce
+	if _, ok := s.seen[key]; ok {
+		return "", ErrAuth
+	}
+	s.seen[key] = t.Add(skew)
+	return a.ClientID, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, RequestMax+1))
+	if err != nil {
+		http.Error(w, "request body unavailable", http.StatusBadRequest)
+		return
+	}
+	if len(body) > RequestMax {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	clientID, err := s.authenticate(r, body)
+	if err != nil {
+		s.log().Warn("remote signing request denied",
+			"remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path, "error", err)
+		w.Header().Set("WWW-Authenticate", AuthScheme)
+		http.Error(w, "authentication denied", http.StatusUnauthorized)
+		return
+	}
+	log := s.log().With("client", clientID, "remote", r.RemoteAddr)
+	store := s.Store
+	if s.Tenants != nil {
+		store, err = s.Tenants.Tenant(clientID)
+		if err != nil {
+			log.Error("remote signing tenant unavailable", "error", err)
+			http.Error(w, "tenant unavailable", http.StatusForbidden)
+			return
+		}
+	}
+
+	// path is /keys[/{ref}[/sign]]
+	p, ok := strings.CutPrefix(strings.TrimSuffix(r.URL.EscapedPath(), "/"), "/keys")
+	if !ok || (p != "" && p[0] != '/') {
+		http.NotFound(w, r)
+		return
+	}
+	rest := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i := range rest {
+		rest[i], err = url.PathUnescape(rest[i])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	switch {
+	case rest[0] == "" && len(rest) == 1:
+		switch r.Method {
+		case http.MethodPost:
+			s.serveCreate(w, store, body, log)
+		case http.MethodGet:
+			s.serveList(w, store, log)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case len(rest) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			s.serveKey(w, store, rest[0], log)
+		case http.MethodDelete:
+			s.serveDelete(w, store, rest[0], log)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case len(rest) == 2 && rest[1] == "sign":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveSign(w, store, rest[0], body, log)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// WriteError maps err to an HTTP status.
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, keystore.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, keystore.ErrKeyType), errors.Is(err, jose.ErrKeyType):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, keystore.ErrQuota):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		http.Error(w, "signer unavailable", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serveCreate(w http.ResponseWriter, store keystore.KeyStore, body []byte, log *slog.Logger) {
+	var req CreateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "malformed create request", http.StatusBadRequest)
+		return
+	}
+	ref, pub, err := store.Create(keystore.KeyType(req.Type))
+	if err != nil {
+		log.Error("remote key creation failed", "type", req.Type, "error", err)
+		writeError(w, err)
+		return
+	}
+	jwk, err := jose.NewJWK(pub)
+	if err != nil {
+		log.Error("remote key creation failed", "type", req.Type, "ref", ref, "error", err)
+		writeError(w, err)
+		return
+	}
+	log.Info("remote key created", "type", req.Type, "ref", ref)
+	writeJSON(w, http.StatusCreated, &KeyResponse{Ref: ref, PublicKey: jwk})
+}
+
+func (s *Server) serveList(w http.ResponseWriter, store keystore.KeyStore, log *slog.Logger) {
+	refs, err := store.List()
+	if err != nil {
+		log.Error("remote key listing failed", "error", err)
+		writeError(w, err)
+		return
+	}
+	log.Info("remote keys listed", "count", len(refs))
+	writeJSON(w, http.StatusOK, &ListResponse{Refs: refs})
+}
+
+func (s *Server) serveKey(w http.ResponseWriter, store keystore.KeyStore, ref string, log *slog.Logger) {
+	signer, err := store.Signer(ref)
+	if err != nil {
+		log.Warn("remote key lookup failed", "ref", ref, "error", err)
+		writeError(w, err)
+		return
+	}
+	jwk, err := jose.NewJWK(signer.Public())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &KeyResponse{Ref: ref, PublicKey: jwk})
+}
+
+func (s *Server) serveDelete(w http.ResponseWriter, store keystore.KeyStore, ref string, log *slog.Logger) {
+	if err := store.Delete(ref); err != nil {
+		log.Warn("remote key deletion failed", "ref", ref, "error", err)
+		writeError(w, err)
+		return
+	}
+	log.Info("remote key deleted", "ref", ref)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serveSign(w http.ResponseWriter, store keystore.KeyStore, ref string, body []byte, log *slog.Logger) {
+	var req SignRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "malformed sign request", http.StatusBadRequest)
+		return
+	}
+	hash, ok := hashByName(req.Hash)
+	if !ok || (hash != 0 && len(req.Data) != hash.Size()) {
+		http.Error(w, "digest does not match hash function", http.StatusBadRequest)
+		return
+	}
+	// audit the content signed without the content itself
+	dataHash := sha256.Sum256(req.Data)
+	log = log.With("ref", ref, "hash", req.Hash, "data-sha256", hex.EncodeToString(dataHash[:]))
+
+	signer, err := store.Signer(ref)
+	if err != nil {
+		log.Warn("remote signature denied", "error", err)
+		writeError(w, err)
+		return
+	}
+	sig, err := signer.Sign(rand.Reader, req.Data, hash)
+	if err != nil {
+		log.Error("remote signature failed", "error", err)
+		writeError(w, err)
+		return
+	}
+	log.Info("remote signature issued")
+	writeJSON(w, http.StatusOK, &SignResponse{Signature: sig})
+}
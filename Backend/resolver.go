@@ -0,0 +1,197 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resolver resolves a DID into a Document with the “Read” operation of the
+// DID method. See Resolve for the error semantics.
+type Resolver interface {
+	Resolve(ctx context.Context, did DID) (*Document, *Meta, error)
+}
+
+// VersionResolver is a Resolver with support for the "versionId" and the
+// "versionTime" DID parameters. Either may be zero for none.
+type VersionResolver interface {
+	Resolver
+	ResolveVersion(ctx context.Context, did DID, versionID string, versionTime time.Time) (*Document, *Meta, error)
+}
+
+// Resolve implements the Resolver interface. The context is not passed on.
+func (f Resolve) Resolve(_ context.Context, did DID) (*Document, *Meta, error) {
+	return f(did)
+}
+
+// ResolveFunc binds r to ctx for use with Resolve fields.
+func ResolveFunc(ctx context.Context, r Resolver) Resolve {
+	return func(did DID) (*Document, *Meta, error) {
+		return r.Resolve(ctx, did)
+	}
+}
+
+// MethodRegistry is a Resolver which dispatches on the DID method. The zero
+// value is ready to use. Multiple goroutines may invoke methods on a
+// MethodRegistry simultaneously.
+type MethodRegistry struct {
+	mutex     sync.RWMutex
+	resolvers map[string]Resolver // by method name
+}
+
+// Register installs r for method. Any previous registration is replaced.
+func (reg *MethodRegistry) Register(method string, r Resolver) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if reg.resolvers == nil {
+		reg.resolvers = make(map[string]Resolver)
+	}
+	reg.resolvers[method] = r
+}
+
+// Unregister removes any resolver for method.
+func (reg *MethodRegistry) Unregister(method string) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	delete(reg.resolvers, method)
+}
+
+// Methods returns the names registered in alphabetical order.
+func (reg *MethodRegistry) Methods() []string {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	names := make([]string, 0, len(reg.resolvers))
+	for name := range reg.resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnsupportedMethod is the method attribute of spans for DIDs of methods not
+// registered. Clients choose the DIDs to resolve, so their method names must
+// not end up in the attributes as is, e.g., as an unbounded metric label.
+const UnsupportedMethod = "unsupported"
+
+// Resolve implements the Resolver interface. Unregistered methods get
+// ErrMethodNotSupported. Each resolution is a "did.resolve" span with the
+// method, or with UnsupportedMethod.
+func (reg *MethodRegistry) Resolve(ctx context.Context, did DID) (doc *Document, meta *Meta, err error) {
+	reg.mutex.RLock()
+	r, ok := reg.resolvers[did.Method]
+	reg.mutex.RUnlock()
+	ctx, span := StartSpan(ctx, "did.resolve", slog.String("method", spanMethod(did, ok)))
+	defer func() { span.End(err) }()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrMethodNotSupported, did.Method)
+	}
+	return r.Resolve(ctx, did)
+}
+
+// ResolveVersion implements the VersionResolver interface. Methods without
+// version support get ErrNotFound for any version.
+func (reg *MethodRegistry) ResolveVersion(ctx context.Context, did DID, versionID string, versionTime time.Time) (doc *Document, meta *Meta, err error) {
+	if versionID == "" && versionTime.IsZero() {
+		return reg.Resolve(ctx, did)
+	}
+	reg.mutex.RLock()
+	r, ok := reg.resolvers[did.Method]
+	reg.mutex.RUnlock()
+	ctx, span := StartSpan(ctx, "did.resolve", slog.String("method", spanMethod(did, ok)), slog.Bool("version", true))
+	defer func() { span.End(err) }()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrMethodNotSupported, did.Method)
+	}
+	vr, ok := r.(VersionResolver)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: DID method %q has no version support", ErrNotFound, did.Method)
+	}
+	return vr.ResolveVersion(ctx, did, versionID, versionTime)
+}
+
+// SpanMethod returns the method attribute of did, with registered when its
+// method has a resolver.
+func spanMethod(did DID, registered bool) string {
+	if registered {
+		return did.Method
+	}
+	return UnsupportedMethod
+}
+
+// ResolutionMeta is the “DID resolution metadata”, as opposed to the DID
+// document metadata in Meta.
+type ResolutionMeta struct {
+	// ContentType is the media type of the representation, if any.
+	ContentType string
+	// Error is the code of a failure, like "notFound" or "invalidDid".
+	Error string
+	// Duration is the time elapsed, which is encoded in milliseconds, as
+	// in the Universal Resolver.
+	Duration time.Duration
+}
+
+// ResolutionMetaJSON is the encoding of ResolutionMeta.
+type resolutionMetaJSON struct {
+	ContentType string `json:"contentType,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Duration    int64  `json:"duration"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (m *ResolutionMeta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resolutionMetaJSON{m.ContentType, m.Error, m.Duration.Milliseconds()})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *ResolutionMeta) UnmarshalJSON(data []byte) error {
+	var v resolutionMetaJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = ResolutionMeta{v.ContentType, v.Error, time.Duration(v.Duration) * time.Millisecond}
+	return nil
+}
+
+// ResolutionResult is the “DID resolution result”, which combines the output
+// of resolution.
+type ResolutionResult struct {
+	Document       *Document       `json:"didDocument"`
+	DocumentMeta   *Meta           `json:"didDocumentMetadata"`
+	ResolutionMeta *ResolutionMeta `json:"didResolutionMetadata"`
+}
+
+// ResolveTimed resolves did with r, with a deadline after timeout when
+// positive. The return stops on cancellation of ctx, even when r ignores the
+// context, in which case the error wraps the context error. The resolution
+// metadata is set on errors too.
+func ResolveTimed(ctx context.Context, r Resolver, did DID, timeout time.Duration) (*Document, *Meta, *ResolutionMeta, error) {
+	start := time.Now()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		doc  *Document
+		meta *Meta
+		err  error
+	}
+	done := make(chan result, 1) // no block when abandoned
+	go func() {
+		doc, meta, err := r.Resolve(ctx, did)
+		done <- result{doc, meta, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = fmt.Errorf("resolution of %s: %w", did.String(), ctx.Err())
+	}
+	return res.doc, res.meta, &ResolutionMeta{Duration: time.Since(start)}, res.err
+}
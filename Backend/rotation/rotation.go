@@ -0,0 +1,249 @@
+// Package rotation replaces verification methods with pre-rotation, in the
+// style of KERI. Each method may commit to its successor with the hash of the
+// next public key, in the NextKeyProperty. A rotation then reveals a key which
+// must match the commitment, such that a compromise of the current key alone
+// does not permit a takeover. The rotations are recorded in the KeyRotations
+// of the document metadata, for verifiers to check the chain of commitments.
+package rotation
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// NextKeyProperty is the verification method property with the commitment to
+// the next key.
+const NextKeyProperty = "nextKeyHash"
+
+// ErrCommitment signals a key which does not match the commitment of its
+// predecessor. The error wraps backend.ErrInvalid.
+var ErrCommitment = fmt.Errorf("%w: key rotation does not match the pre-rotation commitment", backend.ErrInvalid)
+
+// Commitment returns the hash of pub, as a base58btc multihash of the SHA-256
+// over the publicKeyMultibase value.
+func Commitment(pub crypto.PublicKey) (string, error) {
+	s, err := keys.Multibase(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(s))
+	return didkey.EncodeMultibase(multiformat.EncodeMultihash(multiformat.SHA2_256, sum[:])), nil
+}
+
+// Commit returns a copy of m with a commitment to next.
+func Commit(m *backend.VerificationMethod, next crypto.PublicKey) (*backend.VerificationMethod, error) {
+	c, err := Commitment(next)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := json.Marshal(c)
+	committed := *m // copy
+	committed.Additional = maps.Clone(m.Additional)
+	if committed.Additional == nil {
+		committed.Additional = make(map[string]json.RawMessage, 1)
+	}
+	committed.Additional[NextKeyProperty] = raw
+	return &committed, nil
+}
+
+// Rotate returns a copy of doc with the verification method oldKeyID replaced
+// by newKey, under the same identifier and with the same relationships. When
+// the method has a commitment, then newKey must match it. The new method
+// commits to next, if not nil. The rotation is appended to the KeyRotations of
+// meta, and meta is Updated at now. Any Proof of doc is dropped.
+func Rotate(doc *backend.Document, meta *backend.Meta, oldKeyID *backend.URL, newKey, next crypto.PublicKey, now time.Time) (*backend.Document, error) {
+	id := *oldKeyID // copy
+	if id.IsRelative() {
+		id.DID = doc.Subject
+	}
+
+	rotated := *doc     // copy
+	rotated.Proof = nil // no longer valid
+	var record *backend.KeyRotation
+	for i, m := range doc.VerificationMethods {
+		if resolved(doc, m).Equal(&id) {
+			r, rec, err := rotate(m, newKey, next, now)
+			if err != nil {
+				return nil, err
+			}
+			rotated.VerificationMethods = slices.Clone(doc.VerificationMethods)
+			rotated.VerificationMethods[i] = r
+			record = rec
+			break
+		}
+	}
+	// embedded methods
+	for _, p := range []**backend.VerificationRelationship{
+		&rotated.Authentication,
+		&rotated.AssertionMethod,
+		&rotated.KeyAgreement,
+		&rotated.CapabilityInvocation,
+		&rotated.CapabilityDelegation,
+	} {
+		if record != nil || *p == nil {
+			continue
+		}
+		for i, m := range (*p).Methods {
+			if resolved(doc, m).Equal(&id) {
+				r, rec, err := rotate(m, newKey, next, now)
+				if err != nil {
+					return nil, err
+				}
+				c := **p // copy
+				c.Methods = slices.Clone(c.Methods)
+				c.Methods[i] = r
+				*p = &c
+				record = rec
+				break
+			}
+		}
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%w: no verification method %s to rotate", backend.ErrNotFound, id.String())
+	}
+
+	record.Method = id
+	meta.KeyRotations = append(meta.KeyRotations, *record)
+	meta.Updated = now.UTC()
+	return &rotated, nil
+}
+
+// Resolved returns the ID of m, absolute.
+func resolved(doc *backend.Document, m *backend.VerificationMethod) *backend.URL {
+	id := m.ID
+	if id.IsRelative() {
+		id.DID = doc.Subject
+	}
+	return &id
+}
+
+func rotate(old *backend.VerificationMethod, newKey, next crypto.PublicKey, now time.Time) (*backend.VerificationMethod, *backend.KeyRotation, error) {
+	oldKey, err := keys.MethodKey(old)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rec backend.KeyRotation
+	rec.Time = now.UTC()
+	rec.PreviousKey, err = keys.Multibase(oldKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec.Key, err = keys.Multibase(newKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec.PreviousCommitment = old.AdditionalString(NextKeyProperty)
+	if rec.PreviousCommitment != "" {
+		if c, err := Commitment(newKey); err != nil || c != rec.PreviousCommitment {
+			return nil, nil, fmt.Errorf("%w: new key for %s", ErrCommitment, old.ID.String())
+		}
+	}
+
+	format := old.Type
+	if format != keys.JsonWebKey2020 {
+		format = keys.Multikey
+	}
+	m, err := keys.NewMethod(old.ID, old.Controller, newKey, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if next != nil {
+		m, err = Commit(m, next)
+		if err != nil {
+			return nil, nil, err
+		}
+		rec.NextCommitment = m.AdditionalString(NextKeyProperty)
+	}
+	return m, &rec, nil
+}
+
+// Verify checks the KeyRotations of meta against doc. Each rotation must
+// reveal the key committed to by the preceding state of its method, and it
+// must continue from the key of the preceding rotation. The last rotation of
+// each method must match the method in doc, if still present. Rotations away
+// from a method without commitment are accepted.
+func Verify(doc *backend.Document, meta *backend.Meta) error {
+	last := make(map[string]*backend.KeyRotation)
+	for i := range meta.KeyRotations {
+		r := &meta.KeyRotations[i]
+		pub, err := keys.FromMultibase(r.Key)
+		if err != nil {
+			return fmt.Errorf("%w: key rotation № %d: %w", backend.ErrInvalid, i+1, err)
+		}
+		if r.PreviousCommitment != "" {
+			if c, err := Commitment(pub); err != nil || c != r.PreviousCommitment {
+				return fmt.Errorf("%w: rotation № %d of %s", ErrCommitment, i+1, r.Method.String())
+			}
+		}
+
+		id := r.Method.String()
+		if prev, ok := last[id]; ok {
+			if r.PreviousKey != prev.Key {
+				return fmt.Errorf("%w: rotation № %d of %s does not continue from the previous key", backend.ErrInvalid, i+1, id)
+			}
+			if r.PreviousCommitment != prev.NextCommitment {
+				return fmt.Errorf("%w: rotation № %d of %s drops the commitment", ErrCommitment, i+1, id)
+			}
+			if r.Time.Before(prev.Time) {
+				return fmt.Errorf("%w: rotation № %d of %s out of order", backend.ErrInvalid, i+1, id)
+			}
+		}
+		last[id] = r
+	}
+
+	for id, r := range last {
+		u, _ := backend.ParseURL(id)
+		m := find(doc, u)
+		if m == nil {
+			continue // removed since
+		}
+		pub, err := keys.MethodKey(m)
+		if err != nil {
+			return err
+		}
+		s, err := keys.Multibase(pub)
+		if err != nil {
+			return err
+		}
+		if s != r.Key || m.AdditionalString(NextKeyProperty) != r.NextCommitment {
+			return fmt.Errorf("%w: verification method %s does not match its last rotation", backend.ErrInvalid, id)
+		}
+	}
+	return nil
+}
+
+// Find returns the method with id, either listed or embedded.
+func find(doc *backend.Document, id *backend.URL) *backend.VerificationMethod {
+	for _, m := range doc.VerificationMethods {
+		if resolved(doc, m).Equal(id) {
+			return m
+		}
+	}
+	for _, r := range []*backend.VerificationRelationship{
+		doc.Authentication,
+		doc.AssertionMethod,
+		doc.KeyAgreement,
+		doc.CapabilityInvocation,
+		doc.CapabilityDelegation,
+	} {
+		if r == nil {
+			continue
+		}
+		for _, m := range r.Methods {
+			if resolved(doc, m).Equal(id) {
+				return m
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package rotation
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+func newKey(t *testing.T) crypto.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestRotate(t *testing.T) {
+	k0, k1, k2, k3 := newKey(t), newKey(t), newKey(t), newKey(t)
+	subject := backend.DID{Method: "example", SpecID: "rotor"}
+	keyID := backend.URL{DID: subject, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(keyID, subject, k0, keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = Commit(m, k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &backend.Document{
+		Subject:             subject,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		Authentication:      &backend.VerificationRelationship{URIRefs: []*backend.URL{{RawFragment: "#key-1"}}},
+	}
+	meta := new(backend.Meta)
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if _, err := Rotate(doc, meta, &keyID, k2, k3, t0); !errors.Is(err, ErrCommitment) {
+		t.Errorf("rotation to uncommitted key got error %v, want ErrCommitment", err)
+	}
+	if len(meta.KeyRotations) != 0 {
+		t.Fatal("failed rotation recorded")
+	}
+
+	rotated, err := Rotate(doc, meta, &backend.URL{RawFragment: "#key-1"}, k1, k2, t0)
+	if err != nil {
+		t.Fatal("rotate error:", err)
+	}
+	if got, _ := keys.MethodKey(doc.VerificationMethods[0]); !got.(ed25519.PublicKey).Equal(k0) {
+		t.Error("original document modified")
+	}
+	rotated, err = Rotate(rotated, meta, &keyID, k2, nil, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal("second rotate error:", err)
+	}
+	if got, _ := keys.MethodKey(rotated.AuthorizedMethod(rotated.Authentication, &keyID)); !got.(ed25519.PublicKey).Equal(k2) {
+		t.Errorf("authentication got key %v after rotation", got)
+	}
+	if len(meta.KeyRotations) != 2 || !meta.Updated.Equal(t0.Add(time.Hour)) {
+		t.Fatalf("got metadata %+v", meta)
+	}
+	if err := Verify(rotated, meta); err != nil {
+		t.Error("verify error:", err)
+	}
+
+	// the history survives JSON
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded backend.Meta
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(rotated, &decoded); err != nil {
+		t.Error("verify after JSON round trip:", err)
+	}
+
+	// forged history with another key
+	forged := decoded
+	forged.KeyRotations = append([]backend.KeyRotation(nil), decoded.KeyRotations...)
+	forged.KeyRotations[0].Key, _ = keys.Multibase(k3)
+	if err := Verify(rotated, &forged); !errors.Is(err, ErrCommitment) {
+		t.Errorf("forged key got error %v, want ErrCommitment", err)
+	}
+	// document out of sync with its history
+	if err := Verify(doc, &decoded); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("stale document got error %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,441 @@
+// Package sdjwt implements Selective Disclosure for JWTs (SD-JWT), with the
+// credential format of SD-JWT VC. Issuers are DIDs, and the "kid" of the
+// issuer-signed JWT locates their key. Holders bind presentations to an
+// exchange with a Key Binding JWT.
+package sdjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// Explicit types of the JWTs
+const (
+	TypVC = "dc+sd-jwt" // issuer-signed
+	TypKB = "kb+jwt"    // Key Binding
+)
+
+// TypVCLegacy is the explicit type before draft 06 of SD-JWT VC.
+const typVCLegacy = "vc+sd-jwt"
+
+// HashAlg is the only "_sd_alg" supported.
+const hashAlg = "sha-256"
+
+// ErrDisclosure signals a disclosure that does not match the issuer-signed
+// JWT.
+var ErrDisclosure = errors.New("SD-JWT disclosure invalid")
+
+// ErrKeyBinding signals a Key Binding JWT that is absent when required, or
+// that does not verify.
+var ErrKeyBinding = errors.New("SD-JWT key binding invalid")
+
+// “The following claims MUST NOT be selectively disclosed”, conform SD-JWT VC.
+var alwaysVisible = map[string]bool{
+	"iss": true, "nbf": true, "exp": true, "cnf": true, "vct": true, "status": true,
+	"_sd": true, "_sd_alg": true, "...": true,
+}
+
+// Disclosure is the salted plain text of a claim. Name is empty for array
+// elements.
+type Disclosure struct {
+	Salt  string
+	Name  string
+	Value any
+
+	encoded string
+}
+
+// NewDisclosure returns a disclosure of an object property with a random salt.
+func NewDisclosure(name string, value any) (*Disclosure, error) {
+	var salt [16]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	d := Disclosure{Salt: base64.RawURLEncoding.EncodeToString(salt[:]), Name: name, Value: value}
+	j, err := json.Marshal([]any{d.Salt, d.Name, d.Value})
+	if err != nil {
+		return nil, err
+	}
+	d.encoded = base64.RawURLEncoding.EncodeToString(j)
+	return &d, nil
+}
+
+// ParseDisclosure decodes the encoded form of a disclosure.
+func ParseDisclosure(s string) (*Disclosure, error) {
+	j, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDisclosure, err)
+	}
+	var a []json.RawMessage
+	if err := json.Unmarshal(j, &a); err != nil {
+		return nil, fmt.Errorf("%w: not a JSON array", ErrDisclosure)
+	}
+	d := Disclosure{encoded: s}
+	switch len(a) {
+	case 2:
+		err = json.Unmarshal(a[1], &d.Value)
+	case 3:
+		if err = json.Unmarshal(a[1], &d.Name); err == nil {
+			err = json.Unmarshal(a[2], &d.Value)
+		}
+		if err == nil && alwaysVisible[d.Name] {
+			return nil, fmt.Errorf("%w: claim name %q", ErrDisclosure, d.Name)
+		}
+	default:
+		return nil, fmt.Errorf("%w: array of %d elements", ErrDisclosure, len(a))
+	}
+	if err == nil {
+		err = json.Unmarshal(a[0], &d.Salt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDisclosure, err)
+	}
+	return &d, nil
+}
+
+// String returns the encoded form.
+func (d *Disclosure) String() string { return d.encoded }
+
+// Digest returns the hash of the encoded form, as listed in "_sd".
+func (d *Disclosure) Digest() string { return digest(d.encoded) }
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Issue returns an SD-JWT with the claims, of which the top-level ones named
+// in disclose are selectively disclosable. The "iss" claim is set to the DID
+// of keyID, which is the verification method of key. The credential is bound
+// to the holder key, if not nil, with a "cnf" claim. Issue does not modify
+// claims.
+func Issue(claims map[string]any, disclose []string, holder crypto.PublicKey, keyID *backend.URL, key crypto.Signer) (string, error) {
+	if _, ok := claims["vct"].(string); !ok {
+		return "", errors.New(`SD-JWT VC needs a "vct" claim`)
+	}
+	payload := make(map[string]any, len(claims)+3)
+	for name, v := range claims {
+		payload[name] = v
+	}
+	payload["iss"] = keyID.DID.String()
+	if holder != nil {
+		jwk, err := jose.NewJWK(holder)
+		if err != nil {
+			return "", fmt.Errorf("SD-JWT holder key: %w", err)
+		}
+		payload["cnf"] = map[string]any{"jwk": jwk}
+	}
+
+	var b strings.Builder
+	digests := make([]string, 0, len(disclose))
+	for _, name := range disclose {
+		v, ok := payload[name]
+		if !ok {
+			return "", fmt.Errorf("SD-JWT claim %q to disclose absent", name)
+		}
+		if alwaysVisible[name] {
+			return "", fmt.Errorf("SD-JWT claim %q can not be selectively disclosed", name)
+		}
+		d, err := NewDisclosure(name, v)
+		if err != nil {
+			return "", err
+		}
+		delete(payload, name)
+		digests = append(digests, d.Digest())
+		b.WriteByte('~')
+		b.WriteString(d.String())
+	}
+	if len(digests) != 0 {
+		// “The Issuer MUST hide the original order of the claims”
+		sort.Strings(digests)
+		payload["_sd"] = digests
+		payload["_sd_alg"] = hashAlg
+	}
+
+	token, err := didjwt.SignTyp(TypVC, payload, keyID, key)
+	if err != nil {
+		return "", err
+	}
+	b.WriteByte('~')
+	return token + b.String(), nil
+}
+
+// Split returns the issuer-signed JWT, the encoded disclosures, and the Key
+// Binding JWT, if any, of an SD-JWT.
+func Split(sdJWT string) (token string, disclosures []string, kb string, err error) {
+	parts := strings.Split(sdJWT, "~")
+	if len(parts) < 2 {
+		return "", nil, "", errors.New(`SD-JWT has no "~" separator`)
+	}
+	for _, d := range parts[1 : len(parts)-1] {
+		if d == "" {
+			return "", nil, "", errors.New("SD-JWT has an empty disclosure")
+		}
+	}
+	return parts[0], parts[1 : len(parts)-1], parts[len(parts)-1], nil
+}
+
+// Present returns an SD-JWT with only the disclosures of the top-level claims
+// named in reveal. With holderKey not nil, the presentation gets a Key Binding
+// JWT for the nonce and the audience of the verifier.
+func Present(sdJWT string, reveal []string, holderKey crypto.Signer, nonce, audience string) (string, error) {
+	token, disclosures, kb, err := Split(sdJWT)
+	if err != nil {
+		return "", err
+	}
+	if kb != "" {
+		return "", errors.New("SD-JWT is a presentation already")
+	}
+
+	var b strings.Builder
+	b.WriteString(token)
+	for _, s := range disclosures {
+		d, err := ParseDisclosure(s)
+		if err != nil {
+			return "", err
+		}
+		for _, name := range reveal {
+			if d.Name != "" && d.Name == name {
+				b.WriteByte('~')
+				b.WriteString(s)
+				break
+			}
+		}
+	}
+	b.WriteByte('~')
+	if holderKey == nil {
+		return b.String(), nil
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"iat":     time.Now().Unix(),
+		"aud":     audience,
+		"nonce":   nonce,
+		"sd_hash": digest(b.String()),
+	})
+	if err != nil {
+		return "", err
+	}
+	kb, err = jose.Sign(jose.Header{Typ: TypKB}, payload, holderKey)
+	if err != nil {
+		return "", err
+	}
+	return b.String() + kb, nil
+}
+
+// Verifier checks SD-JWTs against the DID documents of their issuer.
+type Verifier struct {
+	Resolver backend.Resolver
+
+	// Leeway is the tolerance for clock skew on the time claims.
+	Leeway time.Duration
+
+	// RequireKeyBinding denies presentations without a Key Binding JWT.
+	RequireKeyBinding bool
+}
+
+// Verify returns the claims of a valid SD-JWT, with each disclosure in place,
+// and with the issuer DID. Claims that were not disclosed are absent. The nonce
+// and the audience apply to the Key Binding JWT, if any.
+func (v *Verifier) Verify(ctx context.Context, sdJWT, nonce, audience string, now time.Time) (map[string]any, backend.DID, error) {
+	token, encoded, kb, err := Split(sdJWT)
+	if err != nil {
+		return nil, backend.DID{}, err
+	}
+	jws, err := jose.ParseCompact(token)
+	if err != nil {
+		return nil, backend.DID{}, err
+	}
+	if jws.Header.Typ != TypVC && jws.Header.Typ != typVCLegacy {
+		return nil, backend.DID{}, fmt.Errorf("SD-JWT typ %q, want %q", jws.Header.Typ, TypVC)
+	}
+	var payload map[string]any
+	jwtVerifier := didjwt.Verifier{Resolver: v.Resolver, Leeway: v.Leeway}
+	issuer, err := jwtVerifier.Verify(ctx, token, now, &payload)
+	if err != nil {
+		return nil, backend.DID{}, err
+	}
+	if alg, ok := payload["_sd_alg"]; ok && alg != hashAlg {
+		return nil, backend.DID{}, fmt.Errorf("SD-JWT _sd_alg %q not supported", alg)
+	}
+
+	disclosures := make(map[string]*Disclosure, len(encoded))
+	for _, s := range encoded {
+		d, err := ParseDisclosure(s)
+		if err != nil {
+			return nil, backend.DID{}, err
+		}
+		sum := d.Digest()
+		if _, ok := disclosures[sum]; ok {
+			return nil, backend.DID{}, fmt.Errorf("%w: duplicate %s", ErrDisclosure, s)
+		}
+		disclosures[sum] = d
+	}
+	claims, err := reconstruct(payload, disclosures)
+	if err != nil {
+		return nil, backend.DID{}, err
+	}
+	// “… MUST be rejected if … not referenced by digest value”
+	if len(disclosures) != 0 {
+		return nil, backend.DID{}, fmt.Errorf("%w: %d disclosures without digest in SD-JWT", ErrDisclosure, len(disclosures))
+	}
+	delete(claims, "_sd_alg")
+
+	if kb == "" {
+		if v.RequireKeyBinding {
+			return nil, backend.DID{}, fmt.Errorf("%w: no Key Binding JWT", ErrKeyBinding)
+		}
+		return claims, issuer, nil
+	}
+	if err := v.verifyKeyBinding(claims, sdJWT[:len(sdJWT)-len(kb)], kb, nonce, audience, now); err != nil {
+		return nil, backend.DID{}, err
+	}
+	return claims, issuer, nil
+}
+
+// Reconstruct returns v with the disclosures in place. Each disclosure used
+// is removed from the map.
+func reconstruct(v any, disclosures map[string]*Disclosure) (map[string]any, error) {
+	out, err := reconstructValue(v, disclosures)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := out.(map[string]any)
+	if !ok {
+		return nil, errors.New("SD-JWT payload is not a JSON object")
+	}
+	return claims, nil
+}
+
+func reconstructValue(v any, disclosures map[string]*Disclosure) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for name, e := range v {
+			if name == "_sd" {
+				continue
+			}
+			e, err := reconstructValue(e, disclosures)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = e
+		}
+		digests, _ := v["_sd"].([]any)
+		for _, sum := range digests {
+			s, ok := sum.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: _sd with %T", ErrDisclosure, sum)
+			}
+			d, ok := disclosures[s]
+			if !ok {
+				continue // not disclosed, or a decoy
+			}
+			delete(disclosures, s)
+			if d.Name == "" {
+				return nil, fmt.Errorf("%w: array element %s in _sd", ErrDisclosure, d.encoded)
+			}
+			if _, ok := out[d.Name]; ok {
+				return nil, fmt.Errorf("%w: claim %q exists already", ErrDisclosure, d.Name)
+			}
+			e, err := reconstructValue(d.Value, disclosures)
+			if err != nil {
+				return nil, err
+			}
+			out[d.Name] = e
+		}
+		return out, nil
+
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, e := range v {
+			if m, ok := e.(map[string]any); ok && len(m) == 1 {
+				if s, ok := m["..."].(string); ok {
+					d, ok := disclosures[s]
+					if !ok {
+						continue // not disclosed, or a decoy
+					}
+					delete(disclosures, s)
+					if d.Name != "" {
+						return nil, fmt.Errorf("%w: object property %s in array", ErrDisclosure, d.encoded)
+					}
+					e = d.Value
+				}
+			}
+			e, err := reconstructValue(e, disclosures)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, e)
+		}
+		return out, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// VerifyKeyBinding checks the Key Binding JWT against the "cnf" key in the
+// claims, with presented as the SD-JWT without the Key Binding JWT.
+func (v *Verifier) verifyKeyBinding(claims map[string]any, presented, kb, nonce, audience string, now time.Time) error {
+	cnf, _ := claims["cnf"].(map[string]any)
+	if cnf["jwk"] == nil {
+		return fmt.Errorf(`%w: no "cnf" with a "jwk" in SD-JWT`, ErrKeyBinding)
+	}
+	jwkJSON, err := json.Marshal(cnf["jwk"])
+	if err != nil {
+		return err
+	}
+	var jwk jose.JWK
+	if err := json.Unmarshal(jwkJSON, &jwk); err != nil {
+		return fmt.Errorf("%w: cnf: %w", ErrKeyBinding, err)
+	}
+	pub, err := jwk.PublicKey()
+	if err != nil {
+		return fmt.Errorf("%w: cnf: %w", ErrKeyBinding, err)
+	}
+
+	jws, err := jose.ParseCompact(kb)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyBinding, err)
+	}
+	if jws.Header.Typ != TypKB {
+		return fmt.Errorf("%w: typ %q, want %q", ErrKeyBinding, jws.Header.Typ, TypKB)
+	}
+	if err := jws.Verify(pub); err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyBinding, err)
+	}
+	var c struct {
+		IssuedAt int64  `json:"iat"`
+		Audience string `json:"aud"`
+		Nonce    string `json:"nonce"`
+		SDHash   string `json:"sd_hash"`
+	}
+	if err := json.Unmarshal(jws.Payload, &c); err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyBinding, err)
+	}
+	switch {
+	case c.Nonce != nonce:
+		return fmt.Errorf("%w: nonce %q does not match", ErrKeyBinding, c.Nonce)
+	case c.Audience != audience:
+		return fmt.Errorf("%w: audience %q does not match", ErrKeyBinding, c.Audience)
+	case c.SDHash != digest(presented):
+		return fmt.Errorf("%w: sd_hash does not match the presentation", ErrKeyBinding)
+	case c.IssuedAt == 0 || now.Add(v.Leeway).Unix() < c.IssuedAt:
+		return fmt.Errorf("%w: iat absent or in the future", ErrKeyBinding)
+	}
+	return nil
+}
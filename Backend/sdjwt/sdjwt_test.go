@@ -0,0 +1,159 @@
+package sdjwt
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+func TestParseDisclosure(t *testing.T) {
+	// example from the SD-JWT specification
+	d, err := ParseDisclosure("WyJfMjZiYzRMVC1hYzZxMktJNmNCVzVlcyIsICJmYW1pbHlfbmFtZSIsICJNw7ZiaXVzIl0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Salt != "_26bc4LT-ac6q2KI6cBW5es" || d.Name != "family_name" || d.Value != "Möbius" {
+		t.Errorf("got %+v", d)
+	}
+	const want = "X9yH0Ajrdm1Oij4tWso9UzzKJvPoDxwmuEcO3XAdRC0"
+	if got := d.Digest(); got != want {
+		t.Errorf("got digest %q, want %q", got, want)
+	}
+
+	for _, s := range []string{
+		"WyJzYWx0IiwgIl9zZCIsIDFd", // ["salt", "_sd", 1]
+		"WyJzYWx0Il0",              // ["salt"]
+		"e30",                      // {}
+		"!",
+	} {
+		if _, err := ParseDisclosure(s); !errors.Is(err, ErrDisclosure) {
+			t.Errorf("%q got error %v, want ErrDisclosure", s, err)
+		}
+	}
+}
+
+func TestIssuePresentVerify(t *testing.T) {
+	issuerKey, _ := keys.Generate(keys.P256)
+	issuerSigner, _ := keys.Signer(issuerKey)
+	issuer, _ := didkey.New(issuerSigner.Public())
+	keyID := &backend.URL{DID: issuer, RawFragment: "#" + issuer.SpecID}
+
+	holderKey, _ := keys.Generate(keys.Ed25519)
+	holderSigner, _ := keys.Signer(holderKey)
+
+	claims := map[string]any{
+		"vct":         "https://credentials.example/identity",
+		"given_name":  "Erika",
+		"family_name": "Mustermann",
+		"birthdate":   "1963-08-12",
+	}
+	sdJWT, err := Issue(claims, []string{"given_name", "family_name", "birthdate"}, holderSigner.Public(), keyID, issuerSigner)
+	if err != nil {
+		t.Fatal("issue error:", err)
+	}
+	if _, disclosures, kb, _ := Split(sdJWT); len(disclosures) != 3 || kb != "" {
+		t.Fatalf("got %d disclosures and Key Binding JWT %q", len(disclosures), kb)
+	}
+	if len(claims) != 4 {
+		t.Error("claims modified")
+	}
+
+	presentation, err := Present(sdJWT, []string{"birthdate"}, holderSigner, "n-0S6_WzA2Mj", "https://verifier.example")
+	if err != nil {
+		t.Fatal("present error:", err)
+	}
+
+	v := &Verifier{Resolver: new(didkey.Resolver), RequireKeyBinding: true}
+	got, gotIssuer, err := v.Verify(context.Background(), presentation, "n-0S6_WzA2Mj", "https://verifier.example", time.Now())
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if gotIssuer != issuer {
+		t.Errorf("got issuer %s, want %s", gotIssuer, issuer)
+	}
+	if got["birthdate"] != "1963-08-12" || got["vct"] != claims["vct"] {
+		t.Errorf("got claims %v", got)
+	}
+	for _, name := range []string{"given_name", "family_name", "_sd", "_sd_alg"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("claim %q present", name)
+		}
+	}
+
+	_, _, err = v.Verify(context.Background(), presentation, "replay", "https://verifier.example", time.Now())
+	if !errors.Is(err, ErrKeyBinding) {
+		t.Errorf("got error %v for nonce mismatch, want ErrKeyBinding", err)
+	}
+
+	// disclosure added after the Key Binding
+	token, disclosures, kb, _ := Split(presentation)
+	_, all, _, _ := Split(sdJWT)
+	extended := token + "~" + strings.Join(append(disclosures, all[0]), "~") + "~" + kb
+	_, _, err = v.Verify(context.Background(), extended, "n-0S6_WzA2Mj", "https://verifier.example", time.Now())
+	if !errors.Is(err, ErrKeyBinding) {
+		t.Errorf("got error %v for disclosure outside sd_hash, want ErrKeyBinding", err)
+	}
+
+	// Key Binding required
+	plain, err := Present(sdJWT, []string{"given_name"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := v.Verify(context.Background(), plain, "", "", time.Now()); !errors.Is(err, ErrKeyBinding) {
+		t.Errorf("got error %v without Key Binding, want ErrKeyBinding", err)
+	}
+	v.RequireKeyBinding = false
+	if got, _, err := v.Verify(context.Background(), plain, "", "", time.Now()); err != nil {
+		t.Error("verify error without Key Binding:", err)
+	} else if got["given_name"] != "Erika" {
+		t.Errorf("got claims %v", got)
+	}
+
+	// foreign disclosure
+	other, _ := NewDisclosure("given_name", "Mallory")
+	forged := strings.TrimSuffix(plain, "~") + "~" + other.String() + "~"
+	if _, _, err := v.Verify(context.Background(), forged, "", "", time.Now()); !errors.Is(err, ErrDisclosure) {
+		t.Errorf("got error %v for foreign disclosure, want ErrDisclosure", err)
+	}
+}
+
+func TestReconstruct(t *testing.T) {
+	street, _ := NewDisclosure("street", "Schulstr. 12")
+	country, _ := NewDisclosure("", "DE")
+	payload := map[string]any{
+		"address": map[string]any{
+			"_sd":      []any{street.Digest(), "decoy"},
+			"locality": "Schulpforta",
+		},
+		"nationalities": []any{
+			map[string]any{"...": country.Digest()},
+			map[string]any{"...": "undisclosed"},
+			"FR",
+		},
+	}
+	disclosures := map[string]*Disclosure{street.Digest(): street, country.Digest(): country}
+	got, err := reconstruct(payload, disclosures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"address": map[string]any{
+			"street":   "Schulstr. 12",
+			"locality": "Schulpforta",
+		},
+		"nationalities": []any{"DE", "FR"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(disclosures) != 0 {
+		t.Errorf("%d disclosures unused", len(disclosures))
+	}
+}
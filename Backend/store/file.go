@@ -0,0 +1,164 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// FileExt is the name extension of histories in a File store.
+const fileExt = ".jsonl"
+
+// File is a Store in a directory, with one file of JSON lines per DID. Files
+// are named by the SHA-256 of the DID, as DIDs may exceed the name limits of
+// file systems. Updates replace files atomically with a rename. Multiple
+// processes must not share a directory.
+type File struct {
+	Dir string
+
+	mutex sync.RWMutex
+}
+
+func (s *File) path(did backend.DID) string {
+	sum := sha256.Sum256([]byte(did.String()))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+fileExt)
+}
+
+// Put implements the Store interface.
+func (s *File) Put(doc *backend.Document, meta *backend.Meta) (*backend.Meta, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if doc == nil {
+		return nil, fmt.Errorf("%w: no document", backend.ErrInvalid)
+	}
+	path := s.path(doc.Subject)
+	lines, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	history, err := decode(lines)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	v, err := next(history, doc, meta, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	line, err := encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, append(lines, line...)); err != nil {
+		return nil, err
+	}
+	m := *v.Meta
+	return &m, nil
+}
+
+// WriteFile replaces the content of path atomically.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Get implements the Store interface.
+func (s *File) Get(did backend.DID) (*backend.Document, *backend.Meta, error) {
+	history, err := s.History(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := history[len(history)-1]
+	return v.Document, v.Meta, nil
+}
+
+// History implements the Store interface.
+func (s *File) History(did backend.DID) ([]Version, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	path := s.path(did)
+	lines, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s not in store", backend.ErrNotFound, did.String())
+		}
+		return nil, err
+	}
+	history, err := decode(lines)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("%w: %s not in store", backend.ErrNotFound, did.String())
+	}
+	return history, nil
+}
+
+// Delete implements the Store interface.
+func (s *File) Delete(did backend.DID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := os.Remove(s.path(did))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s not in store", backend.ErrNotFound, did.String())
+	}
+	return err
+}
+
+// List implements the Store interface. The DIDs come from the first version
+// in each file.
+func (s *File) List() ([]backend.DID, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var dids []backend.DID
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		path := filepath.Join(s.Dir, e.Name())
+		lines, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		history, err := decode(lines)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(history) != 0 {
+			dids = append(dids, history[0].Document.Subject)
+		}
+	}
+	sort.Slice(dids, func(i, j int) bool {
+		return dids[i].String() < dids[j].String()
+	})
+	return dids, nil
+}
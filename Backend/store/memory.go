@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Memory is a volatile Store. Documents are copied in and out, such that
+// callers may modify them freely. The zero value is ready for use.
+type Memory struct {
+	mutex     sync.RWMutex
+	histories map[string][]byte // JSON lines by DID
+}
+
+// Put implements the Store interface.
+func (s *Memory) Put(doc *backend.Document, meta *backend.Meta) (*backend.Meta, error) {
+	if doc == nil {
+		return nil, fmt.Errorf("%w: no document", backend.ErrInvalid)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := doc.Subject.String()
+	history, err := decode(s.histories[key])
+	if err != nil {
+		return nil, err
+	}
+	v, err := next(history, doc, meta, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	line, err := encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if s.histories == nil {
+		s.histories = make(map[string][]byte)
+	}
+	s.histories[key] = append(s.histories[key], line...)
+	m := *v.Meta
+	return &m, nil
+}
+
+// Get implements the Store interface.
+func (s *Memory) Get(did backend.DID) (*backend.Document, *backend.Meta, error) {
+	history, err := s.History(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := history[len(history)-1]
+	return v.Document, v.Meta, nil
+}
+
+// History implements the Store interface.
+func (s *Memory) History(did backend.DID) ([]Version, error) {
+	s.mutex.RLock()
+	lines, ok := s.histories[did.String()]
+	s.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not in store", backend.ErrNotFound, did.String())
+	}
+	return decode(lines)
+}
+
+// Delete implements the Store interface.
+func (s *Memory) Delete(did backend.DID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := did.String()
+	if _, ok := s.histories[key]; !ok {
+		return fmt.Errorf("%w: %s not in store", backend.ErrNotFound, key)
+	}
+	delete(s.histories, key)
+	return nil
+}
+
+// List implements the Store interface.
+func (s *Memory) List() ([]backend.DID, error) {
+	s.mutex.RLock()
+	keys := make([]string, 0, len(s.histories))
+	for k := range s.histories {
+		keys = append(keys, k)
+	}
+	s.mutex.RUnlock()
+	sort.Strings(keys)
+
+	dids := make([]backend.DID, len(keys))
+	for i, k := range keys {
+		did, err := backend.Parse(k)
+		if err != nil {
+			return nil, err
+		}
+		dids[i] = did
+	}
+	return dids, nil
+}
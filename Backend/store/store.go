@@ -0,0 +1,172 @@
+// Package store persists DID documents with their version history, for the
+// documents an application creates or resolves.
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Store is a versioned collection of DID documents. Errors on unknown DIDs
+// wrap backend.ErrNotFound. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put adds a version for the subject of doc. The metadata is optional.
+	// The Store sets the VersionID, Created and Updated when absent. Version
+	// IDs are unique per DID, with numeric ones increasing monotonically.
+	// Updates can not precede the previous version. Violations of either
+	// wrap backend.ErrInvalid.
+	Put(doc *backend.Document, meta *backend.Meta) (*backend.Meta, error)
+
+	// Get returns the latest version of did.
+	Get(did backend.DID) (*backend.Document, *backend.Meta, error)
+
+	// Delete removes did with its entire history.
+	Delete(did backend.DID) error
+
+	// List returns all DIDs in the Store in ascending order.
+	List() ([]backend.DID, error)
+
+	// History returns all versions of did, oldest first, with the
+	// NextVersionID and NextUpdate set accordingly.
+	History(did backend.DID) ([]Version, error)
+}
+
+// Version is a revision of a DID document.
+type Version struct {
+	Document *backend.Document `json:"didDocument"`
+	Meta     *backend.Meta     `json:"didDocumentMetadata"`
+}
+
+// Next returns the version for a Put of doc with meta onto history.
+func next(history []Version, doc *backend.Document, meta *backend.Meta, now time.Time) (Version, error) {
+	if doc == nil || doc.Subject.Method == "" {
+		return Version{}, fmt.Errorf("%w: document without subject", backend.ErrInvalid)
+	}
+	m := new(backend.Meta)
+	if meta != nil {
+		*m = *meta
+	}
+	m.NextVersionID, m.NextUpdate = "", time.Time{}
+
+	// version identifiers are unique, and numeric ones only increase
+	seq := len(history)
+	for _, v := range history {
+		if m.VersionID != "" && v.Meta.VersionID == m.VersionID {
+			return Version{}, fmt.Errorf("%w: version ID %q of %s exists", backend.ErrInvalid, m.VersionID, doc.Subject.String())
+		}
+		if n, err := strconv.Atoi(v.Meta.VersionID); err == nil && n > seq {
+			seq = n
+		}
+	}
+	if m.VersionID == "" {
+		m.VersionID = strconv.Itoa(seq + 1)
+	}
+
+	now = now.UTC().Truncate(time.Second)
+	if len(history) == 0 {
+		if m.Created.IsZero() {
+			m.Created = now
+		}
+		return Version{Document: doc, Meta: m}, nil
+	}
+	if m.Created.IsZero() {
+		m.Created = history[0].Meta.Created
+	}
+	// “If a DID document has not been updated, this property MAY be
+	// omitted.”
+	prev := effective(history[len(history)-1].Meta)
+	switch {
+	case m.Updated.IsZero():
+		// clocks may go backwards
+		m.Updated = now
+		if m.Updated.Before(prev) {
+			m.Updated = prev
+		}
+	case m.Updated.Before(prev):
+		return Version{}, fmt.Errorf("%w: update time %s of %s precedes version %q", backend.ErrInvalid, m.Updated.Format(time.RFC3339), doc.Subject.String(), history[len(history)-1].Meta.VersionID)
+	}
+	return Version{Document: doc, Meta: m}, nil
+}
+
+// Effective returns when the version of meta came into effect.
+func effective(meta *backend.Meta) time.Time {
+	if meta.Updated.IsZero() {
+		return meta.Created
+	}
+	return meta.Updated
+}
+
+// Encode returns v as a JSON line.
+func encode(v Version) ([]byte, error) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// Decode parses the JSON lines of a history.
+func decode(lines []byte) ([]Version, error) {
+	var history []Version
+	scanner := bufio.NewScanner(bytes.NewReader(lines))
+	scanner.Buffer(nil, len(lines)+1)
+	for scanner.Scan() {
+		var v Version
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("DID document store version № %d: %w", len(history)+1, err)
+		}
+		if v.Document == nil || v.Meta == nil {
+			return nil, fmt.Errorf("DID document store version № %d incomplete", len(history)+1)
+		}
+		history = append(history, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(history); i++ {
+		history[i-1].Meta.NextVersionID = history[i].Meta.VersionID
+		history[i-1].Meta.NextUpdate = history[i].Meta.Updated
+	}
+	return history, nil
+}
+
+// Resolver reads from a Store.
+type Resolver struct {
+	Store
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r Resolver) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return r.Get(did)
+}
+
+// ResolveVersion implements the backend.VersionResolver interface. A version
+// time selects the last version updated (or created) at or before it.
+func (r Resolver) ResolveVersion(_ context.Context, did backend.DID, versionID string, versionTime time.Time) (*backend.Document, *backend.Meta, error) {
+	history, err := r.History(did)
+	if err != nil {
+		return nil, nil, err
+	}
+	var match *Version
+	for i := range history {
+		v := &history[i]
+		if versionID != "" && v.Meta.VersionID != versionID {
+			continue
+		}
+		if !versionTime.IsZero() && effective(v.Meta).After(versionTime) {
+			continue
+		}
+		match = v
+	}
+	if match == nil {
+		return nil, nil, fmt.Errorf("%w: no such version of %s", backend.ErrNotFound, did.String())
+	}
+	return match.Document, match.Meta, nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+func testStore(t *testing.T, s Store) {
+	alice := backend.DID{Method: "example", SpecID: "alice"}
+	bob := backend.DID{Method: "example", SpecID: "bob"}
+
+	if _, _, err := s.Get(alice); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("empty store got error %v, want ErrNotFound", err)
+	}
+	meta, err := s.Put(&backend.Document{Subject: alice}, nil)
+	if err != nil {
+		t.Fatal("put error:", err)
+	}
+	if meta.VersionID != "1" || meta.Created.IsZero() || !meta.Updated.IsZero() {
+		t.Errorf("first put got meta %+v", meta)
+	}
+	meta, err = s.Put(&backend.Document{Subject: alice, AlsoKnownAs: []string{"https://alice.example"}}, nil)
+	if err != nil {
+		t.Fatal("put error:", err)
+	}
+	if meta.VersionID != "2" || meta.Updated.IsZero() {
+		t.Errorf("second put got meta %+v", meta)
+	}
+	if _, err := s.Put(&backend.Document{Subject: bob}, &backend.Meta{VersionID: "a1"}); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if _, err := s.Put(&backend.Document{Subject: alice}, &backend.Meta{VersionID: "2"}); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("put with existing version ID got error %v, want ErrInvalid", err)
+	}
+	if _, err := s.Put(&backend.Document{Subject: alice}, &backend.Meta{Updated: meta.Updated.Add(-time.Second)}); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("put with update before previous got error %v, want ErrInvalid", err)
+	}
+	if _, err := s.Put(&backend.Document{}, nil); !errors.Is(err, backend.ErrInvalid) {
+		t.Errorf("put without subject got error %v, want ErrInvalid", err)
+	}
+
+	doc, meta, err := s.Get(alice)
+	if err != nil || len(doc.AlsoKnownAs) != 1 || meta.VersionID != "2" {
+		t.Errorf("get got document %+v, meta %+v, error %v", doc, meta, err)
+	}
+	history, err := s.History(alice)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("got history %+v, error %v", history, err)
+	}
+	if got := history[0].Meta.NextVersionID; got != "2" {
+		t.Errorf("got next version ID %q in history, want 2", got)
+	}
+	if dids, err := s.List(); err != nil || len(dids) != 2 || !dids[0].Equal(alice) || !dids[1].Equal(bob) {
+		t.Errorf("got DIDs %v, error %v", dids, err)
+	}
+
+	r := Resolver{s}
+	if _, meta, err := r.ResolveVersion(context.Background(), alice, "1", time.Time{}); err != nil || meta.VersionID != "1" || meta.NextVersionID != "2" || meta.NextUpdate.IsZero() {
+		t.Errorf("version 1 got meta %+v, error %v", meta, err)
+	}
+	if _, meta, err := r.ResolveVersion(context.Background(), alice, "", history[0].Meta.Created); err != nil || meta.NextVersionID == "" && meta.VersionID != "2" {
+		t.Errorf("version time of creation got meta %+v, error %v", meta, err)
+	}
+	if _, _, err := r.ResolveVersion(context.Background(), alice, "", history[0].Meta.Created.Add(-time.Second)); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("version time before creation got error %v, want ErrNotFound", err)
+	}
+	if _, meta, err := r.ResolveVersion(context.Background(), bob, "", time.Now().Add(time.Minute)); err != nil || meta.VersionID != "a1" {
+		t.Errorf("version time got meta %+v, error %v", meta, err)
+	}
+	if _, _, err := r.ResolveVersion(context.Background(), alice, "3", time.Time{}); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("version 3 got error %v, want ErrNotFound", err)
+	}
+
+	if err := s.Delete(alice); err != nil {
+		t.Fatal("delete error:", err)
+	}
+	if err := s.Delete(alice); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("second delete got error %v, want ErrNotFound", err)
+	}
+	if _, _, err := r.Resolve(context.Background(), alice); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("deleted got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, new(Memory))
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	testStore(t, &File{Dir: dir})
+
+	// across restarts
+	did := backend.DID{Method: "example", SpecID: "carol"}
+	if _, err := (&File{Dir: dir}).Put(&backend.Document{Subject: did}, nil); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if _, meta, err := (&File{Dir: dir}).Get(did); err != nil || meta.VersionID != "1" {
+		t.Errorf("reopen got meta %+v, error %v", meta, err)
+	}
+}
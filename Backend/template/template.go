@@ -0,0 +1,360 @@
+// Package template provisions DIDs from parameterized documents, for the
+// uniform onboarding of many departments or devices.
+package template
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// ErrParam signals a missing, an unknown or an unresolved parameter.
+var ErrParam = errors.New("template parameter mismatch")
+
+// Relationship names, as in the DID document
+const (
+	Authentication       = "authentication"
+	AssertionMethod      = "assertionMethod"
+	KeyAgreement         = "keyAgreement"
+	CapabilityInvocation = "capabilityInvocation"
+	CapabilityDelegation = "capabilityDelegation"
+)
+
+// Template is a DID document with placeholders. String values in Document may
+// reference parameters as "{{name}}". The reserved "{{did}}" is the subject.
+// Key slots add a verification method each, with a key generated on
+// provisioning.
+type Template struct {
+	Name   string  `json:"name"`
+	Params []Param `json:"params,omitempty"`
+
+	// Preset names a policy from Presets, which applies when Keys is empty.
+	Preset string    `json:"preset,omitempty"`
+	Keys   []KeySlot `json:"keys,omitempty"`
+
+	// Document is the JSON base, without verification methods for the
+	// key slots. The "id" property is set on fill.
+	Document json.RawMessage `json:"document,omitempty"`
+}
+
+// Param is a template parameter.
+type Param struct {
+	Name     string `json:"name"`
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// KeySlot is a placeholder for a key.
+type KeySlot struct {
+	// Fragment identifies the verification method within the document,
+	// without the leading '#'.
+	Fragment string `json:"id"`
+
+	Type keystore.KeyType `json:"type"`
+
+	// Relationships lists the verification relationships for the key, such
+	// as Authentication.
+	Relationships []string `json:"relationships"`
+}
+
+// Presets are the policy options for Template.Preset.
+var Presets = map[string][]KeySlot{
+	// one hardware-friendly key for all purposes
+	"device": {
+		{"key-1", keystore.P256, []string{Authentication, AssertionMethod}},
+	},
+	// separation of duties
+	"department": {
+		{"auth-1", keystore.Ed25519, []string{Authentication}},
+		{"assert-1", keystore.Ed25519, []string{AssertionMethod}},
+		{"admin-1", keystore.Ed25519, []string{CapabilityInvocation, CapabilityDelegation}},
+	},
+	// credential issuance by services
+	"issuer": {
+		{"auth-1", keystore.Ed25519, []string{Authentication}},
+		{"assert-1", keystore.P256, []string{AssertionMethod}},
+	},
+}
+
+// Slots returns the key slots in effect.
+func (t *Template) Slots() ([]KeySlot, error) {
+	if len(t.Keys) != 0 {
+		return t.Keys, nil
+	}
+	if t.Preset == "" {
+		return nil, nil
+	}
+	slots, ok := Presets[t.Preset]
+	if !ok {
+		return nil, fmt.Errorf("template %q: unknown preset %q", t.Name, t.Preset)
+	}
+	return slots, nil
+}
+
+// Args returns the parameter values with defaults applied. Each of the
+// parameters must be declared.
+func (t *Template) args(params map[string]string) (map[string]string, error) {
+	args := make(map[string]string, len(t.Params))
+	for _, p := range t.Params {
+		v, ok := params[p.Name]
+		switch {
+		case ok:
+			args[p.Name] = v
+		case p.Required:
+			return nil, fmt.Errorf("%w: template %q requires %q", ErrParam, t.Name, p.Name)
+		default:
+			args[p.Name] = p.Default
+		}
+	}
+	for name := range params {
+		if _, ok := args[name]; !ok {
+			return nil, fmt.Errorf("%w: template %q has no %q", ErrParam, t.Name, name)
+		}
+	}
+	return args, nil
+}
+
+// Fill returns the document for subject, with a public key per slot.
+func (t *Template) Fill(subject backend.DID, params map[string]string, keys map[string]crypto.PublicKey) (*backend.Document, error) {
+	args, err := t.args(params)
+	if err != nil {
+		return nil, err
+	}
+	args["did"] = subject.String()
+
+	doc := new(backend.Document)
+	if len(t.Document) != 0 {
+		var tree any
+		if err := json.Unmarshal(t.Document, &tree); err != nil {
+			return nil, fmt.Errorf("template %q document: %w", t.Name, err)
+		}
+		tree, err = substitute(tree, args)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", t.Name, err)
+		}
+		if m, ok := tree.(map[string]any); ok {
+			m["id"] = args["did"]
+		}
+		filled, err := json.Marshal(tree)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(filled, doc); err != nil {
+			return nil, fmt.Errorf("template %q document: %w", t.Name, err)
+		}
+	}
+	doc.Subject = subject
+
+	slots, err := t.Slots()
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		pub, ok := keys[slot.Fragment]
+		if !ok {
+			return nil, fmt.Errorf("template %q: no key for slot %q", t.Name, slot.Fragment)
+		}
+		m, err := jose.NewMethod(backend.URL{DID: subject, RawFragment: "#" + slot.Fragment}, subject, pub)
+		if err != nil {
+			return nil, fmt.Errorf("template %q slot %q: %w", t.Name, slot.Fragment, err)
+		}
+		doc.VerificationMethods = append(doc.VerificationMethods, m)
+		for _, name := range slot.Relationships {
+			r, err := relationship(doc, name)
+			if err != nil {
+				return nil, fmt.Errorf("template %q slot %q: %w", t.Name, slot.Fragment, err)
+			}
+			r.URIRefs = append(r.URIRefs, &backend.URL{RawFragment: "#" + slot.Fragment})
+		}
+	}
+	return doc, nil
+}
+
+// Relationship returns the named relationship of doc, allocated on demand.
+func relationship(doc *backend.Document, name string) (*backend.VerificationRelationship, error) {
+	var p **backend.VerificationRelationship
+	switch name {
+	case Authentication:
+		p = &doc.Authentication
+	case AssertionMethod:
+		p = &doc.AssertionMethod
+	case KeyAgreement:
+		p = &doc.KeyAgreement
+	case CapabilityInvocation:
+		p = &doc.CapabilityInvocation
+	case CapabilityDelegation:
+		p = &doc.CapabilityDelegation
+	default:
+		return nil, fmt.Errorf("unknown verification relationship %q", name)
+	}
+	if *p == nil {
+		*p = new(backend.VerificationRelationship)
+	}
+	return *p, nil
+}
+
+// Substitute replaces the placeholders in the strings of a JSON tree.
+func substitute(v any, args map[string]string) (any, error) {
+	switch v := v.(type) {
+	case string:
+		var buf strings.Builder
+		for {
+			i := strings.Index(v, "{{")
+			if i < 0 {
+				break
+			}
+			end := strings.Index(v[i:], "}}")
+			if end < 0 {
+				break
+			}
+			name := v[i+2 : i+end]
+			arg, ok := args[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: placeholder %q not declared", ErrParam, name)
+			}
+			buf.WriteString(v[:i])
+			buf.WriteString(arg)
+			v = v[i+end+2:]
+		}
+		buf.WriteString(v)
+		return buf.String(), nil
+
+	case []any:
+		for i := range v {
+			var err error
+			v[i], err = substitute(v[i], args)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		for k := range v {
+			var err error
+			v[k], err = substitute(v[k], args)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Provisioner onboards DIDs from templates.
+type Provisioner struct {
+	Keys keystore.KeyStore
+
+	// Method is the DID method for new subjects. The method-specific
+	// identifier is random.
+	Method string
+
+	// Register records the new DID, with the compact JWS of the document
+	// by its first authentication key as proof of possession.
+	Register func(ctx context.Context, doc *backend.Document, proof string) error
+
+	Log *slog.Logger // nil for slog.Default
+}
+
+func (p *Provisioner) log() *slog.Logger {
+	if p.Log != nil {
+		return p.Log
+	}
+	return slog.Default()
+}
+
+// Provisioned is the outcome of a Provision.
+type Provisioned struct {
+	Document *backend.Document `json:"didDocument"`
+
+	// KeyRefs has the keystore reference per key slot.
+	KeyRefs map[string]string `json:"keyRefs"`
+
+	// Proof is the compact JWS of Document.
+	Proof string `json:"proof"`
+}
+
+// Provision generates the keys for t, fills the template, and registers the
+// DID. Keys are deleted again on failure.
+func (p *Provisioner) Provision(ctx context.Context, t *Template, params map[string]string) (_ *Provisioned, err error) {
+	slots, err := t.Slots()
+	if err != nil {
+		return nil, err
+	}
+
+	var specID [16]byte
+	if _, err := rand.Read(specID[:]); err != nil {
+		return nil, err
+	}
+	subject := backend.DID{
+		Method: p.Method,
+		SpecID: strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(specID[:])),
+	}
+
+	result := &Provisioned{KeyRefs: make(map[string]string, len(slots))}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, ref := range result.KeyRefs {
+			if err := p.Keys.Delete(ref); err != nil {
+				p.log().Error("provisioning key cleanup failed", "keyRef", ref, "error", err)
+			}
+		}
+	}()
+	keys := make(map[string]crypto.PublicKey, len(slots))
+	for _, slot := range slots {
+		ref, pub, err := p.Keys.Create(slot.Type)
+		if err != nil {
+			return nil, fmt.Errorf("key slot %q: %w", slot.Fragment, err)
+		}
+		result.KeyRefs[slot.Fragment] = ref
+		keys[slot.Fragment] = pub
+	}
+
+	result.Document, err = t.Fill(subject, params, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var proofSlot string
+	for _, slot := range slots {
+		for _, name := range slot.Relationships {
+			if name == Authentication && proofSlot == "" {
+				proofSlot = slot.Fragment
+			}
+		}
+	}
+	if proofSlot == "" {
+		return nil, fmt.Errorf("template %q has no authentication key for the proof", t.Name)
+	}
+	signer, err := p.Keys.Signer(result.KeyRefs[proofSlot])
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(result.Document)
+	if err != nil {
+		return nil, err
+	}
+	keyID := backend.URL{DID: subject, RawFragment: "#" + proofSlot}
+	result.Proof, err = jose.Sign(jose.Header{Kid: keyID.String(), Typ: "did+jws"}, payload, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Register != nil {
+		if err := p.Register(ctx, result.Document, result.Proof); err != nil {
+			return nil, fmt.Errorf("registration of %s: %w", subject.String(), err)
+		}
+	}
+	p.log().Info("DID provisioned", "did", subject.String(), "template", t.Name)
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+var deptTemplate = Template{
+	Name:   "department",
+	Preset: "department",
+	Params: []Param{
+		{Name: "org", Required: true},
+		{Name: "host", Default: "id.example.com"},
+	},
+	Document: json.RawMessage(`{
+		"controller": "{{org}}",
+		"service": [{
+			"id": "{{did}}#hub",
+			"type": "LinkedDomains",
+			"serviceEndpoint": "https://{{host}}/hub"
+		}]
+	}`),
+}
+
+func TestProvision(t *testing.T) {
+	var store keystore.Memory
+	var registered *backend.Document
+	var proof string
+	p := &Provisioner{
+		Keys:   &store,
+		Method: "example",
+		Register: func(ctx context.Context, doc *backend.Document, jws string) error {
+			registered, proof = doc, jws
+			return nil
+		},
+	}
+	got, err := p.Provision(context.Background(), &deptTemplate, map[string]string{"org": "did:example:acme"})
+	if err != nil {
+		t.Fatal("provision error:", err)
+	}
+	doc := got.Document
+	if registered != doc || proof != got.Proof {
+		t.Error("registration did not get the provisioned document and proof")
+	}
+
+	if len(doc.Controllers) != 1 || doc.Controllers[0].String() != "did:example:acme" {
+		t.Errorf("got controllers %v, want [did:example:acme]", doc.Controllers)
+	}
+	if len(doc.Services) != 1 || doc.Services[0].ID.String() != doc.Subject.String()+"#hub" {
+		t.Errorf("got services %+v, want one with ID %s#hub", doc.Services, doc.Subject.String())
+	}
+	if len(doc.VerificationMethods) != 3 || len(got.KeyRefs) != 3 {
+		t.Fatalf("got %d verification methods and %d key references, want 3 each", len(doc.VerificationMethods), len(got.KeyRefs))
+	}
+	for name, r := range map[string]*backend.VerificationRelationship{
+		Authentication:       doc.Authentication,
+		AssertionMethod:      doc.AssertionMethod,
+		CapabilityInvocation: doc.CapabilityInvocation,
+		CapabilityDelegation: doc.CapabilityDelegation,
+	} {
+		if r == nil || len(r.URIRefs) != 1 {
+			t.Errorf("%s got %+v, want one reference", name, r)
+		}
+	}
+	if doc.KeyAgreement != nil {
+		t.Errorf("got key agreement %+v, want none", doc.KeyAgreement)
+	}
+
+	// proof by the authentication key
+	jws, err := jose.ParseCompact(got.Proof)
+	if err != nil {
+		t.Fatal("proof parse error:", err)
+	}
+	keyID := backend.URL{DID: doc.Subject, RawFragment: "#auth-1"}
+	m := doc.AuthorizedMethod(doc.Authentication, &keyID)
+	if m == nil {
+		t.Fatal("no authentication method #auth-1")
+	}
+	pub, err := jose.MethodKey(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jws.Verify(pub); err != nil {
+		t.Error("proof verification error:", err)
+	}
+}
+
+func TestProvisionCleanup(t *testing.T) {
+	var store keystore.Memory
+	p := &Provisioner{
+		Keys:   &store,
+		Method: "example",
+		Register: func(ctx context.Context, doc *backend.Document, proof string) error {
+			return errors.New("registry unavailable")
+		},
+	}
+	if _, err := p.Provision(context.Background(), &deptTemplate, map[string]string{"org": "did:example:acme"}); err == nil {
+		t.Fatal("registration failure got no error")
+	}
+	if refs, _ := store.List(); len(refs) != 0 {
+		t.Errorf("got %d keys left after failure, want none", len(refs))
+	}
+}
+
+func TestParams(t *testing.T) {
+	tests := []map[string]string{
+		{},                                 // required missing
+		{"org": "did:example:a", "x": "y"}, // undeclared
+	}
+	for _, params := range tests {
+		_, err := deptTemplate.Fill(backend.DID{Method: "example", SpecID: "1"}, params, nil)
+		if !errors.Is(err, ErrParam) {
+			t.Errorf("%q got error %v, want ErrParam", params, err)
+		}
+	}
+
+	undeclared := Template{Name: "bad", Document: json.RawMessage(`{"alsoKnownAs": ["{{nope}}"]}`)}
+	_, err := undeclared.Fill(backend.DID{Method: "example", SpecID: "1"}, nil, nil)
+	if !errors.Is(err, ErrParam) {
+		t.Errorf("undeclared placeholder got error %v, want ErrParam", err)
+	}
+}
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Tracer observes operations as spans, e.g., with a shim to an OpenTelemetry
+// trace.Tracer, or with a LogTracer. Spans propagate with the context, just
+// like in OpenTelemetry. Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start begins a span, which is the current one in the context
+	// returned.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is an operation in progress.
+type Span interface {
+	// SetAttributes adds details, such as the outcome of a cache lookup.
+	SetAttributes(attrs ...slog.Attr)
+
+	// End completes the span, with the error of the operation, if any.
+	End(err error)
+}
+
+// Context keys of WithTracer and StartSpan
+type (
+	tracerKey struct{}
+	spanKey   struct{}
+)
+
+// WithTracer returns a context in which StartSpan applies t.
+func WithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// StartSpan begins a span with the Tracer of ctx. Without Tracer, the span
+// does nothing, at the cost of a context lookup.
+func StartSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	t, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, noSpan{}
+	}
+	ctx, span := t.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFrom returns the current span of ctx. Without span, the return does
+// nothing.
+func SpanFrom(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noSpan{}
+}
+
+// Tracers is a Tracer which feeds each of its elements, e.g., logs and
+// metrics.
+type Tracers []Tracer
+
+// Start implements the Tracer interface.
+func (list Tracers) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	spans := make(spans, len(list))
+	for i, t := range list {
+		ctx, spans[i] = t.Start(ctx, name, attrs...)
+	}
+	return ctx, spans
+}
+
+type spans []Span
+
+func (list spans) SetAttributes(attrs ...slog.Attr) {
+	for _, s := range list {
+		s.SetAttributes(attrs...)
+	}
+}
+
+func (list spans) End(err error) {
+	for _, s := range list {
+		s.End(err)
+	}
+}
+
+type noSpan struct{}
+
+func (noSpan) SetAttributes(...slog.Attr) {}
+func (noSpan) End(error)                  {}
+
+// ErrorCategory returns a name for the kind of err, for use in logs and
+// metrics. The resolution errors get their error code, e.g., "notFound".
+// Other errors are "timeout", "canceled" or "internalError". Nil gets the
+// empty string.
+func ErrorCategory(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrInvalid):
+		return "invalidDid"
+	case errors.Is(err, ErrNotFound):
+		return "notFound"
+	case errors.Is(err, ErrMediaType):
+		return "representationNotSupported"
+	case errors.Is(err, ErrMethodNotSupported):
+		return "methodNotSupported"
+	case errors.Is(err, ErrDeactivated):
+		return "deactivated"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "internalError"
+	}
+}
+
+// LogTracer is a Tracer which logs each span on end, with its duration and
+// its attributes. Failed spans include the error with its category.
+type LogTracer struct {
+	Log   *slog.Logger // nil for slog.Default
+	Level slog.Level   // of spans without error; failures log one level up
+}
+
+func (t *LogTracer) log() *slog.Logger {
+	if t.Log != nil {
+		return t.Log
+	}
+	return slog.Default()
+}
+
+// Start implements the Tracer interface.
+func (t *LogTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	return ctx, &logSpan{tracer: t, ctx: ctx, name: name, start: time.Now(), attrs: attrs}
+}
+
+// LogSpan is not safe for concurrent use, as spans rarely are.
+type logSpan struct {
+	tracer *LogTracer
+	ctx    context.Context
+	name   string
+	start  time.Time
+	attrs  []slog.Attr
+}
+
+// SetAttributes implements the Span interface.
+func (s *logSpan) SetAttributes(attrs ...slog.Attr) {
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End implements the Span interface.
+func (s *logSpan) End(err error) {
+	level := s.tracer.Level
+	attrs := append(s.attrs, slog.Duration("duration", time.Since(s.start)))
+	if err != nil {
+		level += 4
+		attrs = append(attrs, slog.String("category", ErrorCategory(err)), slog.Any("error", err))
+	}
+	s.tracer.log().LogAttrs(s.ctx, level, s.name, attrs...)
+}
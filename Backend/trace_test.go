@@ -0,0 +1,128 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RecordTracer retains spans on end as "name attr=value … error=category".
+type recordTracer struct {
+	mutex sync.Mutex
+	spans []string
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	return ctx, &recordSpan{t, name, attrs}
+}
+
+type recordSpan struct {
+	tracer *recordTracer
+	name   string
+	attrs  []slog.Attr
+}
+
+func (s *recordSpan) SetAttributes(attrs ...slog.Attr) { s.attrs = append(s.attrs, attrs...) }
+
+func (s *recordSpan) End(err error) {
+	line := s.name
+	for _, a := range s.attrs {
+		line += " " + a.String()
+	}
+	if err != nil {
+		line += " error=" + ErrorCategory(err)
+	}
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.tracer.spans = append(s.tracer.spans, line)
+}
+
+func TestTracing(t *testing.T) {
+	reg := new(MethodRegistry)
+	reg.Register("example", new(countResolver))
+	c := &CachedResolver{Resolver: reg, TTL: time.Hour}
+
+	tracer := new(recordTracer)
+	ctx := WithTracer(context.Background(), tracer)
+	alice := DID{Method: "example", SpecID: "alice"}
+	c.Resolve(ctx, alice)
+	c.Resolve(ctx, alice)
+	c.Resolve(ctx, DID{Method: "other", SpecID: "bob"})
+	c.Resolve(context.Background(), alice) // no tracer
+
+	want := []string{
+		"did.resolve method=example",
+		"did.cache method=example cache=miss",
+		"did.cache method=example cache=hit",
+		"did.resolve method=unsupported error=methodNotSupported",
+		"did.cache method=other cache=miss error=methodNotSupported",
+	}
+	if fmt.Sprint(tracer.spans) != fmt.Sprint(want) {
+		t.Errorf("got spans:\n%s\nwant:\n%s", strings.Join(tracer.spans, "\n"), strings.Join(want, "\n"))
+	}
+	if SpanFrom(ctx) == nil {
+		t.Error("SpanFrom without span got nil")
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("%w: bogus", ErrInvalid), "invalidDid"},
+		{fmt.Errorf("wrap: %w", ErrNotFound), "notFound"},
+		{ErrDeactivated, "deactivated"},
+		{fmt.Errorf("lookup: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{errors.New("other"), "internalError"},
+	}
+	for _, test := range tests {
+		if got := ErrorCategory(test.err); got != test.want {
+			t.Errorf("%v got category %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestLogTracer(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	tracer := &LogTracer{Log: log, Level: slog.LevelDebug}
+	ctx := WithTracer(context.Background(), tracer)
+
+	_, span := StartSpan(ctx, "quiet")
+	span.End(nil)
+	_, span = StartSpan(ctx, "loud", slog.String("method", "example"))
+	span.End(ErrNotFound)
+	got := buf.String()
+	if strings.Contains(got, "quiet") {
+		t.Errorf("span without error logged below the level: %q", got)
+	}
+	for _, s := range []string{"level=INFO", "msg=loud", "method=example", "category=notFound", "duration="} {
+		if !strings.Contains(got, s) {
+			t.Errorf("log %q misses %q", got, s)
+		}
+	}
+}
+
+func TestTracers(t *testing.T) {
+	a, b := new(recordTracer), new(recordTracer)
+	ctx := WithTracer(context.Background(), Tracers{a, b})
+	_, span := StartSpan(ctx, "both", slog.String("method", "example"))
+	span.SetAttributes(slog.Bool("version", true))
+	span.End(ErrNotFound)
+
+	const want = "[both method=example version=true error=notFound]"
+	for _, tracer := range []*recordTracer{a, b} {
+		if got := fmt.Sprint(tracer.spans); got != want {
+			t.Errorf("got spans %s, want %s", got, want)
+		}
+	}
+}
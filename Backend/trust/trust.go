@@ -0,0 +1,303 @@
+// Package trust decides on the issuers to trust, per type of credential. Trust
+// either comes from a list of issuers, or from a chain of accreditations up to
+// a listed accreditor, in the style of the EBSI Trusted Issuers Registry. An
+// accreditation is a verifiable credential about the accredited issuer, with
+// the credential types it is accredited for. Lists may name domains too, for
+// the DIDs which DNS binds to them, as in package diddns.
+package trust
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/diddns"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Accreditation types, as in EBSI. The credentialSubject of an accreditation
+// has the DID of the accredited in "id", and its scope in "accreditedFor", as
+// an array of objects with the credential "types".
+const (
+	// The subject may issue credentials of the types.
+	AccreditationToAttest = "VerifiableAccreditationToAttest"
+	// The subject may accredit others for the types.
+	AccreditationToAccredit = "VerifiableAccreditationToAccredit"
+)
+
+// ChainMax is the number of accreditations allowed in a chain of trust.
+const ChainMax = 8
+
+// ErrUntrusted signals an issuer which is not trusted for a credential type.
+var ErrUntrusted = errors.New("credential issuer not trusted")
+
+// Issuer is an entry in a trust list, with either a DID or a domain.
+type Issuer struct {
+	DID backend.DID `json:"did"`
+
+	// Domain trusts any DID bound to the domain name in DNS instead. See
+	// Registry.DNS.
+	Domain string `json:"domain,omitempty"`
+
+	// Types limits the trust to credentials with each of their types in
+	// the list. None is trusted for any type.
+	Types []string `json:"types,omitempty"`
+
+	// Accredit permits accreditation of other issuers, for the Types.
+	Accredit bool `json:"accredit,omitempty"`
+}
+
+// List is the configuration form of a Registry.
+type List struct {
+	Issuers []Issuer `json:"issuers"`
+
+	// Accreditations are secured credentials, i.e., either a JSON object
+	// with an embedded proof, or a JWT in a JSON string.
+	Accreditations []json.RawMessage `json:"accreditations,omitempty"`
+}
+
+// LoadList reads a JSON trust list.
+func LoadList(r io.Reader) (*List, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var l List
+	if err := dec.Decode(&l); err != nil {
+		return nil, fmt.Errorf("trust list: %w", err)
+	}
+	return &l, nil
+}
+
+// Registry holds the trusted issuers and the accreditations. The zero value
+// is ready to use, once a Verifier is set. Multiple goroutines may invoke
+// methods on a Registry simultaneously.
+type Registry struct {
+	// Verifier checks accreditations, once on Accredit, and then again on
+	// each use, for expiry and status. It must not have the Policy of this
+	// registry.
+	Verifier *vc.Verifier
+
+	Now func() time.Time // defaults to time.Now
+
+	// DNS looks up the DIDs of domains. Issuers with a Domain are not
+	// trusted without it.
+	DNS diddns.TXTResolver
+
+	mutex          sync.RWMutex
+	issuers        map[backend.DID]Issuer
+	domains        []Issuer
+	accreditations map[backend.DID][]*accreditation // by subject
+}
+
+type accreditation struct {
+	secured  []byte
+	issuer   backend.DID
+	accredit bool // or attest
+	types    []string
+}
+
+// Trust adds an issuer to the list. Any previous entry of the DID, or of the
+// domain, is replaced.
+func (reg *Registry) Trust(issuer Issuer) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if issuer.Domain != "" {
+		for i, entry := range reg.domains {
+			if strings.EqualFold(entry.Domain, issuer.Domain) {
+				reg.domains[i] = issuer
+				return
+			}
+		}
+		reg.domains = append(reg.domains, issuer)
+		return
+	}
+	if reg.issuers == nil {
+		reg.issuers = make(map[backend.DID]Issuer)
+	}
+	reg.issuers[issuer.DID] = issuer
+}
+
+// Accredit adds an accreditation, which must verify at the time.
+func (reg *Registry) Accredit(ctx context.Context, secured []byte) error {
+	c, err := reg.Verifier.VerifyCredential(ctx, secured, reg.now())
+	if err != nil {
+		return fmt.Errorf("accreditation: %w", err)
+	}
+	issuer, err := backend.Parse(c.Issuer.ID)
+	if err != nil {
+		return fmt.Errorf("accreditation issuer: %w", err)
+	}
+	a := &accreditation{secured: secured, issuer: issuer}
+	switch {
+	case hasType(c.Types, AccreditationToAccredit):
+		a.accredit = true
+	case hasType(c.Types, AccreditationToAttest):
+		break
+	default:
+		return fmt.Errorf("accreditation %q is neither a %s nor a %s", c.ID, AccreditationToAttest, AccreditationToAccredit)
+	}
+
+	subjects := make([]backend.DID, len(c.Subjects))
+	for i, s := range c.Subjects {
+		id, _ := s["id"].(string)
+		subjects[i], err = backend.Parse(id)
+		if err != nil {
+			return fmt.Errorf("accreditation subject: %w", err)
+		}
+		// re-encode for the structure
+		raw, err := json.Marshal(s["accreditedFor"])
+		if err != nil {
+			return err
+		}
+		var scopes []struct {
+			Types []string `json:"types"`
+		}
+		if err := json.Unmarshal(raw, &scopes); err != nil {
+			return fmt.Errorf("accreditation accreditedFor: %w", err)
+		}
+		for _, scope := range scopes {
+			a.types = append(a.types, scope.Types...)
+		}
+	}
+	if len(a.types) == 0 {
+		return fmt.Errorf("accreditation %q has no types accreditedFor", c.ID)
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if reg.accreditations == nil {
+		reg.accreditations = make(map[backend.DID][]*accreditation)
+	}
+	for _, subject := range subjects {
+		reg.accreditations[subject] = append(reg.accreditations[subject], a)
+	}
+	return nil
+}
+
+// Load adds the issuers and the accreditations of l.
+func (reg *Registry) Load(ctx context.Context, l *List) error {
+	for _, issuer := range l.Issuers {
+		reg.Trust(issuer)
+	}
+	for i, raw := range l.Accreditations {
+		secured := []byte(raw)
+		if len(raw) != 0 && raw[0] == '"' {
+			var token string
+			if err := json.Unmarshal(raw, &token); err != nil {
+				return fmt.Errorf("trust list accreditation № %d: %w", i+1, err)
+			}
+			secured = []byte(token)
+		}
+		if err := reg.Accredit(ctx, secured); err != nil {
+			return fmt.Errorf("trust list accreditation № %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// IsTrusted returns whether issuer may issue credentials of credentialType,
+// either as listed, or as accredited. The error is about accreditations which
+// did not verify, if any, in the absence of trust.
+func (reg *Registry) IsTrusted(ctx context.Context, issuer backend.DID, credentialType string) (bool, error) {
+	return reg.may(ctx, issuer, credentialType, false, reg.now(), 0)
+}
+
+func (reg *Registry) now() time.Time {
+	if reg.Now != nil {
+		return reg.Now()
+	}
+	return time.Now()
+}
+
+// May returns whether did may attest, or accredit, for credentialType.
+func (reg *Registry) may(ctx context.Context, did backend.DID, credentialType string, accredit bool, now time.Time, depth int) (bool, error) {
+	reg.mutex.RLock()
+	issuer, listed := reg.issuers[did]
+	domains := reg.domains
+	accreditations := reg.accreditations[did]
+	reg.mutex.RUnlock()
+	if listed && issuer.grants(credentialType, accredit) {
+		return true, nil
+	}
+
+	var errs []error
+	for _, entry := range domains {
+		if reg.DNS == nil || !entry.grants(credentialType, accredit) {
+			continue
+		}
+		err := diddns.SpeaksFor(ctx, reg.DNS, did, entry.Domain)
+		if err == nil {
+			return true, nil
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if !errors.Is(err, diddns.ErrNoBinding) {
+			errs = append(errs, err)
+		}
+	}
+
+	if depth >= ChainMax {
+		return false, errors.Join(errs...)
+	}
+	for _, a := range accreditations {
+		if a.accredit != accredit || !hasType(a.types, credentialType) {
+			continue
+		}
+		if _, err := reg.Verifier.VerifyCredential(ctx, a.secured, now); err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("accreditation of %s by %s: %w", did.String(), a.issuer.String(), err))
+			continue
+		}
+		ok, err := reg.may(ctx, a.issuer, credentialType, true, now, depth+1)
+		if ok {
+			return true, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return false, errors.Join(errs...)
+}
+
+// Policy returns a vc.Policy which requires the issuer of credentials to be
+// trusted for each of their types.
+func (reg *Registry) Policy() vc.Policy {
+	return &vc.Rule{
+		Name: "trusted issuer",
+		Func: func(ctx context.Context, _ backend.Resolver, e *vc.Evidence) error {
+			for _, t := range e.Credential.Types {
+				ok, err := reg.IsTrusted(ctx, e.Method.DID, t)
+				if err != nil {
+					return fmt.Errorf("%w for %s: %w", ErrUntrusted, t, err)
+				}
+				if !ok {
+					return fmt.Errorf("%w for %s", ErrUntrusted, t)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Grants returns whether the entry permits to attest, or to accredit, for
+// credentialType.
+func (issuer *Issuer) grants(credentialType string, accredit bool) bool {
+	return (!accredit || issuer.Accredit) && (len(issuer.Types) == 0 || hasType(issuer.Types, credentialType))
+}
+
+func hasType(types []string, t string) bool {
+	for _, s := range types {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package trust
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+type party struct {
+	did    backend.DID
+	signer crypto.Signer
+}
+
+func newParty(t *testing.T) *party {
+	key, err := keys.Generate(keys.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	return &party{did, signer}
+}
+
+// Issue returns a secured credential of types about subject.
+func (p *party) issue(t *testing.T, subject map[string]any, until time.Time, types ...string) []byte {
+	t.Helper()
+	from := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	c := &vc.Credential{
+		Context:    []any{vc.V2},
+		ID:         "urn:uuid:0f3a6c8e-1c5b-4b7e-9a52-6d1f2c3b4a59",
+		Types:      append([]string{"VerifiableCredential"}, types...),
+		Issuer:     vc.Issuer{ID: p.did.String()},
+		ValidFrom:  &from,
+		ValidUntil: &until,
+		Subjects:   vc.Subjects{subject},
+	}
+	secured, err := vc.Issue(c, p.signer, &backend.URL{DID: p.did, RawFragment: "#" + p.did.SpecID}, vc.DataIntegrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secured
+}
+
+// Accredit returns an accreditation of subject for types.
+func (p *party) accredit(t *testing.T, subject *party, kind string, until time.Time, types ...string) []byte {
+	t.Helper()
+	scope := []any{map[string]any{"types": append([]any{"VerifiableCredential"}, toAny(types)...)}}
+	return p.issue(t, map[string]any{"id": subject.did.String(), "accreditedFor": scope}, until, kind)
+}
+
+func toAny(a []string) []any {
+	r := make([]any, len(a))
+	for i, s := range a {
+		r[i] = s
+	}
+	return r
+}
+
+func TestRegistry(t *testing.T) {
+	root, tao, school, rogue, club := newParty(t), newParty(t), newParty(t), newParty(t), newParty(t)
+	later := time.Now().AddDate(1, 0, 0)
+
+	reg := &Registry{Verifier: &vc.Verifier{Resolver: new(didkey.Resolver)}}
+	reg.Trust(Issuer{DID: root.did, Accredit: true})
+	reg.Trust(Issuer{DID: club.did, Types: []string{"VerifiableCredential", "MembershipCredential"}})
+	ctx := context.Background()
+	for _, secured := range [][]byte{
+		root.accredit(t, tao, AccreditationToAccredit, later, "DiplomaCredential"),
+		tao.accredit(t, school, AccreditationToAttest, later, "DiplomaCredential"),
+		// the school may not accredit
+		school.accredit(t, rogue, AccreditationToAttest, later, "DiplomaCredential"),
+	} {
+		if err := reg.Accredit(ctx, secured); err != nil {
+			t.Fatal("accredit error:", err)
+		}
+	}
+
+	tests := []struct {
+		issuer *party
+		typ    string
+		want   bool
+	}{
+		{root, "DiplomaCredential", true},
+		{tao, "DiplomaCredential", false}, // accreditor only
+		{school, "DiplomaCredential", true},
+		{school, "VerifiableCredential", true},
+		{school, "MembershipCredential", false},
+		{rogue, "DiplomaCredential", false},
+		{club, "MembershipCredential", true},
+		{club, "DiplomaCredential", false},
+	}
+	for i, test := range tests {
+		got, err := reg.IsTrusted(ctx, test.issuer.did, test.typ)
+		if err != nil {
+			t.Errorf("test № %d: got error: %s", i+1, err)
+		}
+		if got != test.want {
+			t.Errorf("test № %d: got trust %t for %s, want %t", i+1, got, test.typ, test.want)
+		}
+	}
+
+	// in use by verifiers
+	v := &vc.Verifier{Resolver: new(didkey.Resolver), Policy: reg.Policy()}
+	diploma := school.issue(t, map[string]any{"id": "did:example:graduate"}, later, "DiplomaCredential")
+	if _, err := v.VerifyCredential(ctx, diploma, time.Now()); err != nil {
+		t.Errorf("diploma got error: %s", err)
+	}
+	fake := rogue.issue(t, map[string]any{"id": "did:example:graduate"}, later, "DiplomaCredential")
+	if _, err := v.VerifyCredential(ctx, fake, time.Now()); !errors.Is(err, ErrUntrusted) || !errors.Is(err, vc.ErrPolicy) {
+		t.Errorf("diploma of rogue got error %v, want ErrUntrusted", err)
+	}
+}
+
+func TestExpiredAccreditation(t *testing.T) {
+	root, school := newParty(t), newParty(t)
+	reg := &Registry{Verifier: &vc.Verifier{Resolver: new(didkey.Resolver)}}
+	reg.Trust(Issuer{DID: root.did, Accredit: true})
+	soon := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	if err := reg.Accredit(context.Background(), root.accredit(t, school, AccreditationToAttest, soon, "DiplomaCredential")); err != nil {
+		t.Fatal(err)
+	}
+	reg.Now = func() time.Time { return soon.Add(time.Hour) }
+	ok, err := reg.IsTrusted(context.Background(), school.did, "DiplomaCredential")
+	if ok || !errors.Is(err, vc.ErrValidity) {
+		t.Errorf("got trust %t with error %v, want ErrValidity", ok, err)
+	}
+}
+
+func TestLoadList(t *testing.T) {
+	root, school := newParty(t), newParty(t)
+	accreditation := root.accredit(t, school, AccreditationToAttest, time.Now().AddDate(1, 0, 0), "DiplomaCredential")
+	listJSON, _ := json.Marshal(map[string]any{
+		"issuers":        []any{map[string]any{"did": root.did.String(), "accredit": true}},
+		"accreditations": []json.RawMessage{accreditation},
+	})
+	l, err := LoadList(strings.NewReader(string(listJSON)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg Registry
+	reg.Verifier = &vc.Verifier{Resolver: new(didkey.Resolver)}
+	if err := reg.Load(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := reg.IsTrusted(context.Background(), school.did, "DiplomaCredential"); !ok || err != nil {
+		t.Errorf("got trust %t with error %v", ok, err)
+	}
+
+	if _, err := LoadList(strings.NewReader(`{"trusted": []}`)); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+// Zone maps DNS names to their text records.
+type zone map[string][]string
+
+func (z zone) LookupTXT(_ context.Context, name string) ([]string, error) {
+	texts, ok := z[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return texts, nil
+}
+
+func TestDomain(t *testing.T) {
+	school, other := newParty(t), newParty(t)
+	reg := &Registry{Verifier: &vc.Verifier{Resolver: new(didkey.Resolver)}}
+	reg.Trust(Issuer{Domain: "school.example", Types: []string{"VerifiableCredential", "DiplomaCredential"}})
+	if ok, _ := reg.IsTrusted(context.Background(), school.did, "DiplomaCredential"); ok {
+		t.Error("trusted without DNS")
+	}
+
+	reg.DNS = zone{"_did.school.example": {"did=" + school.did.String()}}
+	if ok, err := reg.IsTrusted(context.Background(), school.did, "DiplomaCredential"); !ok || err != nil {
+		t.Errorf("DID bound to domain got trust %t with error %v", ok, err)
+	}
+	if ok, err := reg.IsTrusted(context.Background(), other.did, "DiplomaCredential"); ok || err != nil {
+		t.Errorf("DID not bound to domain got trust %t with error %v", ok, err)
+	}
+	if ok, _ := reg.IsTrusted(context.Background(), school.did, "MembershipCredential"); ok {
+		t.Error("DID bound to domain trusted for another type")
+	}
+}
@@ -0,0 +1,54 @@
+package tsa
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWSSignature returns the signature bytes of a compact serialization. The
+// signature is the subject of time stamps, like the signature time-stamp of
+// CAdES and JAdES.
+func jwsSignature(jws string) ([]byte, error) {
+	i := strings.LastIndexByte(jws, '.')
+	if i < 0 || strings.Count(jws, ".") != 2 {
+		return nil, fmt.Errorf("tsa: JWS not in compact serialization")
+	}
+	return base64.RawURLEncoding.DecodeString(jws[i+1:])
+}
+
+// StampJWS obtains a token for the signature of a JWS.
+func (c *Client) StampJWS(ctx context.Context, jws string) (*Token, error) {
+	sig, err := jwsSignature(jws)
+	if err != nil {
+		return nil, err
+	}
+	return c.Stamp(ctx, sig)
+}
+
+// VerifyJWS checks that token stamps the signature of a JWS, with a TSA
+// certificate from roots. It returns the time of the stamp, which is the
+// latest time the signature could have been made. The JWS itself is not
+// verified.
+func VerifyJWS(jws string, token []byte, roots *x509.CertPool) (time.Time, error) {
+	sig, err := jwsSignature(jws)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := ParseToken(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := t.VerifyChain(roots); err != nil {
+		return time.Time{}, err
+	}
+	h := t.Hash.New()
+	h.Write(sig)
+	if err := t.Verify(t.Hash, h.Sum(nil)); err != nil {
+		return time.Time{}, err
+	}
+	return t.Time, nil
+}
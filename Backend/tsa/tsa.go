@@ -0,0 +1,475 @@
+// Package tsa obtains and verifies time-stamp tokens conform RFC 3161, for
+// signatures which must remain verifiable after their keys expire or get
+// revoked. Tokens prove that a digest existed at the time of the stamp.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // link
+	_ "crypto/sha512" // link
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Media types of the HTTP transport, from RFC 3161, section 3.4
+const (
+	QueryType = "application/timestamp-query"
+	ReplyType = "application/timestamp-reply"
+)
+
+// ErrToken signals a time-stamp token which fails verification.
+var ErrToken = errors.New("time-stamp token denied")
+
+// ResponseMax is the size limit for TSA responses in bytes.
+const ResponseMax = 64 << 10
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+var hashOIDs = []struct {
+	hash crypto.Hash
+	oid  asn1.ObjectIdentifier
+}{
+	{crypto.SHA256, oidSHA256},
+	{crypto.SHA384, oidSHA384},
+	{crypto.SHA512, oidSHA512},
+}
+
+func hashOID(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	for _, e := range hashOIDs {
+		if e.hash == h {
+			return e.oid, nil
+		}
+	}
+	return nil, fmt.Errorf("tsa: hash %s not supported", h)
+}
+
+func hashByOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, e := range hashOIDs {
+		if e.oid.Equal(oid) {
+			return e.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: hash algorithm %s not supported", ErrToken, oid)
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional,default:false"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// Accuracy is typed, as a RawValue would match the nonce too.
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// Token is a verified time-stamp token.
+type Token struct {
+	Raw []byte // DER of the ContentInfo
+
+	Time   time.Time
+	Serial *big.Int
+	Policy asn1.ObjectIdentifier
+	Nonce  *big.Int // optional
+
+	// Hash and Digest are the message imprint.
+	Hash   crypto.Hash
+	Digest []byte
+
+	// Signer is the TSA certificate. Its chain is not verified by
+	// ParseToken. See VerifyChain.
+	Signer *x509.Certificate
+	// Certificates has all certificates embedded in the token.
+	Certificates []*x509.Certificate
+}
+
+// ParseToken decodes a time-stamp token, and it verifies the signature. The
+// signer certificate comes from the token, or else from certs.
+func ParseToken(der []byte, certs ...*x509.Certificate) (*Token, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed content info: %v", ErrToken, err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: content type %s is not signed data", ErrToken, ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("%w: malformed signed data: %v", ErrToken, err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: encapsulated content type %s is not TSTInfo", ErrToken, sd.EncapContentInfo.EContentType)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: %d signer infos, want 1", ErrToken, len(sd.SignerInfos))
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("%w: malformed TSTInfo: %v", ErrToken, err)
+	}
+
+	t := &Token{
+		Raw:    der,
+		Time:   info.GenTime,
+		Serial: info.SerialNumber,
+		Policy: info.Policy,
+		Nonce:  info.Nonce,
+		Digest: info.MessageImprint.HashedMessage,
+	}
+	var err error
+	t.Hash, err = hashByOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Digest) != t.Hash.Size() {
+		return nil, fmt.Errorf("%w: message imprint of %d bytes for %s", ErrToken, len(t.Digest), t.Hash)
+	}
+	if len(sd.Certificates.Bytes) != 0 {
+		t.Certificates, err = x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: embedded certificates: %v", ErrToken, err)
+		}
+	}
+
+	si := &sd.SignerInfos[0]
+	t.Signer, err = signerCert(si, append(t.Certificates, certs...))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignerInfo(si, sd.EncapContentInfo.EContent, t.Signer); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SignerCert returns the certificate identified by the signer info.
+func signerCert(si *signerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	switch {
+	case si.SID.Class == asn1.ClassUniversal && si.SID.Tag == asn1.TagSequence:
+		var ias issuerAndSerial
+		if _, err := asn1.Unmarshal(si.SID.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("%w: malformed signer identifier: %v", ErrToken, err)
+		}
+		for _, c := range certs {
+			if c.SerialNumber.Cmp(ias.Serial) == 0 && bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) {
+				return c, nil
+			}
+		}
+	case si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0:
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, si.SID.Bytes) {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: signer certificate not available", ErrToken)
+}
+
+// VerifySignerInfo checks the signed attributes against content, and the
+// signature over the signed attributes.
+func verifySignerInfo(si *signerInfo, content []byte, cert *x509.Certificate) error {
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return fmt.Errorf("%w: no signed attributes", ErrToken)
+	}
+	hash, err := hashByOID(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &attrs, "set,tag:0"); err != nil {
+		return fmt.Errorf("%w: malformed signed attributes: %v", ErrToken, err)
+	}
+	var hasType, hasDigest bool
+	for _, a := range attrs {
+		if len(a.Values) != 1 {
+			continue
+		}
+		switch {
+		case a.Type.Equal(oidContentType):
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &ct); err != nil || !ct.Equal(oidTSTInfo) {
+				return fmt.Errorf("%w: content-type attribute mismatch", ErrToken)
+			}
+			hasType = true
+		case a.Type.Equal(oidMessageDigest):
+			var digest []byte
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &digest); err != nil {
+				return fmt.Errorf("%w: malformed message-digest attribute", ErrToken)
+			}
+			h := hash.New()
+			h.Write(content)
+			if !bytes.Equal(digest, h.Sum(nil)) {
+				return fmt.Errorf("%w: message-digest attribute mismatch", ErrToken)
+			}
+			hasDigest = true
+		}
+	}
+	if !hasType || !hasDigest {
+		return fmt.Errorf("%w: signed attributes incomplete", ErrToken)
+	}
+
+	// “the DER encoding of the SET OF” instead of the IMPLICIT [0] tag
+	signed := append([]byte(nil), si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	alg, err := signatureAlgorithm(cert.PublicKey, hash)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(alg, signed, si.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrToken, err)
+	}
+	return nil
+}
+
+func signatureAlgorithm(pub crypto.PublicKey, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	}
+	return 0, fmt.Errorf("%w: %T signer with %s", ErrToken, pub, hash)
+}
+
+// Verify checks that the token stamps digest.
+func (t *Token) Verify(hash crypto.Hash, digest []byte) error {
+	if t.Hash != hash || !bytes.Equal(t.Digest, digest) {
+		return fmt.Errorf("%w: message imprint mismatch", ErrToken)
+	}
+	return nil
+}
+
+// VerifyChain checks the signer certificate against roots at the time of the
+// stamp. The certificate must be for time stamping.
+func (t *Token) VerifyChain(roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, c := range t.Certificates {
+		intermediates.AddCert(c)
+	}
+	_, err := t.Signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrToken, err)
+	}
+	return nil
+}
+
+// Client requests tokens from a TSA. Multiple goroutines may invoke methods on
+// a Client simultaneously.
+type Client struct {
+	URL string // HTTP endpoint of the TSA
+
+	Hash   crypto.Hash           // zero defaults to SHA-256
+	Policy asn1.ObjectIdentifier // optional
+
+	// Roots verifies the TSA certificate. Nil means the system roots.
+	Roots *x509.CertPool
+
+	HTTP *http.Client // nil for http.DefaultClient
+}
+
+func (c *Client) hash() crypto.Hash {
+	if c.Hash != 0 {
+		return c.Hash
+	}
+	return crypto.SHA256
+}
+
+// Stamp obtains a verified token for data.
+func (c *Client) Stamp(ctx context.Context, data []byte) (*Token, error) {
+	h := c.hash().New()
+	h.Write(data)
+	return c.StampDigest(ctx, h.Sum(nil))
+}
+
+// StampDigest obtains a verified token for a digest with the Hash of c.
+func (c *Client) StampDigest(ctx context.Context, digest []byte) (*Token, error) {
+	oid, err := hashOID(c.hash())
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	query, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		ReqPolicy: c.Policy,
+		Nonce:     nonce,
+		CertReq:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", QueryType)
+	req.Header.Set("Accept", ReplyType)
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tsa: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tsa: HTTP %q", res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, ResponseMax+1))
+	if err != nil {
+		return nil, fmt.Errorf("tsa: response: %w", err)
+	}
+	if len(body) > ResponseMax {
+		return nil, fmt.Errorf("tsa: response exceeds %d bytes", ResponseMax)
+	}
+
+	var resp timeStampResp
+	if _, err := asn1.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("tsa: malformed response: %w", err)
+	}
+	// granted (0) or grantedWithMods (1)
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("tsa: request rejected with status %d %q", resp.Status.Status, resp.Status.StatusString)
+	}
+	t, err := ParseToken(resp.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Verify(c.hash(), digest); err != nil {
+		return nil, err
+	}
+	if t.Nonce == nil || t.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrToken)
+	}
+	if len(c.Policy) != 0 && !t.Policy.Equal(c.Policy) {
+		return nil, fmt.Errorf("%w: policy %s, want %s", ErrToken, t.Policy, c.Policy)
+	}
+	if err := t.VerifyChain(c.Roots); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
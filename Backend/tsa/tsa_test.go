@@ -0,0 +1,208 @@
+package tsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// TestTSA is an RFC 3161 responder.
+type testTSA struct {
+	key   *ecdsa.PrivateKey
+	cert  *x509.Certificate
+	roots *x509.CertPool
+	now   time.Time
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return &testTSA{key, cert, roots, now.UTC().Truncate(time.Second)}
+}
+
+// Token returns the DER of a token for the imprint, with the signed
+// attributes optionally tampered.
+func (tsa *testTSA) token(t *testing.T, imprint messageImprint, nonce *big.Int) []byte {
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1},
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(42),
+		GenTime:        tsa.now,
+		Nonce:          nonce,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoSum := sha256.Sum256(info)
+	ctValue, _ := asn1.Marshal(oidTSTInfo)
+	mdValue, _ := asn1.Marshal(infoSum[:])
+	attrs, err := asn1.MarshalWithParams([]attribute{
+		{oidContentType, []asn1.RawValue{{FullBytes: ctValue}}},
+		{oidMessageDigest, []asn1.RawValue{{FullBytes: mdValue}}},
+	}, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrsSum := sha256.Sum256(attrs)
+	sig, err := tsa.key.Sign(rand.Reader, attrsSum[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedAttrs := append([]byte(nil), attrs...)
+	signedAttrs[0] = 0xa0 // IMPLICIT [0]
+
+	sid, _ := asn1.Marshal(issuerAndSerial{asn1.RawValue{FullBytes: tsa.cert.RawIssuer}, tsa.cert.SerialNumber})
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapsulatedContentInfo{oidTSTInfo, info},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          sig,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := asn1.Marshal(contentInfo{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (tsa *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil || r.Header.Get("Content-Type") != QueryType {
+		http.Error(w, "bad query", http.StatusBadRequest)
+		return
+	}
+	resp, _ := asn1.Marshal(timeStampResp{
+		TimeStampToken: asn1.RawValue{FullBytes: tsa.token(nil, req.MessageImprint, req.Nonce)},
+	})
+	w.Header().Set("Content-Type", ReplyType)
+	w.Write(resp)
+}
+
+func TestStamp(t *testing.T) {
+	tsa := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+	c := &Client{URL: srv.URL, Roots: tsa.roots}
+
+	token, err := c.Stamp(context.Background(), []byte("hello"))
+	if err != nil {
+		t.Fatal("stamp error:", err)
+	}
+	if !token.Time.Equal(tsa.now) || token.Serial.Int64() != 42 {
+		t.Errorf("got time %s, serial %d", token.Time, token.Serial)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+	if err := token.Verify(crypto.SHA256, sum[:]); err != nil {
+		t.Error("verify error:", err)
+	}
+	other := sha256.Sum256([]byte("bye"))
+	if err := token.Verify(crypto.SHA256, other[:]); !errors.Is(err, ErrToken) {
+		t.Errorf("other digest got error %v, want ErrToken", err)
+	}
+
+	// untrusted TSA
+	if err := token.VerifyChain(x509.NewCertPool()); !errors.Is(err, ErrToken) {
+		t.Errorf("unknown root got error %v, want ErrToken", err)
+	}
+
+	// tampered content
+	der := append([]byte(nil), token.Raw...)
+	for i := range der {
+		if der[i] == 42 && der[i-1] == 1 && der[i-2] == 2 { // serial INTEGER 42
+			der[i] = 43
+			break
+		}
+	}
+	if _, err := ParseToken(der); !errors.Is(err, ErrToken) {
+		t.Errorf("tampered token got error %v, want ErrToken", err)
+	}
+}
+
+func TestJWS(t *testing.T) {
+	tsa := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+	c := &Client{URL: srv.URL, Roots: tsa.roots}
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	jws, err := jose.Sign(jose.Header{}, []byte(`{"claim":true}`), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.StampJWS(context.Background(), jws)
+	if err != nil {
+		t.Fatal("stamp error:", err)
+	}
+	got, err := VerifyJWS(jws, token.Raw, tsa.roots)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if !got.Equal(tsa.now) {
+		t.Errorf("got time %s, want %s", got, tsa.now)
+	}
+
+	other, _ := jose.Sign(jose.Header{}, []byte(`{"claim":false}`), key)
+	if _, err := VerifyJWS(other, token.Raw, tsa.roots); !errors.Is(err, ErrToken) {
+		t.Errorf("other JWS got error %v, want ErrToken", err)
+	}
+}
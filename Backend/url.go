@@ -1,13 +1,23 @@
 package backend
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql/driver"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"EncrypteDL/IDChain/Backend/multiformat"
 )
 
 // URL extends the syntax of a basic DID to incorporate other standard URI
@@ -197,6 +207,16 @@ func ParseURL(s string) (*URL, error) {
 	return &u, nil
 }
 
+// MustParseURL is like ParseURL, but it panics on error. It simplifies the
+// safe initialization of global variables, and tests.
+func MustParseURL(s string) *URL {
+	u, err := ParseURL(s)
+	if err != nil {
+		panic("backend: MustParseURL(" + strconv.Quote(s) + "): " + err.Error())
+	}
+	return u
+}
+
 // IsRelative returns whether u is a relative URI reference.
 //
 // “A relative DID URL is any URL value in a DID document that does not start
@@ -408,6 +428,97 @@ func (u *URL) String() string {
 	return u.DID.String() + u.RawPath + u.RawQuery + u.RawFragment
 }
 
+// Append appends the String of u to dst, and it returns the extended buffer.
+func (u *URL) Append(dst []byte) []byte {
+	dst = u.DID.Append(dst)
+	dst = append(dst, u.RawPath...)
+	dst = append(dst, u.RawQuery...)
+	return append(dst, u.RawFragment...)
+}
+
+// Canonical returns the normalized form of u, conform the “Syntax-Based
+// Normalization” of RFC 3986, subsection 6.2.2. The DID is in its Canonical
+// form. Percent-encodings of unreserved characters are decoded, and any other
+// get uppercase hex digits. Absolute DID URLs have the dot-segments ("." and
+// "..") removed from their path. URLs with the same canonical form are
+// equivalent, which makes it suitable for map keys and database identifiers.
+func (u *URL) Canonical() string {
+	p := normalizeEscapes(u.RawPath)
+	if u.IsRelative() {
+		// dot-segments are meaningful in relative references
+		return p + normalizeEscapes(u.RawQuery) + normalizeEscapes(u.RawFragment)
+	}
+	if strings.HasPrefix(p, "/") {
+		p = removeDotSegments(p)
+	}
+	return u.DID.Canonical() + p + normalizeEscapes(u.RawQuery) + normalizeEscapes(u.RawFragment)
+}
+
+// NormalizeEscapes decodes the percent-encodings of unreserved characters,
+// and it puts the hex digits of any other in uppercase. Malformed percent-
+// encodings simply pass as is.
+func normalizeEscapes(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s // fast path
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		c, err := parseHex(s, i+1)
+		if err != nil {
+			b.WriteByte('%')
+			continue
+		}
+		i += 2
+
+		switch c {
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', // unreserved
+			'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', // unreserved
+			'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', // unreserved
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', // unreserved
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', // unreserved
+			'-', '.', '_', '~': // unreserved
+			b.WriteByte(c)
+
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexTable[c>>4])
+			b.WriteByte(hexTable[c&15])
+		}
+	}
+	return b.String()
+}
+
+// RemoveDotSegments applies the algorithm of RFC 3986, subsection 5.2.4, on
+// an absolute path. Empty segments remain.
+func removeDotSegments(p string) string {
+	segs := strings.Split(p[1:], "/")
+	out := make([]string, 0, len(segs))
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		switch seg {
+		case ".":
+			break
+		case "..":
+			if len(out) != 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+			continue
+		}
+		if last {
+			out = append(out, "") // keep directory
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
 func (u *URL) PathWithEscape(escape byte) string {
 	s := u.RawPath
 	i := 0
@@ -522,6 +633,79 @@ func (u *URL) SetQuery(s string) {
 	u.RawQuery = encodeWithLead(s, '?')
 }
 
+// RegisteredParams are the DID parameters of the DID Specification
+// Registries, which may occur only once.
+var registeredParams = map[string]bool{
+	"service":       true,
+	"relativeRef":   true,
+	"versionId":     true,
+	"versionTime":   true,
+	"hl":            true,
+	"transformKeys": true,
+}
+
+// QueryValues parses RawQuery as name–value pairs separated by ampersands
+// ('&'). Both names and values are percent-decoded conform RFC 3986, with the
+// plus ('+') as is, unlike the form decoding of net/url. Pairs without an
+// equals sign ('=') get the empty value. Malformed pairs, and duplicates of
+// the DID parameters from the DID Specification Registries, get an error.
+func (u *URL) QueryValues() (url.Values, error) {
+	params := make(url.Values)
+	if u.RawQuery == "" {
+		return params, nil
+	}
+	if u.RawQuery[0] != '?' {
+		return nil, fmt.Errorf("DID URL query %q without question mark", u.RawQuery)
+	}
+	for _, pair := range strings.Split(u.RawQuery[1:], "&") {
+		if pair == "" {
+			continue // tolerate empty pairs
+		}
+		rawName, rawValue, _ := strings.Cut(pair, "=")
+		name, err := decodeQueryComponent(rawName)
+		if err != nil {
+			return nil, fmt.Errorf("DID URL query pair %q: %w", pair, err)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("DID URL query pair %q has no name", pair)
+		}
+		value, err := decodeQueryComponent(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("DID URL query pair %q: %w", pair, err)
+		}
+		if registeredParams[name] && len(params[name]) != 0 {
+			return nil, fmt.Errorf("duplicate %s in DID URL", name)
+		}
+		params[name] = append(params[name], value)
+	}
+	return params, nil
+}
+
+// SetQueryValues sets RawQuery to contain a normalized encoding of params,
+// in order of name like url.Values.Encode does. Empty params clear the query.
+func (u *URL) SetQueryValues(params url.Values) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		for _, value := range params[name] {
+			if b.Len() == 0 {
+				b.WriteByte('?')
+			} else {
+				b.WriteByte('&')
+			}
+			b.WriteString(encodeQueryComponent(name))
+			b.WriteByte('=')
+			b.WriteString(encodeQueryComponent(value))
+		}
+	}
+	u.RawQuery = b.String()
+}
+
 func (u *URL) Fragment() string {
 	if u.RawFragment == "" || u.RawFragment[0] != '#' {
 		return ""
@@ -554,6 +738,101 @@ func (u *URL) UnmarshalJSON(bytes []byte) error {
 	return nil
 }
 
+// MarshalText implements the encoding.TextMarshaler interface.
+func (u *URL) MarshalText() ([]byte, error) {
+	return u.Append(nil), nil
+}
+
+// AppendText implements the encoding.TextAppender interface.
+func (u *URL) AppendText(dst []byte) ([]byte, error) {
+	return u.Append(dst), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u *URL) UnmarshalText(text []byte) error {
+	p, err := ParseURL(string(text))
+	if err != nil {
+		return err
+	}
+	*u = *p // copy
+	return nil
+}
+
+// Value implements the driver.Valuer interface, with the Canonical form, and
+// with NULL for the zero URL. The value receiver lets database/sql pass both
+// URL values and nil pointers, like with DID.
+func (u URL) Value() (driver.Value, error) {
+	if u == (URL{}) {
+		return nil, nil
+	}
+	return u.Canonical(), nil
+}
+
+// Scan implements the sql.Scanner interface, with the zero URL for NULL.
+func (u *URL) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*u = URL{}
+		return nil
+	case string:
+		return u.UnmarshalText([]byte(v))
+	case []byte:
+		return u.UnmarshalText(v)
+	default:
+		return fmt.Errorf("DID URL scan from %T not supported", src)
+	}
+}
+
+// The binary encoding of a URL is the size of the binary DID as an unsigned
+// varint, followed by the binary DID, followed by RawPath, RawQuery and
+// RawFragment as is.
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u *URL) MarshalBinary() ([]byte, error) {
+	return u.AppendBinary(nil)
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (u *URL) AppendBinary(dst []byte) ([]byte, error) {
+	n := 0
+	if !u.IsRelative() {
+		n = len(u.Method) + 1 + len(u.SpecID)
+	}
+	dst = binary.AppendUvarint(dst, uint64(n))
+	dst, _ = u.DID.AppendBinary(dst)
+	dst = append(dst, u.RawPath...)
+	dst = append(dst, u.RawQuery...)
+	return append(dst, u.RawFragment...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. The
+// components must conform to the DID URL syntax.
+func (u *URL) UnmarshalBinary(data []byte) error {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)-size) {
+		return errors.New("binary DID URL with malformed DID size")
+	}
+	var d DID
+	if err := d.UnmarshalBinary(data[size : size+int(n)]); err != nil {
+		return err
+	}
+	rest := string(data[size+int(n):])
+	if d == (DID{}) && rest == "" {
+		*u = URL{}
+		return nil
+	}
+	// validate with the text form
+	if d != (DID{}) {
+		rest = d.String() + rest
+	}
+	p, err := ParseURL(rest)
+	if err != nil {
+		return err
+	}
+	*u = *p
+	return nil
+}
+
 var (
 	errVersionIDDupe   = errors.New("duplicate versionId in DID URL")
 	errVersionTimeDupe = errors.New("duplicate versionTime in DID URL")
@@ -608,6 +887,212 @@ func SetVersionParams(params url.Values, s string, t time.Time) {
 	}
 }
 
+var (
+	errServiceDupe     = errors.New("duplicate service in DID URL")
+	errRelativeRefDupe = errors.New("duplicate relativeRef in DID URL")
+)
+
+// ServiceParams returns the standardised "service" and "relativeRef". The
+// relative reference requires a service.
+func ServiceParams(params url.Values) (service string, relativeRef *url.URL, err error) {
+	switch a := params["service"]; len(a) {
+	case 0:
+		break
+	case 1:
+		service = a[0]
+	default:
+		return "", nil, errServiceDupe
+	}
+
+	switch a := params["relativeRef"]; len(a) {
+	case 0:
+		return service, nil, nil
+	case 1:
+		if service == "" {
+			return "", nil, errors.New("relativeRef without service in DID URL")
+		}
+		ref, err := url.Parse(a[0])
+		if err != nil {
+			return "", nil, fmt.Errorf("relativeRef in DID URL: %w", err)
+		}
+		if ref.IsAbs() {
+			return "", nil, fmt.Errorf("relativeRef %q in DID URL is not relative", a[0])
+		}
+		return service, ref, nil
+	default:
+		return "", nil, errRelativeRefDupe
+	}
+}
+
+// ErrHashlink signals content which does not match its hashlink.
+var ErrHashlink = errors.New("content does not match hashlink")
+
+// Hashlink is a Multihash digest of content, conform the “Cryptographic
+// Hyperlinks” draft. The "hl" parameter of DID URLs holds its Multibase
+// encoding.
+type Hashlink struct {
+	Code   uint64 // multiformat.SHA2_256 or multiformat.SHA2_512
+	Digest []byte
+}
+
+// NewHashlink returns the SHA2-256 hashlink of data.
+func NewHashlink(data []byte) *Hashlink {
+	sum := sha256.Sum256(data)
+	return &Hashlink{Code: multiformat.SHA2_256, Digest: sum[:]}
+}
+
+// ParseHashlink decodes a Multibase of a Multihash. Digests other than
+// SHA2-256 and SHA2-512 are not supported.
+func ParseHashlink(s string) (*Hashlink, error) {
+	_, multihash, err := multiformat.Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("hashlink %q: %w", s, err)
+	}
+	code, digest, err := multiformat.DecodeMultihash(multihash)
+	if err != nil {
+		return nil, fmt.Errorf("hashlink %q: %w", s, err)
+	}
+	h := &Hashlink{Code: code, Digest: digest}
+	hash := h.New()
+	if hash == nil {
+		return nil, fmt.Errorf("hashlink multihash %#x not supported", code)
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("hashlink %q has %d-byte digest for multihash %#x", s, len(digest), code)
+	}
+	return h, nil
+}
+
+// New returns the hash function of the digest, or nil when not supported.
+func (h *Hashlink) New() hash.Hash {
+	switch h.Code {
+	case multiformat.SHA2_256:
+		return sha256.New()
+	case multiformat.SHA2_512:
+		return sha512.New()
+	}
+	return nil
+}
+
+// Verify returns ErrHashlink when data does not match the digest.
+func (h *Hashlink) Verify(data []byte) error {
+	hash := h.New()
+	if hash == nil {
+		return fmt.Errorf("hashlink multihash %#x not supported", h.Code)
+	}
+	hash.Write(data)
+	if !bytes.Equal(hash.Sum(nil), h.Digest) {
+		return ErrHashlink
+	}
+	return nil
+}
+
+// String returns the base58btc Multibase of the Multihash.
+func (h *Hashlink) String() string {
+	return multiformat.Encode(multiformat.Base58BTC, multiformat.EncodeMultihash(h.Code, h.Digest))
+}
+
+// Hashlink returns the "hl" parameter, with nil for none.
+func (u *URL) Hashlink() (*Hashlink, error) {
+	s, err := u.param("hl")
+	if s == "" || err != nil {
+		return nil, err
+	}
+	return ParseHashlink(s)
+}
+
+// SetHashlink installs the "hl" parameter with the SHA2-256 hashlink of data.
+func (u *URL) SetHashlink(data []byte) {
+	u.setParam("hl", NewHashlink(data).String())
+}
+
+// Service returns the "service" parameter, with the empty string for none.
+func (u *URL) Service() (string, error) {
+	return u.param("service")
+}
+
+// SetService installs the "service" parameter. The empty string clears.
+func (u *URL) SetService(name string) {
+	u.setParam("service", name)
+}
+
+// RelativeRef returns the "relativeRef" parameter, with nil for none. The
+// relative reference requires a service, as in ServiceParams.
+func (u *URL) RelativeRef() (*url.URL, error) {
+	params, err := u.QueryValues()
+	if err != nil {
+		return nil, err
+	}
+	_, ref, err := ServiceParams(params)
+	return ref, err
+}
+
+// SetRelativeRef installs the "relativeRef" parameter, which must be a
+// relative URI reference. Nil clears.
+func (u *URL) SetRelativeRef(ref *url.URL) error {
+	if ref == nil {
+		u.setParam("relativeRef", "")
+		return nil
+	}
+	if ref.IsAbs() {
+		return fmt.Errorf("relativeRef %q in DID URL is not relative", ref.Redacted())
+	}
+	u.setParam("relativeRef", ref.String())
+	return nil
+}
+
+// TransformKeys returns the "transformKeys" parameter, with the empty string
+// for none.
+func (u *URL) TransformKeys() (string, error) {
+	return u.param("transformKeys")
+}
+
+// SetTransformKeys installs the "transformKeys" parameter, which names a
+// verification method type, e.g., "JsonWebKey". The empty string clears.
+func (u *URL) SetTransformKeys(s string) {
+	u.setParam("transformKeys", s)
+}
+
+// Param returns the value of a DID parameter, with the empty string for none.
+func (u *URL) param(name string) (string, error) {
+	params, err := u.QueryValues()
+	if err != nil {
+		return "", err
+	}
+	return params.Get(name), nil
+}
+
+// SetParam replaces a DID parameter in place, or it appends the parameter
+// when absent. The empty value removes the parameter. Any other parameters,
+// including unknown ones, remain as is.
+func (u *URL) setParam(name, value string) {
+	var pairs []string
+	done := value == ""
+	for _, pair := range strings.Split(strings.TrimPrefix(u.RawQuery, "?"), "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if s, err := decodeQueryComponent(key); err == nil {
+			key = s
+		}
+		switch {
+		case pair == "":
+			continue
+		case key != name:
+			pairs = append(pairs, pair)
+		case !done:
+			pairs = append(pairs, name+"="+encodeQueryComponent(value))
+			done = true
+		}
+	}
+	if !done {
+		pairs = append(pairs, name+"="+encodeQueryComponent(value))
+	}
+	if len(pairs) == 0 {
+		u.RawQuery = ""
+	} else {
+		u.RawQuery = "?" + strings.Join(pairs, "&")
+	}
+}
+
 // Malmormed percent-encodings simply pass as is.
 func bestEffortDecode(s string) string {
 	i := strings.IndexByte(s, '%')
@@ -664,6 +1149,57 @@ func encodeWithLead(s string, lead byte) string {
 	return b.String()
 }
 
+// DecodeQueryComponent returns the percent-decoding of a name or a value from
+// a query. The plus ('+') is a sub-delim in RFC 3986, and not a space.
+func decodeQueryComponent(s string) (string, error) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil // fast path
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '%':
+			v, err := parseHex(s, i+1)
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(v)
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// EncodeQueryComponent returns s percent-encoded for use as a name or a value
+// in a query, with uppercase hex digits.
+func encodeQueryComponent(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		// query BNF excluding pct-encoded and the pair delimiters, with the
+		// plus escaped for consumers with form decoding
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', // unreserved
+			'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', // unreserved
+			'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', // unreserved
+			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', // unreserved
+			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', // unreserved
+			'-', '.', '_', '~', // unreserved
+			'!', '$', '\'', '(', ')', '*', ',', ';', // sub-delims without '&', '+' and '='
+			':', '@', // pchar
+			'/', '?': // query
+			b.WriteByte(c)
+
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexTable[c>>4])
+			b.WriteByte(hexTable[c&15])
+		}
+	}
+	return b.String()
+}
+
 // HexTable maps a nibble to its encoded value.
 //
 // “For consistency, URI producers and normalizers should use uppercase
@@ -0,0 +1,212 @@
+// Package vc implements the W3C Verifiable Credentials Data Model, in both
+// version 1.1 and version 2.0. Credentials secure either as a JWT (VC-JWT),
+// or with an embedded Data Integrity proof.
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Base contexts of credentials
+const (
+	V1 = "https://www.w3.org/2018/credentials/v1"
+	V2 = "https://www.w3.org/ns/credentials/v2"
+)
+
+// Credential is a verifiable credential. The proof is absent in the JWT
+// encoding.
+type Credential struct {
+	// Context is either a URI string, or a context definition as a
+	// map[string]any. The first entry is V1 or V2.
+	Context []any    `json:"@context"`
+	ID      string   `json:"id,omitempty"`
+	Types   []string `json:"type"`
+	Issuer  Issuer   `json:"issuer"`
+
+	// version 1.1
+	IssuanceDate   *time.Time `json:"issuanceDate,omitempty"`
+	ExpirationDate *time.Time `json:"expirationDate,omitempty"`
+	// version 2.0
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+
+	Subjects Subjects  `json:"credentialSubject"`
+	Status   Statuses  `json:"credentialStatus,omitempty"`
+	Schemas  []*Schema `json:"credentialSchema,omitempty"`
+
+	Proof *Proof `json:"proof,omitempty"`
+}
+
+// Issuer identifies the issuer with a URI, typically a DID. The JSON is a
+// string when Name and Description are absent.
+type Issuer struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (iss Issuer) MarshalJSON() ([]byte, error) {
+	if iss.Name == "" && iss.Description == "" {
+		return json.Marshal(iss.ID)
+	}
+	type plain Issuer
+	return json.Marshal(plain(iss))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (iss *Issuer) UnmarshalJSON(bytes []byte) error {
+	if len(bytes) != 0 && bytes[0] == '"' {
+		*iss = Issuer{}
+		return json.Unmarshal(bytes, &iss.ID)
+	}
+	type plain Issuer
+	return json.Unmarshal(bytes, (*plain)(iss))
+}
+
+// Subjects holds the claims per subject. The JSON is an object for a single
+// subject, and an array otherwise.
+type Subjects []map[string]any
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s Subjects) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]map[string]any(s))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *Subjects) UnmarshalJSON(bytes []byte) error {
+	if len(bytes) != 0 && bytes[0] == '{' {
+		var m map[string]any
+		if err := json.Unmarshal(bytes, &m); err != nil {
+			return err
+		}
+		*s = Subjects{m}
+		return nil
+	}
+	return json.Unmarshal(bytes, (*[]map[string]any)(s))
+}
+
+// Status is a “StatusList2021Entry” or a “BitstringStatusListEntry”.
+type Status struct {
+	ID                   string `json:"id,omitempty"`
+	Type                 string `json:"type"`
+	StatusPurpose        string `json:"statusPurpose"`
+	StatusListIndex      string `json:"statusListIndex"`
+	StatusListCredential string `json:"statusListCredential"`
+}
+
+// Statuses holds the status entries, e.g., one for revocation and one for
+// suspension. The JSON is an object for a single entry, and an array
+// otherwise.
+type Statuses []*Status
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s Statuses) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]*Status(s))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *Statuses) UnmarshalJSON(bytes []byte) error {
+	if len(bytes) != 0 && bytes[0] == '{' {
+		status := new(Status)
+		if err := json.Unmarshal(bytes, status); err != nil {
+			return err
+		}
+		*s = Statuses{status}
+		return nil
+	}
+	return json.Unmarshal(bytes, (*[]*Status)(s))
+}
+
+// Schema is a “credentialSchema” entry, such as a JsonSchema.
+type Schema struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// V2 returns whether c is in the data model of version 2.0.
+func (c *Credential) V2() bool {
+	return len(c.Context) != 0 && c.Context[0] == V2
+}
+
+// Validate checks c against the constraints of the data model. Each error
+// found is included.
+func (c *Credential) Validate() error {
+	var errs []error
+	if len(c.Context) == 0 || (c.Context[0] != V1 && c.Context[0] != V2) {
+		errs = append(errs, fmt.Errorf("credential @context does not start with %q nor %q", V1, V2))
+	}
+	var isVC bool
+	for _, t := range c.Types {
+		isVC = isVC || t == "VerifiableCredential"
+	}
+	if !isVC {
+		errs = append(errs, errors.New(`credential type has no "VerifiableCredential"`))
+	}
+	if c.ID != "" && !isURI(c.ID) {
+		errs = append(errs, fmt.Errorf("credential id %q is not a URI", c.ID))
+	}
+	if !isURI(c.Issuer.ID) {
+		errs = append(errs, fmt.Errorf("credential issuer %q is not a URI", c.Issuer.ID))
+	}
+
+	if c.V2() {
+		if c.IssuanceDate != nil || c.ExpirationDate != nil {
+			errs = append(errs, errors.New("credential of data model 2.0 with issuanceDate or expirationDate"))
+		}
+		if c.ValidFrom != nil && c.ValidUntil != nil && c.ValidUntil.Before(*c.ValidFrom) {
+			errs = append(errs, errors.New("credential validUntil before validFrom"))
+		}
+	} else {
+		if c.IssuanceDate == nil {
+			errs = append(errs, errors.New("credential has no issuanceDate"))
+		} else if c.ExpirationDate != nil && c.ExpirationDate.Before(*c.IssuanceDate) {
+			errs = append(errs, errors.New("credential expirationDate before issuanceDate"))
+		}
+	}
+
+	if len(c.Subjects) == 0 {
+		errs = append(errs, errors.New("credential has no credentialSubject"))
+	}
+	for _, s := range c.Subjects {
+		if len(s) == 0 {
+			errs = append(errs, errors.New("credential has an empty credentialSubject"))
+		}
+	}
+	for _, status := range c.Status {
+		if status == nil || status.Type == "" {
+			errs = append(errs, errors.New("credential status has no type"))
+		}
+	}
+	for _, s := range c.Schemas {
+		if !isURI(s.ID) || s.Type == "" {
+			errs = append(errs, fmt.Errorf("credential schema %q needs a URI id and a type", s.ID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidAt returns whether the validity period of c includes t. Absent bounds
+// do not limit.
+func (c *Credential) ValidAt(t time.Time) bool {
+	from, until := c.IssuanceDate, c.ExpirationDate
+	if c.V2() {
+		from, until = c.ValidFrom, c.ValidUntil
+	}
+	return (from == nil || !t.Before(*from)) && (until == nil || t.Before(*until))
+}
+
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
@@ -0,0 +1,166 @@
+package vc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// DocumentProofPurpose is the proof purpose of DID documents, as the authority
+// to update a document is that of capability invocation.
+const DocumentProofPurpose = "capabilityInvocation"
+
+// SignDocument returns a copy of doc with a Data Integrity proof in Proof,
+// by signer, which must be the key of verificationMethod, i.e., a capability
+// invocation method in doc of either the subject or one of the controllers.
+// The document must be without a proof. SignDocument does not modify doc.
+func SignDocument(doc *backend.Document, signer crypto.Signer, verificationMethod *backend.URL) (*backend.Document, error) {
+	if doc.Proof != nil {
+		return nil, errors.New("DID document to sign has a proof already")
+	}
+	m, err := documentSigner(doc, verificationMethod)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return nil, err
+	}
+	if k, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(signer.Public()) {
+		return nil, fmt.Errorf("signer is not the key of verification method %s", verificationMethod.String())
+	}
+
+	unsecured, err := documentJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	created := time.Now().UTC().Truncate(time.Second)
+	proof := &Proof{
+		Type:               "DataIntegrityProof",
+		Created:            &created,
+		VerificationMethod: verificationMethod.String(),
+		ProofPurpose:       DocumentProofPurpose,
+	}
+	if err := sign(unsecured, unsecured["@context"], proof, signer); err != nil {
+		return nil, err
+	}
+	signed := *doc // copy
+	signed.Proof, err = json.Marshal(proof)
+	if err != nil {
+		return nil, err
+	}
+	return &signed, nil
+}
+
+// VerifyDocumentProof checks the embedded proof of doc, as created with
+// SignDocument, and it returns the verification method of the signer. The
+// key comes from doc itself, so the proof only shows that the holder of a
+// key in the document signed it, exactly as is. Compare the method and its
+// key with those of a trusted source, such as an earlier version of the
+// document, to establish authenticity. Errors wrap ErrProof.
+func VerifyDocumentProof(doc *backend.Document) (*backend.URL, error) {
+	if doc.Proof == nil {
+		return nil, fmt.Errorf("%w: DID document without proof", ErrProof)
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc.Proof))
+	dec.UseNumber()
+	var proofJSON map[string]any
+	if err := dec.Decode(&proofJSON); err != nil {
+		return nil, fmt.Errorf("%w: DID document proof: %w", ErrProof, err)
+	}
+	var proof Proof
+	if err := json.Unmarshal(doc.Proof, &proof); err != nil {
+		return nil, fmt.Errorf("%w: DID document proof: %w", ErrProof, err)
+	}
+	switch {
+	case proof.Type != "DataIntegrityProof":
+		return nil, fmt.Errorf("%w: proof type %q not supported", ErrProof, proof.Type)
+	case proof.ProofPurpose != DocumentProofPurpose:
+		return nil, fmt.Errorf("%w: proof purpose %q, want %q", ErrProof, proof.ProofPurpose, DocumentProofPurpose)
+	}
+	keyID, err := backend.ParseURL(proof.VerificationMethod)
+	if err != nil || keyID.IsRelative() {
+		return nil, fmt.Errorf("%w: proof verification method %q is not a DID URL", ErrProof, proof.VerificationMethod)
+	}
+	m, err := documentSigner(doc, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProof, err)
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProof, err)
+	}
+
+	unsigned := *doc // copy
+	unsigned.Proof = nil
+	unsecured, err := documentJSON(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	var v *Verifier // JCS only
+	if err := v.checkSignature(unsecured, proofJSON, &proof, pub); err != nil {
+		return nil, err
+	}
+	return keyID, nil
+}
+
+// DocumentSigner returns the capability invocation method id from doc, when
+// of the subject or of one of the controllers.
+func documentSigner(doc *backend.Document, id *backend.URL) (*backend.VerificationMethod, error) {
+	if !id.DID.Equal(doc.Subject) && !doc.Controllers.ContainsString(id.DID.String()) {
+		return nil, fmt.Errorf("verification method %s is neither of the subject nor of a controller", id.String())
+	}
+	m := doc.AuthorizedMethod(doc.CapabilityInvocation, id)
+	if m == nil {
+		return nil, fmt.Errorf("%w: no %s method %s in DID document", backend.ErrNotFound, DocumentProofPurpose, id.String())
+	}
+	return m, nil
+}
+
+// DocumentJSON returns the JSON object of doc, with numbers preserved.
+func documentJSON(doc *backend.Document) (map[string]any, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ProofResolver is a Resolver which verifies the embedded proof of each
+// document, as with VerifyDocumentProof, such as for documents from mirrors
+// or from gossip. Documents with a proof which does not verify fail with
+// ErrProof. Documents without a proof pass, unless Require is set.
+type ProofResolver struct {
+	Resolver backend.Resolver
+
+	// Require rejects documents without a proof.
+	Require bool
+}
+
+// Resolve implements the backend.Resolver interface.
+func (r *ProofResolver) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, meta, err := r.Resolver.Resolve(ctx, did)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.Proof == nil && !r.Require {
+		return doc, meta, nil
+	}
+	if _, err := VerifyDocumentProof(doc); err != nil {
+		return nil, nil, fmt.Errorf("DID document of %s: %w", did.String(), err)
+	}
+	return doc, meta, nil
+}
@@ -0,0 +1,115 @@
+package vc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+func TestSignDocument(t *testing.T) {
+	for _, kind := range []keys.Type{keys.Ed25519, keys.P256} {
+		key, _ := keys.Generate(kind)
+		signer, _ := keys.Signer(key)
+		did, err := didkey.New(signer.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, _, err := new(didkey.Resolver).Resolve(context.Background(), did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID := &backend.URL{DID: did, RawFragment: "#" + did.SpecID}
+
+		signed, err := SignDocument(doc, signer, keyID)
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		if doc.Proof != nil {
+			t.Errorf("%s: SignDocument modified the original", kind)
+		}
+		// over the wire
+		raw, err := json.Marshal(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var received backend.Document
+		if err := json.Unmarshal(raw, &received); err != nil {
+			t.Fatal(err)
+		}
+		got, err := VerifyDocumentProof(&received)
+		if err != nil {
+			t.Fatalf("%s: got error: %s", kind, err)
+		}
+		if !got.Equal(keyID) {
+			t.Errorf("%s: got verification method %s, want %s", kind, got, keyID)
+		}
+
+		received.AlsoKnownAs = []string{"https://example.com/"}
+		if _, err := VerifyDocumentProof(&received); !errors.Is(err, ErrProof) {
+			t.Errorf("%s: tampered document got error %v, want ErrProof", kind, err)
+		}
+		if _, err := VerifyDocumentProof(doc); !errors.Is(err, ErrProof) {
+			t.Errorf("%s: document without proof got error %v, want ErrProof", kind, err)
+		}
+
+		other, _ := keys.Generate(kind)
+		otherSigner, _ := keys.Signer(other)
+		if _, err := SignDocument(doc, otherSigner, keyID); err == nil {
+			t.Errorf("%s: signed with a key not in the document", kind)
+		}
+	}
+}
+
+// Mirror serves fixed documents.
+type mirror map[string]*backend.Document
+
+func (m mirror) Resolve(_ context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	doc, ok := m[did.String()]
+	if !ok {
+		return nil, nil, backend.ErrNotFound
+	}
+	return doc, new(backend.Meta), nil
+}
+
+func TestProofResolver(t *testing.T) {
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	doc, _, err := new(didkey.Resolver).Resolve(context.Background(), did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := SignDocument(doc, signer, &backend.URL{DID: did, RawFragment: "#" + did.SpecID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *signed
+	tampered.AlsoKnownAs = []string{"did:example:evil"}
+
+	ctx := context.Background()
+	for _, test := range []struct {
+		doc     *backend.Document
+		require bool
+		wantErr bool
+	}{
+		{signed, true, false},
+		{signed, false, false},
+		{doc, false, false},
+		{doc, true, true},
+		{&tampered, false, true},
+	} {
+		r := &ProofResolver{Resolver: mirror{did.String(): test.doc}, Require: test.require}
+		_, _, err := r.Resolve(ctx, did)
+		if test.wantErr && !errors.Is(err, ErrProof) {
+			t.Errorf("proof %t, require %t: got error %v, want ErrProof", test.doc.Proof != nil, test.require, err)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("proof %t, require %t: got error: %s", test.doc.Proof != nil, test.require, err)
+		}
+	}
+}
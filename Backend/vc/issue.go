@@ -0,0 +1,230 @@
+package vc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// Format is a securing mechanism.
+type Format string
+
+// Supported formats
+const (
+	JWT           Format = "jwt"            // VC-JWT, conform data model 1.1, section 6.3.1
+	DataIntegrity Format = "data-integrity" // embedded proof
+)
+
+// DataIntegrityV2 is the context of Data Integrity proofs, which is included
+// in V2 already.
+const DataIntegrityV2 = "https://w3id.org/security/data-integrity/v2"
+
+// Cryptosuites with JCS canonicalization
+const (
+	EdDSAJCS2022 = "eddsa-jcs-2022" // Ed25519
+	ECDSAJCS2019 = "ecdsa-jcs-2019" // P-256 or P-384
+)
+
+// Cryptosuites with RDF Dataset Canonicalization, for verification only. See
+// Verifier.Contexts.
+const (
+	EdDSARDFC2022 = "eddsa-rdfc-2022" // Ed25519
+	ECDSARDFC2019 = "ecdsa-rdfc-2019" // P-256 or P-384
+)
+
+// Proof is a “DataIntegrityProof”.
+type Proof struct {
+	Type               string     `json:"type"`
+	Cryptosuite        string     `json:"cryptosuite"`
+	Created            *time.Time `json:"created,omitempty"`
+	VerificationMethod string     `json:"verificationMethod"`
+	ProofPurpose       string     `json:"proofPurpose"`
+	Challenge          string     `json:"challenge,omitempty"`
+	Domain             string     `json:"domain,omitempty"`
+	ProofValue         string     `json:"proofValue,omitempty"`
+}
+
+// Issue secures c with signer, which must be the key of verificationMethod,
+// i.e., an assertion method of the issuer. The return is either a compact JWT
+// or the JSON of c with a proof. The credential must be valid, and without a
+// proof. Issue does not modify c.
+func Issue(c *Credential, signer crypto.Signer, verificationMethod *backend.URL, format Format) ([]byte, error) {
+	if c.Proof != nil {
+		return nil, errors.New("credential to issue has a proof already")
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !verificationMethod.DID.EqualString(c.Issuer.ID) {
+		return nil, fmt.Errorf("verification method %s is not of issuer %s", verificationMethod.String(), c.Issuer.ID)
+	}
+
+	switch format {
+	case JWT:
+		token, err := didjwt.Sign(jwtClaims(c), verificationMethod, signer)
+		return []byte(token), err
+
+	case DataIntegrity:
+		secured := *c // copy
+		if !secured.V2() && !contains(secured.Context, DataIntegrityV2) {
+			secured.Context = append(secured.Context[:len(secured.Context):len(secured.Context)], DataIntegrityV2)
+		}
+		created := time.Now().UTC().Truncate(time.Second)
+		proof := &Proof{
+			Type:               "DataIntegrityProof",
+			Created:            &created,
+			VerificationMethod: verificationMethod.String(),
+			ProofPurpose:       "assertionMethod",
+		}
+		if err := sign(&secured, secured.Context, proof, signer); err != nil {
+			return nil, err
+		}
+		secured.Proof = proof
+		return json.Marshal(&secured)
+
+	default:
+		return nil, fmt.Errorf("credential format %q not supported", format)
+	}
+}
+
+// JWTClaims maps c to the registered claims, with c in the "vc" claim.
+func jwtClaims(c *Credential) map[string]any {
+	claims := map[string]any{
+		"iss": c.Issuer.ID,
+		"vc":  c,
+	}
+	if c.ID != "" {
+		claims["jti"] = c.ID
+	}
+	if len(c.Subjects) == 1 {
+		if id, ok := c.Subjects[0]["id"].(string); ok {
+			claims["sub"] = id
+		}
+	}
+	from, until := c.IssuanceDate, c.ExpirationDate
+	if c.V2() {
+		from, until = c.ValidFrom, c.ValidUntil
+	}
+	if from != nil {
+		claims["nbf"] = from.Unix()
+	}
+	if until != nil {
+		claims["exp"] = until.Unix()
+	}
+	return claims
+}
+
+func contains(context []any, uri string) bool {
+	for _, e := range context {
+		if e == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign sets the cryptosuite and the proofValue of proof, over the unsecured
+// document with context.
+func sign(unsecured any, context any, proof *Proof, signer crypto.Signer) error {
+	suite, h, err := suiteFor(signer.Public())
+	if err != nil {
+		return err
+	}
+	proof.Cryptosuite = suite
+	proof.ProofValue = ""
+	config := struct {
+		Context any `json:"@context"`
+		*Proof
+	}{context, proof}
+	hashData, err := proofHash(unsecured, &config, h, Canonicalize)
+	if err != nil {
+		return err
+	}
+
+	var sig []byte
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		sig, err = signer.Sign(rand.Reader, hashData, crypto.Hash(0))
+		if err != nil {
+			return err
+		}
+	case *ecdsa.PublicKey:
+		// ECDSA signs the hash of hashData
+		digest := h()
+		digest.Write(hashData)
+		der, err := signer.Sign(rand.Reader, digest.Sum(nil), hashFunc(pub))
+		if err != nil {
+			return err
+		}
+		// “the signature … in IEEE P1363 format”
+		var parsed struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &parsed); err != nil {
+			return fmt.Errorf("ECDSA signature from signer: %w", err)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		parsed.R.FillBytes(sig[:size])
+		parsed.S.FillBytes(sig[size:])
+	}
+	proof.ProofValue = multiformat.Encode(multiformat.Base58BTC, sig)
+	return nil
+}
+
+// SuiteFor returns the cryptosuite for the public key, with its hash.
+func suiteFor(pub crypto.PublicKey) (string, func() hash.Hash, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return EdDSAJCS2022, sha256.New, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return ECDSAJCS2019, sha256.New, nil
+		case elliptic.P384():
+			return ECDSAJCS2019, sha512.New384, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no Data Integrity cryptosuite for key type %T", pub)
+}
+
+func hashFunc(pub *ecdsa.PublicKey) crypto.Hash {
+	if pub.Curve == elliptic.P384() {
+		return crypto.SHA384
+	}
+	return crypto.SHA256
+}
+
+// ProofHash returns the hash of the canonical proof configuration, followed
+// by the hash of the canonical document, conform both the JCS and the RDFC
+// cryptosuites. The configuration is the proof without its value, with the
+// "@context" of the document.
+func proofHash(unsecured, config any, h func() hash.Hash, canonicalize func(any) ([]byte, error)) ([]byte, error) {
+	canonicalConfig, err := canonicalize(config)
+	if err != nil {
+		return nil, err
+	}
+	canonicalDoc, err := canonicalize(unsecured)
+	if err != nil {
+		return nil, err
+	}
+
+	configHash := h()
+	configHash.Write(canonicalConfig)
+	docHash := h()
+	docHash.Write(canonicalDoc)
+	return docHash.Sum(configHash.Sum(nil)), nil
+}
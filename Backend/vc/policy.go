@@ -0,0 +1,277 @@
+package vc
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/keys"
+)
+
+// ErrPolicy signals a credential rejected by a Policy. See Rejection for the
+// reasons.
+var ErrPolicy = errors.New("verifiable credential rejected by policy")
+
+// Evidence is what policies decide on, i.e., a credential with a valid proof.
+type Evidence struct {
+	Credential *Credential
+
+	// Method is the verification method of the proof, in the DID document
+	// of the issuer.
+	Method *backend.URL
+
+	// Issued is the creation time of the proof, with a fallback to the
+	// issuance date, or the start of validity, of the credential. The time
+	// is a claim of the issuer. Zero is unknown.
+	Issued time.Time
+}
+
+// Policy decides whether to accept credentials, beyond the verification of
+// their proof. Policies resolve issuers with r as needed.
+type Policy interface {
+	// Check returns nil for acceptance. Rejections should be a *Rejection.
+	Check(ctx context.Context, r backend.Resolver, e *Evidence) error
+}
+
+// Rejection is the error of a Policy, with a Reason per rule violated. It
+// wraps ErrPolicy, and the error of each reason.
+type Rejection struct {
+	Reasons []Reason
+}
+
+// Reason is a rule violation.
+type Reason struct {
+	Rule string // name
+	Err  error
+}
+
+// Error implements the error interface.
+func (r *Rejection) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrPolicy.Error())
+	for i, reason := range r.Reasons {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(reason.Rule)
+		b.WriteString(": ")
+		b.WriteString(reason.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap provides ErrPolicy, followed by the error of each reason, for
+// errors.Is and errors.As.
+func (r *Rejection) Unwrap() []error {
+	errs := make([]error, 0, len(r.Reasons)+1)
+	errs = append(errs, ErrPolicy)
+	for _, reason := range r.Reasons {
+		errs = append(errs, reason.Err)
+	}
+	return errs
+}
+
+// ReasonsOf returns the reasons of a policy error. Errors other than a
+// Rejection count as a reason of rule.
+func reasonsOf(err error, rule string) []Reason {
+	var r *Rejection
+	if errors.As(err, &r) {
+		return r.Reasons
+	}
+	return []Reason{{Rule: rule, Err: err}}
+}
+
+// Rule is a Policy with a name for its rejection reason.
+type Rule struct {
+	Name string
+	Func func(ctx context.Context, r backend.Resolver, e *Evidence) error
+}
+
+// Check implements the Policy interface.
+func (rule *Rule) Check(ctx context.Context, r backend.Resolver, e *Evidence) error {
+	if err := rule.Func(ctx, r, e); err != nil {
+		return &Rejection{Reasons: reasonsOf(err, rule.Name)}
+	}
+	return nil
+}
+
+// All returns a Policy which accepts when each of policies accepts. Each of
+// policies is checked, for a complete list of reasons on rejection.
+func All(policies ...Policy) Policy {
+	return all(policies)
+}
+
+type all []Policy
+
+// Check implements the Policy interface.
+func (a all) Check(ctx context.Context, r backend.Resolver, e *Evidence) error {
+	var reasons []Reason
+	for i, p := range a {
+		if err := p.Check(ctx, r, e); err != nil {
+			reasons = append(reasons, reasonsOf(err, fmt.Sprintf("policy № %d", i+1))...)
+		}
+	}
+	if len(reasons) != 0 {
+		return &Rejection{Reasons: reasons}
+	}
+	return nil
+}
+
+// Any returns a Policy which accepts when one of policies accepts. The
+// rejection has the reasons of each of policies. Note that Any without
+// policies rejects everything.
+func Any(policies ...Policy) Policy {
+	return anyOf(policies)
+}
+
+type anyOf []Policy
+
+// Check implements the Policy interface.
+func (a anyOf) Check(ctx context.Context, r backend.Resolver, e *Evidence) error {
+	var reasons []Reason
+	for i, p := range a {
+		err := p.Check(ctx, r, e)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, reasonsOf(err, fmt.Sprintf("policy № %d", i+1))...)
+	}
+	return &Rejection{Reasons: reasons}
+}
+
+// NotDeactivated rejects credentials of issuers which are deactivated at the
+// time of verification, regardless of the time of issuance.
+var NotDeactivated Policy = &Rule{
+	Name: "issuer not deactivated",
+	Func: func(ctx context.Context, r backend.Resolver, e *Evidence) error {
+		_, meta, err := r.Resolve(ctx, e.Method.DID)
+		if err != nil {
+			return fmt.Errorf("issuer resolution: %w", err)
+		}
+		if meta != nil && !meta.Deactivated.IsZero() {
+			return fmt.Errorf("%w at %s", backend.ErrDeactivated, meta.Deactivated.UTC().Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+// RequireRelationship rejects credentials with a proof method which is not
+// authorized for relationship, such as "assertionMethod", in the current DID
+// document of the issuer.
+func RequireRelationship(relationship string) Policy {
+	return &Rule{
+		Name: "issuer " + relationship,
+		Func: func(ctx context.Context, r backend.Resolver, e *Evidence) error {
+			doc, _, err := r.Resolve(ctx, e.Method.DID)
+			if err != nil {
+				return fmt.Errorf("issuer resolution: %w", err)
+			}
+			if doc.AuthorizedMethod(doc.Relationship(relationship), e.Method) == nil {
+				return fmt.Errorf("%w: no %s method %s in DID document", backend.ErrNotFound, relationship, e.Method.String())
+			}
+			return nil
+		},
+	}
+}
+
+// HardwareBound reports whether the key of a verification method resides in
+// hardware. Implementations typically look up evidence collected out of band,
+// such as a keystore.Attestation which verified against the enrolled
+// attestation key of the issuer.
+type HardwareBound func(ctx context.Context, method *backend.URL, pub crypto.PublicKey) (bool, error)
+
+// RequireHardwareKey rejects credentials with a proof key which bound does not
+// confirm as hardware-bound. The key is the assertionMethod in the current DID
+// document of the issuer.
+func RequireHardwareKey(bound HardwareBound) Policy {
+	return &Rule{
+		Name: "hardware-bound key",
+		Func: func(ctx context.Context, r backend.Resolver, e *Evidence) error {
+			doc, _, err := r.Resolve(ctx, e.Method.DID)
+			if err != nil {
+				return fmt.Errorf("issuer resolution: %w", err)
+			}
+			m := doc.AuthorizedMethod(doc.AssertionMethod, e.Method)
+			if m == nil {
+				return fmt.Errorf("%w: no assertionMethod %s in DID document", backend.ErrNotFound, e.Method.String())
+			}
+			pub, err := keys.MethodKey(m)
+			if err != nil {
+				return err
+			}
+			ok, err := bound(ctx, e.Method, pub)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("key of %s not attested as hardware-bound", e.Method.String())
+			}
+			return nil
+		},
+	}
+}
+
+// ValidAtIssuance rejects credentials with a proof key which was not in the
+// DID document of the issuer at the time of issuance, as an assertionMethod.
+// The document is resolved with the "versionTime" parameter, which requires a
+// backend.VersionResolver. Keys rotated in or added after issuance thus can
+// not sign credentials dated before their existence.
+var ValidAtIssuance Policy = &Rule{
+	Name: "key valid at issuance",
+	Func: func(ctx context.Context, r backend.Resolver, e *Evidence) error {
+		if e.Issued.IsZero() {
+			return errors.New("time of issuance unknown")
+		}
+		vr, ok := r.(backend.VersionResolver)
+		if !ok {
+			return fmt.Errorf("%w: resolver has no version support", backend.ErrNotFound)
+		}
+
+		current, err := methodKey(ctx, r, e.Method)
+		if err != nil {
+			return err
+		}
+		then, err := methodKey(ctx, versionAt{vr, e.Issued}, e.Method)
+		if err != nil {
+			return fmt.Errorf("at %s: %w", e.Issued.UTC().Format(time.RFC3339), err)
+		}
+		if current != then {
+			return fmt.Errorf("%w: key of %s rotated since %s", backend.ErrNotFound, e.Method.String(), e.Issued.UTC().Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+// VersionAt resolves DIDs at a fixed time.
+type versionAt struct {
+	backend.VersionResolver
+	t time.Time
+}
+
+// Resolve implements the backend.Resolver interface.
+func (v versionAt) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return v.ResolveVersion(ctx, did, "", v.t)
+}
+
+// MethodKey returns the key of assertion method id in multibase.
+func methodKey(ctx context.Context, r backend.Resolver, id *backend.URL) (string, error) {
+	doc, _, err := r.Resolve(ctx, id.DID)
+	if err != nil {
+		return "", fmt.Errorf("issuer resolution: %w", err)
+	}
+	m := doc.AuthorizedMethod(doc.AssertionMethod, id)
+	if m == nil {
+		return "", fmt.Errorf("%w: no assertionMethod %s in DID document", backend.ErrNotFound, id.String())
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return "", err
+	}
+	return keys.Multibase(pub)
+}
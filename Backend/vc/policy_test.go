@@ -0,0 +1,155 @@
+package vc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/rotation"
+)
+
+// History is a backend.VersionResolver of a single DID.
+type history []struct {
+	since time.Time
+	doc   *backend.Document
+	meta  *backend.Meta
+}
+
+func (h history) Resolve(ctx context.Context, did backend.DID) (*backend.Document, *backend.Meta, error) {
+	return h.ResolveVersion(ctx, did, "", time.Time{})
+}
+
+func (h history) ResolveVersion(_ context.Context, did backend.DID, _ string, t time.Time) (*backend.Document, *backend.Meta, error) {
+	if !did.Equal(h[0].doc.Subject) {
+		return nil, nil, backend.ErrNotFound
+	}
+	for i := len(h) - 1; i >= 0; i-- {
+		if t.IsZero() || !h[i].since.After(t) {
+			return h[i].doc, h[i].meta, nil
+		}
+	}
+	return nil, nil, backend.ErrNotFound
+}
+
+func TestPolicy(t *testing.T) {
+	var signers [2]crypto.Signer
+	for i := range signers {
+		key, _ := keys.Generate(keys.Ed25519)
+		signers[i], _ = keys.Signer(key)
+	}
+	issuer := backend.DID{Method: "example", SpecID: "issuer"}
+	keyID := backend.URL{DID: issuer, RawFragment: "#key-1"}
+	m, err := keys.NewMethod(keyID, issuer, signers[0].Public(), keys.Multikey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &backend.Document{
+		Subject:             issuer,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		AssertionMethod:     &backend.VerificationRelationship{URIRefs: []*backend.URL{{RawFragment: "#key-1"}}},
+	}
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotated := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	meta := &backend.Meta{Created: created}
+	rotatedDoc, err := rotation.Rotate(doc, meta, &keyID, signers[1].Public(), nil, rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := history{
+		{created, doc, &backend.Meta{Created: created}},
+		{rotated, rotatedDoc, meta},
+	}
+
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	v := &Verifier{Resolver: resolver, Policy: All(ValidAtIssuance, NotDeactivated)}
+
+	// dated before the rotation, yet signed with the new key
+	backdated, err := Issue(newCredential(issuer), signers[1], &keyID, JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.VerifyCredential(ctx, backdated, now)
+	var rejection *Rejection
+	if !errors.As(err, &rejection) || !errors.Is(err, ErrPolicy) {
+		t.Fatalf("backdated credential got error %v, want a Rejection", err)
+	}
+	if len(rejection.Reasons) != 1 || rejection.Reasons[0].Rule != "key valid at issuance" {
+		t.Errorf("backdated credential got reasons %+v", rejection.Reasons)
+	}
+
+	// the Data Integrity proof dates the signature instead
+	secured, err := Issue(newCredential(issuer), signers[1], &keyID, DataIntegrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifyCredential(ctx, secured, now); err != nil {
+		t.Errorf("credential with a proof after rotation got error: %s", err)
+	}
+
+	c := newCredential(issuer)
+	issued := rotated.AddDate(0, 1, 0)
+	c.IssuanceDate = &issued
+	current, err := Issue(c, signers[1], &keyID, JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifyCredential(ctx, current, now); err != nil {
+		t.Errorf("credential issued after rotation got error: %s", err)
+	}
+
+	// each reason of All is reported
+	meta.Deactivated = now.AddDate(0, 0, -1)
+	_, err = v.VerifyCredential(ctx, backdated, now)
+	if !errors.As(err, &rejection) || len(rejection.Reasons) != 2 {
+		t.Fatalf("backdated credential of deactivated issuer got error %v, want 2 reasons", err)
+	}
+	if !errors.Is(err, backend.ErrDeactivated) || rejection.Reasons[1].Rule != "issuer not deactivated" {
+		t.Errorf("got reasons %+v", rejection.Reasons)
+	}
+	meta.Deactivated = time.Time{}
+
+	v.Policy = RequireRelationship("capabilityInvocation")
+	if _, err := v.VerifyCredential(ctx, current, now); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("credential without capabilityInvocation got error %v, want ErrNotFound", err)
+	}
+	v.Policy = Any(RequireRelationship("capabilityInvocation"), RequireRelationship("assertionMethod"))
+	if _, err := v.VerifyCredential(ctx, current, now); err != nil {
+		t.Errorf("credential with any of the relationships got error: %s", err)
+	}
+
+	// hardware-bound by attestation, i.e., only the initial key
+	attested := signers[0].Public()
+	v.Policy = RequireHardwareKey(func(_ context.Context, method *backend.URL, pub crypto.PublicKey) (bool, error) {
+		if !method.Equal(&keyID) {
+			t.Errorf("hardware check of method %s, want %s", method.String(), keyID.String())
+		}
+		return pub.(ed25519.PublicKey).Equal(attested), nil
+	})
+	if _, err := v.VerifyCredential(ctx, current, now); !errors.As(err, &rejection) || rejection.Reasons[0].Rule != "hardware-bound key" {
+		t.Errorf("credential of a key without attestation got error %v, want a hardware-bound key rejection", err)
+	}
+	attested = signers[1].Public()
+	if _, err := v.VerifyCredential(ctx, current, now); err != nil {
+		t.Errorf("credential of an attested key got error: %s", err)
+	}
+
+	// versionTime resolution required
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	secured, err = Issue(newCredential(did), signer, &backend.URL{DID: did, RawFragment: "#" + did.SpecID}, DataIntegrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v = &Verifier{Resolver: new(didkey.Resolver), Policy: ValidAtIssuance}
+	if _, err := v.VerifyCredential(ctx, secured, now); !errors.Is(err, ErrPolicy) {
+		t.Errorf("resolver without version support got error %v, want ErrPolicy", err)
+	}
+}
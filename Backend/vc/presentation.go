@@ -0,0 +1,136 @@
+package vc
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+)
+
+// Presentation is a verifiable presentation. The proof is absent in the JWT
+// encoding.
+type Presentation struct {
+	Context []any    `json:"@context"`
+	ID      string   `json:"id,omitempty"`
+	Types   []string `json:"type"`
+	Holder  string   `json:"holder,omitempty"`
+
+	// Credentials are secured, i.e., either a JSON object with a proof,
+	// or a JSON string with a VC-JWT. See Add.
+	Credentials []json.RawMessage `json:"verifiableCredential,omitempty"`
+
+	Proof *Proof `json:"proof,omitempty"`
+}
+
+// NewPresentation returns an empty presentation of holder in the data model
+// of version 2.0.
+func NewPresentation(holder backend.DID) *Presentation {
+	return &Presentation{
+		Context: []any{V2},
+		Types:   []string{"VerifiablePresentation"},
+		Holder:  holder.String(),
+	}
+}
+
+// Add includes a secured credential, as returned by Issue.
+func (p *Presentation) Add(secured []byte) error {
+	if len(secured) != 0 && secured[0] == '{' {
+		if !json.Valid(secured) {
+			return errors.New("secured credential is not valid JSON")
+		}
+		p.Credentials = append(p.Credentials, json.RawMessage(secured))
+		return nil
+	}
+	s, err := json.Marshal(string(secured))
+	if err != nil {
+		return err
+	}
+	p.Credentials = append(p.Credentials, s)
+	return nil
+}
+
+// Validate checks p against the constraints of the data model.
+func (p *Presentation) Validate() error {
+	var errs []error
+	if len(p.Context) == 0 || (p.Context[0] != V1 && p.Context[0] != V2) {
+		errs = append(errs, fmt.Errorf("presentation @context does not start with %q nor %q", V1, V2))
+	}
+	var isVP bool
+	for _, t := range p.Types {
+		isVP = isVP || t == "VerifiablePresentation"
+	}
+	if !isVP {
+		errs = append(errs, errors.New(`presentation type has no "VerifiablePresentation"`))
+	}
+	if p.Holder != "" && !isURI(p.Holder) {
+		errs = append(errs, fmt.Errorf("presentation holder %q is not a URI", p.Holder))
+	}
+	return errors.Join(errs...)
+}
+
+// Present secures p with signer, which must be the key of verificationMethod,
+// i.e., an authentication method of the holder. The challenge and the domain
+// of the verifier bind the presentation to a single exchange. The return is
+// either a compact JWT or the JSON of p with a proof. Present does not modify
+// p.
+func Present(p *Presentation, signer crypto.Signer, verificationMethod *backend.URL, challenge, domain string, format Format) ([]byte, error) {
+	if p.Proof != nil {
+		return nil, errors.New("presentation has a proof already")
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Holder != "" && !verificationMethod.DID.EqualString(p.Holder) {
+		return nil, fmt.Errorf("verification method %s is not of holder %s", verificationMethod.String(), p.Holder)
+	}
+	secured := *p // copy
+	secured.Holder = verificationMethod.DID.String()
+
+	switch format {
+	case JWT:
+		now := time.Now().Unix()
+		claims := map[string]any{
+			"iss": secured.Holder,
+			"iat": now,
+			"nbf": now,
+			"vp":  &secured,
+		}
+		if secured.ID != "" {
+			claims["jti"] = secured.ID
+		}
+		if domain != "" {
+			claims["aud"] = domain
+		}
+		if challenge != "" {
+			claims["nonce"] = challenge
+		}
+		token, err := didjwt.Sign(claims, verificationMethod, signer)
+		return []byte(token), err
+
+	case DataIntegrity:
+		if secured.Context[0] == V1 && !contains(secured.Context, DataIntegrityV2) {
+			secured.Context = append(secured.Context[:len(secured.Context):len(secured.Context)], DataIntegrityV2)
+		}
+		created := time.Now().UTC().Truncate(time.Second)
+		proof := &Proof{
+			Type:               "DataIntegrityProof",
+			Created:            &created,
+			VerificationMethod: verificationMethod.String(),
+			ProofPurpose:       "authentication",
+			Challenge:          challenge,
+			Domain:             domain,
+		}
+		if err := sign(&secured, secured.Context, proof, signer); err != nil {
+			return nil, err
+		}
+		secured.Proof = proof
+		return json.Marshal(&secured)
+
+	default:
+		return nil, fmt.Errorf("presentation format %q not supported", format)
+	}
+}
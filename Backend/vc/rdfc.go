@@ -0,0 +1,42 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash"
+
+	"EncrypteDL/IDChain/Backend/jsonld"
+	"EncrypteDL/IDChain/Backend/rdfc"
+)
+
+// RDFCSuites maps each JCS cryptosuite to its RDFC equivalent.
+var rdfcSuites = map[string]string{
+	EdDSAJCS2022: EdDSARDFC2022,
+	ECDSAJCS2019: ECDSARDFC2019,
+}
+
+// CanonicalRDF returns the canonical N-Quads of a JSON-LD document, conform
+// the RDFC cryptosuites. Canonicalization hashes with h, i.e., SHA-384 for
+// P-384 keys.
+func canonicalRDF(doc any, contexts jsonld.Loader, h func() hash.Hash) ([]byte, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	dataset, err := jsonld.ToRDF(tree, contexts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProof, err)
+	}
+	quads, err := (&rdfc.Canonicalizer{Hash: h}).Canonicalize(dataset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProof, err)
+	}
+	return rdfc.Marshal(quads), nil
+}
@@ -0,0 +1,137 @@
+package vc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/jsonld"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// TestContexts has a minimal stand-in for the V2 context, without @vocab.
+var testContexts = jsonld.Contexts{V2: []byte(`{"@context": {
+	"@version": 1.1, "@protected": true, "id": "@id", "type": "@type",
+	"VerifiableCredential": {"@id": "https://www.w3.org/2018/credentials#VerifiableCredential", "@context": {
+		"@protected": true, "id": "@id", "type": "@type",
+		"cred": "https://www.w3.org/2018/credentials#",
+		"xsd": "http://www.w3.org/2001/XMLSchema#",
+		"credentialSubject": {"@id": "cred:credentialSubject", "@type": "@id"},
+		"issuer": {"@id": "cred:issuer", "@type": "@id"},
+		"validFrom": {"@id": "cred:validFrom", "@type": "xsd:dateTime"},
+		"validUntil": {"@id": "cred:validUntil", "@type": "xsd:dateTime"}
+	}},
+	"MembershipCredential": "https://example.com/vocab#MembershipCredential",
+	"member": "https://example.com/vocab#member",
+	"DataIntegrityProof": {"@id": "https://w3id.org/security#DataIntegrityProof", "@context": {
+		"@protected": true, "id": "@id", "type": "@type",
+		"sec": "https://w3id.org/security#",
+		"xsd": "http://www.w3.org/2001/XMLSchema#",
+		"cryptosuite": {"@id": "sec:cryptosuite", "@type": "sec:cryptosuiteString"},
+		"created": {"@id": "http://purl.org/dc/terms/created", "@type": "xsd:dateTime"},
+		"verificationMethod": {"@id": "sec:verificationMethod", "@type": "@id"},
+		"proofPurpose": {"@id": "sec:proofPurpose", "@type": "@vocab", "@context": {
+			"@protected": true, "id": "@id", "type": "@type",
+			"assertionMethod": {"@id": "sec:assertionMethod", "@type": "@id", "@container": "@set"}
+		}},
+		"proofValue": {"@id": "sec:proofValue", "@type": "sec:multibase"}
+	}},
+	"proof": {"@id": "https://w3id.org/security#proof", "@type": "@id", "@container": "@graph"}
+}}`)}
+
+// SignRDFC secures doc with an eddsa-rdfc-2022 proof, as other ecosystems do.
+func signRDFC(t *testing.T, doc map[string]any, signer crypto.Signer, keyID string) []byte {
+	t.Helper()
+	proof := map[string]any{
+		"type":               "DataIntegrityProof",
+		"cryptosuite":        EdDSARDFC2022,
+		"created":            "2024-01-02T03:04:05Z",
+		"verificationMethod": keyID,
+		"proofPurpose":       "assertionMethod",
+	}
+	config := map[string]any{"@context": doc["@context"]}
+	for k, v := range proof {
+		config[k] = v
+	}
+	canonicalize := func(v any) ([]byte, error) { return canonicalRDF(v, testContexts, sha256.New) }
+	hashData, err := proofHash(doc, config, sha256.New, canonicalize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.Sign(rand.Reader, hashData, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof["proofValue"] = multiformat.Encode(multiformat.Base58BTC, sig)
+	secured := map[string]any{"proof": proof}
+	for k, v := range doc {
+		secured[k] = v
+	}
+	b, err := json.Marshal(secured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifyRDFC(t *testing.T) {
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	keyID := (&backend.URL{DID: did, RawFragment: "#" + did.SpecID}).String()
+	newDoc := func(member any) map[string]any {
+		return map[string]any{
+			"@context":          []any{V2},
+			"id":                "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5",
+			"type":              []any{"VerifiableCredential", "MembershipCredential"},
+			"issuer":            did.String(),
+			"validFrom":         "2024-01-02T03:04:05Z",
+			"credentialSubject": map[string]any{"id": "did:example:holder", "member": member},
+		}
+	}
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	v := &Verifier{Resolver: new(didkey.Resolver), Contexts: testContexts}
+
+	secured := signRDFC(t, newDoc("yes"), signer, keyID)
+	c, err := v.VerifyCredential(ctx, secured, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subjects[0]["member"] != "yes" {
+		t.Errorf("got subjects %v", c.Subjects)
+	}
+	if _, err := (&Verifier{Resolver: v.Resolver}).VerifyCredential(ctx, secured, now); !errors.Is(err, ErrProof) {
+		t.Errorf("verification without contexts got error %v, want ErrProof", err)
+	}
+
+	// same RDF in another JSON
+	var doc map[string]any
+	json.Unmarshal(secured, &doc)
+	doc["credentialSubject"] = map[string]any{"@id": "did:example:holder", "member": map[string]any{"@value": "yes"}}
+	equivalent, _ := json.Marshal(doc)
+	if _, err := v.VerifyCredential(ctx, equivalent, now); err != nil {
+		t.Errorf("equivalent credential got error: %s", err)
+	}
+
+	doc["credentialSubject"] = map[string]any{"id": "did:example:holder", "member": "no"}
+	tampered, _ := json.Marshal(doc)
+	if _, err := v.VerifyCredential(ctx, tampered, now); !errors.Is(err, ErrProof) {
+		t.Errorf("tampered credential got error %v, want ErrProof", err)
+	}
+
+	// terms outside of the contexts would escape the signature
+	doc["credentialSubject"] = map[string]any{"id": "did:example:holder", "member": "yes", "role": "admin"}
+	undefined, _ := json.Marshal(doc)
+	if _, err := v.VerifyCredential(ctx, undefined, now); !errors.Is(err, jsonld.ErrUndefined) {
+		t.Errorf("undefined term got error %v, want jsonld.ErrUndefined", err)
+	}
+}
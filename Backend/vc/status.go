@@ -0,0 +1,322 @@
+package vc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+)
+
+// Status list types, as in StatusList2021 and its successor, the Bitstring
+// Status List.
+const (
+	StatusList2021Entry           = "StatusList2021Entry"
+	StatusList2021Credential      = "StatusList2021Credential"
+	BitstringStatusListEntry      = "BitstringStatusListEntry"
+	BitstringStatusListCredential = "BitstringStatusListCredential"
+)
+
+const (
+	statusListDownloadMaxDefault = 1 << 20
+	statusListDecompressedMax    = 1 << 24 // 128 Mi entries
+)
+
+// Status purposes
+const (
+	Revocation = "revocation"
+	Suspension = "suspension"
+)
+
+// ErrRevoked signals a credential with its revocation bit set.
+var ErrRevoked = errors.New("verifiable credential revoked")
+
+// ErrSuspended signals a credential with its suspension bit set.
+var ErrSuspended = errors.New("verifiable credential suspended")
+
+// Bitstring is a status list. Index 0 is the left-most bit of the first byte.
+type Bitstring []byte
+
+// NewBitstring returns a list of n entries, all unset. “The bitstring MUST be
+// a minimum of 16KB in size” for group privacy, i.e., n ≥ 131072.
+func NewBitstring(n int) Bitstring {
+	return make(Bitstring, (n+7)/8)
+}
+
+// Get returns whether the entry at index i is set. Indices out of range are
+// unset.
+func (b Bitstring) Get(i int) bool {
+	if i < 0 || i/8 >= len(b) {
+		return false
+	}
+	return b[i/8]&(0x80>>(i%8)) != 0
+}
+
+// Set marks the entry at index i. It panics when i is out of range.
+func (b Bitstring) Set(i int, v bool) {
+	if v {
+		b[i/8] |= 0x80 >> (i % 8)
+	} else {
+		b[i/8] &^= 0x80 >> (i % 8)
+	}
+}
+
+// Encode returns the GZIP-compressed bitstring in base64url, as the
+// "encodedList" of the status list credential type. The Bitstring Status List
+// prefixes a multibase header 'u'.
+func (b Bitstring) Encode(credentialType string) string {
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	w.Write(b)
+	w.Close()
+	s := base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	if credentialType == BitstringStatusListCredential {
+		return "u" + s
+	}
+	return s
+}
+
+// DecodeBitstring parses an "encodedList" of either status list type.
+func DecodeBitstring(encoded string) (Bitstring, error) {
+	if len(encoded) != 0 && encoded[0] == 'u' {
+		// multibase Base64URL—GZIP in base64 starts with "H4s"
+		encoded = encoded[1:]
+	}
+	compressed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("status list encodedList: %w", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("status list encodedList: %w", err)
+	}
+	// limit applies to the decompressed size, against compression bombs
+	b, err := io.ReadAll(io.LimitReader(r, statusListDecompressedMax+1))
+	if err != nil {
+		return nil, fmt.Errorf("status list encodedList: %w", err)
+	}
+	if len(b) > statusListDecompressedMax {
+		return nil, fmt.Errorf("status list exceeds %d bytes decompressed", statusListDecompressedMax)
+	}
+	return Bitstring(b), nil
+}
+
+// StatusLists fetches status list credentials, and it caches their content.
+// Multiple goroutines may invoke methods on a StatusLists simultaneously.
+type StatusLists struct {
+	http.Client
+
+	// DownloadMax is the upper boundary for the byte size of status list
+	// credentials. Zero defaults to 1 MiB.
+	DownloadMax int
+
+	// TTL is the time to live of status lists, limited by the validity
+	// period and the "ttl" of the list credential. Zero disables caching.
+	TTL time.Duration
+
+	// Changed, when set, gets each entry which differs in the refresh of a
+	// cached list, e.g., to publish with events.CredentialStatusChanged.
+	// Changes go undetected without caching.
+	Changed func(listURL, purpose string, index int, set bool)
+
+	mutex sync.Mutex
+	lists map[string]*statusList // by URL
+}
+
+type statusList struct {
+	bits    Bitstring
+	issuer  string
+	purpose string
+	expires time.Time
+}
+
+// Check returns ErrRevoked or ErrSuspended for a status set in any of the
+// lists of c. Status purposes other than revocation and suspension pass. The
+// status list credentials are verified with v, and they must have the issuer
+// of c. All entries apply, with revocation ahead of suspension, and with both
+// ahead of any other error.
+func (lists *StatusLists) Check(ctx context.Context, v *Verifier, c *Credential, now time.Time) error {
+	var suspended, failed error
+	for _, status := range c.Status {
+		err := lists.check(ctx, v, c, status, now)
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, ErrRevoked):
+			return err // final
+		case errors.Is(err, ErrSuspended):
+			suspended = err
+		case failed == nil:
+			failed = err
+		}
+	}
+	if suspended != nil {
+		return suspended
+	}
+	return failed
+}
+
+// Check applies one status entry of c.
+func (lists *StatusLists) check(ctx context.Context, v *Verifier, c *Credential, status *Status, now time.Time) error {
+	if status == nil {
+		return errors.New("credential status entry is null")
+	}
+	switch status.Type {
+	case StatusList2021Entry, BitstringStatusListEntry:
+		break
+	default:
+		return fmt.Errorf("credential status type %q not supported", status.Type)
+	}
+	var statusErr error
+	switch status.StatusPurpose {
+	case Revocation:
+		statusErr = ErrRevoked
+	case Suspension:
+		statusErr = ErrSuspended
+	default:
+		return nil // not a state of validity
+	}
+	index, err := strconv.ParseUint(status.StatusListIndex, 10, 31)
+	if err != nil {
+		return fmt.Errorf("credential statusListIndex %q: %w", status.StatusListIndex, err)
+	}
+
+	list, err := lists.get(ctx, v, status.StatusListCredential, now)
+	if err != nil {
+		return err
+	}
+	issuer, err := backend.Parse(list.issuer)
+	if err != nil || !issuer.EqualString(c.Issuer.ID) {
+		return fmt.Errorf("%w: status list credential %s by %q, not by credential issuer %q", ErrProof, status.StatusListCredential, list.issuer, c.Issuer.ID)
+	}
+	if list.purpose != status.StatusPurpose {
+		return fmt.Errorf("status list credential %s has purpose %q, want %q", status.StatusListCredential, list.purpose, status.StatusPurpose)
+	}
+	if int(index) >= len(list.bits)*8 {
+		return fmt.Errorf("credential statusListIndex %d exceeds the %d entries of status list %s", index, len(list.bits)*8, status.StatusListCredential)
+	}
+	if list.bits.Get(int(index)) {
+		return statusErr
+	}
+	return nil
+}
+
+// Get returns the status list of the credential at listURL, either from cache
+// or from a fetch.
+func (lists *StatusLists) get(ctx context.Context, v *Verifier, listURL string, now time.Time) (*statusList, error) {
+	lists.mutex.Lock()
+	list, ok := lists.lists[listURL]
+	lists.mutex.Unlock()
+	if ok && now.Before(list.expires) {
+		return list, nil
+	}
+
+	secured, err := lists.fetch(ctx, listURL)
+	if err != nil {
+		return nil, err
+	}
+	// status lists have no status themselves
+	listVerifier := *v
+	listVerifier.Status = nil
+	c, err := listVerifier.VerifyCredential(ctx, secured, now)
+	if err != nil {
+		return nil, fmt.Errorf("status list credential %s: %w", listURL, err)
+	}
+
+	var subjectType string
+	for _, t := range c.Types {
+		switch t {
+		case StatusList2021Credential:
+			subjectType = "StatusList2021"
+		case BitstringStatusListCredential:
+			subjectType = "BitstringStatusList"
+		}
+	}
+	if subjectType == "" {
+		return nil, fmt.Errorf("status list credential %s has type %q", listURL, c.Types)
+	}
+	if len(c.Subjects) != 1 || c.Subjects[0]["type"] != subjectType {
+		return nil, fmt.Errorf("status list credential %s needs one credentialSubject of type %q", listURL, subjectType)
+	}
+	subject := c.Subjects[0]
+	encoded, _ := subject["encodedList"].(string)
+	bits, err := DecodeBitstring(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("status list credential %s: %w", listURL, err)
+	}
+	purpose, _ := subject["statusPurpose"].(string)
+
+	if ok && lists.Changed != nil && list.purpose == purpose {
+		for i := 0; i < max(len(bits), len(list.bits))*8; i++ {
+			if i%8 == 0 && i/8 < min(len(bits), len(list.bits)) && bits[i/8] == list.bits[i/8] {
+				i += 7 // byte unchanged
+				continue
+			}
+			if set := bits.Get(i); set != list.bits.Get(i) {
+				lists.Changed(listURL, purpose, i, set)
+			}
+		}
+	}
+	list = &statusList{bits: bits, issuer: c.Issuer.ID, purpose: purpose}
+	list.expires = now.Add(lists.TTL)
+	// “ttl … in milliseconds”
+	if ttl, ok := subject["ttl"].(float64); ok && ttl >= 0 {
+		if t := now.Add(time.Duration(ttl) * time.Millisecond); t.Before(list.expires) {
+			list.expires = t
+		}
+	}
+	until := c.ExpirationDate
+	if c.V2() {
+		until = c.ValidUntil
+	}
+	if until != nil && until.Before(list.expires) {
+		list.expires = *until
+	}
+	if list.expires.After(now) {
+		lists.mutex.Lock()
+		if lists.lists == nil {
+			lists.lists = make(map[string]*statusList)
+		}
+		lists.lists[listURL] = list
+		lists.mutex.Unlock()
+	}
+	return list, nil
+}
+
+// Fetch returns the secured status list credential at listURL.
+func (lists *StatusLists) fetch(ctx context.Context, listURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("status list credential URL: %w", err)
+	}
+	req.Header.Set("Accept", "application/vc+ld+json, application/vc+jwt;q=0.9, application/json;q=0.5")
+	res, err := lists.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("status list credential lookup: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %q for status list credential %s", res.Status, listURL)
+	}
+
+	max := lists.DownloadMax
+	if max <= 0 {
+		max = statusListDownloadMaxDefault
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, int64(max)+1))
+	if err != nil {
+		return nil, fmt.Errorf("status list credential %s unavailable: %w", listURL, err)
+	}
+	if len(body) > max {
+		return nil, fmt.Errorf("status list credential %s exceeds %d bytes", listURL, max)
+	}
+	return bytes.TrimSpace(body), nil
+}
@@ -0,0 +1,461 @@
+package vc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// Examples from RFC 8785.
+func TestCanonicalize(t *testing.T) {
+	golden := []struct{ in, want string }{
+		{`{"numbers":[333333333.33333329,1E30,4.50,2e-3,0.000000000000000000000000001]}`,
+			`{"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27]}`},
+		{`{"literals":[null,true,false],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+			`{"literals":[null,true,false],"string":"€$\u000f\nA'B\"\\\\\"/"}`},
+		{`{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"},
+		{`[-0, 100, 1e21, 1e-7, 123456789012345680000, -5e-324]`,
+			`[0,100,1e+21,1e-7,123456789012345680000,-5e-324]`},
+	}
+	for _, gold := range golden {
+		got, err := Canonicalize(json.RawMessage(gold.in))
+		if err != nil {
+			t.Errorf("%s got error: %s", gold.in, err)
+			continue
+		}
+		if string(got) != gold.want {
+			t.Errorf("%s got %s\nwant %s", gold.in, got, gold.want)
+		}
+	}
+}
+
+func TestCredentialJSON(t *testing.T) {
+	const sample = `{"@context":["https://www.w3.org/ns/credentials/v2"],"id":"urn:uuid:58172aac-d8ba-11ed-83dd-0b3aef56cc33","type":["VerifiableCredential","ExampleDegreeCredential"],"issuer":{"id":"did:example:2g55q912ec3476eba2l9812ecbfe","name":"Example University"},"validFrom":"2010-01-01T00:00:00Z","credentialSubject":{"degree":{"name":"Bachelor of Science and Arts","type":"ExampleBachelorDegree"},"id":"did:example:ebfeb1f712ebc6f1c276e12ec21"},"credentialSchema":[{"id":"https://example.org/examples/degree.json","type":"JsonSchema"}]}`
+	var c Credential
+	if err := json.Unmarshal([]byte(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Error("validate error:", err)
+	}
+	if !c.V2() || c.Issuer.Name != "Example University" || len(c.Subjects) != 1 {
+		t.Errorf("got %+v", c)
+	}
+	got, err := json.Marshal(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != sample {
+		t.Errorf("round trip got %s\nwant %s", got, sample)
+	}
+
+	c.Issuer.Name = ""
+	c.ValidUntil = new(time.Time)
+	const want = `credential issuer "no URI" is not a URI` + "\n" + `credential validUntil before validFrom`
+	c.Issuer.ID = "no URI"
+	if err := c.Validate(); err == nil || err.Error() != want {
+		t.Errorf("got validate error %v, want %q", err, want)
+	}
+}
+
+func newCredential(issuer backend.DID) *Credential {
+	issued := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := issued.AddDate(1, 0, 0)
+	return &Credential{
+		Context:        []any{V1},
+		ID:             "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5",
+		Types:          []string{"VerifiableCredential", "MembershipCredential"},
+		Issuer:         Issuer{ID: issuer.String()},
+		IssuanceDate:   &issued,
+		ExpirationDate: &expires,
+		Subjects:       Subjects{{"id": "did:example:holder", "member": "yes"}},
+	}
+}
+
+func TestIssueJWT(t *testing.T) {
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	c := newCredential(did)
+
+	token, err := Issue(c, signer, &backend.URL{DID: did, RawFragment: "#" + did.SpecID}, JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		didjwt.Claims
+		VC *Credential `json:"vc"`
+	}
+	v := didjwt.Verifier{Resolver: new(didkey.Resolver)}
+	_, err = v.Verify(context.Background(), string(token), c.IssuanceDate.Add(time.Hour), &claims)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if claims.Subject != "did:example:holder" || claims.ID != c.ID || claims.NotBefore != c.IssuanceDate.Unix() || claims.Expires != c.ExpirationDate.Unix() {
+		t.Errorf("got claims %+v", claims.Claims)
+	}
+	if claims.VC == nil || claims.VC.Subjects[0]["member"] != "yes" {
+		t.Errorf("got vc claim %+v", claims.VC)
+	}
+}
+
+func TestIssueDataIntegrity(t *testing.T) {
+	for _, kt := range []keys.Type{keys.Ed25519, keys.P256, keys.P384} {
+		key, _ := keys.Generate(kt)
+		signer, _ := keys.Signer(key)
+		did, _ := didkey.New(signer.Public())
+		c := newCredential(did)
+		keyID := &backend.URL{DID: did, RawFragment: "#" + did.SpecID}
+
+		secured, err := Issue(c, signer, keyID, DataIntegrity)
+		if err != nil {
+			t.Fatalf("%s: issue error: %s", kt, err)
+		}
+		if c.Proof != nil || len(c.Context) != 1 {
+			t.Errorf("%s: credential modified", kt)
+		}
+
+		var got Credential
+		if err := json.Unmarshal(secured, &got); err != nil {
+			t.Fatal(err)
+		}
+		p := got.Proof
+		if p == nil || p.VerificationMethod != keyID.String() || p.ProofPurpose != "assertionMethod" || !strings.HasPrefix(p.ProofValue, "z") {
+			t.Fatalf("%s: got proof %+v", kt, p)
+		}
+		want := ECDSAJCS2019
+		if kt == keys.Ed25519 {
+			want = EdDSAJCS2022
+		}
+		if p.Cryptosuite != want {
+			t.Errorf("%s: got cryptosuite %q, want %q", kt, p.Cryptosuite, want)
+		}
+
+		// verify by hand
+		_, sig, err := multiformat.Decode(p.ProofValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.Proof = nil
+		proof := *p
+		proof.ProofValue = ""
+		_, h, _ := suiteFor(signer.Public())
+		config := struct {
+			Context []any `json:"@context"`
+			*Proof
+		}{got.Context, &proof}
+		hashData, err := proofHash(&got, &config, h, Canonicalize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := keys.Verify(signer.Public(), hashData, sig); err != nil {
+			t.Errorf("%s: proof verification: %s", kt, err)
+		}
+	}
+}
+
+func TestVerifyCredential(t *testing.T) {
+	key, _ := keys.Generate(keys.P256)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	keyID := &backend.URL{DID: did, RawFragment: "#" + did.SpecID}
+	v := &Verifier{Resolver: new(didkey.Resolver)}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, format := range []Format{JWT, DataIntegrity} {
+		secured, err := Issue(newCredential(did), signer, keyID, format)
+		if err != nil {
+			t.Fatalf("%s: issue error: %s", format, err)
+		}
+		c, err := v.VerifyCredential(context.Background(), secured, now)
+		if err != nil {
+			t.Fatalf("%s: verify error: %s", format, err)
+		}
+		if c.Subjects[0]["member"] != "yes" {
+			t.Errorf("%s: got subjects %v", format, c.Subjects)
+		}
+
+		_, err = v.VerifyCredential(context.Background(), secured, now.AddDate(2, 0, 0))
+		if err == nil {
+			t.Errorf("%s: verified after expiry", format)
+		}
+	}
+
+	// tamper with the subject
+	secured, err := Issue(newCredential(did), signer, keyID, DataIntegrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(secured), `"member":"yes"`, `"member":"no"`, 1)
+	if tampered == string(secured) {
+		t.Fatal("tamper target not found")
+	}
+	_, err = v.VerifyCredential(context.Background(), []byte(tampered), now)
+	if !errors.Is(err, ErrProof) {
+		t.Errorf("got error %v for tampered credential, want ErrProof", err)
+	}
+}
+
+func TestPresentation(t *testing.T) {
+	issuerKey, _ := keys.Generate(keys.Ed25519)
+	issuerSigner, _ := keys.Signer(issuerKey)
+	issuer, _ := didkey.New(issuerSigner.Public())
+	issuerKeyID := &backend.URL{DID: issuer, RawFragment: "#" + issuer.SpecID}
+
+	holderKey, _ := keys.Generate(keys.P256)
+	holderSigner, _ := keys.Signer(holderKey)
+	holder, _ := didkey.New(holderSigner.Public())
+	holderKeyID := &backend.URL{DID: holder, RawFragment: "#" + holder.SpecID}
+
+	now := time.Now()
+	for _, format := range []Format{JWT, DataIntegrity} {
+		p := NewPresentation(holder)
+		for _, credFormat := range []Format{JWT, DataIntegrity} {
+			c := newCredential(issuer)
+			issued := now.Add(-time.Hour).UTC().Truncate(time.Second)
+			expires := issued.AddDate(0, 1, 0)
+			c.IssuanceDate, c.ExpirationDate = &issued, &expires
+			c.Subjects[0]["id"] = holder.String()
+			secured, err := Issue(c, issuerSigner, issuerKeyID, credFormat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Add(secured); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		secured, err := Present(p, holderSigner, holderKeyID, "nonce-123", "https://verifier.example", format)
+		if err != nil {
+			t.Fatalf("%s: present error: %s", format, err)
+		}
+
+		v := &Verifier{Resolver: new(didkey.Resolver), Leeway: time.Minute, BindSubject: true}
+		got, credentials, err := v.VerifyPresentation(context.Background(), secured, "nonce-123", "https://verifier.example", now)
+		if err != nil {
+			t.Fatalf("%s: verify error: %s", format, err)
+		}
+		if got.Holder != holder.String() || len(credentials) != 2 {
+			t.Errorf("%s: got holder %q with %d credentials", format, got.Holder, len(credentials))
+		}
+
+		_, _, err = v.VerifyPresentation(context.Background(), secured, "replay", "https://verifier.example", now)
+		if !errors.Is(err, ErrProof) {
+			t.Errorf("%s: got error %v for challenge mismatch, want ErrProof", format, err)
+		}
+		_, _, err = v.VerifyPresentation(context.Background(), secured, "nonce-123", "https://other.example", now)
+		if err == nil {
+			t.Errorf("%s: verified with domain mismatch", format)
+		}
+	}
+
+	// holder binding
+	p := NewPresentation(issuer)
+	c := newCredential(issuer)
+	issued := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	expires := issued.AddDate(0, 1, 0)
+	c.IssuanceDate, c.ExpirationDate = &issued, &expires
+	secured, err := Issue(c, issuerSigner, issuerKeyID, JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Add(secured)
+	secured, err = Present(p, issuerSigner, issuerKeyID, "", "", DataIntegrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Verifier{Resolver: new(didkey.Resolver), BindSubject: true}
+	_, _, err = v.VerifyPresentation(context.Background(), secured, "", "", time.Now())
+	if !errors.Is(err, ErrProof) {
+		t.Errorf("got error %v for foreign subject, want ErrProof", err)
+	}
+}
+
+func TestBitstring(t *testing.T) {
+	b := NewBitstring(131072)
+	b.Set(0, true)
+	b.Set(42, true)
+	b.Set(131071, true)
+	b.Set(42, false)
+	if b[0] != 0x80 || b[len(b)-1] != 0x01 {
+		t.Errorf("got first byte %#x and last byte %#x, want 0x80 and 0x01", b[0], b[len(b)-1])
+	}
+
+	for _, typ := range []string{StatusList2021Credential, BitstringStatusListCredential} {
+		encoded := b.Encode(typ)
+		if strings.HasPrefix(encoded, "u") != (typ == BitstringStatusListCredential) {
+			t.Errorf("%s: got encoding %.8q…", typ, encoded)
+		}
+		got, err := DecodeBitstring(encoded)
+		if err != nil {
+			t.Fatalf("%s: decode error: %s", typ, err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Errorf("%s: round trip mismatch", typ)
+		}
+	}
+
+	if _, err := DecodeBitstring("uH4sI"); err == nil {
+		t.Error("truncated encoding decoded without error")
+	}
+}
+
+func TestStatusLists(t *testing.T) {
+	key, _ := keys.Generate(keys.Ed25519)
+	signer, _ := keys.Signer(key)
+	did, _ := didkey.New(signer.Public())
+	keyID := &backend.URL{DID: did, RawFragment: "#" + did.SpecID}
+
+	bits := NewBitstring(131072)
+	bits.Set(42, true)
+	validFrom := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	list := &Credential{
+		Context:   []any{V2},
+		ID:        "https://status.example/1",
+		Types:     []string{"VerifiableCredential", BitstringStatusListCredential},
+		Issuer:    Issuer{ID: did.String()},
+		ValidFrom: &validFrom,
+		Subjects: Subjects{{
+			"id":            "https://status.example/1#list",
+			"type":          "BitstringStatusList",
+			"statusPurpose": Revocation,
+			"encodedList":   bits.Encode(BitstringStatusListCredential),
+		}},
+	}
+	listJSON, err := Issue(list, signer, keyID, DataIntegrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suspensionJSON []byte // served at "/suspension"
+	var fetchCount int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vc+ld+json")
+		if r.URL.Path == "/suspension" {
+			w.Write(suspensionJSON)
+			return
+		}
+		fetchCount++
+		w.Write(listJSON)
+	}))
+	defer srv.Close()
+
+	v := &Verifier{
+		Resolver: new(didkey.Resolver),
+		Status:   &StatusLists{Client: *srv.Client(), TTL: time.Minute},
+	}
+	for _, index := range []string{"7", "42"} {
+		c := &Credential{
+			Context:   []any{V2},
+			Types:     []string{"VerifiableCredential"},
+			Issuer:    Issuer{ID: did.String()},
+			ValidFrom: &validFrom,
+			Subjects:  Subjects{{"id": "did:example:holder"}},
+			Status: Statuses{{
+				Type:                 BitstringStatusListEntry,
+				StatusPurpose:        Revocation,
+				StatusListIndex:      index,
+				StatusListCredential: srv.URL,
+			}},
+		}
+		secured, err := Issue(c, signer, keyID, JWT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = v.VerifyCredential(context.Background(), secured, time.Now())
+		if index == "42" {
+			if !errors.Is(err, ErrRevoked) {
+				t.Errorf("index %s: got error %v, want ErrRevoked", index, err)
+			}
+		} else if err != nil {
+			t.Errorf("index %s: verify error: %s", index, err)
+		}
+	}
+	if fetchCount != 1 {
+		t.Errorf("got %d status list fetches, want 1 with caching", fetchCount)
+	}
+
+	// any entry of a status array applies
+	statuses := []byte(`{
+		"@context": ["https://www.w3.org/ns/credentials/v2"],
+		"type": ["VerifiableCredential"],
+		"issuer": "` + did.String() + `",
+		"credentialSubject": {"id": "did:example:holder"},
+		"credentialStatus": [
+			{"type": "BitstringStatusListEntry", "statusPurpose": "revocation", "statusListIndex": "7", "statusListCredential": "` + srv.URL + `"},
+			{"type": "BitstringStatusListEntry", "statusPurpose": "revocation", "statusListIndex": "42", "statusListCredential": "` + srv.URL + `"}
+		]
+	}`)
+	var multi Credential
+	if err := json.Unmarshal(statuses, &multi); err != nil {
+		t.Fatal("credential with status array:", err)
+	}
+	if len(multi.Status) != 2 {
+		t.Fatalf("got %d status entries, want 2", len(multi.Status))
+	}
+	if err := v.Status.Check(context.Background(), v, &multi, time.Now()); !errors.Is(err, ErrRevoked) {
+		t.Errorf("status array got error %v, want ErrRevoked", err)
+	}
+
+	// revocation wins from a suspension listed before it
+	suspension := *list
+	suspension.ID = "https://status.example/2"
+	suspension.Subjects = Subjects{{
+		"id":            "https://status.example/2#list",
+		"type":          "BitstringStatusList",
+		"statusPurpose": Suspension,
+		"encodedList":   bits.Encode(BitstringStatusListCredential),
+	}}
+	if suspensionJSON, err = Issue(&suspension, signer, keyID, DataIntegrity); err != nil {
+		t.Fatal(err)
+	}
+	for revokedIndex, want := range map[string]error{"42": ErrRevoked, "7": ErrSuspended} {
+		both := Credential{Issuer: Issuer{ID: did.String()}, Status: Statuses{
+			{Type: BitstringStatusListEntry, StatusPurpose: Suspension, StatusListIndex: "42", StatusListCredential: srv.URL + "/suspension"},
+			{Type: BitstringStatusListEntry, StatusPurpose: Revocation, StatusListIndex: revokedIndex, StatusListCredential: srv.URL},
+		}}
+		if err := v.Status.Check(context.Background(), v, &both, time.Now()); !errors.Is(err, want) {
+			t.Errorf("suspension 42 and revocation %s got error %v, want %v", revokedIndex, err, want)
+		}
+	}
+
+	if b, err := json.Marshal(multi.Status[:1]); err != nil {
+		t.Error("status marshal error:", err)
+	} else if b[0] != '{' {
+		t.Errorf("single status entry encoded as %s, want an object", b)
+	}
+
+	// revocation of index 7 and reinstatement of index 42
+	bits.Set(7, true)
+	bits.Set(42, false)
+	list.Subjects[0]["encodedList"] = bits.Encode(BitstringStatusListCredential)
+	if listJSON, err = Issue(list, signer, keyID, DataIntegrity); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(map[int]bool)
+	v.Status.Changed = func(listURL, purpose string, index int, set bool) {
+		if listURL != srv.URL || purpose != Revocation {
+			t.Errorf("change of list %q with purpose %q", listURL, purpose)
+		}
+		changes[index] = set
+	}
+	if _, err := v.Status.get(context.Background(), v, srv.URL, time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatal("status list refresh:", err)
+	}
+	if want := map[int]bool{7: true, 42: false}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %v, want %v", changes, want)
+	}
+}
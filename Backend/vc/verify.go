@@ -0,0 +1,302 @@
+package vc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didjwt"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/jsonld"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/multiformat"
+)
+
+// ErrProof signals a proof that does not verify.
+var ErrProof = errors.New("verifiable credential proof invalid")
+
+// ErrValidity signals a credential outside of its validity period.
+var ErrValidity = errors.New("verifiable credential not valid at the time")
+
+// Verifier checks credentials and presentations, including the keys of their
+// issuers and holders, as resolved from DIDs.
+type Verifier struct {
+	Resolver backend.Resolver
+
+	// Leeway is the tolerance for clock skew on validity periods.
+	Leeway time.Duration
+
+	// BindSubject requires the holder of a presentation to be a subject
+	// of each credential it contains.
+	BindSubject bool
+
+	// Status enables credential status checks when set.
+	Status *StatusLists
+
+	// Contexts enables the cryptosuites with RDF Dataset Canonicalization,
+	// i.e., EdDSARDFC2022 and ECDSARDFC2019, with the JSON-LD contexts of
+	// the secured documents.
+	Contexts jsonld.Loader
+
+	// Policy, when set, must accept each credential, after its proof, its
+	// validity period, and its status checked out. See All and Any for
+	// composition.
+	Policy Policy
+}
+
+// VerifyCredential checks a secured credential, as returned by Issue, at time
+// now.
+func (v *Verifier) VerifyCredential(ctx context.Context, secured []byte, now time.Time) (*Credential, error) {
+	c := new(Credential)
+	e := Evidence{Credential: c}
+	if len(secured) == 0 || secured[0] != '{' {
+		var claims struct {
+			didjwt.Claims
+			VC json.RawMessage `json:"vc"`
+		}
+		jwtVerifier := didjwt.Verifier{Resolver: v.Resolver, Leeway: v.Leeway}
+		issuer, err := jwtVerifier.Verify(ctx, string(secured), now, &claims)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrProof, err)
+		}
+		if err := json.Unmarshal(claims.VC, c); err != nil {
+			return nil, fmt.Errorf("credential JWT vc claim: %w", err)
+		}
+		// “iss MUST represent the issuer property”
+		if !issuer.EqualString(c.Issuer.ID) {
+			return nil, fmt.Errorf("%w: JWT issuer %s is not credential issuer %q", ErrProof, issuer.String(), c.Issuer.ID)
+		}
+		if v.Policy != nil {
+			jws, err := jose.ParseCompact(string(secured))
+			if err != nil {
+				return nil, err
+			}
+			// kid checked by the JWT verifier
+			e.Method, _ = backend.ParseURL(jws.Header.Kid)
+			if e.Method.IsRelative() {
+				e.Method.DID = issuer
+			}
+			if claims.IssuedAt != 0 {
+				e.Issued = time.Unix(claims.IssuedAt, 0)
+			}
+		}
+	} else {
+		if err := json.Unmarshal(secured, c); err != nil {
+			return nil, fmt.Errorf("credential: %w", err)
+		}
+		keyID, proof, err := v.verifyProof(ctx, secured, "assertionMethod", "", "")
+		if err != nil {
+			return nil, err
+		}
+		if !keyID.DID.EqualString(c.Issuer.ID) {
+			return nil, fmt.Errorf("%w: proof by %s, which is not credential issuer %q", ErrProof, keyID.DID.String(), c.Issuer.ID)
+		}
+		e.Method = keyID
+		if proof.Created != nil {
+			e.Issued = *proof.Created
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !c.ValidAt(now.Add(v.Leeway)) && !c.ValidAt(now.Add(-v.Leeway)) {
+		return nil, ErrValidity
+	}
+	if v.Status != nil {
+		if err := v.Status.Check(ctx, v, c, now); err != nil {
+			return nil, err
+		}
+	}
+	if v.Policy != nil {
+		if e.Issued.IsZero() {
+			switch {
+			case c.V2() && c.ValidFrom != nil:
+				e.Issued = *c.ValidFrom
+			case !c.V2() && c.IssuanceDate != nil:
+				e.Issued = *c.IssuanceDate
+			}
+		}
+		if err := v.Policy.Check(ctx, v.Resolver, &e); err != nil {
+			if !errors.Is(err, ErrPolicy) {
+				err = fmt.Errorf("%w: %w", ErrPolicy, err)
+			}
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// VerifyPresentation checks a secured presentation, as returned by Present,
+// at time now, including each of its credentials. The challenge and the domain
+// must match the ones the holder signed with.
+func (v *Verifier) VerifyPresentation(ctx context.Context, secured []byte, challenge, domain string, now time.Time) (*Presentation, []*Credential, error) {
+	p := new(Presentation)
+	var holder backend.DID
+	if len(secured) == 0 || secured[0] != '{' {
+		var claims struct {
+			didjwt.Claims
+			Nonce string          `json:"nonce"`
+			VP    json.RawMessage `json:"vp"`
+		}
+		jwtVerifier := didjwt.Verifier{Resolver: v.Resolver, Relationship: "authentication", Audience: domain, Leeway: v.Leeway}
+		var err error
+		holder, err = jwtVerifier.Verify(ctx, string(secured), now, &claims)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrProof, err)
+		}
+		if claims.Nonce != challenge {
+			return nil, nil, fmt.Errorf("%w: presentation nonce %q does not match challenge", ErrProof, claims.Nonce)
+		}
+		if err := json.Unmarshal(claims.VP, p); err != nil {
+			return nil, nil, fmt.Errorf("presentation JWT vp claim: %w", err)
+		}
+	} else {
+		if err := json.Unmarshal(secured, p); err != nil {
+			return nil, nil, fmt.Errorf("presentation: %w", err)
+		}
+		keyID, _, err := v.verifyProof(ctx, secured, "authentication", challenge, domain)
+		if err != nil {
+			return nil, nil, err
+		}
+		holder = keyID.DID
+	}
+	if p.Holder != "" && !holder.EqualString(p.Holder) {
+		return nil, nil, fmt.Errorf("%w: signed by %s, which is not presentation holder %q", ErrProof, holder.String(), p.Holder)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	credentials := make([]*Credential, len(p.Credentials))
+	for i, raw := range p.Credentials {
+		secured := []byte(raw)
+		if len(raw) != 0 && raw[0] == '"' {
+			var token string
+			if err := json.Unmarshal(raw, &token); err != nil {
+				return nil, nil, fmt.Errorf("presentation credential № %d: %w", i+1, err)
+			}
+			secured = []byte(token)
+		}
+		c, err := v.VerifyCredential(ctx, secured, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("presentation credential № %d: %w", i+1, err)
+		}
+		if v.BindSubject && !hasSubject(c, holder) {
+			return nil, nil, fmt.Errorf("%w: presentation credential № %d is not about holder %s", ErrProof, i+1, holder.String())
+		}
+		credentials[i] = c
+	}
+	return p, credentials, nil
+}
+
+func hasSubject(c *Credential, did backend.DID) bool {
+	for _, s := range c.Subjects {
+		if id, ok := s["id"].(string); ok && did.EqualString(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyProof checks the Data Integrity proof of a secured document in JSON,
+// and it returns the verification method of the signer, with the proof. The proof is verified on the original
+// JSON, as properties unknown to the data model count too.
+func (v *Verifier) verifyProof(ctx context.Context, secured []byte, purpose, challenge, domain string) (*backend.URL, *Proof, error) {
+	dec := json.NewDecoder(bytes.NewReader(secured))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	proofJSON, ok := doc["proof"].(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no proof object", ErrProof)
+	}
+	var proof Proof
+	if raw, err := json.Marshal(proofJSON); err != nil {
+		return nil, nil, err
+	} else if err := json.Unmarshal(raw, &proof); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrProof, err)
+	}
+	switch {
+	case proof.Type != "DataIntegrityProof":
+		return nil, nil, fmt.Errorf("%w: proof type %q not supported", ErrProof, proof.Type)
+	case proof.ProofPurpose != purpose:
+		return nil, nil, fmt.Errorf("%w: proof purpose %q, want %q", ErrProof, proof.ProofPurpose, purpose)
+	case proof.Challenge != challenge:
+		return nil, nil, fmt.Errorf("%w: proof challenge %q does not match", ErrProof, proof.Challenge)
+	case proof.Domain != domain:
+		return nil, nil, fmt.Errorf("%w: proof domain %q does not match", ErrProof, proof.Domain)
+	}
+
+	keyID, err := backend.ParseURL(proof.VerificationMethod)
+	if err != nil || keyID.IsRelative() {
+		return nil, nil, fmt.Errorf("%w: proof verification method %q is not a DID URL", ErrProof, proof.VerificationMethod)
+	}
+	didDoc, _, err := v.Resolver.Resolve(ctx, keyID.DID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("proof signer resolution: %w", err)
+	}
+	m := didDoc.AuthorizedMethod(didDoc.Relationship(purpose), keyID)
+	if m == nil {
+		return nil, nil, fmt.Errorf("%w: no %s method %s in DID document", backend.ErrNotFound, purpose, keyID.String())
+	}
+	pub, err := keys.MethodKey(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := v.checkSignature(doc, proofJSON, &proof, pub); err != nil {
+		return nil, nil, err
+	}
+	return keyID, &proof, nil
+}
+
+// CheckSignature verifies the proofValue of proof, with its JSON in
+// proofJSON, over doc without proof. The proof property of doc is removed.
+func (v *Verifier) checkSignature(doc, proofJSON map[string]any, proof *Proof, pub crypto.PublicKey) error {
+	suite, h, err := suiteFor(pub)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProof, err)
+	}
+	canonicalize := Canonicalize
+	switch proof.Cryptosuite {
+	case suite:
+		break
+	case rdfcSuites[suite]:
+		if v == nil || v.Contexts == nil {
+			return fmt.Errorf("%w: cryptosuite %q without JSON-LD contexts", ErrProof, proof.Cryptosuite)
+		}
+		canonicalize = func(doc any) ([]byte, error) {
+			return canonicalRDF(doc, v.Contexts, h)
+		}
+	default:
+		return fmt.Errorf("%w: cryptosuite %q with %s key", ErrProof, proof.Cryptosuite, suite)
+	}
+	base, sig, err := multiformat.Decode(proof.ProofValue)
+	if err != nil || base != multiformat.Base58BTC {
+		return fmt.Errorf("%w: proofValue not in base58btc", ErrProof)
+	}
+
+	config := make(map[string]any, len(proofJSON)+1)
+	for k, v := range proofJSON {
+		if k != "proofValue" {
+			config[k] = v
+		}
+	}
+	config["@context"] = doc["@context"]
+	delete(doc, "proof")
+	hashData, err := proofHash(doc, config, h, canonicalize)
+	if err != nil {
+		return err
+	}
+	if err := keys.Verify(pub, hashData, sig); err != nil {
+		return fmt.Errorf("%w: %w", ErrProof, err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/edv"
+	"EncrypteDL/IDChain/Backend/hdkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/keystore"
+)
+
+// BackupAccount is the account of the master secret for the controller of
+// backup vaults, which is out of reach for NewDID.
+const BackupAccount = hdkey.Hardened - 1
+
+// Index attributes of backup documents
+const (
+	didAttribute   = "did"
+	entryAttribute = "entry"
+)
+
+// BackupRecord is the content of a backup document, with either one of the
+// fields set.
+type backupRecord struct {
+	Identity   *Identity `json:"identity,omitempty"`
+	Credential *Entry    `json:"credential,omitempty"`
+
+	docID string // in the vault
+}
+
+// BackupClient returns a client of the EDV service at baseURL, for the backup
+// vaults of a mnemonic. The controller is the did:key of the Ed25519 key at
+// BackupAccount, with its X25519 equivalent for key agreement, such that the
+// mnemonic recovers all of the keys. The resolver must expand did:key with
+// key agreement, as in didkey.Resolver.
+func BackupClient(mnemonic, baseURL string, r backend.Resolver) (*edv.Client, error) {
+	seed, err := hdkey.MnemonicSeed(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	key, err := hdkey.DIDKey(seed, keys.Ed25519, BackupAccount, hdkey.Authentication, 0)
+	if err != nil {
+		return nil, err
+	}
+	signer := key.(ed25519.PrivateKey)
+	did, err := didkey.New(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	agreement, err := didkey.X25519PrivateFromEd25519(signer)
+	if err != nil {
+		return nil, err
+	}
+	fragment, err := didkey.EncodeKey(agreement.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	// index secret apart from any key
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte("wallet backup index"))
+	return &edv.Client{
+		BaseURL:  baseURL,
+		Resolver: r,
+		Signer:   signer,
+		KeyID:    &backend.URL{DID: did, RawFragment: "#" + did.SpecID},
+		Keys:     map[string]*ecdh.PrivateKey{did.String() + "#" + fragment: agreement},
+		HMACKeys: map[string][]byte{did.String() + "#index": mac.Sum(nil)},
+	}, nil
+}
+
+// NewBackupVault creates a vault with the keys of a BackupClient.
+func NewBackupVault(ctx context.Context, c *edv.Client) (*edv.Vault, error) {
+	var kid, hmacID string
+	for id := range c.Keys {
+		kid = id
+	}
+	for id := range c.HMACKeys {
+		hmacID = id
+	}
+	conf, err := c.NewConfig(kid, hmacID, "wallet")
+	if err != nil {
+		return nil, err
+	}
+	return c.Create(ctx, conf)
+}
+
+// Backup synchronises v with the wallet, i.e., each DID of the master secret
+// and each credential get a document, and any other document is deleted.
+// Vault v is of the BackupClient of the Mnemonic.
+func (w *Wallet) Backup(ctx context.Context, v *edv.Vault) error {
+	w.mutex.Lock()
+	var want []*backupRecord
+	for _, id := range w.records.Identities {
+		if id.KeyType != "" {
+			backup := *id
+			backup.KeyRef = "" // local to the keystore
+			want = append(want, &backupRecord{Identity: &backup})
+		}
+	}
+	for _, e := range w.records.Credentials {
+		backup := *e
+		want = append(want, &backupRecord{Credential: &backup})
+	}
+	w.mutex.Unlock()
+
+	have, err := readBackup(ctx, v)
+	if err != nil {
+		return err
+	}
+	for _, rec := range want {
+		attr := rec.attribute()
+		if _, ok := have[attr]; ok {
+			delete(have, attr)
+			continue
+		}
+		content, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		doc := &edv.Document{Content: content, Attributes: []edv.Attribute{attr}}
+		if err := v.Insert(ctx, doc); err != nil {
+			return fmt.Errorf("wallet backup: %w", err)
+		}
+	}
+	for _, rec := range have {
+		if err := v.Delete(ctx, rec.docID); err != nil && !errors.Is(err, edv.ErrNotFound) {
+			return fmt.Errorf("wallet backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// Attribute returns the unique index entry of the record.
+func (rec *backupRecord) attribute() edv.Attribute {
+	if rec.Identity != nil {
+		return edv.Attribute{Name: didAttribute, Value: rec.Identity.DID.String(), Unique: true}
+	}
+	return edv.Attribute{Name: entryAttribute, Value: rec.Credential.ID, Unique: true}
+}
+
+// ReadBackup returns the records of a backup by their index entry.
+func readBackup(ctx context.Context, v *edv.Vault) (map[edv.Attribute]*backupRecord, error) {
+	recs := make(map[edv.Attribute]*backupRecord)
+	for _, name := range []string{didAttribute, entryAttribute} {
+		found, err := v.Has(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("wallet backup: %w", err)
+		}
+		for _, doc := range found {
+			rec := &backupRecord{docID: doc.ID}
+			if err := json.Unmarshal(doc.Content, rec); err != nil {
+				return nil, fmt.Errorf("wallet backup document %q: %w", doc.ID, err)
+			}
+			if (rec.Identity == nil) == (rec.Credential == nil) || (rec.Identity != nil && rec.Identity.KeyType == "") {
+				return nil, fmt.Errorf("wallet backup document %q has no derived identity nor credential", doc.ID)
+			}
+			recs[rec.attribute()] = rec
+		}
+	}
+	return recs, nil
+}
+
+// Restore installs the wallet of a mnemonic in s, as Create does, with the
+// DIDs and the credentials of a backup in v. Vault v is of the BackupClient of
+// the mnemonic. Keys derive from the mnemonic again, and each DID must match
+// its key. DIDs of the wallet are did:key, which need no registration.
+func Restore(ctx context.Context, s keystore.Storage, passphrase []byte, kdf keystore.KDF, mnemonic string, v *edv.Vault) (*Wallet, error) {
+	entropy, err := hdkey.MnemonicEntropy(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	backup, err := readBackup(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	recs := new(records)
+	var identities []*Identity
+	for _, rec := range backup {
+		if rec.Identity != nil {
+			identities = append(identities, rec.Identity)
+			recs.Accounts = max(recs.Accounts, rec.Identity.Account+1)
+		} else {
+			recs.Credentials = append(recs.Credentials, rec.Credential)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Account < identities[j].Account
+	})
+	sort.Slice(recs.Credentials, func(i, j int) bool {
+		return recs.Credentials[i].Added.Before(recs.Credentials[j].Added)
+	})
+	for _, e := range recs.Credentials {
+		sum := sha256.Sum256(e.Secured)
+		if e.ID != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("wallet backup has credential %q with another hash", e.ID)
+		}
+		if _, err := decode(e.Secured); err != nil {
+			return nil, fmt.Errorf("wallet backup of credential %q: %w", e.ID, err)
+		}
+	}
+
+	w, err := create(s, passphrase, kdf, entropy, recs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range identities {
+		key, err := w.derive(id)
+		if err != nil {
+			return nil, err
+		}
+		did, err := didkey.New(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		if !did.Equal(id.DID) || !id.KeyID.DID.Equal(did) {
+			return nil, fmt.Errorf("wallet backup has DID %s for account %d, want %s", id.DID.String(), id.Account, did.String())
+		}
+		if err := w.importKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,577 @@
+// Package wallet is the holder side in one place. A Wallet owns DIDs with their
+// private keys, it keeps credentials, and it answers presentation requests
+// conform Presentation Exchange. Everything persists encrypted in a
+// keystore.Storage, such as a keystore.DirStorage on disk.
+//
+// The passphrase unlocks a random data key under "key". Private keys are in a
+// keystore.Sealed under "keys/", and the DIDs and the credentials are sealed
+// under "wallet".
+//
+// Hosts with many customers keep a wallet per tenant of a keystore.Tenants.
+// See CreateTenant and OpenTenant.
+//
+// Keys of new DIDs derive from a master secret, conform hdkey, which exports
+// as a BIP-39 mnemonic. The mnemonic restores the wallet in full from a backup
+// in an Encrypted Data Vault. See Backup and Restore.
+package wallet
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/hdkey"
+	"EncrypteDL/IDChain/Backend/jose"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/openid4vp"
+	"EncrypteDL/IDChain/Backend/proofreq"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+// Storage names
+const (
+	keyName     = "key"
+	recordsName = "wallet"
+)
+
+// ErrNotFound signals an unknown DID or credential.
+var ErrNotFound = errors.New("not found in wallet")
+
+// ErrExists signals a wallet creation on storage in use.
+var ErrExists = errors.New("wallet exists already")
+
+// Identity is a DID of the wallet, with the key for its proofs.
+type Identity struct {
+	DID backend.DID `json:"did"`
+
+	// KeyID is the verification method of the key, which should be both
+	// an authentication and an assertion method.
+	KeyID  backend.URL `json:"keyId"`
+	KeyRef string      `json:"keyRef"` // in the keystore
+
+	// KeyType is set for keys of the master secret only, which derive
+	// with hdkey.DIDKey at Account, for the authentication role and
+	// index zero. Imported keys have no KeyType.
+	KeyType keystore.KeyType `json:"keyType,omitempty"`
+	Account uint32           `json:"account,omitempty"`
+}
+
+// Entry is a credential held.
+type Entry struct {
+	ID      string    `json:"id"`      // SHA-256 of Secured in hex
+	Secured []byte    `json:"secured"` // as accepted by vc.Presentation Add
+	Added   time.Time `json:"added"`
+}
+
+// Records is the plaintext of the wallet.
+type records struct {
+	Entropy     []byte      `json:"entropy"`  // master secret of the mnemonic
+	Accounts    uint32      `json:"accounts"` // next account for derivation
+	Identities  []*Identity `json:"identities"`
+	Credentials []*Entry    `json:"credentials"`
+}
+
+// Wallet holds DIDs and credentials. Multiple goroutines may invoke methods on
+// a Wallet simultaneously.
+type Wallet struct {
+	// Verifier, when set, checks each credential before it is added.
+	Verifier *vc.Verifier
+
+	storage keystore.Storage
+	dataKey []byte
+	keys    *keystore.Sealed
+	seed    []byte // of the mnemonic
+	quota   int    // DID limit, if not zero
+
+	mutex   sync.Mutex
+	records records
+}
+
+// Create installs an empty wallet in s, with kdf for the passphrase, and with
+// a new master secret. Storage with a wallet gets ErrExists.
+func Create(s keystore.Storage, passphrase []byte, kdf keystore.KDF) (*Wallet, error) {
+	entropy := make([]byte, 32) // 24 words
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, fmt.Errorf("wallet master secret unavailable: %w", err)
+	}
+	return create(s, passphrase, kdf, entropy, nil)
+}
+
+// Create installs a wallet with the master secret in entropy, and with recs as
+// the initial records, if any.
+func create(s keystore.Storage, passphrase []byte, kdf keystore.KDF, entropy []byte, recs *records) (*Wallet, error) {
+	switch _, err := s.Get(keyName); {
+	case err == nil:
+		return nil, ErrExists
+	case !errors.Is(err, keystore.ErrNotFound):
+		return nil, err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("wallet key unavailable: %w", err)
+	}
+	blob, err := keystore.EncryptData(dataKey, passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	w := newWallet(s, dataKey)
+	if recs != nil {
+		w.records = *recs
+	}
+	w.records.Entropy = entropy
+	if err := w.deriveSeed(); err != nil {
+		return nil, err
+	}
+	if err := w.save(); err != nil {
+		return nil, err
+	}
+	if err := s.Put(keyName, blob); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Open loads the wallet in s. A wrong passphrase gets keystore.ErrSealed.
+func Open(s keystore.Storage, passphrase []byte) (*Wallet, error) {
+	blob, err := s.Get(keyName)
+	if err != nil {
+		return nil, fmt.Errorf("wallet key: %w", err)
+	}
+	dataKey, err := keystore.DecryptData(blob, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("wallet key: %w", err)
+	}
+	w := newWallet(s, dataKey)
+	sealed, err := s.Get(recordsName)
+	if err != nil {
+		return nil, fmt.Errorf("wallet records: %w", err)
+	}
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(plaintext, &w.records); err != nil {
+		return nil, fmt.Errorf("wallet records: %w", err)
+	}
+	if err := w.deriveSeed(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// CreateTenant is like Create, with the storage of a tenant, as registered
+// with t.Add. The quota of t limits the number of DIDs in the wallet. Each
+// tenant has its own passphrase, and thus its own data key.
+func CreateTenant(t *keystore.Tenants, id string, passphrase []byte, kdf keystore.KDF) (*Wallet, error) {
+	s, err := t.Namespace(id)
+	if err != nil {
+		return nil, err
+	}
+	w, err := Create(s, passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	w.quota = t.Quota
+	return w, nil
+}
+
+// OpenTenant is like Open, with the storage of a tenant. See CreateTenant.
+func OpenTenant(t *keystore.Tenants, id string, passphrase []byte) (*Wallet, error) {
+	s, err := t.Namespace(id)
+	if err != nil {
+		return nil, err
+	}
+	w, err := Open(s, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	w.quota = t.Quota
+	return w, nil
+}
+
+// DeriveSeed sets the seed of the master secret.
+func (w *Wallet) deriveSeed() error {
+	mnemonic, err := hdkey.NewMnemonic(w.records.Entropy)
+	if err != nil {
+		return fmt.Errorf("wallet master secret: %w", err)
+	}
+	w.seed, err = hdkey.MnemonicSeed(mnemonic, "")
+	return err
+}
+
+// Mnemonic returns the master secret as a BIP-39 mnemonic sentence of 24
+// words, for use with Restore. Anyone with the mnemonic has the keys of each
+// DID in the wallet, except for the ones imported.
+func (w *Wallet) Mnemonic() (string, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return hdkey.NewMnemonic(w.records.Entropy)
+}
+
+func newWallet(s keystore.Storage, dataKey []byte) *Wallet {
+	return &Wallet{
+		storage: s,
+		dataKey: dataKey,
+		keys:    &keystore.Sealed{Storage: s, Key: dataKey},
+	}
+}
+
+// Save persists the records. The mutex must be held.
+func (w *Wallet) save() error {
+	plaintext, err := json.Marshal(&w.records)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(w.dataKey)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("wallet nonce unavailable: %w", err)
+	}
+	return w.storage.Put(recordsName, aead.Seal(nonce, nonce, plaintext, []byte(recordsName)))
+}
+
+// Open is the inverse of the sealing in save.
+func open(dataKey, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: wallet records truncated", keystore.ErrSealed)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(recordsName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wallet records", keystore.ErrSealed)
+	}
+	return plaintext, nil
+}
+
+// NewDID creates a did:key with a key pair of the type, from the next account
+// of the master secret. Key types are limited to keystore.Ed25519 and
+// keystore.P256.
+func (w *Wallet) NewDID(kt keystore.KeyType) (backend.DID, error) {
+	w.mutex.Lock()
+	account := w.records.Accounts
+	w.records.Accounts++ // persisted with the identity
+	w.mutex.Unlock()
+
+	id := &Identity{KeyType: kt, Account: account}
+	key, err := w.derive(id)
+	if err != nil {
+		return backend.DID{}, err
+	}
+	id.DID, err = didkey.New(key.Public())
+	if err != nil {
+		return backend.DID{}, err
+	}
+	id.KeyID = backend.URL{DID: id.DID, RawFragment: "#" + id.DID.SpecID}
+	if err := w.importKey(id, key); err != nil {
+		return backend.DID{}, err
+	}
+	return id.DID, nil
+}
+
+// Derive returns the key of an identity from the master secret.
+func (w *Wallet) derive(id *Identity) (crypto.Signer, error) {
+	key, err := hdkey.DIDKey(w.seed, keys.Type(id.KeyType), id.Account, hdkey.Authentication, 0)
+	if err != nil {
+		return nil, err
+	}
+	return keys.Signer(key)
+}
+
+// ImportKey adds id with key, which sets the KeyRef of id.
+func (w *Wallet) importKey(id *Identity, key crypto.Signer) error {
+	ref, err := newRef()
+	if err != nil {
+		return err
+	}
+	if err := w.keys.Import(ref, key); err != nil {
+		return err
+	}
+	id.KeyRef = ref
+	if err := w.addIdentity(id); err != nil {
+		w.keys.Delete(ref)
+		return err
+	}
+	return nil
+}
+
+// Import adds the DID of keyID, with the private key of the verification
+// method, for DIDs of any method. Imported keys are not in the mnemonic, nor
+// in backups.
+func (w *Wallet) Import(keyID backend.URL, key crypto.Signer) error {
+	if keyID.IsRelative() {
+		return fmt.Errorf("key identifier %s has no DID", keyID.String())
+	}
+	return w.importKey(&Identity{DID: keyID.DID, KeyID: keyID}, key)
+}
+
+func (w *Wallet) addIdentity(id *Identity) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, e := range w.records.Identities {
+		if e.DID.Equal(id.DID) {
+			return fmt.Errorf("DID %s in wallet already", id.DID.String())
+		}
+	}
+	if w.quota > 0 && len(w.records.Identities) >= w.quota {
+		return fmt.Errorf("%w: %d DIDs", keystore.ErrQuota, len(w.records.Identities))
+	}
+	w.records.Identities = append(w.records.Identities, id)
+	if err := w.save(); err != nil {
+		w.records.Identities = w.records.Identities[:len(w.records.Identities)-1]
+		return err
+	}
+	return nil
+}
+
+// DIDs returns the DIDs of the wallet in order of addition.
+func (w *Wallet) DIDs() []backend.DID {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	dids := make([]backend.DID, len(w.records.Identities))
+	for i, id := range w.records.Identities {
+		dids[i] = id.DID
+	}
+	return dids
+}
+
+// Signer returns the key of did, with its verification method.
+func (w *Wallet) Signer(did backend.DID) (crypto.Signer, *backend.URL, error) {
+	w.mutex.Lock()
+	var id *Identity
+	for _, e := range w.records.Identities {
+		if e.DID.Equal(did) {
+			id = e
+		}
+	}
+	w.mutex.Unlock()
+	if id == nil {
+		return nil, nil, fmt.Errorf("%w: DID %s", ErrNotFound, did.String())
+	}
+	signer, err := w.keys.Signer(id.KeyRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := id.KeyID // copy
+	return signer, &keyID, nil
+}
+
+// Add keeps a secured credential, as returned by vc.Issue, and it returns the
+// identifier of the entry. Credentials are checked with Verifier, if any.
+// Adding a credential held already is a no-op.
+func (w *Wallet) Add(ctx context.Context, secured []byte) (string, error) {
+	if _, err := decode(secured); err != nil {
+		return "", err
+	}
+	if w.Verifier != nil {
+		if _, err := w.Verifier.VerifyCredential(ctx, secured, time.Now()); err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256(secured)
+	e := &Entry{ID: hex.EncodeToString(sum[:]), Secured: secured, Added: time.Now().UTC()}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, held := range w.records.Credentials {
+		if held.ID == e.ID {
+			return e.ID, nil
+		}
+	}
+	w.records.Credentials = append(w.records.Credentials, e)
+	if err := w.save(); err != nil {
+		w.records.Credentials = w.records.Credentials[:len(w.records.Credentials)-1]
+		return "", err
+	}
+	return e.ID, nil
+}
+
+// Credentials returns the entries in order of addition.
+func (w *Wallet) Credentials() []Entry {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	entries := make([]Entry, len(w.records.Credentials))
+	for i, e := range w.records.Credentials {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// Remove discards a credential.
+func (w *Wallet) Remove(id string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for i, e := range w.records.Credentials {
+		if e.ID != id {
+			continue
+		}
+		previous := w.records.Credentials
+		w.records.Credentials = append(previous[:i:i], previous[i+1:]...)
+		if err := w.save(); err != nil {
+			w.records.Credentials = previous
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: credential %q", ErrNotFound, id)
+}
+
+// Present answers req with a presentation of holder, in format, for the
+// presentation definition of the request. Each input descriptor gets the first
+// credential which satisfies its constraints, in order of addition. Requests
+// which can not be satisfied get openid4vp.ErrConstraint. Post the response
+// with proofreq.Fetcher Respond.
+func (w *Wallet) Present(req *proofreq.Request, holder backend.DID, format vc.Format) (*proofreq.Response, error) {
+	if len(req.PresentationDefinition) == 0 {
+		return nil, errors.New("presentation request without presentation_definition")
+	}
+	var def openid4vp.Definition
+	if err := json.Unmarshal(req.PresentationDefinition, &def); err != nil {
+		return nil, fmt.Errorf("presentation_definition: %w", err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	signer, keyID, err := w.Signer(holder)
+	if err != nil {
+		return nil, err
+	}
+
+	vpFormat, nestedPath := openid4vp.JWTVP, "$.vp.verifiableCredential[%d]"
+	if format == vc.DataIntegrity {
+		vpFormat, nestedPath = openid4vp.LDPVP, "$.verifiableCredential[%d]"
+	}
+	p := vc.NewPresentation(holder)
+	submission := &openid4vp.Submission{DefinitionID: def.ID}
+	submission.ID, err = newRef()
+	if err != nil {
+		return nil, err
+	}
+	included := make(map[string]int) // presentation index by entry ID
+	entries := w.Credentials()
+	for _, in := range def.InputDescriptors {
+		var match *Entry
+		for i := range entries {
+			claims, err := decode(entries[i].Secured)
+			if err != nil {
+				continue
+			}
+			if _, err := in.Match(claims); err == nil {
+				match = &entries[i]
+				break
+			}
+		}
+		if match == nil {
+			return nil, fmt.Errorf("%w: no credential in wallet for input descriptor %q", openid4vp.ErrConstraint, in.ID)
+		}
+		index, ok := included[match.ID]
+		if !ok {
+			index = len(p.Credentials)
+			if err := p.Add(match.Secured); err != nil {
+				return nil, err
+			}
+			included[match.ID] = index
+		}
+		nestedFormat := openid4vp.JWTVC
+		if match.Secured[0] == '{' {
+			nestedFormat = openid4vp.LDPVC
+		}
+		submission.DescriptorMap = append(submission.DescriptorMap, &openid4vp.Descriptor{
+			ID:     in.ID,
+			Format: vpFormat,
+			Path:   "$",
+			PathNested: &openid4vp.Descriptor{
+				ID:     in.ID,
+				Format: nestedFormat,
+				Path:   fmt.Sprintf(nestedPath, index),
+			},
+		})
+	}
+
+	token, err := vc.Present(p, signer, keyID, req.Nonce, req.ClientID, format)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(submission)
+	if err != nil {
+		return nil, err
+	}
+	return &proofreq.Response{
+		State:                  req.State,
+		VPToken:                string(token),
+		PresentationSubmission: raw,
+		Request:                req,
+	}, nil
+}
+
+// Decode returns the claims of a secured credential in the form of its claim
+// format. The credential must decode. Nothing is verified.
+func decode(secured []byte) (map[string]any, error) {
+	if len(secured) == 0 {
+		return nil, errors.New("empty credential")
+	}
+	var claims map[string]any
+	credentialJSON := secured
+	if secured[0] == '{' {
+		if err := json.Unmarshal(secured, &claims); err != nil {
+			return nil, fmt.Errorf("credential: %w", err)
+		}
+	} else {
+		jws, err := jose.ParseCompact(string(secured))
+		if err != nil {
+			return nil, fmt.Errorf("credential: %w", err)
+		}
+		var payload struct {
+			VC json.RawMessage `json:"vc"`
+		}
+		if err := json.Unmarshal(jws.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("credential JWT claims: %w", err)
+		}
+		if len(payload.VC) == 0 {
+			return nil, errors.New(`credential JWT has no "vc" claim`)
+		}
+		if err := json.Unmarshal(jws.Payload, &claims); err != nil {
+			return nil, fmt.Errorf("credential JWT claims: %w", err)
+		}
+		credentialJSON = payload.VC
+	}
+	c := new(vc.Credential)
+	if err := json.Unmarshal(credentialJSON, c); err != nil {
+		return nil, fmt.Errorf("credential: %w", err)
+	}
+	return claims, nil
+}
+
+// NewRef returns a random identifier.
+func newRef() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("wallet identifier unavailable: %w", err)
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
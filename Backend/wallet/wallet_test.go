@@ -0,0 +1,393 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/authz"
+	"EncrypteDL/IDChain/Backend/didkey"
+	"EncrypteDL/IDChain/Backend/edv"
+	"EncrypteDL/IDChain/Backend/hdkey"
+	"EncrypteDL/IDChain/Backend/keys"
+	"EncrypteDL/IDChain/Backend/keystore"
+	"EncrypteDL/IDChain/Backend/openid4vp"
+	"EncrypteDL/IDChain/Backend/proofreq"
+	"EncrypteDL/IDChain/Backend/vc"
+)
+
+var fastKDF = keystore.KDF{N: 1 << 10}
+
+func TestPersistence(t *testing.T) {
+	storage := new(keystore.MapStorage)
+	w, err := Create(storage, []byte("correct horse"), fastKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(storage, []byte("correct horse"), fastKDF); !errors.Is(err, ErrExists) {
+		t.Errorf("second creation got error %v, want ErrExists", err)
+	}
+	did, err := w.NewDID(keystore.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := w.Add(context.Background(), []byte(`{"@context":["https://www.w3.org/ns/credentials/v2"],"type":["VerifiableCredential"],"issuer":"did:example:issuer","credentialSubject":{"id":"did:example:holder"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(context.Background(), []byte("not a credential")); err == nil {
+		t.Error("garbage added")
+	}
+
+	if _, err := Open(storage, []byte("battery staple")); !errors.Is(err, keystore.ErrSealed) {
+		t.Errorf("wrong passphrase got error %v, want ErrSealed", err)
+	}
+	reopened, err := Open(storage, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dids := reopened.DIDs(); len(dids) != 1 || !dids[0].Equal(did) {
+		t.Errorf("got DIDs %v, want [%s]", dids, did)
+	}
+	if entries := reopened.Credentials(); len(entries) != 1 || entries[0].ID != id {
+		t.Errorf("got %d credentials, want %q", len(entries), id)
+	}
+	signer, keyID, err := reopened.Signer(did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := didkey.New(signer.Public()); !d.Equal(did) || !keyID.DID.Equal(did) {
+		t.Errorf("got key %s for %s", keyID, did)
+	}
+
+	if err := reopened.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Remove(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second removal got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	storage := new(keystore.MapStorage)
+	tenants := &keystore.Tenants{Storage: storage, MasterKey: make([]byte, 32), Quota: 1}
+	if _, err := CreateTenant(tenants, "acme", []byte("acme pass"), fastKDF); !errors.Is(err, keystore.ErrTenant) {
+		t.Errorf("unregistered tenant got error %v, want ErrTenant", err)
+	}
+	for _, id := range []string{"acme", "globex"} {
+		if err := tenants.Add(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acme, err := CreateTenant(tenants, "acme", []byte("acme pass"), fastKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateTenant(tenants, "globex", []byte("globex pass"), fastKDF); err != nil {
+		t.Fatal("wallet of another tenant:", err)
+	}
+	did, err := acme.NewDID(keystore.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acme.NewDID(keystore.Ed25519); !errors.Is(err, keystore.ErrQuota) {
+		t.Errorf("DID over quota got error %v, want ErrQuota", err)
+	}
+
+	if _, err := OpenTenant(tenants, "globex", []byte("acme pass")); !errors.Is(err, keystore.ErrSealed) {
+		t.Errorf("passphrase of another tenant got error %v, want ErrSealed", err)
+	}
+	globex, err := OpenTenant(tenants, "globex", []byte("globex pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dids := globex.DIDs(); len(dids) != 0 {
+		t.Errorf("other tenant has DIDs %v", dids)
+	}
+	if _, _, err := globex.Signer(did); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cross-tenant signer got error %v, want ErrNotFound", err)
+	}
+
+	if err := tenants.Remove("acme"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := storage.List("tenants/acme/"); len(names) != 0 {
+		t.Errorf("removed tenant left %q", names)
+	}
+	if _, err := OpenTenant(tenants, "acme", []byte("acme pass")); !errors.Is(err, keystore.ErrTenant) {
+		t.Errorf("removed tenant got error %v, want ErrTenant", err)
+	}
+}
+
+func TestPresent(t *testing.T) {
+	issuerKey, _ := keys.Generate(keys.Ed25519)
+	issuerSigner, _ := keys.Signer(issuerKey)
+	issuer, _ := didkey.New(issuerSigner.Public())
+	issuerKeyID := &backend.URL{DID: issuer, RawFragment: "#" + issuer.SpecID}
+
+	verifier := &vc.Verifier{Resolver: new(didkey.Resolver), BindSubject: true}
+	w, err := Create(new(keystore.MapStorage), []byte("correct horse"), fastKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Verifier = verifier
+	holder, err := w.NewDID(keystore.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	for i, subject := range []map[string]any{
+		{"id": holder.String(), "memberOf": "Chess Club"},
+		{"id": holder.String(), "age": 36},
+	} {
+		c := &vc.Credential{
+			Context:   []any{vc.V2},
+			Types:     []string{"VerifiableCredential"},
+			Issuer:    vc.Issuer{ID: issuer.String()},
+			ValidFrom: &issued,
+			Subjects:  vc.Subjects{subject},
+		}
+		format := vc.JWT
+		if i%2 == 1 {
+			format = vc.DataIntegrity
+		}
+		secured, err := vc.Issue(c, issuerSigner, issuerKeyID, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add(context.Background(), secured); err != nil {
+			t.Fatal("add error:", err)
+		}
+	}
+
+	def := &openid4vp.Definition{ID: "age-check", InputDescriptors: []*openid4vp.InputDescriptor{{
+		ID: "adult",
+		Constraints: openid4vp.Constraints{Fields: []*openid4vp.Field{
+			{ID: "age", Path: []string{"$.vc.credentialSubject.age", "$.credentialSubject.age"}, Filter: json.RawMessage(`{"type":"number","minimum":18}`)},
+		}},
+	}, {
+		ID: "member",
+		Constraints: openid4vp.Constraints{Fields: []*openid4vp.Field{
+			{Path: []string{"$.vc.credentialSubject.memberOf", "$.credentialSubject.memberOf"}},
+		}},
+	}}}
+	defJSON, _ := json.Marshal(def)
+	req := &proofreq.Request{ClientID: "did:example:verifier", Nonce: "n-0S6_WzA2Mj", State: "s", PresentationDefinition: defJSON}
+
+	v := &openid4vp.Verifier{Credentials: verifier}
+	for _, format := range []vc.Format{vc.JWT, vc.DataIntegrity} {
+		resp, err := w.Present(req, holder, format)
+		if err != nil {
+			t.Fatalf("%s: present error: %s", format, err)
+		}
+		result, err := v.Verify(context.Background(), def, resp)
+		if err != nil {
+			t.Fatalf("%s: verify error: %s", format, err)
+		}
+		if result.Fields["age"] != 36.0 || result.Credentials["member"] == nil {
+			t.Errorf("%s: got result %+v", format, result)
+		}
+	}
+
+	def.InputDescriptors[0].Constraints.Fields[0].Filter = json.RawMessage(`{"type":"number","minimum":65}`)
+	req.PresentationDefinition, _ = json.Marshal(def)
+	if _, err := w.Present(req, holder, vc.JWT); !errors.Is(err, openid4vp.ErrConstraint) {
+		t.Errorf("unsatisfiable request got error %v, want ErrConstraint", err)
+	}
+}
+
+// EDVServer is a minimal vault service in memory, with queries on names only.
+type edvServer struct {
+	auth *authz.DIDAuth
+
+	mutex  sync.Mutex
+	vaults map[string]*edv.Config
+	docs   map[string]map[string]*edv.EncryptedDocument // by vault and by ID
+}
+
+func (s *edvServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /edvs", func(w http.ResponseWriter, r *http.Request) {
+		conf := new(edv.Config)
+		json.NewDecoder(r.Body).Decode(conf)
+		s.vaults[conf.ID] = conf
+		s.docs[conf.ID] = make(map[string]*edv.EncryptedDocument)
+		w.Header().Set("Location", "/edvs/"+conf.ID)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /edvs/{vault}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(s.vaults[r.PathValue("vault")])
+	})
+	mux.HandleFunc("POST /edvs/{vault}/documents", func(w http.ResponseWriter, r *http.Request) {
+		doc := new(edv.EncryptedDocument)
+		json.NewDecoder(r.Body).Decode(doc)
+		s.docs[r.PathValue("vault")][doc.ID] = doc
+		w.Header().Set("Location", r.URL.Path+"/"+doc.ID)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("DELETE /edvs/{vault}/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		delete(s.docs[r.PathValue("vault")], r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /edvs/{vault}/query", func(w http.ResponseWriter, r *http.Request) {
+		var q edv.Query
+		json.NewDecoder(r.Body).Decode(&q)
+		found := []*edv.EncryptedDocument{}
+		for _, doc := range s.docs[r.PathValue("vault")] {
+			names := make(map[string]bool)
+			for _, index := range doc.Indexed {
+				for _, a := range index.Attributes {
+					names[a.Name] = true
+				}
+			}
+			all := true
+			for _, name := range q.Has {
+				all = all && names[name]
+			}
+			if all {
+				found = append(found, doc)
+			}
+		}
+		json.NewEncoder(w).Encode(found)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, err := s.auth.Authenticate(r); err != nil || p == nil {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func TestBackup(t *testing.T) {
+	resolver := &didkey.Resolver{Format: keys.JsonWebKey2020, DeriveKeyAgreement: true}
+	s := &edvServer{
+		vaults: make(map[string]*edv.Config),
+		docs:   make(map[string]map[string]*edv.EncryptedDocument),
+	}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+	s.auth = &authz.DIDAuth{Resolver: resolver, Audience: srv.URL + "/edvs"}
+	ctx := context.Background()
+
+	w, err := Create(new(keystore.MapStorage), []byte("correct horse"), fastKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dids []backend.DID
+	for _, kt := range []keystore.KeyType{keystore.Ed25519, keystore.P256} {
+		did, err := w.NewDID(kt)
+		if err != nil {
+			t.Fatalf("%s: %s", kt, err)
+		}
+		dids = append(dids, did)
+	}
+	if _, err := w.NewDID(keystore.P384); !errors.Is(err, keys.ErrKeyType) {
+		t.Errorf("P-384 got error %v, want ErrKeyType", err)
+	}
+	_, foreign, _ := ed25519.GenerateKey(rand.Reader)
+	if err := w.Import(backend.URL{DID: backend.DID{Method: "example", SpecID: "imported"}, RawFragment: "#key-1"}, foreign); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, subject := range []string{"did:example:a", "did:example:b"} {
+		id, err := w.Add(ctx, []byte(`{"@context":["https://www.w3.org/ns/credentials/v2"],"type":["VerifiableCredential"],"issuer":"did:example:issuer","credentialSubject":{"id":"`+subject+`"}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	mnemonic, err := w.Mnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Fields(mnemonic)); n != 24 {
+		t.Errorf("got mnemonic of %d words, want 24", n)
+	}
+	c, err := BackupClient(mnemonic, srv.URL+"/edvs", resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewBackupVault(ctx, c)
+	if err != nil {
+		t.Fatal("vault creation error:", err)
+	}
+	for range 2 {
+		if err := w.Backup(ctx, v); err != nil {
+			t.Fatal("backup error:", err)
+		}
+	}
+	if n := len(s.docs[v.Config.ID]); n != 4 {
+		t.Errorf("backup has %d documents, want 2 DIDs and 2 credentials", n)
+	}
+	if err := w.Remove(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Backup(ctx, v); err != nil {
+		t.Fatal("backup error:", err)
+	}
+	if n := len(s.docs[v.Config.ID]); n != 3 {
+		t.Errorf("backup has %d documents after removal, want 3", n)
+	}
+
+	// new device with the mnemonic and the vault location only
+	c, err = BackupClient(mnemonic, srv.URL+"/edvs", resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = c.Open(ctx, v.URL)
+	if err != nil {
+		t.Fatal("vault open error:", err)
+	}
+	restored, err := Restore(ctx, new(keystore.MapStorage), []byte("battery staple"), fastKDF, mnemonic, v)
+	if err != nil {
+		t.Fatal("restore error:", err)
+	}
+	if got := restored.DIDs(); len(got) != 2 || !got[0].Equal(dids[0]) || !got[1].Equal(dids[1]) {
+		t.Errorf("restored DIDs %v, want %v", got, dids)
+	}
+	if got := restored.Credentials(); len(got) != 1 || got[0].ID != ids[1] {
+		t.Errorf("restored %d credentials, want %q", len(got), ids[1])
+	}
+	for _, did := range dids {
+		signer, _, err := restored.Signer(did)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, _ := didkey.New(signer.Public()); !d.Equal(did) {
+			t.Errorf("restored another key for %s", did)
+		}
+	}
+	next, err := restored.NewDID(keystore.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Equal(dids[0]) || next.Equal(dids[1]) {
+		t.Error("restored wallet reuses an account")
+	}
+
+	// vault of another mnemonic
+	other, _ := Create(new(keystore.MapStorage), []byte("correct horse"), fastKDF)
+	otherMnemonic, _ := other.Mnemonic()
+	c, _ = BackupClient(otherMnemonic, srv.URL+"/edvs", resolver)
+	if _, err := c.Open(ctx, v.URL); err == nil {
+		t.Error("opened the vault of another controller")
+	}
+	if _, err := Restore(ctx, new(keystore.MapStorage), nil, fastKDF, "zoo zoo zoo", v); !errors.Is(err, hdkey.ErrMnemonic) {
+		t.Errorf("malformed mnemonic got error %v, want ErrMnemonic", err)
+	}
+}
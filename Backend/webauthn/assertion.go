@@ -0,0 +1,161 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// ErrAssertion signals an authentication assertion which does not verify.
+var ErrAssertion = errors.New("WebAuthn assertion denied")
+
+// ErrSignCount signals a signature counter which did not increase. “This is a
+// signal that the authenticator may be cloned.” — Web Authentication, Level 2
+var ErrSignCount = errors.New("WebAuthn signature counter did not increase")
+
+// Assertion is the authenticator response to navigator.credentials.get.
+type Assertion struct {
+	CredentialID      []byte
+	AuthenticatorData []byte
+	ClientDataJSON    []byte
+	Signature         []byte
+}
+
+// Expectation has the relying party constraints for assertions.
+type Expectation struct {
+	// RPID is the relying party identifier, i.e., a domain name.
+	RPID string
+
+	// Origins lists the acceptable origins, e.g., "https://example.com".
+	Origins []string
+
+	// Challenge has the random bytes issued for the authentication.
+	Challenge []byte
+
+	// UserVerification requires the UV flag when set.
+	UserVerification bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Verify checks a against the expectation, with the credential public key.
+// The previous signature count is compared when either count is non-zero,
+// conform WebAuthn, section 7.2, step 21. The return has the authenticator
+// data on success.
+func (e *Expectation) Verify(a *Assertion, pub crypto.PublicKey, prevSignCount uint32) (*AuthenticatorData, error) {
+	if len(e.Challenge) == 0 {
+		return nil, fmt.Errorf("%w: no challenge issued", ErrAssertion)
+	}
+	var c clientData
+	if err := json.Unmarshal(a.ClientDataJSON, &c); err != nil {
+		return nil, fmt.Errorf("%w: client data: %w", ErrAssertion, err)
+	}
+	if c.Type != "webauthn.get" {
+		return nil, fmt.Errorf("%w: client data type %q", ErrAssertion, c.Type)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(c.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(challenge, e.Challenge) != 1 {
+		return nil, fmt.Errorf("%w: challenge mismatch", ErrAssertion)
+	}
+	originOK := false
+	for _, o := range e.Origins {
+		if o == c.Origin {
+			originOK = true
+			break
+		}
+	}
+	if !originOK {
+		return nil, fmt.Errorf("%w: origin %q not accepted", ErrAssertion, c.Origin)
+	}
+
+	d, err := ParseAuthenticatorData(a.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAssertion, err)
+	}
+	if d.RPIDHash != sha256.Sum256([]byte(e.RPID)) {
+		return nil, fmt.Errorf("%w: relying party ID hash mismatch", ErrAssertion)
+	}
+	if d.Flags&FlagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrAssertion)
+	}
+	if e.UserVerification && d.Flags&FlagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user not verified", ErrAssertion)
+	}
+
+	// signature over the authenticator data and the client data hash
+	clientDataHash := sha256.Sum256(a.ClientDataJSON)
+	signed := make([]byte, 0, len(a.AuthenticatorData)+len(clientDataHash))
+	signed = append(signed, a.AuthenticatorData...)
+	signed = append(signed, clientDataHash[:]...)
+
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signed, a.Signature) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrAssertion)
+		}
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch pub.Curve.Params().BitSize {
+		case 256:
+			h := sha256.Sum256(signed)
+			digest = h[:]
+		case 384:
+			h := sha512.Sum384(signed)
+			digest = h[:]
+		default:
+			h := sha512.Sum512(signed)
+			digest = h[:]
+		}
+		// WebAuthn uses ASN.1 DER, unlike JWS
+		if !ecdsa.VerifyASN1(pub, digest, a.Signature) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrAssertion)
+		}
+	default:
+		return nil, fmt.Errorf("%w: key type %T", jose.ErrKeyType, pub)
+	}
+
+	if d.SignCount != 0 || prevSignCount != 0 {
+		if d.SignCount <= prevSignCount {
+			return nil, ErrSignCount
+		}
+	}
+	return d, nil
+}
+
+// VerifyDIDAuth checks a as a DID Auth response from the subject of doc. The
+// credential must be an authentication method of doc, identified by the
+// Credential Fragment convention. The return has the verification method in
+// use, and the authenticator data for sign count bookkeeping.
+func (e *Expectation) VerifyDIDAuth(doc *backend.Document, a *Assertion, prevSignCount uint32) (*backend.VerificationMethod, *AuthenticatorData, error) {
+	id := &backend.URL{
+		DID:         doc.Subject,
+		RawFragment: (&Credential{ID: a.CredentialID}).Fragment(),
+	}
+	m := doc.AuthorizedMethod(doc.Authentication, id)
+	if m == nil {
+		return nil, nil, fmt.Errorf("%w: no authentication method %s in DID document", ErrAssertion, id.String())
+	}
+	pub, err := jose.MethodKey(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := e.Verify(a, pub, prevSignCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, d, nil
+}
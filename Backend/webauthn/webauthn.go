@@ -0,0 +1,212 @@
+// Package webauthn lets platform passkeys back DID verification methods. The
+// credential public key from a WebAuthn registration becomes a verification
+// method, and authentication assertions from the passkey verify as DID Auth
+// responses.
+//
+// Attestation statements are not verified. Platform passkeys commonly use the
+// "none" attestation format anyway.
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/cbor"
+	"EncrypteDL/IDChain/Backend/jose"
+)
+
+// Authenticator data flags
+const (
+	FlagUserPresent      = 1 << 0 // UP
+	FlagUserVerified     = 1 << 2 // UV
+	FlagBackupEligible   = 1 << 3 // BE
+	FlagBackupState      = 1 << 4 // BS
+	FlagAttestedCredData = 1 << 6 // AT
+	FlagExtensionData    = 1 << 7 // ED
+)
+
+// COSE algorithm identifiers
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgES384 = -35
+	AlgES512 = -36
+)
+
+// AuthenticatorData is the parsed form of the authenticator data structure.
+type AuthenticatorData struct {
+	RPIDHash  [32]byte
+	Flags     byte
+	SignCount uint32
+
+	// Attested credential data is present on registration only.
+	AAGUID              [16]byte
+	CredentialID        []byte
+	CredentialPublicKey []byte // COSE_Key encoding
+}
+
+// ParseAuthenticatorData decodes the binary structure.
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("WebAuthn authenticator data of %d bytes too short", len(data))
+	}
+	var d AuthenticatorData
+	copy(d.RPIDHash[:], data)
+	d.Flags = data[32]
+	d.SignCount = binary.BigEndian.Uint32(data[33:])
+	data = data[37:]
+
+	if d.Flags&FlagAttestedCredData != 0 {
+		if len(data) < 18 {
+			return nil, errors.New("WebAuthn attested credential data incomplete")
+		}
+		copy(d.AAGUID[:], data)
+		n := int(binary.BigEndian.Uint16(data[16:]))
+		data = data[18:]
+		if len(data) < n {
+			return nil, errors.New("WebAuthn credential ID incomplete")
+		}
+		d.CredentialID = data[:n]
+		data = data[n:]
+
+		_, keyLen, err := cbor.UnmarshalPrefix(data)
+		if err != nil {
+			return nil, fmt.Errorf("WebAuthn credential public key: %w", err)
+		}
+		d.CredentialPublicKey = data[:keyLen]
+		data = data[keyLen:]
+	}
+
+	if d.Flags&FlagExtensionData != 0 {
+		_, n, err := cbor.UnmarshalPrefix(data)
+		if err != nil {
+			return nil, fmt.Errorf("WebAuthn extensions: %w", err)
+		}
+		data = data[n:]
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("WebAuthn authenticator data has %d bytes of trailing data", len(data))
+	}
+	return &d, nil
+}
+
+// Credential is a registered passkey.
+type Credential struct {
+	ID        []byte
+	PublicKey crypto.PublicKey // ed25519.PublicKey or *ecdsa.PublicKey
+	Algorithm int              // COSE identifier
+	SignCount uint32
+}
+
+// NewCredential returns the credential from a registration, as encoded in the
+// attestationObject of the authenticator response.
+func NewCredential(attestationObject []byte) (*Credential, error) {
+	v, err := cbor.Unmarshal(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("WebAuthn attestation object: %w", err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("WebAuthn attestation object is not a CBOR map")
+	}
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("WebAuthn attestation object has no authData")
+	}
+
+	d, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if d.Flags&FlagAttestedCredData == 0 {
+		return nil, errors.New("WebAuthn registration has no attested credential data")
+	}
+	pub, alg, err := ParseCOSEKey(d.CredentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        d.CredentialID,
+		PublicKey: pub,
+		Algorithm: alg,
+		SignCount: d.SignCount,
+	}, nil
+}
+
+// ParseCOSEKey decodes a public key conform RFC 9053. It returns the key with
+// its COSE algorithm identifier.
+func ParseCOSEKey(data []byte) (crypto.PublicKey, int, error) {
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("COSE key: %w", err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, 0, errors.New("COSE key is not a CBOR map")
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	x, _ := m[int64(-2)].([]byte)
+
+	switch kty {
+	case 1: // OKP
+		if crv != 6 || alg != AlgEdDSA {
+			return nil, 0, fmt.Errorf("%w: COSE OKP curve %d with algorithm %d", jose.ErrKeyType, crv, alg)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, fmt.Errorf("COSE Ed25519 key has %d bytes", len(x))
+		}
+		return ed25519.PublicKey(x), AlgEdDSA, nil
+
+	case 2: // EC2
+		y, _ := m[int64(-3)].([]byte)
+		var curve elliptic.Curve
+		var want int64
+		switch crv {
+		case 1:
+			curve, want = elliptic.P256(), AlgES256
+		case 2:
+			curve, want = elliptic.P384(), AlgES384
+		case 3:
+			curve, want = elliptic.P521(), AlgES512
+		default:
+			return nil, 0, fmt.Errorf("%w: COSE EC2 curve %d", jose.ErrKeyType, crv)
+		}
+		if alg != want {
+			return nil, 0, fmt.Errorf("%w: COSE algorithm %d for curve %d", jose.ErrKeyType, alg, crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, 0, fmt.Errorf("COSE EC2 coordinates have %d and %d bytes, want %d", len(x), len(y), size)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, errors.New("COSE EC2 point not on curve")
+		}
+		return pub, int(alg), nil
+
+	default:
+		return nil, 0, fmt.Errorf("%w: COSE kty %d", jose.ErrKeyType, kty)
+	}
+}
+
+// Fragment returns the DID URL fragment for the credential, which is the
+// credential ID in base64url encoding. Assertions identify their credential by
+// ID, which makes the verification method directly addressable.
+func (c *Credential) Fragment() string {
+	return "#" + base64.RawURLEncoding.EncodeToString(c.ID)
+}
+
+// VerificationMethod returns a JsonWebKey2020 verification method for c.
+func (c *Credential) VerificationMethod(controller backend.DID) (*backend.VerificationMethod, error) {
+	return jose.NewMethod(backend.URL{DID: controller, RawFragment: c.Fragment()}, controller, c.PublicKey)
+}
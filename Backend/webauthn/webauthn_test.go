@@ -0,0 +1,174 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	backend "EncrypteDL/IDChain/Backend"
+	"EncrypteDL/IDChain/Backend/cbor"
+)
+
+const testRPID = "example.com"
+
+// TestAuthenticator simulates a platform passkey.
+type testAuthenticator struct {
+	t         *testing.T
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthenticator{t: t, key: key, id: []byte("credential-0001")}
+}
+
+func (a *testAuthenticator) authData(flags byte, attested []byte) []byte {
+	h := sha256.Sum256([]byte(testRPID))
+	buf := append(h[:], flags)
+	buf = binary.BigEndian.AppendUint32(buf, a.signCount)
+	return append(buf, attested...)
+}
+
+func (a *testAuthenticator) attestationObject() []byte {
+	coseKey, err := cbor.Marshal(map[int]any{
+		1:  2,        // kty: EC2
+		3:  AlgES256, // alg
+		-1: 1,        // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, coseKey...)
+
+	obj, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(FlagUserPresent|FlagUserVerified|FlagAttestedCredData, attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return obj
+}
+
+func (a *testAuthenticator) get(challenge []byte, origin string) *Assertion {
+	a.signCount++
+	clientDataJSON := []byte(`{"type":"webauthn.get","challenge":"` +
+		base64.RawURLEncoding.EncodeToString(challenge) +
+		`","origin":"` + origin + `","crossOrigin":false}`)
+	authData := a.authData(FlagUserPresent|FlagUserVerified, nil)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return &Assertion{
+		CredentialID:      a.id,
+		AuthenticatorData: authData,
+		ClientDataJSON:    clientDataJSON,
+		Signature:         sig,
+	}
+}
+
+func TestDIDAuth(t *testing.T) {
+	passkey := newTestAuthenticator(t)
+
+	cred, err := NewCredential(passkey.attestationObject())
+	if err != nil {
+		t.Fatal("registration error:", err)
+	}
+	if string(cred.ID) != string(passkey.id) || cred.Algorithm != AlgES256 {
+		t.Errorf("got credential ID %q with algorithm %d", cred.ID, cred.Algorithm)
+	}
+
+	subject := backend.DID{Method: "example", SpecID: "alice"}
+	m, err := cred.VerificationMethod(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &backend.Document{
+		Subject:             subject,
+		VerificationMethods: []*backend.VerificationMethod{m},
+		Authentication: &backend.VerificationRelationship{
+			URIRefs: []*backend.URL{{RawFragment: cred.Fragment()}},
+		},
+	}
+
+	e := Expectation{
+		RPID:             testRPID,
+		Origins:          []string{"https://example.com"},
+		Challenge:        []byte("random challenge"),
+		UserVerification: true,
+	}
+	got, d, err := e.VerifyDIDAuth(doc, passkey.get(e.Challenge, "https://example.com"), cred.SignCount)
+	if err != nil {
+		t.Fatal("DID Auth error:", err)
+	}
+	if got != m {
+		t.Errorf("got verification method %s, want %s", got.ID.String(), m.ID.String())
+	}
+
+	// replay with the same counter
+	a := passkey.get(e.Challenge, "https://example.com")
+	_, _, err = e.VerifyDIDAuth(doc, a, d.SignCount+1)
+	if !errors.Is(err, ErrSignCount) {
+		t.Errorf("stale sign count got error %v, want ErrSignCount", err)
+	}
+
+	// phishing origin
+	_, _, err = e.VerifyDIDAuth(doc, passkey.get(e.Challenge, "https://example.org"), 0)
+	if !errors.Is(err, ErrAssertion) {
+		t.Errorf("foreign origin got error %v, want ErrAssertion", err)
+	}
+
+	// other challenge
+	_, _, err = e.VerifyDIDAuth(doc, passkey.get([]byte("old"), "https://example.com"), 0)
+	if !errors.Is(err, ErrAssertion) {
+		t.Errorf("challenge mismatch got error %v, want ErrAssertion", err)
+	}
+
+	// no challenge issued, which an empty client challenge would match
+	unset := e
+	unset.Challenge = nil
+	_, _, err = unset.VerifyDIDAuth(doc, passkey.get(nil, "https://example.com"), 0)
+	if !errors.Is(err, ErrAssertion) {
+		t.Errorf("without challenge got error %v, want ErrAssertion", err)
+	}
+
+	// not an authentication method
+	doc.Authentication = nil
+	_, _, err = e.VerifyDIDAuth(doc, passkey.get(e.Challenge, "https://example.com"), 0)
+	if !errors.Is(err, ErrAssertion) {
+		t.Errorf("without authentication relationship got error %v, want ErrAssertion", err)
+	}
+}
+
+func TestParseAuthenticatorDataErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		make([]byte, 36),
+		append(make([]byte, 32), FlagAttestedCredData, 0, 0, 0, 0),
+		append(make([]byte, 37), 0xff), // trailing data
+	} {
+		if d, err := ParseAuthenticatorData(data); err == nil {
+			t.Errorf("%x got %+v, want error", data, d)
+		}
+	}
+}
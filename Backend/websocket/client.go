@@ -0,0 +1,164 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults of Client
+const (
+	PingIntervalDefault = 30 * time.Second
+	HelloTimeoutDefault = 10 * time.Second
+	MaxBackoffDefault   = 30 * time.Second
+)
+
+// Client keeps a connection to a WebSocket server, with reconnects on failure.
+// Fields must not change once Run is invoked.
+type Client struct {
+	URL    string
+	Dialer Dialer
+
+	// Hello, when set, runs on each new connection before any other
+	// traffic, e.g., for authentication or to resume a stream. Errors
+	// count as a failed connection attempt.
+	Hello func(ctx context.Context, conn *Conn) error
+
+	// Receive, when set, gets each message in order of arrival.
+	Receive func(messageType int, data []byte)
+
+	// Disconnected, when set, gets the cause of each connection loss,
+	// including failed connection attempts.
+	Disconnected func(err error)
+
+	PingInterval time.Duration // keepalive, with PingIntervalDefault for zero
+	HelloTimeout time.Duration // with HelloTimeoutDefault for zero
+	MaxBackoff   time.Duration // reconnect delay limit, with MaxBackoffDefault for zero
+
+	mutex sync.Mutex
+	conn  *Conn         // current connection, if any
+	ready chan struct{} // closed once conn is set
+}
+
+// Run connects, and it reconnects after each loss, with exponential backoff,
+// until ctx is done.
+func (c *Client) Run(ctx context.Context) error {
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = MaxBackoffDefault
+	}
+	const minBackoff = 100 * time.Millisecond
+	backoff := minBackoff
+	for {
+		connected, err := c.session(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.Disconnected != nil {
+			c.Disconnected(err)
+		}
+		if connected {
+			backoff = minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// Session runs one connection until its loss. Connected is false when the
+// dial or the hello failed.
+func (c *Client) session(ctx context.Context) (connected bool, err error) {
+	conn, err := c.Dialer.Dial(ctx, c.URL)
+	if err != nil {
+		return false, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.CloseStatus(CloseGoingAway, "")
+		case <-done:
+			conn.Close()
+		}
+	}()
+
+	if c.Hello != nil {
+		timeout := c.HelloTimeout
+		if timeout <= 0 {
+			timeout = HelloTimeoutDefault
+		}
+		conn.NetConn().SetDeadline(time.Now().Add(timeout))
+		if err := c.Hello(ctx, conn); err != nil {
+			return false, err
+		}
+		conn.NetConn().SetDeadline(time.Time{})
+	}
+
+	interval := c.PingInterval
+	if interval <= 0 {
+		interval = PingIntervalDefault
+	}
+	stop := conn.KeepAlive(interval)
+	defer stop()
+
+	c.mutex.Lock()
+	c.conn = conn
+	if c.ready == nil {
+		c.ready = make(chan struct{})
+	}
+	close(c.ready)
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		c.conn = nil
+		c.ready = make(chan struct{})
+		c.mutex.Unlock()
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		if c.Receive != nil {
+			c.Receive(messageType, data)
+		}
+	}
+}
+
+// ErrNotConnected signals the loss of a connection during a write.
+var ErrNotConnected = errors.New("websocket client not connected")
+
+// WriteMessage sends on the current connection. Without one, it waits for
+// Run to connect, until ctx is done. Messages may get lost with a connection,
+// so protocols need acknowledgements for reliable delivery.
+func (c *Client) WriteMessage(ctx context.Context, messageType int, data []byte) error {
+	for {
+		c.mutex.Lock()
+		conn := c.conn
+		if c.ready == nil {
+			c.ready = make(chan struct{})
+		}
+		ready := c.ready
+		c.mutex.Unlock()
+
+		if conn != nil {
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return fmt.Errorf("%w: %w", ErrNotConnected, err)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ready:
+		}
+	}
+}
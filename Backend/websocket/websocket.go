@@ -0,0 +1,464 @@
+// Package websocket implements the WebSocket protocol conform RFC 6455, with
+// whole messages as the unit of exchange. Control frames are handled within
+// the read of messages.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Message types, as frame opcodes
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+
+	closeFrame = 8
+	pingFrame  = 9
+	pongFrame  = 10
+)
+
+// Close status codes
+const (
+	CloseNormal      = 1000
+	CloseGoingAway   = 1001
+	CloseProtocol    = 1002
+	CloseUnsupported = 1003
+	CloseNoStatus    = 1005
+	ClosePolicy      = 1008
+	CloseTooBig      = 1009
+)
+
+// ReadLimitDefault is the message size limit of Conn.ReadMessage.
+const ReadLimitDefault = 1 << 20
+
+// ErrProtocol signals a violation of RFC 6455 by the remote end.
+var ErrProtocol = errors.New("websocket protocol violation")
+
+// ErrHandshake signals a failed opening handshake.
+var ErrHandshake = errors.New("websocket handshake failed")
+
+// CloseError is the close frame from the remote end.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed with status %d: %q", e.Code, e.Reason)
+}
+
+// “258EAFA5-E914-47DA-95CA-C5AB0DC85B11” is the GUID of section 1.3.
+func acceptKey(challenge string) string {
+	h := sha1.New()
+	h.Write([]byte(challenge))
+	h.Write([]byte("258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsUpgrade returns whether r requests a WebSocket.
+func IsUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet && headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade runs the server side of the opening handshake. Failures get an HTTP
+// error response.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !IsUpgrade(r) {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%w: no upgrade request", ErrHandshake)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "WebSocket version 13 required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%w: version %q", ErrHandshake, r.Header.Get("Sec-WebSocket-Version"))
+	}
+	challenge := r.Header.Get("Sec-WebSocket-Key")
+	if raw, err := base64.StdEncoding.DecodeString(challenge); err != nil || len(raw) != 16 {
+		http.Error(w, "malformed Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: key %q", ErrHandshake, challenge)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported on this connection", http.StatusHTTPVersionNotSupported)
+		return nil, fmt.Errorf("%w: HTTP response writer %T can not hijack", ErrHandshake, w)
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	rw.WriteString(acceptKey(challenge))
+	rw.WriteString("\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+	return newConn(conn, rw.Reader, false), nil
+}
+
+// Dialer opens client connections. The zero value is ready to use.
+type Dialer struct {
+	TLSConfig *tls.Config // for wss URLs
+	Header    http.Header // additional request headers, if any
+}
+
+// Dial runs the client side of the opening handshake on a "ws" or "wss" URL.
+func (d *Dialer) Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "ws":
+			host = net.JoinHostPort(u.Hostname(), "80")
+		case "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = new(net.Dialer).DialContext(ctx, "tcp", host)
+	case "wss":
+		config := d.TLSConfig
+		if config == nil {
+			config = new(tls.Config)
+		}
+		conn, err = (&tls.Dialer{Config: config}).DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("websocket URL scheme %q not supported", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := d.handshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (d *Dialer) handshake(conn net.Conn, u *url.URL) (*Conn, error) {
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	challenge := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for name, values := range d.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", challenge)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: HTTP status %q", ErrHandshake, resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(challenge) {
+		return nil, fmt.Errorf("%w: Sec-WebSocket-Accept mismatch", ErrHandshake)
+	}
+	return newConn(conn, br, true), nil
+}
+
+// Conn is a WebSocket connection. Reads must be sequential. Multiple
+// goroutines may invoke writes simultaneously.
+type Conn struct {
+	// ReadLimit is the maximum message size in bytes, with
+	// ReadLimitDefault for zero.
+	ReadLimit int
+
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool // masks frames
+
+	writeMutex sync.Mutex
+	closeSent  bool
+
+	lastRead atomic.Int64 // Unix nanoseconds of the last frame
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool) *Conn {
+	c := &Conn{conn: conn, br: br, client: client}
+	c.lastRead.Store(time.Now().UnixNano())
+	return c
+}
+
+// NetConn returns the underlying connection, e.g., for deadlines.
+func (c *Conn) NetConn() net.Conn { return c.conn }
+
+// WriteMessage sends data as one frame of type TextMessage or BinaryMessage.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket message type %d not supported", messageType)
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// Ping sends a ping frame. The pong is handled by ReadMessage.
+func (c *Conn) Ping(payload []byte) error {
+	if len(payload) > 125 {
+		return errors.New("websocket ping payload exceeds 125 bytes")
+	}
+	return c.writeFrame(pingFrame, payload)
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == closeFrame {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | byte(opcode) // final fragment
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	var mask [4]byte
+	if c.client {
+		rand.Read(mask[:])
+		header[1] |= 0x80
+		header = append(header, mask[:]...)
+	}
+	frame := append(header, payload...)
+	if c.client {
+		maskBytes(mask, frame[len(header):])
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
+
+// ReadMessage returns the next message, with its type. Pings get a pong, and
+// pongs are discarded. A close from the remote end is confirmed, and it
+// returns as *CloseError.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	limit := c.ReadLimit
+	if limit <= 0 {
+		limit = ReadLimitDefault
+	}
+	for {
+		final, opcode, payload, err := c.readFrame(limit - len(data))
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				c.closeWith(CloseProtocol, "")
+			}
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case pingFrame:
+			if err := c.writeFrame(pongFrame, payload); err != nil && !errors.Is(err, net.ErrClosed) {
+				return 0, nil, err
+			}
+			continue
+		case pongFrame:
+			continue
+		case closeFrame:
+			e := &CloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				e.Code = int(binary.BigEndian.Uint16(payload))
+				e.Reason = string(payload[2:])
+			}
+			c.closeWith(e.Code, "")
+			return 0, nil, e
+		case 0: // continuation
+			if messageType == 0 {
+				return 0, nil, fmt.Errorf("%w: continuation frame without message", ErrProtocol)
+			}
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, fmt.Errorf("%w: new message within fragmented message", ErrProtocol)
+			}
+			messageType = opcode
+		default:
+			c.closeWith(CloseUnsupported, "")
+			return 0, nil, fmt.Errorf("%w: opcode %d", ErrProtocol, opcode)
+		}
+		data = append(data, payload...)
+		if final {
+			return messageType, data, nil
+		}
+	}
+}
+
+var errTooBig = errors.New("websocket message exceeds read limit")
+
+func (c *Conn) readFrame(limit int) (final bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	c.lastRead.Store(time.Now().UnixNano())
+	final = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", ErrProtocol)
+	}
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, fmt.Errorf("%w: frame masking from wrong end", ErrProtocol)
+	}
+
+	size := uint64(head[1] & 0x7f)
+	switch size {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	}
+	if opcode >= closeFrame && (size > 125 || !final) {
+		return false, 0, nil, fmt.Errorf("%w: control frame of %d bytes", ErrProtocol, size)
+	}
+	if opcode < closeFrame && size > uint64(limit) {
+		c.closeWith(CloseTooBig, "")
+		return false, 0, nil, errTooBig
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return final, opcode, payload, nil
+}
+
+func (c *Conn) closeWith(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if code == CloseNoStatus {
+		payload = nil // reserved for absence
+	}
+	err := c.writeFrame(closeFrame, append(payload, reason...))
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close sends a normal close, and it closes the connection without waiting
+// for confirmation.
+func (c *Conn) Close() error {
+	return c.CloseStatus(CloseNormal, "")
+}
+
+// CloseStatus is like Close, with a status code and a reason for the remote
+// end. Reasons are limited to 123 bytes.
+func (c *Conn) CloseStatus(code int, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.closeWith(code, reason)
+	return c.conn.Close()
+}
+
+// KeepAlive sends a ping every interval, and it closes the connection when
+// nothing arrived for two intervals, such that a silent peer fails the read in
+// progress. Pongs count only while ReadMessage runs. Stop ends the pings.
+func (c *Conn) KeepAlive(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if time.Since(time.Unix(0, c.lastRead.Load())) > 2*interval {
+				c.conn.Close()
+				return
+			}
+			if err := c.Ping(nil); err != nil {
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEcho(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			t.Error("upgrade error:", err)
+			return
+		}
+		defer c.Close()
+		c.ReadLimit = 1 << 17
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(typ, data); err != nil {
+				t.Error("echo error:", err)
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := new(Dialer).Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/echo")
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	defer c.Close()
+
+	if err := c.Ping([]byte("hello")); err != nil {
+		t.Fatal("ping error:", err)
+	}
+	for _, size := range []int{0, 125, 126, 0xffff, 0x10000} {
+		msg := bytes.Repeat([]byte{'a'}, size)
+		if err := c.WriteMessage(BinaryMessage, msg); err != nil {
+			t.Fatal("write error:", err)
+		}
+		typ, got, err := c.ReadMessage()
+		if err != nil || typ != BinaryMessage || !bytes.Equal(got, msg) {
+			t.Fatalf("echo of %d bytes got type %d, %d bytes, error %v", size, typ, len(got), err)
+		}
+	}
+
+	// exceeds the server limit
+	if err := c.WriteMessage(TextMessage, make([]byte, 1<<17+1)); err != nil {
+		t.Fatal("write error:", err)
+	}
+	var closed *CloseError
+	if _, _, err := c.ReadMessage(); !errors.As(err, &closed) || closed.Code != CloseTooBig {
+		t.Errorf("oversized message got error %v, want close status %d", err, CloseTooBig)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) { Upgrade(w, r) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("plain GET got HTTP status %q", resp.Status)
+	}
+	if _, err := new(Dialer).Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")); !errors.Is(err, ErrHandshake) {
+		t.Errorf("dial on not found got error %v, want ErrHandshake", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	var sessions atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			t.Error("upgrade error:", err)
+			return
+		}
+		defer c.Close()
+		if _, hello, err := c.ReadMessage(); err != nil || string(hello) != "hello" {
+			t.Errorf("got hello %q, error %v", hello, err)
+			return
+		}
+		n := sessions.Add(1)
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(typ, data); err != nil {
+				return
+			}
+			if n == 1 {
+				return // drop to test the reconnect
+			}
+		}
+	}))
+	defer srv.Close()
+
+	received := make(chan string, 4)
+	c := &Client{
+		URL: "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Hello: func(ctx context.Context, conn *Conn) error {
+			return conn.WriteMessage(TextMessage, []byte("hello"))
+		},
+		Receive: func(_ int, data []byte) { received <- string(data) },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	timeout := time.After(5 * time.Second)
+	for _, msg := range []string{"first", "second", "third"} {
+		for {
+			if err := c.WriteMessage(ctx, TextMessage, []byte(msg)); err != nil {
+				t.Log("write error:", err)
+				continue // lost with the first session
+			}
+			select {
+			case got := <-received:
+				if got != msg {
+					t.Fatalf("got %q, want %q", got, msg)
+				}
+			case <-time.After(100 * time.Millisecond):
+				continue // lost with the first session
+			case <-timeout:
+				t.Fatal("no echo of", msg)
+			}
+			break
+		}
+	}
+	if n := sessions.Load(); n != 2 {
+		t.Errorf("got %d sessions, want 2", n)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got run error %v, want context.Canceled", err)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			t.Error("upgrade error:", err)
+			return
+		}
+		defer c.Close()
+		time.Sleep(time.Second) // no reads, so no pongs
+	}))
+	defer srv.Close()
+
+	c, err := new(Dialer).Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	defer c.Close()
+	stop := c.KeepAlive(20 * time.Millisecond)
+	defer stop()
+	start := time.Now()
+	if _, _, err := c.ReadMessage(); err == nil {
+		t.Fatal("read from silent peer got no error")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("silent peer detected after %s", d)
+	}
+}
@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: UNLICENSED
+pragma solidity ^0.8.13;
+
+
+import "./ownership/owner.sol";
+
+/**
+ * @title CheckpointAnchor
+ * @dev Public record of IDChain state roots. Heights must increase, such that
+ * each checkpoint is anchored at most once.
+ */
+contract CheckpointAnchor is Ownable {
+    uint64 public height;
+    bytes32 public root;
+
+    event Anchored(uint64 indexed height, bytes32 root);
+
+    function anchor(uint64 _height, bytes32 _root) public onlyOwner {
+        require(_height > height, "height not increasing");
+        height = _height;
+        root = _root;
+        emit Anchored(_height, _root);
+    }
+}
@@ -1,3 +1,12 @@
 module EncrypteDL/IDChain
 
 go 1.22.5
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.3.0
+	github.com/google/go-tpm v0.9.8
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/crypto v0.25.0
+)
+
+require golang.org/x/sys v0.22.0 // indirect